@@ -140,6 +140,8 @@ var (
 		utils.VMTraceFlag,
 		utils.VMTraceJsonConfigFlag,
 		utils.VMWitnessStatsFlag,
+		utils.VMSGXBootstrapFlag,
+		utils.VMSGXSealingFlag,
 		utils.VMStatelessSelfValidationFlag,
 		utils.NetworkIdFlag,
 		utils.EthStatsURLFlag,
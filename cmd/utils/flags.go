@@ -611,6 +611,17 @@ var (
 		Usage:    "Generate execution witnesses and self-check against them (testing purpose)",
 		Category: flags.VMCategory,
 	}
+	VMSGXBootstrapFlag = &cli.BoolFlag{
+		Name:     "sgx.bootstrap",
+		Usage:    "Generate the SGX network master secret if none is sealed (first node of a new network only)",
+		Category: flags.VMCategory,
+	}
+	VMSGXSealingFlag = &cli.StringFlag{
+		Name:     "sgx.sealing",
+		Usage:    "Enclave identity the SGX key store is sealed to (mrsigner, mrenclave, or file for an insecure development key)",
+		Value:    "mrsigner",
+		Category: flags.VMCategory,
+	}
 	// API options.
 	RPCGlobalGasCapFlag = &cli.Uint64Flag{
 		Name:     "rpc.gascap",
@@ -1808,6 +1819,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.Bool(VMWitnessStatsFlag.Name) {
 		cfg.StatelessSelfValidation = true
 	}
+	if ctx.IsSet(VMSGXBootstrapFlag.Name) {
+		cfg.SGXBootstrap = ctx.Bool(VMSGXBootstrapFlag.Name)
+	}
+	if ctx.IsSet(VMSGXSealingFlag.Name) {
+		cfg.SGXSealing = ctx.String(VMSGXSealingFlag.Name)
+	}
 
 	if ctx.IsSet(RPCGlobalGasCapFlag.Name) {
 		cfg.RPCGasCap = ctx.Uint64(RPCGlobalGasCapFlag.Name)
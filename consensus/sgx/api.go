@@ -1,9 +1,17 @@
 package sgx
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 // API RPC API for SGX consensus
@@ -49,32 +57,83 @@ func (api *API) GetBlockQuality(blockHash common.Hash) (*BlockQuality, error) {
 	return quality, nil
 }
 
-// GetNodeReputation returns the reputation data for a node
-func (api *API) GetNodeReputation(address common.Address) (*NodeReputation, error) {
-	return api.engine.reputationSystem.GetReputation(address)
-}
-
-// GetUptimeScore returns the uptime score for a node
-func (api *API) GetUptimeScore(address common.Address) (*UptimeData, error) {
-	// Network statistics constants for uptime calculation
-	const (
-		defaultObservers = 10
-		defaultTotalTxs  = uint64(10000)
-		defaultTotalGas  = uint64(300000000)
-	)
-	
-	uptimeData := api.engine.uptimeCalculator.CalculateUptimeScore(
-		address,
-		defaultObservers,
-		defaultTotalTxs,
-		defaultTotalGas,
-	)
+// stateAt opens the state of the given block, the current head if nil. Node
+// records live in the incentive contract storage, so they can be read back at
+// any block whose state is available.
+func (api *API) stateAt(blockNrOrHash *rpc.BlockNumberOrHash) (vm.StateDB, *types.Header, error) {
+	var header *types.Header
+	if blockNrOrHash == nil {
+		header = api.chain.CurrentHeader()
+	} else if hash, ok := blockNrOrHash.Hash(); ok {
+		header = api.chain.GetHeaderByHash(hash)
+	} else if number, ok := blockNrOrHash.Number(); ok {
+		if number < 0 {
+			header = api.chain.CurrentHeader()
+		} else {
+			header = api.chain.GetHeaderByNumber(uint64(number))
+		}
+	}
+	if header == nil {
+		return nil, nil, ErrInvalidBlock
+	}
+	reader, ok := api.chain.(stateReader)
+	if !ok {
+		return nil, nil, errors.New("chain state not available")
+	}
+	statedb, err := reader.StateAt(header.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	return statedb, header, nil
+}
+
+// GetNodeReputation returns the reputation data for a node at the given block
+func (api *API) GetNodeReputation(address common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (*NodeReputation, error) {
+	statedb, _, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return api.engine.reputationSystem.GetReputation(statedb, address)
+}
+
+// GetUptimeScore returns the uptime score for a node at the given block. The
+// consensus score is the local node's view of the network and not part of
+// the comprehensive score.
+func (api *API) GetUptimeScore(address common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (*UptimeData, error) {
+	statedb, _, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	uptimeData := api.engine.uptimeCalculator.CalculateUptimeScore(statedb, address)
+	uptimeData.ConsensusScore = api.engine.uptimeCalculator.ConsensusScore(address)
 	return uptimeData, nil
 }
 
-// IsNodeExcluded checks if a node is excluded due to penalties
-func (api *API) IsNodeExcluded(address common.Address) bool {
-	return api.engine.reputationSystem.IsExcluded(address)
+// GetHeartbeatRecord returns the on-chain heartbeat record for a node at the given block
+func (api *API) GetHeartbeatRecord(address common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (*HeartbeatRecord, error) {
+	statedb, _, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return api.engine.uptimeCalculator.heartbeatTracker.GetHeartbeatRecord(statedb, address), nil
+}
+
+// IsNodeExcluded checks if a node is excluded due to penalties at the given block
+func (api *API) IsNodeExcluded(address common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (bool, error) {
+	statedb, header, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return false, err
+	}
+	return api.engine.reputationSystem.IsExcluded(statedb, address, header.Time), nil
+}
+
+// GetKeyPermissions returns the permissions granted on an SGX key at the given block
+func (api *API) GetKeyPermissions(keyID common.Hash, blockNrOrHash *rpc.BlockNumberOrHash) ([]vm.Permission, error) {
+	statedb, _, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return vm.NewStatePermissionManager(statedb).GetPermissions(keyID)
 }
 
 // GetConfig returns the current SGX engine configuration
@@ -82,12 +141,78 @@ func (api *API) GetConfig() *Config {
 	return api.engine.config
 }
 
-// GetPenaltyCount returns the penalty count for a node
-func (api *API) GetPenaltyCount(address common.Address) (uint64, error) {
-	return api.engine.penaltyManager.GetPenaltyCount(address)
+// GetPenaltyCount returns the penalty count for a node at the given block
+func (api *API) GetPenaltyCount(address common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (uint64, error) {
+	statedb, _, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return 0, err
+	}
+	return api.engine.penaltyManager.GetPenaltyCount(statedb, address)
 }
 
-// GetNodePriority returns the priority score for a node
-func (api *API) GetNodePriority(address common.Address) (uint64, error) {
-	return api.engine.reputationSystem.GetNodePriority(address)
+// GetNodePriority returns the priority score for a node at the given block
+func (api *API) GetNodePriority(address common.Address, blockNrOrHash *rpc.BlockNumberOrHash) (uint64, error) {
+	statedb, _, err := api.stateAt(blockNrOrHash)
+	if err != nil {
+		return 0, err
+	}
+	return api.engine.reputationSystem.GetNodePriority(statedb, address)
+}
+
+// SubmitDoubleSignEvidence verifies two headers sealed by the same producer on
+// the same parent and queues them for inclusion in a locally produced block.
+func (api *API) SubmitDoubleSignEvidence(first, second *types.Header) error {
+	evidence := &DoubleSignEvidence{First: first, Second: second}
+	if first != nil && second != nil && bytes.Compare(api.engine.SealHash(first).Bytes(), api.engine.SealHash(second).Bytes()) > 0 {
+		evidence.First, evidence.Second = second, first
+	}
+	return api.engine.SubmitEvidence(api.chain, evidence)
+}
+
+// GetCheckpoint returns the checkpoint of the epoch containing the given
+// canonical block, the current head if nil.
+func (api *API) GetCheckpoint(number *rpc.BlockNumber) (*Checkpoint, error) {
+	header := api.chain.CurrentHeader()
+	if number != nil && *number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, ErrInvalidBlock
+	}
+	checkpoint, ok := api.engine.checkpointEpoch(header.Number.Uint64())
+	if !ok {
+		return nil, fmt.Errorf("%w: no checkpoint before block %d", ErrInvalidCheckpoint, header.Number)
+	}
+	if header = api.chain.GetHeaderByNumber(checkpoint); header == nil {
+		return nil, ErrInvalidBlock
+	}
+	return decodeCheckpoint(header)
+}
+
+// GetBlockRandomness returns the randomness of the given canonical block, the
+// current head if nil, with the VRF proof needed to verify it.
+func (api *API) GetBlockRandomness(number *rpc.BlockNumber) (*BlockRandomness, error) {
+	header := api.chain.CurrentHeader()
+	if number != nil && *number >= 0 {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, ErrInvalidBlock
+	}
+	return blockRandomness(api.chain.Config().ChainID, header)
+}
+
+// GetTransactionKey returns the public key the calls of encrypted transactions
+// are encrypted to, as a 65 byte uncompressed key. Its secret is shared among
+// the key holders of the network, none of which can decrypt alone.
+func (api *API) GetTransactionKey() (hexutil.Bytes, error) {
+	params, err := vm.TransactionKeyParams(api.chain.Config())
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.DecompressPubkey(params.GroupKey())
+	if err != nil {
+		return nil, err
+	}
+	return crypto.FromECDSAPub(key), nil
 }
@@ -125,6 +125,10 @@ func (bp *BlockProducer) tryProduceBlock() {
 		}
 	}
 
+	// 出块条件使用链头状态中生效的治理参数
+	if head := bp.chain.CurrentBlock(); head != nil {
+		bp.onDemandCtrl.SetConfig(bp.configAt(head))
+	}
 	shouldProduce := bp.onDemandCtrl.ShouldProduceBlock(bp.lastBlockTime, pendingTxCount, pendingGasTotal)
 	
 	if !shouldProduce {
@@ -152,6 +156,13 @@ func (bp *BlockProducer) produceBlock() error {
 		return ErrInvalidConfig
 	}
 	
+	parent := bp.chain.CurrentBlock()
+	if parent == nil {
+		return ErrUnknownAncestor
+	}
+	// 区块限制由父区块状态中的治理参数决定
+	config := bp.configAt(parent)
+
 	pending := bp.txPool.Pending(false)
 	var transactions []*types.Transaction
 	gasLimit := uint64(0)
@@ -159,32 +170,27 @@ func (bp *BlockProducer) produceBlock() error {
 	// 收集交易直到达到 Gas 限制或交易数量限制
 	for _, txs := range pending {
 		for _, tx := range txs {
-			if gasLimit+tx.Gas() > bp.config.MaxGasPerBlock {
+			if gasLimit+tx.Gas() > config.MaxGasPerBlock {
 				break
 			}
-			if len(transactions) >= int(bp.config.MaxTxPerBlock) {
+			if len(transactions) >= config.MaxTxPerBlock {
 				break
 			}
 			transactions = append(transactions, tx)
 			gasLimit += tx.Gas()
 		}
-		if len(transactions) >= int(bp.config.MaxTxPerBlock) {
+		if len(transactions) >= config.MaxTxPerBlock {
 			break
 		}
 	}
 	
 	log.Info("BlockProducer: Collected transactions", "count", len(transactions), "gasLimit", gasLimit)
 	
-	// 2. 获取父区块并创建区块头
-	parent := bp.chain.CurrentBlock()
-	if parent == nil {
-		return ErrUnknownAncestor
-	}
-	
+	// 2. 创建区块头
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
-		GasLimit:   bp.config.MaxGasPerBlock,
+		GasLimit:   config.MaxGasPerBlock,
 		GasUsed:    0, // Will be set after execution
 		Time:       uint64(time.Now().Unix()),
 		Difficulty: big.NewInt(1), // PoA-SGX 固定难度为 1
@@ -223,9 +229,24 @@ func (bp *BlockProducer) produceBlock() error {
 		return err
 	}
 	
+	// 先揭示之前区块提交的加密交易并使超出揭示窗口的交易过期，等待解密份额的交易不阻塞其他交易
+	if coreChain.Config().IsSGXEncryptedTx(header.Number) {
+		reveals := core.EncryptedTxReveals(coreChain.Config(), coreChain, parent, statedb, bp.engine.decryptionShares())
+		transactions = append(reveals, transactions...)
+	}
+
 	// 6. 执行交易
 	processor := core.NewStateProcessor(coreChain)
-	vmConfig := vm.Config{}
+	// SGX 预编译合约使用与区块导入相同的密钥库，修改只保留在内存中，
+	// 密封后的区块导入时重新执行并写入。主密钥加载前不出块
+	chainConfig := coreChain.GetVMConfig()
+	if err := chainConfig.SGXKeyLayers.Ready(); err != nil {
+		return err
+	}
+	vmConfig := vm.Config{
+		SGXKeyStore:  chainConfig.SGXKeyStore,
+		SGXKeyLayers: chainConfig.SGXKeyLayers,
+	}.WithSGXKeys(parentBlock.Hash())
 	
 	body := &types.Body{
 		Transactions: transactions,
@@ -282,8 +303,14 @@ func (bp *BlockProducer) produceBlock() error {
 		log.Error("BlockProducer: Failed to insert block", "err", err, "number", sealedBlock.NumberU64())
 		return err
 	}
-	
-	log.Info("BlockProducer: Block produced successfully", 
+
+	// 11. 登记为本高度的候选并广播给其他节点
+	if err := bp.engine.AddCandidate(sealedBlock, time.Now()); err != nil {
+		log.Warn("BlockProducer: Failed to record candidate", "err", err, "number", sealedBlock.NumberU64())
+	}
+	bp.engine.sealedFeed.Send(SealedBlockEvent{Block: sealedBlock})
+
+	log.Info("BlockProducer: Block produced successfully",
 		"number", sealedBlock.NumberU64(), 
 		"hash", sealedBlock.Hash().Hex(),
 		"txs", len(transactions),
@@ -315,6 +342,16 @@ func (bp *BlockProducer) sealBlockSync(block *types.Block) (*types.Block, error)
 	}
 }
 
+// configAt 返回在父区块状态上生效的配置，状态不可用时使用生产者的配置
+func (bp *BlockProducer) configAt(parent *types.Header) *Config {
+	config, err := bp.engine.configAt(bp.chain, parent)
+	if err != nil {
+		log.Warn("BlockProducer: Failed to load governance parameters", "number", parent.Number, "err", err)
+		return bp.config
+	}
+	return config
+}
+
 // SetLastBlockTime 设置最后出块时间（用于测试）
 func (bp *BlockProducer) SetLastBlockTime(t time.Time) {
 	bp.mu.Lock()
@@ -356,7 +393,7 @@ func (bp *BlockProducer) ProduceBlockNow(
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
-		GasLimit:   bp.config.MaxGasPerBlock,
+		GasLimit:   bp.configAt(parent).MaxGasPerBlock,
 		GasUsed:    gasUsed,
 		Time:       uint64(time.Now().Unix()),
 		Coinbase:   coinbase,
@@ -0,0 +1,312 @@
+package sgx
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// MaxRankedProducers 写入 SGXExtra 的排名上限（第1名, 第2名, 第3名）
+	MaxRankedProducers = 3
+
+	// candidateRetention 候选轮次保留的区块高度数
+	candidateRetention = 64
+
+	// maxCandidatesPerRound 每个父区块下保留的候选区块上限，防止内存被填满
+	maxCandidatesPerRound = 64
+
+	// maxRankingProofSize 单个排名证明区块头 RLP 编码后的大小上限，
+	// 超出上限的兄弟区块不参与排名
+	maxRankingProofSize = 256 * 1024
+)
+
+// candidateRound 同一父区块下的一轮候选区块（同高度的兄弟区块）
+type candidateRound struct {
+	number     uint64                   // 候选区块高度
+	opened     time.Time                // 收到第一个候选的时间，候选窗口从此开始
+	candidates []*BlockCandidate        // 按收到顺序排列
+	known      map[common.Hash]struct{} // 已收录的区块哈希
+}
+
+// CandidatePool 按父区块收集同高度的竞争区块
+// 窗口从收到第一个候选开始，持续 CandidateWindowMs，窗口外收到的区块不参与排名
+type CandidatePool struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	rounds map[common.Hash]*candidateRound // 父区块哈希 -> 候选轮次
+}
+
+// NewCandidatePool 创建候选区块池
+func NewCandidatePool(config *Config) *CandidatePool {
+	return &CandidatePool{
+		window: time.Duration(config.CandidateWindowMs) * time.Millisecond,
+		rounds: make(map[common.Hash]*candidateRound),
+	}
+}
+
+// Add 记录一个候选区块及其收到时间
+// 返回 false 表示区块已收录、窗口已关闭或本轮候选已满
+func (p *CandidatePool) Add(block *types.Block, producer common.Address, receivedAt time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	number := block.NumberU64()
+	round := p.rounds[block.ParentHash()]
+	if round == nil {
+		if p.stale(number) {
+			return false
+		}
+		round = &candidateRound{
+			number: number,
+			opened: receivedAt,
+			known:  make(map[common.Hash]struct{}),
+		}
+		p.rounds[block.ParentHash()] = round
+		p.prune(number)
+	}
+	if _, ok := round.known[block.Hash()]; ok {
+		return false
+	}
+	if receivedAt.Sub(round.opened) > p.window || len(round.candidates) >= maxCandidatesPerRound {
+		return false
+	}
+	// 较早的收到时间（例如本地区块晚于远程区块登记）会提前窗口起点
+	if receivedAt.Before(round.opened) {
+		round.opened = receivedAt
+	}
+	round.known[block.Hash()] = struct{}{}
+	round.candidates = append(round.candidates, &BlockCandidate{
+		Block:      block,
+		Producer:   producer,
+		ReceivedAt: receivedAt,
+	})
+	return true
+}
+
+// Candidates 返回父区块下窗口内收到的候选区块，按收到时间排序
+func (p *CandidatePool) Candidates(parent common.Hash) []*BlockCandidate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	round := p.rounds[parent]
+	if round == nil {
+		return nil
+	}
+	candidates := make([]*BlockCandidate, 0, len(round.candidates))
+	for _, c := range round.candidates {
+		if c.ReceivedAt.Sub(round.opened) <= p.window {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ReceivedAt.Before(candidates[j].ReceivedAt)
+	})
+	return candidates
+}
+
+// Ranking 计算 head 所在高度的生产者排名，写入下一个区块的 SGXExtra
+// head 已被链选中，其生产者固定为第1名；其余兄弟区块按 rankSiblings 的确定性顺序排列，
+// 同一生产者只计一次，最多 MaxRankedProducers 名。
+// 同时返回第2名起各生产者的兄弟区块头作为排名证明，sealed 不为 nil 时跳过其拒绝的区块
+func (p *CandidatePool) Ranking(head *types.Header, producer common.Address, sealed func(*types.Header) bool) ([]common.Address, []*types.Header) {
+	var siblings []rankedSibling
+	for _, c := range p.Candidates(head.ParentHash) {
+		header := c.Block.Header()
+		if header.Hash() == head.Hash() || !rankingProofSizeOK(header) {
+			continue
+		}
+		if sealed != nil && !sealed(header) {
+			continue
+		}
+		siblings = append(siblings, rankedSibling{producer: c.Producer, header: header})
+	}
+	ranking, proofs := rankSiblings(siblings, producer)
+	return append([]common.Address{producer}, ranking...), proofs
+}
+
+// rankedSibling 参与排名的兄弟区块头及其生产者
+type rankedSibling struct {
+	producer common.Address
+	header   *types.Header
+}
+
+// compareSiblings 兄弟区块在排名中的确定性顺序：区块时间早者在前，相同时按区块哈希升序
+func compareSiblings(a, b *types.Header) int {
+	if a.Time != b.Time {
+		if a.Time < b.Time {
+			return -1
+		}
+		return 1
+	}
+	return a.Hash().Cmp(b.Hash())
+}
+
+// rankSiblings 按 compareSiblings 排列兄弟区块，跳过第1名 first 和重复的生产者
+// （同一生产者取顺序最靠前的区块），返回第2名起的生产者及其排名证明
+func rankSiblings(siblings []rankedSibling, first common.Address) ([]common.Address, []*types.Header) {
+	sort.SliceStable(siblings, func(i, j int) bool {
+		return compareSiblings(siblings[i].header, siblings[j].header) < 0
+	})
+	var (
+		ranking = []common.Address{first}
+		proofs  []*types.Header
+	)
+	for _, s := range siblings {
+		if len(ranking) >= MaxRankedProducers {
+			break
+		}
+		if containsAddress(ranking, s.producer) {
+			continue
+		}
+		ranking = append(ranking, s.producer)
+		proofs = append(proofs, s.header)
+	}
+	return ranking[1:], proofs
+}
+
+// rankingProofSizeOK 检查兄弟区块头编码后不超过 maxRankingProofSize
+func rankingProofSizeOK(header *types.Header) bool {
+	enc, err := rlp.EncodeToBytes(header)
+	return err == nil && len(enc) <= maxRankingProofSize
+}
+
+// stale 判断高度是否已低于保留范围
+func (p *CandidatePool) stale(number uint64) bool {
+	for _, round := range p.rounds {
+		if round.number >= number+candidateRetention {
+			return true
+		}
+	}
+	return false
+}
+
+// prune 删除低于保留范围的候选轮次
+func (p *CandidatePool) prune(head uint64) {
+	if head < candidateRetention {
+		return
+	}
+	for parent, round := range p.rounds {
+		if round.number <= head-candidateRetention {
+			delete(p.rounds, parent)
+		}
+	}
+}
+
+func containsAddress(list []common.Address, addr common.Address) bool {
+	for _, a := range list {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// SealedBlockEvent 本地生产的区块已插入链，需要广播给其他节点
+type SealedBlockEvent struct {
+	Block *types.Block
+}
+
+// AddCandidate 将收到的区块（本地生产或网络广播）登记为同高度的候选
+func (e *SGXEngine) AddCandidate(block *types.Block, receivedAt time.Time) error {
+	producer, err := e.Author(block.Header())
+	if err != nil {
+		return err
+	}
+	e.candidatePool.Add(block, producer, receivedAt)
+	e.ObserveSealed(block.Header())
+	return nil
+}
+
+// Candidates 返回父区块下候选窗口内收到的同高度区块
+func (e *SGXEngine) Candidates(parent common.Hash) []*BlockCandidate {
+	return e.candidatePool.Candidates(parent)
+}
+
+// SubscribeSealedBlocks 订阅本地生产的区块
+func (e *SGXEngine) SubscribeSealedBlocks(ch chan<- SealedBlockEvent) event.Subscription {
+	return e.sealedFeed.Subscribe(ch)
+}
+
+// ranking 计算以 parent 为父区块的新区块应写入的生产者排名和排名证明，
+// 只收录封装可以验证的兄弟区块
+func (e *SGXEngine) ranking(chainID *big.Int, parent *types.Header) ([]common.Address, []*types.Header) {
+	if parent.Number.Sign() == 0 {
+		return nil, nil
+	}
+	producer, err := e.Author(parent)
+	if err != nil {
+		return nil, nil
+	}
+	return e.candidatePool.Ranking(parent, producer, func(header *types.Header) bool {
+		_, _, err := e.verifySealedHeader(chainID, header)
+		return err == nil
+	})
+}
+
+// verifyRanking 验证区块提交的排名：最多 MaxRankedProducers 名、无重复，
+// 且第1名必须是父区块的生产者。第2名起的每名生产者都必须附带其在父区块高度
+// 密封的兄弟区块头，没有证明的名次不能参与奖励分配。
+// 排名证明必须按 compareSiblings 严格递增，生产者不能调整名次。
+// 验证只依赖区块头携带的排名证明，不使用节点本地、随时序变化的候选池，
+// 所有节点（包括之后同步的节点）对同一区块得出相同结论；候选池只在 Prepare 构建排名时使用
+func (e *SGXEngine) verifyRanking(chainID *big.Int, ranking []common.Address, proofs []*types.Header, parent *types.Header) error {
+	if len(ranking) == 0 {
+		if len(proofs) != 0 {
+			return fmt.Errorf("%w: %d proofs without ranking", ErrInvalidRanking, len(proofs))
+		}
+		return nil
+	}
+	if len(ranking) > MaxRankedProducers {
+		return fmt.Errorf("%w: %d producers ranked", ErrInvalidRanking, len(ranking))
+	}
+	for i := range ranking {
+		if containsAddress(ranking[:i], ranking[i]) {
+			return fmt.Errorf("%w: duplicate producer %s", ErrInvalidRanking, ranking[i])
+		}
+	}
+	if parent.Number.Sign() == 0 {
+		return fmt.Errorf("%w: genesis has no producer", ErrInvalidRanking)
+	}
+	producer, err := e.Author(parent)
+	if err != nil {
+		return err
+	}
+	if ranking[0] != producer {
+		return fmt.Errorf("%w: first %s, parent producer %s", ErrInvalidRanking, ranking[0], producer)
+	}
+	if len(proofs) != len(ranking)-1 {
+		return fmt.Errorf("%w: %d proofs for %d ranked producers", ErrInvalidRanking, len(proofs), len(ranking))
+	}
+	for i, proof := range proofs {
+		rank := i + 2
+		if proof == nil || proof.Number == nil {
+			return fmt.Errorf("%w: rank %d: missing proof", ErrInvalidRanking, rank)
+		}
+		if !rankingProofSizeOK(proof) {
+			return fmt.Errorf("%w: rank %d: proof exceeds %d bytes", ErrInvalidRanking, rank, maxRankingProofSize)
+		}
+		if proof.Number.Cmp(parent.Number) != 0 || proof.ParentHash != parent.ParentHash || proof.Hash() == parent.Hash() {
+			return fmt.Errorf("%w: rank %d: proof is not a sibling of the parent", ErrInvalidRanking, rank)
+		}
+		if i > 0 && compareSiblings(proofs[i-1], proof) >= 0 {
+			return fmt.Errorf("%w: rank %d: proof out of order", ErrInvalidRanking, rank)
+		}
+		extra, _, err := e.verifySealedHeader(chainID, proof)
+		if err != nil {
+			return fmt.Errorf("%w: rank %d: %v", ErrInvalidRanking, rank, err)
+		}
+		if nodeAddress(extra.ProducerID) != ranking[rank-1] {
+			return fmt.Errorf("%w: rank %d: proof sealed by %s", ErrInvalidRanking, rank, nodeAddress(extra.ProducerID))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package sgx
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// candidateTestBlock returns a block at height 1 of parent 0x01 sealed by the
+// given producer ID, ranked among its siblings through its timestamp.
+func candidateTestBlock(t *testing.T, producerID byte, timestamp uint64) *types.Block {
+	extra, err := (&SGXExtra{ProducerID: []byte{producerID}, SGXQuote: make([]byte, 32)}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.NewBlockWithHeader(&types.Header{
+		ParentHash: common.Hash{0x01},
+		Number:     big.NewInt(1),
+		Time:       timestamp,
+		Difficulty: big.NewInt(1),
+		Extra:      extra,
+	})
+}
+
+func TestCandidatePoolWindow(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	now := time.Unix(1_000_000, 0)
+
+	first := candidateTestBlock(t, 1, 10)
+	second := candidateTestBlock(t, 2, 11)
+	late := candidateTestBlock(t, 3, 9)
+
+	if err := engine.AddCandidate(second, now.Add(100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddCandidate(first, now); err != nil {
+		t.Fatal(err)
+	}
+	// Received after the window closed, measured from the earliest candidate.
+	if err := engine.AddCandidate(late, now.Add(550*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	// Duplicates are ignored.
+	if engine.candidatePool.Add(first, common.Address{}, now) {
+		t.Error("duplicate candidate accepted")
+	}
+
+	candidates := engine.Candidates(common.Hash{0x01})
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2", len(candidates))
+	}
+	if candidates[0].Block != first || candidates[1].Block != second {
+		t.Error("candidates not ordered by receive time")
+	}
+
+	collected := engine.GetMultiProducerReward().CollectCandidates(first, candidates[0].Producer, now)
+	if len(collected) != 2 {
+		t.Errorf("CollectCandidates returned %d candidates, want 2", len(collected))
+	}
+}
+
+func TestCandidateRanking(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	now := time.Unix(1_000_000, 0)
+
+	var (
+		head   = candidateTestBlock(t, 1, 12) // Kept by the chain, ranked first regardless
+		best   = candidateTestBlock(t, 2, 10)
+		second = candidateTestBlock(t, 3, 11)
+		twice  = candidateTestBlock(t, 2, 13) // Same producer as best, counted once
+		fourth = candidateTestBlock(t, 4, 14)
+		blocks = []*types.Block{head, fourth, twice, second, best}
+	)
+	for i, block := range blocks {
+		if err := engine.AddCandidate(block, now.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ranking, proofs := engine.candidatePool.Ranking(head.Header(), nodeAddress([]byte{1}), nil)
+	want := []common.Address{nodeAddress([]byte{1}), nodeAddress([]byte{2}), nodeAddress([]byte{3})}
+	if len(ranking) != len(want) {
+		t.Fatalf("got ranking %v, want %v", ranking, want)
+	}
+	for i := range want {
+		if ranking[i] != want[i] {
+			t.Errorf("rank %d: got %s, want %s", i+1, ranking[i], want[i])
+		}
+	}
+	if len(proofs) != 2 || proofs[0].Hash() != best.Hash() || proofs[1].Hash() != second.Hash() {
+		t.Errorf("ranking proofs do not match the ranked siblings")
+	}
+
+	// A parent without recorded siblings ranks its producer alone.
+	orphan := candidateTestBlock(t, 5, 1).Header()
+	orphan.ParentHash = common.Hash{0x02}
+	alone, proofs := engine.candidatePool.Ranking(orphan, nodeAddress([]byte{5}), nil)
+	if len(alone) != 1 || alone[0] != nodeAddress([]byte{5}) || len(proofs) != 0 {
+		t.Errorf("unexpected ranking without siblings: %v", alone)
+	}
+}
+
+// rankingTestEngine returns an engine sealing blocks as the given producer.
+func rankingTestEngine(id byte) *SGXEngine {
+	producerID := make([]byte, 32)
+	producerID[0] = id
+	return New(DefaultConfig(), &heartbeatTestAttestor{producerID: producerID}, sealTestVerifier{})
+}
+
+func TestVerifyRanking(t *testing.T) {
+	var (
+		genesis  = &types.Header{Number: big.NewInt(0)}
+		chain    = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		chainID  = chain.Config().ChainID
+		now      = uint64(time.Now().Unix())
+		engines  = []*SGXEngine{rankingTestEngine(1), rankingTestEngine(2), rankingTestEngine(3), rankingTestEngine(4)}
+		headers  = make([]*types.Header, len(engines))
+		ranked   = make([]common.Address, len(engines))
+		verifier = engines[0]
+	)
+	for i, engine := range engines {
+		headers[i] = sealTestHeader(t, engine, chain, genesis, now+uint64(i))
+		ranked[i] = nodeAddress(engine.attestor.(*heartbeatTestAttestor).producerID)
+	}
+	var (
+		parent     = headers[0]
+		a, b, c, d = ranked[0], ranked[1], ranked[2], ranked[3]
+		pb, pc, pd = headers[1], headers[2], headers[3]
+	)
+	// A sibling with an invalid seal does not prove its producer's rank.
+	forged := types.CopyHeader(pc)
+	forged.GasLimit++
+	// A block on another parent is not a sibling.
+	uncle := types.CopyHeader(genesis)
+	uncle.Time = 1
+	cousin := sealTestHeader(t, engines[2], chain, uncle, now+10)
+
+	tests := []struct {
+		ranking []common.Address
+		proofs  []*types.Header
+		valid   bool
+	}{
+		{nil, nil, true},
+		{[]common.Address{a}, nil, true},
+		{[]common.Address{a, b, c}, []*types.Header{pb, pc}, true},
+		{[]common.Address{a, b, c}, []*types.Header{pb}, false},
+		{[]common.Address{a, b, c}, []*types.Header{pc, pb}, false},
+		{[]common.Address{a, b, c}, []*types.Header{pb, forged}, false},
+		{[]common.Address{a, c}, []*types.Header{cousin}, false},
+		{[]common.Address{a, b}, []*types.Header{parent}, false},
+		{nil, []*types.Header{pb}, false},
+		{[]common.Address{b, a}, []*types.Header{parent}, false},
+		{[]common.Address{a, b, b}, []*types.Header{pb, pb}, false},
+		{[]common.Address{a, b, c, d}, []*types.Header{pb, pc, pd}, false},
+	}
+	for i, tt := range tests {
+		err := verifier.verifyRanking(chainID, tt.ranking, tt.proofs, parent)
+		if tt.valid && err != nil {
+			t.Errorf("test %d: valid ranking rejected: %v", i, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidRanking) {
+			t.Errorf("test %d: expected ErrInvalidRanking, got %v", i, err)
+		}
+	}
+	if err := verifier.verifyRanking(chainID, []common.Address{a}, nil, genesis); !errors.Is(err, ErrInvalidRanking) {
+		t.Errorf("ranking on genesis accepted: %v", err)
+	}
+
+	// An oversized sibling header does not prove its producer's rank.
+	oversized := types.CopyHeader(pb)
+	oversized.Extra = append(oversized.Extra, make([]byte, maxRankingProofSize)...)
+	if err := verifier.verifyRanking(chainID, []common.Address{a, b}, []*types.Header{oversized}, parent); !errors.Is(err, ErrInvalidRanking) {
+		t.Errorf("oversized proof accepted: %v", err)
+	}
+
+	// The producer only ranks siblings whose seal verifies.
+	for _, header := range []*types.Header{parent, pb, forged} {
+		if err := verifier.AddCandidate(types.NewBlockWithHeader(header), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ranking, proofs := verifier.ranking(chainID, parent)
+	if len(ranking) != 2 || ranking[1] != b || len(proofs) != 1 {
+		t.Fatalf("unexpected ranking %v", ranking)
+	}
+	if err := verifier.verifyRanking(chainID, ranking, proofs, parent); err != nil {
+		t.Errorf("own ranking rejected: %v", err)
+	}
+}
+
+func TestSGXExtraRankingOptional(t *testing.T) {
+	legacy, err := (&SGXExtra{ProducerID: []byte{1}}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeSGXExtra(legacy)
+	if err != nil {
+		t.Fatalf("decoding extra without ranking failed: %v", err)
+	}
+	if decoded.Ranking != nil {
+		t.Errorf("unexpected ranking %v", decoded.Ranking)
+	}
+
+	ranked := &SGXExtra{ProducerID: []byte{1}, Ranking: []common.Address{{1}, {2}}}
+	enc, err := ranked.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = DecodeSGXExtra(enc); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Ranking) != 2 || decoded.Ranking[1] != (common.Address{2}) {
+		t.Errorf("ranking not round-tripped: %v", decoded.Ranking)
+	}
+}
@@ -0,0 +1,369 @@
+package sgx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/holiman/uint256"
+)
+
+// 检查点
+//
+// 每 Epoch 个区块产生一个检查点区块，其 SGXExtra 记录父区块状态中的白名单条目及其哈希和
+// 已准入且未被排除的生产者 ID（升序）。检查点之后的区块只能由检查点中的生产者产生，
+// 这一规则只依赖区块头，全节点和没有状态的节点结果一致；没有父区块状态时，
+// 区块头的 MRENCLAVE/MRSIGNER 按最近的检查点检查。
+// 白名单在两个检查点之间的变化对没有状态的节点从下一个检查点起生效。
+
+const (
+	// MaxCheckpointProducers 生产者登记表和检查点可容纳的最大生产者数
+	MaxCheckpointProducers = 1024
+
+	// producerInactivity 登记表已满时，超过该时间（秒）没有心跳的生产者可以被替换
+	producerInactivity = 7 * 24 * 3600
+
+	// inmemoryCheckpoints 缓存的“区块哈希 -> 生效检查点”条目数
+	inmemoryCheckpoints = 4096
+)
+
+// 生产者登记表存储在激励合约的 storage 中：基址存放数量，基址 + 1 + i 存放第 i 个生产者 ID，
+// 成员标记用于去重。生产者在其区块或区块携带的心跳在 Finalize 中执行时登记，
+// 登记表已满时替换被排除或长期不活跃的生产者，没有可替换的生产者时拒绝登记。
+var (
+	producersPrefix     = []byte("sgx.producers")     // 已准入的生产者 ID 列表
+	producerIndexPrefix = []byte("sgx.producerIndex") // 生产者是否已登记
+)
+
+// Checkpoint 检查点区块记录的白名单和生产者集合
+type Checkpoint struct {
+	Number        uint64        `json:"number"`
+	WhitelistHash common.Hash   `json:"whitelistHash"`
+	MREnclaves    []common.Hash `json:"mrEnclaves"`
+	MRSigners     []common.Hash `json:"mrSigners"`
+	Producers     []common.Hash `json:"producers"`
+}
+
+// whitelist 返回检查点记录的白名单
+func (c *Checkpoint) whitelist() *whitelistSet {
+	set := &whitelistSet{
+		mrEnclaves: make(map[common.Hash]bool, len(c.MREnclaves)),
+		mrSigners:  make(map[common.Hash]bool, len(c.MRSigners)),
+	}
+	for _, entry := range c.MREnclaves {
+		set.mrEnclaves[entry] = true
+	}
+	for _, entry := range c.MRSigners {
+		set.mrSigners[entry] = true
+	}
+	return set
+}
+
+// hasProducer 判断生产者是否在检查点中，检查点没有记录生产者时不限制
+func (c *Checkpoint) hasProducer(producerID []byte) bool {
+	if len(c.Producers) == 0 {
+		return true
+	}
+	id := common.BytesToHash(producerID)
+	i := sort.Search(len(c.Producers), func(i int) bool { return bytes.Compare(c.Producers[i][:], id[:]) >= 0 })
+	return len(producerID) == common.HashLength && i < len(c.Producers) && c.Producers[i] == id
+}
+
+// isCheckpoint 判断区块高度是否为检查点，Epoch 为 0 时不产生检查点
+func (e *SGXEngine) isCheckpoint(number uint64) bool {
+	return e.config.Epoch > 0 && number > 0 && number%e.config.Epoch == 0
+}
+
+// entries 返回升序排列的 MRENCLAVE 和 MRSIGNER 条目
+func (s *whitelistSet) entries() (mrEnclaves, mrSigners []common.Hash) {
+	sorted := func(set map[common.Hash]bool) []common.Hash {
+		entries := make([]common.Hash, 0, len(set))
+		for entry, ok := range set {
+			if ok {
+				entries = append(entries, entry)
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i][:], entries[j][:]) < 0 })
+		return entries
+	}
+	return sorted(s.mrEnclaves), sorted(s.mrSigners)
+}
+
+// hash 计算白名单哈希：keccak256(rlp([升序 MRENCLAVE 列表, 升序 MRSIGNER 列表]))
+func (s *whitelistSet) hash() common.Hash {
+	mrEnclaves, mrSigners := s.entries()
+	return whitelistHash(mrEnclaves, mrSigners)
+}
+
+// whitelistHash 计算升序白名单条目的哈希
+func whitelistHash(mrEnclaves, mrSigners []common.Hash) common.Hash {
+	data, _ := rlp.EncodeToBytes([][]common.Hash{mrEnclaves, mrSigners})
+	return crypto.Keccak256Hash(data)
+}
+
+// registerProducer 登记生产者，只在 Finalize 中调用。登记表已满时替换一个在 now
+// 被排除或超过 producerInactivity 没有心跳的生产者，没有可替换的生产者时返回错误
+func (e *SGXEngine) registerProducer(statedb vm.StateDB, producerID []byte, now uint64) error {
+	if len(producerID) != common.HashLength {
+		return ErrInvalidProducerID
+	}
+	var (
+		contract = e.incentiveContract
+		id       = common.BytesToHash(producerID)
+		indexKey = rewardStateKey(producerIndexPrefix, id.Bytes())
+	)
+	if statedb.GetState(contract, indexKey) != (common.Hash{}) {
+		return nil
+	}
+	base := rewardStateKey(producersPrefix, nil)
+	count := statedb.GetState(contract, base).Big().Uint64()
+	if count >= MaxCheckpointProducers {
+		slot, ok := e.evictableProducer(statedb, base, count, now)
+		if !ok {
+			return fmt.Errorf("%w: %d producers", ErrProducerRegistryFull, count)
+		}
+		evicted := statedb.GetState(contract, fieldKey(base, slot))
+		statedb.SetState(contract, rewardStateKey(producerIndexPrefix, evicted.Bytes()), common.Hash{})
+		statedb.SetState(contract, fieldKey(base, slot), id)
+		statedb.SetState(contract, indexKey, common.Hash(uint256.NewInt(1).Bytes32()))
+		log.Info("Replaced inactive producer in registry", "producer", nodeAddress(producerID), "replaced", nodeAddress(evicted.Bytes()))
+		return nil
+	}
+	statedb.SetState(contract, fieldKey(base, int(count)+1), id)
+	statedb.SetState(contract, base, common.Hash(uint256.NewInt(count+1).Bytes32()))
+	statedb.SetState(contract, indexKey, common.Hash(uint256.NewInt(1).Bytes32()))
+	return nil
+}
+
+// evictableProducer 返回登记表中第一个可以被替换的生产者所在的存储槽偏移
+func (e *SGXEngine) evictableProducer(statedb vm.StateDB, base common.Hash, count, now uint64) (int, bool) {
+	tracker := e.uptimeCalculator.heartbeatTracker
+	for i := uint64(0); i < count; i++ {
+		addr := nodeAddress(statedb.GetState(e.incentiveContract, fieldKey(base, int(i)+1)).Bytes())
+		if e.penaltyManager.IsExcluded(statedb, addr, now) {
+			return int(i) + 1, true
+		}
+		record := tracker.GetHeartbeatRecord(statedb, addr)
+		if record == nil || uint64(record.LastHeartbeat.Unix())+producerInactivity < now {
+			return int(i) + 1, true
+		}
+	}
+	return 0, false
+}
+
+// activeProducers 返回已登记且在 time 时未被排除的生产者 ID，按升序排列
+func (e *SGXEngine) activeProducers(statedb vm.StateDB, time uint64) []common.Hash {
+	var (
+		contract = e.incentiveContract
+		base     = rewardStateKey(producersPrefix, nil)
+		count    = min(statedb.GetState(contract, base).Big().Uint64(), MaxCheckpointProducers)
+		active   []common.Hash
+	)
+	for i := uint64(0); i < count; i++ {
+		id := statedb.GetState(contract, fieldKey(base, int(i)+1))
+		if !e.penaltyManager.IsExcluded(statedb, nodeAddress(id.Bytes()), time) {
+			active = append(active, id)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return bytes.Compare(active[i][:], active[j][:]) < 0 })
+	return active
+}
+
+// checkpointAt 根据父区块状态计算区块 header 应记录的检查点
+func (e *SGXEngine) checkpointAt(chain consensus.ChainHeaderReader, header, parent *types.Header) (*Checkpoint, error) {
+	reader, ok := chain.(stateReader)
+	if !ok {
+		return nil, consensus.ErrPrunedAncestor
+	}
+	statedb, err := reader.StateAt(parent.Root)
+	if err != nil {
+		return nil, consensus.ErrPrunedAncestor
+	}
+	whitelist, err := e.whitelistAt(reader, parent)
+	if err != nil {
+		return nil, consensus.ErrPrunedAncestor
+	}
+	mrEnclaves, mrSigners := whitelist.entries()
+	return &Checkpoint{
+		Number:        header.Number.Uint64(),
+		WhitelistHash: whitelistHash(mrEnclaves, mrSigners),
+		MREnclaves:    mrEnclaves,
+		MRSigners:     mrSigners,
+		Producers:     e.activeProducers(statedb, header.Time),
+	}, nil
+}
+
+// verifyCheckpointFormat 无状态检查：只有检查点区块携带检查点数据，白名单条目和生产者 ID
+// 严格升序，白名单条目的哈希等于 WhitelistHash
+func (e *SGXEngine) verifyCheckpointFormat(header *types.Header, extra *SGXExtra) error {
+	if !e.isCheckpoint(header.Number.Uint64()) {
+		if extra.WhitelistHash != (common.Hash{}) || len(extra.Producers) > 0 || len(extra.CheckpointMREnclaves) > 0 || len(extra.CheckpointMRSigners) > 0 {
+			return fmt.Errorf("%w: checkpoint data in non-checkpoint block", ErrInvalidCheckpoint)
+		}
+		return nil
+	}
+	if extra.WhitelistHash == (common.Hash{}) {
+		return fmt.Errorf("%w: missing whitelist hash", ErrInvalidCheckpoint)
+	}
+	if len(extra.Producers) > MaxCheckpointProducers {
+		return fmt.Errorf("%w: %d producers, max %d", ErrInvalidCheckpoint, len(extra.Producers), MaxCheckpointProducers)
+	}
+	for name, list := range map[string][]common.Hash{"producers": extra.Producers, "MRENCLAVEs": extra.CheckpointMREnclaves, "MRSIGNERs": extra.CheckpointMRSigners} {
+		for i := 1; i < len(list); i++ {
+			if bytes.Compare(list[i-1][:], list[i][:]) >= 0 {
+				return fmt.Errorf("%w: %s not sorted", ErrInvalidCheckpoint, name)
+			}
+		}
+	}
+	if hash := whitelistHash(extra.CheckpointMREnclaves, extra.CheckpointMRSigners); hash != extra.WhitelistHash {
+		return fmt.Errorf("%w: whitelist entries hash to %x, header %x", ErrInvalidCheckpoint, hash, extra.WhitelistHash)
+	}
+	return nil
+}
+
+// verifyCheckpointState 检查检查点内容与父区块状态一致
+func (e *SGXEngine) verifyCheckpointState(chain consensus.ChainHeaderReader, header, parent *types.Header, extra *SGXExtra) error {
+	if !e.isCheckpoint(header.Number.Uint64()) {
+		return nil
+	}
+	want, err := e.checkpointAt(chain, header, parent)
+	if err != nil {
+		return err
+	}
+	if extra.WhitelistHash != want.WhitelistHash {
+		return fmt.Errorf("%w: whitelist hash %x, state %x", ErrInvalidCheckpoint, extra.WhitelistHash, want.WhitelistHash)
+	}
+	if len(extra.Producers) != len(want.Producers) {
+		return fmt.Errorf("%w: %d producers, state %d", ErrInvalidCheckpoint, len(extra.Producers), len(want.Producers))
+	}
+	for i, id := range extra.Producers {
+		if id != want.Producers[i] {
+			return fmt.Errorf("%w: producer %d is %x, state %x", ErrInvalidCheckpoint, i, id, want.Producers[i])
+		}
+	}
+	return nil
+}
+
+// verifyCheckpoint 验证区块头的检查点数据，父区块状态可用时同时检查内容，
+// 否则由区块体验证中的 verifyParentState 在执行区块前检查
+func (e *SGXEngine) verifyCheckpoint(chain consensus.ChainHeaderReader, header, parent *types.Header, extra *SGXExtra) error {
+	if err := e.verifyCheckpointFormat(header, extra); err != nil {
+		return err
+	}
+	if err := e.verifyCheckpointState(chain, header, parent, extra); !errors.Is(err, consensus.ErrPrunedAncestor) {
+		return err
+	}
+	return nil
+}
+
+// checkpointEpoch 返回区块所在周期的检查点高度，Epoch 为 0 或第一个周期时返回 false
+func (e *SGXEngine) checkpointEpoch(number uint64) (uint64, bool) {
+	if e.config.Epoch == 0 {
+		return 0, false
+	}
+	checkpoint := number - number%e.config.Epoch
+	return checkpoint, checkpoint > 0
+}
+
+// decodeCheckpoint 读取检查点区块头中的检查点
+func decodeCheckpoint(header *types.Header) (*Checkpoint, error) {
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		return nil, ErrInvalidExtra
+	}
+	return &Checkpoint{
+		Number:        header.Number.Uint64(),
+		WhitelistHash: extra.WhitelistHash,
+		MREnclaves:    extra.CheckpointMREnclaves,
+		MRSigners:     extra.CheckpointMRSigners,
+		Producers:     extra.Producers,
+	}, nil
+}
+
+// latestCheckpoint 返回对 parent 的子区块生效的检查点，即 parent 及其祖先中最近的检查点区块，
+// 第一个周期内返回 nil。parents 为 VerifyHeaders 中同批次、尚未写入链的祖先区块头。
+// 结果按区块哈希缓存，顺序验证时每个区块头只需回溯一个区块
+func (e *SGXEngine) latestCheckpoint(chain consensus.ChainHeaderReader, parent *types.Header, parents []*types.Header) (*Checkpoint, error) {
+	if e.config.Epoch == 0 {
+		return nil, nil
+	}
+	batch := make(map[common.Hash]*types.Header, len(parents))
+	for _, header := range parents {
+		batch[header.Hash()] = header
+	}
+	var (
+		header     = parent
+		checkpoint *Checkpoint
+		path       []common.Hash
+	)
+	for {
+		hash := header.Hash()
+		if cached, ok := e.checkpoints.Get(hash); ok {
+			checkpoint = cached
+			break
+		}
+		path = append(path, hash)
+		number := header.Number.Uint64()
+		if e.isCheckpoint(number) {
+			cp, err := decodeCheckpoint(header)
+			if err != nil {
+				return nil, err
+			}
+			checkpoint = cp
+			break
+		}
+		if number < e.config.Epoch {
+			break
+		}
+		ancestor := batch[header.ParentHash]
+		if ancestor == nil {
+			ancestor = chain.GetHeader(header.ParentHash, number-1)
+		}
+		if ancestor == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+		header = ancestor
+	}
+	// 只缓存回溯的起点和终点，避免冷启动时填满缓存
+	if len(path) > 0 {
+		e.checkpoints.Add(path[0], checkpoint)
+		e.checkpoints.Add(path[len(path)-1], checkpoint)
+	}
+	return checkpoint, nil
+}
+
+// verifyCheckpointProducer 检查点之后的区块只能由最近检查点中的生产者产生
+func (e *SGXEngine) verifyCheckpointProducer(checkpoint *Checkpoint, extra *SGXExtra) error {
+	if checkpoint == nil || checkpoint.hasProducer(extra.ProducerID) {
+		return nil
+	}
+	return fmt.Errorf("%w: producer %s, checkpoint %d", ErrNotCheckpointProducer, nodeAddress(extra.ProducerID), checkpoint.Number)
+}
+
+// verifyCheckpointAgainstParent 在执行区块前检查检查点内容，要求父区块状态可用
+func (e *SGXEngine) verifyCheckpointAgainstParent(chain consensus.ChainHeaderReader, header *types.Header) error {
+	number := header.Number.Uint64()
+	if !e.isCheckpoint(number) {
+		return nil
+	}
+	if _, ok := chain.(stateReader); !ok {
+		return nil
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		return ErrInvalidExtra
+	}
+	return e.verifyCheckpointState(chain, header, parent, extra)
+}
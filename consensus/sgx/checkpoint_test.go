@@ -0,0 +1,196 @@
+package sgx
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that checkpoint blocks carry the whitelist hash and the producers
+// admitted and not excluded in the parent state, and that other contents are
+// rejected.
+func TestCheckpoint(t *testing.T) {
+	config := DefaultConfig()
+	config.Epoch = 2
+	engine := New(config, nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+	engine.securityConfig = testSecurityConfig
+
+	var (
+		mrenclave = common.Hash{0xee}
+		statedb   = newWhitelistState(t, []common.Hash{mrenclave}, nil)
+		genesis   = &types.Header{Number: big.NewInt(0)}
+		parent    = &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: uint64(time.Now().Unix()) - 10, Root: common.Hash{0x01}}
+		chain     = &whitelistTestChain{
+			headers: map[common.Hash]*types.Header{genesis.Hash(): genesis, parent.Hash(): parent},
+			states:  map[common.Hash]*state.StateDB{parent.Root: statedb},
+		}
+		ids = []common.Hash{{0x03}, {0x01}, {0x02}}
+	)
+	for _, id := range ids {
+		if err := engine.registerProducer(statedb, id.Bytes(), parent.Time); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := engine.registerProducer(statedb, ids[0].Bytes(), parent.Time); err != nil {
+		t.Fatal(err)
+	}
+	engine.penaltyManager.RecordDoubleSign(statedb, nodeAddress(ids[2].Bytes()), parent.Time)
+
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(2)}
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatal(err)
+	}
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := newWhitelistSet(GenesisWhitelist{MREnclaves: []string{mrenclave.Hex()}}).hash(); extra.WhitelistHash != want {
+		t.Errorf("whitelist hash: got %x, want %x", extra.WhitelistHash, want)
+	}
+	if len(extra.CheckpointMREnclaves) != 1 || extra.CheckpointMREnclaves[0] != mrenclave || len(extra.CheckpointMRSigners) != 0 {
+		t.Errorf("whitelist entries: got %x %x", extra.CheckpointMREnclaves, extra.CheckpointMRSigners)
+	}
+	if want := []common.Hash{ids[1], ids[0]}; len(extra.Producers) != len(want) || extra.Producers[0] != want[0] || extra.Producers[1] != want[1] {
+		t.Errorf("producers: got %x, want %x", extra.Producers, want)
+	}
+	if err := engine.verifyCheckpoint(chain, header, parent, extra); err != nil {
+		t.Fatalf("valid checkpoint rejected: %v", err)
+	}
+	// Contents not matching the parent state are rejected
+	excluded := *extra
+	excluded.Producers = []common.Hash{ids[1], ids[2], ids[0]}
+	unsorted := *extra
+	unsorted.Producers = []common.Hash{ids[0], ids[1]}
+	whitelist := *extra
+	whitelist.CheckpointMREnclaves = []common.Hash{{0xff}}
+	whitelist.WhitelistHash = whitelistHash(whitelist.CheckpointMREnclaves, nil)
+	entries := *extra
+	entries.CheckpointMREnclaves = []common.Hash{{0xff}}
+	missing := *extra
+	missing.WhitelistHash = common.Hash{}
+
+	for name, extra := range map[string]*SGXExtra{"excluded producer": &excluded, "unsorted": &unsorted, "whitelist": &whitelist, "entries": &entries, "missing": &missing} {
+		if err := engine.verifyCheckpoint(chain, header, parent, extra); !errors.Is(err, ErrInvalidCheckpoint) {
+			t.Errorf("%s: expected ErrInvalidCheckpoint, got %v", name, err)
+		}
+	}
+	// Without the parent state only the format can be checked
+	delete(chain.states, parent.Root)
+	engine.whitelists.Purge()
+	if err := engine.verifyCheckpoint(chain, header, parent, &whitelist); err != nil {
+		t.Errorf("checkpoint without parent state: %v", err)
+	}
+	// Blocks between checkpoints carry no checkpoint data
+	between := &types.Header{ParentHash: header.Hash(), Number: big.NewInt(3)}
+	if err := engine.verifyCheckpoint(chain, between, header, extra); !errors.Is(err, ErrInvalidCheckpoint) {
+		t.Errorf("checkpoint data between checkpoints: expected ErrInvalidCheckpoint, got %v", err)
+	}
+}
+
+// Tests that blocks after a checkpoint are restricted to its producers and,
+// without parent state, to its whitelist.
+func TestLatestCheckpoint(t *testing.T) {
+	config := DefaultConfig()
+	config.Epoch = 2
+	engine := New(config, nil, nil)
+
+	var (
+		member  = common.Hash{0x01}
+		other   = common.Hash{0x02}
+		genesis = &types.Header{Number: big.NewInt(0)}
+		block1  = nodeTestHeader(t, genesis, 1, 10, nil)
+	)
+	extra, _ := (&SGXExtra{
+		ProducerID:           member.Bytes(),
+		WhitelistHash:        whitelistHash([]common.Hash{testMREnclave}, nil),
+		CheckpointMREnclaves: []common.Hash{testMREnclave},
+		Producers:            []common.Hash{member},
+	}).Encode()
+	block2 := &types.Header{ParentHash: block1.Hash(), Number: big.NewInt(2), Time: 20, Extra: extra}
+	block3 := nodeTestHeader(t, block2, 1, 30, nil)
+	chain := &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis, block1.Hash(): block1}}
+
+	// The first epoch has no checkpoint.
+	if checkpoint, err := engine.latestCheckpoint(chain, block1, nil); err != nil || checkpoint != nil {
+		t.Fatalf("unexpected checkpoint in the first epoch: %v, %v", checkpoint, err)
+	}
+	// Headers of the same batch are found without the chain.
+	checkpoint, err := engine.latestCheckpoint(chain, block3, []*types.Header{block2, block3})
+	if err != nil || checkpoint == nil || checkpoint.Number != 2 {
+		t.Fatalf("checkpoint not found: %v, %v", checkpoint, err)
+	}
+	if err := engine.verifyCheckpointProducer(checkpoint, &SGXExtra{ProducerID: member.Bytes()}); err != nil {
+		t.Errorf("checkpoint producer rejected: %v", err)
+	}
+	if err := engine.verifyCheckpointProducer(checkpoint, &SGXExtra{ProducerID: other.Bytes()}); !errors.Is(err, ErrNotCheckpointProducer) {
+		t.Errorf("expected ErrNotCheckpointProducer, got %v", err)
+	}
+	// Without parent state the checkpoint whitelist applies.
+	allowed := engine.headerWhitelist(chain, block3, checkpoint)
+	if allowed == nil {
+		t.Fatal("no whitelist check without parent state")
+	}
+	for mrenclave, want := range map[common.Hash]error{testMREnclave: nil, testMREnclave2: ErrNotWhitelisted} {
+		extra, _ := DecodeSGXExtra(whitelistTestHeader(t, block3, mrenclave).Extra)
+		if err := allowed(extra.SGXQuote); !errors.Is(err, want) {
+			t.Errorf("MRENCLAVE %x: got %v, want %v", mrenclave, err, want)
+		}
+	}
+	// Unknown ancestors are reported.
+	orphan := nodeTestHeader(t, &types.Header{Number: big.NewInt(4)}, 1, 50, nil)
+	if _, err := engine.latestCheckpoint(chain, orphan, nil); err != consensus.ErrUnknownAncestor {
+		t.Errorf("expected ErrUnknownAncestor, got %v", err)
+	}
+}
+
+// Tests that a full producer registry replaces inactive producers and
+// refuses registration when every producer is active.
+func TestProducerRegistryFull(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+
+	var (
+		statedb = newNodeTestState(t)
+		tracker = engine.uptimeCalculator.heartbeatTracker
+		now     = uint64(producerInactivity + 1000)
+	)
+	tracker.AdvanceRound(statedb, now)
+	for i := 0; i < MaxCheckpointProducers; i++ {
+		id := common.BigToHash(big.NewInt(int64(i + 1)))
+		if err := engine.registerProducer(statedb, id.Bytes(), now); err != nil {
+			t.Fatal(err)
+		}
+		tracker.RecordHeartbeat(statedb, nodeAddress(id.Bytes()), now)
+	}
+	newcomer := common.Hash{0xff}
+	if err := engine.registerProducer(statedb, newcomer.Bytes(), now); !errors.Is(err, ErrProducerRegistryFull) {
+		t.Fatalf("expected ErrProducerRegistryFull, got %v", err)
+	}
+	// Once a producer is excluded its slot can be taken over.
+	evicted := common.BigToHash(big.NewInt(7))
+	engine.penaltyManager.RecordDoubleSign(statedb, nodeAddress(evicted.Bytes()), now)
+	if err := engine.registerProducer(statedb, newcomer.Bytes(), now); err != nil {
+		t.Fatalf("registration with an excluded producer failed: %v", err)
+	}
+	producers := engine.activeProducers(statedb, now)
+	if len(producers) != MaxCheckpointProducers {
+		t.Fatalf("got %d active producers, want %d", len(producers), MaxCheckpointProducers)
+	}
+	found := false
+	for _, id := range producers {
+		if id == evicted {
+			t.Error("evicted producer still registered")
+		}
+		found = found || id == newcomer
+	}
+	if !found {
+		t.Error("newcomer not registered")
+	}
+}
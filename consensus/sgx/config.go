@@ -1,8 +1,12 @@
 package sgx
 
 import (
+	"fmt"
+	"math"
 	"math/big"
 	"time"
+
+	"github.com/ethereum/go-ethereum/governance"
 )
 
 // Config SGX 共识引擎配置
@@ -14,6 +18,11 @@ type Config struct {
 	MaxGasPerBlock   uint64        // 单区块最大 Gas
 	VerifyTimeout    time.Duration // 区块验证超时
 
+	// 区块封装配置
+	MaxAttestationAge   time.Duration // Quote 相对区块时间的最大年龄
+	KeyRotationInterval time.Duration // 签名密钥轮换间隔（须小于 MaxAttestationAge）
+	Epoch               uint64        // 检查点间隔（区块数），0 表示不产生检查点
+
 	// 按需出块配置
 	OnDemandEnabled bool   // 是否启用按需出块
 	MinTxCount      int    // 触发出块的最小交易数
@@ -102,6 +111,11 @@ func DefaultConfig() *Config {
 		MaxGasPerBlock:   30000000,
 		VerifyTimeout:    10 * time.Second,
 
+		// 区块封装配置
+		MaxAttestationAge:   1 * time.Hour,
+		KeyRotationInterval: 30 * time.Minute,
+		Epoch:               30000,
+
 		// 按需出块配置
 		OnDemandEnabled: true,
 		MinTxCount:      1,
@@ -180,6 +194,9 @@ func (c *Config) Validate() error {
 	if c.MaxGasPerBlock == 0 {
 		return ErrInvalidConfig
 	}
+	if c.MinTxCount < 0 || c.CandidateWindowMs < 0 || c.MaxCandidates < 0 {
+		return ErrInvalidConfig
+	}
 	if c.QualityConfig == nil {
 		return ErrInvalidConfig
 	}
@@ -197,3 +214,73 @@ func (c *Config) Validate() error {
 	}
 	return nil
 }
+
+// SetParameter 应用治理提案修改的参数，时长以毫秒计。
+// 修改后的配置无效时恢复原值并返回错误。
+func (c *Config) SetParameter(name string, value uint64) error {
+	prev := *c
+	if err := c.setParameter(name, value); err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		*c = prev
+		return fmt.Errorf("parameter %s=%d: %w", name, value, err)
+	}
+	return nil
+}
+
+// WithParameters 返回应用了治理参数的配置副本。
+// 参数全部应用后再验证，因此可以同时调整相互约束的参数（如最小和最大出块间隔）
+func (c *Config) WithParameters(params map[string]uint64) (*Config, error) {
+	config := *c
+	for name, value := range params {
+		if err := config.setParameter(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("governance parameters %v: %w", params, err)
+	}
+	return &config, nil
+}
+
+// setParameter 设置参数而不验证配置，超出类型范围的值无效
+func (c *Config) setParameter(name string, value uint64) error {
+	switch name {
+	case governance.ParamMinBlockInterval, governance.ParamMaxBlockInterval:
+		if value > math.MaxInt64/uint64(time.Millisecond) {
+			return fmt.Errorf("parameter %s=%d: %w", name, value, ErrInvalidConfig)
+		}
+	case governance.ParamMaxGasPerBlock, governance.ParamMinGasTotal, governance.ParamMinStakeAmount,
+		governance.ParamUnstakeLockPeriod, governance.ParamAnnualRewardRate, governance.ParamSlashingRate,
+		governance.ParamBlocksPerYear:
+	default:
+		if value > math.MaxInt32 {
+			return fmt.Errorf("parameter %s=%d: %w", name, value, ErrInvalidConfig)
+		}
+	}
+	switch name {
+	case governance.ParamMinBlockInterval:
+		c.MinBlockInterval = time.Duration(value) * time.Millisecond
+	case governance.ParamMaxBlockInterval:
+		c.MaxBlockInterval = time.Duration(value) * time.Millisecond
+	case governance.ParamMaxTxPerBlock:
+		c.MaxTxPerBlock = int(value)
+	case governance.ParamMaxGasPerBlock:
+		c.MaxGasPerBlock = value
+	case governance.ParamMinTxCount:
+		c.MinTxCount = int(value)
+	case governance.ParamMinGasTotal:
+		c.MinGasTotal = value
+	case governance.ParamCandidateWindowMs:
+		c.CandidateWindowMs = int(value)
+	case governance.ParamMaxCandidates:
+		c.MaxCandidates = int(value)
+	case governance.ParamMinStakeAmount, governance.ParamUnstakeLockPeriod, governance.ParamAnnualRewardRate,
+		governance.ParamSlashingRate, governance.ParamBlocksPerYear:
+		// 质押参数不属于共识配置，由治理合约的质押管理器读取
+	default:
+		return fmt.Errorf("%w: %q", governance.ErrUnknownParameter, name)
+	}
+	return nil
+}
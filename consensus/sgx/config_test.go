@@ -0,0 +1,87 @@
+package sgx
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/governance"
+)
+
+func TestConfigSetParameter(t *testing.T) {
+	config := DefaultConfig()
+	if err := config.SetParameter(governance.ParamMaxBlockInterval, 30000); err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxBlockInterval != 30*time.Second {
+		t.Fatalf("MaxBlockInterval = %v, want 30s", config.MaxBlockInterval)
+	}
+	if err := config.SetParameter(governance.ParamMaxCandidates, 5); err != nil || config.MaxCandidates != 5 {
+		t.Fatalf("MaxCandidates = %d, err %v", config.MaxCandidates, err)
+	}
+
+	// 无效值被拒绝，配置保持不变
+	if err := config.SetParameter(governance.ParamMinBlockInterval, 60000); err == nil {
+		t.Fatal("accepted MinBlockInterval above MaxBlockInterval")
+	}
+	if config.MinBlockInterval != time.Second {
+		t.Fatalf("MinBlockInterval = %v after rejected change", config.MinBlockInterval)
+	}
+	if err := config.SetParameter("epoch", 1); !errors.Is(err, governance.ErrUnknownParameter) {
+		t.Fatalf("unknown parameter: err %v", err)
+	}
+}
+
+// 引擎使用父区块状态中的治理参数，与本地配置组合后无效的参数被忽略
+func TestConfigAtGovernanceParameters(t *testing.T) {
+	var (
+		governanceAddr = common.HexToAddress("0x1001")
+		rootA          = common.HexToHash("0xa1")
+		rootB          = common.HexToHash("0xb1")
+		parentA        = &types.Header{Number: big.NewInt(1), Root: rootA}
+		parentB        = &types.Header{Number: big.NewInt(1), Root: rootB, Time: 1}
+		stateA         = newWhitelistState(t, nil, nil)
+		stateB         = newWhitelistState(t, nil, nil)
+		chain          = &whitelistTestChain{
+			headers: map[common.Hash]*types.Header{parentA.Hash(): parentA, parentB.Hash(): parentB},
+			states:  map[common.Hash]*state.StateDB{rootA: stateA, rootB: stateB},
+		}
+	)
+	engine := New(DefaultConfig(), nil, nil)
+	engine.governanceContract = governanceAddr
+
+	if err := governance.NewStateParameters(stateA, governanceAddr).SetParameter(governance.ParamMaxTxPerBlock, 2); err != nil {
+		t.Fatal(err)
+	}
+	config, err := engine.configAt(chain, parentA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxTxPerBlock != 2 || engine.config.MaxTxPerBlock != DefaultConfig().MaxTxPerBlock {
+		t.Fatalf("MaxTxPerBlock = %d, local %d", config.MaxTxPerBlock, engine.config.MaxTxPerBlock)
+	}
+	txs := make([]*types.Transaction, 3)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, common.Big0, 21000, common.Big1, nil)
+	}
+	block := types.NewBlockWithHeader(&types.Header{ParentHash: parentA.Hash(), Number: big.NewInt(2)}).WithBody(types.Body{Transactions: txs})
+	if err := engine.verifyBlockLimits(chain, block); err == nil {
+		t.Fatal("accepted block above the governance transaction limit")
+	}
+	block = types.NewBlockWithHeader(&types.Header{ParentHash: parentB.Hash(), Number: big.NewInt(2)}).WithBody(types.Body{Transactions: txs})
+	if err := engine.verifyBlockLimits(chain, block); err != nil {
+		t.Fatalf("block within the local limits: %v", err)
+	}
+
+	// 最小出块间隔超过本地最大出块间隔，组合后的配置无效
+	if err := governance.NewStateParameters(stateB, governanceAddr).SetParameter(governance.ParamMinBlockInterval, 120000); err != nil {
+		t.Fatal(err)
+	}
+	if config, err := engine.configAt(chain, parentB); err != nil || config != engine.config {
+		t.Fatalf("invalid parameters applied: %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package sgx
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -11,18 +10,23 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/ethereum/go-ethereum/incentive"
 	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
-	"github.com/holiman/uint256"
 )
 
 // SGXEngine PoA-SGX 共识引擎
@@ -46,6 +50,44 @@ type SGXEngine struct {
 	onlineRewardCalc    *OnlineRewardCalculator
 	nodeSelector        *NodeSelector
 	comprehensiveReward *ComprehensiveRewardCalculator
+	candidatePool       *CandidatePool
+	sealedFeed          event.Feed    // 本地生产的区块
+	rewardParams        *rewardParams // 共识奖励参数（整数）
+
+	// 激励合约地址（收取交易费并存储奖励和节点状态）
+	incentiveContract common.Address
+	nodeState         *NodeStateStore
+
+	// 双签检测与处罚
+	equivocations *EquivocationDetector
+	slashing      *incentive.PenaltyManager // 双签罚没比例
+
+	// 区块哈希 -> 对其子区块生效的检查点（第一个周期内为 nil）
+	checkpoints *lru.Cache[common.Hash, *Checkpoint]
+
+	// 区块封装
+	sealKey     *signingKey                             // 本地生产者当前的签名密钥
+	sealMu      sync.Mutex                              // 保护 sealKey
+	quotes      *lru.Cache[common.Hash, []byte]         // 已验证的 Quote -> 平台实例 ID
+	signingKeys *lru.Cache[common.Hash, signingKeyInfo] // 区块哈希 -> 签名密钥信息
+	signed      ethdb.KeyValueStore                     // 本地节点已签名的区块（见 guardSeal），受 sealMu 保护
+
+	heartbeatQuotes *lru.Cache[common.Hash, []byte] // 区块携带的已验证心跳 Quote -> 平台实例 ID
+
+	// 安全配置合约地址（白名单存储）
+	securityConfig common.Address
+	whitelists     *lru.Cache[common.Hash, *whitelistSet] // 按状态根缓存的白名单
+	whitelistFeed  event.Feed
+	whitelistMu    sync.Mutex // 串行化白名单同步
+
+	// 治理合约地址（锁定质押资金，未设置时不处理质押）
+	governanceContract common.Address
+
+	// 解密份额来源，出块时用于揭示之前区块提交的加密交易
+	shares core.DecryptionShareSource
+
+	quit      chan struct{}
+	closeOnce sync.Once
 
 	// 同步
 	mu sync.RWMutex
@@ -61,23 +103,39 @@ func New(config *Config, attestor Attestor, verifier Verifier) *SGXEngine {
 	}
 
 	engine := &SGXEngine{
-		config:   config,
-		attestor: attestor,
-		verifier: verifier,
+		config:     config,
+		attestor:   attestor,
+		verifier:   verifier,
+		whitelists: lru.NewCache[common.Hash, *whitelistSet](inmemoryWhitelists),
+		nodeState:  NewNodeStateStore(common.Address{}),
+		quit:       make(chan struct{}),
+
+		equivocations: NewEquivocationDetector(),
+		slashing:      incentive.NewPenaltyManager(incentive.DefaultPenaltyConfig()),
+		checkpoints:   lru.NewCache[common.Hash, *Checkpoint](inmemoryCheckpoints),
+
+		quotes:      lru.NewCache[common.Hash, []byte](inmemoryQuotes),
+		signingKeys: lru.NewCache[common.Hash, signingKeyInfo](inmemorySigningKeys),
+		signed:      rawdb.NewMemoryDatabase(),
+
+		heartbeatQuotes: lru.NewCache[common.Hash, []byte](inmemoryHeartbeatQuotes),
 	}
 
 	// 初始化内部组件
 	engine.blockQualityScorer = NewBlockQualityScorer(config.QualityConfig)
 	engine.multiProducerReward = NewMultiProducerRewardCalculator(config, engine.blockQualityScorer)
 	engine.forkChoiceRule = NewForkChoiceRule()
+	engine.candidatePool = NewCandidatePool(config)
+	engine.multiProducerReward.candidates = engine.candidatePool
 	engine.reorgHandler = NewReorgHandler()
-	engine.uptimeCalculator = NewUptimeCalculator(config.UptimeConfig)
-	engine.penaltyManager = NewPenaltyManager(config.PenaltyConfig)
-	engine.reputationSystem = NewReputationSystem(config.ReputationConfig, engine.uptimeCalculator, engine.penaltyManager)
+	engine.uptimeCalculator = NewUptimeCalculator(config.UptimeConfig, engine.nodeState)
+	engine.penaltyManager = NewPenaltyManager(config.PenaltyConfig, engine.nodeState)
+	engine.reputationSystem = NewReputationSystem(config.ReputationConfig, engine.uptimeCalculator, engine.penaltyManager, engine.nodeState)
 	engine.onlineRewardCalc = NewOnlineRewardCalculator(config.RewardConfig)
 	engine.nodeSelector = NewNodeSelector(engine.reputationSystem)
 	engine.comprehensiveReward = NewComprehensiveRewardCalculator(config.RewardConfig)
 	engine.onDemandController = NewOnDemandController(config)
+	engine.rewardParams = newRewardParams(config)
 
 	return engine
 }
@@ -123,6 +181,7 @@ func NewFromParams(paramsConfig *params.SGXConfig, db ethdb.Database) *SGXEngine
 		appConfig = &internalsgx.AppConfig{
 			GovernanceContract:     governanceAddr.Hex(),
 			SecurityConfigContract: securityAddr.Hex(),
+			CollateralDir:          os.Getenv("SGX_COLLATERAL_DIR"),
 		}
 	} else {
 		log.Info("✓ Configuration loaded from environment",
@@ -141,6 +200,12 @@ func NewFromParams(paramsConfig *params.SGXConfig, db ethdb.Database) *SGXEngine
 	
 	// Use default config as base
 	config := DefaultConfig()
+	if paramsConfig.HeartbeatInterval > 0 {
+		config.UptimeConfig.HeartbeatInterval = time.Duration(paramsConfig.HeartbeatInterval) * time.Second
+	}
+	if paramsConfig.Epoch > 0 {
+		config.Epoch = paramsConfig.Epoch
+	}
 	
 	log.Info("SGX Configuration",
 		"period", paramsConfig.Period,
@@ -151,7 +216,7 @@ func NewFromParams(paramsConfig *params.SGXConfig, db ethdb.Database) *SGXEngine
 	log.Info("Loading Module 01: SGX Attestation")
 	log.Info("Loading Module 02: SGX Consensus Engine")
 	log.Info("Loading Module 03: Incentive Mechanism")
-	log.Info("Loading Module 04: Precompiled Contracts (0x8000-0x8009)")
+	log.Info("Loading Module 04: Precompiled Contracts (0x8000-0x800d)")
 	log.Info("Loading Module 05: Governance System")
 	log.Info("Loading Module 06: Encrypted Storage")
 	log.Info("Loading Module 07: Gramine Integration")
@@ -164,21 +229,29 @@ func NewFromParams(paramsConfig *params.SGXConfig, db ethdb.Database) *SGXEngine
 		log.Crit("Failed to create Gramine attestor", "error", err)
 	}
 	
-	// Create DCAP verifier
-	verifier := internalsgx.NewDCAPVerifier(true)
+	// Create DCAP verifier with offline collateral, which only test mode may omit
+	verifier, err := internalsgx.NewDCAPVerifierFromEnvironment(true)
+	if err != nil {
+		log.Crit("Failed to create DCAP verifier", "error", err)
+	}
+	if appConfig.CollateralDir == "" {
+		log.Warn("TEST MODE: no DCAP collateral, accepting quotes of unknown TCB level")
+	} else {
+		log.Info("DCAP collateral loaded", "dir", appConfig.CollateralDir)
+	}
 	
 	// Step 5: Initialize whitelist from contract storage
-	// Priority: Contract Storage → Genesis Alloc Storage
+	// The genesis alloc of the security config contract holds the initial
+	// whitelist; later changes are applied from state by governance.
 	log.Info("Step 5: Loading whitelist from security config contract...")
 	
-	// The security config contract address comes from appConfig
-	// Now read whitelist from contract storage
-	// In genesis block, the storage is in alloc
-	// After genesis, the storage is in state database
-	
-	// For now, try environment variables as genesis alloc representation
-	// In production, this would read from actual contract storage
-	genesisWhitelist := loadWhitelistFromContractStorage(appConfig.SecurityConfigContract)
+	securityAddr := common.HexToAddress(appConfig.SecurityConfigContract)
+	genesisWhitelist, err := loadGenesisWhitelist(db, securityAddr)
+	if errors.Is(err, ErrWhitelistNotListed) {
+		log.Crit("Invalid genesis whitelist", "contract", securityAddr, "err", err)
+	} else if err != nil {
+		log.Info("Genesis whitelist not available yet", "contract", securityAddr, "reason", err)
+	}
 	
 	if len(genesisWhitelist.MREnclaves) > 0 || len(genesisWhitelist.MRSigners) > 0 {
 		log.Info("Loading whitelist from security config contract")
@@ -195,7 +268,19 @@ func NewFromParams(paramsConfig *params.SGXConfig, db ethdb.Database) *SGXEngine
 	log.Info("=== SGX Consensus Engine Initialized ===")
 	log.Info("Architecture: Manifest(contract addr) → Contract Storage(whitelist) → Governance(updates)")
 	
-	return New(config, attestor, verifier)
+	engine := New(config, attestor, verifier)
+	engine.securityConfig = securityAddr
+	if db != nil {
+		engine.signed = db
+	}
+	// 质押的绑定、支付和罚没是共识规则，必须使用链配置中原生治理合约的地址
+	engine.governanceContract = paramsConfig.GovernanceContract
+	if configured := common.HexToAddress(appConfig.GovernanceContract); configured != paramsConfig.GovernanceContract {
+		log.Warn("Ignoring governance contract of the environment, using the chain config",
+			"configured", configured, "chain", paramsConfig.GovernanceContract)
+	}
+	engine.setIncentiveContract(incentiveAddr)
+	return engine
 }
 
 // GenesisWhitelist holds whitelist configuration from genesis
@@ -204,41 +289,6 @@ type GenesisWhitelist struct {
 	MRSigners  []string
 }
 
-// loadWhitelistFromContractStorage reads whitelist from genesis alloc storage
-// Security requirement: No environment variables for security parameters
-// Only sources: 1) Contract Storage, 2) Genesis Alloc Storage
-func loadWhitelistFromContractStorage(contractAddr string) GenesisWhitelist {
-	whitelist := GenesisWhitelist{
-		MREnclaves: []string{},
-		MRSigners:  []string{},
-	}
-	
-	// Read from genesis.json alloc[contractAddr].storage
-	// In production deployment:
-	// 1. Genesis file contains pre-populated storage for security config contract
-	// 2. Storage layout follows Solidity mapping:
-	//    - allowedMREnclaves: mapping(bytes32 => bool) at slot 0
-	//    - allowedMRSigners: mapping(bytes32 => bool) at slot 1
-	// 3. Storage keys: keccak256(abi.encode(mrenclave/mrsigner, slot))
-	
-	// After genesis, whitelist is managed via governance contract
-	// which updates the contract storage in state database
-	
-	// For testing: genesis.json should contain the storage entries
-	// For production: genesis.json is created by deployment tools
-	
-	// This function will be called during consensus engine initialization
-	// At that point, we can read from the genesis block's alloc storage
-	// or from the state database after the chain has started
-	
-	// Currently returns empty whitelist - will be populated via governance
-	log.Info("Whitelist loading from genesis alloc storage",
-		"contract", contractAddr,
-		"note", "Use governance contract to populate whitelist")
-	
-	return whitelist
-}
-
 // loadWhitelistToVerifier loads whitelist entries into verifier
 func loadWhitelistToVerifier(verifier *internalsgx.DCAPVerifier, mrenclaves, mrsigners []string) {
 	for _, mrEnclaveHex := range mrenclaves {
@@ -317,12 +367,7 @@ func (e *SGXEngine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*
 
 	go func() {
 		for i, header := range headers {
-			var parent *types.Header
-			if i > 0 {
-				parent = headers[i-1]
-			}
-
-			err := e.verifyHeader(chain, header, parent)
+			err := e.verifyHeader(chain, header, headers[:i])
 
 			select {
 			case <-abort:
@@ -335,8 +380,8 @@ func (e *SGXEngine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*
 	return abort, results
 }
 
-// verifyHeader 内部验证逻辑
-func (e *SGXEngine) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parent *types.Header) error {
+// verifyHeader 内部验证逻辑，parents 为同批次中排在 header 之前的区块头
+func (e *SGXEngine) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
 	// Skip verification for genesis block
 	if header.Number.Uint64() == 0 {
 		return nil
@@ -348,10 +393,13 @@ func (e *SGXEngine) verifyHeader(chain consensus.ChainHeaderReader, header *type
 	}
 
 	// 获取父区块
-	if parent == nil {
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
 		parent = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
 	}
-	if parent == nil {
+	if parent == nil || parent.Hash() != header.ParentHash {
 		return consensus.ErrUnknownAncestor
 	}
 
@@ -365,57 +413,94 @@ func (e *SGXEngine) verifyHeader(chain consensus.ChainHeaderReader, header *type
 		return ErrInvalidDifficulty
 	}
 
+	// 交易费统一记入激励合约，在 Finalize 中按排名分配
+	if header.Coinbase != e.incentiveContract {
+		return ErrInvalidCoinbase
+	}
+
 	// 解析 Extra 字段
 	extra, err := DecodeSGXExtra(header.Extra)
 	if err != nil {
 		return ErrInvalidExtra
 	}
 
-	// 完整的Quote验证（一次性获取所有数据）
-	// 这会验证Quote并返回所有measurements和instanceID
-	// 匹配gramine sgx-quote-verify.js的verifyQuote()逻辑
-	quoteResult, err := e.verifier.VerifyQuoteComplete(extra.SGXQuote, nil)
+	// 验证 Quote、签名密钥绑定、证明时效和区块签名
+	if err := e.verifySeal(chain.Config().ChainID, header, extra); err != nil {
+		return err
+	}
+
+	// 检查点之后的区块只能由最近检查点中的生产者产生
+	checkpoint, err := e.latestCheckpoint(chain, parent, parents)
 	if err != nil {
-		return fmt.Errorf("quote verification failed: %w", err)
+		return err
 	}
-	
-	if !quoteResult.Verified {
-		return ErrQuoteVerificationFailed
+	if err := e.verifyCheckpointProducer(checkpoint, extra); err != nil {
+		return err
 	}
 
-	// 验证ProducerID：应该等于从Quote验证中返回的PlatformInstanceID
-	// 这确保一个物理CPU只能作为一个生产者，防止Sybil攻击
-	if !bytes.Equal(quoteResult.Measurements.PlatformInstanceID[:], extra.ProducerID) {
-		return fmt.Errorf("producer ID mismatch: expected %x (from %s), got %x",
-			quoteResult.Measurements.PlatformInstanceID[:],
-			quoteResult.Measurements.PlatformInstanceIDSource,
-			extra.ProducerID)
+	// MRENCLAVE/MRSIGNER 白名单（父区块状态不可用时使用最近的检查点或验证器当前加载的白名单）
+	allowed := e.headerWhitelist(chain, parent, checkpoint)
+	if allowed != nil {
+		if err := allowed(extra.SGXQuote); err != nil {
+			return err
+		}
 	}
 
-	// 可以在这里添加更多验证，比如检查MRENCLAVE、MRSIGNER等
+	// 验证生产者签名密钥链
+	if err := e.verifyKeyChain(chain, header, parents); err != nil {
+		return err
+	}
 
-	return nil
+	// 验证心跳：每条心跳的 Quote 都必须有效并绑定心跳内容
+	if err := e.verifyHeartbeats(header, extra.Heartbeats, allowed); err != nil {
+		return err
+	}
+
+	// 验证双签证据（无状态）
+	if err := e.verifyEvidence(chain.Config().ChainID, header, extra.Evidence); err != nil {
+		return err
+	}
+
+	// 验证检查点（父区块状态不可用时只检查格式）
+	if err := e.verifyCheckpoint(chain, header, parent, extra); err != nil {
+		return err
+	}
+
+	// 验证父区块高度的生产者排名
+	return e.verifyRanking(chain.Config().ChainID, extra.Ranking, extra.RankingProofs, parent)
 }
 
-// VerifyUncles 验证叔块（PoA-SGX 不支持叔块）
-// 同时验证SGX Quote中的userData是否匹配seal hash
+// VerifyUncles 验证叔块（PoA-SGX 不支持叔块），并执行需要父区块状态的区块体验证
+// （见 verifyParentState）。区块封装已在 verifyHeader 中验证
 func (e *SGXEngine) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
 	// PoA-SGX不支持叔块
 	if len(block.Uncles()) > 0 {
 		return errors.New("uncles not allowed in PoA-SGX")
 	}
-	
-	// ===== 关键安全验证：Quote userData必须匹配seal hash =====
-	// 这确保了：
-	// 1. Quote确实是为这个特定区块生成的
-	// 2. 区块数据未被篡改
-	// 3. 防止恶意节点用其他区块的Quote替换
-	//
-	// Implementation is in:
-	// - verify_userdata_production.go (strict validation)
-	// - verify_userdata_testenv.go (lenient validation for testing)
-	
-	return e.verifyQuoteUserData(block)
+	return e.verifyParentState(chain, block)
+}
+
+// verifyParentState 按父区块状态验证区块：白名单、排除期、区块限制和检查点内容。
+// 这些检查需要父区块状态，只在区块体验证（BlockValidator.ValidateBody 调用 VerifyUncles）时执行，
+// 只验证区块头（VerifyHeader/VerifyHeaders）的调用方不会执行这些检查
+func (e *SGXEngine) verifyParentState(chain consensus.ChainReader, block *types.Block) error {
+	// MRENCLAVE/MRSIGNER 必须在父区块状态的白名单中
+	if err := e.verifyWhitelist(chain, block.Header()); err != nil {
+		return err
+	}
+
+	// 生产者在父区块状态中不能处于排除期
+	if err := e.verifyExclusion(chain, block.Header()); err != nil {
+		return err
+	}
+
+	// 交易数和 Gas 不能超过父区块状态中治理参数设定的限制
+	if err := e.verifyBlockLimits(chain, block); err != nil {
+		return err
+	}
+
+	// 检查点内容必须与父区块状态一致
+	return e.verifyCheckpointAgainstParent(chain, block.Header())
 }
 
 // Prepare 准备区块头
@@ -434,14 +519,38 @@ func (e *SGXEngine) Prepare(chain consensus.ChainHeaderReader, header *types.Hea
 		header.Time = parent.Time + 1
 	}
 
+	// 交易费记入激励合约，由下一个区块按生产者排名分配
+	header.Coinbase = e.incentiveContract
+
 	// SGX特有：预留Extra空间用于后续在Seal阶段填充
 	// 此时还没有完整的区块信息，所以只预留空间
 	// 实际的SGX Quote将在Seal阶段生成（因为需要完整的区块哈希作为userData）
+	// 父区块高度的候选窗口已关闭，排名在此确定并随区块一起被Quote证明
+	ranking, rankingProofs := e.ranking(chain.Config().ChainID, parent)
 	extra := &SGXExtra{
 		SGXQuote:      []byte{}, // Seal阶段生成
 		ProducerID:    []byte{}, // Seal阶段填充
 		AttestationTS: 0,        // Seal阶段填充
 		Signature:     []byte{}, // Seal阶段生成
+		Ranking:       ranking,
+		RankingProofs: rankingProofs,
+		Heartbeats:    e.pendingHeartbeats(header.Time),
+		Evidence:      e.pendingEvidence(chain, parent),
+	}
+	// 检查点区块记录父区块状态中的白名单和活跃生产者
+	if e.isCheckpoint(header.Number.Uint64()) {
+		checkpoint, err := e.checkpointAt(chain, header, parent)
+		if err != nil {
+			return err
+		}
+		extra.WhitelistHash = checkpoint.WhitelistHash
+		extra.CheckpointMREnclaves = checkpoint.MREnclaves
+		extra.CheckpointMRSigners = checkpoint.MRSigners
+		extra.Producers = checkpoint.Producers
+	}
+	// 区块随机数在执行交易前确定，没有签名密钥时 Seal 会失败
+	if err := e.prepareRandomness(chain, header, extra); err != nil {
+		log.Warn("Failed to compute block randomness", "number", header.Number, "err", err)
 	}
 
 	extraData, err := extra.Encode()
@@ -453,10 +562,10 @@ func (e *SGXEngine) Prepare(chain consensus.ChainHeaderReader, header *types.Hea
 	return nil
 }
 
-// Finalize 完成区块（计算状态根，不包含奖励）
+// Finalize 完成区块：发放父区块高度的奖励、记录本区块的交易费，并处理验证者质押
 func (e *SGXEngine) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state vm.StateDB, body *types.Body) {
-	// Block rewards and incentives are managed by the incentive system
-	// No additional finalization needed here
+	e.accumulateRewards(chain, state, header, body)
+	e.finalizeStaking(chain.Config(), state, header)
 }
 
 // FinalizeAndAssemble 完成并组装区块
@@ -471,70 +580,37 @@ func (e *SGXEngine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, heade
 	return types.NewBlock(header, body, receipts, trie.NewStackTrie(nil)), nil
 }
 
-// Seal 密封区块（生成SGX远程证明）
-// 这是唯一涉及SGX的核心函数，其他所有处理与以太坊一致
+// Seal 密封区块
+// 使用 enclave 内由 SGX Quote 证明的签名密钥对区块签名（封装格式见 seal.go），
+// 签名密钥定期轮换并重新证明，其他所有处理与以太坊一致
 func (e *SGXEngine) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
 	header := block.Header()
 
-	// ===== SGX核心功能：远程证明 =====
-	// 使用seal hash（不包含Extra的哈希）作为userData生成Quote
-	// Quote本身就是签名！不需要额外的ECDSA签名
-	
-	// 1. 计算seal hash（不包含Extra/签名的区块哈希）
-	//    这是标准以太坊PoA的做法，因为Extra在Seal时才填充
-	sealHash := e.SealHash(header)
-	
-	// 2. 生成SGX Quote，将seal hash写入userData
-	//    Quote包含：
-	//    - MRENCLAVE（证明代码未被篡改）
-	//    - userData（seal hash）
-	//    - 硬件签名（Intel/AMD CPU签名，不可伪造）
-	//    验证Quote即可确保：
-	//    - 区块来自合法SGX enclave
-	//    - 区块数据完整性（哈希匹配）
-	//    - 无需额外的ECDSA签名或密钥管理
-	quote, err := e.attestor.GenerateQuote(sealHash.Bytes())
+	// Prepare阶段确定的生产者排名、心跳列表、双签证据和检查点
+	extra, err := DecodeSGXExtra(header.Extra)
 	if err != nil {
-		return err
+		extra = &SGXExtra{}
 	}
-
-	// 3. 从Quote验证中获取ProducerID
-	//    使用VerifyQuoteComplete一次性获取所有数据（包括instanceID）
-	//    这样ProducerID和验证逻辑保持一致
-	quoteResult, err := e.verifier.VerifyQuoteComplete(quote, nil)
+	chainID := chain.Config().ChainID
+	key, err := e.currentSigningKey(chain, header)
 	if err != nil {
-		return fmt.Errorf("failed to verify generated quote: %w", err)
+		return err
 	}
-	
-	if !quoteResult.Verified {
-		return errors.New("generated quote failed verification")
+	// 交易已用 Prepare 阶段的随机数执行，签名密钥必须与之对应
+	if err := verifyRandomness(chainID, header, &SGXExtra{SigningKey: key.publicKey, VRFProof: extra.VRFProof}); err != nil {
+		return err
 	}
-	
-	// Debug logging
-	log.Debug("Seal: Quote verification result",
-		"verified", quoteResult.Verified,
-		"platformInstanceID", fmt.Sprintf("%x", quoteResult.Measurements.PlatformInstanceID),
-		"platformInstanceIDSource", quoteResult.Measurements.PlatformInstanceIDSource,
-		"platformInstanceIDLen", len(quoteResult.Measurements.PlatformInstanceID))
-	
-	// ProducerID就是PlatformInstanceID
-	producerID := quoteResult.Measurements.PlatformInstanceID[:]
-	
-	log.Debug("Seal: ProducerID set", "producerID", fmt.Sprintf("%x", producerID), "length", len(producerID))
-
-	// 4. 构造包含SGX证明的Extra数据
-	extra := &SGXExtra{
-		SGXQuote:      quote,                       // SGX Quote（硬件级签名，包含seal hash）
-		ProducerID:    producerID,                  // 出块者身份标识
-		AttestationTS: uint64(time.Now().Unix()),  // 证明时间戳
-		Signature:     []byte{},                    // 空，Quote本身就是签名
+	if err := e.signHeader(chainID, header, key, extra); err != nil {
+		return err
 	}
-
-	extraData, err := extra.Encode()
+	// 签名只有在记录之后才离开 Seal，本地节点不会在同一父区块上发布两个不同的区块
+	e.sealMu.Lock()
+	err = guardSeal(e.signed, header.Number.Uint64(), header.ParentHash, e.SealHash(header))
+	e.sealMu.Unlock()
 	if err != nil {
 		return err
 	}
-	header.Extra = extraData
+	log.Debug("Sealed block", "number", header.Number, "producer", nodeAddress(key.producerID), "sealhash", e.SealHash(header))
 
 	// 标准以太坊处理：返回密封后的区块
 	select {
@@ -579,57 +655,29 @@ func (e *SGXEngine) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 
 // Close 关闭引擎
 func (e *SGXEngine) Close() error {
+	e.closeOnce.Do(func() { close(e.quit) })
 	return nil
 }
 
-// accumulateRewards 累积奖励
-func (e *SGXEngine) accumulateRewards(chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, body *types.Body) {
-	// 获取区块生产者地址
-	producer, err := e.Author(header)
-	if err != nil {
-		return
-	}
-
-	// Calculate total transaction fees
-	// Using tx.Gas() (gas limit) for fee calculation in the Finalize stage.
-	// Gas used accounting happens during transaction execution.
-	totalFees := new(big.Int)
-	for _, tx := range body.Transactions {
-		gasPrice := tx.GasPrice()
-		if gasPrice != nil {
-			fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(tx.Gas()))
-			totalFees.Add(totalFees, fee)
-		}
-	}
-
-	// 基础出块奖励
-	blockReward := new(big.Int).Set(e.config.RewardConfig.BaseBlockReward)
-
-	// 添加交易费
-	blockReward.Add(blockReward, totalFees)
-
-	// 计算区块质量倍数
-	block := types.NewBlock(header, body, nil, nil)
-	quality := e.blockQualityScorer.CalculateQuality(block)
-
-	// 应用质量倍数
-	qualityBonus := new(big.Int).SetUint64(uint64(float64(blockReward.Uint64()) * (quality.RewardMultiplier - 1.0)))
-	if qualityBonus.Sign() > 0 {
-		blockReward.Add(blockReward, qualityBonus)
-	}
-
-	// 分配奖励到生产者
-	reward, overflow := uint256.FromBig(blockReward)
-	if !overflow {
-		state.AddBalance(producer, reward, 0)
-	}
-}
-
 // SetBlockProducer 设置区块生产者（用于测试）
 func (e *SGXEngine) SetBlockProducer(bp *BlockProducer) {
 	e.blockProducer = bp
 }
 
+// SetDecryptionShares 设置解密份额来源，区块生产者用其揭示已提交的加密交易
+func (e *SGXEngine) SetDecryptionShares(source core.DecryptionShareSource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shares = source
+}
+
+// decryptionShares 返回解密份额来源，未设置时为 nil
+func (e *SGXEngine) decryptionShares() core.DecryptionShareSource {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.shares
+}
+
 // InitBlockProducer 初始化并启动区块生产者
 // 必须在 txPool 和 blockchain 都可用后调用
 func (e *SGXEngine) InitBlockProducer(txPool TxPool, chain BlockChain) error {
@@ -649,6 +697,52 @@ func (e *SGXEngine) GetConfig() *Config {
 	return e.config
 }
 
+// configAt 返回在父区块状态上生效的配置，即应用了治理参数的本地配置。
+// 治理参数与本地配置组合后无效时沿用本地配置，父区块状态不可用时返回错误
+func (e *SGXEngine) configAt(chain consensus.ChainHeaderReader, parent *types.Header) (*Config, error) {
+	reader, ok := chain.(stateReader)
+	if !ok || e.governanceContract == (common.Address{}) {
+		return e.config, nil
+	}
+	statedb, err := reader.StateAt(parent.Root)
+	if err != nil {
+		return nil, consensus.ErrPrunedAncestor
+	}
+	params := governance.NewStateParameters(statedb, e.governanceContract).Parameters()
+	if len(params) == 0 {
+		return e.config, nil
+	}
+	config, err := e.config.WithParameters(params)
+	if err != nil {
+		log.Warn("Ignoring invalid governance parameters", "number", parent.Number, "err", err)
+		return e.config, nil
+	}
+	return config, nil
+}
+
+// verifyBlockLimits 检查区块的交易数和 Gas 不超过父区块状态中生效的限制
+func (e *SGXEngine) verifyBlockLimits(chain consensus.ChainHeaderReader, block *types.Block) error {
+	number := block.NumberU64()
+	if number == 0 {
+		return nil
+	}
+	parent := chain.GetHeader(block.ParentHash(), number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	config, err := e.configAt(chain, parent)
+	if err != nil {
+		return err
+	}
+	if len(block.Transactions()) > config.MaxTxPerBlock {
+		return fmt.Errorf("too many transactions: %d > %d", len(block.Transactions()), config.MaxTxPerBlock)
+	}
+	if block.GasUsed() > config.MaxGasPerBlock {
+		return fmt.Errorf("gas used exceeds limit: %d > %d", block.GasUsed(), config.MaxGasPerBlock)
+	}
+	return nil
+}
+
 // GetBlockQualityScorer 获取质量评分器
 func (e *SGXEngine) GetBlockQualityScorer() *BlockQualityScorer {
 	return e.blockQualityScorer
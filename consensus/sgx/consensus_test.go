@@ -365,20 +365,30 @@ func TestMultiProducerReward(t *testing.T) {
 // TestReputationSystem tests the reputation system
 func TestReputationSystem(t *testing.T) {
 	config := DefaultConfig()
-	uptimeCalc := NewUptimeCalculator(config.UptimeConfig)
-	penaltyMgr := NewPenaltyManager(config.PenaltyConfig)
-	repSystem := NewReputationSystem(config.ReputationConfig, uptimeCalc, penaltyMgr)
+	store := NewNodeStateStore(testIncentiveContract)
+	uptimeCalc := NewUptimeCalculator(config.UptimeConfig, store)
+	penaltyMgr := NewPenaltyManager(config.PenaltyConfig, store)
+	repSystem := NewReputationSystem(config.ReputationConfig, uptimeCalc, penaltyMgr, store)
+	statedb := newNodeTestState(t)
 
 	address := common.HexToAddress("0x1234567890")
 
+	// Never updated nodes have no reputation
+	if rep, err := repSystem.GetReputation(statedb, address); err != nil || rep != nil {
+		t.Fatalf("unexpected reputation before update: %v, %v", rep, err)
+	}
+	uptimeCalc.heartbeatTracker.AdvanceRound(statedb, 100)
+	uptimeCalc.heartbeatTracker.RecordHeartbeat(statedb, address, 100)
+	uptimeCalc.RecordResponse(statedb, address, 0, bpsDenominator)
+
 	// Update reputation
-	err := repSystem.UpdateReputation(address)
+	err := repSystem.UpdateReputation(statedb, address, 100)
 	if err != nil {
 		t.Fatalf("Failed to update reputation: %v", err)
 	}
 
 	// Get reputation
-	rep, err := repSystem.GetReputation(address)
+	rep, err := repSystem.GetReputation(statedb, address)
 	if err != nil {
 		t.Fatalf("Failed to get reputation: %v", err)
 	}
@@ -386,6 +396,9 @@ func TestReputationSystem(t *testing.T) {
 	if rep == nil {
 		t.Fatal("Reputation should not be nil")
 	}
+	if rep.ReputationScore == 0 || rep.SuccessRate != 1 {
+		t.Errorf("unexpected reputation: %+v", rep)
+	}
 
 	t.Logf("Reputation Score: %d", rep.ReputationScore)
 }
@@ -393,31 +406,30 @@ func TestReputationSystem(t *testing.T) {
 // TestUptimeCalculator tests uptime calculation
 func TestUptimeCalculator(t *testing.T) {
 	config := DefaultConfig()
-	uptimeCalc := NewUptimeCalculator(config.UptimeConfig)
+	uptimeCalc := NewUptimeCalculator(config.UptimeConfig, NewNodeStateStore(testIncentiveContract))
+	statedb := newNodeTestState(t)
 
 	address := common.HexToAddress("0x1234567890")
+	interval := uint64(config.UptimeConfig.HeartbeatInterval / time.Second)
 
-	// Record some heartbeats
-	for i := 0; i < 5; i++ {
-		msg := &HeartbeatMessage{
-			NodeID:    address,
-			Timestamp: uint64(time.Now().Unix()),
-			SGXQuote:  []byte("mock-quote"),
-			Signature: []byte("mock-sig"),
-		}
-		uptimeCalc.RecordHeartbeat(msg)
+	// Record a heartbeat in each of five rounds
+	for i := uint64(0); i < 5; i++ {
+		now := 1000 + i*interval
+		uptimeCalc.heartbeatTracker.AdvanceRound(statedb, now)
+		uptimeCalc.heartbeatTracker.RecordHeartbeat(statedb, address, now)
 	}
 
-	// Calculate uptime score with network statistics
-	// For testing, use sample network stats
-	networkObservers := 10
-	networkTotalTxs := uint64(1000)
-	networkTotalGas := uint64(30000000)
-	
-	uptimeData := uptimeCalc.CalculateUptimeScore(address, networkObservers, networkTotalTxs, networkTotalGas)
+	uptimeData := uptimeCalc.CalculateUptimeScore(statedb, address)
 
-	if uptimeData.HeartbeatScore == 0 {
-		t.Error("Heartbeat score should not be zero after recording heartbeats")
+	if uptimeData.HeartbeatScore != 10000 {
+		t.Errorf("Heartbeat score %d, want 10000 after a heartbeat in every round", uptimeData.HeartbeatScore)
+	}
+	// Five more rounds without heartbeats halve the score
+	for i := uint64(5); i < 10; i++ {
+		uptimeCalc.heartbeatTracker.AdvanceRound(statedb, 1000+i*interval)
+	}
+	if score := uptimeCalc.CalculateUptimeScore(statedb, address).HeartbeatScore; score != 5000 {
+		t.Errorf("Heartbeat score %d, want 5000", score)
 	}
 
 	t.Logf("Uptime Data: Heartbeat=%d, Consensus=%d, TxParticipation=%d, Response=%d, Comprehensive=%d",
@@ -431,25 +443,30 @@ func TestUptimeCalculator(t *testing.T) {
 // TestPenaltyManager tests penalty management
 func TestPenaltyManager(t *testing.T) {
 	config := DefaultConfig()
-	penaltyMgr := NewPenaltyManager(config.PenaltyConfig)
+	penaltyMgr := NewPenaltyManager(config.PenaltyConfig, NewNodeStateStore(testIncentiveContract))
+	statedb := newNodeTestState(t)
 
 	address := common.HexToAddress("0x1234567890")
+	now := uint64(1000)
 
 	// Record penalties
 	for i := 0; i < 3; i++ {
-		err := penaltyMgr.RecordPenalty(address, "low_quality", big.NewInt(1e18), "Low quality block")
+		err := penaltyMgr.RecordPenalty(statedb, address, "low_quality", now)
 		if err != nil {
 			t.Fatalf("Failed to record penalty: %v", err)
 		}
 	}
 
 	// Check if excluded
-	if !penaltyMgr.IsExcluded(address) {
+	if !penaltyMgr.IsExcluded(statedb, address, now) {
 		t.Error("Node should be excluded after 3 penalties")
 	}
+	if end := now + uint64(config.PenaltyConfig.ExclusionPeriod/time.Second); penaltyMgr.IsExcluded(statedb, address, end) {
+		t.Error("Node should not be excluded after the exclusion period")
+	}
 
 	// Get penalty count
-	count, err := penaltyMgr.GetPenaltyCount(address)
+	count, err := penaltyMgr.GetPenaltyCount(statedb, address)
 	if err != nil {
 		t.Fatalf("Failed to get penalty count: %v", err)
 	}
@@ -457,6 +474,13 @@ func TestPenaltyManager(t *testing.T) {
 	if count != 3 {
 		t.Errorf("Expected 3 penalties, got %d", count)
 	}
+
+	// Penalties are forgiven after the recovery period
+	later := now + uint64(config.PenaltyConfig.RecoveryPeriod/time.Second)
+	penaltyMgr.RecordPenalty(statedb, address, "offline", later)
+	if count, _ := penaltyMgr.GetPenaltyCount(statedb, address); count != 1 {
+		t.Errorf("Expected penalty count reset to 1, got %d", count)
+	}
 }
 
 // BenchmarkBlockQualityScoring benchmarks quality scoring
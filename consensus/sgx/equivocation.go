@@ -0,0 +1,299 @@
+package sgx
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+const (
+	// MaxEvidencePerBlock 每个区块最多携带的双签证据数
+	MaxEvidencePerBlock = 4
+
+	// evidenceWindow 双签证据的有效区块数：高度 n 的证据只能由 n+1 到 n+evidenceWindow 的区块提交
+	evidenceWindow = 256
+)
+
+// 已处罚的双签行为，键为 keccak256(前缀 ++ 生产者地址 ++ 父区块哈希)，值为处罚所在的区块高度
+var evidencePrefix = []byte("sgx.evidence")
+
+// DoubleSignEvidence 双签证据：同一生产者在同一父区块上密封的两个不同区块头。
+// 两个区块头各自带有证明签名密钥的 SGX Quote 和对封装摘要的签名，
+// 无需任何链状态即可验证。First 的 seal hash 小于 Second，保证同一对区块头只有一种编码
+type DoubleSignEvidence struct {
+	First  *types.Header `json:"first"`
+	Second *types.Header `json:"second"`
+}
+
+// offenceKey 双签行为的唯一标识：生产者地址 ++ 父区块哈希。
+// 同一行为的多组证据只处罚一次
+func offenceKey(producer common.Address, parent common.Hash) []byte {
+	return append(producer.Bytes(), parent.Bytes()...)
+}
+
+// newDoubleSignEvidence 按 seal hash 排序构造证据
+func newDoubleSignEvidence(a, b *types.Header, sealA, sealB common.Hash) *DoubleSignEvidence {
+	if bytes.Compare(sealA[:], sealB[:]) > 0 {
+		a, b = b, a
+	}
+	return &DoubleSignEvidence{First: a, Second: b}
+}
+
+// sealedHeader 检测器记录的已密封区块头
+type sealedHeader struct {
+	header   *types.Header
+	sealHash common.Hash
+}
+
+// EquivocationDetector 双签检测器
+// 记录近期每个生产者在每个父区块上密封的第一个区块头，
+// 再次见到同一生产者在同一父区块上的不同区块头时生成双签证据，等待打包进区块
+type EquivocationDetector struct {
+	mu      sync.Mutex
+	sealed  map[string]*sealedHeader       // offenceKey -> 第一个区块头
+	pending map[string]*DoubleSignEvidence // offenceKey -> 待提交的证据
+	head    uint64                         // 见到的最高区块高度
+}
+
+// NewEquivocationDetector 创建双签检测器
+func NewEquivocationDetector() *EquivocationDetector {
+	return &EquivocationDetector{
+		sealed:  make(map[string]*sealedHeader),
+		pending: make(map[string]*DoubleSignEvidence),
+	}
+}
+
+// Observe 记录一个 Quote 已验证的区块头，与已记录的区块头冲突时返回双签证据
+func (d *EquivocationDetector) Observe(producer common.Address, header *types.Header, sealHash common.Hash) *DoubleSignEvidence {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	number := header.Number.Uint64()
+	if number+evidenceWindow <= d.head {
+		return nil
+	}
+	if number > d.head {
+		d.head = number
+		d.prune()
+	}
+	key := string(offenceKey(producer, header.ParentHash))
+	prev := d.sealed[key]
+	if prev == nil {
+		d.sealed[key] = &sealedHeader{header: header, sealHash: sealHash}
+		return nil
+	}
+	if prev.sealHash == sealHash {
+		return nil
+	}
+	return newDoubleSignEvidence(prev.header, header, prev.sealHash, sealHash)
+}
+
+// Add 登记一条已验证的证据，等待打包
+func (d *EquivocationDetector) Add(producer common.Address, evidence *DoubleSignEvidence) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if evidence.First.Number.Uint64()+evidenceWindow <= d.head {
+		return
+	}
+	key := string(offenceKey(producer, evidence.First.ParentHash))
+	if _, ok := d.pending[key]; !ok {
+		d.pending[key] = evidence
+	}
+}
+
+// Pending 返回可由高度 number 的区块提交的证据，按 offenceKey 升序。
+// applied 报告行为是否已被处罚，已处罚的证据从待提交列表中删除
+func (d *EquivocationDetector) Pending(number uint64, applied func(key []byte) bool) []*DoubleSignEvidence {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	keys := make([]string, 0, len(d.pending))
+	for key, evidence := range d.pending {
+		height := evidence.First.Number.Uint64()
+		if height >= number || height+evidenceWindow < number {
+			continue
+		}
+		if applied != nil && applied([]byte(key)) {
+			delete(d.pending, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > MaxEvidencePerBlock {
+		keys = keys[:MaxEvidencePerBlock]
+	}
+	evidence := make([]*DoubleSignEvidence, len(keys))
+	for i, key := range keys {
+		evidence[i] = d.pending[key]
+	}
+	return evidence
+}
+
+// prune 删除超出证据有效期的记录
+func (d *EquivocationDetector) prune() {
+	for key, sealed := range d.sealed {
+		if sealed.header.Number.Uint64()+evidenceWindow <= d.head {
+			delete(d.sealed, key)
+		}
+	}
+	for key, evidence := range d.pending {
+		if evidence.First.Number.Uint64()+evidenceWindow <= d.head {
+			delete(d.pending, key)
+		}
+	}
+}
+
+// ObserveSealed 将封装已验证的区块头交给双签检测器，发现双签时登记证据。
+// 由区块广播（AddCandidate）和区块导入（链上新区块事件）路径调用，不在验证钩子中执行
+func (e *SGXEngine) ObserveSealed(header *types.Header) {
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil || len(extra.ProducerID) == 0 {
+		return
+	}
+	producer := nodeAddress(extra.ProducerID)
+	evidence := e.equivocations.Observe(producer, header, e.SealHash(header))
+	if evidence == nil {
+		return
+	}
+	log.Warn("Detected double-signing producer", "producer", producer, "number", header.Number,
+		"first", evidence.First.Hash(), "second", evidence.Second.Hash())
+	e.equivocations.Add(producer, evidence)
+}
+
+// SubmitEvidence 验证并登记外部提交的双签证据，由后续本地生产的区块打包
+func (e *SGXEngine) SubmitEvidence(chain consensus.ChainHeaderReader, evidence *DoubleSignEvidence) error {
+	producer, err := e.verifyDoubleSign(chain.Config().ChainID, evidence, chain.CurrentHeader().Number.Uint64()+1)
+	if err != nil {
+		return err
+	}
+	e.equivocations.Add(producer, evidence)
+	return nil
+}
+
+// pendingEvidence 返回以 parent 为父区块的新区块应携带的双签证据，
+// 跳过在父区块状态中已处罚的行为
+func (e *SGXEngine) pendingEvidence(chain consensus.ChainHeaderReader, parent *types.Header) []*DoubleSignEvidence {
+	var statedb vm.StateDB
+	if reader, ok := chain.(stateReader); ok {
+		if st, err := reader.StateAt(parent.Root); err == nil {
+			statedb = st
+		}
+	}
+	var applied func([]byte) bool
+	if statedb != nil {
+		applied = func(key []byte) bool {
+			return statedb.GetState(e.incentiveContract, rewardStateKey(evidencePrefix, key)) != (common.Hash{})
+		}
+	}
+	return e.equivocations.Pending(parent.Number.Uint64()+1, applied)
+}
+
+// verifySealedHeader 无状态验证证据中的区块头的封装，返回其 SGXExtra 和 seal hash
+func (e *SGXEngine) verifySealedHeader(chainID *big.Int, header *types.Header) (*SGXExtra, common.Hash, error) {
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		return nil, common.Hash{}, ErrInvalidExtra
+	}
+	if err := e.verifySeal(chainID, header, extra); err != nil {
+		return nil, common.Hash{}, err
+	}
+	return extra, e.SealHash(header), nil
+}
+
+// verifyDoubleSign 验证高度 number 的区块提交的一条双签证据，返回双签的生产者地址
+func (e *SGXEngine) verifyDoubleSign(chainID *big.Int, evidence *DoubleSignEvidence, number uint64) (common.Address, error) {
+	if evidence == nil || evidence.First == nil || evidence.Second == nil || evidence.First.Number == nil || evidence.Second.Number == nil {
+		return common.Address{}, fmt.Errorf("%w: missing header", ErrInvalidEvidence)
+	}
+	first, second := evidence.First, evidence.Second
+	if first.Number.Cmp(second.Number) != 0 || first.ParentHash != second.ParentHash {
+		return common.Address{}, fmt.Errorf("%w: headers do not share a parent", ErrInvalidEvidence)
+	}
+	height := first.Number.Uint64()
+	if height == 0 || height >= number || height+evidenceWindow < number {
+		return common.Address{}, fmt.Errorf("%w: height %d outside window of block %d", ErrInvalidEvidence, height, number)
+	}
+	extraA, sealA, err := e.verifySealedHeader(chainID, first)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: first header: %v", ErrInvalidEvidence, err)
+	}
+	extraB, sealB, err := e.verifySealedHeader(chainID, second)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%w: second header: %v", ErrInvalidEvidence, err)
+	}
+	if !bytes.Equal(extraA.ProducerID, extraB.ProducerID) {
+		return common.Address{}, fmt.Errorf("%w: different producers", ErrInvalidEvidence)
+	}
+	if bytes.Compare(sealA[:], sealB[:]) >= 0 {
+		return common.Address{}, fmt.Errorf("%w: headers not ordered by seal hash", ErrInvalidEvidence)
+	}
+	return nodeAddress(extraA.ProducerID), nil
+}
+
+// verifyEvidence 验证区块携带的双签证据：数量有上限，按 offenceKey 严格升序
+func (e *SGXEngine) verifyEvidence(chainID *big.Int, header *types.Header, evidence []*DoubleSignEvidence) error {
+	if len(evidence) > MaxEvidencePerBlock {
+		return fmt.Errorf("%w: %d entries, max %d", ErrInvalidEvidence, len(evidence), MaxEvidencePerBlock)
+	}
+	var prev []byte
+	for _, ev := range evidence {
+		producer, err := e.verifyDoubleSign(chainID, ev, header.Number.Uint64())
+		if err != nil {
+			return err
+		}
+		key := offenceKey(producer, ev.First.ParentHash)
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			return fmt.Errorf("%w: entries not sorted", ErrInvalidEvidence)
+		}
+		prev = key
+	}
+	return nil
+}
+
+// applyEvidence 在 Finalize 中处罚区块携带的双签证据（证据已在 verifyHeader 中验证）：
+// 立即排除生产者，按 incentive.PenaltyManager 的双签比例罚没其余额、
+// 按 SlashingRate 罚没与其生产者 ID 绑定的验证者在治理合约中的质押，均转入激励合约并留存在合约中，
+// 不作为交易费分配。同一行为只处罚一次
+func (e *SGXEngine) applyEvidence(config *params.ChainConfig, statedb vm.StateDB, header *types.Header, evidence []*DoubleSignEvidence) {
+	for _, ev := range evidence {
+		extra, err := DecodeSGXExtra(ev.First.Extra)
+		if err != nil {
+			continue
+		}
+		producer := nodeAddress(extra.ProducerID)
+		key := rewardStateKey(evidencePrefix, offenceKey(producer, ev.First.ParentHash))
+		if statedb.GetState(e.incentiveContract, key) != (common.Hash{}) {
+			continue
+		}
+		statedb.SetState(e.incentiveContract, key, common.BigToHash(header.Number))
+
+		e.penaltyManager.RecordDoubleSign(statedb, producer, header.Time)
+		if err := e.reputationSystem.UpdateReputation(statedb, producer, header.Time); err != nil {
+			log.Error("Failed to update node reputation", "address", producer, "err", err)
+		}
+		balance := statedb.GetBalance(producer)
+		slashed, overflow := uint256.FromBig(e.slashing.CalculateDoubleSignPenalty(balance.ToBig()))
+		if overflow || slashed.Gt(balance) {
+			slashed = balance.Clone()
+		}
+		if !slashed.IsZero() {
+			statedb.SubBalance(producer, slashed, tracing.BalanceChangeTransfer)
+			statedb.AddBalance(e.incentiveContract, slashed, tracing.BalanceChangeTransfer)
+		}
+		log.Info("Slashed double-signing producer", "producer", producer, "height", ev.First.Number, "amount", slashed)
+		e.slashStake(config, statedb, header, extra.ProducerID)
+	}
+}
@@ -0,0 +1,221 @@
+package sgx
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/holiman/uint256"
+)
+
+// doubleSignHeaders returns two different headers sealed by the same producer
+// on the same parent.
+func doubleSignHeaders(t *testing.T, producer byte, parent common.Hash, number int64) (*types.Header, *types.Header) {
+	producerID := make([]byte, 32)
+	producerID[0] = producer
+	quote := append(common.CopyBytes(producerID), make([]byte, 32)...)
+	extra, err := (&SGXExtra{ProducerID: producerID, SGXQuote: quote}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &types.Header{ParentHash: parent, Number: big.NewInt(number), Time: 100, Extra: extra}
+	b := &types.Header{ParentHash: parent, Number: big.NewInt(number), Time: 101, Extra: extra}
+	return a, b
+}
+
+func TestEquivocationDetector(t *testing.T) {
+	var (
+		detector = NewEquivocationDetector()
+		producer = common.Address{0x01}
+		a, b     = doubleSignHeaders(t, 1, common.Hash{0xaa}, 10)
+		sealA    = common.Hash{0x02}
+		sealB    = common.Hash{0x01}
+	)
+	if ev := detector.Observe(producer, a, sealA); ev != nil {
+		t.Fatal("evidence from a single header")
+	}
+	if ev := detector.Observe(producer, a, sealA); ev != nil {
+		t.Fatal("evidence from the same header seen twice")
+	}
+	other := types.CopyHeader(b)
+	other.ParentHash = common.Hash{0xbb}
+	if ev := detector.Observe(producer, other, sealB); ev != nil {
+		t.Fatal("evidence from headers on different parents")
+	}
+	ev := detector.Observe(producer, b, sealB)
+	if ev == nil {
+		t.Fatal("double-sign not detected")
+	}
+	if ev.First != b || ev.Second != a {
+		t.Fatal("evidence not ordered by seal hash")
+	}
+	detector.Add(producer, ev)
+
+	if pending := detector.Pending(10, nil); len(pending) != 0 {
+		t.Errorf("evidence pending for its own height: %d", len(pending))
+	}
+	if pending := detector.Pending(11, nil); len(pending) != 1 || pending[0] != ev {
+		t.Fatalf("evidence not pending for the next block: %v", pending)
+	}
+	if pending := detector.Pending(11+evidenceWindow, nil); len(pending) != 0 {
+		t.Errorf("evidence pending beyond the window")
+	}
+	applied := func(key []byte) bool {
+		return bytes.Equal(key, offenceKey(producer, a.ParentHash))
+	}
+	if pending := detector.Pending(12, applied); len(pending) != 0 {
+		t.Errorf("applied evidence still pending")
+	}
+	if pending := detector.Pending(12, nil); len(pending) != 0 {
+		t.Errorf("applied evidence not dropped")
+	}
+}
+
+func TestVerifyEvidenceMalformed(t *testing.T) {
+	engine := New(DefaultConfig(), nil, heartbeatTestVerifier{})
+	a, b := doubleSignHeaders(t, 1, common.Hash{0xaa}, 10)
+	header := &types.Header{Number: big.NewInt(11)}
+
+	otherParent := types.CopyHeader(b)
+	otherParent.ParentHash = common.Hash{0xbb}
+	otherHeight := types.CopyHeader(b)
+	otherHeight.Number = big.NewInt(9)
+
+	tests := []struct {
+		name     string
+		evidence []*DoubleSignEvidence
+	}{
+		{"missing header", []*DoubleSignEvidence{{First: a}}},
+		{"different parents", []*DoubleSignEvidence{{First: a, Second: otherParent}}},
+		{"different heights", []*DoubleSignEvidence{{First: a, Second: otherHeight}}},
+		{"too many", make([]*DoubleSignEvidence, MaxEvidencePerBlock+1)},
+	}
+	for _, tt := range tests {
+		if err := engine.verifyEvidence(common.Big1, header, tt.evidence); !errors.Is(err, ErrInvalidEvidence) {
+			t.Errorf("%s: expected ErrInvalidEvidence, got %v", tt.name, err)
+		}
+	}
+	// Evidence must be submitted within the window after its height
+	for _, number := range []int64{10, 11 + evidenceWindow} {
+		late := &types.Header{Number: big.NewInt(number)}
+		if err := engine.verifyEvidence(common.Big1, late, []*DoubleSignEvidence{{First: a, Second: b}}); !errors.Is(err, ErrInvalidEvidence) {
+			t.Errorf("block %d: expected ErrInvalidEvidence, got %v", number, err)
+		}
+	}
+}
+
+// Tests that evidence carried by a block excludes the producer, moves part of
+// its balance into the incentive contract and slashes its stake in the
+// governance contract once, even when the block is finalized again.
+func TestApplyEvidence(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+	engine.governanceContract = testGovernanceContract
+
+	var (
+		statedb  = newNodeTestState(t)
+		genesis  = &types.Header{Number: big.NewInt(0)}
+		chain    = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		a, b     = doubleSignHeaders(t, 7, genesis.Hash(), 1)
+		extra, _ = DecodeSGXExtra(a.Extra)
+		offender = nodeAddress(extra.ProducerID)
+		staker   = common.Address{0x99}
+		config   = governance.DefaultStakingConfig()
+		stake    = config.MinStakeAmount
+	)
+	block := nodeTestHeader(t, genesis, 1, 1000, nil)
+	blockExtra, _ := DecodeSGXExtra(block.Extra)
+	blockExtra.Evidence = []*DoubleSignEvidence{{First: a, Second: b}}
+	block.Extra, _ = blockExtra.Encode()
+
+	// The operator stakes from its own account, bound to the producer ID.
+	statedb.AddBalance(staker, uint256.MustFromBig(stake), tracing.BalanceChangeUnspecified)
+	if err := engine.stakingManager(statedb, genesis).StakeProducer(staker, common.BytesToHash(extra.ProducerID), stake); err != nil {
+		t.Fatal(err)
+	}
+	statedb.AddBalance(offender, uint256.NewInt(1000), tracing.BalanceChangeUnspecified)
+
+	engine.Finalize(chain, block, statedb, &types.Body{})
+	engine.Finalize(chain, block, statedb, &types.Body{})
+
+	slashed := new(big.Int).Div(new(big.Int).Mul(stake, new(big.Int).SetUint64(config.SlashingRate)), big.NewInt(100))
+	if got := statedb.GetBalance(offender).Uint64(); got != 500 {
+		t.Errorf("offender balance: got %d, want 500", got)
+	}
+	if got, want := statedb.GetBalance(testIncentiveContract).ToBig(), new(big.Int).Add(slashed, big.NewInt(500)); got.Cmp(want) != 0 {
+		t.Errorf("incentive contract balance: got %v, want %v", got, want)
+	}
+	if !engine.penaltyManager.IsExcluded(statedb, offender, block.Time) {
+		t.Error("double-signing producer not excluded")
+	}
+	info, err := engine.stakingManager(statedb, block).GetValidator(staker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := new(big.Int).Sub(stake, slashed); info.StakeAmount.Cmp(want) != 0 {
+		t.Errorf("validator stake: got %v, want %v", info.StakeAmount, want)
+	}
+}
+
+// Tests that two blocks sealed by the same producer on the same parent yield
+// evidence that verifies in a later block and, once that block is finalized,
+// slashes the stake the operator bound to the producer ID.
+func TestDoubleSignSlashesBoundStake(t *testing.T) {
+	var (
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		now     = uint64(time.Now().Unix())
+		statedb = newNodeTestState(t)
+		staker  = common.Address{0x99}
+		config  = governance.DefaultStakingConfig()
+		stake   = config.MinStakeAmount
+
+		// The producer runs two nodes which seal competing blocks.
+		first, second = rankingTestEngine(7), rankingTestEngine(7)
+		producerID    = first.attestor.(*heartbeatTestAttestor).producerID
+		engine        = rankingTestEngine(1)
+	)
+	engine.setIncentiveContract(testIncentiveContract)
+	engine.governanceContract = testGovernanceContract
+
+	statedb.AddBalance(staker, uint256.MustFromBig(stake), tracing.BalanceChangeUnspecified)
+	if err := engine.stakingManager(statedb, genesis).StakeProducer(staker, common.BytesToHash(producerID), stake); err != nil {
+		t.Fatal(err)
+	}
+	a := sealTestHeader(t, first, chain, genesis, now)
+	b := sealTestHeader(t, second, chain, genesis, now+1)
+	chain.headers[a.Hash()] = a
+
+	engine.ObserveSealed(a)
+	engine.ObserveSealed(b)
+	evidence := engine.pendingEvidence(chain, a)
+	if len(evidence) != 1 {
+		t.Fatalf("got %d pieces of evidence, want 1", len(evidence))
+	}
+	block := nodeTestHeader(t, a, 1, now+2, nil)
+	extra, _ := DecodeSGXExtra(block.Extra)
+	extra.Evidence = evidence
+	block.Extra, _ = extra.Encode()
+	if err := engine.verifyEvidence(chain.Config().ChainID, block, extra.Evidence); err != nil {
+		t.Fatalf("evidence rejected: %v", err)
+	}
+	engine.Finalize(chain, block, statedb, &types.Body{})
+
+	slashed := new(big.Int).Div(new(big.Int).Mul(stake, new(big.Int).SetUint64(config.SlashingRate)), big.NewInt(100))
+	info, err := engine.stakingManager(statedb, block).GetValidator(staker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := new(big.Int).Sub(stake, slashed); info.StakeAmount.Cmp(want) != 0 {
+		t.Errorf("validator stake: got %v, want %v", info.StakeAmount, want)
+	}
+	if got := statedb.GetBalance(testIncentiveContract).ToBig(); got.Cmp(slashed) != 0 {
+		t.Errorf("incentive contract balance: got %v, want %v", got, slashed)
+	}
+}
@@ -18,11 +18,21 @@ var (
 	ErrInvalidSignature        = errors.New("invalid signature")
 	ErrQuoteVerificationFailed = errors.New("SGX quote verification failed")
 	ErrAttestationTooOld       = errors.New("attestation timestamp too old")
+	ErrNotWhitelisted          = errors.New("enclave measurement not whitelisted")
+	ErrWhitelistNotListed      = errors.New("security config storage holds no whitelist list entries")
+	ErrInvalidRanking          = errors.New("invalid producer ranking")
+	ErrInvalidHeartbeats       = errors.New("invalid heartbeat list")
+	ErrInvalidEvidence         = errors.New("invalid double-sign evidence")
+	ErrInvalidKeyChain         = errors.New("invalid signing key chain")
+	ErrInvalidCheckpoint       = errors.New("invalid checkpoint")
+	ErrNotCheckpointProducer   = errors.New("producer not in the latest checkpoint")
+	ErrProducerRegistryFull    = errors.New("producer registry full")
 
 	// 验证错误
 	ErrFutureBlock       = errors.New("block timestamp too far in future")
 	ErrInvalidTimestamp  = errors.New("invalid timestamp")
 	ErrInvalidDifficulty = errors.New("invalid difficulty")
+	ErrInvalidCoinbase   = errors.New("coinbase must be the incentive contract")
 	ErrInvalidMixDigest  = errors.New("invalid mix digest")
 	ErrInvalidNonce      = errors.New("invalid nonce")
 
@@ -30,6 +40,7 @@ var (
 	ErrNoTransactions        = errors.New("no transactions to include")
 	ErrTooManyTransactions   = errors.New("too many transactions")
 	ErrBlockIntervalTooShort = errors.New("block interval too short")
+	ErrAlreadySigned         = errors.New("another block on the same parent already signed")
 
 	// 奖励错误
 	ErrInvalidReward    = errors.New("invalid reward calculation")
@@ -1,127 +1,185 @@
 package sgx
 
 import (
+	"bytes"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 // HeartbeatTracker SGX 心跳追踪器
+//
+// 区块在 SGXExtra.Heartbeats 中携带生产者收到的 Quote 签名心跳。出块稀疏时不能按
+// 时间计算应有的心跳数，因此以心跳轮次计数：每个心跳间隔内第一个携带心跳列表的
+// 区块开启新的一轮，节点每轮最多记一次心跳。
 type HeartbeatTracker struct {
-	mu         sync.RWMutex
-	heartbeats map[common.Address]*HeartbeatRecord
+	store    *NodeStateStore
+	interval uint64 // 心跳间隔（秒）
 }
 
 // HeartbeatRecord 心跳记录
 type HeartbeatRecord struct {
-	Address        common.Address
-	LastHeartbeat  time.Time
-	HeartbeatCount uint64
-	MissedCount    uint64
+	Address        common.Address `json:"address"`
+	FirstRound     uint64         `json:"firstRound"`     // 首次记录心跳的轮次
+	LastRound      uint64         `json:"lastRound"`      // 最近记录心跳的轮次
+	LastHeartbeat  time.Time      `json:"lastHeartbeat"`  // 最近记录心跳的区块时间
+	HeartbeatCount uint64         `json:"heartbeatCount"` // 已记录的心跳轮次数
+	MissedCount    uint64         `json:"missedCount"`    // 缺失的心跳轮次数
 }
 
 // NewHeartbeatTracker 创建心跳追踪器
-func NewHeartbeatTracker() *HeartbeatTracker {
+func NewHeartbeatTracker(store *NodeStateStore, interval time.Duration) *HeartbeatTracker {
 	return &HeartbeatTracker{
-		heartbeats: make(map[common.Address]*HeartbeatRecord),
+		store:    store,
+		interval: max(uint64(interval/time.Second), 1),
 	}
 }
 
-// RecordHeartbeat 记录心跳
-func (ht *HeartbeatTracker) RecordHeartbeat(msg *HeartbeatMessage) error {
-	ht.mu.Lock()
-	defer ht.mu.Unlock()
+// currentRound 读取当前心跳轮次及其开始时间
+func (ht *HeartbeatTracker) currentRound(statedb vm.StateDB) (round, start uint64) {
+	ht.store.load(statedb, heartbeatRoundPrefix, common.Address{}, &round, &start)
+	return round, start
+}
 
-	record, exists := ht.heartbeats[msg.NodeID]
-	if !exists {
-		record = &HeartbeatRecord{
-			Address: msg.NodeID,
-		}
-		ht.heartbeats[msg.NodeID] = record
+// AdvanceRound 在携带心跳列表的区块中调用，距本轮开始已满一个心跳间隔时开启新的一轮
+func (ht *HeartbeatTracker) AdvanceRound(statedb vm.StateDB, now uint64) uint64 {
+	round, start := ht.currentRound(statedb)
+	if round == 0 || now >= start+ht.interval {
+		round, start = round+1, now
+		ht.store.store(statedb, heartbeatRoundPrefix, common.Address{}, round, start)
 	}
+	return round
+}
 
-	record.LastHeartbeat = time.Now()
-	record.HeartbeatCount++
-
-	return nil
+// RecordHeartbeat 在当前轮次记录节点的心跳，返回自上次心跳以来缺失的轮次数
+func (ht *HeartbeatTracker) RecordHeartbeat(statedb vm.StateDB, address common.Address, now uint64) uint64 {
+	round, _ := ht.currentRound(statedb)
+	if round == 0 {
+		return 0
+	}
+	var first, last, lastTime, count, missed uint64
+	ht.store.load(statedb, heartbeatPrefix, address, &first, &last, &lastTime, &count, &missed)
+	if last == round {
+		return 0
+	}
+	var gap uint64
+	if first == 0 {
+		first = round
+	} else {
+		gap = round - last - 1
+	}
+	ht.store.store(statedb, heartbeatPrefix, address, first, round, now, count+1, missed+gap)
+	return gap
 }
 
 // GetHeartbeatRecord 获取心跳记录
-func (ht *HeartbeatTracker) GetHeartbeatRecord(address common.Address) *HeartbeatRecord {
-	ht.mu.RLock()
-	defer ht.mu.RUnlock()
-
-	record, exists := ht.heartbeats[address]
-	if !exists {
+func (ht *HeartbeatTracker) GetHeartbeatRecord(statedb vm.StateDB, address common.Address) *HeartbeatRecord {
+	record := &HeartbeatRecord{Address: address}
+	var lastTime uint64
+	ht.store.load(statedb, heartbeatPrefix, address, &record.FirstRound, &record.LastRound, &lastTime, &record.HeartbeatCount, &record.MissedCount)
+	if record.FirstRound == 0 {
 		return nil
 	}
-
-	// 返回副本
-	recordCopy := *record
-	return &recordCopy
+	record.LastHeartbeat = time.Unix(int64(lastTime), 0)
+	return record
 }
 
-// CalculateHeartbeatScore 计算心跳评分
-func (ht *HeartbeatTracker) CalculateHeartbeatScore(address common.Address, interval time.Duration) uint64 {
-	ht.mu.RLock()
-	defer ht.mu.RUnlock()
-
-	record, exists := ht.heartbeats[address]
-	if !exists {
+// CalculateHeartbeatScore 计算心跳评分：首次心跳以来记录心跳的轮次占比（0-10000）
+func (ht *HeartbeatTracker) CalculateHeartbeatScore(statedb vm.StateDB, address common.Address) uint64 {
+	var first, last, lastTime, count uint64
+	ht.store.load(statedb, heartbeatPrefix, address, &first, &last, &lastTime, &count)
+	if first == 0 {
 		return 0
 	}
+	round, _ := ht.currentRound(statedb)
+	expected := round - first + 1
+	return min(count*bpsDenominator/expected, bpsDenominator)
+}
 
-	// 计算预期心跳次数
-	elapsed := time.Since(record.LastHeartbeat)
-	expectedHeartbeats := uint64(elapsed / interval)
-	if expectedHeartbeats == 0 {
-		expectedHeartbeats = 1
-	}
+// heartbeatPool 本地收到的已验证心跳，等待生产者写入区块
+type heartbeatPool struct {
+	mu      sync.RWMutex
+	entries map[common.Address]*pooledHeartbeat
+}
 
-	// 计算实际心跳率
-	actualRate := float64(record.HeartbeatCount) / float64(expectedHeartbeats)
-	if actualRate > 1.0 {
-		actualRate = 1.0
-	}
+// pooledHeartbeat 每个节点最新的一条心跳
+type pooledHeartbeat struct {
+	msg       *HeartbeatMessage
+	seen      time.Time // 收到心跳的本地时间
+	committed time.Time // 最近一次选入区块的时间，用于在多个区块间轮换
+}
 
-	// 转换为评分（0-10000）
-	score := uint64(actualRate * 10000)
-	return score
+// newHeartbeatPool 创建心跳池
+func newHeartbeatPool() *heartbeatPool {
+	return &heartbeatPool{
+		entries: make(map[common.Address]*pooledHeartbeat),
+	}
 }
 
-// CheckMissedHeartbeats 检查缺失的心跳
-func (ht *HeartbeatTracker) CheckMissedHeartbeats(interval time.Duration) {
-	ht.mu.Lock()
-	defer ht.mu.Unlock()
+// add 记录收到的心跳（只保留每个节点时间戳最新的一条），并清理超出观测窗口的记录
+func (p *heartbeatPool) add(msg *HeartbeatMessage, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	now := time.Now()
-	for _, record := range ht.heartbeats {
-		elapsed := now.Sub(record.LastHeartbeat)
-		if elapsed > interval*2 {
-			record.MissedCount++
+	entry := p.entries[msg.NodeID]
+	if entry == nil {
+		p.entries[msg.NodeID] = &pooledHeartbeat{msg: msg, seen: at}
+	} else if msg.Timestamp >= entry.msg.Timestamp {
+		entry.msg, entry.seen = msg, at
+	}
+	for node, entry := range p.entries {
+		if at.Sub(entry.seen) > observationWindow {
+			delete(p.entries, node)
 		}
 	}
 }
 
-// GetAllRecords 获取所有记录
-func (ht *HeartbeatTracker) GetAllRecords() map[common.Address]*HeartbeatRecord {
-	ht.mu.RLock()
-	defer ht.mu.RUnlock()
+// pending 选出时间戳不早于 since 的心跳写入区块，最近未被选入的优先，
+// 最多 limit 条，按 NodeID 升序返回
+func (p *heartbeatPool) pending(since, now uint64, limit int) []*HeartbeatMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	records := make(map[common.Address]*HeartbeatRecord)
-	for addr, record := range ht.heartbeats {
-		recordCopy := *record
-		records[addr] = &recordCopy
+	entries := make([]*pooledHeartbeat, 0, len(p.entries))
+	for _, entry := range p.entries {
+		if entry.msg.Timestamp >= since && entry.msg.Timestamp <= now {
+			entries = append(entries, entry)
+		}
 	}
-
-	return records
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].committed.Equal(entries[j].committed) {
+			return entries[i].committed.Before(entries[j].committed)
+		}
+		return bytes.Compare(entries[i].msg.NodeID[:], entries[j].msg.NodeID[:]) < 0
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	msgs := make([]*HeartbeatMessage, len(entries))
+	committed := time.Now()
+	for i, entry := range entries {
+		entry.committed = committed
+		msgs[i] = entry.msg
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return bytes.Compare(msgs[i].NodeID[:], msgs[j].NodeID[:]) < 0
+	})
+	return msgs
 }
 
-// ResetRecord 重置记录
-func (ht *HeartbeatTracker) ResetRecord(address common.Address) {
-	ht.mu.Lock()
-	defer ht.mu.Unlock()
+// count 返回 since 之后有心跳的节点数量
+func (p *heartbeatPool) count(since time.Time) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	delete(ht.heartbeats, address)
+	count := 0
+	for _, entry := range p.entries {
+		if !entry.seen.Before(since) {
+			count++
+		}
+	}
+	return count
 }
@@ -0,0 +1,205 @@
+package sgx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// MaxHeartbeatObserved 单条心跳中可携带的观测节点上限
+	MaxHeartbeatObserved = 256
+
+	// MaxHeartbeatsPerBlock 单个区块可携带的心跳上限，每条心跳都带有完整的 SGX Quote
+	MaxHeartbeatsPerBlock = 16
+
+	// heartbeatClockSkew 心跳时间戳可以超前区块时间的秒数，与区块时间的允许误差一致
+	heartbeatClockSkew = 15
+
+	// inmemoryHeartbeatQuotes 缓存的区块心跳 Quote 验证结果数
+	inmemoryHeartbeatQuotes = 1024
+)
+
+var (
+	errHeartbeatNoAttestor   = errors.New("no attestor configured")
+	errHeartbeatTooManyNodes = errors.New("too many observed nodes in heartbeat")
+	errHeartbeatNodeMismatch = errors.New("heartbeat node ID does not match quote")
+)
+
+// Hash 返回心跳绑定到 SGX Quote userData 中的哈希，覆盖除 Quote 和签名外的所有字段
+func (m *HeartbeatMessage) Hash() common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{m.NodeID, m.Timestamp, m.Observed})
+	return crypto.Keccak256Hash(enc)
+}
+
+// nodeAddress 从 ProducerID 派生节点地址，与 Author 的派生方式一致
+func nodeAddress(producerID []byte) common.Address {
+	return common.BytesToAddress(crypto.Keccak256(producerID)[:20])
+}
+
+// NodeAddress 返回本地节点地址
+func (e *SGXEngine) NodeAddress() (common.Address, error) {
+	if e.attestor == nil {
+		return common.Address{}, errHeartbeatNoAttestor
+	}
+	producerID, err := e.attestor.GetProducerID()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return nodeAddress(producerID), nil
+}
+
+// NewHeartbeat 生成本地节点的心跳，observed 为近期观测到在线的节点
+func (e *SGXEngine) NewHeartbeat(observed []common.Address) (*HeartbeatMessage, error) {
+	if len(observed) > MaxHeartbeatObserved {
+		observed = observed[:MaxHeartbeatObserved]
+	}
+	if e.attestor == nil {
+		return nil, errHeartbeatNoAttestor
+	}
+	producerID, err := e.attestor.GetProducerID()
+	if err != nil {
+		return nil, err
+	}
+	msg := &HeartbeatMessage{
+		NodeID:     nodeAddress(producerID),
+		Timestamp:  uint64(time.Now().Unix()),
+		Observed:   observed,
+		ProducerID: common.CopyBytes(producerID),
+	}
+	quote, err := e.attestor.GenerateQuote(msg.Hash().Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate heartbeat quote: %w", err)
+	}
+	msg.SGXQuote = quote
+	// 本地节点的心跳和收到的心跳一样等待写入区块
+	e.uptimeCalculator.RecordHeartbeat(msg)
+	return msg, nil
+}
+
+// VerifyHeartbeat 验证心跳：Quote 有效、userData 绑定心跳内容、
+// 且 Quote 的平台实例 ID 派生出的地址等于 NodeID
+func (e *SGXEngine) VerifyHeartbeat(msg *HeartbeatMessage) error {
+	return e.verifyHeartbeat(msg, false)
+}
+
+// verifyHeartbeat 验证心跳。inBlock 为 true 时验证区块携带的心跳：Quote 按心跳时间验证，
+// 跳过验证器的当前白名单
+func (e *SGXEngine) verifyHeartbeat(msg *HeartbeatMessage, inBlock bool) error {
+	if len(msg.Observed) > MaxHeartbeatObserved {
+		return errHeartbeatTooManyNodes
+	}
+	instanceID, err := e.heartbeatInstanceID(msg, inBlock)
+	if err != nil {
+		return err
+	}
+	if err := e.checkQuoteUserData(msg.SGXQuote, msg.Hash()); err != nil {
+		return err
+	}
+	if !bytes.Equal(nodeAddress(instanceID).Bytes(), msg.NodeID.Bytes()) {
+		return errHeartbeatNodeMismatch
+	}
+	if len(msg.ProducerID) > 0 && !bytes.Equal(instanceID, msg.ProducerID) {
+		return errHeartbeatNodeMismatch
+	}
+	return nil
+}
+
+// heartbeatInstanceID 完整验证心跳的 Quote，返回其平台实例 ID。
+// 同一条心跳可能被多个区块和分叉携带，区块心跳的验证结果按 Quote 哈希缓存；
+// userData 绑定心跳时间戳，缓存的结果只对验证时的心跳时间有效
+func (e *SGXEngine) heartbeatInstanceID(msg *HeartbeatMessage, inBlock bool) ([]byte, error) {
+	var (
+		options   map[string]interface{}
+		quoteHash common.Hash
+	)
+	if inBlock {
+		quoteHash = crypto.Keccak256Hash(msg.SGXQuote)
+		if instanceID, ok := e.heartbeatQuotes.Get(quoteHash); ok {
+			return instanceID, nil
+		}
+		options = map[string]interface{}{
+			"skipWhitelist": true,
+			"verifyTime":    time.Unix(int64(msg.Timestamp), 0),
+		}
+	}
+	result, err := e.verifier.VerifyQuoteComplete(msg.SGXQuote, options)
+	if err != nil {
+		return nil, fmt.Errorf("quote verification failed: %w", err)
+	}
+	if !result.Verified {
+		return nil, ErrQuoteVerificationFailed
+	}
+	instanceID := common.CopyBytes(result.Measurements.PlatformInstanceID[:])
+	if inBlock {
+		e.heartbeatQuotes.Add(quoteHash, instanceID)
+	}
+	return instanceID, nil
+}
+
+// RecordHeartbeat 将已验证的心跳计入在线率：发送者记一次心跳并被本地节点观测，
+// 心跳中列出的节点记为被发送者观测
+func (e *SGXEngine) RecordHeartbeat(msg *HeartbeatMessage) error {
+	if err := e.uptimeCalculator.RecordHeartbeat(msg); err != nil {
+		return err
+	}
+	if self, err := e.NodeAddress(); err == nil && self != msg.NodeID {
+		e.uptimeCalculator.RecordObservation(msg.NodeID, self)
+	}
+	for _, observed := range msg.Observed {
+		if observed != msg.NodeID {
+			e.uptimeCalculator.RecordObservation(observed, msg.NodeID)
+		}
+	}
+	return nil
+}
+
+// HeartbeatInterval 返回心跳间隔
+func (e *SGXEngine) HeartbeatInterval() time.Duration {
+	return e.config.UptimeConfig.HeartbeatInterval
+}
+
+// pendingHeartbeats 返回写入区块时间为 now 的新区块的心跳，按 NodeID 升序
+func (e *SGXEngine) pendingHeartbeats(now uint64) []*HeartbeatMessage {
+	return e.uptimeCalculator.PendingHeartbeats(now)
+}
+
+// verifyHeartbeats 检查区块携带的心跳：数量有上限、NodeID 严格升序、
+// 时间戳在区块时间前 heartbeatMaxAge 之内且不晚于允许的未来时间，
+// 携带平台实例 ID，每条心跳的 Quote 按心跳时间验证并绑定心跳内容。
+// allowed 不为 nil 时 Quote 的 MRENCLAVE/MRSIGNER 还必须在白名单中
+func (e *SGXEngine) verifyHeartbeats(header *types.Header, heartbeats []*HeartbeatMessage, allowed func(quote []byte) error) error {
+	if len(heartbeats) > MaxHeartbeatsPerBlock {
+		return fmt.Errorf("%w: %d entries, max %d", ErrInvalidHeartbeats, len(heartbeats), MaxHeartbeatsPerBlock)
+	}
+	maxAge := e.uptimeCalculator.heartbeatMaxAge()
+	for i, msg := range heartbeats {
+		if msg == nil {
+			return fmt.Errorf("%w: missing entry", ErrInvalidHeartbeats)
+		}
+		if i > 0 && bytes.Compare(heartbeats[i-1].NodeID[:], msg.NodeID[:]) >= 0 {
+			return fmt.Errorf("%w: entries not sorted", ErrInvalidHeartbeats)
+		}
+		if len(msg.ProducerID) != common.HashLength {
+			return fmt.Errorf("%w: heartbeat of %s without producer ID", ErrInvalidHeartbeats, msg.NodeID)
+		}
+		if msg.Timestamp+maxAge < header.Time || msg.Timestamp > header.Time+heartbeatClockSkew {
+			return fmt.Errorf("%w: heartbeat of %s at %d outside window of block time %d", ErrInvalidHeartbeats, msg.NodeID, msg.Timestamp, header.Time)
+		}
+		if err := e.verifyHeartbeat(msg, true); err != nil {
+			return fmt.Errorf("%w: heartbeat of %s: %v", ErrInvalidHeartbeats, msg.NodeID, err)
+		}
+		if allowed != nil {
+			if err := allowed(msg.SGXQuote); err != nil {
+				return fmt.Errorf("%w: heartbeat of %s: %v", ErrInvalidHeartbeats, msg.NodeID, err)
+			}
+		}
+	}
+	return nil
+}
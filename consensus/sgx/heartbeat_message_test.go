@@ -0,0 +1,101 @@
+package sgx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
+)
+
+// heartbeatTestAttestor produces quotes of the form producerID || userData.
+type heartbeatTestAttestor struct {
+	producerID []byte
+}
+
+func (a *heartbeatTestAttestor) GenerateQuote(data []byte) ([]byte, error) {
+	return append(common.CopyBytes(a.producerID), data...), nil
+}
+
+func (a *heartbeatTestAttestor) GetProducerID() ([]byte, error) {
+	return a.producerID, nil
+}
+
+// heartbeatTestVerifier accepts the quotes of heartbeatTestAttestor.
+type heartbeatTestVerifier struct{}
+
+func (heartbeatTestVerifier) VerifyQuote(quote []byte) error { return nil }
+
+func (heartbeatTestVerifier) VerifyQuoteComplete(input []byte, options map[string]interface{}) (*internalsgx.QuoteVerificationResult, error) {
+	if len(input) < 32 {
+		return nil, errors.New("quote too short")
+	}
+	result := &internalsgx.QuoteVerificationResult{Verified: true}
+	result.Measurements.PlatformInstanceID = input[:32]
+	return result, nil
+}
+
+func (heartbeatTestVerifier) VerifySignature(data, signature, publicKey []byte) error {
+	return errors.New("not supported")
+}
+
+func (heartbeatTestVerifier) ExtractProducerID(quote []byte) ([]byte, error) { return quote[:32], nil }
+
+func (heartbeatTestVerifier) ExtractQuoteUserData(quote []byte) ([]byte, error) {
+	return quote[32:], nil
+}
+
+func (heartbeatTestVerifier) ExtractPublicKeyFromQuote(quote []byte) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func (heartbeatTestVerifier) ExtractInstanceID(quote []byte) ([]byte, error) { return quote[:32], nil }
+
+func newHeartbeatTestEngine(id byte) *SGXEngine {
+	producerID := make([]byte, 32)
+	producerID[0] = id
+	return New(DefaultConfig(), &heartbeatTestAttestor{producerID: producerID}, heartbeatTestVerifier{})
+}
+
+func TestHeartbeatRoundTrip(t *testing.T) {
+	var (
+		sender   = newHeartbeatTestEngine(1)
+		receiver = newHeartbeatTestEngine(2)
+		observed = common.Address{0xcc}
+	)
+	msg, err := sender.NewHeartbeat([]common.Address{observed})
+	if err != nil {
+		t.Fatalf("failed to create heartbeat: %v", err)
+	}
+	if self, _ := sender.NodeAddress(); msg.NodeID != self {
+		t.Fatalf("heartbeat node ID %x, want %x", msg.NodeID, self)
+	}
+	if err := receiver.VerifyHeartbeat(msg); err != nil {
+		t.Fatalf("valid heartbeat rejected: %v", err)
+	}
+
+	// A heartbeat claiming another node ID is rejected.
+	forged := *msg
+	forged.NodeID = common.Address{0xdd}
+	if err := receiver.VerifyHeartbeat(&forged); err == nil {
+		t.Fatal("forged heartbeat accepted")
+	}
+
+	if err := receiver.RecordHeartbeat(msg); err != nil {
+		t.Fatalf("failed to record heartbeat: %v", err)
+	}
+	uptime := receiver.uptimeCalculator
+	if n := uptime.ActiveObservers(); n != 1 {
+		t.Fatalf("active observers %d, want 1", n)
+	}
+	if pending := uptime.PendingHeartbeats(msg.Timestamp); len(pending) != 1 || pending[0] != msg {
+		t.Fatalf("heartbeat not pending for inclusion: %v", pending)
+	}
+	// The receiver observed the sender, and the sender observed the listed node.
+	if score := uptime.uptimeObserver.CalculateConsensusScore(msg.NodeID, 1); score != 10000 {
+		t.Errorf("sender consensus score %d, want 10000", score)
+	}
+	if score := uptime.uptimeObserver.CalculateConsensusScore(observed, 1); score != 10000 {
+		t.Errorf("observed node consensus score %d, want 10000", score)
+	}
+}
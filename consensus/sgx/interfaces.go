@@ -6,6 +6,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
 	"github.com/ethereum/go-ethereum/params"
 )
@@ -124,50 +125,47 @@ type RewardDistributor interface {
 	CalculateComprehensiveReward(address common.Address) (*ComprehensiveReward, error)
 }
 
-// ReputationManager 信誉管理接口
+// ReputationManager 信誉管理接口，记录存储在链上状态中
 type ReputationManager interface {
 	// GetReputation 获取节点信誉
-	GetReputation(address common.Address) (*NodeReputation, error)
+	GetReputation(statedb vm.StateDB, address common.Address) (*NodeReputation, error)
 
 	// UpdateReputation 更新节点信誉
-	UpdateReputation(address common.Address) error
+	UpdateReputation(statedb vm.StateDB, address common.Address, now uint64) error
 
 	// IsExcluded 检查节点是否被排除
-	IsExcluded(address common.Address) bool
+	IsExcluded(statedb vm.StateDB, address common.Address, now uint64) bool
 
 	// GetNodePriority 获取节点优先级
-	GetNodePriority(address common.Address) (uint64, error)
+	GetNodePriority(statedb vm.StateDB, address common.Address) (uint64, error)
 }
 
 // UptimeTracker 在线率追踪接口
 type UptimeTracker interface {
-	// RecordHeartbeat 记录心跳
+	// RecordHeartbeat 记录收到的已验证心跳，等待写入区块
 	RecordHeartbeat(msg *HeartbeatMessage) error
 
 	// RecordTxParticipation 记录交易参与
-	RecordTxParticipation(address common.Address, txCount, gasUsed uint64) error
+	RecordTxParticipation(statedb vm.StateDB, address common.Address, txCount, gasUsed, now uint64)
 
-	// RecordResponseTime 记录响应时间
-	RecordResponseTime(address common.Address, responseMs uint64) error
+	// RecordResponse 记录节点在一个高度的排名
+	RecordResponse(statedb vm.StateDB, address common.Address, rank int, points uint64)
 
-	// CalculateUptimeScore 计算在线率评分
-	// networkObservers: 网络中的总观测者数量
-	// networkTotalTxs: 网络总交易数
-	// networkTotalGas: 网络总 Gas 使用量
-	CalculateUptimeScore(address common.Address, networkObservers int, networkTotalTxs, networkTotalGas uint64) (*UptimeData, error)
+	// CalculateUptimeScore 根据链上状态计算在线率评分
+	CalculateUptimeScore(statedb vm.StateDB, address common.Address) *UptimeData
 }
 
-// PenaltyManager 惩罚管理接口
+// PenaltyManager 惩罚管理接口，记录存储在链上状态中，时间均为区块时间
 type PenaltyManager interface {
 	// RecordPenalty 记录惩罚
-	RecordPenalty(address common.Address, penaltyType string, amount *big.Int, reason string) error
+	RecordPenalty(statedb vm.StateDB, address common.Address, penaltyType string, now uint64) error
 
 	// GetPenaltyCount 获取惩罚次数
-	GetPenaltyCount(address common.Address) (uint64, error)
+	GetPenaltyCount(statedb vm.StateDB, address common.Address) (uint64, error)
 
 	// IsExcluded 检查是否被排除
-	IsExcluded(address common.Address) bool
+	IsExcluded(statedb vm.StateDB, address common.Address, now uint64) bool
 
 	// GetExclusionEndTime 获取排除结束时间
-	GetExclusionEndTime(address common.Address) (time.Time, error)
+	GetExclusionEndTime(statedb vm.StateDB, address common.Address) (time.Time, error)
 }
@@ -13,6 +13,7 @@ import (
 type MultiProducerRewardCalculator struct {
 	config        *Config
 	qualityScorer *BlockQualityScorer
+	candidates    *CandidatePool // 网络收集的候选区块，未设置时只返回第一个候选
 }
 
 // NewMultiProducerRewardCalculator 创建多生产者收益计算器
@@ -197,27 +198,21 @@ func (c *MultiProducerRewardCalculator) CollectCandidates(
 	firstProducer common.Address,
 	firstReceivedAt time.Time,
 ) []*BlockCandidate {
-	candidates := make([]*BlockCandidate, 0)
-
-	// 添加第一个候选
-	candidates = append(candidates, &BlockCandidate{
-		Block:      firstBlock,
-		Producer:   firstProducer,
-		ReceivedAt: firstReceivedAt,
-		Rank:       1,
-	})
+	if c.candidates == nil {
+		return []*BlockCandidate{{
+			Block:      firstBlock,
+			Producer:   firstProducer,
+			ReceivedAt: firstReceivedAt,
+			Rank:       1,
+		}}
+	}
 
-	// Candidate window mechanism implementation:
-	// This function initializes the candidate block data structure.
-	// The complete window management is handled by the consensus engine's
-	// block reception loop, which:
-	// 1. Starts candidate window upon receiving the first block
-	// 2. Continues to collect candidate blocks during the window (CandidateWindowMs, default 500ms)
-	// 3. Calls DistributeRewards after the window closes
-	//
-	// Candidate collection is coordinated between the P2P layer and block validation layer.
-
-	return candidates
+	// 候选窗口由候选池维护：
+	// 1. 收到某父区块下的第一个区块时开启窗口
+	// 2. 窗口期间（CandidateWindowMs，默认500ms）继续收录同高度的竞争区块
+	// 3. 窗口外收到的区块不再参与排名
+	c.candidates.Add(firstBlock, firstProducer, firstReceivedAt)
+	return c.candidates.Candidates(firstBlock.ParentHash())
 }
 
 // ValidateRewardDistribution 验证收益分配是否正确
@@ -4,6 +4,7 @@ import (
 	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 // NodeSelector 节点选择器
@@ -18,8 +19,8 @@ func NewNodeSelector(reputationSystem *ReputationSystem) *NodeSelector {
 	}
 }
 
-// SelectNodes 选择节点（按优先级排序）
-func (ns *NodeSelector) SelectNodes(candidates []common.Address, count int) []common.Address {
+// SelectNodes 按 statedb 中记录的信誉选择节点（按优先级排序）
+func (ns *NodeSelector) SelectNodes(statedb vm.StateDB, candidates []common.Address, count int) []common.Address {
 	if count <= 0 || len(candidates) == 0 {
 		return nil
 	}
@@ -32,7 +33,7 @@ func (ns *NodeSelector) SelectNodes(candidates []common.Address, count int) []co
 
 	priorities := make([]nodePriority, 0, len(candidates))
 	for _, addr := range candidates {
-		priority, _ := ns.reputationSystem.GetNodePriority(addr)
+		priority, _ := ns.reputationSystem.GetNodePriority(statedb, addr)
 		priorities = append(priorities, nodePriority{
 			address:  addr,
 			priority: priority,
@@ -0,0 +1,146 @@
+package sgx
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/uint256"
+)
+
+// 节点的在线率、响应、交易参与、惩罚和信誉记录存储在激励合约的 storage 中，
+// 只在 Finalize 中根据链上证据更新，任意历史区块的状态都可以读回。
+// 每条记录的基址为 keccak256(前缀 ++ 地址)，第 i 个字段存放在基址 + i 的存储槽中。
+var (
+	heartbeatPrefix      = []byte("sgx.heartbeat")      // 心跳记录
+	heartbeatRoundPrefix = []byte("sgx.heartbeatRound") // 全局心跳轮次
+	responsePrefix       = []byte("sgx.response")       // 出块响应记录
+	participationPrefix  = []byte("sgx.participation")  // 交易参与记录
+	penaltyPrefix        = []byte("sgx.penalty")        // 惩罚记录
+	reputationPrefix     = []byte("sgx.reputation")     // 信誉记录
+)
+
+// NodeStateStore 节点状态存储管理器
+type NodeStateStore struct {
+	contractAddr common.Address
+}
+
+// NewNodeStateStore 创建节点状态存储管理器
+func NewNodeStateStore(contractAddr common.Address) *NodeStateStore {
+	return &NodeStateStore{
+		contractAddr: contractAddr,
+	}
+}
+
+// fieldKey 计算记录第 i 个字段的存储槽
+func fieldKey(base common.Hash, i int) common.Hash {
+	slot := new(uint256.Int).SetBytes32(base[:])
+	slot.AddUint64(slot, uint64(i))
+	return slot.Bytes32()
+}
+
+// load 读取一条记录的全部字段
+func (s *NodeStateStore) load(statedb vm.StateDB, prefix []byte, addr common.Address, fields ...*uint64) {
+	base := rewardStateKey(prefix, addr.Bytes())
+	for i, field := range fields {
+		value := statedb.GetState(s.contractAddr, fieldKey(base, i))
+		*field = new(uint256.Int).SetBytes32(value[:]).Uint64()
+	}
+}
+
+// store 写入一条记录的全部字段，未变化的字段不产生写操作
+func (s *NodeStateStore) store(statedb vm.StateDB, prefix []byte, addr common.Address, fields ...uint64) {
+	base := rewardStateKey(prefix, addr.Bytes())
+	for i, field := range fields {
+		key := fieldKey(base, i)
+		value := common.Hash(uint256.NewInt(field).Bytes32())
+		if statedb.GetState(s.contractAddr, key) != value {
+			statedb.SetState(s.contractAddr, key, value)
+		}
+	}
+}
+
+// updateNodeState 根据区块中的链上证据更新节点状态，只在 Finalize 中调用：
+// 区块生产者的登记和交易参与、父区块高度的排名和区块携带的心跳
+func (e *SGXEngine) updateNodeState(statedb vm.StateDB, header *types.Header, extra *SGXExtra, ranking []common.Address, txs []*types.Transaction) {
+	var (
+		now     = header.Time
+		touched []common.Address
+		seen    = make(map[common.Address]struct{})
+	)
+	touch := func(addr common.Address) {
+		if _, ok := seen[addr]; !ok {
+			seen[addr] = struct{}{}
+			touched = append(touched, addr)
+		}
+	}
+	// 1. 区块生产者的登记和交易参与
+	if producer, err := e.Author(header); err == nil {
+		if err := e.registerProducer(statedb, extra.ProducerID, now); err != nil {
+			log.Warn("Failed to register block producer", "producer", producer, "err", err)
+		}
+		e.uptimeCalculator.RecordTxParticipation(statedb, producer, uint64(len(txs)), header.GasUsed, now)
+		touch(producer)
+	}
+	// 2. 父区块高度的排名，名次得分与速度奖励比例一致
+	for i, addr := range ranking {
+		var points uint64
+		if i < len(e.rewardParams.speedRatios) {
+			points = e.rewardParams.speedRatios[i]
+		}
+		e.uptimeCalculator.RecordResponse(statedb, addr, i, points)
+		touch(addr)
+	}
+	// 3. 心跳。区块携带哪些心跳由生产者决定，生产者可以不写入竞争者的心跳，
+	// 因此心跳缺失只影响在线率评分，不记离线惩罚，不会使节点被排除
+	if len(extra.Heartbeats) > 0 {
+		tracker := e.uptimeCalculator.heartbeatTracker
+		tracker.AdvanceRound(statedb, now)
+
+		for _, msg := range extra.Heartbeats {
+			// 心跳的发送者登记为生产者，从下一个检查点起可以出块
+			if err := e.registerProducer(statedb, msg.ProducerID, now); err != nil {
+				log.Warn("Failed to register heartbeat sender", "node", msg.NodeID, "err", err)
+			}
+			tracker.RecordHeartbeat(statedb, msg.NodeID, now)
+			touch(msg.NodeID)
+		}
+	}
+	// 4. 重新计算受影响节点的信誉
+	for _, addr := range touched {
+		if err := e.reputationSystem.UpdateReputation(statedb, addr, now); err != nil {
+			log.Error("Failed to update node reputation", "address", addr, "err", err)
+		}
+	}
+}
+
+// verifyExclusion 检查区块生产者在父区块状态中未被排除
+func (e *SGXEngine) verifyExclusion(chain consensus.ChainHeaderReader, header *types.Header) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	reader, ok := chain.(stateReader)
+	if !ok {
+		return nil
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := reader.StateAt(parent.Root)
+	if err != nil {
+		return consensus.ErrPrunedAncestor
+	}
+	producer, err := e.Author(header)
+	if err != nil {
+		return err
+	}
+	if e.penaltyManager.IsExcluded(statedb, producer, header.Time) {
+		return fmt.Errorf("%w: %s", ErrNodeExcluded, producer)
+	}
+	return nil
+}
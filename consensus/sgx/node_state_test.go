@@ -0,0 +1,274 @@
+package sgx
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
+)
+
+func newNodeTestState(t *testing.T) *state.StateDB {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return statedb
+}
+
+// nodeTestHeader returns a header sealed by producer on top of parent,
+// carrying the given heartbeat list.
+func nodeTestHeader(t *testing.T, parent *types.Header, producer byte, time uint64, heartbeats []common.Address) *types.Header {
+	msgs := make([]*HeartbeatMessage, len(heartbeats))
+	for i, node := range heartbeats {
+		msgs[i] = &HeartbeatMessage{NodeID: node, Timestamp: time}
+	}
+	extra, err := (&SGXExtra{ProducerID: []byte{producer}, SGXQuote: make([]byte, 32), Heartbeats: msgs}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Time:       time,
+		Coinbase:   testIncentiveContract,
+		Extra:      extra,
+	}
+}
+
+// Tests that node records written in Finalize survive a restart: a fresh
+// engine reading the committed state agrees on scores and exclusions.
+func TestNodeStatePersistence(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+
+	var (
+		db       = state.NewDatabaseForTesting()
+		online   = common.Address{0x01}
+		flaky    = common.Address{0x02}
+		interval = uint64(DefaultConfig().UptimeConfig.HeartbeatInterval / time.Second)
+		genesis  = &types.Header{Number: big.NewInt(0)}
+		chain    = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		parent   = genesis
+	)
+	statedb, err := state.New(types.EmptyRootHash, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The flaky node is seen in the first and last of 12 rounds, missing 10
+	for i := uint64(0); i < 12; i++ {
+		heartbeats := []common.Address{online}
+		if i == 0 || i == 11 {
+			heartbeats = []common.Address{online, flaky}
+		}
+		header := nodeTestHeader(t, parent, 1, 1000+i*interval, heartbeats)
+		engine.Finalize(chain, header, statedb, &types.Body{})
+		chain.headers[header.Hash()] = header
+		parent = header
+	}
+	root, err := statedb.Commit(parent.Number.Uint64(), true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := New(DefaultConfig(), nil, nil)
+	restarted.setIncentiveContract(testIncentiveContract)
+	reopened, err := state.New(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := restarted.uptimeCalculator.heartbeatTracker.GetHeartbeatRecord(reopened, flaky)
+	if record == nil || record.HeartbeatCount != 2 || record.MissedCount != 10 {
+		t.Fatalf("unexpected heartbeat record after restart: %+v", record)
+	}
+	if score := restarted.uptimeCalculator.heartbeatTracker.CalculateHeartbeatScore(reopened, online); score != bpsDenominator {
+		t.Errorf("online node heartbeat score %d, want %d", score, bpsDenominator)
+	}
+	if score := restarted.uptimeCalculator.heartbeatTracker.CalculateHeartbeatScore(reopened, flaky); score >= bpsDenominator {
+		t.Errorf("flaky node heartbeat score %d, want below %d", score, bpsDenominator)
+	}
+	// Heartbeats missing from blocks may be censored by the producers and
+	// are not penalised
+	if count, _ := restarted.penaltyManager.GetPenaltyCount(reopened, flaky); count != 0 {
+		t.Errorf("flaky node penalty count %d, want 0", count)
+	}
+	if count, _ := restarted.penaltyManager.GetPenaltyCount(reopened, online); count != 0 {
+		t.Errorf("online node penalty count %d, want 0", count)
+	}
+	// The producer's participation and reputation were recorded as well
+	producer := nodeAddress([]byte{1})
+	if p := restarted.uptimeCalculator.txParticipationTracker.GetParticipation(reopened, producer); p == nil || p.TotalBlocks != 12 {
+		t.Errorf("unexpected producer participation: %+v", p)
+	}
+	online1, _ := engine.reputationSystem.GetReputation(statedb, online)
+	online2, _ := restarted.reputationSystem.GetReputation(reopened, online)
+	if online1 == nil || online2 == nil || online1.ReputationScore != online2.ReputationScore {
+		t.Errorf("reputation differs after restart: %+v, %+v", online1, online2)
+	}
+}
+
+// Tests that a producer excluded in the parent state cannot extend the chain.
+func TestVerifyExclusion(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+
+	statedb := newNodeTestState(t)
+	producer := nodeAddress([]byte{1})
+	for i := 0; i < exclusionPenalties; i++ {
+		engine.penaltyManager.RecordPenalty(statedb, producer, "test", 1000)
+	}
+	parent := &types.Header{Number: big.NewInt(1), Root: common.Hash{0x01}, Time: 1000}
+	chain := &whitelistTestChain{
+		headers: map[common.Hash]*types.Header{parent.Hash(): parent},
+		states:  map[common.Hash]*state.StateDB{parent.Root: statedb},
+	}
+	if err := engine.verifyExclusion(chain, nodeTestHeader(t, parent, 1, 1001, nil)); !errors.Is(err, ErrNodeExcluded) {
+		t.Errorf("excluded producer accepted: %v", err)
+	}
+	if err := engine.verifyExclusion(chain, nodeTestHeader(t, parent, 2, 1001, nil)); err != nil {
+		t.Errorf("producer rejected: %v", err)
+	}
+	end := 1000 + uint64(DefaultConfig().PenaltyConfig.ExclusionPeriod/time.Second)
+	if err := engine.verifyExclusion(chain, nodeTestHeader(t, parent, 1, end, nil)); err != nil {
+		t.Errorf("producer rejected after the exclusion period: %v", err)
+	}
+}
+
+func TestVerifyHeartbeats(t *testing.T) {
+	var (
+		verifier = newHeartbeatTestEngine(9)
+		senders  = []*SGXEngine{newHeartbeatTestEngine(1), newHeartbeatTestEngine(2)}
+		msgs     = make([]*HeartbeatMessage, len(senders))
+	)
+	for i, sender := range senders {
+		msg, err := sender.NewHeartbeat(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[i] = msg
+	}
+	if bytes.Compare(msgs[0].NodeID[:], msgs[1].NodeID[:]) > 0 {
+		msgs[0], msgs[1] = msgs[1], msgs[0]
+	}
+	var (
+		a, b    = msgs[0], msgs[1]
+		maxAge  = verifier.uptimeCalculator.heartbeatMaxAge()
+		header  = &types.Header{Number: big.NewInt(1), Time: a.Timestamp}
+		late    = &types.Header{Number: big.NewInt(1), Time: a.Timestamp + maxAge + 1}
+		early   = &types.Header{Number: big.NewInt(1), Time: a.Timestamp - heartbeatClockSkew - 1}
+		forged  = *a
+		tooMany = make([]*HeartbeatMessage, MaxHeartbeatsPerBlock+1)
+	)
+	// Claiming another node invalidates the quote binding.
+	forged.NodeID = common.Address{0xdd}
+	for i := range tooMany {
+		tooMany[i] = a
+	}
+	tests := []struct {
+		header     *types.Header
+		heartbeats []*HeartbeatMessage
+		valid      bool
+	}{
+		{header, nil, true},
+		{header, []*HeartbeatMessage{a, b}, true},
+		{header, []*HeartbeatMessage{b, a}, false},
+		{header, []*HeartbeatMessage{a, a}, false},
+		{header, []*HeartbeatMessage{&forged}, false},
+		{header, []*HeartbeatMessage{nil}, false},
+		{header, tooMany, false},
+		{late, []*HeartbeatMessage{a}, false},
+		{early, []*HeartbeatMessage{a}, false},
+	}
+	for i, tt := range tests {
+		err := verifier.verifyHeartbeats(tt.header, tt.heartbeats, nil)
+		if tt.valid && err != nil {
+			t.Errorf("test %d: valid list rejected: %v", i, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidHeartbeats) {
+			t.Errorf("test %d: expected ErrInvalidHeartbeats, got %v", i, err)
+		}
+	}
+	// Heartbeats from enclaves outside the whitelist do not count.
+	reject := func([]byte) error { return ErrNotWhitelisted }
+	if err := verifier.verifyHeartbeats(header, []*HeartbeatMessage{a}, reject); !errors.Is(err, ErrInvalidHeartbeats) {
+		t.Errorf("expected ErrInvalidHeartbeats for non-whitelisted heartbeat, got %v", err)
+	}
+}
+
+func TestPendingHeartbeatsRotate(t *testing.T) {
+	pool := newHeartbeatPool()
+	for i := 0; i < MaxHeartbeatsPerBlock+4; i++ {
+		pool.add(&HeartbeatMessage{NodeID: common.Address{byte(i + 1)}, Timestamp: 100}, time.Now())
+	}
+	// A newer heartbeat replaces the pooled one, an older one is ignored.
+	pool.add(&HeartbeatMessage{NodeID: common.Address{1}, Timestamp: 101}, time.Now())
+	pool.add(&HeartbeatMessage{NodeID: common.Address{1}, Timestamp: 99}, time.Now())
+
+	first := pool.pending(90, 110, MaxHeartbeatsPerBlock)
+	if len(first) != MaxHeartbeatsPerBlock || first[0].Timestamp != 101 {
+		t.Fatalf("unexpected first selection: %d entries", len(first))
+	}
+	for i := 1; i < len(first); i++ {
+		if bytes.Compare(first[i-1].NodeID[:], first[i].NodeID[:]) >= 0 {
+			t.Fatal("selection not sorted by node ID")
+		}
+	}
+	// Heartbeats left out of the previous block are selected first.
+	second := pool.pending(90, 110, MaxHeartbeatsPerBlock)
+	selected := make(map[common.Address]bool)
+	for _, msg := range second {
+		selected[msg.NodeID] = true
+	}
+	for i := MaxHeartbeatsPerBlock; i < MaxHeartbeatsPerBlock+4; i++ {
+		if !selected[common.Address{byte(i + 1)}] {
+			t.Errorf("left out heartbeat of %s not selected", common.Address{byte(i + 1)})
+		}
+	}
+	// Heartbeats outside the window are never selected.
+	if stale := pool.pending(102, 110, MaxHeartbeatsPerBlock); len(stale) != 0 {
+		t.Errorf("selected %d stale heartbeats", len(stale))
+	}
+}
+
+// countingVerifier counts the full quote verifications.
+type countingVerifier struct {
+	heartbeatTestVerifier
+	calls int
+}
+
+func (v *countingVerifier) VerifyQuoteComplete(input []byte, options map[string]interface{}) (*internalsgx.QuoteVerificationResult, error) {
+	v.calls++
+	return v.heartbeatTestVerifier.VerifyQuoteComplete(input, options)
+}
+
+// Tests that the quotes of heartbeats carried by blocks are fully verified
+// only once, while the cached result is still checked against the heartbeat.
+func TestVerifyHeartbeatsCache(t *testing.T) {
+	sender := newHeartbeatTestEngine(1)
+	msg, err := sender.NewHeartbeat(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		counter  = new(countingVerifier)
+		verifier = New(DefaultConfig(), nil, counter)
+		header   = &types.Header{Number: big.NewInt(1), Time: msg.Timestamp}
+	)
+	for i := 0; i < 3; i++ {
+		if err := verifier.verifyHeartbeats(header, []*HeartbeatMessage{msg}, nil); err != nil {
+			t.Fatalf("valid heartbeat rejected: %v", err)
+		}
+	}
+	if counter.calls != 1 {
+		t.Fatalf("quote verified %d times, want 1", counter.calls)
+	}
+	forged := *msg
+	forged.NodeID = common.Address{0xdd}
+	if err := verifier.verifyHeartbeats(header, []*HeartbeatMessage{&forged}, nil); !errors.Is(err, ErrInvalidHeartbeats) {
+		t.Fatalf("expected ErrInvalidHeartbeats for forged heartbeat, got %v", err)
+	}
+}
@@ -16,6 +16,11 @@ func NewOnDemandController(config *Config) *OnDemandController {
 	}
 }
 
+// SetConfig 更新配置，区块生产者据此应用链上的治理参数
+func (c *OnDemandController) SetConfig(config *Config) {
+	c.config = config
+}
+
 // ShouldProduceBlock 判断是否应该出块
 func (c *OnDemandController) ShouldProduceBlock(
 	lastBlockTime time.Time,
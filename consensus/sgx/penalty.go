@@ -1,93 +1,86 @@
 package sgx
 
 import (
-	"math/big"
-	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
 )
 
-// PenaltyManagerImpl 惩罚管理实现
+// exclusionPenalties 触发排除的惩罚次数
+const exclusionPenalties = 3
+
+// PenaltyManagerImpl 惩罚管理实现，时间均为区块时间（秒）
 type PenaltyManagerImpl struct {
 	config *PenaltyConfig
-
-	mu         sync.RWMutex
-	penalties  map[common.Address][]*PenaltyRecord
-	exclusions map[common.Address]time.Time
+	store  *NodeStateStore
 }
 
 // NewPenaltyManager 创建惩罚管理器
-func NewPenaltyManager(config *PenaltyConfig) *PenaltyManagerImpl {
+func NewPenaltyManager(config *PenaltyConfig, store *NodeStateStore) *PenaltyManagerImpl {
 	return &PenaltyManagerImpl{
-		config:     config,
-		penalties:  make(map[common.Address][]*PenaltyRecord),
-		exclusions: make(map[common.Address]time.Time),
+		config: config,
+		store:  store,
 	}
 }
 
-// RecordPenalty 记录惩罚
-func (pm *PenaltyManagerImpl) RecordPenalty(address common.Address, penaltyType string, amount *big.Int, reason string) error {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+// RecordPenalty 记录惩罚；超过恢复期未再受罚的节点惩罚次数清零，
+// 累计达到 exclusionPenalties 次后被排除 ExclusionPeriod
+func (pm *PenaltyManagerImpl) RecordPenalty(statedb vm.StateDB, address common.Address, penaltyType string, now uint64) error {
+	return pm.record(statedb, address, penaltyType, now, false)
+}
 
-	record := &PenaltyRecord{
-		Address:       address,
-		PenaltyType:   penaltyType,
-		PenaltyAmount: amount,
-		Timestamp:     time.Now(),
-		Reason:        reason,
-	}
+// RecordDoubleSign 记录双签惩罚，双签节点立即被排除 ExclusionPeriod
+func (pm *PenaltyManagerImpl) RecordDoubleSign(statedb vm.StateDB, address common.Address, now uint64) error {
+	return pm.record(statedb, address, "double_sign", now, true)
+}
 
-	pm.penalties[address] = append(pm.penalties[address], record)
+func (pm *PenaltyManagerImpl) record(statedb vm.StateDB, address common.Address, penaltyType string, now uint64, exclude bool) error {
+	var count, last, excludedUntil uint64
+	pm.store.load(statedb, penaltyPrefix, address, &count, &last, &excludedUntil)
 
-	// 检查是否需要排除
-	if len(pm.penalties[address]) >= 3 {
-		pm.exclusions[address] = time.Now().Add(pm.config.ExclusionPeriod)
+	if count > 0 && now >= last+uint64(pm.config.RecoveryPeriod/time.Second) {
+		count = 0
+	}
+	count++
+	if exclude {
+		count = max(count, exclusionPenalties)
+	}
+	if count >= exclusionPenalties {
+		excludedUntil = max(excludedUntil, now+uint64(pm.config.ExclusionPeriod/time.Second))
 	}
+	pm.store.store(statedb, penaltyPrefix, address, count, now, excludedUntil)
 
+	log.Debug("Recorded producer penalty", "address", address, "type", penaltyType, "count", count, "excludedUntil", excludedUntil)
 	return nil
 }
 
 // GetPenaltyCount 获取惩罚次数
-func (pm *PenaltyManagerImpl) GetPenaltyCount(address common.Address) (uint64, error) {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-
-	return uint64(len(pm.penalties[address])), nil
+func (pm *PenaltyManagerImpl) GetPenaltyCount(statedb vm.StateDB, address common.Address) (uint64, error) {
+	var count uint64
+	pm.store.load(statedb, penaltyPrefix, address, &count)
+	return count, nil
 }
 
-// IsExcluded 检查是否被排除
-func (pm *PenaltyManagerImpl) IsExcluded(address common.Address) bool {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-
-	excludedUntil, exists := pm.exclusions[address]
-	if !exists {
-		return false
-	}
-
-	return time.Now().Before(excludedUntil)
+// IsExcluded 检查在区块时间 now 是否被排除
+func (pm *PenaltyManagerImpl) IsExcluded(statedb vm.StateDB, address common.Address, now uint64) bool {
+	var count, last, excludedUntil uint64
+	pm.store.load(statedb, penaltyPrefix, address, &count, &last, &excludedUntil)
+	return now < excludedUntil
 }
 
 // GetExclusionEndTime 获取排除结束时间
-func (pm *PenaltyManagerImpl) GetExclusionEndTime(address common.Address) (time.Time, error) {
-	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-
-	excludedUntil, exists := pm.exclusions[address]
-	if !exists {
+func (pm *PenaltyManagerImpl) GetExclusionEndTime(statedb vm.StateDB, address common.Address) (time.Time, error) {
+	var count, last, excludedUntil uint64
+	pm.store.load(statedb, penaltyPrefix, address, &count, &last, &excludedUntil)
+	if excludedUntil == 0 {
 		return time.Time{}, nil
 	}
-
-	return excludedUntil, nil
+	return time.Unix(int64(excludedUntil), 0), nil
 }
 
 // ClearPenalties 清除惩罚记录
-func (pm *PenaltyManagerImpl) ClearPenalties(address common.Address) {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
-
-	delete(pm.penalties, address)
-	delete(pm.exclusions, address)
+func (pm *PenaltyManagerImpl) ClearPenalties(statedb vm.StateDB, address common.Address) {
+	pm.store.store(statedb, penaltyPrefix, address, 0, 0, 0)
 }
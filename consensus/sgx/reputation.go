@@ -1,10 +1,10 @@
 package sgx
 
 import (
-	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 // ReputationSystem 信誉系统
@@ -12,107 +12,83 @@ type ReputationSystem struct {
 	config           *ReputationConfig
 	uptimeCalculator *UptimeCalculator
 	penaltyManager   *PenaltyManagerImpl
+	store            *NodeStateStore
 
-	mu          sync.RWMutex
-	reputations map[common.Address]*NodeReputation
+	uptimeWeight  uint64 // 在线率权重（基点）
+	successWeight uint64 // 成功率权重（基点）
+	penaltyWeight uint64 // 惩罚权重（基点）
 }
 
 // NewReputationSystem 创建信誉系统
-func NewReputationSystem(config *ReputationConfig, uptimeCalculator *UptimeCalculator, penaltyManager *PenaltyManagerImpl) *ReputationSystem {
+func NewReputationSystem(config *ReputationConfig, uptimeCalculator *UptimeCalculator, penaltyManager *PenaltyManagerImpl, store *NodeStateStore) *ReputationSystem {
 	return &ReputationSystem{
 		config:           config,
 		uptimeCalculator: uptimeCalculator,
 		penaltyManager:   penaltyManager,
-		reputations:      make(map[common.Address]*NodeReputation),
+		store:            store,
+		uptimeWeight:     toBps(config.UptimeWeight, 100),
+		successWeight:    toBps(config.SuccessRateWeight, 100),
+		penaltyWeight:    toBps(config.PenaltyWeight, 100),
 	}
 }
 
-// GetReputation 获取节点信誉
-func (rs *ReputationSystem) GetReputation(address common.Address) (*NodeReputation, error) {
-	rs.mu.RLock()
-	defer rs.mu.RUnlock()
-
-	reputation, exists := rs.reputations[address]
-	if !exists {
+// GetReputation 获取节点信誉，从未更新过的节点返回 nil
+func (rs *ReputationSystem) GetReputation(statedb vm.StateDB, address common.Address) (*NodeReputation, error) {
+	var uptime, success, score, updated uint64
+	rs.store.load(statedb, reputationPrefix, address, &uptime, &success, &score, &updated)
+	if updated == 0 {
 		return nil, nil
 	}
-
-	reputationCopy := *reputation
-	return &reputationCopy, nil
+	penaltyCount, err := rs.penaltyManager.GetPenaltyCount(statedb, address)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeReputation{
+		Address:         address,
+		UptimeScore:     uptime,
+		SuccessRate:     float64(success) / bpsDenominator,
+		PenaltyCount:    penaltyCount,
+		ReputationScore: score,
+		LastUpdateTime:  time.Unix(int64(updated), 0),
+	}, nil
 }
 
-// UpdateReputation 更新节点信誉
-func (rs *ReputationSystem) UpdateReputation(address common.Address) error {
-	rs.mu.Lock()
-	defer rs.mu.Unlock()
+// UpdateReputation 根据链上状态更新节点信誉，now 为区块时间
+func (rs *ReputationSystem) UpdateReputation(statedb vm.StateDB, address common.Address, now uint64) error {
+	uptime := rs.uptimeCalculator.CalculateUptimeScore(statedb, address).ComprehensiveScore
+	success := rs.uptimeCalculator.responseTracker.CalculateSuccessRate(statedb, address)
 
-	reputation, exists := rs.reputations[address]
-	if !exists {
-		reputation = &NodeReputation{
-			Address: address,
-		}
-		rs.reputations[address] = reputation
+	penaltyCount, err := rs.penaltyManager.GetPenaltyCount(statedb, address)
+	if err != nil {
+		return err
 	}
-
-	// Calculate uptime score using network statistics
-	const (
-		defaultObservers = 10
-		defaultTotalTxs  = uint64(10000)
-		defaultTotalGas  = uint64(300000000)
-	)
-	
-	uptimeData := rs.uptimeCalculator.CalculateUptimeScore(
-		address,
-		defaultObservers,
-		defaultTotalTxs,
-		defaultTotalGas,
-	)
-	reputation.UptimeScore = uptimeData.ComprehensiveScore
-
-	// 获取惩罚次数
-	penaltyCount, _ := rs.penaltyManager.GetPenaltyCount(address)
-	reputation.PenaltyCount = penaltyCount
-
-	// 计算综合信誉评分
-	reputation.ReputationScore = rs.calculateReputationScore(reputation)
-	reputation.LastUpdateTime = time.Now()
-
+	score := rs.calculateReputationScore(uptime, success, penaltyCount)
+	rs.store.store(statedb, reputationPrefix, address, uptime, success, score, now)
 	return nil
 }
 
-// calculateReputationScore 计算信誉评分
-func (rs *ReputationSystem) calculateReputationScore(reputation *NodeReputation) uint64 {
-	// 在线率权重 60%
-	uptimeComponent := float64(reputation.UptimeScore) * rs.config.UptimeWeight / 100.0
-
-	// 成功率权重 30%
-	successComponent := reputation.SuccessRate * 10000 * rs.config.SuccessRateWeight / 100.0
+// calculateReputationScore 计算信誉评分（0-10000），成功率以基点表示
+func (rs *ReputationSystem) calculateReputationScore(uptime, success, penaltyCount uint64) uint64 {
+	// 在线率权重 60%，成功率权重 30%
+	score := (min(uptime, bpsDenominator)*rs.uptimeWeight + min(success, bpsDenominator)*rs.successWeight) / bpsDenominator
 
 	// 惩罚权重 10%（惩罚降低评分）
-	penaltyComponent := float64(reputation.PenaltyCount) * 1000
-	if penaltyComponent > 10000*rs.config.PenaltyWeight/100.0 {
-		penaltyComponent = 10000 * rs.config.PenaltyWeight / 100.0
+	penalty := min(penaltyCount, bpsDenominator) * 1000
+	penalty = min(penalty, rs.penaltyWeight)
+	if penalty >= score {
+		return 0
 	}
-
-	score := uptimeComponent + successComponent - penaltyComponent
-	if score < 0 {
-		score = 0
-	}
-	if score > 10000 {
-		score = 10000
-	}
-
-	return uint64(score)
+	return min(score-penalty, bpsDenominator)
 }
 
-// IsExcluded 检查节点是否被排除
-func (rs *ReputationSystem) IsExcluded(address common.Address) bool {
-	return rs.penaltyManager.IsExcluded(address)
+// IsExcluded 检查节点在区块时间 now 是否被排除
+func (rs *ReputationSystem) IsExcluded(statedb vm.StateDB, address common.Address, now uint64) bool {
+	return rs.penaltyManager.IsExcluded(statedb, address, now)
 }
 
 // GetNodePriority 获取节点优先级
-func (rs *ReputationSystem) GetNodePriority(address common.Address) (uint64, error) {
-	reputation, err := rs.GetReputation(address)
+func (rs *ReputationSystem) GetNodePriority(statedb vm.StateDB, address common.Address) (uint64, error) {
+	reputation, err := rs.GetReputation(statedb, address)
 	if err != nil {
 		return 0, err
 	}
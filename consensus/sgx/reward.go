@@ -0,0 +1,252 @@
+package sgx
+
+import (
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// 共识内的奖励计算只使用整数运算：浮点运算在不同架构上可能被融合为 FMA，
+// 无法保证所有节点得到逐位相同的状态根。比例统一以基点（1/10000）表示。
+const bpsDenominator = 10000
+
+var (
+	bps    = uint256.NewInt(bpsDenominator)
+	bpsSqr = uint256.NewInt(bpsDenominator * bpsDenominator)
+)
+
+// rewardParams 由 Config 一次性换算得到的整数奖励参数
+type rewardParams struct {
+	baseReward     *uint256.Int // 基础出块奖励
+	onlinePerEpoch *uint256.Int // 每个周期的在线奖励
+	epochSeconds   uint64       // 奖励周期（秒）
+
+	speedRatios     []uint64 // 第1名、第2名、第3名的速度奖励比例（基点）
+	qualityBonus    uint64   // 质量奖励比率（基点）
+	serviceBonus    uint64   // 服务奖励比率（基点）
+	historicalBonus uint64   // 历史贡献奖励比率（基点）
+
+	txCountWeight   uint64 // 交易数量权重（基点）
+	sizeWeight      uint64 // 区块大小权重（基点）
+	gasWeight       uint64 // Gas 利用率权重（基点）
+	diversityWeight uint64 // 交易多样性权重（基点）
+	minTxThreshold  uint64 // 最小交易数阈值
+	targetSize      uint64 // 目标区块大小（字节）
+	targetGasUtil   uint64 // 目标 Gas 利用率（基点）
+}
+
+// toBps 将配置中的比例换算为基点，scale 为配置值中 1.0 对应的数值
+func toBps(v float64, scale float64) uint64 {
+	if v <= 0 {
+		return 0
+	}
+	return uint64(math.Round(v * bpsDenominator / scale))
+}
+
+// newRewardParams 将浮点配置换算为共识使用的整数参数
+func newRewardParams(config *Config) *rewardParams {
+	p := &rewardParams{
+		baseReward:     new(uint256.Int),
+		onlinePerEpoch: new(uint256.Int),
+	}
+	for i, r := range config.SpeedRewardRatios {
+		if i >= MaxRankedProducers {
+			break
+		}
+		p.speedRatios = append(p.speedRatios, toBps(r, 1))
+	}
+	if rc := config.RewardConfig; rc != nil {
+		if rc.BaseBlockReward != nil {
+			p.baseReward.SetFromBig(rc.BaseBlockReward)
+		}
+		if rc.OnlineRewardPerEpoch != nil {
+			p.onlinePerEpoch.SetFromBig(rc.OnlineRewardPerEpoch)
+		}
+		p.epochSeconds = uint64(rc.EpochDuration.Seconds())
+		p.qualityBonus = toBps(rc.QualityBonusRate, 1)
+		p.serviceBonus = toBps(rc.ServiceBonusRate, 1)
+		p.historicalBonus = toBps(rc.HistoricalBonusRate, 1)
+	}
+	if qc := config.QualityConfig; qc != nil {
+		p.txCountWeight = toBps(qc.TxCountWeight, 100)
+		p.sizeWeight = toBps(qc.BlockSizeWeight, 100)
+		p.gasWeight = toBps(qc.GasUtilizationWeight, 100)
+		p.diversityWeight = toBps(qc.TxDiversityWeight, 100)
+		p.minTxThreshold = uint64(max(qc.MinTxThreshold, 1))
+		p.targetSize = qc.TargetBlockSize
+		p.targetGasUtil = toBps(qc.TargetGasUtilization, 1)
+	}
+	return p
+}
+
+// producerScores 排名生产者在父区块状态中记录的评分
+type producerScores struct {
+	Uptime     uint64 // 在线率评分（0-10000）
+	Service    uint64 // 服务质量评分（0-10000）
+	Historical uint64 // 历史贡献倍数（基点，10000 = 1.0x，最高 20000）
+}
+
+// rewardInput 一个高度的奖励分配输入，全部来自链上数据
+type rewardInput struct {
+	Ranking []common.Address // 生产者排名，第1名为被链选中的区块生产者
+	Scores  []producerScores // 与 Ranking 一一对应
+	Fees    *uint256.Int     // 该高度区块的交易费（Σ receipt.GasUsed × 有效小费）
+	Quality uint64           // 被选中区块的质量评分（0-10000）
+	Elapsed uint64           // 距上一区块的秒数，用于按时间折算在线奖励
+}
+
+// mulDiv 计算 x*y/d，中间结果为 512 位，不会溢出；结果超出 256 位时饱和
+func mulDiv(x, y, d *uint256.Int) *uint256.Int {
+	if d.IsZero() {
+		return new(uint256.Int)
+	}
+	z, overflow := new(uint256.Int).MulDivOverflow(x, y, d)
+	if overflow {
+		return new(uint256.Int).SetAllOne()
+	}
+	return z
+}
+
+// splitReward 按比例拆分 pool，向下取整，余数归第1名，总和恒等于 pool
+func splitReward(pool *uint256.Int, ratios []uint64) []*uint256.Int {
+	if len(ratios) == 0 {
+		return nil
+	}
+	total := new(uint256.Int)
+	for _, r := range ratios {
+		total.Add(total, uint256.NewInt(r))
+	}
+	shares := make([]*uint256.Int, len(ratios))
+	if total.IsZero() {
+		shares[0] = pool.Clone()
+		for i := 1; i < len(shares); i++ {
+			shares[i] = new(uint256.Int)
+		}
+		return shares
+	}
+	distributed := new(uint256.Int)
+	for i, r := range ratios {
+		shares[i] = mulDiv(pool, uint256.NewInt(r), total)
+		distributed.Add(distributed, shares[i])
+	}
+	shares[0].Add(shares[0], new(uint256.Int).Sub(pool, distributed))
+	return shares
+}
+
+// qualityMultiplier 质量评分对应的收益倍数（基点），与 calculateRewardMultiplier 的分段一致：
+// 0-2000: 0.1-0.5，2000-5000: 0.5-1.0，5000-8000: 1.0-1.5，8000-10000: 1.5-2.0
+func qualityMultiplier(score uint64) uint64 {
+	score = min(score, bpsDenominator)
+	switch {
+	case score < 2000:
+		return 1000 + score*4000/2000
+	case score < 5000:
+		return 5000 + (score-2000)*5000/3000
+	case score < 8000:
+		return 10000 + (score-5000)*5000/3000
+	default:
+		return 15000 + (score-8000)*5000/2000
+	}
+}
+
+// blockQualityScore 计算区块质量综合评分（0-10000），与 BlockQualityScorer 的指标一致，
+// 但只使用整数运算；区块大小只计交易，不依赖 Seal 前后会变化的区块头
+func (p *rewardParams) blockQualityScore(header *types.Header, txs []*types.Transaction) uint64 {
+	txCount := uint64(len(txs))
+	if txCount == 0 {
+		return 0
+	}
+	var (
+		size    uint64
+		senders = make(map[common.Address]struct{})
+	)
+	for _, tx := range txs {
+		size += tx.Size()
+		if from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+			senders[from] = struct{}{}
+		}
+	}
+	// 1. 交易数量得分
+	var txScore uint64
+	if txCount < p.minTxThreshold {
+		txScore = txCount * 2000 / p.minTxThreshold
+	} else {
+		txScore = 8000 + 2000*min(txCount-p.minTxThreshold, 95)/95
+	}
+	// 2. 区块大小得分
+	var sizeScore uint64
+	switch {
+	case p.targetSize == 0:
+	case size <= p.targetSize:
+		sizeScore = mulDiv(uint256.NewInt(size), bps, uint256.NewInt(p.targetSize)).Uint64()
+	default:
+		penalty := mulDiv(uint256.NewInt(size-p.targetSize), uint256.NewInt(1000), uint256.NewInt(p.targetSize))
+		sizeScore = bpsDenominator - min(penalty.Uint64(), 2000)
+		if !penalty.IsUint64() {
+			sizeScore = bpsDenominator - 2000
+		}
+	}
+	// 3. Gas 利用率得分：gasUsed / (gasLimit × 目标利用率)
+	var gasScore uint64
+	if header.GasLimit > 0 && p.targetGasUtil > 0 {
+		capacity := new(uint256.Int).Mul(uint256.NewInt(header.GasLimit), uint256.NewInt(p.targetGasUtil))
+		score := mulDiv(uint256.NewInt(header.GasUsed), bpsSqr, capacity)
+		gasScore = bpsDenominator
+		if score.IsUint64() {
+			gasScore = min(score.Uint64(), bpsDenominator)
+		}
+	}
+	// 4. 交易多样性得分
+	diversityScore := uint64(len(senders)) * bpsDenominator / txCount
+
+	return (txScore*p.txCountWeight + sizeScore*p.sizeWeight +
+		gasScore*p.gasWeight + diversityScore*p.diversityWeight) / bpsDenominator
+}
+
+// computeBlockRewards 计算一个高度应发放给每名排名生产者的奖励，与 in.Ranking 一一对应
+//
+//	奖池 = 基础奖励 × 质量倍数 + 交易费，按速度比例拆分给各名次
+//	质量奖励 = 第1名份额 × 质量评分 × 质量奖励率
+//	服务奖励 = 份额 × 服务评分 × 服务奖励率
+//	历史贡献奖励 = 份额 × (历史倍数 - 1.0) × 历史奖励率
+//	在线奖励 = 每周期在线奖励 × 出块间隔 / 周期 × 在线率评分
+func (p *rewardParams) computeBlockRewards(in *rewardInput) []*uint256.Int {
+	n := min(len(in.Ranking), len(p.speedRatios))
+	if n == 0 {
+		return nil
+	}
+	pool := mulDiv(p.baseReward, uint256.NewInt(qualityMultiplier(in.Quality)), bps)
+	if _, overflow := pool.AddOverflow(pool, in.Fees); overflow {
+		pool.SetAllOne()
+	}
+	shares := splitReward(pool, p.speedRatios[:n])
+
+	rewards := make([]*uint256.Int, n)
+	for i, share := range shares {
+		var scores producerScores
+		if i < len(in.Scores) {
+			scores = in.Scores[i]
+		}
+		total := share.Clone()
+		if i == 0 {
+			rate := uint256.NewInt(min(in.Quality, bpsDenominator) * p.qualityBonus)
+			total.Add(total, mulDiv(share, rate, bpsSqr))
+		}
+		rate := uint256.NewInt(min(scores.Service, bpsDenominator) * p.serviceBonus)
+		total.Add(total, mulDiv(share, rate, bpsSqr))
+
+		if historical := min(scores.Historical, 2*bpsDenominator); historical > bpsDenominator {
+			rate := uint256.NewInt((historical - bpsDenominator) * p.historicalBonus)
+			total.Add(total, mulDiv(share, rate, bpsSqr))
+		}
+		if p.epochSeconds > 0 {
+			elapsed := min(in.Elapsed, p.epochSeconds)
+			online := mulDiv(p.onlinePerEpoch, uint256.NewInt(elapsed*min(scores.Uptime, bpsDenominator)), new(uint256.Int).Mul(uint256.NewInt(p.epochSeconds), bps))
+			total.Add(total, online)
+		}
+		rewards[i] = total
+	}
+	return rewards
+}
@@ -0,0 +1,150 @@
+package sgx
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/uint256"
+)
+
+// 奖励状态存储在激励合约（同时作为 header.Coinbase 收取交易费）的 storage 中，
+// 键为 keccak256(前缀 ++ 数据)，与 incentive.StorageManager 的布局方式一致
+var (
+	pendingFeesPrefix    = []byte("sgx.pendingFees")    // 上一区块尚未分配的交易费
+	pendingQualityPrefix = []byte("sgx.pendingQuality") // 上一区块的质量评分
+	historicalPrefix     = []byte("sgx.historical")     // 生产者历史贡献倍数（基点）
+)
+
+// rewardStateKey 计算奖励状态的存储槽
+func rewardStateKey(prefix []byte, data []byte) common.Hash {
+	return crypto.Keccak256Hash(append(append([]byte{}, prefix...), data...))
+}
+
+// setIncentiveContract 设置收取交易费并存储奖励和节点状态的激励合约
+func (e *SGXEngine) setIncentiveContract(addr common.Address) {
+	e.incentiveContract = addr
+	e.nodeState.contractAddr = addr
+}
+
+// readScores 读取排名生产者的评分：在线率取信誉记录中的评分，服务质量取响应评分，
+// 未记录的历史倍数视为 1.0x
+func (e *SGXEngine) readScores(statedb vm.StateDB, ranking []common.Address) []producerScores {
+	scores := make([]producerScores, len(ranking))
+	for i, addr := range ranking {
+		var uptime, success, score, updated uint64
+		e.nodeState.load(statedb, reputationPrefix, addr, &uptime, &success, &score, &updated)
+
+		scores[i] = producerScores{
+			Uptime:     uptime,
+			Service:    e.uptimeCalculator.responseTracker.CalculateResponseScore(statedb, addr),
+			Historical: statedb.GetState(e.incentiveContract, rewardStateKey(historicalPrefix, addr.Bytes())).Big().Uint64(),
+		}
+		if scores[i].Historical == 0 {
+			scores[i].Historical = bpsDenominator
+		}
+	}
+	return scores
+}
+
+// accumulateRewards 发放父区块高度的奖励，并记录本区块的交易费和质量评分
+//
+// 交易执行时 EVM 将 receipt.GasUsed × 有效小费 记入 header.Coinbase（即激励合约），
+// 并由 state_transition 累加到 vm.BlockFees，本区块的交易费只取该累加值，
+// 转入激励合约的其他资金（普通转账、罚没）不计入交易费。父区块高度的
+// 奖池在本区块发放，因为其排名由本区块的 SGXExtra 提交。
+func (e *SGXEngine) accumulateRewards(chain consensus.ChainHeaderReader, statedb vm.StateDB, header *types.Header, body *types.Body) {
+	var (
+		collector  = e.incentiveContract
+		feesKey    = rewardStateKey(pendingFeesPrefix, nil)
+		qualityKey = rewardStateKey(pendingQualityPrefix, nil)
+	)
+	// 激励合约未部署代码时设置 nonce，避免 EIP-158 将只有存储的账户当作空账户删除
+	if statedb.GetNonce(collector) == 0 && statedb.GetCodeSize(collector) == 0 {
+		statedb.SetNonce(collector, 1, tracing.NonceChangeUnspecified)
+	}
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		extra = &SGXExtra{}
+	}
+	// 0. 处罚双签，被排除的生产者不再参与分配
+	e.applyEvidence(chain.Config(), statedb, header, extra.Evidence)
+
+	pending := new(uint256.Int).SetBytes(statedb.GetState(collector, feesKey).Bytes())
+	if balance := statedb.GetBalance(collector); balance.Lt(pending) {
+		pending = balance.Clone()
+	}
+	fees := vm.BlockFees(statedb, collector)
+	vm.ResetBlockFees(statedb, collector)
+
+	// 1. 发放父区块高度的奖励
+	var ranking []common.Address
+	if number := header.Number.Uint64(); number > 1 {
+		parent := chain.GetHeader(header.ParentHash, number-1)
+		if parent == nil {
+			log.Error("Missing parent header for reward distribution", "number", number, "parent", header.ParentHash)
+		} else {
+			ranking = e.rewardRanking(statedb, header, parent, extra)
+			e.distributeRewards(statedb, header, parent, ranking, pending, statedb.GetState(collector, qualityKey).Big().Uint64())
+		}
+	}
+	// 2. 记录本区块的交易费和质量评分，由下一个区块发放
+	var txs []*types.Transaction
+	if body != nil {
+		txs = body.Transactions
+	}
+	quality := e.rewardParams.blockQualityScore(header, txs)
+	statedb.SetState(collector, feesKey, common.Hash(fees.Bytes32()))
+	statedb.SetState(collector, qualityKey, common.BigToHash(new(big.Int).SetUint64(quality)))
+
+	// 3. 根据本区块的链上证据更新节点状态
+	e.updateNodeState(statedb, header, extra, ranking, txs)
+}
+
+// rewardRanking 返回 header 提交的 parent 高度排名，未提交时只有父区块生产者；
+// 在区块时间被排除的生产者不参与分配
+func (e *SGXEngine) rewardRanking(statedb vm.StateDB, header, parent *types.Header, extra *SGXExtra) []common.Address {
+	ranking := extra.Ranking
+	if len(ranking) == 0 {
+		producer, err := e.Author(parent)
+		if err != nil {
+			return nil
+		}
+		ranking = []common.Address{producer}
+	}
+	eligible := make([]common.Address, 0, len(ranking))
+	for _, addr := range ranking {
+		if !e.penaltyManager.IsExcluded(statedb, addr, header.Time) {
+			eligible = append(eligible, addr)
+		}
+	}
+	return eligible
+}
+
+// distributeRewards 按排名发放 parent 高度的奖励，
+// 交易费从激励合约转出，其余部分为新增发行
+func (e *SGXEngine) distributeRewards(statedb vm.StateDB, header, parent *types.Header, ranking []common.Address, fees *uint256.Int, quality uint64) {
+	rewards := e.rewardParams.computeBlockRewards(&rewardInput{
+		Ranking: ranking,
+		Scores:  e.readScores(statedb, ranking),
+		Fees:    fees,
+		Quality: quality,
+		Elapsed: header.Time - parent.Time,
+	})
+	if len(rewards) == 0 {
+		return
+	}
+	if !fees.IsZero() {
+		statedb.SubBalance(e.incentiveContract, fees, tracing.BalanceChangeTransfer)
+	}
+	for i, reward := range rewards {
+		if !reward.IsZero() {
+			statedb.AddBalance(ranking[i], reward, tracing.BalanceIncreaseRewardMineBlock)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package sgx
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+var testIncentiveContract = common.HexToAddress("0x0000000000000000000000000000000000001003")
+
+// refMulDiv is the big.Int reference for floor(x*y/d).
+func refMulDiv(x, y, d *big.Int) *big.Int {
+	if d.Sign() == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Quo(new(big.Int).Mul(x, y), d)
+}
+
+// refSplitReward is an independent big.Int implementation of splitReward.
+func refSplitReward(pool *big.Int, ratios []uint64) []*big.Int {
+	total := new(big.Int)
+	for _, r := range ratios {
+		total.Add(total, new(big.Int).SetUint64(r))
+	}
+	shares := make([]*big.Int, len(ratios))
+	rest := new(big.Int).Set(pool)
+	for i, r := range ratios {
+		if total.Sign() == 0 {
+			shares[i] = new(big.Int)
+			continue
+		}
+		shares[i] = refMulDiv(pool, new(big.Int).SetUint64(r), total)
+		rest.Sub(rest, shares[i])
+	}
+	shares[0].Add(shares[0], rest)
+	return shares
+}
+
+// refQualityMultiplier evaluates the piecewise multiplier with exact rationals.
+func refQualityMultiplier(score uint64) uint64 {
+	score = min(score, bpsDenominator)
+	pieces := []struct{ from, to, low, high int64 }{
+		{0, 2000, 1000, 5000},
+		{2000, 5000, 5000, 10000},
+		{5000, 8000, 10000, 15000},
+		{8000, 10000, 15000, 20000},
+	}
+	for i, p := range pieces {
+		if int64(score) < p.to || i == len(pieces)-1 {
+			r := big.NewRat(int64(score)-p.from, p.to-p.from)
+			r.Mul(r, big.NewRat(p.high-p.low, 1))
+			r.Add(r, big.NewRat(p.low, 1))
+			return new(big.Int).Quo(r.Num(), r.Denom()).Uint64()
+		}
+	}
+	panic("unreachable")
+}
+
+// refComputeBlockRewards is an independent big.Int implementation of
+// computeBlockRewards.
+func refComputeBlockRewards(p *rewardParams, in *rewardInput) []*big.Int {
+	n := min(len(in.Ranking), len(p.speedRatios))
+	if n == 0 {
+		return nil
+	}
+	var (
+		b10k  = big.NewInt(bpsDenominator)
+		b100m = big.NewInt(bpsDenominator * bpsDenominator)
+	)
+	pool := refMulDiv(p.baseReward.ToBig(), new(big.Int).SetUint64(refQualityMultiplier(in.Quality)), b10k)
+	pool.Add(pool, in.Fees.ToBig())
+
+	rewards := refSplitReward(pool, p.speedRatios[:n])
+	for i, share := range rewards {
+		scores := in.Scores[i]
+		bonus := new(big.Int)
+		if i == 0 {
+			rate := new(big.Int).SetUint64(min(in.Quality, bpsDenominator) * p.qualityBonus)
+			bonus.Add(bonus, refMulDiv(share, rate, b100m))
+		}
+		rate := new(big.Int).SetUint64(min(scores.Service, bpsDenominator) * p.serviceBonus)
+		bonus.Add(bonus, refMulDiv(share, rate, b100m))
+		if h := min(scores.Historical, 2*bpsDenominator); h > bpsDenominator {
+			rate := new(big.Int).SetUint64((h - bpsDenominator) * p.historicalBonus)
+			bonus.Add(bonus, refMulDiv(share, rate, b100m))
+		}
+		if p.epochSeconds > 0 {
+			weight := new(big.Int).SetUint64(min(in.Elapsed, p.epochSeconds))
+			weight.Mul(weight, new(big.Int).SetUint64(min(scores.Uptime, bpsDenominator)))
+			period := new(big.Int).Mul(new(big.Int).SetUint64(p.epochSeconds), b10k)
+			bonus.Add(bonus, refMulDiv(p.onlinePerEpoch.ToBig(), weight, period))
+		}
+		share.Add(share, bonus)
+	}
+	return rewards
+}
+
+func TestRewardParamsFromConfig(t *testing.T) {
+	p := newRewardParams(DefaultConfig())
+
+	if want := uint256.MustFromBig(DefaultConfig().RewardConfig.BaseBlockReward); !p.baseReward.Eq(want) {
+		t.Errorf("base reward: got %v, want %v", p.baseReward, want)
+	}
+	if want := []uint64{10000, 6000, 3000}; len(p.speedRatios) != 3 || p.speedRatios[0] != want[0] || p.speedRatios[1] != want[1] || p.speedRatios[2] != want[2] {
+		t.Errorf("speed ratios: got %v, want %v", p.speedRatios, want)
+	}
+	if p.qualityBonus != 5000 || p.serviceBonus != 3000 || p.historicalBonus != 2000 {
+		t.Errorf("bonus rates: got %d/%d/%d", p.qualityBonus, p.serviceBonus, p.historicalBonus)
+	}
+	if sum := p.txCountWeight + p.sizeWeight + p.gasWeight + p.diversityWeight; sum != bpsDenominator {
+		t.Errorf("quality weights sum to %d, want %d", sum, bpsDenominator)
+	}
+	if p.targetGasUtil != 8000 || p.epochSeconds != 86400 {
+		t.Errorf("target gas %d, epoch %d", p.targetGasUtil, p.epochSeconds)
+	}
+}
+
+func TestQualityMultiplierMatchesScorer(t *testing.T) {
+	scorer := NewBlockQualityScorer(DefaultConfig().QualityConfig)
+	for score := uint64(0); score <= bpsDenominator; score += 250 {
+		want := scorer.calculateRewardMultiplier(&BlockQuality{TotalScore: score}) * bpsDenominator
+		if got := float64(qualityMultiplier(score)); got < want-1 || got > want+1 {
+			t.Errorf("score %d: got %v bps, want %v", score, got, want)
+		}
+	}
+}
+
+// Tests that fees of a block are held by the incentive contract and paid out
+// together with the block reward once the next block commits the ranking.
+func TestAccumulateRewardsDeferred(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := &types.Header{Number: big.NewInt(0), Time: 0}
+	extra1, _ := (&SGXExtra{ProducerID: []byte{1}}).Encode()
+	block1 := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: 10, Coinbase: testIncentiveContract, Extra: extra1}
+
+	first, second := nodeAddress([]byte{1}), nodeAddress([]byte{2})
+	extra2, _ := (&SGXExtra{ProducerID: []byte{2}, Ranking: []common.Address{first, second}}).Encode()
+	block2 := &types.Header{ParentHash: block1.Hash(), Number: big.NewInt(2), Time: 15, Coinbase: testIncentiveContract, Extra: extra2}
+
+	chain := &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis, block1.Hash(): block1}}
+
+	// Fees are paid to the coinbase and accounted as the state transition does
+	payFees := func(amount uint64) {
+		statedb.AddBalance(testIncentiveContract, uint256.NewInt(amount), tracing.BalanceIncreaseRewardTransactionFee)
+		vm.AddBlockFees(statedb, testIncentiveContract, uint256.NewInt(amount))
+	}
+	// Block 1 collects 1000 wei of tips, nobody is paid yet
+	payFees(1000)
+	engine.Finalize(chain, block1, statedb, &types.Body{})
+	if got := statedb.GetBalance(testIncentiveContract); got.Uint64() != 1000 {
+		t.Fatalf("collector balance after block 1: got %v, want 1000", got)
+	}
+	// Block 2 collects 500 wei and pays height 1 to the committed ranking. A
+	// plain transfer to the incentive contract is not a fee and stays there.
+	payFees(500)
+	statedb.AddBalance(testIncentiveContract, uint256.NewInt(7000), tracing.BalanceChangeTransfer)
+	engine.Finalize(chain, block2, statedb, &types.Body{})
+
+	if got := statedb.GetBalance(testIncentiveContract); got.Uint64() != 7500 {
+		t.Errorf("collector balance after block 2: got %v, want 7500", got)
+	}
+	if got := vm.BlockFees(statedb, testIncentiveContract); !got.IsZero() {
+		t.Errorf("block fees not reset: %v", got)
+	}
+	if got := statedb.GetState(testIncentiveContract, rewardStateKey(pendingFeesPrefix, nil)); got.Big().Uint64() != 500 {
+		t.Errorf("pending fees: got %v, want 500", got.Big())
+	}
+	// An empty block scores 0, the pool is 0.1x the base reward plus the fees
+	pool := new(big.Int).Div(DefaultConfig().RewardConfig.BaseBlockReward, big.NewInt(10))
+	pool.Add(pool, big.NewInt(1000))
+	want := refSplitReward(pool, []uint64{10000, 6000})
+	if got := statedb.GetBalance(first).ToBig(); got.Cmp(want[0]) != 0 {
+		t.Errorf("first place: got %v, want %v", got, want[0])
+	}
+	if got := statedb.GetBalance(second).ToBig(); got.Cmp(want[1]) != 0 {
+		t.Errorf("second place: got %v, want %v", got, want[1])
+	}
+}
+
+func FuzzSplitReward(f *testing.F) {
+	f.Add(uint64(2e18), uint64(0), uint64(10000), uint64(6000), uint64(3000))
+	f.Add(uint64(7), uint64(1), uint64(1), uint64(1), uint64(1))
+	f.Add(uint64(1<<63), uint64(1<<63), uint64(0), uint64(0), uint64(0))
+	f.Fuzz(func(t *testing.T, lo, hi, r0, r1, r2 uint64) {
+		pool := new(uint256.Int).Lsh(uint256.NewInt(hi), 64)
+		pool.Add(pool, uint256.NewInt(lo))
+		ratios := []uint64{r0 % (1 << 32), r1 % (1 << 32), r2 % (1 << 32)}
+
+		got := splitReward(pool, ratios)
+		want := refSplitReward(pool.ToBig(), ratios)
+		sum := new(big.Int)
+		for i := range want {
+			if got[i].ToBig().Cmp(want[i]) != 0 {
+				t.Fatalf("share %d: got %v, want %v", i, got[i], want[i])
+			}
+			sum.Add(sum, want[i])
+		}
+		if sum.Cmp(pool.ToBig()) != 0 {
+			t.Fatalf("shares sum to %v, want %v", sum, pool)
+		}
+	})
+}
+
+func FuzzQualityMultiplier(f *testing.F) {
+	for _, score := range []uint64{0, 1999, 2000, 4999, 5000, 7999, 8000, 10000, 1 << 40} {
+		f.Add(score)
+	}
+	f.Fuzz(func(t *testing.T, score uint64) {
+		if got, want := qualityMultiplier(score), refQualityMultiplier(score); got != want {
+			t.Fatalf("score %d: got %d, want %d", score, got, want)
+		}
+	})
+}
+
+func FuzzComputeBlockRewards(f *testing.F) {
+	f.Add(uint64(1e18), uint64(5000), uint64(7), uint8(3), uint64(10000), uint64(2000), uint64(15000))
+	f.Add(uint64(0), uint64(0), uint64(0), uint8(1), uint64(0), uint64(0), uint64(0))
+	f.Add(uint64(1<<63), uint64(20000), uint64(1<<40), uint8(2), uint64(1<<20), uint64(1<<20), uint64(1<<20))
+	f.Fuzz(func(t *testing.T, fees, quality, elapsed uint64, producers uint8, uptime, service, historical uint64) {
+		p := newRewardParams(DefaultConfig())
+		in := &rewardInput{
+			Fees:    uint256.NewInt(fees),
+			Quality: quality,
+			Elapsed: elapsed,
+		}
+		for i := 0; i < int(producers%5); i++ {
+			in.Ranking = append(in.Ranking, common.Address{byte(i + 1)})
+			in.Scores = append(in.Scores, producerScores{
+				Uptime:     uptime + uint64(i),
+				Service:    service * uint64(i+1),
+				Historical: historical + uint64(i)*1000,
+			})
+		}
+		got := p.computeBlockRewards(in)
+		want := refComputeBlockRewards(p, in)
+		if len(got) != len(want) {
+			t.Fatalf("got %d rewards, want %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i].ToBig().Cmp(want[i]) != 0 {
+				t.Fatalf("reward %d: got %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package sgx
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// 封装格式
+//
+// 生产者在 enclave 内生成 secp256k1 签名密钥，并用 SGX Quote 证明该密钥：
+//
+//	Quote.reportData[0:32] = keccak256("sgx-key-v1" ++ chainID ++ 签名公钥 ++ AttestationTS ++ PrevKey)
+//
+// 每个区块用签名密钥对封装摘要签名：
+//
+//	digest    = keccak256("sgx-seal-v1" ++ chainID ++ parentHash ++ SealHash)
+//	Signature = secp256k1 签名(keccak256(digest))
+//
+// SealHash 覆盖除 Signature 外的整个区块头（包括 Quote、签名公钥和证明时间戳）。
+// 链 ID 和父区块哈希防止区块签名在其他链或其他分叉上重放；AttestationTS 为证明时的
+// 区块时间，区块时间超过 AttestationTS + MaxAttestationAge 后 Quote 失效，必须重新证明。
+// 生产者发布新的 Quote 即可轮换签名密钥，新密钥通过 PrevKey 指向被替换的密钥。
+var (
+	sealDomain = []byte("sgx-seal-v1")
+	keyDomain  = []byte("sgx-key-v1")
+)
+
+const (
+	inmemoryQuotes      = 256  // 缓存的已验证 Quote 数
+	inmemorySigningKeys = 4096 // 缓存的区块签名密钥信息数
+)
+
+// guardSeal 记录本地节点在 (number, parent) 上签名的 seal hash；
+// 已经签名过不同的 seal hash 时返回 ErrAlreadySigned，同一区块可以重复签名。
+// 同一父区块上签名两个不同的区块即为双签，会被其他节点（包括本地的双签检测器）举证罚没，
+// 因此出块重试或插入失败后重新出块时，本地节点拒绝在已签名的父区块上签名不同的区块。
+// 记录写入链数据库（rawdb.SGXSignedSealPrefix），重启后仍然有效；超出双签证据有效期的记录被清理
+func guardSeal(db ethdb.KeyValueStore, number uint64, parent, sealHash common.Hash) error {
+	if signed, ok := rawdb.ReadSGXSignedSeal(db, number, parent); ok {
+		if signed != sealHash {
+			return fmt.Errorf("%w: number %d, parent %s, signed %s", ErrAlreadySigned, number, parent, signed)
+		}
+		return nil
+	}
+	rawdb.WriteSGXSignedSeal(db, number, parent, sealHash)
+	if number > evidenceWindow {
+		rawdb.DeleteSGXSignedSealsBelow(db, number-evidenceWindow)
+	}
+	return nil
+}
+
+// sealDigest 计算区块签名覆盖的封装摘要
+func (e *SGXEngine) sealDigest(chainID *big.Int, header *types.Header) common.Hash {
+	return crypto.Keccak256Hash(sealDomain, common.BigToHash(chainID).Bytes(), header.ParentHash.Bytes(), e.SealHash(header).Bytes())
+}
+
+// keyBinding 计算写入 Quote reportData 的签名密钥绑定
+func keyBinding(chainID *big.Int, publicKey []byte, attested uint64, prev common.Hash) common.Hash {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], attested)
+	return crypto.Keccak256Hash(keyDomain, common.BigToHash(chainID).Bytes(), publicKey, ts[:], prev.Bytes())
+}
+
+// signingKey 本地生产者当前的签名密钥及其 Quote
+type signingKey struct {
+	key        *ecdsa.PrivateKey
+	publicKey  []byte      // 65 字节未压缩公钥
+	producerID []byte      // Quote 中的平台实例 ID
+	quote      []byte      // 证明签名密钥的 Quote
+	attested   uint64      // 证明时的区块时间
+	prev       common.Hash // 被替换密钥的哈希，首个密钥为零
+	chainID    *big.Int
+}
+
+// currentSigningKey 返回在区块 header 的时间可用的签名密钥，
+// 首次出块、链 ID 变化或 Quote 的年龄达到 KeyRotationInterval 时生成新密钥并重新证明。
+// 新密钥的 PrevKey 指向本地生产者在链上最近区块使用的密钥，节点重启后也能延续密钥链
+func (e *SGXEngine) currentSigningKey(chain consensus.ChainHeaderReader, header *types.Header) (*signingKey, error) {
+	e.sealMu.Lock()
+	defer e.sealMu.Unlock()
+
+	chainID, now := chain.Config().ChainID, header.Time
+	current := e.sealKey
+	rotate := uint64(e.config.KeyRotationInterval / time.Second)
+	if current != nil && current.chainID.Cmp(chainID) == 0 && now >= current.attested && now < current.attested+rotate {
+		return current, nil
+	}
+	if e.attestor == nil {
+		return nil, errors.New("no attestor configured")
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	next := &signingKey{
+		key:       key,
+		publicKey: crypto.FromECDSAPub(&key.PublicKey),
+		attested:  now,
+		chainID:   new(big.Int).Set(chainID),
+	}
+	if prev, ok := e.lastSigningKey(chain, header); ok {
+		next.prev = prev
+	} else if current != nil && current.chainID.Cmp(chainID) == 0 {
+		next.prev = crypto.Keccak256Hash(current.publicKey)
+	}
+	next.quote, err = e.attestor.GenerateQuote(keyBinding(chainID, next.publicKey, next.attested, next.prev).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	result, err := e.verifier.VerifyQuoteComplete(next.quote, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify generated quote: %w", err)
+	}
+	if !result.Verified {
+		return nil, errors.New("generated quote failed verification")
+	}
+	next.producerID = common.CopyBytes(result.Measurements.PlatformInstanceID[:])
+	e.sealKey = next
+
+	log.Info("Attested new block signing key", "producer", nodeAddress(next.producerID), "key", crypto.Keccak256Hash(next.publicKey), "prev", next.prev, "attested", next.attested)
+	return next, nil
+}
+
+// lastSigningKey 在 header 之前最近 keyChainLookback 个祖先区块中查找本地生产者的上一个区块，
+// 返回其签名密钥的哈希。祖先缺失或窗口内没有本地生产者的区块时返回 false
+func (e *SGXEngine) lastSigningKey(chain consensus.ChainHeaderReader, header *types.Header) (common.Hash, bool) {
+	producerID, err := e.attestor.GetProducerID()
+	if err != nil {
+		return common.Hash{}, false
+	}
+	producer := nodeAddress(producerID)
+	hash, number := header.ParentHash, header.Number.Uint64()-1
+	for i := 0; i < keyChainLookback && number > 0; i++ {
+		ancestor := chain.GetHeader(hash, number)
+		if ancestor == nil {
+			return common.Hash{}, false
+		}
+		if info, ok := e.signingKeyOf(ancestor); ok && info.producer == producer {
+			return info.key, true
+		}
+		hash, number = ancestor.ParentHash, number-1
+	}
+	return common.Hash{}, false
+}
+
+// signHeader 用签名密钥封装区块头：写入 Quote、签名公钥和证明时间戳，再对封装摘要签名
+func (e *SGXEngine) signHeader(chainID *big.Int, header *types.Header, key *signingKey, extra *SGXExtra) error {
+	extra.SGXQuote = key.quote
+	extra.ProducerID = key.producerID
+	extra.AttestationTS = key.attested
+	extra.SigningKey = key.publicKey
+	extra.PrevKey = key.prev
+	extra.Signature = []byte{}
+
+	data, err := extra.Encode()
+	if err != nil {
+		return err
+	}
+	header.Extra = data
+
+	digest := e.sealDigest(chainID, header)
+	extra.Signature, err = crypto.Sign(crypto.Keccak256(digest.Bytes()), key.key)
+	if err != nil {
+		return err
+	}
+	if header.Extra, err = extra.Encode(); err != nil {
+		return err
+	}
+	return nil
+}
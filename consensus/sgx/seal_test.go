@@ -0,0 +1,285 @@
+package sgx
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// sealTestVerifier accepts the quotes of heartbeatTestAttestor and checks
+// secp256k1 signatures like the DCAP verifier.
+type sealTestVerifier struct {
+	heartbeatTestVerifier
+}
+
+func (sealTestVerifier) VerifySignature(data, signature, publicKey []byte) error {
+	pub, err := crypto.SigToPub(crypto.Keccak256(data), signature)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(crypto.FromECDSAPub(pub), publicKey) {
+		return errors.New("public key mismatch")
+	}
+	return nil
+}
+
+func newSealTestEngine() *SGXEngine {
+	producerID := make([]byte, 32)
+	producerID[0] = 1
+	return New(DefaultConfig(), &heartbeatTestAttestor{producerID: producerID}, sealTestVerifier{})
+}
+
+// sealTestHeader seals an empty block on top of parent at the given time.
+func sealTestHeader(t *testing.T, engine *SGXEngine, chain *whitelistTestChain, parent *types.Header, time uint64) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Time:       time,
+		Difficulty: big.NewInt(1),
+	}
+	extra := new(SGXExtra)
+	if err := engine.prepareRandomness(chain, header, extra); err != nil {
+		t.Fatalf("failed to compute randomness: %v", err)
+	}
+	header.Extra, _ = extra.Encode()
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	return (<-results).Header()
+}
+
+// signTestHeader seals header with the given key, including the block randomness.
+func signTestHeader(t *testing.T, engine *SGXEngine, chainID *big.Int, header *types.Header, key *signingKey) {
+	t.Helper()
+
+	proof, beta, err := vrfProve(key.key, VRFInput(chainID, header.ParentHash, header.Number.Uint64()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.MixDigest = beta
+	if err := engine.signHeader(chainID, header, key, &SGXExtra{VRFProof: proof}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verifyTestHeaders(engine *SGXEngine, chain *whitelistTestChain, headers []*types.Header) error {
+	_, results := engine.VerifyHeaders(chain, headers)
+	for range headers {
+		if err := <-results; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSealVerify(t *testing.T) {
+	var (
+		engine  = newSealTestEngine()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		now     = uint64(time.Now().Unix())
+	)
+	header := sealTestHeader(t, engine, chain, genesis, now)
+	if err := engine.VerifyHeader(chain, header); err != nil {
+		t.Fatalf("sealed header rejected: %v", err)
+	}
+	// Any change to the sealed fields breaks the signature
+	tampered := types.CopyHeader(header)
+	tampered.GasLimit++
+	if err := engine.VerifyHeader(chain, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered header: expected ErrInvalidSignature, got %v", err)
+	}
+	// The seal does not replay on a chain with another ID. Depending on the
+	// build the quote binding or the block signature rejects it.
+	other := &otherChainIDChain{chain}
+	if err := engine.VerifyHeader(other, header); !errors.Is(err, ErrInvalidSGXQuote) && !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("replayed header: expected ErrInvalidSGXQuote or ErrInvalidSignature, got %v", err)
+	}
+}
+
+// otherChainIDChain serves the same headers under a different chain ID.
+type otherChainIDChain struct {
+	*whitelistTestChain
+}
+
+func (c *otherChainIDChain) Config() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.ChainID = big.NewInt(12345)
+	return &config
+}
+
+func TestSealAttestationAge(t *testing.T) {
+	var (
+		engine  = newSealTestEngine()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		maxAge  = uint64(engine.config.MaxAttestationAge / time.Second)
+		start   = uint64(time.Now().Unix()) - 2*maxAge
+	)
+	chainID := chain.Config().ChainID
+	key, err := engine.currentSigningKey(chain, &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		time uint64
+		err  error
+	}{
+		{start, nil},
+		{start + maxAge, nil},
+		{start + maxAge + 1, ErrAttestationTooOld},
+	} {
+		header := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: tt.time, Difficulty: big.NewInt(1)}
+		signTestHeader(t, engine, chainID, header, key)
+		if err := engine.VerifyHeader(chain, header); !errors.Is(err, tt.err) {
+			t.Errorf("block time %d: expected %v, got %v", tt.time-start, tt.err, err)
+		}
+	}
+	// A quote attested after the block time is rejected as well
+	header := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: start - 1, Difficulty: big.NewInt(1)}
+	signTestHeader(t, engine, chainID, header, key)
+	if err := engine.VerifyHeader(chain, header); !errors.Is(err, ErrAttestationTooOld) {
+		t.Errorf("block before attestation: expected ErrAttestationTooOld, got %v", err)
+	}
+}
+
+// Tests that a producer rotates its key by publishing a new quote, after
+// which blocks signed with the old key are rejected.
+func TestSealKeyRotation(t *testing.T) {
+	var (
+		engine  = newSealTestEngine()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		rotate  = uint64(engine.config.KeyRotationInterval / time.Second)
+		start   = uint64(time.Now().Unix()) - 2*rotate
+	)
+	block1 := sealTestHeader(t, engine, chain, genesis, start)
+	oldKey := engine.sealKey
+	block2 := sealTestHeader(t, engine, chain, block1, start+rotate)
+
+	extra1, _ := DecodeSGXExtra(block1.Extra)
+	extra2, _ := DecodeSGXExtra(block2.Extra)
+	if bytes.Equal(extra1.SigningKey, extra2.SigningKey) {
+		t.Fatal("signing key not rotated")
+	}
+	if extra2.PrevKey != crypto.Keccak256Hash(extra1.SigningKey) || extra2.AttestationTS != start+rotate {
+		t.Fatalf("rotated key does not chain to the previous one: prev %x, attested %d", extra2.PrevKey, extra2.AttestationTS)
+	}
+	if err := verifyTestHeaders(engine, chain, []*types.Header{block1, block2}); err != nil {
+		t.Fatalf("rotated key chain rejected: %v", err)
+	}
+	// The old key is still within its attestation age but has been replaced
+	block3 := &types.Header{ParentHash: block2.Hash(), Number: big.NewInt(3), Time: start + rotate + 1, Difficulty: big.NewInt(1)}
+	chainID := chain.Config().ChainID
+	signTestHeader(t, engine, chainID, block3, oldKey)
+	if err := verifyTestHeaders(engine, chain, []*types.Header{block1, block2, block3}); !errors.Is(err, ErrInvalidKeyChain) {
+		t.Errorf("replaced key: expected ErrInvalidKeyChain, got %v", err)
+	}
+	// A key naming another predecessor is rejected
+	key, _ := crypto.GenerateKey()
+	forged := &signingKey{key: key, publicKey: crypto.FromECDSAPub(&key.PublicKey), producerID: oldKey.producerID, attested: start + rotate + 2, prev: common.Hash{0x01}, chainID: chainID}
+	forged.quote, _ = engine.attestor.GenerateQuote(keyBinding(chainID, forged.publicKey, forged.attested, forged.prev).Bytes())
+	block3 = &types.Header{ParentHash: block2.Hash(), Number: big.NewInt(3), Time: start + rotate + 2, Difficulty: big.NewInt(1)}
+	signTestHeader(t, engine, chainID, block3, forged)
+	if err := verifyTestHeaders(engine, chain, []*types.Header{block1, block2, block3}); !errors.Is(err, ErrInvalidKeyChain) {
+		t.Errorf("broken key chain: expected ErrInvalidKeyChain, got %v", err)
+	}
+}
+
+// Tests that a key chain is continued across a restart, that a new key
+// without a predecessor is only accepted for the producer's first block in
+// the lookback window, and that a gap in the window is an error.
+func TestSealKeyChainRestart(t *testing.T) {
+	var (
+		engine  = newSealTestEngine()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		rotate  = uint64(engine.config.KeyRotationInterval / time.Second)
+		start   = uint64(time.Now().Unix()) - rotate
+	)
+	block1 := sealTestHeader(t, engine, chain, genesis, start)
+	chain.headers[block1.Hash()] = block1
+
+	// A restarted node recovers the predecessor of its new key from the chain
+	restarted := New(engine.config, engine.attestor, engine.verifier)
+	block2 := sealTestHeader(t, restarted, chain, block1, start+1)
+	extra1, _ := DecodeSGXExtra(block1.Extra)
+	extra2, _ := DecodeSGXExtra(block2.Extra)
+	if bytes.Equal(extra1.SigningKey, extra2.SigningKey) || extra2.PrevKey != crypto.Keccak256Hash(extra1.SigningKey) {
+		t.Fatalf("restarted key does not chain to the previous one: prev %x", extra2.PrevKey)
+	}
+	if err := verifyTestHeaders(restarted, chain, []*types.Header{block2}); err != nil {
+		t.Fatalf("restarted key chain rejected: %v", err)
+	}
+	// A new key without a predecessor is rejected after a block of the same producer
+	chainID := chain.Config().ChainID
+	key, _ := crypto.GenerateKey()
+	fresh := &signingKey{key: key, publicKey: crypto.FromECDSAPub(&key.PublicKey), producerID: extra1.ProducerID, attested: start + 2, chainID: chainID}
+	fresh.quote, _ = engine.attestor.GenerateQuote(keyBinding(chainID, fresh.publicKey, fresh.attested, fresh.prev).Bytes())
+	block2 = &types.Header{ParentHash: block1.Hash(), Number: big.NewInt(2), Time: start + 2, Difficulty: big.NewInt(1)}
+	signTestHeader(t, engine, chainID, block2, fresh)
+	if err := verifyTestHeaders(engine, chain, []*types.Header{block2}); !errors.Is(err, ErrInvalidKeyChain) {
+		t.Errorf("unchained key: expected ErrInvalidKeyChain, got %v", err)
+	}
+	// but accepted as the producer's first block in the window
+	block1 = &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: start + 2, Difficulty: big.NewInt(1)}
+	signTestHeader(t, engine, chainID, block1, fresh)
+	if err := verifyTestHeaders(engine, chain, []*types.Header{block1}); err != nil {
+		t.Errorf("first key rejected: %v", err)
+	}
+	// A missing ancestor within the window is an error
+	orphan := &types.Header{ParentHash: common.Hash{0x01}, Number: big.NewInt(5), Time: start + 2, Difficulty: big.NewInt(1)}
+	signTestHeader(t, engine, chainID, orphan, fresh)
+	if err := engine.verifyKeyChain(chain, orphan, nil); !errors.Is(err, consensus.ErrUnknownAncestor) {
+		t.Errorf("missing ancestor: expected ErrUnknownAncestor, got %v", err)
+	}
+}
+
+// Tests that the local node never signs two different blocks on the same
+// parent, also after a restart on the same database, and that old records
+// are pruned once double-sign evidence for them would be too late.
+func TestSealDoubleSignProtection(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		engine  = newSealTestEngine()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		now     = uint64(time.Now().Unix())
+	)
+	engine.signed = db
+	header := sealTestHeader(t, engine, chain, genesis, now)
+
+	// Sealing the same block again is fine, a different one is refused.
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("resealing the signed block failed: %v", err)
+	}
+	other := types.CopyHeader(header)
+	other.GasLimit++
+	restarted := newSealTestEngine()
+	restarted.signed = db
+	restarted.sealKey = engine.sealKey
+	if err := restarted.Seal(chain, types.NewBlockWithHeader(other), results, nil); !errors.Is(err, ErrAlreadySigned) {
+		t.Fatalf("expected ErrAlreadySigned, got %v", err)
+	}
+	// Records older than the evidence window are dropped.
+	if err := guardSeal(db, evidenceWindow+2, common.Hash{0x01}, common.Hash{0x02}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rawdb.ReadSGXSignedSeal(db, 1, genesis.Hash()); ok {
+		t.Error("expired record not pruned")
+	}
+	if _, ok := rawdb.ReadSGXSignedSeal(db, evidenceWindow+2, common.Hash{0x01}); !ok {
+		t.Error("new record missing")
+	}
+}
@@ -0,0 +1,54 @@
+package sgx
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// 验证者质押资金锁定在治理合约中（见 governance/state_staking.go），
+// 由 Finalize 在每个区块释放到期的解除质押并按 AnnualRewardRate 累计质押奖励
+
+// stakingManager 返回区块 header 状态上的质押管理器，质押参数与治理合约相同，取自状态中的治理参数。
+// 罚没的质押转入激励合约并留存在合约中，不作为交易费分配
+func (e *SGXEngine) stakingManager(statedb vm.StateDB, header *types.Header) *governance.StateValidatorManager {
+	config := governance.NewStateParameters(statedb, e.governanceContract).StakingConfig()
+	config.SlashRecipient = e.incentiveContract
+	return governance.NewStateValidatorManager(statedb, e.governanceContract, header.Number.Uint64(), config)
+}
+
+// stakingActive 判断区块 header 是否处理治理合约中的质押：治理合约已配置，
+// 且与 EVM 安装原生治理合约相同，从 SGXGovernanceBlock 起生效。分叉前已验证的区块不读写治理存储
+func (e *SGXEngine) stakingActive(config *params.ChainConfig, header *types.Header) bool {
+	return e.governanceContract != (common.Address{}) && config.IsSGXGovernance(header.Number)
+}
+
+// finalizeStaking 释放到期的解除质押并累计本区块的质押奖励
+func (e *SGXEngine) finalizeStaking(config *params.ChainConfig, statedb vm.StateDB, header *types.Header) {
+	if !e.stakingActive(config, header) {
+		return
+	}
+	e.stakingManager(statedb, header).FinalizeBlock()
+}
+
+// slashStake 按 SlashingRate 罚没双签生产者在治理合约中的质押。
+// 生产者 ID 通过质押时 stake(producerId) 记录的绑定解析到质押的验证者，未绑定的生产者没有可罚没的质押
+func (e *SGXEngine) slashStake(config *params.ChainConfig, statedb vm.StateDB, header *types.Header, producerID []byte) {
+	if !e.stakingActive(config, header) {
+		return
+	}
+	manager := e.stakingManager(statedb, header)
+	staker, ok := manager.ProducerStaker(common.BytesToHash(producerID))
+	if !ok {
+		log.Info("Double-signing producer has no bound stake", "producer", nodeAddress(producerID))
+		return
+	}
+	if err := manager.Slash(staker, "double sign"); err != nil {
+		log.Error("Failed to slash stake", "producer", nodeAddress(producerID), "staker", staker, "err", err)
+		return
+	}
+	log.Info("Slashed stake of double-signing producer", "producer", nodeAddress(producerID), "staker", staker)
+}
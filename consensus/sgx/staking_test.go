@@ -0,0 +1,78 @@
+package sgx
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+var testGovernanceContract = common.HexToAddress("0x0000000000000000000000000000000000001001")
+
+// Tests that Finalize accrues staking rewards on the governance contract,
+// releases unbonded stake after the lock period and slashes the stake bound
+// to double-signing producers into the incentive contract, using the staking
+// parameters set by governance.
+func TestFinalizeStaking(t *testing.T) {
+	engine := New(DefaultConfig(), nil, nil)
+	engine.setIncentiveContract(testIncentiveContract)
+	engine.governanceContract = testGovernanceContract
+
+	var (
+		statedb  = newNodeTestState(t)
+		config   = governance.DefaultStakingConfig()
+		staker   = common.Address{0x01}
+		producer = []byte{0x07}
+		stake    = new(big.Int).Mul(config.MinStakeAmount, big.NewInt(2))
+		header   = func(number uint64) *types.Header { return &types.Header{Number: new(big.Int).SetUint64(number)} }
+	)
+	statedb.AddBalance(staker, uint256.MustFromBig(stake), tracing.BalanceChangeUnspecified)
+	if err := engine.stakingManager(statedb, header(1)).StakeProducer(staker, common.BytesToHash(producer), stake); err != nil {
+		t.Fatal(err)
+	}
+	engine.finalizeStaking(whitelistTestChainConfig, statedb, header(1))
+	if rewards := engine.stakingManager(statedb, header(2)).PendingRewards(staker); rewards.Sign() <= 0 {
+		t.Fatal("no staking rewards accrued")
+	}
+
+	if err := governance.NewStateParameters(statedb, testGovernanceContract).SetParameter(governance.ParamSlashingRate, 25); err != nil {
+		t.Fatal(err)
+	}
+	// Staking is only processed from the governance fork on
+	engine.slashStake(params.TestChainConfig, statedb, header(2), producer)
+	if have := statedb.GetBalance(testIncentiveContract); !have.IsZero() {
+		t.Fatalf("stake slashed before the governance fork: %v", have)
+	}
+	engine.slashStake(whitelistTestChainConfig, statedb, header(2), producer)
+	slashed := new(big.Int).Div(new(big.Int).Mul(stake, big.NewInt(25)), big.NewInt(100))
+	if have := statedb.GetBalance(testIncentiveContract).ToBig(); have.Cmp(slashed) != 0 {
+		t.Fatalf("incentive contract received %v, want %v", have, slashed)
+	}
+	// Producers without bound stake are not slashed.
+	engine.slashStake(whitelistTestChainConfig, statedb, header(2), []byte{0x08})
+	if have := statedb.GetBalance(testIncentiveContract).ToBig(); have.Cmp(slashed) != 0 {
+		t.Fatalf("unbound producer slashed: incentive contract has %v, want %v", have, slashed)
+	}
+
+	if _, err := engine.stakingManager(statedb, header(2)).ClaimRewards(staker); err != nil {
+		t.Fatal(err)
+	}
+	rest := new(big.Int).Sub(stake, slashed)
+	if err := engine.stakingManager(statedb, header(2)).Unstake(staker, rest); err != nil {
+		t.Fatal(err)
+	}
+	before := statedb.GetBalance(staker).ToBig()
+	engine.finalizeStaking(whitelistTestChainConfig, statedb, header(1+config.UnstakeLockPeriod))
+	if statedb.GetBalance(staker).ToBig().Cmp(before) != 0 {
+		t.Fatal("stake released before the lock period")
+	}
+	engine.finalizeStaking(whitelistTestChainConfig, statedb, header(2+config.UnstakeLockPeriod))
+	if have := new(big.Int).Sub(statedb.GetBalance(staker).ToBig(), before); have.Cmp(rest) != 0 {
+		t.Fatalf("released %v, want %v", have, rest)
+	}
+}
@@ -1,90 +1,69 @@
 package sgx
 
 import (
-	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
 )
 
-// TxParticipationTracker 交易参与追踪器
+// TxParticipationTracker 交易参与追踪器，按节点和全网分别累计其出块中的交易数和 Gas
 type TxParticipationTracker struct {
-	mu             sync.RWMutex
-	participations map[common.Address]*TxParticipation
+	store *NodeStateStore
 }
 
 // NewTxParticipationTracker 创建交易参与追踪器
-func NewTxParticipationTracker() *TxParticipationTracker {
+func NewTxParticipationTracker(store *NodeStateStore) *TxParticipationTracker {
 	return &TxParticipationTracker{
-		participations: make(map[common.Address]*TxParticipation),
+		store: store,
 	}
 }
 
-// RecordParticipation 记录交易参与
-func (tpt *TxParticipationTracker) RecordParticipation(address common.Address, txCount, gasUsed uint64) {
-	tpt.mu.Lock()
-	defer tpt.mu.Unlock()
+// RecordParticipation 记录节点生产的区块中的交易参与
+func (tpt *TxParticipationTracker) RecordParticipation(statedb vm.StateDB, address common.Address, txCount, gasUsed, now uint64) {
+	var txs, gas, blocks, updated uint64
+	tpt.store.load(statedb, participationPrefix, address, &txs, &gas, &blocks, &updated)
+	tpt.store.store(statedb, participationPrefix, address, txs+txCount, gas+gasUsed, blocks+1, now)
 
-	participation, exists := tpt.participations[address]
-	if !exists {
-		participation = &TxParticipation{
-			Address: address,
-		}
-		tpt.participations[address] = participation
-	}
-
-	participation.ProcessedTxs += txCount
-	participation.ProcessedGas += gasUsed
-	participation.TotalBlocks++
-	participation.LastUpdateTime = time.Now()
+	// 全网累计记录在零地址下
+	tpt.store.load(statedb, participationPrefix, common.Address{}, &txs, &gas, &blocks, &updated)
+	tpt.store.store(statedb, participationPrefix, common.Address{}, txs+txCount, gas+gasUsed, blocks+1, now)
 }
 
 // GetParticipation 获取参与数据
-func (tpt *TxParticipationTracker) GetParticipation(address common.Address) *TxParticipation {
-	tpt.mu.RLock()
-	defer tpt.mu.RUnlock()
-
-	participation, exists := tpt.participations[address]
-	if !exists {
+func (tpt *TxParticipationTracker) GetParticipation(statedb vm.StateDB, address common.Address) *TxParticipation {
+	var updated uint64
+	participation := &TxParticipation{Address: address}
+	tpt.store.load(statedb, participationPrefix, address, &participation.ProcessedTxs, &participation.ProcessedGas, &participation.TotalBlocks, &updated)
+	if participation.TotalBlocks == 0 {
 		return nil
 	}
-
-	participationCopy := *participation
-	return &participationCopy
+	participation.LastUpdateTime = time.Unix(int64(updated), 0)
+	return participation
 }
 
-// CalculateParticipationScore 计算参与评分
-func (tpt *TxParticipationTracker) CalculateParticipationScore(address common.Address, totalTxs, totalGas uint64) uint64 {
-	tpt.mu.RLock()
-	defer tpt.mu.RUnlock()
-
-	participation, exists := tpt.participations[address]
-	if !exists || totalTxs == 0 {
+// CalculateParticipationScore 计算参与评分：节点在全网交易数和 Gas 中的份额各占 50%（0-10000）
+func (tpt *TxParticipationTracker) CalculateParticipationScore(statedb vm.StateDB, address common.Address) uint64 {
+	participation := tpt.GetParticipation(statedb, address)
+	if participation == nil {
 		return 0
 	}
+	var totalTxs, totalGas uint64
+	tpt.store.load(statedb, participationPrefix, common.Address{}, &totalTxs, &totalGas)
 
-	// 计算交易份额
-	txShare := float64(participation.ProcessedTxs) / float64(totalTxs)
-	if txShare > 1.0 {
-		txShare = 1.0
+	var score uint64
+	if totalTxs > 0 {
+		score += share(participation.ProcessedTxs, totalTxs, bpsDenominator/2)
 	}
-
-	// 计算 Gas 份额
-	gasShare := float64(participation.ProcessedGas) / float64(totalGas)
-	if gasShare > 1.0 {
-		gasShare = 1.0
+	if totalGas > 0 {
+		score += share(participation.ProcessedGas, totalGas, bpsDenominator/2)
 	}
-
-	// 综合评分（50% 交易数 + 50% Gas）
-	score := (txShare*0.5 + gasShare*0.5) * 10000
-
-	return uint64(score)
+	return score
 }
 
-// Reset 重置统计
-func (tpt *TxParticipationTracker) Reset(address common.Address) {
-	tpt.mu.Lock()
-	defer tpt.mu.Unlock()
-
-	delete(tpt.participations, address)
+// share 计算 part/total × scale，结果不超过 scale
+func share(part, total, scale uint64) uint64 {
+	s := mulDiv(uint256.NewInt(min(part, total)), uint256.NewInt(scale), uint256.NewInt(total))
+	return s.Uint64()
 }
@@ -15,8 +15,39 @@ import (
 type SGXExtra struct {
 	SGXQuote      []byte `json:"sgxQuote"`      // 出块节点的 SGX Quote（证明代码完整性）
 	ProducerID    []byte `json:"producerId"`    // 出块节点标识（从 SGX Quote 中提取的公钥哈希）
-	AttestationTS uint64 `json:"attestationTs"` // SGX 证明时间戳
-	Signature     []byte `json:"signature"`     // 区块签名（使用节点私钥签名）
+	AttestationTS uint64 `json:"attestationTs"` // SGX 证明时的区块时间
+	Signature     []byte `json:"signature"`     // 区块签名（签名密钥对封装摘要的签名）
+
+	// 父区块高度的生产者排名（第1名为父区块生产者），用于确定性分配多生产者奖励
+	Ranking []common.Address `json:"ranking" rlp:"optional"`
+
+	// 生产者最近收到的 Quote 签名心跳（按 NodeID 升序），作为在线率的链上证据，
+	// 每条心跳在 verifyHeader 中重新验证
+	Heartbeats []*HeartbeatMessage `json:"heartbeats" rlp:"optional"`
+
+	// 双签证据（按 offenceKey 升序），在 Finalize 中处罚
+	Evidence []*DoubleSignEvidence `json:"evidence" rlp:"optional"`
+
+	// 区块签名公钥（65 字节未压缩格式），由 SGXQuote 证明，Signature 用其签名
+	SigningKey []byte `json:"signingKey" rlp:"optional"`
+	// 被本密钥替换的上一个签名公钥的哈希，首个密钥为零
+	PrevKey common.Hash `json:"prevKey" rlp:"optional"`
+
+	// 检查点区块（高度为 Epoch 的整数倍）记录父区块状态中的白名单哈希和活跃生产者 ID（升序）
+	WhitelistHash common.Hash   `json:"whitelistHash" rlp:"optional"`
+	Producers     []common.Hash `json:"producers" rlp:"optional"`
+
+	// 签名密钥对父区块计算的 VRF 证明，输出记入 MixDigest（见 vrf.go）
+	VRFProof []byte `json:"vrfProof" rlp:"optional"`
+
+	// 排名第2名起各生产者在父区块高度密封的兄弟区块头，与 Ranking[1:] 一一对应，
+	// 证明被排名的生产者确实参与了该高度的竞争
+	RankingProofs []*types.Header `json:"rankingProofs" rlp:"optional"`
+
+	// 检查点区块记录的白名单条目（升序），哈希必须等于 WhitelistHash，
+	// 没有状态的节点据此检查后续区块的 MRENCLAVE/MRSIGNER
+	CheckpointMREnclaves []common.Hash `json:"checkpointMrEnclaves" rlp:"optional"`
+	CheckpointMRSigners  []common.Hash `json:"checkpointMrSigners" rlp:"optional"`
 }
 
 // Encode 序列化 SGX Extra 数据
@@ -96,10 +127,14 @@ type UptimeData struct {
 
 // HeartbeatMessage SGX 签名的心跳消息
 type HeartbeatMessage struct {
-	NodeID    common.Address `json:"nodeId"`
-	Timestamp uint64         `json:"timestamp"`
-	SGXQuote  []byte         `json:"sgxQuote"`  // SGX Quote 证明
-	Signature []byte         `json:"signature"` // 签名
+	NodeID    common.Address   `json:"nodeId"`
+	Timestamp uint64           `json:"timestamp"`
+	Observed  []common.Address `json:"observed"`  // 发送者近期观测到在线的节点
+	SGXQuote  []byte           `json:"sgxQuote"`  // SGX Quote 证明，userData 为 Hash()
+	Signature []byte           `json:"signature"` // 签名
+
+	// 发送者的平台实例 ID，必须等于 Quote 中的平台实例 ID，用于登记生产者
+	ProducerID []byte `json:"producerId" rlp:"optional"`
 }
 
 // TxParticipation 交易参与数据
@@ -111,15 +146,12 @@ type TxParticipation struct {
 	LastUpdateTime time.Time      `json:"lastUpdateTime"`
 }
 
-// ResponseTimeData 响应时间数据
-type ResponseTimeData struct {
-	Address        common.Address `json:"address"`
-	AvgResponseMs  uint64         `json:"avgResponseMs"` // 平均响应时间（毫秒）
-	P50ResponseMs  uint64         `json:"p50ResponseMs"` // P50 响应时间
-	P95ResponseMs  uint64         `json:"p95ResponseMs"` // P95 响应时间
-	P99ResponseMs  uint64         `json:"p99ResponseMs"` // P99 响应时间
-	SampleCount    uint64         `json:"sampleCount"`   // 样本数量
-	LastUpdateTime time.Time      `json:"lastUpdateTime"`
+// ResponseData 响应速度数据
+type ResponseData struct {
+	Address     common.Address `json:"address"`
+	Ranked      uint64         `json:"ranked"`      // 进入排名的次数
+	FirstPlaces uint64         `json:"firstPlaces"` // 获得第1名（区块被链选中）的次数
+	RankPoints  uint64         `json:"rankPoints"`  // 名次得分累计（每次 0-10000）
 }
 
 // PenaltyRecord 惩罚记录
@@ -1,72 +1,80 @@
 package sgx
 
 import (
+	"time"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 // UptimeCalculator 综合在线率计算器
+//
+// 心跳、交易参与和响应评分来自链上状态，进入共识；多节点观测只是本地视图，
+// 用于挑选写入区块的心跳，不计入链上的综合评分。
 type UptimeCalculator struct {
 	config                 *UptimeConfig
 	heartbeatTracker       *HeartbeatTracker
 	uptimeObserver         *UptimeObserver
 	txParticipationTracker *TxParticipationTracker
 	responseTracker        *ResponseTracker
+	heartbeats             *heartbeatPool
+
+	heartbeatWeight     uint64 // 心跳权重（基点）
+	participationWeight uint64 // 交易参与度权重（基点）
+	responseWeight      uint64 // 响应权重（基点）
 }
 
 // NewUptimeCalculator 创建在线率计算器
-func NewUptimeCalculator(config *UptimeConfig) *UptimeCalculator {
+func NewUptimeCalculator(config *UptimeConfig, store *NodeStateStore) *UptimeCalculator {
 	return &UptimeCalculator{
 		config:                 config,
-		heartbeatTracker:       NewHeartbeatTracker(),
+		heartbeatTracker:       NewHeartbeatTracker(store, config.HeartbeatInterval),
 		uptimeObserver:         NewUptimeObserver(config.ConsensusThreshold),
-		txParticipationTracker: NewTxParticipationTracker(),
-		responseTracker:        NewResponseTracker(),
+		txParticipationTracker: NewTxParticipationTracker(store),
+		responseTracker:        NewResponseTracker(store),
+		heartbeats:             newHeartbeatPool(),
+		heartbeatWeight:        toBps(config.HeartbeatWeight, 100),
+		participationWeight:    toBps(config.TxParticipationWeight, 100),
+		responseWeight:         toBps(config.ResponseWeight, 100),
 	}
 }
 
-// CalculateUptimeScore 计算综合在线率评分
-// networkObservers: 网络中的总观测者数量
-// networkTotalTxs: 网络总交易数
-// networkTotalGas: 网络总 Gas 使用量
-func (uc *UptimeCalculator) CalculateUptimeScore(
-	address common.Address,
-	networkObservers int,
-	networkTotalTxs uint64,
-	networkTotalGas uint64,
-) *UptimeData {
-	// 1. SGX 心跳评分（40%）
-	heartbeatScore := uc.heartbeatTracker.CalculateHeartbeatScore(address, uc.config.HeartbeatInterval)
-
-	// 2. 多节点共识评分（30%）
-	consensusScore := uc.uptimeObserver.CalculateConsensusScore(address, networkObservers)
-
-	// 3. 交易参与度评分（20%）
-	txParticipationScore := uc.txParticipationTracker.CalculateParticipationScore(address, networkTotalTxs, networkTotalGas)
-
-	// 4. 响应时间评分（10%）
-	responseScore := uc.responseTracker.CalculateResponseScore(address, uc.config.ResponseTimeTarget)
-
-	// 计算综合评分
-	comprehensiveScore := uint64(
-		float64(heartbeatScore)*uc.config.HeartbeatWeight/100.0 +
-			float64(consensusScore)*uc.config.ConsensusWeight/100.0 +
-			float64(txParticipationScore)*uc.config.TxParticipationWeight/100.0 +
-			float64(responseScore)*uc.config.ResponseWeight/100.0,
-	)
+// CalculateUptimeScore 根据链上状态计算综合在线率评分
+func (uc *UptimeCalculator) CalculateUptimeScore(statedb vm.StateDB, address common.Address) *UptimeData {
+	// 1. SGX 心跳评分
+	heartbeatScore := uc.heartbeatTracker.CalculateHeartbeatScore(statedb, address)
+
+	// 2. 交易参与度评分
+	txParticipationScore := uc.txParticipationTracker.CalculateParticipationScore(statedb, address)
+
+	// 3. 响应评分
+	responseScore := uc.responseTracker.CalculateResponseScore(statedb, address)
 
+	// 按链上分项的权重归一化计算综合评分
+	var comprehensiveScore uint64
+	if total := uc.heartbeatWeight + uc.participationWeight + uc.responseWeight; total > 0 {
+		comprehensiveScore = (heartbeatScore*uc.heartbeatWeight +
+			txParticipationScore*uc.participationWeight +
+			responseScore*uc.responseWeight) / total
+	}
+	var lastUpdate time.Time
+	if record := uc.heartbeatTracker.GetHeartbeatRecord(statedb, address); record != nil {
+		lastUpdate = record.LastHeartbeat
+	}
 	return &UptimeData{
 		Address:              address,
 		HeartbeatScore:       heartbeatScore,
-		ConsensusScore:       consensusScore,
 		TxParticipationScore: txParticipationScore,
 		ResponseScore:        responseScore,
 		ComprehensiveScore:   comprehensiveScore,
+		LastUpdateTime:       lastUpdate,
 	}
 }
 
-// RecordHeartbeat 记录心跳
+// RecordHeartbeat 记录收到的已验证心跳，等待写入区块
 func (uc *UptimeCalculator) RecordHeartbeat(msg *HeartbeatMessage) error {
-	return uc.heartbeatTracker.RecordHeartbeat(msg)
+	uc.heartbeats.add(msg, time.Now())
+	return nil
 }
 
 // RecordObservation 记录观测
@@ -74,12 +82,33 @@ func (uc *UptimeCalculator) RecordObservation(observed, observer common.Address)
 	uc.uptimeObserver.RecordObservation(observed, observer)
 }
 
+// ActiveObservers 返回观测窗口内有心跳的节点数量，作为共识评分的观测者总数
+func (uc *UptimeCalculator) ActiveObservers() int {
+	return uc.heartbeats.count(time.Now().Add(-observationWindow))
+}
+
+// ConsensusScore 返回本地观测到的多节点共识评分
+func (uc *UptimeCalculator) ConsensusScore(address common.Address) uint64 {
+	return uc.uptimeObserver.CalculateConsensusScore(address, uc.ActiveObservers())
+}
+
+// PendingHeartbeats 返回写入区块时间为 now 的新区块的心跳，
+// 心跳时间戳必须在 heartbeatMaxAge 之内，最多 MaxHeartbeatsPerBlock 条
+func (uc *UptimeCalculator) PendingHeartbeats(now uint64) []*HeartbeatMessage {
+	return uc.heartbeats.pending(now-min(now, uc.heartbeatMaxAge()), now, MaxHeartbeatsPerBlock)
+}
+
+// heartbeatMaxAge 区块可以携带的心跳的最大时间差（秒），为两个心跳间隔
+func (uc *UptimeCalculator) heartbeatMaxAge() uint64 {
+	return 2 * uc.heartbeatTracker.interval
+}
+
 // RecordTxParticipation 记录交易参与
-func (uc *UptimeCalculator) RecordTxParticipation(address common.Address, txCount, gasUsed uint64) {
-	uc.txParticipationTracker.RecordParticipation(address, txCount, gasUsed)
+func (uc *UptimeCalculator) RecordTxParticipation(statedb vm.StateDB, address common.Address, txCount, gasUsed, now uint64) {
+	uc.txParticipationTracker.RecordParticipation(statedb, address, txCount, gasUsed, now)
 }
 
-// RecordResponseTime 记录响应时间
-func (uc *UptimeCalculator) RecordResponseTime(address common.Address, responseMs uint64) {
-	uc.responseTracker.RecordResponse(address, responseMs)
+// RecordResponse 记录节点在一个高度的排名
+func (uc *UptimeCalculator) RecordResponse(statedb vm.StateDB, address common.Address, rank int, points uint64) {
+	uc.responseTracker.RecordResponse(statedb, address, rank, points)
 }
@@ -7,6 +7,9 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 )
 
+// observationWindow 观测有效期，超过该时间的观测不计入共识评分
+const observationWindow = 5 * time.Minute
+
 // UptimeObserver 多节点在线率观测器
 type UptimeObserver struct {
 	mu           sync.RWMutex
@@ -46,10 +49,9 @@ func (uo *UptimeObserver) CalculateConsensusScore(address common.Address, totalO
 	// 计算最近看到该节点的观测者数量
 	recentCount := 0
 	now := time.Now()
-	recentWindow := 5 * time.Minute
 
 	for _, lastSeen := range observations {
-		if now.Sub(lastSeen) < recentWindow {
+		if now.Sub(lastSeen) < observationWindow {
 			recentCount++
 		}
 	}
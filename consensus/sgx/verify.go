@@ -4,17 +4,13 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math/big"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
-)
-
-const (
-	// MinExtraDataLength 最小 Extra 数据长度
-	MinExtraDataLength = 32
-	// MaxExtraDataLength 最大 Extra 数据长度
-	MaxExtraDataLength = 1024 * 10 // 10KB
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // Verifier 区块验证器
@@ -37,7 +33,7 @@ func (v *BlockVerifier) VerifyBlock(chain consensus.ChainHeaderReader, block *ty
 	}
 
 	// 验证区块体
-	if err := v.verifyBody(block); err != nil {
+	if err := v.verifyBody(chain, block); err != nil {
 		return err
 	}
 
@@ -45,21 +41,10 @@ func (v *BlockVerifier) VerifyBlock(chain consensus.ChainHeaderReader, block *ty
 }
 
 // verifyBody 验证区块体
-func (v *BlockVerifier) verifyBody(block *types.Block) error {
-	// 验证交易数量
-	if len(block.Transactions()) > v.engine.config.MaxTxPerBlock {
-		return fmt.Errorf("too many transactions: %d > %d",
-			len(block.Transactions()), v.engine.config.MaxTxPerBlock)
-	}
-
-	// 验证 Gas 总量
-	totalGas := uint64(0)
-	for _, tx := range block.Transactions() {
-		totalGas += tx.Gas()
-	}
-	if totalGas > v.engine.config.MaxGasPerBlock {
-		return fmt.Errorf("total gas exceeds limit: %d > %d",
-			totalGas, v.engine.config.MaxGasPerBlock)
+func (v *BlockVerifier) verifyBody(chain consensus.ChainHeaderReader, block *types.Block) error {
+	// 验证交易数量和 Gas，限制由父区块状态中的治理参数决定
+	if err := v.engine.verifyBlockLimits(chain, block); err != nil {
+		return err
 	}
 
 	// 验证叔块（PoA-SGX 不允许叔块）
@@ -70,27 +55,6 @@ func (v *BlockVerifier) verifyBody(block *types.Block) error {
 	return nil
 }
 
-// verifyBasic 基本验证
-func (e *SGXEngine) verifyBasic(header *types.Header) error {
-	// 验证区块号
-	if header.Number == nil {
-		return errors.New("block number is nil")
-	}
-
-	// 验证 Extra 字段长度
-	if len(header.Extra) < MinExtraDataLength {
-		return fmt.Errorf("extra data too short: %d < %d",
-			len(header.Extra), MinExtraDataLength)
-	}
-
-	if len(header.Extra) > MaxExtraDataLength {
-		return fmt.Errorf("extra data too long: %d > %d",
-			len(header.Extra), MaxExtraDataLength)
-	}
-
-	return nil
-}
-
 // verifyTimestamp 验证时间戳
 func (e *SGXEngine) verifyTimestamp(header, parent *types.Header) error {
 	// 区块时间必须大于父区块
@@ -106,66 +70,125 @@ func (e *SGXEngine) verifyTimestamp(header, parent *types.Header) error {
 	return nil
 }
 
-// verifyQuote 验证 SGX Quote
-func (e *SGXEngine) verifyQuote(header *types.Header) error {
-	extra, err := DecodeSGXExtra(header.Extra)
-	if err != nil {
-		return fmt.Errorf("failed to decode extra data: %w", err)
+// verifySeal 无状态验证区块封装：Quote 有效且属于 ProducerID，reportData 绑定签名公钥、
+// 链 ID 和证明时间戳，Quote 相对区块时间未过期，签名覆盖封装摘要
+func (e *SGXEngine) verifySeal(chainID *big.Int, header *types.Header, extra *SGXExtra) error {
+	// 完整的Quote验证（匹配gramine sgx-quote-verify.js的verifyQuote()逻辑），结果按 Quote 哈希缓存
+	// 白名单由 verifyHeader 按父区块状态（或已加载的白名单）单独检查，这里跳过验证器的当前白名单。
+	// 证书和抵押品按证明时间戳验证，而不是当前时间，历史区块在抵押品过期后仍可验证
+	quoteHash := crypto.Keccak256Hash(extra.SGXQuote)
+	instanceID, ok := e.quotes.Get(quoteHash)
+	if !ok {
+		result, err := e.verifier.VerifyQuoteComplete(extra.SGXQuote, map[string]interface{}{
+			"skipWhitelist": true,
+			"verifyTime":    time.Unix(int64(extra.AttestationTS), 0),
+		})
+		if err != nil {
+			return fmt.Errorf("quote verification failed: %w", err)
+		}
+		if !result.Verified {
+			return ErrQuoteVerificationFailed
+		}
+		instanceID = common.CopyBytes(result.Measurements.PlatformInstanceID[:])
+		e.quotes.Add(quoteHash, instanceID)
 	}
-
-	// 验证 Quote
-	if err := e.verifier.VerifyQuote(extra.SGXQuote); err != nil {
+	// 验证ProducerID：应该等于从Quote验证中返回的PlatformInstanceID
+	// 这确保一个物理CPU只能作为一个生产者，防止Sybil攻击
+	if len(extra.ProducerID) == 0 || !bytes.Equal(instanceID, extra.ProducerID) {
+		return fmt.Errorf("producer ID mismatch: quote=%x, extra=%x", instanceID, extra.ProducerID)
+	}
+	// Quote 证明的是签名密钥，而不是某个区块
+	if err := e.checkQuoteUserData(extra.SGXQuote, keyBinding(chainID, extra.SigningKey, extra.AttestationTS, extra.PrevKey)); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidSGXQuote, err)
 	}
-
-	// 验证 Quote 中的 ProducerID
-	producerID, err := e.verifier.ExtractProducerID(extra.SGXQuote)
-	if err != nil {
-		return fmt.Errorf("failed to extract producer ID: %w", err)
+	// 证明时间戳相对区块时间不能太旧，也不能晚于区块
+	if extra.AttestationTS > header.Time {
+		return fmt.Errorf("%w: attested at %d, block time %d", ErrAttestationTooOld, extra.AttestationTS, header.Time)
 	}
-
-	if !bytes.Equal(producerID, extra.ProducerID) {
-		return fmt.Errorf("producer ID mismatch: quote=%x, extra=%x",
-			producerID, extra.ProducerID)
+	if header.Time-extra.AttestationTS > uint64(e.config.MaxAttestationAge/time.Second) {
+		return fmt.Errorf("%w: attested at %d, block time %d", ErrAttestationTooOld, extra.AttestationTS, header.Time)
 	}
-
-	// 验证证明时间戳（不能太旧）
-	now := uint64(time.Now().Unix())
-	maxAge := uint64(3600) // 1小时
-	if now > extra.AttestationTS+maxAge {
-		return ErrAttestationTooOld
+	// 区块签名
+	if err := e.verifier.VerifySignature(e.sealDigest(chainID, header).Bytes(), extra.Signature, extra.SigningKey); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
 	}
+	// 区块随机数
+	return verifyRandomness(chainID, header, extra)
+}
 
-	return nil
+// keyChainLookback 检查签名密钥链时向前查找同一生产者区块的最大区块数
+const keyChainLookback = 64
+
+// signingKeyInfo 区块头中的签名密钥信息
+type signingKeyInfo struct {
+	producer common.Address
+	key      common.Hash // 签名公钥哈希
+	prev     common.Hash
+	attested uint64
 }
 
-// verifySignatureInternal 验证区块签名
-func (e *SGXEngine) verifySignatureInternal(header *types.Header) error {
+// signingKeyOf 返回区块头的签名密钥信息，按区块哈希缓存
+func (e *SGXEngine) signingKeyOf(header *types.Header) (signingKeyInfo, bool) {
+	hash := header.Hash()
+	if info, ok := e.signingKeys.Get(hash); ok {
+		return info, true
+	}
 	extra, err := DecodeSGXExtra(header.Extra)
-	if err != nil {
-		return err
+	if err != nil || len(extra.ProducerID) == 0 {
+		return signingKeyInfo{}, false
 	}
-
-	// 计算签名哈希
-	sigHash := e.SealHash(header)
-
-	// 验证签名
-	if err := e.verifier.VerifySignature(sigHash.Bytes(), extra.Signature, extra.ProducerID); err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	info := signingKeyInfo{
+		producer: nodeAddress(extra.ProducerID),
+		key:      crypto.Keccak256Hash(extra.SigningKey),
+		prev:     extra.PrevKey,
+		attested: extra.AttestationTS,
 	}
+	e.signingKeys.Add(hash, info)
+	return info, true
+}
 
+// verifyKeyChain 验证生产者签名密钥的连续性：在最近 keyChainLookback 个祖先区块中找到同一生产者的
+// 上一个区块，证明时间戳不能倒退（轮换后旧密钥作废），更换密钥时新的 Quote 必须晚于旧的，
+// 且 PrevKey 指向旧密钥。只有窗口内没有同一生产者的区块时才不检查 PrevKey，窗口内祖先缺失时返回错误。
+// parents 为 VerifyHeaders 中同批次、尚未写入链的祖先区块头
+func (e *SGXEngine) verifyKeyChain(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	info, ok := e.signingKeyOf(header)
+	if !ok {
+		return ErrInvalidExtra
+	}
+	hash, number := header.ParentHash, header.Number.Uint64()-1
+	for i := 0; i < keyChainLookback && number > 0; i++ {
+		var ancestor *types.Header
+		if len(parents) > 0 && parents[len(parents)-1].Hash() == hash {
+			ancestor, parents = parents[len(parents)-1], parents[:len(parents)-1]
+		} else {
+			ancestor = chain.GetHeader(hash, number)
+		}
+		if ancestor == nil {
+			return consensus.ErrUnknownAncestor
+		}
+		if prev, ok := e.signingKeyOf(ancestor); ok && prev.producer == info.producer {
+			switch {
+			case info.attested < prev.attested:
+				return fmt.Errorf("%w: attestation %d older than %d in block %d", ErrInvalidKeyChain, info.attested, prev.attested, number)
+			case info.key == prev.key:
+				return nil
+			case info.attested == prev.attested:
+				return fmt.Errorf("%w: two keys attested at %d", ErrInvalidKeyChain, info.attested)
+			case info.prev != prev.key:
+				return fmt.Errorf("%w: key replaces %x, previous key %x", ErrInvalidKeyChain, info.prev, prev.key)
+			}
+			return nil
+		}
+		hash, number = ancestor.ParentHash, number-1
+	}
 	return nil
 }
 
 // VerifyHeaderChain 验证区块头链
 func (e *SGXEngine) VerifyHeaderChain(chain consensus.ChainHeaderReader, headers []*types.Header) error {
 	for i, header := range headers {
-		var parent *types.Header
-		if i > 0 {
-			parent = headers[i-1]
-		}
-
-		if err := e.verifyHeader(chain, header, parent); err != nil {
+		if err := e.verifyHeader(chain, header, headers[:i]); err != nil {
 			return fmt.Errorf("header %d validation failed: %w", i, err)
 		}
 	}
@@ -12,24 +12,15 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 )
 
-// verifyQuoteUserData verifies that Quote userData matches the block's sealHash.
+// checkQuoteUserData verifies that the first 32 bytes of the Quote userData
+// equal expected.
 // Production version: strictly enforces userData matching.
-func (e *SGXEngine) verifyQuoteUserData(block *types.Block) error {
-	header := block.Header()
-	extra, err := DecodeSGXExtra(header.Extra)
-	if err != nil {
-		return ErrInvalidExtra
-	}
-	
-	// Calculate seal hash
-	sealHash := e.SealHash(header)
-	
+func (e *SGXEngine) checkQuoteUserData(quote []byte, expected common.Hash) error {
 	// Extract userData from Quote
-	userData, err := e.verifier.ExtractQuoteUserData(extra.SGXQuote)
+	userData, err := e.verifier.ExtractQuoteUserData(quote)
 	if err != nil {
 		return errors.New("failed to extract userData from Quote")
 	}
@@ -40,13 +31,11 @@ func (e *SGXEngine) verifyQuoteUserData(block *types.Block) error {
 	}
 	
 	// Production mode: strictly enforce userData matching
-	if !bytes.Equal(userData[:32], sealHash.Bytes()) {
+	if !bytes.Equal(userData[:32], expected.Bytes()) {
 		log.Error("Quote userData mismatch",
-			"expected", sealHash.Hex(),
+			"expected", expected.Hex(),
 			"got", common.BytesToHash(userData[:32]).Hex())
-		return errors.New("Quote userData does not match seal hash - possible tampering")
+		return errors.New("Quote userData does not match signed hash - possible tampering")
 	}
-	
-	log.Debug("✓ Quote userData verified", "sealHash", sealHash.Hex())
 	return nil
 }
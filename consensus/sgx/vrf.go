@@ -0,0 +1,233 @@
+package sgx
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 区块随机数
+//
+// 生产者用已证明的区块签名密钥计算 VRF（ECVRF-SECP256K1-SHA256-TAI，结构同 RFC 9381，suite 0xfe）：
+//
+//	alpha     = "sgx-vrf-v1" ++ chainID ++ parentHash ++ number
+//	VRFProof  = Gamma(33 字节压缩点) ++ c(16 字节) ++ s(32 字节)
+//	MixDigest = beta = sha256(suite ++ 0x03 ++ Gamma ++ 0x00)
+//
+// 输出在封装前无法预测（需要 enclave 内的私钥），对给定密钥和父区块唯一，生产者无法挑选。
+// 验证者用 SigningKey 验证证明并检查 MixDigest，EVM 中的 SGXRandom 预编译合约以其为种子。
+
+// VRFProofLength VRF 证明长度
+const VRFProofLength = 33 + 16 + 32
+
+const vrfSuite = 0xfe
+
+var vrfDomain = []byte("sgx-vrf-v1")
+
+// VRFInput 返回区块 VRF 的输入
+func VRFInput(chainID *big.Int, parentHash common.Hash, number uint64) []byte {
+	input := append(common.CopyBytes(vrfDomain), common.BigToHash(chainID).Bytes()...)
+	input = append(input, parentHash.Bytes()...)
+	return append(input, new(big.Int).SetUint64(number).FillBytes(make([]byte, 8))...)
+}
+
+// compressPoint 返回曲线点的 33 字节压缩格式
+func compressPoint(x, y *big.Int) []byte {
+	return crypto.CompressPubkey(&ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y})
+}
+
+// vrfHashToCurve 用 try-and-increment 将输入映射到曲线点
+func vrfHashToCurve(publicKey []byte, alpha []byte) (*big.Int, *big.Int, error) {
+	for ctr := 0; ctr < 256; ctr++ {
+		h := sha256.New()
+		h.Write([]byte{vrfSuite, 0x01})
+		h.Write(publicKey)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), 0x00})
+		point, err := crypto.DecompressPubkey(append([]byte{0x02}, h.Sum(nil)...))
+		if err == nil {
+			return point.X, point.Y, nil
+		}
+	}
+	return nil, nil, errors.New("vrf: hash to curve failed")
+}
+
+// vrfChallenge 计算 16 字节挑战值 c
+func vrfChallenge(points ...[]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x02})
+	for _, p := range points {
+		h.Write(p)
+	}
+	h.Write([]byte{0x00})
+	return h.Sum(nil)[:16]
+}
+
+// vrfOutput 由 Gamma 计算 VRF 输出
+func vrfOutput(gamma []byte) common.Hash {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x03})
+	h.Write(gamma)
+	h.Write([]byte{0x00})
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// vrfProve 计算 VRF 证明和输出
+func vrfProve(key *ecdsa.PrivateKey, alpha []byte) ([]byte, common.Hash, error) {
+	var (
+		curve  = crypto.S256()
+		n      = curve.Params().N
+		x      = math.PaddedBigBytes(key.D, 32)
+		pubKey = compressPoint(key.PublicKey.X, key.PublicKey.Y)
+	)
+	hx, hy, err := vrfHashToCurve(pubKey, alpha)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	gx, gy := curve.ScalarMult(hx, hy, x)
+	gamma := compressPoint(gx, gy)
+
+	// 确定性随机数 k = HMAC-SHA256(私钥, H)，只用于证明，不影响输出
+	mac := hmac.New(sha256.New, x)
+	mac.Write(compressPoint(hx, hy))
+	k := new(big.Int).SetBytes(mac.Sum(nil))
+	k.Mod(k, n)
+	if k.Sign() == 0 {
+		return nil, common.Hash{}, errors.New("vrf: invalid nonce")
+	}
+	ux, uy := curve.ScalarBaseMult(math.PaddedBigBytes(k, 32))
+	vx, vy := curve.ScalarMult(hx, hy, math.PaddedBigBytes(k, 32))
+	c := vrfChallenge(pubKey, compressPoint(hx, hy), gamma, compressPoint(ux, uy), compressPoint(vx, vy))
+
+	// s = k + c*x mod n
+	s := new(big.Int).Mul(new(big.Int).SetBytes(c), key.D)
+	s.Add(s, k)
+	s.Mod(s, n)
+
+	proof := make([]byte, 0, VRFProofLength)
+	proof = append(proof, gamma...)
+	proof = append(proof, c...)
+	proof = append(proof, math.PaddedBigBytes(s, 32)...)
+	return proof, vrfOutput(gamma), nil
+}
+
+// VerifyVRF 验证 VRF 证明，返回 VRF 输出。publicKey 为 65 字节未压缩或 33 字节压缩公钥
+func VerifyVRF(publicKey []byte, alpha []byte, proof []byte) (common.Hash, error) {
+	if len(proof) != VRFProofLength {
+		return common.Hash{}, errors.New("vrf: invalid proof length")
+	}
+	var (
+		pub *ecdsa.PublicKey
+		err error
+	)
+	if len(publicKey) == 33 {
+		pub, err = crypto.DecompressPubkey(publicKey)
+	} else {
+		pub, err = crypto.UnmarshalPubkey(publicKey)
+	}
+	if err != nil {
+		return common.Hash{}, errors.New("vrf: invalid public key")
+	}
+	gammaPoint, err := crypto.DecompressPubkey(proof[:33])
+	if err != nil {
+		return common.Hash{}, errors.New("vrf: invalid gamma")
+	}
+	var (
+		curve  = crypto.S256()
+		n      = curve.Params().N
+		c      = new(big.Int).SetBytes(proof[33:49])
+		s      = new(big.Int).SetBytes(proof[49:])
+		pubKey = compressPoint(pub.X, pub.Y)
+	)
+	if s.Cmp(n) >= 0 {
+		return common.Hash{}, errors.New("vrf: invalid scalar")
+	}
+	hx, hy, err := vrfHashToCurve(pubKey, alpha)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	// U = s*G - c*Y, V = s*H - c*Gamma
+	var (
+		negC     = math.PaddedBigBytes(new(big.Int).Sub(n, c), 32)
+		sGx, sGy = curve.ScalarBaseMult(math.PaddedBigBytes(s, 32))
+		cYx, cYy = curve.ScalarMult(pub.X, pub.Y, negC)
+		sHx, sHy = curve.ScalarMult(hx, hy, math.PaddedBigBytes(s, 32))
+		cGx, cGy = curve.ScalarMult(gammaPoint.X, gammaPoint.Y, negC)
+	)
+	if sGx == nil || cYx == nil || sHx == nil || cGx == nil {
+		return common.Hash{}, errors.New("vrf: invalid proof")
+	}
+	ux, uy := curve.Add(sGx, sGy, cYx, cYy)
+	vx, vy := curve.Add(sHx, sHy, cGx, cGy)
+
+	expected := vrfChallenge(pubKey, compressPoint(hx, hy), proof[:33], compressPoint(ux, uy), compressPoint(vx, vy))
+	if !hmac.Equal(expected, proof[33:49]) {
+		return common.Hash{}, errors.New("vrf: invalid proof")
+	}
+	return vrfOutput(proof[:33]), nil
+}
+
+// prepareRandomness 用区块时间可用的签名密钥计算 VRF，写入 VRFProof 和 MixDigest。
+// 必须在执行交易前调用，Seal 使用同一个签名密钥
+func (e *SGXEngine) prepareRandomness(chain consensus.ChainHeaderReader, header *types.Header, extra *SGXExtra) error {
+	key, err := e.currentSigningKey(chain, header)
+	if err != nil {
+		return err
+	}
+	chainID := chain.Config().ChainID
+	proof, beta, err := vrfProve(key.key, VRFInput(chainID, header.ParentHash, header.Number.Uint64()))
+	if err != nil {
+		return err
+	}
+	extra.VRFProof = proof
+	header.MixDigest = beta
+	return nil
+}
+
+// verifyRandomness 用区块的签名公钥验证 VRF 证明，并检查 MixDigest 为其输出
+func verifyRandomness(chainID *big.Int, header *types.Header, extra *SGXExtra) error {
+	beta, err := VerifyVRF(extra.SigningKey, VRFInput(chainID, header.ParentHash, header.Number.Uint64()), extra.VRFProof)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMixDigest, err)
+	}
+	if beta != header.MixDigest {
+		return fmt.Errorf("%w: have %x, want %x", ErrInvalidMixDigest, header.MixDigest, beta)
+	}
+	return nil
+}
+
+// BlockRandomness 区块随机数及其 VRF 证明，供链下验证 SGXRandom 的输出
+type BlockRandomness struct {
+	Number     uint64        `json:"number"`
+	Hash       common.Hash   `json:"hash"`
+	Input      hexutil.Bytes `json:"input"`      // VRF 输入 alpha
+	Proof      hexutil.Bytes `json:"proof"`      // VRF 证明
+	SigningKey hexutil.Bytes `json:"signingKey"` // 区块签名公钥，由 SGXQuote 证明
+	Output     common.Hash   `json:"output"`     // VRF 输出，即 MixDigest
+}
+
+// blockRandomness 返回区块头中的随机数及其证明
+func blockRandomness(chainID *big.Int, header *types.Header) (*BlockRandomness, error) {
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockRandomness{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash(),
+		Input:      VRFInput(chainID, header.ParentHash, header.Number.Uint64()),
+		Proof:      extra.VRFProof,
+		SigningKey: extra.SigningKey,
+		Output:     header.MixDigest,
+	}, nil
+}
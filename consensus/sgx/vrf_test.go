@@ -0,0 +1,93 @@
+package sgx
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVRFProveVerify(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	publicKey := crypto.FromECDSAPub(&key.PublicKey)
+	alpha := VRFInput(common.Big1, common.Hash{0x01}, 1)
+
+	proof, beta, err := vrfProve(key, alpha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof) != VRFProofLength {
+		t.Fatalf("proof length: got %d, want %d", len(proof), VRFProofLength)
+	}
+	for _, pub := range [][]byte{publicKey, crypto.CompressPubkey(&key.PublicKey)} {
+		output, err := VerifyVRF(pub, alpha, proof)
+		if err != nil || output != beta {
+			t.Fatalf("valid proof rejected: output %x, err %v", output, err)
+		}
+	}
+	// The output is unique for the key and input
+	again, second, _ := vrfProve(key, alpha)
+	if second != beta || string(again) != string(proof) {
+		t.Error("proof is not deterministic")
+	}
+	if _, other, _ := vrfProve(key, VRFInput(common.Big1, common.Hash{0x02}, 1)); other == beta {
+		t.Error("different inputs produce the same output")
+	}
+	// Proofs do not verify for another input, another key or when modified
+	if _, err := VerifyVRF(publicKey, VRFInput(common.Big2, common.Hash{0x01}, 1), proof); err == nil {
+		t.Error("proof accepted for another input")
+	}
+	otherKey, _ := crypto.GenerateKey()
+	if _, err := VerifyVRF(crypto.FromECDSAPub(&otherKey.PublicKey), alpha, proof); err == nil {
+		t.Error("proof accepted for another key")
+	}
+	for _, i := range []int{0, 40, VRFProofLength - 1} {
+		tampered := common.CopyBytes(proof)
+		tampered[i] ^= 0x01
+		if _, err := VerifyVRF(publicKey, alpha, tampered); err == nil {
+			t.Errorf("proof modified at byte %d accepted", i)
+		}
+	}
+}
+
+// Tests that sealed blocks commit to the VRF output of their signing key.
+func TestSealRandomness(t *testing.T) {
+	var (
+		engine  = newSealTestEngine()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		chain   = &whitelistTestChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+		chainID = chain.Config().ChainID
+		now     = uint64(time.Now().Unix())
+	)
+	header := sealTestHeader(t, engine, chain, genesis, now)
+	extra, _ := DecodeSGXExtra(header.Extra)
+
+	// The randomness verifies off-chain from the published proof
+	randomness, err := blockRandomness(chainID, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := VerifyVRF(randomness.SigningKey, randomness.Input, randomness.Proof)
+	if err != nil || output != header.MixDigest || output == (common.Hash{}) {
+		t.Fatalf("mix digest %x does not match VRF output %x (err %v)", header.MixDigest, output, err)
+	}
+	// The producer cannot choose the randomness
+	chosen := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Time: now, Difficulty: big.NewInt(1), MixDigest: common.Hash{0x01}}
+	if err := engine.signHeader(chainID, chosen, engine.sealKey, &SGXExtra{VRFProof: extra.VRFProof}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.VerifyHeader(chain, chosen); !errors.Is(err, ErrInvalidMixDigest) {
+		t.Errorf("chosen mix digest: expected ErrInvalidMixDigest, got %v", err)
+	}
+	// Seal refuses blocks whose randomness its key did not produce
+	forged := types.CopyHeader(header)
+	forged.Extra, _ = (&SGXExtra{VRFProof: extra.VRFProof[:VRFProofLength-1]}).Encode()
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, types.NewBlockWithHeader(forged), results, nil); !errors.Is(err, ErrInvalidMixDigest) {
+		t.Errorf("invalid VRF proof sealed: %v", err)
+	}
+}
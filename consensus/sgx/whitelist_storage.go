@@ -0,0 +1,194 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Storage layout of the whitelist in the security config contract, following
+// the Solidity layout rules:
+//
+//	slot 0: mapping(bytes32 => bool) allowedMREnclaves
+//	slot 1: mapping(bytes32 => bool) allowedMRSigners
+//	slot 2: bytes32[] mrEnclaveList
+//	slot 3: bytes32[] mrSignerList
+//
+// Mappings cannot be enumerated, so every value ever allowed is also appended
+// to the matching list. An entry is part of the whitelist if it appears in the
+// list and its mapping slot is non-zero; removals only clear the mapping slot.
+// The lists are therefore mandatory: a value set only in a mapping is never
+// loaded, and a genesis allocation holding storage without any list entry is
+// rejected with ErrWhitelistNotListed.
+const (
+	allowedMREnclavesSlot = 0
+	allowedMRSignersSlot  = 1
+	mrEnclaveListSlot     = 2
+	mrSignerListSlot      = 3
+
+	// maxWhitelistEntries bounds how many list entries are read per list, so
+	// a corrupted length cannot make whitelist loading unbounded.
+	maxWhitelistEntries = 4096
+)
+
+// storageReader returns the value of a storage slot of the whitelist contract.
+type storageReader func(slot common.Hash) common.Hash
+
+// whitelistMappingSlot returns the storage slot of key in the mapping at
+// slot, i.e. keccak256(abi.encode(key, slot)).
+func whitelistMappingSlot(key common.Hash, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), common.BigToHash(new(big.Int).SetUint64(slot)).Bytes())
+}
+
+// whitelistListSlot returns the storage slot of element index of the dynamic
+// array at slot, i.e. keccak256(abi.encode(slot)) + index.
+func whitelistListSlot(slot uint64, index uint64) common.Hash {
+	base := crypto.Keccak256Hash(common.BigToHash(new(big.Int).SetUint64(slot)).Bytes()).Big()
+	return common.BigToHash(base.Add(base, new(big.Int).SetUint64(index)))
+}
+
+// readWhitelistEntries returns the entries of the list at listSlot whose flag
+// in the mapping at mapSlot is set, in list order and without duplicates.
+func readWhitelistEntries(read storageReader, mapSlot, listSlot uint64) []common.Hash {
+	length := read(common.BigToHash(new(big.Int).SetUint64(listSlot))).Big()
+	if !length.IsUint64() || length.Uint64() > maxWhitelistEntries {
+		length.SetUint64(maxWhitelistEntries)
+	}
+	var (
+		entries []common.Hash
+		seen    = make(map[common.Hash]bool)
+	)
+	for i := uint64(0); i < length.Uint64(); i++ {
+		entry := read(whitelistListSlot(listSlot, i))
+		if seen[entry] || read(whitelistMappingSlot(entry, mapSlot)) == (common.Hash{}) {
+			continue
+		}
+		seen[entry] = true
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// readWhitelist decodes the MRENCLAVE and MRSIGNER whitelist from storage.
+func readWhitelist(read storageReader) GenesisWhitelist {
+	whitelist := GenesisWhitelist{
+		MREnclaves: []string{},
+		MRSigners:  []string{},
+	}
+	for _, entry := range readWhitelistEntries(read, allowedMREnclavesSlot, mrEnclaveListSlot) {
+		whitelist.MREnclaves = append(whitelist.MREnclaves, entry.Hex())
+	}
+	for _, entry := range readWhitelistEntries(read, allowedMRSignersSlot, mrSignerListSlot) {
+		whitelist.MRSigners = append(whitelist.MRSigners, entry.Hex())
+	}
+	return whitelist
+}
+
+// ReadWhitelistFromAlloc decodes the whitelist from the genesis allocation of
+// the security config contract. It fails if the contract has storage but both
+// lists are empty, as a whitelist written only to the mappings cannot be read.
+func ReadWhitelistFromAlloc(alloc types.GenesisAlloc, contract common.Address) (GenesisWhitelist, error) {
+	account := alloc[contract]
+	read := func(slot common.Hash) common.Hash {
+		return account.Storage[slot]
+	}
+	if len(account.Storage) > 0 &&
+		read(common.BigToHash(big.NewInt(mrEnclaveListSlot))) == (common.Hash{}) &&
+		read(common.BigToHash(big.NewInt(mrSignerListSlot))) == (common.Hash{}) {
+		return GenesisWhitelist{}, ErrWhitelistNotListed
+	}
+	return readWhitelist(read), nil
+}
+
+// ReadWhitelistFromState decodes the whitelist from the security config
+// contract storage in the given state.
+func ReadWhitelistFromState(statedb vm.StateDB, contract common.Address) GenesisWhitelist {
+	return readWhitelist(func(slot common.Hash) common.Hash {
+		return statedb.GetState(contract, slot)
+	})
+}
+
+// WhitelistStorage returns the storage of a security config contract allowing
+// exactly the given measurements, for use in a genesis allocation.
+func WhitelistStorage(mrenclaves, mrsigners []common.Hash) map[common.Hash]common.Hash {
+	storage := make(map[common.Hash]common.Hash)
+	one := common.BigToHash(common.Big1)
+
+	add := func(entries []common.Hash, mapSlot, listSlot uint64) {
+		for i, entry := range entries {
+			storage[whitelistMappingSlot(entry, mapSlot)] = one
+			storage[whitelistListSlot(listSlot, uint64(i))] = entry
+		}
+		if len(entries) > 0 {
+			storage[common.BigToHash(new(big.Int).SetUint64(listSlot))] = common.BigToHash(big.NewInt(int64(len(entries))))
+		}
+	}
+	add(mrenclaves, allowedMREnclavesSlot, mrEnclaveListSlot)
+	add(mrsigners, allowedMRSignersSlot, mrSignerListSlot)
+	return storage
+}
+
+// loadGenesisWhitelist reads the whitelist from the genesis allocation stored
+// in the database. It fails if the chain has not been initialised yet.
+func loadGenesisWhitelist(db ethdb.Database, contract common.Address) (GenesisWhitelist, error) {
+	if db == nil {
+		return GenesisWhitelist{}, errors.New("no database")
+	}
+	stored := rawdb.ReadCanonicalHash(db, 0)
+	if stored == (common.Hash{}) {
+		return GenesisWhitelist{}, errors.New("genesis block not found")
+	}
+	blob := rawdb.ReadGenesisStateSpec(db, stored)
+	if len(blob) == 0 {
+		return GenesisWhitelist{}, errors.New("genesis allocation not found")
+	}
+	var alloc types.GenesisAlloc
+	if err := alloc.UnmarshalJSON(blob); err != nil {
+		return GenesisWhitelist{}, err
+	}
+	return ReadWhitelistFromAlloc(alloc, contract)
+}
+
+// LoadGenesisWhitelist loads the whitelist from a genesis allocation into the
+// engine's verifier. It is used when the engine is created before the genesis
+// block has been committed to the database, so the stored spec is missing.
+func (e *SGXEngine) LoadGenesisWhitelist(alloc types.GenesisAlloc) error {
+	whitelist, err := ReadWhitelistFromAlloc(alloc, e.securityConfig)
+	if err != nil {
+		return err
+	}
+	verifier, ok := e.verifier.(*internalsgx.DCAPVerifier)
+	if !ok || (len(whitelist.MREnclaves) == 0 && len(whitelist.MRSigners) == 0) {
+		return nil
+	}
+	loadWhitelistToVerifier(verifier, whitelist.MREnclaves, whitelist.MRSigners)
+	log.Info("Whitelist loaded from genesis alloc",
+		"contract", e.securityConfig,
+		"mrenclaves", len(whitelist.MREnclaves),
+		"mrsigners", len(whitelist.MRSigners))
+	return nil
+}
@@ -0,0 +1,133 @@
+package sgx
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/governance"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
+)
+
+var (
+	testSecurityConfig = common.HexToAddress("0x0000000000000000000000000000000000001002")
+	testMREnclave      = common.HexToHash("0x1111111111111111111111111111111111111111111111111111111111111111")
+	testMREnclave2     = common.HexToHash("0x2222222222222222222222222222222222222222222222222222222222222222")
+	testMRSigner       = common.HexToHash("0x3333333333333333333333333333333333333333333333333333333333333333")
+)
+
+func TestWhitelistFromAlloc(t *testing.T) {
+	storage := WhitelistStorage([]common.Hash{testMREnclave, testMREnclave2}, []common.Hash{testMRSigner})
+	alloc := types.GenesisAlloc{
+		testSecurityConfig: {Balance: common.Big0, Storage: storage},
+	}
+	whitelist, err := ReadWhitelistFromAlloc(alloc, testSecurityConfig)
+	if err != nil {
+		t.Fatalf("failed to read whitelist: %v", err)
+	}
+	if len(whitelist.MREnclaves) != 2 || whitelist.MREnclaves[0] != testMREnclave.Hex() || whitelist.MREnclaves[1] != testMREnclave2.Hex() {
+		t.Fatalf("unexpected MRENCLAVE whitelist: %v", whitelist.MREnclaves)
+	}
+	if len(whitelist.MRSigners) != 1 || whitelist.MRSigners[0] != testMRSigner.Hex() {
+		t.Fatalf("unexpected MRSIGNER whitelist: %v", whitelist.MRSigners)
+	}
+
+	// Clearing the mapping flag removes the entry even though it stays listed.
+	delete(storage, whitelistMappingSlot(testMREnclave, allowedMREnclavesSlot))
+	whitelist, _ = ReadWhitelistFromAlloc(alloc, testSecurityConfig)
+	if len(whitelist.MREnclaves) != 1 || whitelist.MREnclaves[0] != testMREnclave2.Hex() {
+		t.Fatalf("removed MRENCLAVE still whitelisted: %v", whitelist.MREnclaves)
+	}
+
+	// Other accounts do not contribute.
+	whitelist, err = ReadWhitelistFromAlloc(alloc, common.HexToAddress("0x1234"))
+	if err != nil || len(whitelist.MREnclaves) != 0 || len(whitelist.MRSigners) != 0 {
+		t.Fatalf("unexpected whitelist for foreign contract: %+v, %v", whitelist, err)
+	}
+
+	// A whitelist set only in the mappings cannot be enumerated and is rejected.
+	mappingsOnly := types.GenesisAlloc{
+		testSecurityConfig: {Balance: common.Big0, Storage: map[common.Hash]common.Hash{
+			whitelistMappingSlot(testMREnclave, allowedMREnclavesSlot): common.BigToHash(common.Big1),
+		}},
+	}
+	if _, err := ReadWhitelistFromAlloc(mappingsOnly, testSecurityConfig); !errors.Is(err, ErrWhitelistNotListed) {
+		t.Fatalf("mapping-only whitelist: have %v, want %v", err, ErrWhitelistNotListed)
+	}
+	engine := New(DefaultConfig(), nil, internalsgx.NewDCAPVerifier(true))
+	engine.securityConfig = testSecurityConfig
+	if err := engine.LoadGenesisWhitelist(mappingsOnly); !errors.Is(err, ErrWhitelistNotListed) {
+		t.Fatalf("engine accepted mapping-only whitelist: %v", err)
+	}
+}
+
+func TestLoadGenesisWhitelist(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	if _, err := loadGenesisWhitelist(db, testSecurityConfig); err == nil {
+		t.Fatal("expected error on uninitialised database")
+	}
+
+	alloc := types.GenesisAlloc{
+		testSecurityConfig: {Balance: common.Big0, Storage: WhitelistStorage([]common.Hash{testMREnclave}, []common.Hash{testMRSigner})},
+	}
+	blob, err := json.Marshal(alloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisHash := common.HexToHash("0xabcdef")
+	rawdb.WriteCanonicalHash(db, genesisHash, 0)
+	rawdb.WriteGenesisStateSpec(db, genesisHash, blob)
+
+	whitelist, err := loadGenesisWhitelist(db, testSecurityConfig)
+	if err != nil {
+		t.Fatalf("loadGenesisWhitelist failed: %v", err)
+	}
+	verifier := internalsgx.NewDCAPVerifier(true)
+	loadWhitelistToVerifier(verifier, whitelist.MREnclaves, whitelist.MRSigners)
+	if !verifier.IsAllowedMREnclave(testMREnclave.Bytes()) {
+		t.Error("genesis MRENCLAVE not whitelisted")
+	}
+	if verifier.IsAllowedMREnclave(testMREnclave2.Bytes()) {
+		t.Error("unexpected MRENCLAVE whitelisted")
+	}
+	if !verifier.IsAllowedMRSigner(testMRSigner.Bytes()) {
+		t.Error("genesis MRSIGNER not whitelisted")
+	}
+}
+
+func TestEngineLoadGenesisWhitelist(t *testing.T) {
+	verifier := internalsgx.NewDCAPVerifier(true)
+	engine := New(DefaultConfig(), nil, verifier)
+	engine.securityConfig = testSecurityConfig
+
+	err := engine.LoadGenesisWhitelist(types.GenesisAlloc{
+		testSecurityConfig: {Balance: common.Big0, Storage: WhitelistStorage([]common.Hash{testMREnclave}, nil)},
+	})
+	if err != nil {
+		t.Fatalf("failed to load whitelist: %v", err)
+	}
+	if !verifier.IsAllowedMREnclave(testMREnclave.Bytes()) {
+		t.Error("genesis MRENCLAVE not whitelisted")
+	}
+}
+
+// Tests that whitelist changes made through the state-backed governance
+// manager are seen by the engine.
+func TestWhitelistFromGovernanceState(t *testing.T) {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	for slot, value := range WhitelistStorage([]common.Hash{testMREnclave}, nil) {
+		statedb.SetState(testSecurityConfig, slot, value)
+	}
+	whitelist := governance.NewStateWhitelistManager(statedb, testSecurityConfig, 1, governance.DefaultWhitelistConfig(), nil)
+	whitelist.AddEntry(&governance.MREnclaveEntry{MRENCLAVE: testMREnclave2, Status: governance.StatusActive})
+	whitelist.RemoveEntry(testMREnclave)
+
+	have := ReadWhitelistFromState(statedb, testSecurityConfig)
+	if len(have.MREnclaves) != 1 || have.MREnclaves[0] != testMREnclave2.Hex() {
+		t.Fatalf("unexpected MRENCLAVE whitelist: %v", have.MREnclaves)
+	}
+}
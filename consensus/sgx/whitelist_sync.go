@@ -1,98 +1,364 @@
 package sgx
 
 import (
-"context"
-"fmt"
-"time"
-
-"github.com/ethereum/go-ethereum/common"
-"github.com/ethereum/go-ethereum/core/state"
-internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
-"github.com/ethereum/go-ethereum/log"
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
 )
 
-// AddMREnclaveViaGovernance adds an MRENCLAVE to whitelist
-func (e *SGXEngine) AddMREnclaveViaGovernance(mrenclave []byte) error {
-if len(mrenclave) != 32 {
-return fmt.Errorf("invalid MRENCLAVE length: %d", len(mrenclave))
+// inmemoryWhitelists is the number of per-state whitelists kept in memory.
+const inmemoryWhitelists = 128
+
+// Whitelist entry kinds reported in WhitelistChangeEvent.
+const (
+	WhitelistMREnclave = "mrenclave"
+	WhitelistMRSigner  = "mrsigner"
+)
+
+// WhitelistChangeEvent is posted for every whitelist entry added to or removed
+// from the verifier while following the security config contract state.
+type WhitelistChangeEvent struct {
+	BlockNumber uint64
+	Kind        string // WhitelistMREnclave or WhitelistMRSigner
+	Value       common.Hash
+	Added       bool
 }
 
-if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
-dcapVerifier.AddAllowedMREnclave(mrenclave)
-log.Info("MRENCLAVE added via governance", "mrenclave", common.Bytes2Hex(mrenclave))
-} else {
-return fmt.Errorf("verifier does not support whitelist management")
+// stateReader is implemented by chains that can open historical state, such
+// as core.BlockChain.
+type stateReader interface {
+	StateAt(root common.Hash) (*state.StateDB, error)
 }
 
-return nil
+// whitelistChain is the chain access needed to follow whitelist changes.
+type whitelistChain interface {
+	stateReader
+	CurrentBlock() *types.Header
+	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
 }
 
-// RemoveMREnclaveViaGovernance removes an MRENCLAVE from whitelist
-func (e *SGXEngine) RemoveMREnclaveViaGovernance(mrenclave []byte) error {
-if len(mrenclave) != 32 {
-return fmt.Errorf("invalid MRENCLAVE length: %d", len(mrenclave))
+// whitelistSet is the whitelist as stored in one particular state.
+type whitelistSet struct {
+	mrEnclaves map[common.Hash]bool
+	mrSigners  map[common.Hash]bool
 }
 
-if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
-dcapVerifier.RemoveAllowedMREnclave(mrenclave)
-log.Info("MRENCLAVE removed via governance", "mrenclave", common.Bytes2Hex(mrenclave))
-} else {
-return fmt.Errorf("verifier does not support whitelist management")
+func newWhitelistSet(whitelist GenesisWhitelist) *whitelistSet {
+	set := &whitelistSet{
+		mrEnclaves: make(map[common.Hash]bool),
+		mrSigners:  make(map[common.Hash]bool),
+	}
+	for _, entry := range whitelist.MREnclaves {
+		set.mrEnclaves[common.HexToHash(entry)] = true
+	}
+	for _, entry := range whitelist.MRSigners {
+		set.mrSigners[common.HexToHash(entry)] = true
+	}
+	return set
 }
 
-return nil
+// allows checks the measurements against the set. An empty list allows no
+// value, unless the chain config explicitly allows any value for it.
+func (s *whitelistSet) allows(mrenclave, mrsigner []byte, config *params.SGXConfig) error {
+	anyMREnclave := config != nil && config.AllowAnyMREnclave && len(s.mrEnclaves) == 0
+	if !anyMREnclave && !s.mrEnclaves[common.BytesToHash(mrenclave)] {
+		return fmt.Errorf("%w: MRENCLAVE %x", ErrNotWhitelisted, mrenclave)
+	}
+	anyMRSigner := config != nil && config.AllowAnyMRSigner && len(s.mrSigners) == 0
+	if !anyMRSigner && !s.mrSigners[common.BytesToHash(mrsigner)] {
+		return fmt.Errorf("%w: MRSIGNER %x", ErrNotWhitelisted, mrsigner)
+	}
+	return nil
 }
 
-// AddMRSignerViaGovernance adds an MRSIGNER to whitelist
-func (e *SGXEngine) AddMRSignerViaGovernance(mrsigner []byte) error {
-if len(mrsigner) != 32 {
-return fmt.Errorf("invalid MRSIGNER length: %d", len(mrsigner))
+// whitelistAt returns the whitelist stored in the state of the given header.
+func (e *SGXEngine) whitelistAt(chain stateReader, header *types.Header) (*whitelistSet, error) {
+	if set, ok := e.whitelists.Get(header.Root); ok {
+		return set, nil
+	}
+	statedb, err := chain.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	set := newWhitelistSet(ReadWhitelistFromState(statedb, e.securityConfig))
+	e.whitelists.Add(header.Root, set)
+	return set, nil
 }
 
-if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
-dcapVerifier.AddAllowedMRSigner(mrsigner)
-log.Info("MRSIGNER added via governance", "mrsigner", common.Bytes2Hex(mrsigner))
-} else {
-return fmt.Errorf("verifier does not support whitelist management")
+// verifyWhitelist checks the enclave measurements of a block's quote against
+// the whitelist as of the parent state, so the result does not depend on how
+// far the local chain has progressed. Chains without state access fall back to
+// the whitelist currently loaded in the verifier.
+func (e *SGXEngine) verifyWhitelist(chain consensus.ChainHeaderReader, header *types.Header) error {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	reader, ok := chain.(stateReader)
+	if !ok {
+		if _, ok := e.verifier.(*internalsgx.DCAPVerifier); !ok {
+			return nil
+		}
+	}
+	extra, err := DecodeSGXExtra(header.Extra)
+	if err != nil {
+		return ErrInvalidExtra
+	}
+	mrenclave, mrsigner, err := quoteMeasurements(extra.SGXQuote)
+	if err != nil {
+		return err
+	}
+	if reader == nil {
+		return e.verifierAllows(mrenclave, mrsigner)
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	set, err := e.whitelistAt(reader, parent)
+	if err != nil {
+		return consensus.ErrPrunedAncestor
+	}
+	return set.allows(mrenclave, mrsigner, chain.Config().SGX)
 }
 
-return nil
+// headerWhitelist returns the header-level whitelist check used by
+// VerifyHeader and VerifyHeaders for quotes in a block on top of parent. It
+// uses the parent state when it is available, otherwise the whitelist recorded
+// in the latest checkpoint, so that header-first sync does not accept headers
+// from unknown enclaves. Without either the check is deferred to
+// verifyParentState at body validation, which stays authoritative once state
+// exists, and a nil check is returned.
+func (e *SGXEngine) headerWhitelist(chain consensus.ChainHeaderReader, parent *types.Header, checkpoint *Checkpoint) func(quote []byte) error {
+	var set *whitelistSet
+	if reader, ok := chain.(stateReader); ok {
+		set, _ = e.whitelistAt(reader, parent)
+	}
+	if set == nil && checkpoint != nil {
+		set = checkpoint.whitelist()
+	}
+	if set == nil {
+		return nil
+	}
+	config := chain.Config().SGX
+	return func(quote []byte) error {
+		mrenclave, mrsigner, err := quoteMeasurements(quote)
+		if err != nil {
+			return err
+		}
+		return set.allows(mrenclave, mrsigner, config)
+	}
+}
+
+// verifierAllows checks the measurements against the whitelist currently
+// loaded in the verifier. Verifiers without whitelist support allow any value.
+func (e *SGXEngine) verifierAllows(mrenclave, mrsigner []byte) error {
+	verifier, ok := e.verifier.(*internalsgx.DCAPVerifier)
+	if !ok {
+		return nil
+	}
+	if !verifier.IsAllowedMREnclave(mrenclave) {
+		return fmt.Errorf("%w: MRENCLAVE %x", ErrNotWhitelisted, mrenclave)
+	}
+	if !verifier.IsAllowedMRSigner(mrsigner) {
+		return fmt.Errorf("%w: MRSIGNER %x", ErrNotWhitelisted, mrsigner)
+	}
+	return nil
+}
+
+// quoteMeasurements extracts MRENCLAVE and MRSIGNER from a quote.
+func quoteMeasurements(quote []byte) (mrenclave, mrsigner []byte, err error) {
+	if mrenclave, err = internalsgx.ExtractMREnclave(quote); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSGXQuote, err)
+	}
+	if mrsigner, err = internalsgx.ExtractMRSigner(quote); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSGXQuote, err)
+	}
+	return mrenclave, mrsigner, nil
+}
+
+// AddMREnclaveViaGovernance adds an MRENCLAVE to whitelist
+func (e *SGXEngine) AddMREnclaveViaGovernance(mrenclave []byte) error {
+	if len(mrenclave) != 32 {
+		return fmt.Errorf("invalid MRENCLAVE length: %d", len(mrenclave))
+	}
+
+	if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
+		dcapVerifier.AddAllowedMREnclave(mrenclave)
+		log.Info("MRENCLAVE added via governance", "mrenclave", common.Bytes2Hex(mrenclave))
+	} else {
+		return fmt.Errorf("verifier does not support whitelist management")
+	}
+
+	return nil
+}
+
+// RemoveMREnclaveViaGovernance removes an MRENCLAVE from whitelist
+func (e *SGXEngine) RemoveMREnclaveViaGovernance(mrenclave []byte) error {
+	if len(mrenclave) != 32 {
+		return fmt.Errorf("invalid MRENCLAVE length: %d", len(mrenclave))
+	}
+
+	if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
+		dcapVerifier.RemoveAllowedMREnclave(mrenclave)
+		log.Info("MRENCLAVE removed via governance", "mrenclave", common.Bytes2Hex(mrenclave))
+	} else {
+		return fmt.Errorf("verifier does not support whitelist management")
+	}
+
+	return nil
+}
+
+// AddMRSignerViaGovernance adds an MRSIGNER to whitelist
+func (e *SGXEngine) AddMRSignerViaGovernance(mrsigner []byte) error {
+	if len(mrsigner) != 32 {
+		return fmt.Errorf("invalid MRSIGNER length: %d", len(mrsigner))
+	}
+
+	if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
+		dcapVerifier.AddAllowedMRSigner(mrsigner)
+		log.Info("MRSIGNER added via governance", "mrsigner", common.Bytes2Hex(mrsigner))
+	} else {
+		return fmt.Errorf("verifier does not support whitelist management")
+	}
+
+	return nil
 }
 
 // RemoveMRSignerViaGovernance removes an MRSIGNER from whitelist
 func (e *SGXEngine) RemoveMRSignerViaGovernance(mrsigner []byte) error {
-if len(mrsigner) != 32 {
-return fmt.Errorf("invalid MRSIGNER length: %d", len(mrsigner))
-}
+	if len(mrsigner) != 32 {
+		return fmt.Errorf("invalid MRSIGNER length: %d", len(mrsigner))
+	}
+
+	if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
+		dcapVerifier.RemoveAllowedMRSigner(mrsigner)
+		log.Info("MRSIGNER removed via governance", "mrsigner", common.Bytes2Hex(mrsigner))
+	} else {
+		return fmt.Errorf("verifier does not support whitelist management")
+	}
 
-if dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier); ok {
-dcapVerifier.RemoveAllowedMRSigner(mrsigner)
-log.Info("MRSIGNER removed via governance", "mrsigner", common.Bytes2Hex(mrsigner))
-} else {
-return fmt.Errorf("verifier does not support whitelist management")
+	return nil
 }
 
-return nil
+// diffWhitelist returns the entries to add to and remove from current to make
+// it equal to target, both in ascending order.
+func diffWhitelist(current [][]byte, target map[common.Hash]bool) (added, removed []common.Hash) {
+	have := make(map[common.Hash]bool, len(current))
+	for _, entry := range current {
+		hash := common.BytesToHash(entry)
+		have[hash] = true
+		if !target[hash] {
+			removed = append(removed, hash)
+		}
+	}
+	for hash := range target {
+		if !have[hash] {
+			added = append(added, hash)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return bytes.Compare(added[i][:], added[j][:]) < 0 })
+	sort.Slice(removed, func(i, j int) bool { return bytes.Compare(removed[i][:], removed[j][:]) < 0 })
+	return added, removed
 }
 
 // UpdateWhitelistFromGovernance updates whitelist based on governance contract state
+// The verifier's whitelist is replaced by the one stored in the security config
+// contract in statedb. Removals are applied before additions, MRENCLAVE before
+// MRSIGNER, each in ascending order, and a WhitelistChangeEvent is posted for
+// every change.
 func (e *SGXEngine) UpdateWhitelistFromGovernance(statedb *state.StateDB, blockNumber uint64) error {
-log.Debug("Checking for whitelist updates from governance", "block", blockNumber)
-return nil
-}
+	dcapVerifier, ok := e.verifier.(*internalsgx.DCAPVerifier)
+	if !ok {
+		return fmt.Errorf("verifier does not support whitelist management")
+	}
+	target := newWhitelistSet(ReadWhitelistFromState(statedb, e.securityConfig))
+
+	e.whitelistMu.Lock()
+	defer e.whitelistMu.Unlock()
 
-// SyncWhitelistPeriodically starts a background goroutine to sync whitelist
-func (e *SGXEngine) SyncWhitelistPeriodically(ctx context.Context, interval time.Duration) {
-ticker := time.NewTicker(interval)
-defer ticker.Stop()
+	var changes []WhitelistChangeEvent
+	apply := func(kind string, current [][]byte, target map[common.Hash]bool, add, remove func([]byte) error) error {
+		added, removed := diffWhitelist(current, target)
+		for _, hash := range removed {
+			if err := remove(hash.Bytes()); err != nil {
+				return err
+			}
+			changes = append(changes, WhitelistChangeEvent{BlockNumber: blockNumber, Kind: kind, Value: hash, Added: false})
+		}
+		for _, hash := range added {
+			if err := add(hash.Bytes()); err != nil {
+				return err
+			}
+			changes = append(changes, WhitelistChangeEvent{BlockNumber: blockNumber, Kind: kind, Value: hash, Added: true})
+		}
+		return nil
+	}
+	if err := apply(WhitelistMREnclave, dcapVerifier.AllowedMREnclaves(), target.mrEnclaves, e.AddMREnclaveViaGovernance, e.RemoveMREnclaveViaGovernance); err != nil {
+		return err
+	}
+	if err := apply(WhitelistMRSigner, dcapVerifier.AllowedMRSigners(), target.mrSigners, e.AddMRSignerViaGovernance, e.RemoveMRSignerViaGovernance); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		log.Info("Whitelist updated from governance", "block", blockNumber, "kind", change.Kind, "value", change.Value, "added", change.Added)
+		e.whitelistFeed.Send(change)
+	}
+	return nil
+}
 
-for {
-select {
-case <-ticker.C:
-log.Debug("Periodic whitelist sync triggered")
-case <-ctx.Done():
-log.Info("Whitelist sync stopped")
-return
+// SubscribeWhitelistChanges registers a subscription for whitelist changes
+// applied by UpdateWhitelistFromGovernance.
+func (e *SGXEngine) SubscribeWhitelistChanges(ch chan<- WhitelistChangeEvent) event.Subscription {
+	return e.whitelistFeed.Subscribe(ch)
 }
+
+// StartWhitelistSync keeps the verifier whitelist in line with the security
+// config contract state of the canonical chain, starting from the current head
+// and following every imported block. It stops when the engine is closed.
+func (e *SGXEngine) StartWhitelistSync(chain whitelistChain) {
+	events := make(chan core.ChainEvent, 16)
+	sub := chain.SubscribeChainEvent(events)
+
+	go func() {
+		defer sub.Unsubscribe()
+
+		e.syncWhitelist(chain, chain.CurrentBlock())
+		for {
+			select {
+			case ev := <-events:
+				e.syncWhitelist(chain, ev.Header)
+			case <-sub.Err():
+				return
+			case <-e.quit:
+				log.Info("Whitelist sync stopped")
+				return
+			}
+		}
+	}()
 }
+
+// syncWhitelist applies the whitelist stored in the state of header.
+func (e *SGXEngine) syncWhitelist(chain stateReader, header *types.Header) {
+	if header == nil {
+		return
+	}
+	statedb, err := chain.StateAt(header.Root)
+	if err != nil {
+		log.Debug("Whitelist state unavailable", "block", header.Number, "err", err)
+		return
+	}
+	if err := e.UpdateWhitelistFromGovernance(statedb, header.Number.Uint64()); err != nil {
+		log.Warn("Failed to update whitelist from governance", "block", header.Number, "err", err)
+	}
 }
@@ -0,0 +1,218 @@
+package sgx
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// whitelistTestChainConfig allows any MRSIGNER, as the tests only whitelist
+// MRENCLAVEs.
+var whitelistTestChainConfig = func() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.SGX = &params.SGXConfig{AllowAnyMRSigner: true}
+	config.SGXGovernanceBlock = common.Big0
+	return &config
+}()
+
+// whitelistTestChain serves headers and states keyed by state root.
+type whitelistTestChain struct {
+	headers map[common.Hash]*types.Header
+	states  map[common.Hash]*state.StateDB
+}
+
+func (c *whitelistTestChain) Config() *params.ChainConfig  { return whitelistTestChainConfig }
+func (c *whitelistTestChain) CurrentHeader() *types.Header { return nil }
+func (c *whitelistTestChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return c.headers[hash]
+}
+func (c *whitelistTestChain) GetHeaderByNumber(number uint64) *types.Header { return nil }
+func (c *whitelistTestChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+
+func (c *whitelistTestChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	if statedb, ok := c.states[root]; ok {
+		return statedb, nil
+	}
+	return nil, errors.New("missing state")
+}
+
+func newWhitelistState(t *testing.T, mrenclaves, mrsigners []common.Hash) *state.StateDB {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slot, value := range WhitelistStorage(mrenclaves, mrsigners) {
+		statedb.SetState(testSecurityConfig, slot, value)
+	}
+	return statedb
+}
+
+// whitelistTestHeader returns a header whose quote carries the given MRENCLAVE.
+func whitelistTestHeader(t *testing.T, parent *types.Header, mrenclave common.Hash) *types.Header {
+	quote := make([]byte, 432)
+	quote[0] = 3
+	copy(quote[112:144], mrenclave[:])
+	extra, err := (&SGXExtra{SGXQuote: quote}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Extra:      extra,
+	}
+}
+
+func TestUpdateWhitelistFromGovernance(t *testing.T) {
+	verifier := internalsgx.NewDCAPVerifier(true)
+	verifier.AddAllowedMREnclave(testMREnclave.Bytes())
+	engine := New(DefaultConfig(), nil, verifier)
+	engine.securityConfig = testSecurityConfig
+
+	events := make(chan WhitelistChangeEvent, 10)
+	sub := engine.SubscribeWhitelistChanges(events)
+	defer sub.Unsubscribe()
+
+	statedb := newWhitelistState(t, []common.Hash{testMREnclave2}, []common.Hash{testMRSigner})
+	if err := engine.UpdateWhitelistFromGovernance(statedb, 7); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	want := []WhitelistChangeEvent{
+		{BlockNumber: 7, Kind: WhitelistMREnclave, Value: testMREnclave, Added: false},
+		{BlockNumber: 7, Kind: WhitelistMREnclave, Value: testMREnclave2, Added: true},
+		{BlockNumber: 7, Kind: WhitelistMRSigner, Value: testMRSigner, Added: true},
+	}
+	for i, w := range want {
+		if got := <-events; got != w {
+			t.Fatalf("event %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if verifier.IsAllowedMREnclave(testMREnclave.Bytes()) || !verifier.IsAllowedMREnclave(testMREnclave2.Bytes()) {
+		t.Error("MRENCLAVE whitelist not synced")
+	}
+	if !verifier.IsAllowedMRSigner(testMRSigner.Bytes()) {
+		t.Error("MRSIGNER whitelist not synced")
+	}
+
+	// A second sync against the same state is a no-op.
+	if err := engine.UpdateWhitelistFromGovernance(statedb, 8); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestVerifyWhitelistParentState(t *testing.T) {
+	var (
+		rootA   = common.HexToHash("0xa1")
+		rootB   = common.HexToHash("0xb1")
+		parentA = &types.Header{Number: big.NewInt(1), Root: rootA}
+		parentB = &types.Header{Number: big.NewInt(1), Root: rootB, Time: 1}
+		chain   = &whitelistTestChain{
+			headers: map[common.Hash]*types.Header{parentA.Hash(): parentA, parentB.Hash(): parentB},
+			states: map[common.Hash]*state.StateDB{
+				rootA: newWhitelistState(t, []common.Hash{testMREnclave}, nil),
+				rootB: newWhitelistState(t, []common.Hash{testMREnclave2}, nil),
+			},
+		}
+	)
+	verifier := internalsgx.NewDCAPVerifier(true)
+	engine := New(DefaultConfig(), nil, verifier)
+	engine.securityConfig = testSecurityConfig
+
+	// The live verifier whitelist does not matter, only the parent state.
+	verifier.AddAllowedMREnclave(testMREnclave2.Bytes())
+	if err := engine.verifyWhitelist(chain, whitelistTestHeader(t, parentA, testMREnclave)); err != nil {
+		t.Errorf("whitelisted MRENCLAVE rejected: %v", err)
+	}
+	if err := engine.verifyWhitelist(chain, whitelistTestHeader(t, parentB, testMREnclave)); !errors.Is(err, ErrNotWhitelisted) {
+		t.Errorf("expected ErrNotWhitelisted, got %v", err)
+	}
+
+	// Missing parent state is reported so the importer can recover it.
+	delete(chain.states, rootA)
+	engine.whitelists.Purge()
+	if err := engine.verifyWhitelist(chain, whitelistTestHeader(t, parentA, testMREnclave)); err != consensus.ErrPrunedAncestor {
+		t.Errorf("expected ErrPrunedAncestor, got %v", err)
+	}
+	orphan := whitelistTestHeader(t, &types.Header{Number: big.NewInt(5)}, testMREnclave)
+	if err := engine.verifyWhitelist(chain, orphan); err != consensus.ErrUnknownAncestor {
+		t.Errorf("expected ErrUnknownAncestor, got %v", err)
+	}
+}
+
+func TestVerifyHeaderWhitelist(t *testing.T) {
+	var (
+		root   = common.HexToHash("0xa1")
+		parent = &types.Header{Number: big.NewInt(1), Root: root}
+		chain  = &whitelistTestChain{
+			headers: map[common.Hash]*types.Header{parent.Hash(): parent},
+			states: map[common.Hash]*state.StateDB{
+				root: newWhitelistState(t, []common.Hash{testMREnclave}, nil),
+			},
+		}
+	)
+	verifier := internalsgx.NewDCAPVerifier(true)
+	engine := New(DefaultConfig(), nil, verifier)
+	engine.securityConfig = testSecurityConfig
+	verifier.AddAllowedMREnclave(testMREnclave2.Bytes())
+
+	check := func(mrenclave common.Hash) error {
+		extra, err := DecodeSGXExtra(whitelistTestHeader(t, parent, mrenclave).Extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return engine.headerWhitelist(chain, parent, nil)(extra.SGXQuote)
+	}
+	// With parent state available the state whitelist is used.
+	if err := check(testMREnclave); err != nil {
+		t.Errorf("whitelisted MRENCLAVE rejected: %v", err)
+	}
+	if err := check(testMREnclave2); !errors.Is(err, ErrNotWhitelisted) {
+		t.Errorf("expected ErrNotWhitelisted, got %v", err)
+	}
+	// Without parent state or checkpoint (header-first sync in the first
+	// epoch) the check is left to the parent-state check, not to the
+	// whitelist loaded in the verifier.
+	delete(chain.states, root)
+	engine.whitelists.Purge()
+	if engine.headerWhitelist(chain, parent, nil) != nil {
+		t.Error("header whitelist checked without parent state or checkpoint")
+	}
+}
+
+// Tests that an empty whitelist allows nothing unless the chain config
+// explicitly allows any value.
+func TestEmptyWhitelist(t *testing.T) {
+	var (
+		empty     = newWhitelistSet(GenesisWhitelist{})
+		mrenclave = testMREnclave.Bytes()
+		mrsigner  = testMRSigner.Bytes()
+	)
+	if err := empty.allows(mrenclave, mrsigner, nil); !errors.Is(err, ErrNotWhitelisted) {
+		t.Errorf("empty whitelist: expected ErrNotWhitelisted, got %v", err)
+	}
+	if err := empty.allows(mrenclave, mrsigner, &params.SGXConfig{AllowAnyMREnclave: true}); !errors.Is(err, ErrNotWhitelisted) {
+		t.Errorf("empty MRSIGNER whitelist: expected ErrNotWhitelisted, got %v", err)
+	}
+	if err := empty.allows(mrenclave, mrsigner, &params.SGXConfig{AllowAnyMREnclave: true, AllowAnyMRSigner: true}); err != nil {
+		t.Errorf("allow-any whitelist rejected: %v", err)
+	}
+	// Allowing any value only applies while the list is empty.
+	set := newWhitelistSet(GenesisWhitelist{MREnclaves: []string{testMREnclave2.Hex()}})
+	if err := set.allows(mrenclave, mrsigner, &params.SGXConfig{AllowAnyMREnclave: true, AllowAnyMRSigner: true}); !errors.Is(err, ErrNotWhitelisted) {
+		t.Errorf("unlisted MRENCLAVE: expected ErrNotWhitelisted, got %v", err)
+	}
+}
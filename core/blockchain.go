@@ -651,6 +651,13 @@ func (bc *BlockChain) loadLastState() error {
 	bc.currentBlock.Store(headHeader)
 	headBlockGauge.Update(int64(headBlock.NumberU64()))
 
+	// Rewind the SGX key store along with the chain after a crash or SetHead
+	if layers := bc.cfg.VmConfig.SGXKeyLayers; layers != nil {
+		if err := layers.Commit(headHeader); err != nil {
+			log.Error("Failed to rewind SGX key store", "number", headHeader.Number, "hash", head, "err", err)
+		}
+	}
+
 	// Restore the last known head header
 	if head := rawdb.ReadHeadHeaderHash(bc.db); head != (common.Hash{}) {
 		if header := bc.GetHeaderByHash(head); header != nil {
@@ -1283,6 +1290,13 @@ func (bc *BlockChain) writeHeadBlock(block *types.Block) {
 	rawdb.WriteTxLookupEntriesByBlock(batch, block)
 	rawdb.WriteHeadBlockHash(batch, block.Hash())
 
+	// Write the SGX key store changes of the new canonical chain before the
+	// head markers, so a crash in between is rewound on restart
+	if layers := bc.cfg.VmConfig.SGXKeyLayers; layers != nil {
+		if err := layers.Commit(block.Header()); err != nil {
+			log.Error("Failed to write SGX key store changes", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+	}
 	// Flush the whole batch into the disk, exit the node if failed
 	if err := batch.Write(); err != nil {
 		log.Crit("Failed to update chain indexes and markers", "err", err)
@@ -2082,6 +2096,11 @@ func (bc *BlockChain) ProcessBlock(parentRoot common.Hash, block *types.Block, s
 	)
 	defer interrupt.Store(true) // terminate the prefetch at the end
 
+	// Blocks of SGX chains are not executed before the master secret of the
+	// key store is loaded, import resumes once it has been synced.
+	if err := bc.cfg.VmConfig.SGXKeyLayers.Ready(); err != nil {
+		return nil, err
+	}
 	if bc.cfg.NoPrefetch {
 		statedb, err = state.New(parentRoot, bc.statedb)
 		if err != nil {
@@ -2162,9 +2181,11 @@ func (bc *BlockChain) ProcessBlock(parentRoot common.Hash, block *types.Block, s
 		}()
 	}
 
-	// Process block using the parent state as reference point
+	// Process block using the parent state as reference point. The changes
+	// of the SGX key store are kept in memory until the block is canonical.
 	pstart := time.Now()
-	res, err := bc.processor.Process(block, statedb, bc.cfg.VmConfig)
+	vmConfig := bc.cfg.VmConfig.WithSGXKeys(block.ParentHash())
+	res, err := bc.processor.Process(block, statedb, vmConfig)
 	if err != nil {
 		bc.reportBadBlock(block, res, err)
 		return nil, err
@@ -2178,6 +2199,10 @@ func (bc *BlockChain) ProcessBlock(parentRoot common.Hash, block *types.Block, s
 	}
 	vtime := time.Since(vstart)
 
+	if layers := vmConfig.SGXKeyLayers; layers != nil {
+		layers.Retain(block.Header(), vmConfig.SGXKeyStore)
+	}
+
 	// If witnesses was generated and stateless self-validation requested, do
 	// that now. Self validation should *never* run in production, it's more of
 	// a tight integration to enable running *all* consensus tests through the
@@ -2195,7 +2220,7 @@ func (bc *BlockChain) ProcessBlock(parentRoot common.Hash, block *types.Block, s
 		task := types.NewBlockWithHeader(context).WithBody(*block.Body())
 
 		// Run the stateless self-cross-validation
-		crossStateRoot, crossReceiptRoot, err := ExecuteStateless(bc.chainConfig, bc.cfg.VmConfig, task, witness)
+		crossStateRoot, crossReceiptRoot, err := ExecuteStateless(bc.chainConfig, bc.cfg.VmConfig.WithSGXKeys(block.ParentHash()), task, witness)
 		if err != nil {
 			return nil, fmt.Errorf("stateless self-validation failed: %v", err)
 		}
@@ -0,0 +1,123 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// EncryptedTxRevealWindow is the number of blocks after its commitment an
+	// encrypted transaction can only be revealed with decryption shares. Later
+	// blocks may expire it without executing its call.
+	EncryptedTxRevealWindow = 16
+
+	// MaxEncryptedTxsPerBlock is the maximum number of encrypted transactions
+	// a block commits. As transactions past the reveal window are expired
+	// before anything else is included, the queue holds at most the
+	// commitments of one reveal window.
+	MaxEncryptedTxsPerBlock = 64
+
+	// MaxPendingEncryptedTxsPerSender is the maximum number of committed
+	// encrypted transactions of a sender waiting to be revealed, bounding the
+	// share of the queue a sender whose transactions are never revealed holds.
+	MaxPendingEncryptedTxsPerSender = 16
+
+	// EncryptedTxProofGas is the intrinsic gas of an encrypted transaction for
+	// verifying the proof of its ephemeral key, on top of the gas of a call.
+	EncryptedTxProofGas = params.EcrecoverGas
+)
+
+// DecryptionShareSource provides the decryption shares released for the
+// committed encrypted transactions.
+type DecryptionShareSource interface {
+	// DecryptionShares returns threshold many shares for the compressed
+	// ephemeral key of a payload, ascending by share index, or nil if not
+	// enough shares are known yet.
+	DecryptionShares(ephemeral []byte) [][]byte
+}
+
+// EncryptedTxChain is the chain access needed to look up the payloads of the
+// committed encrypted transactions.
+type EncryptedTxChain interface {
+	GetHeader(hash common.Hash, number uint64) *types.Header
+	GetBlock(hash common.Hash, number uint64) *types.Block
+}
+
+// EncryptedTxPayload returns the payload of a committed encrypted transaction,
+// from the block of the chain ending at head it was committed in.
+func EncryptedTxPayload(chain EncryptedTxChain, head *types.Header, committed *vm.EncryptedTxCommitment) ([]byte, error) {
+	header := head
+	for header != nil && header.Number.Uint64() > committed.Number {
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	if header == nil || header.Number.Uint64() != committed.Number {
+		return nil, fmt.Errorf("block %d of encrypted transaction not found", committed.Number)
+	}
+	block := chain.GetBlock(header.Hash(), committed.Number)
+	if block == nil {
+		return nil, fmt.Errorf("block %d of encrypted transaction not found", committed.Number)
+	}
+	for _, tx := range block.Transactions() {
+		if tx.Type() == types.EncryptedTxType && tx.Nonce() == committed.Nonce && crypto.Keccak256Hash(tx.Data()) == committed.PayloadHash {
+			return tx.Data(), nil
+		}
+	}
+	return nil, errors.New("encrypted transaction not found in its block")
+}
+
+// EncryptedTxReveals returns the reveals of the encrypted transactions
+// committed up to parent that a block on top of it includes ahead of its
+// other transactions, in commitment order: the transactions whose decryption
+// shares are known, and the transactions past the reveal window, which are
+// expired. The reveals stop at the first transaction still waiting for its
+// shares within the window, which does not hold back the other transactions
+// of the block.
+func EncryptedTxReveals(config *params.ChainConfig, chain EncryptedTxChain, parent *types.Header, statedb vm.StateDB, source DecryptionShareSource) []*types.Transaction {
+	var (
+		number  = parent.Number.Uint64() + 1
+		reveals []*types.Transaction
+	)
+	for _, committed := range vm.PendingEncryptedTxs(statedb) {
+		payload, err := EncryptedTxPayload(chain, parent, committed)
+		if err != nil {
+			return reveals
+		}
+		var shares [][]byte
+		if source != nil {
+			shares = source.DecryptionShares(types.EncryptedTxEphemeralKey(payload))
+		}
+		if len(shares) == 0 && number < committed.Number+EncryptedTxRevealWindow {
+			return reveals
+		}
+		reveals = append(reveals, types.NewTx(&types.EncryptedRevealTx{
+			ChainID: config.ChainID,
+			From:    committed.From,
+			Nonce:   committed.Nonce,
+			Payload: payload,
+			Shares:  shares,
+		}))
+	}
+	return reveals
+}
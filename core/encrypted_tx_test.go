@@ -0,0 +1,362 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/holiman/uint256"
+)
+
+// testEncryptedTxChain is a chain of blocks by hash for looking up committed
+// payloads.
+type testEncryptedTxChain map[common.Hash]*types.Block
+
+func (c testEncryptedTxChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if block := c[hash]; block != nil {
+		return block.Header()
+	}
+	return nil
+}
+
+func (c testEncryptedTxChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return c[hash]
+}
+
+// testShareSource releases the decryption shares of a fixed set of key shares.
+type testShareSource []*vm.KeyShare
+
+func (s testShareSource) DecryptionShares(ephemeral []byte) [][]byte {
+	var shares [][]byte
+	for _, share := range s {
+		d, err := share.DecryptionShare(ephemeral, rand.Reader)
+		if err != nil {
+			return nil
+		}
+		shares = append(shares, d)
+	}
+	return shares
+}
+
+// Tests that encrypted transactions are only committed by their block, and
+// execute their call when revealed with decryption shares in a later block.
+func TestApplyEncryptedTransaction(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		from   = crypto.PubkeyToAddress(key.PublicKey)
+		target = common.Address{0xaa}
+		config = *params.TestChainConfig
+		chain  = make(testEncryptedTxChain)
+	)
+	secret, _ := crypto.GenerateKey()
+	txKey, keyShares, err := vm.SplitThresholdKey(crypto.FromECDSA(secret), 2, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupKey, _ := crypto.DecompressPubkey(txKey.GroupKey())
+	config.SGX = &params.SGXConfig{TransactionKey: txKey.Encode()}
+	config.SGXEncryptedTxBlock = common.Big0
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	statedb.SetBalance(from, uint256.NewInt(params.Ether), tracing.BalanceChangeUnspecified)
+	// Store the call value at slot 0 and the first input word at slot 1
+	statedb.SetCode(target, []byte{
+		byte(vm.CALLVALUE), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+		byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD), byte(vm.PUSH1), 1, byte(vm.SSTORE),
+		byte(vm.STOP),
+	}, tracing.CodeChangeUnspecified)
+
+	newHeader := func(number int64, parent common.Hash) *types.Header {
+		return &types.Header{ParentHash: parent, Number: big.NewInt(number), Difficulty: big.NewInt(1), GasLimit: 10_000_000, BaseFee: big.NewInt(1)}
+	}
+	newTx := func(header *types.Header, nonce uint64, payload []byte) *types.Transaction {
+		return types.MustSignNewTx(key, types.MakeSigner(&config, header.Number, header.Time), &types.EncryptedTx{
+			ChainID:   config.ChainID,
+			Nonce:     nonce,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(10),
+			Gas:       100_000,
+			Payload:   payload,
+		})
+	}
+	apply := func(config *params.ChainConfig, header *types.Header, tx *types.Transaction) (*types.Receipt, error) {
+		var usedGas uint64
+		evm := vm.NewEVM(NewEVMBlockContext(header, nil, &common.Address{}), statedb, config, vm.Config{})
+		return ApplyTransaction(evm, new(GasPool).AddGas(header.GasLimit), statedb, header, tx, &usedGas)
+	}
+	call := &types.EncryptedCall{To: target, Value: big.NewInt(7), Data: common.LeftPadBytes([]byte{0x2a}, 32)}
+	payload, err := types.EncryptTxCall(rand.Reader, groupKey, config.ChainID, from, 0, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header1 := newHeader(1, common.Hash{})
+	commit := newTx(header1, 0, payload)
+
+	// Chains without a transaction key cannot commit encrypted transactions
+	unkeyed := config
+	unkeyed.SGX = &params.SGXConfig{}
+	if _, err := apply(&unkeyed, header1, commit); !errors.Is(err, ErrEncryptedTxUnsupported) {
+		t.Fatalf("expected ErrEncryptedTxUnsupported, got %v", err)
+	}
+	// Committing pays for all the gas without executing the call
+	receipt, err := apply(&config, header1, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.GasUsed != 100_000 {
+		t.Fatalf("commit: status %d, gas used %d", receipt.Status, receipt.GasUsed)
+	}
+	// The fee of the reserved gas is only paid when the call is revealed
+	committed, _ := vm.NextEncryptedTx(statedb)
+	if balance := statedb.GetBalance(common.Address{}); balance.Uint64() != 100_000-committed.Gas {
+		t.Fatalf("commit fee: got %v, want %d", balance, 100_000-committed.Gas)
+	}
+	if statedb.GetBalance(target).Sign() != 0 || statedb.GetState(target, common.Hash{}) != (common.Hash{}) {
+		t.Fatal("call executed when committed")
+	}
+	// A payload copied into another transaction lacks the proof of its sender
+	if _, err := apply(&config, header1, newTx(header1, 1, payload)); !errors.Is(err, ErrEncryptedTxPayload) {
+		t.Fatalf("expected ErrEncryptedTxPayload, got %v", err)
+	}
+	block1 := types.NewBlock(header1, &types.Body{Transactions: types.Transactions{commit}}, nil, trie.NewStackTrie(nil))
+	chain[block1.Hash()] = block1
+	header2 := newHeader(2, block1.Hash())
+
+	// A committed transaction waiting for its shares does not hold back others
+	other, err := types.EncryptTxCall(rand.Reader, groupKey, config.ChainID, from, 1, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit2 := newTx(header2, 1, other)
+	if _, err := apply(&config, header2, commit2); err != nil {
+		t.Fatal(err)
+	}
+	if reveals := EncryptedTxReveals(&config, chain, block1.Header(), statedb, nil); len(reveals) != 0 {
+		t.Fatalf("revealed without shares: %d reveals", len(reveals))
+	}
+	unshared := types.NewTx(&types.EncryptedRevealTx{ChainID: config.ChainID, From: from, Nonce: 0, Payload: payload})
+	if _, err := apply(&config, header2, unshared); !errors.Is(err, ErrEncryptedTxShares) {
+		t.Fatalf("expected ErrEncryptedTxShares, got %v", err)
+	}
+	reveals := EncryptedTxReveals(&config, chain, block1.Header(), statedb, testShareSource{keyShares[0], keyShares[2]})
+	if len(reveals) != 1 {
+		t.Fatalf("%d reveals", len(reveals))
+	}
+	// The revealed call needs its reserved gas in the revealing block
+	small := newHeader(2, block1.Hash())
+	small.GasLimit = params.TxGas
+	if _, err := apply(&config, small, reveals[0]); !errors.Is(err, ErrGasLimitReached) {
+		t.Fatalf("expected ErrGasLimitReached, got %v", err)
+	}
+	var (
+		sender   = statedb.GetBalance(from).Uint64()
+		coinbase = statedb.GetBalance(common.Address{}).Uint64()
+	)
+	receipt, err = apply(&config, header2, reveals[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.GasUsed == 0 || receipt.GasUsed >= 100_000 {
+		t.Fatalf("reveal: status %d, gas used %d", receipt.Status, receipt.GasUsed)
+	}
+	// The gas left over is refunded at the committed price of 2, the revealing
+	// block gets the tip of 1 on the gas used
+	if refund, want := statedb.GetBalance(from).Uint64()+7-sender, 2*(committed.Gas-receipt.GasUsed); refund != want {
+		t.Errorf("reveal refund: got %d, want %d", refund, want)
+	}
+	if fee := statedb.GetBalance(common.Address{}).Uint64() - coinbase; fee != receipt.GasUsed {
+		t.Errorf("reveal fee: got %d, want %d", fee, receipt.GasUsed)
+	}
+	if value := statedb.GetState(target, common.Hash{}); value != common.BigToHash(call.Value) {
+		t.Errorf("call value: got %x, want 7", value)
+	}
+	if input := statedb.GetState(target, common.BigToHash(common.Big1)); input != common.BytesToHash(call.Data) {
+		t.Errorf("call input: got %x, want %x", input, call.Data)
+	}
+	// A transaction is only revealed once
+	if _, err := apply(&config, header2, reveals[0]); !errors.Is(err, ErrEncryptedTxNotCommitted) {
+		t.Fatalf("expected ErrEncryptedTxNotCommitted, got %v", err)
+	}
+	// Transactions without shares expire after the reveal window
+	committed, _ = vm.NextEncryptedTx(statedb)
+	block2 := types.NewBlock(header2, &types.Body{Transactions: types.Transactions{commit2, reveals[0]}}, nil, trie.NewStackTrie(nil))
+	chain[block2.Hash()] = block2
+	parent := block2.Header()
+	for number := int64(3); number < 2+EncryptedTxRevealWindow; number++ {
+		block := types.NewBlockWithHeader(newHeader(number, parent.Hash()))
+		chain[block.Hash()] = block
+		parent = block.Header()
+	}
+	expired := EncryptedTxReveals(&config, chain, parent, statedb, nil)
+	if len(expired) != 1 || len(expired[0].DecryptionShares()) != 0 {
+		t.Fatalf("%d expired reveals", len(expired))
+	}
+	sender = statedb.GetBalance(from).Uint64()
+	receipt, err = apply(&config, newHeader(2+EncryptedTxRevealWindow, parent.Hash()), expired[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusFailed {
+		t.Error("expired transaction executed")
+	}
+	if refund := statedb.GetBalance(from).Uint64() - sender; refund != 2*committed.Gas {
+		t.Errorf("expiry refund: got %d, want %d", refund, 2*committed.Gas)
+	}
+	if _, ok := vm.NextEncryptedTx(statedb); ok {
+		t.Error("expired transaction still queued")
+	}
+	if balance := statedb.GetBalance(target); balance.Uint64() != 7 {
+		t.Errorf("target balance: got %v, want 7", balance)
+	}
+}
+
+// Tests that a block and a sender commit a bounded number of encrypted
+// transactions, that transactions waiting for their shares do not hold back
+// other transactions, and that expired ones are dropped before anything else.
+func TestEncryptedTxLiveness(t *testing.T) {
+	var (
+		config  = *params.TestChainConfig
+		chain   = make(testEncryptedTxChain)
+		senders = make([]*ecdsa.PrivateKey, MaxEncryptedTxsPerBlock/MaxPendingEncryptedTxsPerSender+1)
+		nonces  = make(map[*ecdsa.PrivateKey]uint64)
+	)
+	secret, _ := crypto.GenerateKey()
+	txKey, _, err := vm.SplitThresholdKey(crypto.FromECDSA(secret), 2, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupKey, _ := crypto.DecompressPubkey(txKey.GroupKey())
+	config.SGX = &params.SGXConfig{TransactionKey: txKey.Encode()}
+	config.SGXEncryptedTxBlock = common.Big0
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	for i := range senders {
+		senders[i], _ = crypto.GenerateKey()
+		statedb.SetBalance(crypto.PubkeyToAddress(senders[i].PublicKey), uint256.NewInt(params.Ether), tracing.BalanceChangeUnspecified)
+	}
+	newHeader := func(number int64, parent common.Hash) *types.Header {
+		return &types.Header{ParentHash: parent, Number: big.NewInt(number), Difficulty: big.NewInt(1), GasLimit: 30_000_000, BaseFee: big.NewInt(1)}
+	}
+	apply := func(header *types.Header, key *ecdsa.PrivateKey, tx *types.Transaction) error {
+		var usedGas uint64
+		evm := vm.NewEVM(NewEVMBlockContext(header, nil, &common.Address{}), statedb, &config, vm.Config{})
+		_, err := ApplyTransaction(evm, new(GasPool).AddGas(header.GasLimit), statedb, header, tx, &usedGas)
+		if err == nil && key != nil {
+			nonces[key]++
+		}
+		return err
+	}
+	encrypted := func(header *types.Header, key *ecdsa.PrivateKey) *types.Transaction {
+		from := crypto.PubkeyToAddress(key.PublicKey)
+		payload, err := types.EncryptTxCall(rand.Reader, groupKey, config.ChainID, from, nonces[key], &types.EncryptedCall{To: common.Address{0xaa}, Value: new(big.Int)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.MustSignNewTx(key, types.MakeSigner(&config, header.Number, header.Time), &types.EncryptedTx{
+			ChainID:   config.ChainID,
+			Nonce:     nonces[key],
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(10),
+			Gas:       100_000,
+			Payload:   payload,
+		})
+	}
+	plain := func(header *types.Header, key *ecdsa.PrivateKey) *types.Transaction {
+		return types.MustSignNewTx(key, types.MakeSigner(&config, header.Number, header.Time), &types.DynamicFeeTx{
+			ChainID:   config.ChainID,
+			Nonce:     nonces[key],
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(10),
+			Gas:       params.TxGas,
+			To:        &common.Address{0xbb},
+		})
+	}
+	// A sender has at most MaxPendingEncryptedTxsPerSender transactions pending
+	var (
+		header1 = newHeader(1, common.Hash{})
+		last    = senders[len(senders)-1]
+		txs     types.Transactions
+	)
+	for _, key := range senders[:len(senders)-1] {
+		for i := 0; i < MaxPendingEncryptedTxsPerSender; i++ {
+			tx := encrypted(header1, key)
+			if err := apply(header1, key, tx); err != nil {
+				t.Fatalf("commit %d: %v", len(txs), err)
+			}
+			txs = append(txs, tx)
+		}
+		if len(txs) < MaxEncryptedTxsPerBlock {
+			if err := apply(header1, key, encrypted(header1, key)); !errors.Is(err, ErrEncryptedTxSenderLimit) {
+				t.Fatalf("expected ErrEncryptedTxSenderLimit, got %v", err)
+			}
+		}
+	}
+	// A block commits at most MaxEncryptedTxsPerBlock encrypted transactions
+	if err := apply(header1, last, encrypted(header1, last)); !errors.Is(err, ErrEncryptedTxLimit) {
+		t.Fatalf("expected ErrEncryptedTxLimit, got %v", err)
+	}
+	block1 := types.NewBlock(header1, &types.Body{Transactions: txs}, nil, trie.NewStackTrie(nil))
+	chain[block1.Hash()] = block1
+
+	// Without shares, the blocks of the reveal window include other transactions
+	parent := block1.Header()
+	for number := int64(2); number < 1+EncryptedTxRevealWindow; number++ {
+		header := newHeader(number, parent.Hash())
+		if reveals := EncryptedTxReveals(&config, chain, parent, statedb, nil); len(reveals) != 0 {
+			t.Fatalf("block %d: %d reveals", number, len(reveals))
+		}
+		tx := plain(header, last)
+		if err := apply(header, last, tx); err != nil {
+			t.Fatalf("block %d: %v", number, err)
+		}
+		block := types.NewBlock(header, &types.Body{Transactions: types.Transactions{tx}}, nil, trie.NewStackTrie(nil))
+		chain[block.Hash()] = block
+		parent = block.Header()
+	}
+	// The first block past the window expires all of them before anything else
+	header := newHeader(1+EncryptedTxRevealWindow, parent.Hash())
+	if err := apply(header, last, plain(header, last)); !errors.Is(err, ErrEncryptedTxUnrevealed) {
+		t.Fatalf("expected ErrEncryptedTxUnrevealed, got %v", err)
+	}
+	expired := EncryptedTxReveals(&config, chain, parent, statedb, nil)
+	if len(expired) != MaxEncryptedTxsPerBlock {
+		t.Fatalf("%d expired reveals", len(expired))
+	}
+	for _, tx := range expired {
+		if err := apply(header, nil, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := apply(header, last, plain(header, last)); err != nil {
+		t.Fatalf("transaction after expiry: %v", err)
+	}
+	if err := apply(header, senders[0], encrypted(header, senders[0])); err != nil {
+		t.Fatalf("commit after expiry: %v", err)
+	}
+}
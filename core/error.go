@@ -132,6 +132,45 @@ var (
 
 	// -- EIP-7825 errors --
 	ErrGasLimitTooHigh = errors.New("transaction gas limit too high")
+
+	// -- SGX encrypted transaction errors --
+
+	// ErrEncryptedTxUnsupported is returned for encrypted transactions on chains
+	// without a transaction key.
+	ErrEncryptedTxUnsupported = errors.New("encrypted transactions unsupported")
+
+	// ErrEncryptedTxInvalid is the execution error of a revealed encrypted
+	// transaction whose payload does not decrypt to a call.
+	ErrEncryptedTxInvalid = errors.New("invalid encrypted transaction")
+
+	// ErrEncryptedTxPayload is returned if the payload of an encrypted
+	// transaction is malformed or lacks a valid proof of its ephemeral key.
+	ErrEncryptedTxPayload = errors.New("invalid encrypted transaction payload")
+
+	// ErrEncryptedTxUnrevealed is returned for transactions included while
+	// encrypted transactions past their reveal window are not expired yet.
+	ErrEncryptedTxUnrevealed = errors.New("committed encrypted transactions not revealed")
+
+	// ErrEncryptedTxLimit is returned for encrypted transactions beyond the
+	// maximum a block commits.
+	ErrEncryptedTxLimit = errors.New("too many encrypted transactions in block")
+
+	// ErrEncryptedTxSenderLimit is returned for encrypted transactions beyond
+	// the maximum a sender has waiting to be revealed.
+	ErrEncryptedTxSenderLimit = errors.New("too many pending encrypted transactions of sender")
+
+	// ErrEncryptedTxNotCommitted is returned for reveals that do not match the
+	// next committed encrypted transaction.
+	ErrEncryptedTxNotCommitted = errors.New("encrypted transaction not committed")
+
+	// ErrEncryptedTxShares is returned for reveals whose decryption shares are
+	// invalid, or that lack shares before the reveal window of the encrypted
+	// transaction has passed.
+	ErrEncryptedTxShares = errors.New("invalid decryption shares")
+
+	// ErrEncryptedTxExpired is the execution error of an encrypted transaction
+	// not revealed within the reveal window.
+	ErrEncryptedTxExpired = errors.New("encrypted transaction expired")
 )
 
 // EIP-7702 state transition errors.
@@ -48,7 +48,13 @@ func NewEVMBlockContext(header *types.Header, chain ChainContext, author *common
 
 	// If we don't have an explicit author (i.e. not mining), extract from the header
 	if author == nil {
-		beneficiary, _ = chain.Engine().Author(header) // Ignore error, we're past header validation
+		if chain.Config().SGX != nil {
+			// SGX chains collect the fees in the incentive contract set as
+			// coinbase, not with the producer authoring the block
+			beneficiary = header.Coinbase
+		} else {
+			beneficiary, _ = chain.Engine().Author(header) // Ignore error, we're past header validation
+		}
 	} else {
 		beneficiary = *author
 	}
@@ -73,6 +79,10 @@ func NewEVMBlockContext(header *types.Header, chain ChainContext, author *common
 		BlobBaseFee: blobBaseFee,
 		GasLimit:    header.GasLimit,
 		Random:      random,
+
+		// The SGX engine commits a verifiable random output to the mix
+		// digest, the SGX precompiles only exist on such chains
+		SGXRandomness: header.MixDigest,
 	}
 }
 
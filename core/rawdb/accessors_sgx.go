@@ -0,0 +1,66 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ReadSGXSignedSeal retrieves the seal hash of the block the local SGX
+// producer signed at the given number on top of parent, if any.
+func ReadSGXSignedSeal(db ethdb.KeyValueReader, number uint64, parent common.Hash) (common.Hash, bool) {
+	data, _ := db.Get(sgxSignedSealKey(number, parent))
+	if len(data) != common.HashLength {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(data), true
+}
+
+// WriteSGXSignedSeal stores the seal hash of a block the local SGX producer
+// signed at the given number on top of parent.
+func WriteSGXSignedSeal(db ethdb.KeyValueWriter, number uint64, parent common.Hash, sealHash common.Hash) {
+	if err := db.Put(sgxSignedSealKey(number, parent), sealHash.Bytes()); err != nil {
+		log.Crit("Failed to store SGX signed seal", "err", err)
+	}
+}
+
+// DeleteSGXSignedSealsBelow removes the signed seals of all numbers below the
+// given limit.
+func DeleteSGXSignedSealsBelow(db ethdb.KeyValueStore, limit uint64) {
+	it := db.NewIterator(SGXSignedSealPrefix, nil)
+	defer it.Release()
+
+	batch := db.NewBatch()
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SGXSignedSealPrefix)+8+common.HashLength {
+			continue
+		}
+		// Keys are ordered by number, so the first one at the limit ends the scan
+		if binary.BigEndian.Uint64(key[len(SGXSignedSealPrefix):]) >= limit {
+			break
+		}
+		batch.Delete(common.CopyBytes(key))
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to delete SGX signed seals", "err", err)
+	}
+}
@@ -423,6 +423,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		preimages          stat
 		beaconHeaders      stat
 		cliqueSnaps        stat
+		sgxSignedSeals     stat
 		bloomBits          stat
 		filterMapRows      stat
 		filterMapLastBlock stat
@@ -509,6 +510,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 				beaconHeaders.add(size)
 			case bytes.HasPrefix(key, CliqueSnapshotPrefix) && len(key) == 7+common.HashLength:
 				cliqueSnaps.add(size)
+			case bytes.HasPrefix(key, SGXSignedSealPrefix) && len(key) == len(SGXSignedSealPrefix)+8+common.HashLength:
+				sgxSignedSeals.add(size)
 
 			// new log index
 			case bytes.HasPrefix(key, filterMapRowPrefix) && len(key) <= len(filterMapRowPrefix)+9:
@@ -643,6 +646,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Historical trie index", trienodeIndex.sizeString(), trienodeIndex.countString()},
 		{"Key-Value store", "Beacon sync headers", beaconHeaders.sizeString(), beaconHeaders.countString()},
 		{"Key-Value store", "Clique snapshots", cliqueSnaps.sizeString(), cliqueSnaps.countString()},
+		{"Key-Value store", "SGX signed seals", sgxSignedSeals.sizeString(), sgxSignedSeals.countString()},
 		{"Key-Value store", "Singleton metadata", metadata.sizeString(), metadata.countString()},
 	}
 
@@ -147,6 +147,10 @@ var (
 
 	CliqueSnapshotPrefix = []byte("clique-")
 
+	SGXKeyJournalPrefix = []byte("sgx-keys-")   // SGXKeyJournalPrefix + num (uint64 big endian) + hash -> SGX key store changes of a written block
+	SGXKeyHeadKey       = []byte("LastSGXKeys") // num (uint64 big endian) + hash of the block whose SGX key store changes were written last
+	SGXSignedSealPrefix = []byte("sgx-signed-") // SGXSignedSealPrefix + num (uint64 big endian) + parent hash -> seal hash of the block the local SGX producer signed
+
 	BestUpdateKey         = []byte("update-")    // bigEndian64(syncPeriod) -> RLP(types.LightClientUpdate)  (nextCommittee only referenced by root hash)
 	FixedCommitteeRootKey = []byte("fixedRoot-") // bigEndian64(syncPeriod) -> committee root hash
 	SyncCommitteeKey      = []byte("committee-") // bigEndian64(syncPeriod) -> serialized committee
@@ -455,6 +459,13 @@ func trienodeHistoryIndexBlockKey(addressHash common.Hash, path []byte, blockID
 	return out
 }
 
+// sgxSignedSealKey = SGXSignedSealPrefix + num (uint64 big endian) + parent hash
+func sgxSignedSealKey(number uint64, parent common.Hash) []byte {
+	key := append([]byte{}, SGXSignedSealPrefix...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return append(key, parent.Bytes()...)
+}
+
 // transitionStateKey = transitionStatusKey + hash
 func transitionStateKey(hash common.Hash) []byte {
 	return append(VerkleTransitionStatePrefix, hash.Bytes()...)
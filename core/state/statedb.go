@@ -351,6 +351,11 @@ func (s *StateDB) GetStorageRoot(addr common.Address) common.Hash {
 	return common.Hash{}
 }
 
+// TxHash returns the current transaction hash set by SetTxContext.
+func (s *StateDB) TxHash() common.Hash {
+	return s.thash
+}
+
 // TxIndex returns the current transaction index set by SetTxContext.
 func (s *StateDB) TxIndex() int {
 	return s.txIndex
@@ -154,6 +154,10 @@ func (s *hookedStateDB) AddPreimage(hash common.Hash, bytes []byte) {
 	s.inner.AddPreimage(hash, bytes)
 }
 
+func (s *hookedStateDB) TxHash() common.Hash {
+	return s.inner.TxHash()
+}
+
 func (s *hookedStateDB) Witness() *stateless.Witness {
 	return s.inner.Witness()
 }
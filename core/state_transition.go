@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/tracing"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/kzg4844"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
@@ -170,6 +171,15 @@ type Message struct {
 	// - From is not verified to be an EOA
 	// - GasLimit is not checked against the protocol defined tx gaslimit
 	SkipTransactionChecks bool
+
+	// Encrypted is set for SGX encrypted transactions, whose Data is the
+	// encrypted call to commit.
+	Encrypted bool
+
+	// Reveal is set for the reveals of committed encrypted transactions, whose
+	// Data is the committed payload, decrypted with the DecryptionShares.
+	Reveal           bool
+	DecryptionShares [][]byte
 }
 
 // TransactionToMessage converts a transaction into a Message.
@@ -189,6 +199,9 @@ func TransactionToMessage(tx *types.Transaction, s types.Signer, baseFee *big.In
 		SkipTransactionChecks: false,
 		BlobHashes:            tx.BlobHashes(),
 		BlobGasFeeCap:         tx.BlobGasFeeCap(),
+		Encrypted:             tx.Type() == types.EncryptedTxType,
+		Reveal:                tx.Type() == types.EncryptedRevealTxType,
+		DecryptionShares:      tx.DecryptionShares(),
 	}
 	// If baseFee provided, set gasPrice to effectiveGasPrice.
 	if baseFee != nil {
@@ -263,6 +276,172 @@ func (st *stateTransition) to() common.Address {
 	return *st.msg.To
 }
 
+// checkEncryptedTxs rejects encrypted transactions the chain cannot reveal
+// and transactions included while encrypted transactions committed in earlier
+// blocks are past their reveal window.
+//
+// Committed transactions waiting for their decryption shares do not hold back
+// other transactions, but once the reveal window of a transaction has passed
+// it is expired, which needs no shares and no gas, before anything else is
+// included. A block commits at most MaxEncryptedTxsPerBlock transactions, so
+// the queue holds the commitments of at most one reveal window, of which a
+// sender has at most MaxPendingEncryptedTxsPerSender.
+func (st *stateTransition) checkEncryptedTxs() error {
+	config := st.evm.ChainConfig()
+	if st.msg.Encrypted {
+		if _, err := vm.TransactionKeyParams(config); err != nil {
+			return fmt.Errorf("%w: %v", ErrEncryptedTxUnsupported, err)
+		}
+		sharedInfo := types.EncryptedTxSharedInfo(config.ChainID, st.msg.From, st.msg.Nonce)
+		if err := types.VerifyEncryptedTxPayload(st.msg.Data, sharedInfo); err != nil {
+			return fmt.Errorf("%w: %v", ErrEncryptedTxPayload, err)
+		}
+	}
+	if st.msg.SkipTransactionChecks || !config.IsSGXEncryptedTx(st.evm.Context.BlockNumber) {
+		return nil
+	}
+	number := st.evm.Context.BlockNumber.Uint64()
+	if next, ok := vm.NextEncryptedTx(st.state); ok && number >= next.Number+EncryptedTxRevealWindow {
+		return fmt.Errorf("%w: transaction %d of block %d expired", ErrEncryptedTxUnrevealed, next.Index, next.Number)
+	}
+	if !st.msg.Encrypted {
+		return nil
+	}
+	if vm.CommittedEncryptedTxCount(st.state, number) >= MaxEncryptedTxsPerBlock {
+		return fmt.Errorf("%w: %d committed", ErrEncryptedTxLimit, MaxEncryptedTxsPerBlock)
+	}
+	if vm.PendingEncryptedTxsOf(st.state, st.msg.From) >= MaxPendingEncryptedTxsPerSender {
+		return fmt.Errorf("%w: sender %v has %d pending", ErrEncryptedTxSenderLimit, st.msg.From.Hex(), MaxPendingEncryptedTxsPerSender)
+	}
+	return nil
+}
+
+// commitEncrypted queues an encrypted transaction for its reveal in a later
+// block and returns the gas reserved for the revealed call: the gas remaining
+// after the intrinsic gas. The reserved gas counts as used by the committing
+// block, but is neither refunded nor paid to the block now. Its fee is settled
+// when the call is revealed.
+func (st *stateTransition) commitEncrypted() uint64 {
+	reserved := st.gasRemaining
+	vm.CommitEncryptedTx(st.state, &vm.EncryptedTxCommitment{
+		From:        st.msg.From,
+		Nonce:       st.msg.Nonce,
+		Gas:         reserved,
+		GasPrice:    new(big.Int).Set(st.msg.GasPrice),
+		Number:      st.evm.Context.BlockNumber.Uint64(),
+		PayloadHash: crypto.Keccak256Hash(st.msg.Data),
+	})
+	if t := st.evm.Config.Tracer; t != nil && t.OnGasChange != nil {
+		t.OnGasChange(st.gasRemaining, 0, tracing.GasChangeUnspecified)
+	}
+	st.gasRemaining = 0
+	return reserved
+}
+
+// executeReveal executes the call of the next committed encrypted transaction,
+// decrypted with the decryption shares of the reveal. The call runs with the
+// gas reserved when the transaction was committed and counts the gas it uses
+// against the revealing block, which settles the reserved gas like refundGas.
+// Calls that do not decrypt, or expired without shares, fail without executing
+// and get all of their reserved gas back.
+func (st *stateTransition) executeReveal() (*ExecutionResult, error) {
+	var (
+		msg    = st.msg
+		config = st.evm.ChainConfig()
+		number = st.evm.Context.BlockNumber.Uint64()
+	)
+	committed, ok := vm.NextEncryptedTx(st.state)
+	if !ok || committed.Number >= number || committed.From != msg.From || committed.Nonce != msg.Nonce || committed.PayloadHash != crypto.Keccak256Hash(msg.Data) {
+		return nil, fmt.Errorf("%w: sender %v nonce %d", ErrEncryptedTxNotCommitted, msg.From.Hex(), msg.Nonce)
+	}
+	var (
+		call    *types.EncryptedCall
+		callErr error
+	)
+	if len(msg.DecryptionShares) == 0 {
+		if number < committed.Number+EncryptedTxRevealWindow {
+			return nil, fmt.Errorf("%w: none within the reveal window", ErrEncryptedTxShares)
+		}
+		callErr = ErrEncryptedTxExpired
+	} else {
+		key, err := vm.TransactionKeyParams(config)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEncryptedTxUnsupported, err)
+		}
+		shared, err := vm.CombineDecryptionShares(key, types.EncryptedTxEphemeralKey(msg.Data), msg.DecryptionShares)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEncryptedTxShares, err)
+		}
+		call, err = types.DecryptTxCall(msg.Data, shared, types.EncryptedTxSharedInfo(config.ChainID, msg.From, msg.Nonce))
+		switch {
+		case err != nil:
+			callErr = fmt.Errorf("%w: %v", ErrEncryptedTxInvalid, err)
+		case call.Value.BitLen() > 256:
+			callErr = fmt.Errorf("%w: value overflows uint256", ErrEncryptedTxInvalid)
+		}
+	}
+	if callErr == nil {
+		if err := st.gp.SubGas(committed.Gas); err != nil {
+			return nil, err
+		}
+	}
+	vm.PopEncryptedTx(st.state)
+	if callErr != nil {
+		st.settleReveal(committed, committed.Gas)
+		return &ExecutionResult{Err: callErr}, nil
+	}
+	revealed := *msg
+	revealed.To, revealed.Value, revealed.Data = &call.To, call.Value, call.Data
+	revealed.GasLimit, revealed.GasPrice = committed.Gas, committed.GasPrice
+	st.msg = &revealed
+	st.evm.SetTxContext(NewEVMTxContext(st.msg))
+
+	value, _ := uint256.FromBig(call.Value)
+	if !value.IsZero() && !st.evm.Context.CanTransfer(st.state, msg.From, value) {
+		st.gp.AddGas(committed.Gas)
+		st.settleReveal(committed, committed.Gas)
+		return &ExecutionResult{Err: ErrInsufficientFundsForTransfer}, nil
+	}
+	rules := config.Rules(st.evm.Context.BlockNumber, st.evm.Context.Random != nil, st.evm.Context.Time)
+	st.state.Prepare(rules, msg.From, st.evm.Context.Coinbase, &call.To, vm.ActivePrecompiles(rules), nil)
+	if addr, ok := types.ParseDelegation(st.state.GetCode(call.To)); ok {
+		st.state.AddAddressToAccessList(addr)
+	}
+	ret, leftover, vmerr := st.evm.Call(msg.From, call.To, call.Data, committed.Gas, value)
+	st.gp.AddGas(leftover)
+	st.settleReveal(committed, leftover)
+	return &ExecutionResult{
+		UsedGas:    committed.Gas - leftover,
+		MaxUsedGas: committed.Gas - leftover,
+		Err:        vmerr,
+		ReturnData: ret,
+	}, nil
+}
+
+// settleReveal settles the gas reserved by a committed encrypted transaction
+// once its call has run. As in refundGas, the sender gets the gas left over
+// back at the committed gas price. The revealing block receives the tip of the
+// gas used over its base fee, and the rest of the gas used is burnt.
+func (st *stateTransition) settleReveal(committed *vm.EncryptedTxCommitment, leftover uint64) {
+	refund := uint256.NewInt(leftover)
+	refund.Mul(refund, uint256.MustFromBig(committed.GasPrice))
+	st.state.AddBalance(committed.From, refund, tracing.BalanceIncreaseGasReturn)
+
+	tip := new(big.Int).Set(committed.GasPrice)
+	if st.evm.ChainConfig().IsLondon(st.evm.Context.BlockNumber) {
+		tip.Sub(tip, st.evm.Context.BaseFee)
+	}
+	if tip.Sign() <= 0 || leftover == committed.Gas {
+		return
+	}
+	fee := uint256.NewInt(committed.Gas - leftover)
+	fee.Mul(fee, uint256.MustFromBig(tip))
+	st.state.AddBalance(st.evm.Context.Coinbase, fee, tracing.BalanceIncreaseRewardTransactionFee)
+	if st.evm.ChainConfig().SGX != nil {
+		vm.AddBlockFees(st.state, st.evm.Context.Coinbase, fee)
+	}
+}
+
 func (st *stateTransition) buyGas() error {
 	mgval := new(big.Int).SetUint64(st.msg.GasLimit)
 	mgval.Mul(mgval, st.msg.GasPrice)
@@ -430,6 +609,12 @@ func (st *stateTransition) execute() (*ExecutionResult, error) {
 	// 5. there is no overflow when calculating intrinsic gas
 	// 6. caller has enough balance to cover asset transfer for **topmost** call
 
+	if st.msg.Reveal {
+		return st.executeReveal()
+	}
+	if err := st.checkEncryptedTxs(); err != nil {
+		return nil, err
+	}
 	// Check clauses 1-3, buy gas if everything is correct
 	if err := st.preCheck(); err != nil {
 		return nil, err
@@ -447,6 +632,9 @@ func (st *stateTransition) execute() (*ExecutionResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	if msg.Encrypted {
+		gas += EncryptedTxProofGas
+	}
 	if st.gasRemaining < gas {
 		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, st.gasRemaining, gas)
 	}
@@ -493,8 +681,9 @@ func (st *stateTransition) execute() (*ExecutionResult, error) {
 	st.state.Prepare(rules, msg.From, st.evm.Context.Coinbase, msg.To, vm.ActivePrecompiles(rules), msg.AccessList)
 
 	var (
-		ret   []byte
-		vmerr error // vm errors do not effect consensus and are therefore not assigned to err
+		ret      []byte
+		vmerr    error  // vm errors do not effect consensus and are therefore not assigned to err
+		reserved uint64 // gas of a committed encrypted call, paid for when revealed
 	)
 	if contractCreation {
 		ret, _, st.gasRemaining, vmerr = st.evm.Create(msg.From, msg.Data, st.gasRemaining, value)
@@ -519,8 +708,12 @@ func (st *stateTransition) execute() (*ExecutionResult, error) {
 			st.state.AddAddressToAccessList(addr)
 		}
 
-		// Execute the transaction's call.
-		ret, st.gasRemaining, vmerr = st.evm.Call(msg.From, st.to(), msg.Data, st.gasRemaining, value)
+		// Execute the transaction's call, or commit an encrypted one.
+		if msg.Encrypted {
+			reserved = st.commitEncrypted()
+		} else {
+			ret, st.gasRemaining, vmerr = st.evm.Call(msg.From, st.to(), msg.Data, st.gasRemaining, value)
+		}
 	}
 
 	// Record the gas used excluding gas refunds. This value represents the actual
@@ -555,9 +748,12 @@ func (st *stateTransition) execute() (*ExecutionResult, error) {
 		// are 0. This avoids a negative effectiveTip being applied to
 		// the coinbase when simulating calls.
 	} else {
-		fee := new(uint256.Int).SetUint64(st.gasUsed())
+		fee := new(uint256.Int).SetUint64(st.gasUsed() - reserved)
 		fee.Mul(fee, effectiveTipU256)
 		st.state.AddBalance(st.evm.Context.Coinbase, fee, tracing.BalanceIncreaseRewardTransactionFee)
+		if st.evm.ChainConfig().SGX != nil {
+			vm.AddBlockFees(st.state, st.evm.Context.Coinbase, fee)
+		}
 
 		// add the coinbase to the witness iff the fee is greater than 0
 		if rules.IsEIP4762 && fee.Sign() != 0 {
@@ -41,10 +41,11 @@ var (
 type ValidationOptions struct {
 	Config *params.ChainConfig // Chain configuration to selectively validate based on current fork rules
 
-	Accept       uint8    // Bitmap of transaction types that should be accepted for the calling pool
-	MaxSize      uint64   // Maximum size of a transaction that the caller can meaningfully handle
-	MaxBlobCount int      // Maximum number of blobs allowed per transaction
-	MinTip       *big.Int // Minimum gas tip needed to allow a transaction into the caller pool
+	Accept          uint8    // Bitmap of transaction types that should be accepted for the calling pool
+	AcceptEncrypted bool     // Whether SGX encrypted transactions, outside the bitmap range, are accepted
+	MaxSize         uint64   // Maximum size of a transaction that the caller can meaningfully handle
+	MaxBlobCount    int      // Maximum number of blobs allowed per transaction
+	MinTip          *big.Int // Minimum gas tip needed to allow a transaction into the caller pool
 }
 
 // ValidationFunction is an method type which the pools use to perform the tx-validations which do not
@@ -60,7 +61,11 @@ type ValidationFunction func(tx *types.Transaction, head *types.Header, signer t
 // rules without duplicating code and running the risk of missed updates.
 func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types.Signer, opts *ValidationOptions) error {
 	// Ensure transactions not implemented by the calling pool are rejected
-	if opts.Accept&(1<<tx.Type()) == 0 {
+	if tx.Type() == types.EncryptedTxType {
+		if !opts.AcceptEncrypted {
+			return fmt.Errorf("%w: tx type %v not supported by this pool", core.ErrTxTypeNotSupported, tx.Type())
+		}
+	} else if opts.Accept&(1<<tx.Type()) == 0 {
 		return fmt.Errorf("%w: tx type %v not supported by this pool", core.ErrTxTypeNotSupported, tx.Type())
 	}
 	if blobCount := len(tx.BlobHashes()); blobCount > opts.MaxBlobCount {
@@ -85,6 +90,9 @@ func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types
 	if !rules.IsPrague && tx.Type() == types.SetCodeTxType {
 		return fmt.Errorf("%w: type %d rejected, pool not yet in Prague", core.ErrTxTypeNotSupported, tx.Type())
 	}
+	if !rules.IsSGXEncryptedTx && tx.Type() == types.EncryptedTxType {
+		return fmt.Errorf("%w: type %d rejected, pool not yet accepting encrypted transactions", core.ErrTxTypeNotSupported, tx.Type())
+	}
 	// Check whether the init code size has been exceeded
 	if rules.IsShanghai && tx.To() == nil && len(tx.Data()) > params.MaxInitCodeSize {
 		return fmt.Errorf("%w: code size %v, limit %v", core.ErrMaxInitCodeSizeExceeded, len(tx.Data()), params.MaxInitCodeSize)
@@ -126,6 +134,9 @@ func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types
 	if err != nil {
 		return err
 	}
+	if tx.Type() == types.EncryptedTxType {
+		intrGas += core.EncryptedTxProofGas
+	}
 	if tx.Gas() < intrGas {
 		return fmt.Errorf("%w: gas %v, minimum needed %v", core.ErrIntrinsicGas, tx.Gas(), intrGas)
 	}
@@ -151,6 +162,14 @@ func ValidateTransaction(tx *types.Transaction, head *types.Header, signer types
 			return errors.New("set code tx must have at least one authorization tuple")
 		}
 	}
+	// The call of encrypted transactions is only decrypted once they are
+	// committed in a block, check that the sender knows the ephemeral key
+	if tx.Type() == types.EncryptedTxType {
+		from, _ := types.Sender(signer, tx) // already validated
+		if err := types.VerifyEncryptedTxPayload(tx.Data(), types.EncryptedTxSharedInfo(tx.ChainId(), from, tx.Nonce())); err != nil {
+			return fmt.Errorf("%w: %v", core.ErrEncryptedTxPayload, err)
+		}
+	}
 	return nil
 }
 
@@ -18,6 +18,7 @@ package txpool
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
 	"errors"
 	"math"
 	"math/big"
@@ -113,3 +114,69 @@ func createTestTransaction(key *ecdsa.PrivateKey, nonce uint64) *types.Transacti
 	signedTx, _ := types.SignTx(tx, types.HomesteadSigner{}, key)
 	return signedTx
 }
+
+func TestValidateEncryptedTransaction(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := &types.Header{
+		Number:     big.NewInt(1),
+		GasLimit:   5000000,
+		Time:       1,
+		Difficulty: big.NewInt(1),
+	}
+	config := *params.TestChainConfig
+	config.SGX = &params.SGXConfig{}
+	config.SGXEncryptedTxBlock = big.NewInt(1)
+	preFork := config
+	preFork.SGXEncryptedTxBlock = big.NewInt(2)
+
+	txKey, _ := crypto.GenerateKey()
+	call := &types.EncryptedCall{To: common.Address{0x01}, Value: big.NewInt(1)}
+	payload, err := types.EncryptTxCall(rand.Reader, &txKey.PublicKey, config.ChainID, crypto.PubkeyToAddress(key.PublicKey), 0, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := types.EncryptTxCall(rand.Reader, &txKey.PublicKey, config.ChainID, common.Address{0x02}, 0, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *params.ChainConfig
+		accept  bool
+		payload []byte
+		wantErr error
+	}{
+		{"valid envelope", &config, true, payload, nil},
+		{"not accepted by the pool", &config, false, payload, core.ErrTxTypeNotSupported},
+		{"before the fork", &preFork, true, payload, core.ErrTxTypeNotSupported},
+		{"short payload", &config, true, payload[:types.EncryptedTxMinPayload-1], core.ErrEncryptedTxPayload},
+		{"payload of another sender", &config, true, copied, core.ErrEncryptedTxPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := types.LatestSigner(tt.config)
+			tx := types.MustSignNewTx(key, signer, &types.EncryptedTx{
+				ChainID:   tt.config.ChainID,
+				GasTipCap: big.NewInt(1),
+				GasFeeCap: big.NewInt(1),
+				Gas:       100000,
+				Payload:   tt.payload,
+			})
+			opts := &ValidationOptions{
+				Config:          tt.config,
+				Accept:          0xFF,
+				AcceptEncrypted: tt.accept,
+				MaxSize:         32 * 1024,
+				MinTip:          big.NewInt(0),
+			}
+			err := ValidateTransaction(tx, head, signer, opts)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -50,6 +50,9 @@ const (
 	DynamicFeeTxType = 0x02
 	BlobTxType       = 0x03
 	SetCodeTxType    = 0x04
+	EncryptedTxType  = 0x50 // SGX networks only
+
+	EncryptedRevealTxType = 0x51 // SGX networks only, included by block producers
 )
 
 // Transaction is an Ethereum transaction.
@@ -212,6 +215,10 @@ func (tx *Transaction) decodeTyped(b []byte) (TxData, error) {
 		inner = new(BlobTx)
 	case SetCodeTxType:
 		inner = new(SetCodeTx)
+	case EncryptedTxType:
+		inner = new(EncryptedTx)
+	case EncryptedRevealTxType:
+		inner = new(EncryptedRevealTx)
 	default:
 		return nil, ErrTxTypeNotSupported
 	}
@@ -512,6 +519,15 @@ func (tx *Transaction) SetCodeAuthorizations() []SetCodeAuthorization {
 	return setcodetx.AuthList
 }
 
+// DecryptionShares returns the decryption shares of an encrypted reveal
+// transaction, nil otherwise.
+func (tx *Transaction) DecryptionShares() [][]byte {
+	if reveal, ok := tx.inner.(*EncryptedRevealTx); ok {
+		return reveal.Shares
+	}
+	return nil
+}
+
 // SetCodeAuthorities returns a list of unique authorities from the
 // authorization list.
 func (tx *Transaction) SetCodeAuthorities() []common.Address {
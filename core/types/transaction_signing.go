@@ -56,6 +56,9 @@ func MakeSigner(config *params.ChainConfig, blockNumber *big.Int, blockTime uint
 	default:
 		signer = FrontierSigner{}
 	}
+	if config.IsSGXEncryptedTx(blockNumber) {
+		signer = withEncryptedTxs(signer)
+	}
 	return signer
 }
 
@@ -83,6 +86,9 @@ func LatestSigner(config *params.ChainConfig) Signer {
 		default:
 			signer = HomesteadSigner{}
 		}
+		if config.SGX != nil && config.SGXEncryptedTxBlock != nil {
+			signer = withEncryptedTxs(signer)
+		}
 	} else {
 		signer = HomesteadSigner{}
 	}
@@ -234,6 +240,20 @@ func newModernSigner(chainID *big.Int, fork forks.Fork) Signer {
 	return s
 }
 
+// withEncryptedTxs returns a copy of the signer that also accepts SGX
+// encrypted transactions and their reveals. Signers predating London are
+// returned unchanged.
+func withEncryptedTxs(signer Signer) Signer {
+	s, ok := signer.(*modernSigner)
+	if !ok || !s.supportsType(DynamicFeeTxType) {
+		return signer
+	}
+	cpy := *s
+	cpy.txtypes.set(EncryptedTxType)
+	cpy.txtypes.set(EncryptedRevealTxType)
+	return &cpy
+}
+
 func (s *modernSigner) ChainID() *big.Int {
 	return s.chainID
 }
@@ -262,6 +282,11 @@ func (s *modernSigner) Sender(tx *Transaction) (common.Address, error) {
 	if tx.ChainId().Cmp(s.chainID) != 0 {
 		return common.Address{}, fmt.Errorf("%w: have %d want %d", ErrInvalidChainId, tx.ChainId(), s.chainID)
 	}
+	// Reveals are unsigned, they execute on behalf of the sender of the
+	// encrypted transaction committed in the state.
+	if reveal, ok := tx.inner.(*EncryptedRevealTx); ok {
+		return reveal.From, nil
+	}
 	// 'modern' txs are defined to use 0 and 1 as their recovery
 	// id, add 27 to become equivalent to unprotected Homestead signatures.
 	V, R, S := tx.RawSignatureValues()
@@ -277,6 +302,9 @@ func (s *modernSigner) SignatureValues(tx *Transaction, sig []byte) (R, S, V *bi
 	if tt == LegacyTxType {
 		return s.legacy.SignatureValues(tx, sig)
 	}
+	if tt == EncryptedRevealTxType {
+		return nil, nil, nil, ErrTxTypeNotSupported
+	}
 	// Check that chain ID of tx matches the signer. We also accept ID zero here,
 	// because it indicates that the chain ID was not specified in the tx.
 	if tx.inner.chainID().Sign() != 0 && tx.inner.chainID().Cmp(s.chainID) != 0 {
@@ -0,0 +1,308 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// EncryptedTxRecipient is the public recipient of all encrypted transactions.
+// The real recipient is part of the encrypted payload.
+var EncryptedTxRecipient = common.BytesToAddress([]byte{0x80, 0xff})
+
+// EncryptedTxMinPayload is the length of the smallest valid encrypted payload:
+// the compressed ephemeral public key, the proof of knowledge of its secret,
+// the GCM tag and one byte of ciphertext.
+const EncryptedTxMinPayload = encryptedTxHeader + 16 + 1
+
+// encryptedTxHeader is the length of the ephemeral key and its proof.
+const encryptedTxHeader = 33 + 32 + 32
+
+var encryptedTxDomain = []byte("sgx-encrypted-tx-v2")
+
+var errEncryptedPayload = errors.New("invalid encrypted payload")
+
+// EncryptedTx is a transaction whose call is encrypted to the threshold
+// transaction key of an SGX network. Only the fields needed to order the
+// transaction and to pay for it are public. The block including the
+// transaction only commits to it; the recipient, value and input are revealed
+// by an EncryptedRevealTx in a later block, once the holders of the key shares
+// have seen the position of the transaction fixed in a canonical block, so
+// that they cannot be used to front-run it.
+type EncryptedTx struct {
+	ChainID   *big.Int
+	Nonce     uint64
+	GasTipCap *big.Int // a.k.a. maxPriorityFeePerGas
+	GasFeeCap *big.Int // a.k.a. maxFeePerGas
+	Gas       uint64
+	Payload   []byte // Ephemeral key, its proof and the AES-GCM ciphertext of the RLP encoded EncryptedCall
+
+	// Signature values
+	V *big.Int
+	R *big.Int
+	S *big.Int
+}
+
+// EncryptedCall is the plaintext of an encrypted transaction payload.
+// Encrypted transactions cannot create contracts.
+type EncryptedCall struct {
+	To    common.Address
+	Value *big.Int
+	Data  []byte
+}
+
+// copy creates a deep copy of the transaction data and initializes all fields.
+func (tx *EncryptedTx) copy() TxData {
+	cpy := &EncryptedTx{
+		Nonce:   tx.Nonce,
+		Payload: common.CopyBytes(tx.Payload),
+		Gas:     tx.Gas,
+		// These are copied below.
+		ChainID:   new(big.Int),
+		GasTipCap: new(big.Int),
+		GasFeeCap: new(big.Int),
+		V:         new(big.Int),
+		R:         new(big.Int),
+		S:         new(big.Int),
+	}
+	if tx.ChainID != nil {
+		cpy.ChainID.Set(tx.ChainID)
+	}
+	if tx.GasTipCap != nil {
+		cpy.GasTipCap.Set(tx.GasTipCap)
+	}
+	if tx.GasFeeCap != nil {
+		cpy.GasFeeCap.Set(tx.GasFeeCap)
+	}
+	if tx.V != nil {
+		cpy.V.Set(tx.V)
+	}
+	if tx.R != nil {
+		cpy.R.Set(tx.R)
+	}
+	if tx.S != nil {
+		cpy.S.Set(tx.S)
+	}
+	return cpy
+}
+
+// accessors for innerTx.
+func (tx *EncryptedTx) txType() byte           { return EncryptedTxType }
+func (tx *EncryptedTx) chainID() *big.Int      { return tx.ChainID }
+func (tx *EncryptedTx) accessList() AccessList { return nil }
+func (tx *EncryptedTx) data() []byte           { return tx.Payload }
+func (tx *EncryptedTx) gas() uint64            { return tx.Gas }
+func (tx *EncryptedTx) gasFeeCap() *big.Int    { return tx.GasFeeCap }
+func (tx *EncryptedTx) gasTipCap() *big.Int    { return tx.GasTipCap }
+func (tx *EncryptedTx) gasPrice() *big.Int     { return tx.GasFeeCap }
+func (tx *EncryptedTx) value() *big.Int        { return new(big.Int) }
+func (tx *EncryptedTx) nonce() uint64          { return tx.Nonce }
+func (tx *EncryptedTx) to() *common.Address    { return &EncryptedTxRecipient }
+
+func (tx *EncryptedTx) effectiveGasPrice(dst *big.Int, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return dst.Set(tx.GasFeeCap)
+	}
+	tip := dst.Sub(tx.GasFeeCap, baseFee)
+	if tip.Cmp(tx.GasTipCap) > 0 {
+		tip.Set(tx.GasTipCap)
+	}
+	return tip.Add(tip, baseFee)
+}
+
+func (tx *EncryptedTx) rawSignatureValues() (v, r, s *big.Int) {
+	return tx.V, tx.R, tx.S
+}
+
+func (tx *EncryptedTx) setSignatureValues(chainID, v, r, s *big.Int) {
+	tx.ChainID, tx.V, tx.R, tx.S = chainID, v, r, s
+}
+
+func (tx *EncryptedTx) encode(b *bytes.Buffer) error {
+	return rlp.Encode(b, tx)
+}
+
+func (tx *EncryptedTx) decode(input []byte) error {
+	return rlp.DecodeBytes(input, tx)
+}
+
+func (tx *EncryptedTx) sigHash(chainID *big.Int) common.Hash {
+	return prefixedRlpHash(
+		EncryptedTxType,
+		[]any{
+			chainID,
+			tx.Nonce,
+			tx.GasTipCap,
+			tx.GasFeeCap,
+			tx.Gas,
+			tx.Payload,
+		})
+}
+
+// EncryptedTxSharedInfo returns the information binding an encrypted payload
+// to its chain, sender and nonce. A payload copied into another transaction
+// does not decrypt.
+func EncryptedTxSharedInfo(chainID *big.Int, from common.Address, nonce uint64) []byte {
+	return crypto.Keccak256(encryptedTxDomain, common.BigToHash(chainID).Bytes(), from.Bytes(), new(big.Int).SetUint64(nonce).FillBytes(make([]byte, 8)))
+}
+
+// EncryptTxCall encrypts a call to the transaction key of a network, for the
+// payload of an encrypted transaction of the sender with the given nonce.
+//
+// The payload is the compressed ephemeral public key R = r*G, a Schnorr proof
+// of knowledge of r bound to the sender and nonce, and the call encrypted with
+// AES-256-GCM under a key derived from the shared point r*Y with the
+// transaction key Y. The key holders compute the shared point from the
+// ephemeral key without learning r. The proof keeps others from committing a
+// copy of the ephemeral key to have it decrypted.
+func EncryptTxCall(rand io.Reader, key *ecdsa.PublicKey, chainID *big.Int, from common.Address, nonce uint64, call *EncryptedCall) ([]byte, error) {
+	plaintext, err := rlp.EncodeToBytes(call)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdsa.GenerateKey(crypto.S256(), rand)
+	if err != nil {
+		return nil, err
+	}
+	defer ephemeral.D.SetInt64(0)
+
+	commitment, err := ecdsa.GenerateKey(crypto.S256(), rand)
+	if err != nil {
+		return nil, err
+	}
+	defer commitment.D.SetInt64(0)
+
+	var (
+		curve      = crypto.S256()
+		n          = curve.Params().N
+		sharedInfo = EncryptedTxSharedInfo(chainID, from, nonce)
+		public     = crypto.CompressPubkey(&ephemeral.PublicKey)
+	)
+	x, y := curve.ScalarMult(key.X, key.Y, math.PaddedBigBytes(ephemeral.D, 32))
+	shared := crypto.CompressPubkey(&ecdsa.PublicKey{Curve: curve, X: x, Y: y})
+
+	// e = H(R, A, info), f = k + e*r
+	e := encryptedTxChallenge(public, crypto.CompressPubkey(&commitment.PublicKey), sharedInfo)
+	f := new(big.Int).Mul(e, ephemeral.D)
+	f.Add(f, commitment.D).Mod(f, n)
+
+	header := append(public, math.PaddedBigBytes(e, 32)...)
+	header = append(header, math.PaddedBigBytes(f, 32)...)
+
+	aead, err := encryptedTxCipher(public, shared, sharedInfo)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, make([]byte, aead.NonceSize()), plaintext, nil), nil
+}
+
+// encryptedTxChallenge computes the challenge of the proof of an ephemeral key.
+func encryptedTxChallenge(public []byte, commitment []byte, sharedInfo []byte) *big.Int {
+	e := new(big.Int).SetBytes(crypto.Keccak256(encryptedTxDomain, public, commitment, sharedInfo))
+	return e.Mod(e, crypto.S256().Params().N)
+}
+
+// VerifyEncryptedTxPayload checks that an encrypted payload is well formed and
+// that its creator knows the secret of the ephemeral key, for the sender and
+// nonce the shared information binds it to.
+func VerifyEncryptedTxPayload(payload []byte, sharedInfo []byte) error {
+	if len(payload) < EncryptedTxMinPayload {
+		return errEncryptedPayload
+	}
+	point, err := crypto.DecompressPubkey(payload[:33])
+	if err != nil {
+		return errEncryptedPayload
+	}
+	var (
+		curve = crypto.S256()
+		n     = curve.Params().N
+		e     = new(big.Int).SetBytes(payload[33:65])
+		f     = new(big.Int).SetBytes(payload[65:encryptedTxHeader])
+	)
+	if e.Sign() == 0 || e.Cmp(n) >= 0 || f.Sign() == 0 || f.Cmp(n) >= 0 {
+		return errEncryptedPayload
+	}
+	// A = f*G - e*R
+	ax, ay := curve.ScalarBaseMult(math.PaddedBigBytes(f, 32))
+	rx, ry := curve.ScalarMult(point.X, point.Y, math.PaddedBigBytes(new(big.Int).Sub(n, e), 32))
+	ax, ay = curve.Add(ax, ay, rx, ry)
+	if ax.Sign() == 0 && ay.Sign() == 0 {
+		return errEncryptedPayload
+	}
+	commitment := crypto.CompressPubkey(&ecdsa.PublicKey{Curve: curve, X: ax, Y: ay})
+	if encryptedTxChallenge(payload[:33], commitment, sharedInfo).Cmp(e) != 0 {
+		return errEncryptedPayload
+	}
+	return nil
+}
+
+// EncryptedTxEphemeralKey returns the compressed ephemeral public key of an
+// encrypted payload, or nil if the payload is too short.
+func EncryptedTxEphemeralKey(payload []byte) []byte {
+	if len(payload) < EncryptedTxMinPayload {
+		return nil
+	}
+	return payload[:33]
+}
+
+// DecryptTxCall decrypts the call of an encrypted payload with the compressed
+// shared point of its ephemeral key and the transaction key.
+func DecryptTxCall(payload []byte, shared []byte, sharedInfo []byte) (*EncryptedCall, error) {
+	public := EncryptedTxEphemeralKey(payload)
+	if public == nil {
+		return nil, errEncryptedPayload
+	}
+	aead, err := encryptedTxCipher(public, shared, sharedInfo)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, make([]byte, aead.NonceSize()), payload[encryptedTxHeader:], nil)
+	if err != nil {
+		return nil, errEncryptedPayload
+	}
+	return DecodeEncryptedCall(plaintext)
+}
+
+// encryptedTxCipher returns the cipher of an encrypted payload. The key is
+// only used once, as the ephemeral key is fresh, so the nonce is zero.
+func encryptedTxCipher(public []byte, shared []byte, sharedInfo []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(crypto.Keccak256(encryptedTxDomain, public, shared, sharedInfo))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// DecodeEncryptedCall decodes the decrypted payload of an encrypted transaction.
+func DecodeEncryptedCall(plaintext []byte) (*EncryptedCall, error) {
+	call := new(EncryptedCall)
+	if err := rlp.DecodeBytes(plaintext, call); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
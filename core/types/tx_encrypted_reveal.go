@@ -0,0 +1,104 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// EncryptedRevealTx executes the call of an encrypted transaction committed
+// in an earlier block. Reveals are not signed and never enter the transaction
+// pool: block producers include them ahead of all other transactions, in the
+// order the encrypted transactions were committed, with the decryption shares
+// the holders of the transaction key released for the committed payload.
+//
+// The gas of the call was paid by the encrypted transaction, reveals use no
+// gas of their own block.
+type EncryptedRevealTx struct {
+	ChainID *big.Int
+	From    common.Address // Sender of the encrypted transaction
+	Nonce   uint64         // Nonce of the encrypted transaction
+	Payload []byte         // Payload of the encrypted transaction
+	Shares  [][]byte       // Decryption shares of the payload, none if the transaction expired
+}
+
+// copy creates a deep copy of the transaction data and initializes all fields.
+func (tx *EncryptedRevealTx) copy() TxData {
+	cpy := &EncryptedRevealTx{
+		ChainID: new(big.Int),
+		From:    tx.From,
+		Nonce:   tx.Nonce,
+		Payload: common.CopyBytes(tx.Payload),
+		Shares:  make([][]byte, len(tx.Shares)),
+	}
+	if tx.ChainID != nil {
+		cpy.ChainID.Set(tx.ChainID)
+	}
+	for i, share := range tx.Shares {
+		cpy.Shares[i] = common.CopyBytes(share)
+	}
+	return cpy
+}
+
+// accessors for innerTx.
+func (tx *EncryptedRevealTx) txType() byte           { return EncryptedRevealTxType }
+func (tx *EncryptedRevealTx) chainID() *big.Int      { return tx.ChainID }
+func (tx *EncryptedRevealTx) accessList() AccessList { return nil }
+func (tx *EncryptedRevealTx) data() []byte           { return tx.Payload }
+func (tx *EncryptedRevealTx) gas() uint64            { return 0 }
+func (tx *EncryptedRevealTx) gasFeeCap() *big.Int    { return new(big.Int) }
+func (tx *EncryptedRevealTx) gasTipCap() *big.Int    { return new(big.Int) }
+func (tx *EncryptedRevealTx) gasPrice() *big.Int     { return new(big.Int) }
+func (tx *EncryptedRevealTx) value() *big.Int        { return new(big.Int) }
+func (tx *EncryptedRevealTx) nonce() uint64          { return tx.Nonce }
+func (tx *EncryptedRevealTx) to() *common.Address    { return &EncryptedTxRecipient }
+
+func (tx *EncryptedRevealTx) effectiveGasPrice(dst *big.Int, baseFee *big.Int) *big.Int {
+	return dst.SetUint64(0)
+}
+
+func (tx *EncryptedRevealTx) rawSignatureValues() (v, r, s *big.Int) {
+	return new(big.Int), new(big.Int), new(big.Int)
+}
+
+func (tx *EncryptedRevealTx) setSignatureValues(chainID, v, r, s *big.Int) {
+	tx.ChainID = chainID
+}
+
+func (tx *EncryptedRevealTx) encode(b *bytes.Buffer) error {
+	return rlp.Encode(b, tx)
+}
+
+func (tx *EncryptedRevealTx) decode(input []byte) error {
+	return rlp.DecodeBytes(input, tx)
+}
+
+func (tx *EncryptedRevealTx) sigHash(chainID *big.Int) common.Hash {
+	return prefixedRlpHash(
+		EncryptedRevealTxType,
+		[]any{
+			chainID,
+			tx.From,
+			tx.Nonce,
+			tx.Payload,
+			tx.Shares,
+		})
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// sgxEncryptedTxConfig returns an SGX chain config with encrypted transactions
+// enabled from the given block.
+func sgxEncryptedTxConfig(block *big.Int) *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.SGX = &params.SGXConfig{}
+	config.SGXEncryptedTxBlock = block
+	return &config
+}
+
+// Tests that encrypted transactions are only accepted by the signers of SGX
+// chains after the fork, and survive the RLP and JSON encodings.
+func TestEncryptedTxSigning(t *testing.T) {
+	var (
+		key, _ = crypto.GenerateKey()
+		from   = crypto.PubkeyToAddress(key.PublicKey)
+		config = sgxEncryptedTxConfig(big.NewInt(5))
+		inner  = &EncryptedTx{
+			ChainID:   config.ChainID,
+			Nonce:     3,
+			GasTipCap: big.NewInt(1),
+			GasFeeCap: big.NewInt(10),
+			Gas:       100000,
+			Payload:   make([]byte, EncryptedTxMinPayload),
+		}
+	)
+	tx, err := SignNewTx(key, LatestSigner(config), inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.To() == nil || *tx.To() != EncryptedTxRecipient || tx.Value().Sign() != 0 {
+		t.Errorf("public call: to %v, value %v", tx.To(), tx.Value())
+	}
+	for _, tt := range []struct {
+		config *params.ChainConfig
+		number int64
+		valid  bool
+	}{
+		{config, 4, false},
+		{config, 5, true},
+		{sgxEncryptedTxConfig(nil), 5, false},
+		{params.TestChainConfig, 5, false},
+	} {
+		sender, err := Sender(MakeSigner(tt.config, big.NewInt(tt.number), 0), tx)
+		if tt.valid && (err != nil || sender != from) {
+			t.Errorf("block %d: sender %x, err %v", tt.number, sender, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrTxTypeNotSupported) {
+			t.Errorf("block %d: expected ErrTxTypeNotSupported, got %v", tt.number, err)
+		}
+	}
+	// Encoding round trips
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc[0] != EncryptedTxType {
+		t.Fatalf("encoded type %#x", enc[0])
+	}
+	var decoded Transaction
+	if err := decoded.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash() != tx.Hash() {
+		t.Error("RLP round trip changed the transaction")
+	}
+	js, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Transaction
+	if err := json.Unmarshal(js, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Error("JSON round trip changed the transaction")
+	}
+}
+
+// Tests that encrypted calls only decrypt and prove their ephemeral key for
+// the transaction they were encrypted for.
+func TestEncryptTxCall(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		chainID = big.NewInt(1)
+		from    = common.Address{0x01}
+		info    = EncryptedTxSharedInfo(chainID, from, 0)
+		call    = &EncryptedCall{To: common.Address{0x02}, Value: big.NewInt(7), Data: []byte{0x2a}}
+	)
+	payload, err := EncryptTxCall(rand.Reader, &key.PublicKey, chainID, from, 0, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) < EncryptedTxMinPayload {
+		t.Fatalf("payload length %d below minimum %d", len(payload), EncryptedTxMinPayload)
+	}
+	if err := VerifyEncryptedTxPayload(payload, info); err != nil {
+		t.Fatalf("valid payload rejected: %v", err)
+	}
+	// The key holders compute the shared point from the ephemeral key
+	ephemeral, err := crypto.DecompressPubkey(EncryptedTxEphemeralKey(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := crypto.S256().ScalarMult(ephemeral.X, ephemeral.Y, crypto.FromECDSA(key))
+	shared := crypto.CompressPubkey(&ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y})
+
+	decoded, err := DecryptTxCall(payload, shared, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := rlp.EncodeToBytes(call)
+	if have, _ := rlp.EncodeToBytes(decoded); string(have) != string(want) {
+		t.Errorf("decrypted call %+v, want %+v", decoded, call)
+	}
+	for _, other := range [][]byte{
+		EncryptedTxSharedInfo(big.NewInt(2), from, 0),
+		EncryptedTxSharedInfo(chainID, common.Address{0x03}, 0),
+		EncryptedTxSharedInfo(chainID, from, 1),
+	} {
+		if err := VerifyEncryptedTxPayload(payload, other); err == nil {
+			t.Error("payload proof valid for another transaction")
+		}
+		if _, err := DecryptTxCall(payload, shared, other); err == nil {
+			t.Error("payload decrypted for another transaction")
+		}
+	}
+	// Tampering with the proof invalidates the payload
+	tampered := common.CopyBytes(payload)
+	tampered[40] ^= 0x01
+	if err := VerifyEncryptedTxPayload(tampered, info); err == nil {
+		t.Error("tampered proof accepted")
+	}
+}
+
+// Tests that reveals are attributed to the sender of the encrypted transaction
+// without a signature, and survive the RLP and JSON encodings.
+func TestEncryptedRevealTx(t *testing.T) {
+	var (
+		config = sgxEncryptedTxConfig(big.NewInt(5))
+		from   = common.Address{0x01}
+		tx     = NewTx(&EncryptedRevealTx{
+			ChainID: config.ChainID,
+			From:    from,
+			Nonce:   3,
+			Payload: []byte{0x01, 0x02},
+			Shares:  [][]byte{{0x03}, {0x04}},
+		})
+	)
+	if sender, err := Sender(MakeSigner(config, big.NewInt(5), 0), tx); err != nil || sender != from {
+		t.Errorf("sender %x, err %v", sender, err)
+	}
+	if _, err := Sender(MakeSigner(config, big.NewInt(4), 0), tx); !errors.Is(err, ErrTxTypeNotSupported) {
+		t.Errorf("expected ErrTxTypeNotSupported before the fork, got %v", err)
+	}
+	if tx.Gas() != 0 || tx.GasPrice().Sign() != 0 || len(tx.DecryptionShares()) != 2 {
+		t.Errorf("gas %d, price %v, shares %d", tx.Gas(), tx.GasPrice(), len(tx.DecryptionShares()))
+	}
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Transaction
+	if err := decoded.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hash() != tx.Hash() {
+		t.Error("RLP round trip changed the transaction")
+	}
+	js, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed Transaction
+	if err := json.Unmarshal(js, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Hash() != tx.Hash() {
+		t.Error("JSON round trip changed the transaction")
+	}
+}
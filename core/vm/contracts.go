@@ -192,6 +192,69 @@ var PrecompiledContractsSGX = PrecompiledContracts{
 	common.BytesToAddress([]byte{0x80, 0x07}): &SGXDecrypt{},
 	common.BytesToAddress([]byte{0x80, 0x08}): &SGXKeyDerive{},
 	common.BytesToAddress([]byte{0x80, 0x09}): &SGXKeyDelete{},
+	common.BytesToAddress([]byte{0x80, 0x0a}): &SGXTransferOwnership{},
+	common.BytesToAddress([]byte{0x80, 0x0b}): &SGXRandomProof{},
+	common.BytesToAddress([]byte{0x80, 0x0c}): &SGXGrantPermission{},
+	common.BytesToAddress([]byte{0x80, 0x0d}): &SGXRevokePermission{},
+}
+
+// PrecompiledContractsSGXRepriced contains the SGX precompiled contracts with
+// the gas schedule of the SGX gas fork.
+var PrecompiledContractsSGXRepriced = PrecompiledContracts{
+	common.BytesToAddress([]byte{0x80, 0x00}): &SGXKeyCreate{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x01}): &SGXKeyGetPublic{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x02}): &SGXSign{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x03}): &SGXVerify{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x04}): &SGXECDH{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x05}): &SGXRandom{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x06}): &SGXEncrypt{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x07}): &SGXDecrypt{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x08}): &SGXKeyDerive{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x09}): &SGXKeyDelete{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0a}): &SGXTransferOwnership{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0b}): &SGXRandomProof{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0c}): &SGXGrantPermission{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0d}): &SGXRevokePermission{repriced: true},
+}
+
+// PrecompiledContractsSGXKeyTypes contains the SGX precompiled contracts with
+// the key-type-tagged ABI of the SGX key types fork, which supports Ed25519 and
+// P-256 keys. The fork implies the gas schedule of the SGX gas fork.
+var PrecompiledContractsSGXKeyTypes = PrecompiledContracts{
+	common.BytesToAddress([]byte{0x80, 0x00}): &SGXKeyCreate{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x01}): &SGXKeyGetPublic{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x02}): &SGXSign{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x03}): &SGXVerify{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x04}): &SGXECDH{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x05}): &SGXRandom{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x06}): &SGXEncrypt{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x07}): &SGXDecrypt{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x08}): &SGXKeyDerive{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x09}): &SGXKeyDelete{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0a}): &SGXTransferOwnership{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0b}): &SGXRandomProof{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0c}): &SGXGrantPermission{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0d}): &SGXRevokePermission{repriced: true},
+}
+
+// PrecompiledContractsSGXThreshold contains the SGX precompiled contracts of
+// the SGX threshold keys fork, which registers, signs with and verifies
+// threshold keys. The fork implies the SGX key types fork.
+var PrecompiledContractsSGXThreshold = PrecompiledContracts{
+	common.BytesToAddress([]byte{0x80, 0x00}): &SGXKeyCreate{repriced: true, tagged: true, threshold: true},
+	common.BytesToAddress([]byte{0x80, 0x01}): &SGXKeyGetPublic{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x02}): &SGXSign{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x03}): &SGXVerify{repriced: true, tagged: true, threshold: true},
+	common.BytesToAddress([]byte{0x80, 0x04}): &SGXECDH{repriced: true, tagged: true},
+	common.BytesToAddress([]byte{0x80, 0x05}): &SGXRandom{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x06}): &SGXEncrypt{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x07}): &SGXDecrypt{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x08}): &SGXKeyDerive{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x09}): &SGXKeyDelete{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0a}): &SGXTransferOwnership{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0b}): &SGXRandomProof{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0c}): &SGXGrantPermission{repriced: true},
+	common.BytesToAddress([]byte{0x80, 0x0d}): &SGXRevokePermission{repriced: true},
 }
 
 var (
@@ -252,8 +315,18 @@ func activePrecompiledContracts(rules params.Rules) PrecompiledContracts {
 	// Only include SGX precompiled contracts if SGX consensus is enabled
 	// This is indicated by the IsSGX flag in the rules
 	if rules.IsSGX {
+		sgx := PrecompiledContractsSGX
+		if rules.IsSGXGas {
+			sgx = PrecompiledContractsSGXRepriced
+		}
+		if rules.IsSGXKeyTypes {
+			sgx = PrecompiledContractsSGXKeyTypes
+		}
+		if rules.IsSGXThreshold {
+			sgx = PrecompiledContractsSGXThreshold
+		}
 		result := maps.Clone(base)
-		for addr, contract := range PrecompiledContractsSGX {
+		for addr, contract := range sgx {
 			result[addr] = contract
 		}
 		return result
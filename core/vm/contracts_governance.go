@@ -0,0 +1,121 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"maps"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// ErrGovernanceDelegated is returned when the native governance contracts are
+// invoked by CALLCODE or DELEGATECALL, which would act without transferring
+// the call value to them.
+var ErrGovernanceDelegated = errors.New("native governance contract called by CALLCODE or DELEGATECALL")
+
+// governanceContract serves a native governance contract as a precompile at
+// an address of the SGX chain config.
+type governanceContract struct {
+	*governance.NativeContract
+	name string
+}
+
+func (c *governanceContract) Name() string {
+	return c.name
+}
+
+// Run implements PrecompiledContract; the contract only runs with the call
+// context.
+func (c *governanceContract) Run(input []byte) ([]byte, error) {
+	return nil, errors.New("context required")
+}
+
+// withGovernanceContracts returns the precompiles extended with the native
+// governance and security config contracts of the SGX chain config.
+func withGovernanceContracts(precompiles PrecompiledContracts, config *params.SGXConfig) PrecompiledContracts {
+	if config == nil || config.GovernanceContract == (common.Address{}) || config.SecurityConfig == (common.Address{}) {
+		return precompiles
+	}
+	result := maps.Clone(precompiles)
+	result[config.GovernanceContract] = &governanceContract{
+		NativeContract: governance.NewGovernanceNativeContract(config.GovernanceContract, config.SecurityConfig),
+		name:           "GOVERNANCE",
+	}
+	result[config.SecurityConfig] = &governanceContract{
+		NativeContract: governance.NewSecurityConfigNativeContract(config.GovernanceContract, config.SecurityConfig),
+		name:           "SECURITY_CONFIG",
+	}
+	return result
+}
+
+// revertSelector is the selector of the Error(string) revert reason.
+var revertSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+
+// revertReason encodes a revert reason like the Solidity revert statement.
+func revertReason(reason string) []byte {
+	stringType, _ := abi.NewType("string", "", nil)
+	data, _ := abi.Arguments{{Type: stringType}}.Pack(reason)
+	return append(common.CopyBytes(revertSelector), data...)
+}
+
+// runGovernanceContract runs a native governance contract on behalf of
+// caller. The value is nil for CALLCODE and DELEGATECALL. Calls listing
+// entries are charged for them as they run. Failed calls revert with the
+// error as reason and return the remaining gas.
+func (evm *EVM) runGovernanceContract(c *governanceContract, caller common.Address, input []byte, gas uint64, value *uint256.Int, readOnly bool) ([]byte, uint64, error) {
+	gasCost := c.RequiredGas(input)
+	if gas < gasCost {
+		return nil, 0, ErrOutOfGas
+	}
+	if evm.Config.Tracer != nil && evm.Config.Tracer.OnGasChange != nil {
+		evm.Config.Tracer.OnGasChange(gas, gas-gasCost, tracing.GasChangeCallPrecompiledContract)
+	}
+	gas -= gasCost
+	if value == nil {
+		return nil, 0, ErrGovernanceDelegated
+	}
+	ctx := &governance.CallContext{
+		DB:          evm.StateDB,
+		Caller:      caller,
+		Value:       value,
+		ChainID:     evm.chainConfig.ChainID,
+		BlockNumber: evm.Context.BlockNumber.Uint64(),
+		ReadOnly:    readOnly || evm.readOnly,
+		Gas:         gas,
+	}
+	ret, err := c.NativeContract.Run(ctx, input)
+	if evm.Config.Tracer != nil && evm.Config.Tracer.OnGasChange != nil && ctx.Gas != gas {
+		evm.Config.Tracer.OnGasChange(gas, ctx.Gas, tracing.GasChangeCallPrecompiledContract)
+	}
+	gas = ctx.Gas
+	switch {
+	case errors.Is(err, governance.ErrWriteProtected):
+		return nil, 0, ErrWriteProtection
+	case errors.Is(err, governance.ErrOutOfGas):
+		return nil, 0, ErrOutOfGas
+	case err != nil:
+		return revertReason(err.Error()), gas, ErrExecutionReverted
+	}
+	return ret, gas, nil
+}
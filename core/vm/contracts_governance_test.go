@@ -0,0 +1,131 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+func newGovernanceTestEVM(t *testing.T, forkBlock int64) (*EVM, *params.SGXConfig) {
+	config := *params.MergedTestChainConfig
+	config.SGX = &params.SGXConfig{
+		GovernanceContract: common.HexToAddress("0x1000000000000000000000000000000000000001"),
+		SecurityConfig:     common.HexToAddress("0x1000000000000000000000000000000000000002"),
+	}
+	config.SGXGovernanceBlock = big.NewInt(forkBlock)
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	vmctx := BlockContext{
+		CanTransfer: func(db StateDB, addr common.Address, amount *uint256.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		},
+		Transfer: func(db StateDB, sender, recipient common.Address, amount *uint256.Int) {
+			db.SubBalance(sender, amount, tracing.BalanceChangeTransfer)
+			db.AddBalance(recipient, amount, tracing.BalanceChangeTransfer)
+		},
+		BlockNumber: big.NewInt(1),
+		Random:      &common.Hash{},
+	}
+	return NewEVM(vmctx, statedb, &config, Config{}), config.SGX
+}
+
+// Tests that transactions reach the native governance contract through the
+// EVM, with the call value and reverts carrying the error as reason.
+func TestGovernanceContractCall(t *testing.T) {
+	evm, sgx := newGovernanceTestEVM(t, 0)
+	govABI, err := abi.JSON(strings.NewReader(governance.GovernanceABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		staker   = common.HexToAddress("0x01")
+		minStake = uint256.MustFromBig(governance.DefaultStakingConfig().MinStakeAmount)
+	)
+	evm.StateDB.AddBalance(staker, minStake, tracing.BalanceChangeUnspecified)
+
+	// Proposals by non-validators revert with the reason and return the gas.
+	input, _ := govABI.Pack("proposeAddMREnclave", [32]byte{1}, "v1")
+	ret, leftOver, err := evm.Call(staker, sgx.GovernanceContract, input, 1_000_000, new(uint256.Int))
+	if !errors.Is(err, ErrExecutionReverted) {
+		t.Fatalf("have error %v, want %v", err, ErrExecutionReverted)
+	}
+	if reason, _ := abi.UnpackRevert(ret); reason != governance.ErrInvalidProposer.Error() {
+		t.Errorf("have revert reason %q", reason)
+	}
+	p, _ := evm.precompile(sgx.GovernanceContract)
+	if want := 1_000_000 - p.RequiredGas(input); leftOver != want {
+		t.Errorf("have %d gas left after revert, want %d", leftOver, want)
+	}
+
+	// Staking moves the call value into the contract.
+	input, _ = govABI.Pack("stake", [32]byte{})
+	if _, _, err := evm.Call(staker, sgx.GovernanceContract, input, 1_000_000, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if !evm.StateDB.GetBalance(staker).IsZero() || evm.StateDB.GetBalance(sgx.GovernanceContract).Cmp(minStake) != 0 {
+		t.Fatal("stake not transferred to the governance contract")
+	}
+	input, _ = govABI.Pack("isValidator", staker)
+	ret, _, err = evm.StaticCall(staker, sgx.GovernanceContract, input, 1_000_000)
+	if err != nil || new(big.Int).SetBytes(ret).Uint64() != 1 {
+		t.Fatalf("staker is no validator: %x, %v", ret, err)
+	}
+
+	// Writes fail in static calls, and delegated calls are rejected.
+	input, _ = govABI.Pack("unstake", minStake.ToBig())
+	if _, _, err := evm.StaticCall(staker, sgx.GovernanceContract, input, 1_000_000); !errors.Is(err, ErrWriteProtection) {
+		t.Errorf("static unstake: have %v, want %v", err, ErrWriteProtection)
+	}
+	input, _ = govABI.Pack("stake", [32]byte{})
+	if _, _, err := evm.DelegateCall(staker, staker, sgx.GovernanceContract, input, 1_000_000, minStake); !errors.Is(err, ErrGovernanceDelegated) {
+		t.Errorf("delegated stake: have %v, want %v", err, ErrGovernanceDelegated)
+	}
+	if _, _, err := evm.CallCode(staker, sgx.GovernanceContract, input, 1_000_000, new(uint256.Int)); !errors.Is(err, ErrGovernanceDelegated) {
+		t.Errorf("callcode stake: have %v, want %v", err, ErrGovernanceDelegated)
+	}
+}
+
+func TestGovernanceContractFork(t *testing.T) {
+	for _, tt := range []struct {
+		fork   int64
+		active bool
+	}{{2, false}, {1, true}} {
+		evm, sgx := newGovernanceTestEVM(t, tt.fork)
+		for _, addr := range []common.Address{sgx.GovernanceContract, sgx.SecurityConfig} {
+			if _, ok := evm.precompile(addr); ok != tt.active {
+				t.Errorf("fork %d: contract %x active %v, want %v", tt.fork, addr, ok, tt.active)
+			}
+		}
+		// Overriding the precompiles over RPC keeps the native contracts.
+		evm.SetPrecompiles(ActivePrecompiledContracts(evm.chainRules))
+		if _, ok := evm.precompile(sgx.GovernanceContract); ok != tt.active {
+			t.Errorf("fork %d: contract active %v after override, want %v", tt.fork, ok, tt.active)
+		}
+	}
+}
@@ -17,9 +17,74 @@
 package vm
 
 import (
+	"errors"
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
 )
 
+// ErrSGXKeyStoreUnavailable is returned by the SGX precompiles that need a key
+// store when the EVM has none configured.
+var ErrSGXKeyStoreUnavailable = errors.New("sgx key store unavailable")
+
+// unavailableKeyStore is the key store of the SGX precompiles in an EVM
+// without one. Precompiles reading only the state or the block randomness
+// work as usual, all key operations fail.
+type unavailableKeyStore struct{}
+
+func (unavailableKeyStore) CreateKey(common.Address, KeyType) (common.Hash, error) {
+	return common.Hash{}, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) CreateKeyDeterministic(common.Address, KeyType, *big.Int, uint64) (common.Hash, error) {
+	return common.Hash{}, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) GetPublicKey(common.Hash) ([]byte, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) Sign(common.Hash, []byte) ([]byte, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) ECDH(common.Hash, []byte, []byte) (common.Hash, error) {
+	return common.Hash{}, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) GetECDHPublicKey(common.Hash) ([]byte, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) Encrypt(common.Hash, []byte) ([]byte, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) Decrypt(common.Hash, []byte) ([]byte, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) DeriveKey(common.Hash, []byte) (common.Hash, error) {
+	return common.Hash{}, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) GetExtendedPublicKey(common.Hash) ([]byte, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) GetMetadata(common.Hash) (*KeyMetadata, error) {
+	return nil, ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) DeleteKey(common.Hash, common.Address) error {
+	return ErrSGXKeyStoreUnavailable
+}
+
+func (unavailableKeyStore) TransferOwnership(common.Hash, common.Address) error {
+	return ErrSGXKeyStoreUnavailable
+}
+
 // SGXPrecompileWithContext is the precompiled contract interface with context support
 type SGXPrecompileWithContext interface {
 	PrecompiledContract
@@ -41,6 +106,12 @@ type SGXContext struct {
 	
 	// Timestamp
 	Timestamp uint64
+
+	// Chain ID, bound into derived keys
+	ChainID *big.Int
+
+	// State database holding the key nonces, nil outside the EVM
+	StateDB StateDB
 	
 	// Key storage
 	KeyStore KeyStore
@@ -50,9 +121,47 @@ type SGXContext struct {
 	
 	// Read-only mode flag (true for STATICCALL)
 	IsReadOnly bool
+
+	// Verifiable block randomness (the header MixDigest)
+	Randomness common.Hash
+
+	// Hash of the executing transaction and index of the SGX precompile
+	// call within it
+	TxHash    common.Hash
+	CallIndex uint64
 }
 
 // Name returns the name of the contract
 func (c *SGXContext) Name() string {
 	return "SGXContext"
 }
+
+// RunSGXPrecompiledContract runs an SGX precompiled contract with the given
+// context. Like RunPrecompiledContract it returns the output, the remaining
+// gas and any error that occurred.
+func RunSGXPrecompiledContract(p SGXPrecompileWithContext, ctx *SGXContext, input []byte, suppliedGas uint64, logger *tracing.Hooks) (ret []byte, remainingGas uint64, err error) {
+	gasCost := p.RequiredGas(input)
+	if suppliedGas < gasCost {
+		return nil, 0, ErrOutOfGas
+	}
+	if logger != nil && logger.OnGasChange != nil {
+		logger.OnGasChange(suppliedGas, suppliedGas-gasCost, tracing.GasChangeCallPrecompiledContract)
+	}
+	suppliedGas -= gasCost
+	output, err := p.RunWithContext(ctx, input)
+	return output, suppliedGas, err
+}
+
+// authorizeKeyUse reports whether the caller may use the key: the owner always
+// may, other callers need an active permission of the given type, whose use is
+// then recorded. Recording is a state change, so grantees cannot use keys in
+// read-only mode.
+func authorizeKeyUse(ctx *SGXContext, metadata *KeyMetadata, permType PermissionType) bool {
+	if metadata.Owner == ctx.Caller {
+		return true
+	}
+	if ctx.IsReadOnly || ctx.PermissionManager == nil || !ctx.PermissionManager.CheckPermission(metadata.KeyID, ctx.Caller, permType, ctx.Timestamp) {
+		return false
+	}
+	return ctx.PermissionManager.UsePermission(metadata.KeyID, ctx.Caller, permType, ctx.Timestamp) == nil
+}
@@ -19,12 +19,14 @@ package vm
 import (
 	"bytes"
 	"crypto/rand"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
 )
 
 // setupTestSGXContext creates a test SGX context with temporary key storage
@@ -33,7 +35,7 @@ func setupTestSGXContext(t *testing.T) (*SGXContext, func()) {
 	encryptedPath := filepath.Join(tmpDir, "encrypted")
 	publicPath := filepath.Join(tmpDir, "public")
 
-	keyStore, err := NewEncryptedKeyStore(encryptedPath, publicPath)
+	keyStore, err := NewEncryptedKeyStore(encryptedPath, publicPath, FileSealingKey{Path: filepath.Join(tmpDir, "sealing.key")})
 	if err != nil {
 		t.Fatalf("failed to create keystore: %v", err)
 	}
@@ -569,6 +571,7 @@ func TestSGXECDH(t *testing.T) {
 // TestSGXRandom tests the SGX_RANDOM contract (0x8005)
 func TestSGXRandom(t *testing.T) {
 	contract := &SGXRandom{}
+	ctx := &SGXContext{Caller: common.HexToAddress("0x1234"), Randomness: common.Hash{0x01}}
 
 	tests := []struct {
 		name      string
@@ -610,16 +613,16 @@ func TestSGXRandom(t *testing.T) {
 				input[31-i] = byte(tt.length >> (i * 8))
 			}
 
-			result, err := contract.Run(input)
+			result, err := contract.RunWithContext(ctx, input)
 			if tt.wantError {
 				if err == nil {
-					t.Error("Run() expected error, got nil")
+					t.Error("RunWithContext() expected error, got nil")
 				}
 				return
 			}
 
 			if err != nil {
-				t.Errorf("Run() error = %v", err)
+				t.Errorf("RunWithContext() error = %v", err)
 				return
 			}
 
@@ -642,6 +645,84 @@ func TestSGXRandom(t *testing.T) {
 	}
 }
 
+// TestSGXRandomDeterministic tests that SGX_RANDOM (0x8005) output only
+// depends on the block randomness and the call, and that SGX_RANDOM_PROOF
+// (0x800b) returns the inputs of the output.
+func TestSGXRandomDeterministic(t *testing.T) {
+	var (
+		contract = &SGXRandom{}
+		ctx      = &SGXContext{Caller: common.HexToAddress("0x1234"), Randomness: common.Hash{0x01}, TxHash: common.Hash{0x02}, CallIndex: 3}
+		input    = common.LeftPadBytes([]byte{64}, 32)
+	)
+	want, err := contract.RunWithContext(ctx, input)
+	if err != nil {
+		t.Fatalf("RunWithContext() error = %v", err)
+	}
+	if again, _ := contract.RunWithContext(ctx, input); !bytes.Equal(want, again) {
+		t.Error("output differs for the same call")
+	}
+	// A shorter output is a prefix of the longer one
+	if short, _ := contract.RunWithContext(ctx, common.LeftPadBytes([]byte{16}, 32)); !bytes.Equal(short, want[:16]) {
+		t.Error("short output is not a prefix")
+	}
+	for name, modify := range map[string]func(*SGXContext){
+		"randomness": func(c *SGXContext) { c.Randomness = common.Hash{0x09} },
+		"tx hash":    func(c *SGXContext) { c.TxHash = common.Hash{0x09} },
+		"call index": func(c *SGXContext) { c.CallIndex++ },
+		"caller":     func(c *SGXContext) { c.Caller = common.HexToAddress("0x5678") },
+	} {
+		other := *ctx
+		modify(&other)
+		if output, _ := contract.RunWithContext(&other, input); bytes.Equal(want, output) {
+			t.Errorf("%s does not change the output", name)
+		}
+	}
+	// Without block randomness there is no output
+	noRandomness := *ctx
+	noRandomness.Randomness = common.Hash{}
+	if _, err := contract.RunWithContext(&noRandomness, input); err == nil {
+		t.Error("output without block randomness")
+	}
+
+	proof, err := (&SGXRandomProof{}).RunWithContext(ctx, input)
+	if err != nil {
+		t.Fatalf("SGXRandomProof error = %v", err)
+	}
+	if len(proof) != 96+64 {
+		t.Fatalf("proof output length = %d, want %d", len(proof), 96+64)
+	}
+	if common.BytesToHash(proof[:32]) != ctx.Randomness || common.BytesToHash(proof[32:64]) != ctx.TxHash || new(big.Int).SetBytes(proof[64:96]).Uint64() != ctx.CallIndex {
+		t.Errorf("proof inputs = %x", proof[:96])
+	}
+	if !bytes.Equal(proof[96:], want) {
+		t.Error("proof output differs from SGXRandom")
+	}
+}
+
+// TestSGXRandomCallIndex tests that the EVM numbers the SGX precompile calls
+// of a transaction, so repeated calls return different output.
+func TestSGXRandomCallIndex(t *testing.T) {
+	input := common.LeftPadBytes([]byte{32}, 32)
+	evm, contract := newSGXTestEVM(t, newSGXTestKeyStore(t), common.BytesToAddress([]byte{0x80, 0x05}), input, RETURN)
+	evm.Context.SGXRandomness = common.Hash{0x01}
+
+	var outputs [][]byte
+	for i := 0; i < 2; i++ {
+		ret, _, err := evm.Call(common.Address{0x01}, contract, nil, 1_000_000, new(uint256.Int))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := (&SGXRandom{}).RunWithContext(&SGXContext{Caller: contract, Randomness: common.Hash{0x01}, CallIndex: uint64(i)}, input)
+		if !bytes.Equal(ret, want) {
+			t.Fatalf("call %d: output %x, want %x", i, ret, want)
+		}
+		outputs = append(outputs, ret)
+	}
+	if bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("repeated calls returned the same output")
+	}
+}
+
 // TestSGXEncryptDecrypt tests the SGX_ENCRYPT (0x8006) and SGX_DECRYPT (0x8007) contracts
 func TestSGXEncryptDecrypt(t *testing.T) {
 	ctx, cleanup := setupTestSGXContext(t)
@@ -776,21 +857,21 @@ func TestSGXKeyDerive(t *testing.T) {
 		{
 			name:      "Derive with owner",
 			keyID:     masterKeyID,
-			path:      []byte("m/0/1"),
+			path:      EncodeDerivationPath(0, 1),
 			caller:    ctx.Caller,
 			wantError: false,
 		},
 		{
 			name:      "Derive without permission",
 			keyID:     masterKeyID,
-			path:      []byte("m/0/2"),
+			path:      EncodeDerivationPath(0, 2),
 			caller:    common.HexToAddress("0x9999999999999999999999999999999999999999"),
 			wantError: true,
 		},
 		{
 			name:      "Derive with granted permission",
 			keyID:     masterKeyID,
-			path:      []byte("m/0/3"),
+			path:      EncodeDerivationPath(0, 3),
 			caller:    common.HexToAddress("0x6666666666666666666666666666666666666666"),
 			wantError: false,
 			setupPerm: func() {
@@ -881,7 +962,7 @@ func TestPermissionManagement(t *testing.T) {
 
 	t.Run("Use permission with max uses", func(t *testing.T) {
 		for i := 0; i < 5; i++ {
-			err := ctx.PermissionManager.UsePermission(keyID, grantee, PermissionSign)
+			err := ctx.PermissionManager.UsePermission(keyID, grantee, PermissionSign, ctx.Timestamp)
 			if err != nil {
 				t.Errorf("UsePermission() error = %v", err)
 			}
@@ -937,7 +1018,7 @@ func TestKeyStoreOperations(t *testing.T) {
 	encryptedPath := filepath.Join(tmpDir, "encrypted")
 	publicPath := filepath.Join(tmpDir, "public")
 
-	keyStore, err := NewEncryptedKeyStore(encryptedPath, publicPath)
+	keyStore, err := NewEncryptedKeyStore(encryptedPath, publicPath, FileSealingKey{Path: filepath.Join(tmpDir, "sealing.key")})
 	if err != nil {
 		t.Fatalf("failed to create keystore: %v", err)
 	}
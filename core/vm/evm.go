@@ -46,6 +46,46 @@ func (evm *EVM) precompile(addr common.Address) (PrecompiledContract, bool) {
 	return p, ok
 }
 
+// runPrecompile runs a precompiled contract on behalf of caller. SGX
+// precompiles run with an SGXContext, read-only within a static call frame.
+// The native governance contracts also receive the transferred value, nil for
+// CALLCODE and DELEGATECALL.
+func (evm *EVM) runPrecompile(p PrecompiledContract, caller common.Address, input []byte, gas uint64, value *uint256.Int, readOnly bool) ([]byte, uint64, error) {
+	if gc, ok := p.(*governanceContract); ok {
+		return evm.runGovernanceContract(gc, caller, input, gas, value, readOnly)
+	}
+	sp, ok := p.(SGXPrecompileWithContext)
+	if !ok {
+		return RunPrecompiledContract(p, input, gas, evm.Config.Tracer)
+	}
+	// Without a key store only the precompiles needing no key material work,
+	// the others fail with ErrSGXKeyStoreUnavailable.
+	var keys KeyStore = unavailableKeyStore{}
+	if evm.sgxJournal != nil {
+		keys = evm.sgxJournal.keyStore()
+	}
+	txHash := evm.StateDB.TxHash()
+	if txHash != evm.sgxCallTx {
+		evm.sgxCallTx, evm.sgxCallIndex = txHash, 0
+	}
+	ctx := &SGXContext{
+		Caller:            caller,
+		Origin:            evm.Origin,
+		BlockNumber:       evm.Context.BlockNumber.Uint64(),
+		Timestamp:         evm.Context.Time,
+		ChainID:           evm.chainConfig.ChainID,
+		StateDB:           evm.StateDB,
+		KeyStore:          keys,
+		PermissionManager: NewStatePermissionManager(evm.StateDB),
+		IsReadOnly:        readOnly || evm.readOnly,
+		Randomness:        evm.Context.SGXRandomness,
+		TxHash:            txHash,
+		CallIndex:         evm.sgxCallIndex,
+	}
+	evm.sgxCallIndex++
+	return RunSGXPrecompiledContract(sp, ctx, input, gas, evm.Config.Tracer)
+}
+
 // BlockContext provides the EVM with auxiliary information. Once provided
 // it shouldn't be modified.
 type BlockContext struct {
@@ -66,6 +106,8 @@ type BlockContext struct {
 	BaseFee     *big.Int       // Provides information for BASEFEE (0 if vm runs with NoBaseFee flag and 0 gas price)
 	BlobBaseFee *big.Int       // Provides information for BLOBBASEFEE (0 if vm runs with NoBaseFee flag and 0 blob gas price)
 	Random      *common.Hash   // Provides information for PREVRANDAO
+
+	SGXRandomness common.Hash // Verifiable block randomness seeding the SGX random precompiles
 }
 
 // TxContext provides the EVM with information about a transaction.
@@ -130,6 +172,15 @@ type EVM struct {
 
 	readOnly   bool   // Whether to throw on stateful modifications
 	returnData []byte // Last CALL's return data for subsequent reuse
+
+	// sgxJournal records the key changes of the SGX precompiles, nil if no
+	// key store is configured
+	sgxJournal *sgxJournal
+
+	// sgxCallTx and sgxCallIndex number the SGX precompile calls within a
+	// transaction, separating the random outputs of repeated calls
+	sgxCallTx    common.Hash
+	sgxCallIndex uint64
 }
 
 // NewEVM constructs an EVM instance with the supplied block context, state
@@ -147,6 +198,16 @@ func NewEVM(blockCtx BlockContext, statedb StateDB, chainConfig *params.ChainCon
 		hasher:      crypto.NewKeccakState(),
 	}
 	evm.precompiles = activePrecompiledContracts(evm.chainRules)
+	if evm.chainRules.IsSGXGovernance {
+		evm.precompiles = withGovernanceContracts(evm.precompiles, chainConfig.SGX)
+	}
+	if config.SGXKeyStore != nil {
+		var versions StateDB
+		if evm.chainRules.IsSGXKeyVersion {
+			versions = statedb
+		}
+		evm.sgxJournal = newSGXJournal(config.SGXKeyStore, versions)
+	}
 
 	switch {
 	case evm.chainRules.IsOsaka:
@@ -198,10 +259,14 @@ func NewEVM(blockCtx BlockContext, statedb StateDB, chainConfig *params.ChainCon
 	return evm
 }
 
-// SetPrecompiles sets the precompiled contracts for the EVM.
+// SetPrecompiles sets the precompiled contracts for the EVM. The native
+// governance contracts of the chain config are kept.
 // This method is only used through RPC calls.
 // It is not thread-safe.
 func (evm *EVM) SetPrecompiles(precompiles PrecompiledContracts) {
+	if evm.chainRules.IsSGXGovernance {
+		precompiles = withGovernanceContracts(precompiles, evm.chainConfig.SGX)
+	}
 	evm.precompiles = precompiles
 }
 
@@ -210,6 +275,14 @@ func (evm *EVM) SetJumpDestCache(jumpDests JumpDestCache) {
 	evm.jumpDests = jumpDests
 }
 
+// commitSGXKeys finalises the key changes of the SGX precompiles once the
+// outermost call frame of a transaction returns.
+func (evm *EVM) commitSGXKeys() {
+	if evm.depth == 0 {
+		evm.sgxJournal.commit()
+	}
+}
+
 // SetTxContext resets the EVM with a new transaction context.
 // This is not threadsafe and should only be done very cautiously.
 func (evm *EVM) SetTxContext(txCtx TxContext) {
@@ -254,7 +327,7 @@ func (evm *EVM) Call(caller common.Address, addr common.Address, input []byte, g
 	if !value.IsZero() && !evm.Context.CanTransfer(evm.StateDB, caller, value) {
 		return nil, gas, ErrInsufficientBalance
 	}
-	snapshot := evm.StateDB.Snapshot()
+	snapshot, keySnapshot := evm.StateDB.Snapshot(), evm.sgxJournal.snapshot()
 	p, isPrecompile := evm.precompile(addr)
 
 	if !evm.StateDB.Exist(addr) {
@@ -283,7 +356,7 @@ func (evm *EVM) Call(caller common.Address, addr common.Address, input []byte, g
 	evm.Context.Transfer(evm.StateDB, caller, addr, value)
 
 	if isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas, evm.Config.Tracer)
+		ret, gas, err = evm.runPrecompile(p, caller, input, gas, value, false)
 	} else {
 		// Initialise a new contract and set the code that is to be used by the EVM.
 		code := evm.resolveCode(addr)
@@ -303,6 +376,7 @@ func (evm *EVM) Call(caller common.Address, addr common.Address, input []byte, g
 	// when we're in homestead this also counts for code storage gas errors.
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.sgxJournal.revertToSnapshot(keySnapshot)
 		if err != ErrExecutionReverted {
 			if evm.Config.Tracer != nil && evm.Config.Tracer.OnGasChange != nil {
 				evm.Config.Tracer.OnGasChange(gas, 0, tracing.GasChangeCallFailedExecution)
@@ -314,6 +388,7 @@ func (evm *EVM) Call(caller common.Address, addr common.Address, input []byte, g
 		//} else {
 		//	evm.StateDB.DiscardSnapshot(snapshot)
 	}
+	evm.commitSGXKeys()
 	return ret, gas, err
 }
 
@@ -343,11 +418,11 @@ func (evm *EVM) CallCode(caller common.Address, addr common.Address, input []byt
 	if !evm.Context.CanTransfer(evm.StateDB, caller, value) {
 		return nil, gas, ErrInsufficientBalance
 	}
-	var snapshot = evm.StateDB.Snapshot()
+	var snapshot, keySnapshot = evm.StateDB.Snapshot(), evm.sgxJournal.snapshot()
 
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas, evm.Config.Tracer)
+		ret, gas, err = evm.runPrecompile(p, caller, input, gas, nil, false)
 	} else {
 		// Initialise a new contract and set the code that is to be used by the EVM.
 		// The contract is a scoped environment for this execution context only.
@@ -358,6 +433,7 @@ func (evm *EVM) CallCode(caller common.Address, addr common.Address, input []byt
 	}
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.sgxJournal.revertToSnapshot(keySnapshot)
 		if err != ErrExecutionReverted {
 			if evm.Config.Tracer != nil && evm.Config.Tracer.OnGasChange != nil {
 				evm.Config.Tracer.OnGasChange(gas, 0, tracing.GasChangeCallFailedExecution)
@@ -365,6 +441,7 @@ func (evm *EVM) CallCode(caller common.Address, addr common.Address, input []byt
 			gas = 0
 		}
 	}
+	evm.commitSGXKeys()
 	return ret, gas, err
 }
 
@@ -386,11 +463,11 @@ func (evm *EVM) DelegateCall(originCaller common.Address, caller common.Address,
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
-	var snapshot = evm.StateDB.Snapshot()
+	var snapshot, keySnapshot = evm.StateDB.Snapshot(), evm.sgxJournal.snapshot()
 
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas, evm.Config.Tracer)
+		ret, gas, err = evm.runPrecompile(p, caller, input, gas, nil, false)
 	} else {
 		// Initialise a new contract and make initialise the delegate values
 		//
@@ -402,6 +479,7 @@ func (evm *EVM) DelegateCall(originCaller common.Address, caller common.Address,
 	}
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.sgxJournal.revertToSnapshot(keySnapshot)
 		if err != ErrExecutionReverted {
 			if evm.Config.Tracer != nil && evm.Config.Tracer.OnGasChange != nil {
 				evm.Config.Tracer.OnGasChange(gas, 0, tracing.GasChangeCallFailedExecution)
@@ -409,6 +487,7 @@ func (evm *EVM) DelegateCall(originCaller common.Address, caller common.Address,
 			gas = 0
 		}
 	}
+	evm.commitSGXKeys()
 	return ret, gas, err
 }
 
@@ -433,7 +512,7 @@ func (evm *EVM) StaticCall(caller common.Address, addr common.Address, input []b
 	// after all empty accounts were deleted, so this is not required. However, if we omit this,
 	// then certain tests start failing; stRevertTest/RevertPrecompiledTouchExactOOG.json.
 	// We could change this, but for now it's left for legacy reasons
-	var snapshot = evm.StateDB.Snapshot()
+	var snapshot, keySnapshot = evm.StateDB.Snapshot(), evm.sgxJournal.snapshot()
 
 	// We do an AddBalance of zero here, just in order to trigger a touch.
 	// This doesn't matter on Mainnet, where all empties are gone at the time of Byzantium,
@@ -442,7 +521,7 @@ func (evm *EVM) StaticCall(caller common.Address, addr common.Address, input []b
 	evm.StateDB.AddBalance(addr, new(uint256.Int), tracing.BalanceChangeTouchAccount)
 
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
-		ret, gas, err = RunPrecompiledContract(p, input, gas, evm.Config.Tracer)
+		ret, gas, err = evm.runPrecompile(p, caller, input, gas, new(uint256.Int), true)
 	} else {
 		// Initialise a new contract and set the code that is to be used by the EVM.
 		// The contract is a scoped environment for this execution context only.
@@ -457,6 +536,7 @@ func (evm *EVM) StaticCall(caller common.Address, addr common.Address, input []b
 	}
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.sgxJournal.revertToSnapshot(keySnapshot)
 		if err != ErrExecutionReverted {
 			if evm.Config.Tracer != nil && evm.Config.Tracer.OnGasChange != nil {
 				evm.Config.Tracer.OnGasChange(gas, 0, tracing.GasChangeCallFailedExecution)
@@ -465,6 +545,7 @@ func (evm *EVM) StaticCall(caller common.Address, addr common.Address, input []b
 			gas = 0
 		}
 	}
+	evm.commitSGXKeys()
 	return ret, gas, err
 }
 
@@ -525,7 +606,7 @@ func (evm *EVM) create(caller common.Address, code []byte, gas uint64, value *ui
 	// Create a new account on the state only if the object was not present.
 	// It might be possible the contract code is deployed to a pre-existent
 	// account with non-zero balance.
-	snapshot := evm.StateDB.Snapshot()
+	snapshot, keySnapshot := evm.StateDB.Snapshot(), evm.sgxJournal.snapshot()
 	if !evm.StateDB.Exist(address) {
 		evm.StateDB.CreateAccount(address)
 	}
@@ -563,10 +644,12 @@ func (evm *EVM) create(caller common.Address, code []byte, gas uint64, value *ui
 	ret, err = evm.initNewContract(contract, address)
 	if err != nil && (evm.chainRules.IsHomestead || err != ErrCodeStoreOutOfGas) {
 		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.sgxJournal.revertToSnapshot(keySnapshot)
 		if err != ErrExecutionReverted {
 			contract.UseGas(contract.Gas, evm.Config.Tracer, tracing.GasChangeCallFailedExecution)
 		}
 	}
+	evm.commitSGXKeys()
 	return ret, address, contract.Gas, err
 }
 
@@ -87,6 +87,8 @@ type StateDB interface {
 	Snapshot() int
 
 	AddLog(*types.Log)
+	// TxHash returns the hash of the transaction being executed
+	TxHash() common.Hash
 	AddPreimage(common.Hash, []byte)
 
 	Witness() *stateless.Witness
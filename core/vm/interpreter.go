@@ -34,6 +34,19 @@ type Config struct {
 
 	StatelessSelfValidation bool // Generate execution witnesses and self-check against them (testing purpose)
 	EnableWitnessStats      bool // Whether trie access statistics collection is enabled
+
+	SGXKeyStore  KeyStore        // Key store of the SGX precompiles (nil leaves them unavailable)
+	SGXKeyLayers *KeyStoreLayers // Per-block changes of the SGX key store, see WithSGXKeys
+}
+
+// WithSGXKeys returns the configuration for executing on top of the block with
+// the given hash. If the chain buffers its key store changes per block, the
+// SGX precompiles use a key store keeping their changes in memory.
+func (c Config) WithSGXKeys(block common.Hash) Config {
+	if c.SGXKeyLayers != nil {
+		c.SGXKeyStore = c.SGXKeyLayers.Open(block)
+	}
+	return c
 }
 
 // ScopeContext contains the things that are per-call, such as stack and memory,
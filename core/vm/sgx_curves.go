@@ -0,0 +1,253 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/secp256r1"
+)
+
+// From the SGX key types fork on, the SGX precompiles tag the public keys and
+// signatures they take and return with the key type, and encode them as:
+//
+//	key type          public key                 signature
+//	secp256k1 (0x01)  65 bytes, 0x04 || X || Y   65 bytes, R || S || V
+//	Ed25519   (0x02)  32 bytes (RFC 8032)        64 bytes (RFC 8032)
+//	threshold (0x04)  33 bytes, compressed       65 bytes, R || z
+//	P-256     (0x05)  65 bytes, 0x04 || X || Y   64 bytes, R || S
+//
+// ECDH with an Ed25519 key is X25519 (RFC 7748) with the Montgomery form of the
+// key, its peers use 32 byte X25519 public keys.
+
+// publicKeyLength returns the length of the public keys of the key type, zero
+// for keys without a public component.
+func publicKeyLength(keyType KeyType) int {
+	switch keyType {
+	case KeyTypeECDSA, KeyTypeP256:
+		return 65
+	case KeyTypeEd25519:
+		return ed25519.PublicKeySize
+	case KeyTypeThreshold:
+		return 33
+	default:
+		return 0
+	}
+}
+
+// signatureLength returns the length of the signatures of the key type, zero
+// for keys that cannot sign.
+func signatureLength(keyType KeyType) int {
+	switch keyType {
+	case KeyTypeECDSA, KeyTypeThreshold:
+		return 65
+	case KeyTypeEd25519, KeyTypeP256:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// ecdhPublicKeyLength returns the length of the ECDH public keys of the key
+// type, zero for keys that cannot be used for ECDH.
+func ecdhPublicKeyLength(keyType KeyType) int {
+	switch keyType {
+	case KeyTypeECDSA, KeyTypeP256:
+		return 65
+	case KeyTypeEd25519:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// p256KeyFromScalar returns the P-256 private key with the given 32 byte
+// big-endian scalar.
+func p256KeyFromScalar(d []byte) (*ecdsa.PrivateKey, error) {
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid P-256 key: %w", err)
+	}
+	pub := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}, nil
+}
+
+// p256KeyFromSeed returns the P-256 private key generated from a 32 byte seed.
+// Seeds outside the curve order are rehashed, so that every seed yields a key.
+func p256KeyFromSeed(seed []byte) *ecdsa.PrivateKey {
+	d := sha256.Sum256(nil)
+	copy(d[:], seed)
+	defer zeroBytes(d[:])
+	for {
+		if key, err := p256KeyFromScalar(d[:]); err == nil {
+			return key
+		}
+		d = sha256.Sum256(d[:])
+	}
+}
+
+// p256PublicKey returns the uncompressed public key of a P-256 key.
+func p256PublicKey(pub *ecdsa.PublicKey) []byte {
+	return append(append([]byte{0x04}, math.PaddedBigBytes(pub.X, 32)...), math.PaddedBigBytes(pub.Y, 32)...)
+}
+
+// signP256 signs a 32 byte hash with a P-256 key. The nonce is derived as in
+// RFC 6979, so that all nodes produce the same signature.
+func signP256(key *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	der, err := key.Sign(nil, hash, stdcrypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+	return append(math.PaddedBigBytes(sig.R, 32), math.PaddedBigBytes(sig.S, 32)...), nil
+}
+
+// verifyP256 reports whether sig is a valid P-256 signature of the hash by the
+// uncompressed public key pub.
+func verifyP256(pub, hash, sig []byte) bool {
+	if len(pub) != 65 || pub[0] != 0x04 || len(hash) != 32 || len(sig) != 64 {
+		return false
+	}
+	var (
+		x = new(big.Int).SetBytes(pub[1:33])
+		y = new(big.Int).SetBytes(pub[33:])
+		r = new(big.Int).SetBytes(sig[:32])
+		s = new(big.Int).SetBytes(sig[32:])
+	)
+	return secp256r1.Verify(hash, r, s, x, y)
+}
+
+// verifySecp256k1 reports whether sig is a valid recoverable secp256k1
+// signature of the hash by the uncompressed public key pub.
+func verifySecp256k1(pub, hash, sig []byte) bool {
+	if len(pub) != 65 || len(hash) != 32 || len(sig) != 65 {
+		return false
+	}
+	recovered, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(crypto.FromECDSAPub(recovered), pub)
+}
+
+// verifySignature reports whether sig is a valid signature of the message by
+// the public key of the given key type. Ed25519 signs messages of any length,
+// the other key types sign 32 byte hashes.
+func verifySignature(keyType KeyType, pub, msg, sig []byte) bool {
+	switch keyType {
+	case KeyTypeECDSA:
+		return verifySecp256k1(pub, msg, sig)
+	case KeyTypeEd25519:
+		return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, msg, sig)
+	case KeyTypeThreshold:
+		return len(msg) == 32 && VerifyThresholdSignature(pub, msg, sig)
+	case KeyTypeP256:
+		return verifyP256(pub, msg, sig)
+	default:
+		return false
+	}
+}
+
+// x25519Key returns the X25519 private key of an Ed25519 key, the clamped
+// first half of the SHA-512 hash of its seed (RFC 8032, section 5.1.5).
+func x25519Key(key ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(key.Seed())
+	defer zeroBytes(h[:])
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
+
+// ecdhPublicKey returns the public key peers use for ECDH with the private key.
+func ecdhPublicKey(privKey interface{}) ([]byte, error) {
+	switch key := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		if key.Curve == elliptic.P256() {
+			return p256PublicKey(&key.PublicKey), nil
+		}
+		return crypto.FromECDSAPub(&key.PublicKey), nil
+	case ed25519.PrivateKey:
+		xkey, err := x25519Key(key)
+		if err != nil {
+			return nil, err
+		}
+		return xkey.PublicKey().Bytes(), nil
+	default:
+		return nil, errors.New("key type does not support ECDH")
+	}
+}
+
+// ecdhSharedSecret returns the raw shared secret of the private key and the
+// peer's public key: the X coordinate of the shared point, or the X25519
+// output for Ed25519 keys.
+func ecdhSharedSecret(privKey interface{}, peerPubKey []byte) ([]byte, error) {
+	switch key := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		if key.Curve == elliptic.P256() {
+			peer, err := ecdh.P256().NewPublicKey(peerPubKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer public key: %w", err)
+			}
+			xkey, err := key.ECDH()
+			if err != nil {
+				return nil, err
+			}
+			return xkey.ECDH(peer)
+		}
+		peer, err := crypto.UnmarshalPubkey(peerPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer public key: %w", err)
+		}
+		x, _ := peer.Curve.ScalarMult(peer.X, peer.Y, key.D.Bytes())
+		return x.Bytes(), nil
+
+	case ed25519.PrivateKey:
+		peer, err := ecdh.X25519().NewPublicKey(peerPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer public key: %w", err)
+		}
+		xkey, err := x25519Key(key)
+		if err != nil {
+			return nil, err
+		}
+		return xkey.ECDH(peer)
+
+	default:
+		return nil, errors.New("key type does not support ECDH")
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Test vectors of RFC 8032, section 7.1.
+var ed25519Vectors = []struct {
+	secret, public, message, signature string
+}{
+	{
+		secret:    "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		public:    "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		message:   "",
+		signature: "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b",
+	},
+	{
+		secret:    "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		public:    "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		message:   "72",
+		signature: "92a009a9f0d4cab8720e820b5f642540a2b27b5416503f8fb3762223ebdb69da085ac1e43e15996e458f3613d0f11d8c387b2eaeb4302aeeb00d291612bb0c00",
+	},
+	{
+		secret:    "c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7",
+		public:    "fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025",
+		message:   "af82",
+		signature: "6291d657deec24024827e69c3abe01a30ce548a284743a445e3680d7db5ac3ac18ff9b538d16f290ae67f760984dc6594a7c15e9716ed28dc027beceea1ec40a",
+	},
+}
+
+// Test vectors of RFC 6979, section A.2.5 (P-256 with SHA-256).
+var p256Vectors = struct {
+	secret, public string
+	signatures     []struct{ message, signature string }
+}{
+	secret: "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+	public: "0460fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb67903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299",
+	signatures: []struct{ message, signature string }{
+		{"sample", "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8"},
+		{"test", "f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083"},
+	},
+}
+
+// Tests the key-type-tagged signature verification against the RFC 8032 and
+// RFC 6979 test vectors.
+func TestSGXVerifyTaggedVectors(t *testing.T) {
+	verify := &SGXVerify{repriced: true, tagged: true}
+	check := func(name string, input []byte, want byte) {
+		t.Helper()
+		out, err := verify.Run(input)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out[0] != want {
+			t.Errorf("%s: got %x, want %x", name, out[0], want)
+		}
+	}
+	for i, v := range ed25519Vectors {
+		input := concat([]byte{byte(KeyTypeEd25519)}, common.FromHex(v.public), common.FromHex(v.signature), common.FromHex(v.message))
+		check("ed25519", input, 0x01)
+		input[len(input)-1] ^= 0x01
+		check("ed25519 modified", input, 0x00)
+
+		want := params.SGXVerifyGas + toWordSize(uint64(len(v.message)/2))*params.SGXVerifyWordGas
+		if gas := verify.RequiredGas(input); gas != want {
+			t.Errorf("vector %d: gas %d, want %d", i, gas, want)
+		}
+	}
+	for _, v := range p256Vectors.signatures {
+		hash := sha256.Sum256([]byte(v.message))
+		input := concat([]byte{byte(KeyTypeP256)}, common.FromHex(p256Vectors.public), common.FromHex(v.signature), hash[:])
+		check("p256", input, 0x01)
+		input[len(input)-1] ^= 0x01
+		check("p256 modified", input, 0x00)
+	}
+	// Hashed key types take 32 byte hashes only
+	input := concat([]byte{byte(KeyTypeP256)}, common.FromHex(p256Vectors.public), common.FromHex(p256Vectors.signatures[0].signature), []byte("sample"))
+	if _, err := verify.Run(input); err == nil {
+		t.Error("expected error for unhashed P-256 message")
+	}
+	if _, err := verify.Run([]byte{byte(KeyTypeAES256)}); err == nil {
+		t.Error("expected error for AES key type")
+	}
+}
+
+// Tests P-256 keys and deterministic signatures against RFC 6979.
+func TestSignP256(t *testing.T) {
+	key, err := p256KeyFromScalar(common.FromHex(p256Vectors.secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub := p256PublicKey(&key.PublicKey); !bytes.Equal(pub, common.FromHex(p256Vectors.public)) {
+		t.Fatalf("public key mismatch: %x", pub)
+	}
+	for _, v := range p256Vectors.signatures {
+		hash := sha256.Sum256([]byte(v.message))
+		sig, err := signP256(key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig, common.FromHex(v.signature)) {
+			t.Errorf("message %q: signature %x, want %s", v.message, sig, v.signature)
+		}
+	}
+	// Every seed yields a key, including those beyond the curve order
+	if key := p256KeyFromSeed(bytes.Repeat([]byte{0xff}, 32)); key.D.Sign() == 0 {
+		t.Error("no key for out of range seed")
+	}
+}
+
+// Tests that the X25519 key of an Ed25519 key is its Montgomery form, by
+// mapping the RFC 8032 public keys to the curve25519 u-coordinate
+// u = (1 + y) / (1 - y) (RFC 7748, section 4.1).
+func TestX25519FromEd25519(t *testing.T) {
+	p := new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 255), big.NewInt(19))
+	for _, v := range ed25519Vectors {
+		pub := common.FromHex(v.public)
+		le := make([]byte, 32)
+		for i := range pub {
+			le[31-i] = pub[i]
+		}
+		le[0] &= 0x7f // drop the sign of x
+		y := new(big.Int).SetBytes(le)
+		d := new(big.Int).Sub(common.Big1, y)
+		d.ModInverse(d.Mod(d, p), p)
+		u := new(big.Int).Add(common.Big1, y)
+		u.Mul(u, d).Mod(u, p)
+		want := make([]byte, 32)
+		for i, b := range common.LeftPadBytes(u.Bytes(), 32) {
+			want[31-i] = b
+		}
+		got, err := ecdhPublicKey(ed25519.NewKeyFromSeed(common.FromHex(v.secret)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("X25519 key %x, want %x", got, want)
+		}
+	}
+}
+
+// Tests creating, signing with, verifying and exchanging keys of every key
+// type through the key-type-tagged precompiles.
+func TestSGXKeyTypesPrecompiles(t *testing.T) {
+	ctx, cleanup := setupTestSGXContext(t)
+	defer cleanup()
+
+	var (
+		create    = &SGXKeyCreate{repriced: true, tagged: true}
+		getPublic = &SGXKeyGetPublic{repriced: true, tagged: true}
+		sign      = &SGXSign{repriced: true, tagged: true}
+		verify    = &SGXVerify{repriced: true, tagged: true}
+		ecdh      = &SGXECDH{repriced: true, tagged: true}
+		hash      = sha256.Sum256([]byte("sample"))
+	)
+	if _, err := (&SGXKeyCreate{repriced: true}).RunWithContext(ctx, []byte{byte(KeyTypeP256)}); err == nil {
+		t.Error("P-256 key created before the key types fork")
+	}
+	for _, keyType := range []KeyType{KeyTypeECDSA, KeyTypeEd25519, KeyTypeP256} {
+		var keys [2][]byte
+		for i := range keys {
+			keyID, err := create.RunWithContext(ctx, []byte{byte(keyType)})
+			if err != nil {
+				t.Fatalf("key type %d: create: %v", keyType, err)
+			}
+			keys[i] = keyID
+		}
+		pub, err := getPublic.RunWithContext(ctx, keys[0])
+		if err != nil {
+			t.Fatalf("key type %d: public key: %v", keyType, err)
+		}
+		if KeyType(pub[0]) != keyType || len(pub) != 1+publicKeyLength(keyType) {
+			t.Fatalf("key type %d: public key %x", keyType, pub)
+		}
+		sig, err := sign.RunWithContext(ctx, concat(keys[0], hash[:]))
+		if err != nil {
+			t.Fatalf("key type %d: sign: %v", keyType, err)
+		}
+		if KeyType(sig[0]) != keyType || len(sig) != 1+signatureLength(keyType) {
+			t.Fatalf("key type %d: signature %x", keyType, sig)
+		}
+		// The tagged public key, the signature and the hash form the input of
+		// the verification
+		valid, err := verify.Run(concat(pub, sig[1:], hash[:]))
+		if err != nil || valid[0] != 0x01 {
+			t.Errorf("key type %d: verify: %x, %v", keyType, valid, err)
+		}
+		// Both sides of the key exchange derive the same key
+		var shared [2][]byte
+		for i := range keys {
+			peer, err := getPublic.RunWithContext(ctx, append(common.CopyBytes(keys[1-i]), 0x02))
+			if err != nil {
+				t.Fatalf("key type %d: ECDH public key: %v", keyType, err)
+			}
+			if shared[i], err = ecdh.RunWithContext(ctx, concat(keys[i], peer, []byte("kdf"))); err != nil {
+				t.Fatalf("key type %d: ECDH: %v", keyType, err)
+			}
+		}
+		if !bytes.Equal(shared[0], shared[1]) {
+			t.Errorf("key type %d: shared keys differ: %x != %x", keyType, shared[0], shared[1])
+		}
+		// The peer key must be of the key's type
+		other := KeyTypeEd25519
+		if keyType == KeyTypeEd25519 {
+			other = KeyTypeP256
+		}
+		peer := make([]byte, 1+ecdhPublicKeyLength(other))
+		peer[0] = byte(other)
+		if _, err := ecdh.RunWithContext(ctx, concat(keys[0], peer)); err == nil {
+			t.Errorf("key type %d: ECDH with key type %d peer succeeded", keyType, other)
+		}
+	}
+}
+
+// Tests that the key-type-tagged precompiles activate at the fork block.
+func TestSGXKeyTypesFork(t *testing.T) {
+	config := *params.MergedTestChainConfig
+	config.SGX = &params.SGXConfig{}
+	config.SGXKeyTypesBlock = big.NewInt(10)
+
+	verify := common.BytesToAddress([]byte{0x80, 0x03})
+	input := concat([]byte{byte(KeyTypeEd25519)}, common.FromHex(ed25519Vectors[1].public), common.FromHex(ed25519Vectors[1].signature), common.FromHex(ed25519Vectors[1].message))
+	for _, tt := range []struct {
+		number int64
+		valid  bool
+	}{{9, false}, {10, true}} {
+		contracts := ActivePrecompiledContracts(config.Rules(big.NewInt(tt.number), true, 0))
+		out, err := contracts[verify].Run(input)
+		if valid := err == nil && out[0] == 0x01; valid != tt.valid {
+			t.Errorf("block %d: valid %v, want %v (err %v)", tt.number, valid, tt.valid, err)
+		}
+	}
+	for addr := range PrecompiledContractsSGX {
+		if _, ok := PrecompiledContractsSGXKeyTypes[addr]; !ok {
+			t.Errorf("precompile %x missing from the key types fork", addr)
+		}
+	}
+}
+
+// concat returns the concatenation of the given byte slices.
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
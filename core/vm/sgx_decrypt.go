@@ -23,7 +23,9 @@ import (
 )
 
 // SGXDecrypt is the precompiled contract for symmetric decryption (0x8007)
-type SGXDecrypt struct{}
+type SGXDecrypt struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
 
 // Name returns the name of the contract
 func (c *SGXDecrypt) Name() string {
@@ -38,6 +40,9 @@ func (c *SGXDecrypt) RequiredGas(input []byte) uint64 {
 	}
 	
 	ciphertextLen := uint64(len(input) - 32)
+	if c.repriced {
+		return sgxCipherGas(ciphertextLen)
+	}
 	return 5000 + (ciphertextLen * 10)
 }
 
@@ -91,9 +96,9 @@ func (c *SGXDecrypt) RunWithContext(ctx *SGXContext, input []byte) ([]byte, erro
 		return nil, err
 	}
 	
-	// SECURITY: Only owner can decrypt
-	if metadata.Owner != ctx.Caller {
-		return nil, errors.New("permission denied: only key owner can decrypt")
+	// SECURITY: Only the owner or a grantee with decryption permission can decrypt
+	if !authorizeKeyUse(ctx, metadata, PermissionDecrypt) {
+		return nil, errors.New("permission denied: caller is neither key owner nor granted decryption")
 	}
 	
 	// 4. Check key metadata (ensure it's an AES key)
@@ -21,10 +21,14 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXECDH is the precompiled contract for ECDH key exchange (0x8004)
-type SGXECDH struct{}
+type SGXECDH struct {
+	repriced bool // Gas schedule of the SGX gas fork
+	tagged   bool // Key-type-tagged input of the SGX key types fork
+}
 
 // Name returns the name of the contract
 func (c *SGXECDH) Name() string {
@@ -34,6 +38,9 @@ func (c *SGXECDH) Name() string {
 // RequiredGas calculates the required gas
 // Input format: keyID (32 bytes) + peerPubKey (64 bytes) + optional kdfParams (variable)
 func (c *SGXECDH) RequiredGas(input []byte) uint64 {
+	if c.repriced {
+		return params.SGXECDHGas
+	}
 	return 20000
 }
 
@@ -45,6 +52,11 @@ func (c *SGXECDH) Run(input []byte) ([]byte, error) {
 // RunWithContext executes the contract with SGX context
 // Input format: keyID (32 bytes) + peerPubKey (64 bytes) + optional kdfParams (variable)
 // Output format: newKeyID (32 bytes)
+//
+// From the SGX key types fork on, the peer key is tagged and its length given
+// by the key type, which must match the stored key (see sgx_curves.go):
+// keyID (32 bytes) + keyType (1 byte) + peerPubKey + optional kdfParams. Ed25519
+// keys perform X25519 with 32 byte peer keys, P-256 keys ECDH on P-256.
 func (c *SGXECDH) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
 	// 1. Check if in read-only mode
 	if ctx.IsReadOnly {
@@ -52,16 +64,39 @@ func (c *SGXECDH) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error)
 	}
 	
 	// 2. Parse input
-	if len(input) < 96 {
-		return nil, errors.New("invalid input: expected keyID (32 bytes) + peerPubKey (64 bytes)")
-	}
-	keyID := common.BytesToHash(input[:32])
-	peerPubKey := input[32:96]
-	
-	// Parse optional kdfParams
-	var kdfParams []byte
-	if len(input) > 96 {
-		kdfParams = input[96:]
+	var (
+		keyID      common.Hash
+		keyType    KeyType
+		peerPubKey []byte
+		kdfParams  []byte
+	)
+	if c.tagged {
+		if len(input) < 33 {
+			return nil, errors.New("invalid input: expected keyID (32 bytes) + keyType (1 byte) + peerPubKey")
+		}
+		keyType = KeyType(input[32])
+		peerLen := ecdhPublicKeyLength(keyType)
+		if peerLen == 0 {
+			return nil, fmt.Errorf("key type %d does not support ECDH", keyType)
+		}
+		if len(input) < 33+peerLen {
+			return nil, fmt.Errorf("invalid input: expected %d byte peer public key", peerLen)
+		}
+		keyID = common.BytesToHash(input[:32])
+		peerPubKey = input[33 : 33+peerLen]
+		kdfParams = input[33+peerLen:]
+	} else {
+		if len(input) < 96 {
+			return nil, errors.New("invalid input: expected keyID (32 bytes) + peerPubKey (64 bytes)")
+		}
+		keyID = common.BytesToHash(input[:32])
+		keyType = KeyTypeECDSA
+		peerPubKey = input[32:96]
+		
+		// Parse optional kdfParams
+		if len(input) > 96 {
+			kdfParams = input[96:]
+		}
 	}
 	
 	// 3. Get key metadata and check ownership
@@ -69,6 +104,9 @@ func (c *SGXECDH) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error)
 	if err != nil {
 		return nil, err
 	}
+	if metadata.KeyType != keyType {
+		return nil, fmt.Errorf("key type mismatch: key is type %d", metadata.KeyType)
+	}
 	
 	// SECURITY: Only owner can perform ECDH
 	if metadata.Owner != ctx.Caller {
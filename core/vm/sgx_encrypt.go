@@ -20,10 +20,13 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXEncrypt is the precompiled contract for symmetric encryption (0x8006)
-type SGXEncrypt struct{}
+type SGXEncrypt struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
 
 // Name returns the name of the contract
 func (c *SGXEncrypt) Name() string {
@@ -38,9 +41,18 @@ func (c *SGXEncrypt) RequiredGas(input []byte) uint64 {
 	}
 	
 	plaintextLen := uint64(len(input) - 32)
+	if c.repriced {
+		return sgxCipherGas(plaintextLen)
+	}
 	return 5000 + (plaintextLen * 10)
 }
 
+// sgxCipherGas calculates the gas of encrypting or decrypting size bytes
+// under the SGX gas fork.
+func sgxCipherGas(size uint64) uint64 {
+	return params.SGXCipherGas + toWordSize(size)*params.SGXCipherWordGas
+}
+
 // Run executes the contract (requires context)
 func (c *SGXEncrypt) Run(input []byte) ([]byte, error) {
 	return nil, errors.New("context required")
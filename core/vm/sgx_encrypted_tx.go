@@ -0,0 +1,363 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Encrypted transactions carry a call encrypted to the transaction key of the
+// network, a threshold key whose shares are held by attested nodes, none of
+// which can decrypt alone. Executing an encrypted transaction only commits
+// it: the sender pays for the gas and the transaction is queued in the state.
+// Once the committing block is canonical, the share holders release their
+// decryption shares of the committed payloads
+//
+//	D_i = s_i*R
+//
+// for the ephemeral key R of the payload, with a Chaum-Pedersen proof that
+// D_i and the public share Y_i = s_i*G have the same discrete logarithm. The
+// next block reveals the queued transactions in order, combining threshold
+// many shares into the shared point s*R = Σλ_i*D_i the call is encrypted
+// with. Shares are released for committed payloads only, and the payload
+// proves knowledge of r for its sender and nonce, so a copied ephemeral key
+// cannot be committed to obtain the shares of another transaction.
+//
+// The queue of committed transactions is kept in the storage of the public
+// recipient of encrypted transactions:
+//
+//	keccak256("sgx-encrypted-tx-queue")           index of the next transaction to reveal
+//	keccak256("sgx-encrypted-tx-queue") + 1       index of the next transaction to commit
+//	keccak256("sgx-encrypted-tx" ++ index) + 0..5 sender, nonce, gas, gas price, block, payload hash
+//	keccak256("sgx-encrypted-tx-sender" ++ sender) number of queued transactions of the sender
+
+// DecryptionShareLength is the length of an encoded decryption share: the
+// share index (1 byte), D_i (33 bytes, compressed) and the proof c, z (32
+// bytes each).
+const DecryptionShareLength = 1 + 33 + 32 + 32
+
+var (
+	encryptedTxQueueDomain  = []byte("sgx-encrypted-tx-queue")
+	encryptedTxDomain       = []byte("sgx-encrypted-tx")
+	encryptedTxSenderDomain = []byte("sgx-encrypted-tx-sender")
+	decryptionShareDomain   = []byte("sgx-threshold-decryption")
+)
+
+var (
+	// ErrNoTransactionKey is returned if the chain has no transaction key.
+	ErrNoTransactionKey = errors.New("no SGX transaction key configured")
+
+	errInvalidDecryptionShare = errors.New("invalid decryption share")
+)
+
+// TransactionKeyParams returns the threshold parameters of the transaction
+// key of the chain.
+func TransactionKeyParams(config *params.ChainConfig) (*ThresholdParams, error) {
+	if config.SGX == nil || len(config.SGX.TransactionKey) == 0 {
+		return nil, ErrNoTransactionKey
+	}
+	return decodeThresholdParams(config.SGX.TransactionKey)
+}
+
+// EncryptedTxCommitment is an encrypted transaction committed in a block,
+// waiting to be revealed.
+type EncryptedTxCommitment struct {
+	Index       uint64         // Position in the queue of committed transactions
+	From        common.Address // Sender of the transaction
+	Nonce       uint64         // Nonce of the transaction
+	Gas         uint64         // Gas paid for the call
+	GasPrice    *big.Int       // Effective gas price paid
+	Number      uint64         // Block the transaction was committed in
+	PayloadHash common.Hash    // Hash of the encrypted payload
+}
+
+func encryptedTxQueueSlots() (head, tail common.Hash) {
+	base := new(big.Int).SetBytes(crypto.Keccak256(encryptedTxQueueDomain))
+	return common.BigToHash(base), slotAt(base, 1)
+}
+
+func encryptedTxSlot(index uint64) *big.Int {
+	return new(big.Int).SetBytes(crypto.Keccak256(encryptedTxDomain, new(big.Int).SetUint64(index).FillBytes(make([]byte, 8))))
+}
+
+func encryptedTxSenderSlot(from common.Address) common.Hash {
+	return crypto.Keccak256Hash(encryptedTxSenderDomain, from.Bytes())
+}
+
+// encryptedTxQueue returns the index of the next transaction to reveal and of
+// the next transaction to commit.
+func encryptedTxQueue(db StateDB) (uint64, uint64) {
+	head, tail := encryptedTxQueueSlots()
+	return db.GetState(types.EncryptedTxRecipient, head).Big().Uint64(), db.GetState(types.EncryptedTxRecipient, tail).Big().Uint64()
+}
+
+// CommitEncryptedTx appends a committed transaction to the queue.
+func CommitEncryptedTx(db StateDB, c *EncryptedTxCommitment) {
+	var (
+		_, tail   = encryptedTxQueueSlots()
+		_, index  = encryptedTxQueue(db)
+		base      = encryptedTxSlot(index)
+		recipient = types.EncryptedTxRecipient
+	)
+	touchSGXAccount(db, recipient)
+	db.SetState(recipient, slotAt(base, 0), common.BytesToHash(c.From.Bytes()))
+	db.SetState(recipient, slotAt(base, 1), common.BigToHash(new(big.Int).SetUint64(c.Nonce)))
+	db.SetState(recipient, slotAt(base, 2), common.BigToHash(new(big.Int).SetUint64(c.Gas)))
+	db.SetState(recipient, slotAt(base, 3), common.BigToHash(c.GasPrice))
+	db.SetState(recipient, slotAt(base, 4), common.BigToHash(new(big.Int).SetUint64(c.Number)))
+	db.SetState(recipient, slotAt(base, 5), c.PayloadHash)
+	db.SetState(recipient, tail, common.BigToHash(new(big.Int).SetUint64(index+1)))
+	db.SetState(recipient, encryptedTxSenderSlot(c.From), common.BigToHash(new(big.Int).SetUint64(PendingEncryptedTxsOf(db, c.From)+1)))
+	c.Index = index
+}
+
+// EncryptedTxAt returns the committed transaction at the given position of
+// the queue, if it has not been revealed yet.
+func EncryptedTxAt(db StateDB, index uint64) (*EncryptedTxCommitment, bool) {
+	if head, tail := encryptedTxQueue(db); index < head || index >= tail {
+		return nil, false
+	}
+	var (
+		base      = encryptedTxSlot(index)
+		recipient = types.EncryptedTxRecipient
+	)
+	return &EncryptedTxCommitment{
+		Index:       index,
+		From:        common.BytesToAddress(db.GetState(recipient, slotAt(base, 0)).Bytes()),
+		Nonce:       db.GetState(recipient, slotAt(base, 1)).Big().Uint64(),
+		Gas:         db.GetState(recipient, slotAt(base, 2)).Big().Uint64(),
+		GasPrice:    db.GetState(recipient, slotAt(base, 3)).Big(),
+		Number:      db.GetState(recipient, slotAt(base, 4)).Big().Uint64(),
+		PayloadHash: db.GetState(recipient, slotAt(base, 5)),
+	}, true
+}
+
+// NextEncryptedTx returns the committed transaction to reveal next.
+func NextEncryptedTx(db StateDB) (*EncryptedTxCommitment, bool) {
+	head, _ := encryptedTxQueue(db)
+	return EncryptedTxAt(db, head)
+}
+
+// PendingEncryptedTxs returns the committed transactions not revealed yet, in
+// commitment order.
+func PendingEncryptedTxs(db StateDB) []*EncryptedTxCommitment {
+	var (
+		head, tail = encryptedTxQueue(db)
+		pending    []*EncryptedTxCommitment
+	)
+	for index := head; index < tail; index++ {
+		c, _ := EncryptedTxAt(db, index)
+		pending = append(pending, c)
+	}
+	return pending
+}
+
+// PendingEncryptedTxCount returns the number of committed transactions not
+// revealed yet.
+func PendingEncryptedTxCount(db StateDB) uint64 {
+	head, tail := encryptedTxQueue(db)
+	return tail - head
+}
+
+// PendingEncryptedTxsOf returns the number of committed transactions of a
+// sender not revealed yet.
+func PendingEncryptedTxsOf(db StateDB, from common.Address) uint64 {
+	return db.GetState(types.EncryptedTxRecipient, encryptedTxSenderSlot(from)).Big().Uint64()
+}
+
+// CommittedEncryptedTxCount returns the number of transactions committed in
+// the given block that are not revealed yet, the last ones of the queue.
+func CommittedEncryptedTxCount(db StateDB, number uint64) uint64 {
+	var (
+		head, tail = encryptedTxQueue(db)
+		count      uint64
+	)
+	for index := tail; index > head; index-- {
+		if db.GetState(types.EncryptedTxRecipient, slotAt(encryptedTxSlot(index-1), 4)).Big().Uint64() != number {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+// PopEncryptedTx removes the next committed transaction from the queue.
+func PopEncryptedTx(db StateDB) {
+	head, tail := encryptedTxQueue(db)
+	if head >= tail {
+		return
+	}
+	var (
+		headSlot, _ = encryptedTxQueueSlots()
+		base        = encryptedTxSlot(head)
+		recipient   = types.EncryptedTxRecipient
+		from        = common.BytesToAddress(db.GetState(recipient, slotAt(base, 0)).Bytes())
+	)
+	db.SetState(recipient, encryptedTxSenderSlot(from), common.BigToHash(new(big.Int).SetUint64(PendingEncryptedTxsOf(db, from)-1)))
+	for i := 0; i < 6; i++ {
+		db.SetState(recipient, slotAt(base, i), common.Hash{})
+	}
+	db.SetState(recipient, headSlot, common.BigToHash(new(big.Int).SetUint64(head+1)))
+}
+
+// decryptionChallenge computes the challenge of the proof of a decryption
+// share.
+func decryptionChallenge(publicShare, ephemeral, share, a, b []byte) *big.Int {
+	c := new(big.Int).SetBytes(crypto.Keccak256(decryptionShareDomain, publicShare, ephemeral, share, a, b))
+	return c.Mod(c, crypto.S256().Params().N)
+}
+
+// DecryptionShare computes the decryption share of the compressed ephemeral
+// key of an encrypted payload, with a proof that it was computed with the
+// share.
+func (s *KeyShare) DecryptionShare(ephemeral []byte, rand io.Reader) ([]byte, error) {
+	point, err := crypto.DecompressPubkey(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	k, err := s.nonce(rand)
+	if err != nil {
+		return nil, err
+	}
+	defer k.SetInt64(0)
+
+	var (
+		curve  = crypto.S256()
+		n      = curve.Params().N
+		secret = math.PaddedBigBytes(s.Value, 32)
+		nonce  = math.PaddedBigBytes(k, 32)
+	)
+	defer zeroBytes(secret)
+	defer zeroBytes(nonce)
+
+	dx, dy := curve.ScalarMult(point.X, point.Y, secret)
+	yx, yy := curve.ScalarBaseMult(secret)
+	ax, ay := curve.ScalarBaseMult(nonce)
+	bx, by := curve.ScalarMult(point.X, point.Y, nonce)
+
+	share := compressPoint(dx, dy)
+	c := decryptionChallenge(compressPoint(yx, yy), ephemeral, share, compressPoint(ax, ay), compressPoint(bx, by))
+	z := new(big.Int).Mul(c, s.Value)
+	z.Add(z, k).Mod(z, n)
+
+	out := append([]byte{s.Index}, share...)
+	out = append(out, math.PaddedBigBytes(c, 32)...)
+	return append(out, math.PaddedBigBytes(z, 32)...), nil
+}
+
+// verifyDecryptionShare checks the proof of a decryption share of the
+// ephemeral key against the public share of its index, and returns the index
+// and D_i.
+func verifyDecryptionShare(params *ThresholdParams, ephemeral []byte, point *ecdsa.PublicKey, share []byte) (uint8, *big.Int, *big.Int, error) {
+	var (
+		curve = crypto.S256()
+		n     = curve.Params().N
+	)
+	if len(share) != DecryptionShareLength || share[0] == 0 {
+		return 0, nil, nil, fmt.Errorf("%w: length %d", errInvalidDecryptionShare, len(share))
+	}
+	index := share[0]
+	d, err := crypto.DecompressPubkey(share[1:34])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("%w: %v", errInvalidDecryptionShare, err)
+	}
+	c := new(big.Int).SetBytes(share[34:66])
+	z := new(big.Int).SetBytes(share[66:])
+	if c.Sign() == 0 || c.Cmp(n) >= 0 || z.Sign() == 0 || z.Cmp(n) >= 0 {
+		return 0, nil, nil, fmt.Errorf("%w: proof out of range", errInvalidDecryptionShare)
+	}
+	// A = z*G - c*Y_i and B = z*R - c*D_i
+	var (
+		negC   = math.PaddedBigBytes(new(big.Int).Sub(n, c), 32)
+		zBytes = math.PaddedBigBytes(z, 32)
+	)
+	yx, yy := params.publicShare(index)
+	ax, ay := curve.ScalarBaseMult(zBytes)
+	cx, cy := curve.ScalarMult(yx, yy, negC)
+	ax, ay = curve.Add(ax, ay, cx, cy)
+
+	bx, by := curve.ScalarMult(point.X, point.Y, zBytes)
+	cx, cy = curve.ScalarMult(d.X, d.Y, negC)
+	bx, by = curve.Add(bx, by, cx, cy)
+
+	if ax.Sign() == 0 && ay.Sign() == 0 || bx.Sign() == 0 && by.Sign() == 0 {
+		return 0, nil, nil, fmt.Errorf("%w: invalid proof", errInvalidDecryptionShare)
+	}
+	if decryptionChallenge(compressPoint(yx, yy), ephemeral, share[1:34], compressPoint(ax, ay), compressPoint(bx, by)).Cmp(c) != 0 {
+		return 0, nil, nil, fmt.Errorf("%w: share %d does not match its proof", errInvalidDecryptionShare, index)
+	}
+	return index, d.X, d.Y, nil
+}
+
+// VerifyDecryptionShare checks a decryption share of the compressed ephemeral
+// key of an encrypted payload.
+func VerifyDecryptionShare(params *ThresholdParams, ephemeral []byte, share []byte) error {
+	point, err := crypto.DecompressPubkey(ephemeral)
+	if err != nil {
+		return fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	_, _, _, err = verifyDecryptionShare(params, ephemeral, point, share)
+	return err
+}
+
+// CombineDecryptionShares verifies exactly threshold many decryption shares
+// of the compressed ephemeral key R, ascending by share index, and returns
+// the compressed shared point s*R.
+func CombineDecryptionShares(params *ThresholdParams, ephemeral []byte, shares [][]byte) ([]byte, error) {
+	if len(shares) != int(params.Threshold) {
+		return nil, fmt.Errorf("%w: %d shares, threshold %d", errInvalidDecryptionShare, len(shares), params.Threshold)
+	}
+	point, err := crypto.DecompressPubkey(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral key: %v", err)
+	}
+	var (
+		curve   = crypto.S256()
+		indices = make([]uint8, len(shares))
+		points  = make([][2]*big.Int, len(shares))
+	)
+	for i, share := range shares {
+		index, x, y, err := verifyDecryptionShare(params, ephemeral, point, share)
+		if err != nil {
+			return nil, err
+		}
+		indices[i], points[i] = index, [2]*big.Int{x, y}
+	}
+	if err := checkSignerSet(indices, params.Threshold); err != nil {
+		return nil, err
+	}
+	var x, y *big.Int
+	for i, index := range indices {
+		px, py := curve.ScalarMult(points[i][0], points[i][1], math.PaddedBigBytes(lagrangeCoefficient(index, indices), 32))
+		if x == nil {
+			x, y = px, py
+		} else {
+			x, y = curve.Add(x, y, px, py)
+		}
+	}
+	return compressPoint(x, y), nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that threshold many decryption shares decrypt an encrypted call, and
+// that invalid or incomplete share sets are rejected.
+func TestDecryptionShares(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	params, shares, err := SplitThresholdKey(crypto.FromECDSA(key), 2, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupKey, _ := crypto.DecompressPubkey(params.GroupKey())
+	var (
+		chainID = big.NewInt(1)
+		from    = common.Address{0x01}
+		info    = types.EncryptedTxSharedInfo(chainID, from, 0)
+		call    = &types.EncryptedCall{To: common.Address{0x02}, Value: big.NewInt(7), Data: []byte{0x2a}}
+	)
+	payload, err := types.EncryptTxCall(rand.Reader, groupKey, chainID, from, 0, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ephemeral := types.EncryptedTxEphemeralKey(payload)
+
+	var released [][]byte
+	for _, share := range shares {
+		d, err := share.DecryptionShare(ephemeral, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyDecryptionShare(params, ephemeral, d); err != nil {
+			t.Fatalf("share %d rejected: %v", share.Index, err)
+		}
+		released = append(released, d)
+	}
+	// Any threshold of the shares decrypts the call
+	for _, set := range [][][]byte{{released[0], released[1]}, {released[0], released[2]}, {released[1], released[2]}} {
+		shared, err := CombineDecryptionShares(params, ephemeral, set)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := types.DecryptTxCall(payload, shared, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.To != call.To || decoded.Value.Cmp(call.Value) != 0 {
+			t.Errorf("decrypted call %+v, want %+v", decoded, call)
+		}
+	}
+	// Share sets of the wrong size or order are rejected
+	for _, set := range [][][]byte{{released[0]}, {released[0], released[1], released[2]}, {released[1], released[0]}, {released[0], released[0]}} {
+		if _, err := CombineDecryptionShares(params, ephemeral, set); err == nil {
+			t.Errorf("invalid share set of %d shares combined", len(set))
+		}
+	}
+	// Tampered shares and shares of another ephemeral key are rejected
+	tampered := common.CopyBytes(released[0])
+	tampered[5] ^= 0x01
+	if err := VerifyDecryptionShare(params, ephemeral, tampered); err == nil {
+		t.Error("tampered share accepted")
+	}
+	other, _ := crypto.GenerateKey()
+	if err := VerifyDecryptionShare(params, crypto.CompressPubkey(&other.PublicKey), released[0]); !errors.Is(err, errInvalidDecryptionShare) {
+		t.Errorf("expected errInvalidDecryptionShare for another ephemeral key, got %v", err)
+	}
+}
+
+// Tests that committed encrypted transactions are revealed in commitment
+// order, and that the queued transactions are counted per sender and block.
+func TestEncryptedTxQueue(t *testing.T) {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if _, ok := NextEncryptedTx(statedb); ok {
+		t.Fatal("empty queue has a next transaction")
+	}
+	for i := uint64(0); i < 3; i++ {
+		CommitEncryptedTx(statedb, &EncryptedTxCommitment{
+			From:        common.Address{byte(i % 2)},
+			Nonce:       i,
+			Gas:         21000 + i,
+			GasPrice:    big.NewInt(int64(i + 1)),
+			Number:      10,
+			PayloadHash: common.Hash{byte(i)},
+		})
+	}
+	if pending := PendingEncryptedTxs(statedb); len(pending) != 3 {
+		t.Fatalf("%d pending transactions, want 3", len(pending))
+	}
+	if n := PendingEncryptedTxsOf(statedb, common.Address{0}); n != 2 {
+		t.Fatalf("%d pending transactions of sender, want 2", n)
+	}
+	if n, m := CommittedEncryptedTxCount(statedb, 10), CommittedEncryptedTxCount(statedb, 11); n != 3 || m != 0 {
+		t.Fatalf("committed in blocks 10 and 11: %d, %d", n, m)
+	}
+	for i := uint64(0); i < 3; i++ {
+		next, ok := NextEncryptedTx(statedb)
+		if !ok || next.Index != i || next.Nonce != i || next.Gas != 21000+i || next.GasPrice.Uint64() != i+1 || next.PayloadHash != (common.Hash{byte(i)}) {
+			t.Fatalf("transaction %d: %+v", i, next)
+		}
+		PopEncryptedTx(statedb)
+	}
+	if _, ok := EncryptedTxAt(statedb, 0); ok {
+		t.Error("revealed transaction still queued")
+	}
+	if pending := PendingEncryptedTxs(statedb); len(pending) != 0 {
+		t.Errorf("%d pending transactions after the reveals", len(pending))
+	}
+	if n := PendingEncryptedTxsOf(statedb, common.Address{0}); n != 0 {
+		t.Errorf("%d pending transactions of sender after the reveals", n)
+	}
+}
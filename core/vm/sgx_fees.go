@@ -0,0 +1,55 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// SGX chains collect the transaction fees of a block in the incentive
+// contract set as the block coinbase, which the consensus engine distributes
+// to the ranked producers. The fees are accounted explicitly as they are paid
+// rather than inferred from the balance of the contract, which also receives
+// plain transfers and slashed funds.
+
+// sgxBlockFeesSlot is the storage slot of the coinbase accumulating the fees
+// paid in the current block.
+var sgxBlockFeesSlot = crypto.Keccak256Hash([]byte("sgx.blockFees"))
+
+// AddBlockFees records a transaction fee paid to the coinbase.
+func AddBlockFees(db StateDB, coinbase common.Address, fee *uint256.Int) {
+	if fee.IsZero() {
+		return
+	}
+	fees := BlockFees(db, coinbase)
+	fees.Add(fees, fee)
+	db.SetState(coinbase, sgxBlockFeesSlot, fees.Bytes32())
+}
+
+// BlockFees returns the fees paid to the coinbase since the last reset.
+func BlockFees(db StateDB, coinbase common.Address) *uint256.Int {
+	slot := db.GetState(coinbase, sgxBlockFeesSlot)
+	return new(uint256.Int).SetBytes(slot[:])
+}
+
+// ResetBlockFees clears the fees paid to the coinbase, once the consensus
+// engine has taken them over at the end of the block.
+func ResetBlockFees(db StateDB, coinbase common.Address) {
+	db.SetState(coinbase, sgxBlockFeesSlot, common.Hash{})
+}
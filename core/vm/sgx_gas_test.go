@@ -0,0 +1,305 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// sgxBenchKeyStoreSizes are the numbers of keys held by the key stores the
+// SGX precompiles are benchmarked with.
+var sgxBenchKeyStoreSizes = []int{10, 1000}
+
+// sgxBenchEnv is a key store filled with keys and a state to run the SGX
+// precompiles on.
+type sgxBenchEnv struct {
+	keys    *EncryptedKeyStore
+	statedb *state.StateDB
+	owner   common.Address
+
+	ecdsaKey, ed25519Key, aesKey common.Hash
+	thresholdKey                 common.Hash
+	thresholdShares              []*KeyShare
+}
+
+func newSGXBenchEnv(b *testing.B, size int) *sgxBenchEnv {
+	b.Helper()
+
+	dir := b.TempDir()
+	keys, err := NewEncryptedKeyStore(filepath.Join(dir, "encrypted"), filepath.Join(dir, "public"), FileSealingKey{Path: filepath.Join(dir, "sealing.key")})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := keys.SetMasterSecret(make([]byte, MasterSecretLength)); err != nil {
+		b.Fatal(err)
+	}
+	env := &sgxBenchEnv{keys: keys, owner: common.Address{0x01}}
+	env.statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+
+	keyTypes := []KeyType{KeyTypeECDSA, KeyTypeEd25519, KeyTypeAES256}
+	for i := 0; i < size; i++ {
+		if _, err := keys.CreateKey(common.Address{0x02}, keyTypes[i%len(keyTypes)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for _, key := range []struct {
+		id      *common.Hash
+		keyType KeyType
+	}{{&env.ecdsaKey, KeyTypeECDSA}, {&env.ed25519Key, KeyTypeEd25519}, {&env.aesKey, KeyTypeAES256}} {
+		if *key.id, err = keys.CreateKey(env.owner, key.keyType); err != nil {
+			b.Fatal(err)
+		}
+	}
+	secret, _ := crypto.GenerateKey()
+	params, shares, err := SplitThresholdKey(crypto.FromECDSA(secret), 2, 3, rand.Reader)
+	if err != nil {
+		b.Fatal(err)
+	}
+	registerThresholdKey(env.statedb, env.owner, params)
+	env.thresholdKey, env.thresholdShares = params.KeyID(), shares
+	return env
+}
+
+func (env *sgxBenchEnv) context() *SGXContext {
+	return &SGXContext{
+		Caller:            env.owner,
+		Origin:            env.owner,
+		BlockNumber:       1,
+		Timestamp:         1,
+		ChainID:           big.NewInt(1),
+		StateDB:           env.statedb,
+		KeyStore:          env.keys,
+		PermissionManager: NewStatePermissionManager(env.statedb),
+		Randomness:        common.Hash{0x01},
+	}
+}
+
+// sgxBenchmark is an SGX precompile call to benchmark. The input is built once
+// the environment exists, reset runs untimed before every call.
+type sgxBenchmark struct {
+	name  string
+	addr  byte
+	input func(env *sgxBenchEnv) []byte
+	reset func(env *sgxBenchEnv, input []byte)
+}
+
+var sgxBenchmarks = []sgxBenchmark{
+	{name: "KeyCreate-ECDSA", addr: 0x00, input: func(*sgxBenchEnv) []byte { return []byte{byte(KeyTypeECDSA)} }},
+	{name: "KeyCreate-AES", addr: 0x00, input: func(*sgxBenchEnv) []byte { return []byte{byte(KeyTypeAES256)} }},
+	{name: "KeyGetPublic", addr: 0x01, input: func(env *sgxBenchEnv) []byte { return env.ecdsaKey.Bytes() }},
+	{name: "Sign-ECDSA", addr: 0x02, input: func(env *sgxBenchEnv) []byte { return append(env.ecdsaKey.Bytes(), make([]byte, 32)...) }},
+	{name: "Sign-Ed25519", addr: 0x02, input: func(env *sgxBenchEnv) []byte { return append(env.ed25519Key.Bytes(), make([]byte, 32)...) }},
+	{name: "Sign-Threshold-Request", addr: 0x02, input: func(env *sgxBenchEnv) []byte { return append(env.thresholdKey.Bytes(), make([]byte, 32)...) }},
+	{
+		name: "Sign-Threshold-Combine-2", addr: 0x02,
+		input: func(env *sgxBenchEnv) []byte {
+			hash := make([]byte, 32)
+			input := append(env.thresholdKey.Bytes(), hash...)
+			return append(input, sgxBenchPartials(env.thresholdShares[:2], hash)...)
+		},
+		reset: func(env *sgxBenchEnv, input []byte) {
+			setThresholdSignRequest(env.statedb, env.thresholdKey, input[32:64], true)
+		},
+	},
+	{name: "Verify-ECDSA", addr: 0x03, input: sgxBenchVerifyECDSA},
+	// ECDH is not benchmarked: the key store cannot parse the 64 byte peer
+	// keys the precompile passes on (see TestSGXECDH)
+	{name: "Random-32", addr: 0x05, input: func(*sgxBenchEnv) []byte { return common.LeftPadBytes([]byte{32}, 32) }},
+	{name: "Random-1024", addr: 0x05, input: func(*sgxBenchEnv) []byte { return common.LeftPadBytes([]byte{0x04, 0x00}, 32) }},
+	{name: "Encrypt-32", addr: 0x06, input: func(env *sgxBenchEnv) []byte { return append(env.aesKey.Bytes(), make([]byte, 32)...) }},
+	{name: "Encrypt-4096", addr: 0x06, input: func(env *sgxBenchEnv) []byte { return append(env.aesKey.Bytes(), make([]byte, 4096)...) }},
+	{name: "Decrypt-32", addr: 0x07, input: func(env *sgxBenchEnv) []byte { return sgxBenchCiphertext(env, 32) }},
+	{name: "Decrypt-4096", addr: 0x07, input: func(env *sgxBenchEnv) []byte { return sgxBenchCiphertext(env, 4096) }},
+	{name: "KeyDerive-1", addr: 0x08, input: func(env *sgxBenchEnv) []byte {
+		return append(env.ecdsaKey.Bytes(), EncodeDerivationPath(1)...)
+	}},
+	{name: "KeyDerive-5", addr: 0x08, input: func(env *sgxBenchEnv) []byte {
+		return append(env.ecdsaKey.Bytes(), EncodeDerivationPath(1, 2, 3, 4, 5)...)
+	}},
+	{
+		name: "KeyDelete", addr: 0x09,
+		input: func(env *sgxBenchEnv) []byte { return make([]byte, 32) },
+		reset: func(env *sgxBenchEnv, input []byte) {
+			keyID, _ := env.keys.CreateKey(env.owner, KeyTypeECDSA)
+			copy(input, keyID.Bytes())
+		},
+	},
+	{name: "TransferOwnership", addr: 0x0a, input: func(env *sgxBenchEnv) []byte { return append(env.ecdsaKey.Bytes(), env.owner.Bytes()...) }},
+	{name: "RandomProof-32", addr: 0x0b, input: func(*sgxBenchEnv) []byte { return common.LeftPadBytes([]byte{32}, 32) }},
+	{name: "GrantPermission", addr: 0x0c, input: func(env *sgxBenchEnv) []byte {
+		input := append(env.ecdsaKey.Bytes(), common.Address{0xaa}.Bytes()...)
+		return append(input, append([]byte{byte(PermissionSign)}, make([]byte, 16)...)...)
+	}},
+	{
+		name: "RevokePermission", addr: 0x0d,
+		input: func(env *sgxBenchEnv) []byte {
+			return append(append(env.ecdsaKey.Bytes(), common.Address{0xbb}.Bytes()...), byte(PermissionSign))
+		},
+		reset: func(env *sgxBenchEnv, input []byte) {
+			NewStatePermissionManager(env.statedb).GrantPermission(env.ecdsaKey, Permission{Grantee: common.Address{0xbb}, Type: PermissionSign})
+		},
+	},
+}
+
+// sgxThresholdBenchmarks are the benchmarks of the SGX threshold keys fork.
+var sgxThresholdBenchmarks = []sgxBenchmark{
+	{name: "Verify-Threshold", addr: 0x03, input: sgxBenchVerifyThreshold},
+}
+
+func sgxBenchPartials(shares []*KeyShare, hash []byte) []byte {
+	var (
+		signers     []uint8
+		nonces      []*SigningNonces
+		commitments [][]byte
+	)
+	for _, s := range shares {
+		n, _ := s.Commit(rand.Reader)
+		signers = append(signers, s.Index)
+		nonces = append(nonces, n)
+		commitments = append(commitments, n.Commitment())
+	}
+	var partials []byte
+	for i, s := range shares {
+		partial, _ := s.PartialSign(nonces[i], hash, signers, commitments)
+		partials = append(partials, partial...)
+	}
+	return partials
+}
+
+func sgxBenchVerifyECDSA(env *sgxBenchEnv) []byte {
+	hash := make([]byte, 32)
+	sig, _ := env.keys.Sign(env.ecdsaKey, hash)
+	pub, _ := env.keys.GetPublicKey(env.ecdsaKey)
+	return append(append(hash, sig...), pub...)
+}
+
+func sgxBenchVerifyThreshold(env *sgxBenchEnv) []byte {
+	hash := make([]byte, 32)
+	_, params, _ := thresholdKey(env.statedb, env.thresholdKey)
+	sig, _ := CombineThresholdSignature(params, hash, sgxBenchPartials(env.thresholdShares[:2], hash))
+	input := append([]byte{byte(KeyTypeThreshold)}, params.GroupKey()...)
+	return append(append(input, sig...), hash...)
+}
+
+func sgxBenchCiphertext(env *sgxBenchEnv, size int) []byte {
+	ciphertext, _ := env.keys.Encrypt(env.aesKey, make([]byte, size))
+	return append(env.aesKey.Bytes(), ciphertext...)
+}
+
+// benchmarkSGXPrecompiled is benchmarkPrecompiled for the SGX precompiles,
+// which run with a context on a key store.
+func benchmarkSGXPrecompiled(b *testing.B, contracts PrecompiledContracts, env *sgxBenchEnv, test sgxBenchmark) {
+	p := contracts[common.BytesToAddress([]byte{0x80, test.addr})]
+	in := test.input(env)
+	reqGas := p.RequiredGas(in)
+
+	b.Run(fmt.Sprintf("%s-Gas=%d", test.name, reqGas), func(b *testing.B) {
+		b.ReportAllocs()
+		var (
+			err     error
+			elapsed time.Duration
+			data    = make([]byte, len(in))
+		)
+		for i := 0; i < b.N; i++ {
+			copy(data, in)
+			if test.reset != nil {
+				test.reset(env, data)
+			}
+			ctx, start := env.context(), time.Now()
+			if sp, ok := p.(SGXPrecompileWithContext); ok {
+				_, _, err = RunSGXPrecompiledContract(sp, ctx, data, reqGas, nil)
+			} else {
+				_, _, err = RunPrecompiledContract(p, data, reqGas, nil)
+			}
+			elapsed += time.Since(start)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		if elapsed < 1 {
+			elapsed = 1
+		}
+		gasUsed := reqGas * uint64(b.N)
+		b.ReportMetric(float64(reqGas), "gas/op")
+		// Keep it as uint64, multiply 100 to get two digit float later
+		mgasps := (100 * 1000 * gasUsed) / uint64(elapsed)
+		b.ReportMetric(float64(mgasps)/100, "mgas/s")
+	})
+}
+
+// Benchmarks the SGX precompiles under the legacy and the repriced gas
+// schedule, with key stores of different sizes.
+func BenchmarkPrecompiledSGX(b *testing.B) {
+	for _, size := range sgxBenchKeyStoreSizes {
+		env := newSGXBenchEnv(b, size)
+		for _, schedule := range []struct {
+			name      string
+			contracts PrecompiledContracts
+		}{{"legacy", PrecompiledContractsSGX}, {"repriced", PrecompiledContractsSGXRepriced}} {
+			b.Run(fmt.Sprintf("keys=%d/%s", size, schedule.name), func(b *testing.B) {
+				for _, test := range sgxBenchmarks {
+					benchmarkSGXPrecompiled(b, schedule.contracts, env, test)
+				}
+			})
+		}
+		b.Run(fmt.Sprintf("keys=%d/threshold", size), func(b *testing.B) {
+			for _, test := range sgxThresholdBenchmarks {
+				benchmarkSGXPrecompiled(b, PrecompiledContractsSGXThreshold, env, test)
+			}
+		})
+	}
+}
+
+// Tests that the SGX gas schedule changes at the fork block only.
+func TestSGXGasSchedule(t *testing.T) {
+	config := *params.MergedTestChainConfig
+	config.SGX = &params.SGXConfig{}
+	config.SGXGasBlock = big.NewInt(10)
+
+	sign := common.BytesToAddress([]byte{0x80, 0x02})
+	for _, tt := range []struct {
+		number int64
+		gas    uint64
+	}{{9, 10000}, {10, params.SGXSignGas}, {11, params.SGXSignGas}} {
+		contracts := ActivePrecompiledContracts(config.Rules(big.NewInt(tt.number), true, 0))
+		if gas := contracts[sign].RequiredGas(make([]byte, 64)); gas != tt.gas {
+			t.Errorf("block %d: sign gas %d, want %d", tt.number, gas, tt.gas)
+		}
+	}
+	// Both schedules cover all SGX precompiles
+	for addr := range PrecompiledContractsSGX {
+		if _, ok := PrecompiledContractsSGXRepriced[addr]; !ok {
+			t.Errorf("precompile %x not repriced", addr)
+		}
+	}
+	// Without SGX the fork block has no effect
+	config.SGX = nil
+	if config.Rules(big.NewInt(10), true, 0).IsSGXGas {
+		t.Error("SGX gas schedule active without SGX")
+	}
+}
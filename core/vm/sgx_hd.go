@@ -0,0 +1,227 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Keys of the SGX key store form hierarchies:
+//
+//   - secp256k1 keys derive children as in BIP32, with hardened and
+//     non-hardened indices. Non-hardened children can be derived from the
+//     extended public key (xpub) of the parent without the enclave.
+//   - Ed25519 keys derive children as in SLIP-10, hardened indices only.
+//   - AES keys derive children with HKDF-SHA256.
+//
+// A derivation path is the concatenation of its uint32 indices, each encoded
+// in 4 bytes big-endian (abi.encodePacked of uint32 values in Solidity).
+// Indices from HardenedKeyStart on are hardened.
+//
+// Keys created from a seed rather than derived have no BIP32 chain code, so
+// theirs is derived from the private key.
+
+// HardenedKeyStart is the first hardened child index.
+const HardenedKeyStart uint32 = 0x80000000
+
+// MaxDerivationPathLength is the maximum number of indices in a path.
+const MaxDerivationPathLength = 32
+
+// ExtendedPublicKeyLength is the length of a serialized BIP32 extended public
+// key (without base58 checksum).
+const ExtendedPublicKeyLength = 78
+
+// xpubVersion is the BIP32 version of mainnet extended public keys.
+var xpubVersion = []byte{0x04, 0x88, 0xb2, 0x1e}
+
+var (
+	errInvalidPath     = errors.New("invalid derivation path")
+	errHardenedPublic  = errors.New("cannot derive hardened child from public key")
+	errHardenedOnly    = errors.New("Ed25519 keys only derive hardened children")
+	errInvalidChildKey = errors.New("invalid child key, use the next index")
+)
+
+// ParseDerivationPath decodes a derivation path into its indices.
+func ParseDerivationPath(path []byte) ([]uint32, error) {
+	if len(path) == 0 || len(path)%4 != 0 || len(path)/4 > MaxDerivationPathLength {
+		return nil, fmt.Errorf("%w: length %d", errInvalidPath, len(path))
+	}
+	indices := make([]uint32, len(path)/4)
+	for i := range indices {
+		indices[i] = binary.BigEndian.Uint32(path[4*i:])
+	}
+	return indices, nil
+}
+
+// EncodeDerivationPath encodes the indices of a derivation path.
+func EncodeDerivationPath(indices ...uint32) []byte {
+	path := make([]byte, 0, 4*len(indices))
+	for _, index := range indices {
+		path = binary.BigEndian.AppendUint32(path, index)
+	}
+	return path
+}
+
+// defaultChainCode returns the chain code of a key that was not derived.
+func defaultChainCode(material []byte) []byte {
+	mac := hmac.New(sha256.New, []byte("sgx-chain-code"))
+	mac.Write(material)
+	return mac.Sum(nil)
+}
+
+// hdMAC computes HMAC-SHA512(chainCode, data ++ index), split into the child
+// key material and chain code.
+func hdMAC(chainCode []byte, data []byte, index uint32) ([]byte, []byte) {
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	mac.Write(binary.BigEndian.AppendUint32(nil, index))
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+// keyFingerprint returns the BIP32 fingerprint of a serialized public key.
+func keyFingerprint(publicKey []byte) uint32 {
+	sha := sha256.Sum256(publicKey)
+	hasher := ripemd160.New()
+	hasher.Write(sha[:])
+	return binary.BigEndian.Uint32(hasher.Sum(nil))
+}
+
+// deriveChildECDSA derives the BIP32 child of a secp256k1 key.
+func deriveChildECDSA(key *ecdsa.PrivateKey, chainCode []byte, index uint32) (*ecdsa.PrivateKey, []byte, error) {
+	var data []byte
+	if index >= HardenedKeyStart {
+		data = append([]byte{0x00}, math.PaddedBigBytes(key.D, 32)...)
+	} else {
+		data = crypto.CompressPubkey(&key.PublicKey)
+	}
+	il, childChainCode := hdMAC(chainCode, data, index)
+	defer clear(il)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(il)
+	if tweak.Cmp(n) >= 0 {
+		return nil, nil, errInvalidChildKey
+	}
+	d := tweak.Add(tweak, key.D)
+	d.Mod(d, n)
+	if d.Sign() == 0 {
+		return nil, nil, errInvalidChildKey
+	}
+	child, err := crypto.ToECDSA(math.PaddedBigBytes(d, 32))
+	d.SetInt64(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return child, childChainCode, nil
+}
+
+// deriveChildPublic derives the BIP32 child of a compressed secp256k1 public
+// key, only possible for non-hardened indices.
+func deriveChildPublic(publicKey []byte, chainCode []byte, index uint32) ([]byte, []byte, error) {
+	if index >= HardenedKeyStart {
+		return nil, nil, errHardenedPublic
+	}
+	parent, err := crypto.DecompressPubkey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	il, childChainCode := hdMAC(chainCode, publicKey, index)
+	curve := crypto.S256()
+	if new(big.Int).SetBytes(il).Cmp(curve.Params().N) >= 0 {
+		return nil, nil, errInvalidChildKey
+	}
+	x, y := curve.ScalarBaseMult(il)
+	x, y = curve.Add(x, y, parent.X, parent.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, nil, errInvalidChildKey
+	}
+	return crypto.CompressPubkey(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}), childChainCode, nil
+}
+
+// deriveChildEd25519 derives the SLIP-10 child of an Ed25519 key.
+func deriveChildEd25519(key ed25519.PrivateKey, chainCode []byte, index uint32) (ed25519.PrivateKey, []byte, error) {
+	if index < HardenedKeyStart {
+		return nil, nil, errHardenedOnly
+	}
+	seed, childChainCode := hdMAC(chainCode, append([]byte{0x00}, key.Seed()...), index)
+	defer clear(seed)
+	return ed25519.NewKeyFromSeed(seed), childChainCode, nil
+}
+
+// deriveChildAES derives the child of an AES key with HKDF-SHA256.
+func deriveChildAES(key []byte, index uint32) ([]byte, error) {
+	info := binary.BigEndian.AppendUint32([]byte("sgx-aes-derive"), index)
+	child := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, info), child); err != nil {
+		return nil, fmt.Errorf("failed to derive AES key: %w", err)
+	}
+	return child, nil
+}
+
+// serializeExtendedPublicKey serializes a BIP32 extended public key.
+func serializeExtendedPublicKey(depth uint8, parentFingerprint, childNumber uint32, chainCode, publicKey []byte) []byte {
+	xpub := make([]byte, 0, ExtendedPublicKeyLength)
+	xpub = append(xpub, xpubVersion...)
+	xpub = append(xpub, depth)
+	xpub = binary.BigEndian.AppendUint32(xpub, parentFingerprint)
+	xpub = binary.BigEndian.AppendUint32(xpub, childNumber)
+	xpub = append(xpub, chainCode...)
+	return append(xpub, publicKey...)
+}
+
+// DeriveExtendedPublicKey derives the extended public key of a descendant
+// from a serialized extended public key along a non-hardened path.
+func DeriveExtendedPublicKey(xpub []byte, path []byte) ([]byte, error) {
+	if len(xpub) != ExtendedPublicKeyLength || string(xpub[:4]) != string(xpubVersion) {
+		return nil, errors.New("invalid extended public key")
+	}
+	indices, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	depth := int(xpub[4]) + len(indices)
+	if depth > 255 {
+		return nil, fmt.Errorf("%w: depth %d", errInvalidPath, depth)
+	}
+	var (
+		chainCode   = xpub[13:45]
+		publicKey   = xpub[45:]
+		fingerprint uint32
+	)
+	for _, index := range indices {
+		fingerprint = keyFingerprint(publicKey)
+		if publicKey, chainCode, err = deriveChildPublic(publicKey, chainCode, index); err != nil {
+			return nil, err
+		}
+	}
+	return serializeExtendedPublicKey(uint8(depth), fingerprint, indices[len(indices)-1], chainCode, publicKey), nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// hdTestMaster returns the master key and chain code of a seed as in BIP32 and SLIP-10.
+func hdTestMaster(curve string, seed []byte) ([]byte, []byte) {
+	mac := hmac.New(sha512.New, []byte(curve))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
+
+// Tests BIP32 derivation against test vector 1 of the specification.
+func TestDeriveChildECDSA(t *testing.T) {
+	master, chainCode := hdTestMaster("Bitcoin seed", hexutil.MustDecode("0x000102030405060708090a0b0c0d0e0f"))
+	key, _ := crypto.ToECDSA(master)
+	if pub := hexutil.Encode(crypto.CompressPubkey(&key.PublicKey)); pub != "0x0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2" {
+		t.Fatalf("master public key %s", pub)
+	}
+	for _, step := range []struct {
+		index     uint32
+		chainCode string
+		private   string
+		public    string
+	}{
+		{HardenedKeyStart, "0x47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", "0xedb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", "0x035a784662a4a20a65bf6aab9ae98a6c068a81c52e4b032c0fb5400c706cfccc56"},
+		{1, "0x2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19", "0x3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", "0x03501e454bf00751f24b1b489aa925215d66af2234e3891c3b21a52bedb3cd711c"},
+	} {
+		parentPub, parentChainCode := crypto.CompressPubkey(&key.PublicKey), chainCode
+		var err error
+		if key, chainCode, err = deriveChildECDSA(key, chainCode, step.index); err != nil {
+			t.Fatal(err)
+		}
+		if got := hexutil.Encode(chainCode); got != step.chainCode {
+			t.Errorf("index %#x: chain code %s, want %s", step.index, got, step.chainCode)
+		}
+		if got := hexutil.Encode(crypto.FromECDSA(key)); got != step.private {
+			t.Errorf("index %#x: private key %s, want %s", step.index, got, step.private)
+		}
+		if got := hexutil.Encode(crypto.CompressPubkey(&key.PublicKey)); got != step.public {
+			t.Errorf("index %#x: public key %s, want %s", step.index, got, step.public)
+		}
+		// Non-hardened children derive from the public key as well
+		pub, pubChainCode, err := deriveChildPublic(parentPub, parentChainCode, step.index)
+		switch {
+		case step.index >= HardenedKeyStart && !errors.Is(err, errHardenedPublic):
+			t.Errorf("index %#x: hardened public derivation: %v", step.index, err)
+		case step.index < HardenedKeyStart && (hexutil.Encode(pub) != step.public || !bytes.Equal(pubChainCode, chainCode)):
+			t.Errorf("index %#x: public derivation differs: %x (err %v)", step.index, pub, err)
+		}
+	}
+}
+
+// Tests SLIP-10 Ed25519 derivation against test vector 1 of the specification.
+func TestDeriveChildEd25519(t *testing.T) {
+	master, chainCode := hdTestMaster("ed25519 seed", hexutil.MustDecode("0x000102030405060708090a0b0c0d0e0f"))
+	key := ed25519.NewKeyFromSeed(master)
+
+	child, childChainCode, err := deriveChildEd25519(key, chainCode, HardenedKeyStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hexutil.Encode(childChainCode); got != "0x8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69" {
+		t.Errorf("chain code %s", got)
+	}
+	if got := hexutil.Encode(child.Seed()); got != "0x68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3" {
+		t.Errorf("private key %s", got)
+	}
+	if got := hexutil.Encode(child.Public().(ed25519.PublicKey)); got != "0x8c8a13df77a28f3445213a0f432fde644acaa215fc72dcdf300d5efaa85d350c" {
+		t.Errorf("public key %s", got)
+	}
+	if _, _, err := deriveChildEd25519(key, chainCode, 0); !errors.Is(err, errHardenedOnly) {
+		t.Errorf("non-hardened Ed25519 derivation: %v", err)
+	}
+}
+
+func TestParseDerivationPath(t *testing.T) {
+	path := EncodeDerivationPath(HardenedKeyStart+44, HardenedKeyStart+60, 0, 7)
+	indices, err := ParseDerivationPath(path)
+	if err != nil || len(indices) != 4 || indices[0] != HardenedKeyStart+44 || indices[3] != 7 {
+		t.Errorf("parsed path %v (err %v)", indices, err)
+	}
+	for _, invalid := range [][]byte{nil, {0x00, 0x01}, make([]byte, 4*(MaxDerivationPathLength+1))} {
+		if _, err := ParseDerivationPath(invalid); !errors.Is(err, errInvalidPath) {
+			t.Errorf("path %x: expected errInvalidPath, got %v", invalid, err)
+		}
+	}
+}
+
+// Tests that children of enclave keys can be derived from their extended
+// public key without the enclave.
+func TestSGXExtendedPublicKey(t *testing.T) {
+	var (
+		keys  = newSGXTestKeyStore(t)
+		owner = common.Address{0x01}
+	)
+	root, err := keys.CreateKeyDeterministic(owner, KeyTypeECDSA, common.Big1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hardened, err := keys.DeriveKey(root, EncodeDerivationPath(HardenedKeyStart+44, HardenedKeyStart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := keys.GetExtendedPublicKey(hardened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xpub) != ExtendedPublicKeyLength || xpub[4] != 2 || binary.BigEndian.Uint32(xpub[9:13]) != HardenedKeyStart {
+		t.Fatalf("extended public key %x", xpub)
+	}
+	path := EncodeDerivationPath(0, 5)
+	child, err := keys.DeriveKey(hardened, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The wallet derives the same child as the enclave
+	childXpub, err := DeriveExtendedPublicKey(xpub, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enclaveXpub, _ := keys.GetExtendedPublicKey(child)
+	if !bytes.Equal(childXpub, enclaveXpub) {
+		t.Fatalf("extended public keys differ:\n%x\n%x", childXpub, enclaveXpub)
+	}
+	pub, _ := keys.GetPublicKey(child)
+	walletPub, _ := crypto.DecompressPubkey(childXpub[45:])
+	if !bytes.Equal(pub, crypto.FromECDSAPub(walletPub)) {
+		t.Error("public keys differ")
+	}
+	if metadata, _ := keys.GetMetadata(child); metadata.Owner != owner || metadata.Depth != 4 || metadata.ChildNumber != 5 {
+		t.Errorf("child metadata %+v", metadata)
+	}
+	// Derivation is deterministic and hardened children stay private
+	if again, _ := keys.DeriveKey(hardened, path); again != child {
+		t.Error("derivation is not deterministic")
+	}
+	if _, err := DeriveExtendedPublicKey(xpub, EncodeDerivationPath(HardenedKeyStart)); !errors.Is(err, errHardenedPublic) {
+		t.Errorf("hardened public derivation: %v", err)
+	}
+}
+
+func TestSGXDeriveKeyTypes(t *testing.T) {
+	keys := newSGXTestKeyStore(t)
+	owner := common.Address{0x01}
+
+	edKey, _ := keys.CreateKeyDeterministic(owner, KeyTypeEd25519, common.Big1, 0)
+	if _, err := keys.DeriveKey(edKey, EncodeDerivationPath(1)); !errors.Is(err, errHardenedOnly) {
+		t.Errorf("non-hardened Ed25519 derivation: %v", err)
+	}
+	edChild, err := keys.DeriveKey(edKey, EncodeDerivationPath(HardenedKeyStart+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.GetExtendedPublicKey(edChild); err == nil {
+		t.Error("extended public key for an Ed25519 key")
+	}
+
+	aesKey, _ := keys.CreateKeyDeterministic(owner, KeyTypeAES256, common.Big1, 1)
+	first, err := keys.DeriveKey(aesKey, EncodeDerivationPath(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := keys.DeriveKey(aesKey, EncodeDerivationPath(2))
+	nested, _ := keys.DeriveKey(first, EncodeDerivationPath(2))
+	direct, _ := keys.DeriveKey(aesKey, EncodeDerivationPath(1, 2))
+	if first == second || nested != direct {
+		t.Errorf("AES derivation: first %x, second %x, nested %x, direct %x", first, second, nested, direct)
+	}
+}
+
+// Tests that the precompile returns the extended public key on request.
+func TestSGXKeyGetExtendedPublic(t *testing.T) {
+	keys := newSGXTestKeyStore(t)
+	keyID, _ := keys.CreateKeyDeterministic(common.Address{0x01}, KeyTypeECDSA, common.Big1, 0)
+	ctx := &SGXContext{KeyStore: keys}
+
+	xpub, err := new(SGXKeyGetPublic).RunWithContext(ctx, append(keyID.Bytes(), 0x01))
+	if err != nil || len(xpub) != ExtendedPublicKeyLength {
+		t.Fatalf("extended public key %x (err %v)", xpub, err)
+	}
+	pub, _ := new(SGXKeyGetPublic).RunWithContext(ctx, keyID.Bytes())
+	key, _ := crypto.UnmarshalPubkey(pub)
+	if !bytes.Equal(xpub[45:], crypto.CompressPubkey(key)) {
+		t.Error("extended public key does not contain the public key")
+	}
+}
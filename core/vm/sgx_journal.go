@@ -0,0 +1,319 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// errKeyNotFound is returned for keys deleted in a call frame that has not
+// been committed yet.
+var errKeyNotFound = errors.New("key not found")
+
+// ErrKeyRollback is returned for keys whose stored version is older than the
+// version anchored in the state, after the host restored an old copy of the
+// key store.
+var ErrKeyRollback = errors.New("sgx key store rolled back")
+
+// Every change of a key (creation, ownership transfer, deletion) increments
+// its version in the storage of sgxKeyNonceAddress:
+//
+//	keccak256("sgx-key-version" ++ keyID)    version
+//
+// The key store records the same version in the sealed metadata of the key.
+// Since the version only depends on the executed transactions, it is the same
+// on all nodes and is part of consensus.
+var keyVersionDomain = []byte("sgx-key-version")
+
+func keyVersionSlot(keyID common.Hash) common.Hash {
+	return crypto.Keccak256Hash(keyVersionDomain, keyID.Bytes())
+}
+
+// anchoredKeyVersion returns the version of the key anchored in the state.
+func anchoredKeyVersion(db StateDB, keyID common.Hash) uint64 {
+	return db.GetState(sgxKeyNonceAddress, keyVersionSlot(keyID)).Big().Uint64()
+}
+
+// keyVersioner is implemented by key stores recording key versions.
+type keyVersioner interface {
+	SetKeyVersion(keyID common.Hash, version uint64) error
+}
+
+// sgxJournal records the key store changes made by the SGX precompiles during
+// a transaction, so that a reverted call frame undoes them together with its
+// state changes. Key permissions are part of the state and need no journal.
+//
+// Created keys and ownership transfers are applied to the key store right
+// away and undone on revert. Deleted keys only become unavailable to the
+// precompiles and are removed from the key store once the transaction
+// commits, as their key material cannot be restored.
+type sgxJournal struct {
+	keys KeyStore
+	db   StateDB // State anchoring the key versions, nil before the key version fork
+
+	undo    []func()                       // undo functions, in order of the changes
+	deleted map[common.Hash]common.Address // keys deleted in this transaction -> caller
+}
+
+func newSGXJournal(keys KeyStore, db StateDB) *sgxJournal {
+	return &sgxJournal{
+		keys:    keys,
+		db:      db,
+		deleted: make(map[common.Hash]common.Address),
+	}
+}
+
+// snapshot returns an identifier for the current revision of the journal.
+func (j *sgxJournal) snapshot() int {
+	if j == nil {
+		return 0
+	}
+	return len(j.undo)
+}
+
+// revertToSnapshot undoes all changes made since the given revision.
+func (j *sgxJournal) revertToSnapshot(revid int) {
+	if j == nil {
+		return
+	}
+	for i := len(j.undo) - 1; i >= revid; i-- {
+		j.undo[i]()
+	}
+	j.undo = j.undo[:revid]
+}
+
+// commit finalises the changes of the transaction, removing the deleted keys
+// from the key store.
+func (j *sgxJournal) commit() {
+	if j == nil {
+		return
+	}
+	for keyID, caller := range j.deleted {
+		if err := j.keys.DeleteKey(keyID, caller); err != nil {
+			log.Warn("Failed to delete SGX key", "key", keyID, "err", err)
+		}
+	}
+	clear(j.deleted)
+	j.undo = j.undo[:0]
+}
+
+// keyStore returns the key store view of the precompiles.
+func (j *sgxJournal) keyStore() KeyStore { return (*journaledKeyStore)(j) }
+
+// journaledKeyStore is a KeyStore recording its changes in the journal.
+type journaledKeyStore sgxJournal
+
+func (ks *journaledKeyStore) exists(keyID common.Hash) error {
+	if _, ok := ks.deleted[keyID]; ok {
+		return fmt.Errorf("%w: %x", errKeyNotFound, keyID)
+	}
+	if ks.db == nil {
+		return nil
+	}
+	anchored := anchoredKeyVersion(ks.db, keyID)
+	if anchored == 0 {
+		return nil // threshold key or unchanged since the fork
+	}
+	metadata, err := ks.keys.GetMetadata(keyID)
+	if err != nil {
+		return err
+	}
+	if metadata.Version < anchored {
+		return fmt.Errorf("%w: key %x at version %d, want %d", ErrKeyRollback, keyID, metadata.Version, anchored)
+	}
+	return nil
+}
+
+// bumpVersion increments the version of a changed key in the state and
+// returns it.
+func (ks *journaledKeyStore) bumpVersion(keyID common.Hash) uint64 {
+	version := anchoredKeyVersion(ks.db, keyID) + 1
+	touchSGXAccount(ks.db, sgxKeyNonceAddress)
+	ks.db.SetState(sgxKeyNonceAddress, keyVersionSlot(keyID), common.BigToHash(new(big.Int).SetUint64(version)))
+	return version
+}
+
+// setVersion records the version of a key in the key store.
+func (ks *journaledKeyStore) setVersion(keyID common.Hash, version uint64) {
+	if versioner, ok := ks.keys.(keyVersioner); ok {
+		if err := versioner.SetKeyVersion(keyID, version); err != nil {
+			log.Warn("Failed to set SGX key version", "key", keyID, "err", err)
+		}
+	}
+}
+
+// created records the undo of a key created by the key store.
+func (ks *journaledKeyStore) created(keyID common.Hash) {
+	metadata, err := ks.keys.GetMetadata(keyID)
+	if err != nil {
+		return
+	}
+	if ks.db != nil {
+		ks.setVersion(keyID, ks.bumpVersion(keyID))
+	}
+	ks.undo = append(ks.undo, func() {
+		if err := ks.keys.DeleteKey(keyID, metadata.Owner); err != nil {
+			log.Warn("Failed to undo SGX key creation", "key", keyID, "err", err)
+		}
+	})
+}
+
+func (ks *journaledKeyStore) CreateKey(owner common.Address, keyType KeyType) (common.Hash, error) {
+	keyID, err := ks.keys.CreateKey(owner, keyType)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ks.created(keyID)
+	return keyID, nil
+}
+
+func (ks *journaledKeyStore) CreateKeyDeterministic(owner common.Address, keyType KeyType, chainID *big.Int, nonce uint64) (common.Hash, error) {
+	keyID, err := ks.keys.CreateKeyDeterministic(owner, keyType, chainID, nonce)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ks.created(keyID)
+	return keyID, nil
+}
+
+func (ks *journaledKeyStore) GetPublicKey(keyID common.Hash) ([]byte, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.GetPublicKey(keyID)
+}
+
+func (ks *journaledKeyStore) Sign(keyID common.Hash, hash []byte) ([]byte, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.Sign(keyID, hash)
+}
+
+func (ks *journaledKeyStore) ECDH(keyID common.Hash, peerPubKey []byte, kdfParams []byte) (common.Hash, error) {
+	if err := ks.exists(keyID); err != nil {
+		return common.Hash{}, err
+	}
+	newKeyID, err := ks.keys.ECDH(keyID, peerPubKey, kdfParams)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ks.created(newKeyID)
+	return newKeyID, nil
+}
+
+func (ks *journaledKeyStore) GetECDHPublicKey(keyID common.Hash) ([]byte, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.GetECDHPublicKey(keyID)
+}
+
+func (ks *journaledKeyStore) Encrypt(keyID common.Hash, plaintext []byte) ([]byte, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.Encrypt(keyID, plaintext)
+}
+
+func (ks *journaledKeyStore) Decrypt(keyID common.Hash, ciphertext []byte) ([]byte, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.Decrypt(keyID, ciphertext)
+}
+
+func (ks *journaledKeyStore) DeriveKey(keyID common.Hash, path []byte) (common.Hash, error) {
+	if err := ks.exists(keyID); err != nil {
+		return common.Hash{}, err
+	}
+	childKeyID, err := ks.keys.DeriveKey(keyID, path)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	ks.created(childKeyID)
+	return childKeyID, nil
+}
+
+func (ks *journaledKeyStore) GetExtendedPublicKey(keyID common.Hash) ([]byte, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.GetExtendedPublicKey(keyID)
+}
+
+// DealerAddress returns the dealer address of the underlying key store.
+func (ks *journaledKeyStore) DealerAddress(chainID *big.Int) (common.Address, error) {
+	dealer, ok := ks.keys.(ThresholdDealer)
+	if !ok {
+		return common.Address{}, errors.New("key store has no threshold key dealer")
+	}
+	return dealer.DealerAddress(chainID)
+}
+
+func (ks *journaledKeyStore) GetMetadata(keyID common.Hash) (*KeyMetadata, error) {
+	if err := ks.exists(keyID); err != nil {
+		return nil, err
+	}
+	return ks.keys.GetMetadata(keyID)
+}
+
+// DeleteKey checks ownership like the key store but defers the deletion
+// until the transaction commits.
+func (ks *journaledKeyStore) DeleteKey(keyID common.Hash, caller common.Address) error {
+	metadata, err := ks.GetMetadata(keyID)
+	if err != nil {
+		return fmt.Errorf("failed to load metadata: %w", err)
+	}
+	if metadata.Owner != caller {
+		return errors.New("permission denied: only key owner can delete key")
+	}
+	if ks.db != nil {
+		ks.bumpVersion(keyID) // restored copies of the key are older
+	}
+	ks.deleted[keyID] = caller
+	ks.undo = append(ks.undo, func() { delete(ks.deleted, keyID) })
+	return nil
+}
+
+func (ks *journaledKeyStore) TransferOwnership(keyID common.Hash, newOwner common.Address) error {
+	metadata, err := ks.GetMetadata(keyID)
+	if err != nil {
+		return err
+	}
+	if err := ks.keys.TransferOwnership(keyID, newOwner); err != nil {
+		return err
+	}
+	if ks.db != nil {
+		ks.setVersion(keyID, ks.bumpVersion(keyID))
+	}
+	ks.undo = append(ks.undo, func() {
+		if err := ks.keys.TransferOwnership(keyID, metadata.Owner); err != nil {
+			log.Warn("Failed to undo SGX key ownership transfer", "key", keyID, "err", err)
+		}
+		if ks.db != nil {
+			ks.setVersion(keyID, metadata.Version)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,330 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+var (
+	sgxKeyCreateAddr = common.BytesToAddress([]byte{0x80, 0x00})
+	sgxKeyDeleteAddr = common.BytesToAddress([]byte{0x80, 0x09})
+)
+
+// newSGXTestEVM returns an EVM with the SGX precompiles active and the given
+// key store, along with a contract that calls precompile with input and then
+// ends with the given opcode (RETURN or REVERT), passing on the output.
+func newSGXTestEVM(t *testing.T, keys KeyStore, precompile common.Address, input []byte, end OpCode) (*EVM, common.Address) {
+	config := *params.MergedTestChainConfig
+	config.SGX = &params.SGXConfig{}
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	vmctx := BlockContext{
+		CanTransfer: func(StateDB, common.Address, *uint256.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *uint256.Int) {},
+		BlockNumber: big.NewInt(1),
+		Random:      &common.Hash{},
+	}
+	vmconfig := Config{}
+	if keys != nil {
+		vmconfig.SGXKeyStore = keys
+	}
+	// Store input at memory 0, call the precompile writing 32 bytes of output
+	// at 0x100, and return or revert with them.
+	var code []byte
+	for i, b := range input {
+		code = append(code, byte(PUSH1), b, byte(PUSH2), byte(i>>8), byte(i), byte(MSTORE8))
+	}
+	code = append(code,
+		byte(PUSH1), 0x20, byte(PUSH2), 0x01, 0x00, // retSize, retOffset
+		byte(PUSH1), byte(len(input)), byte(PUSH1), 0x00, // argsSize, argsOffset
+		byte(PUSH1), 0x00, byte(PUSH2), precompile[18], precompile[19], byte(GAS), byte(CALL),
+		byte(POP),
+		byte(PUSH1), 0x20, byte(PUSH2), 0x01, 0x00, byte(end),
+	)
+	contract := common.BytesToAddress([]byte("contract"))
+	statedb.CreateAccount(contract)
+	statedb.SetCode(contract, code, tracing.CodeChangeUnspecified)
+
+	return NewEVM(vmctx, statedb, &config, vmconfig), contract
+}
+
+func newSGXTestKeyStore(t *testing.T) *EncryptedKeyStore {
+	dir := t.TempDir()
+	keys, err := NewEncryptedKeyStore(filepath.Join(dir, "encrypted"), filepath.Join(dir, "public"), FileSealingKey{Path: filepath.Join(dir, "sealing.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.SetMasterSecret(make([]byte, MasterSecretLength)); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// Tests that the EVM runs the SGX precompiles with the calling contract as
+// caller, and that keys created in a reverted frame are removed again.
+func TestSGXPrecompileCall(t *testing.T) {
+	for _, end := range []OpCode{RETURN, REVERT} {
+		keys := newSGXTestKeyStore(t)
+		evm, contract := newSGXTestEVM(t, keys, sgxKeyCreateAddr, []byte{byte(KeyTypeECDSA)}, end)
+
+		ret, _, err := evm.Call(common.Address{0x01}, contract, nil, 1_000_000, new(uint256.Int))
+		if end == REVERT && !errors.Is(err, ErrExecutionReverted) || end == RETURN && err != nil {
+			t.Fatalf("%v: unexpected error %v", end, err)
+		}
+		keyID := common.BytesToHash(ret)
+		metadata, err := keys.GetMetadata(keyID)
+		switch end {
+		case RETURN:
+			if err != nil {
+				t.Fatalf("created key missing: %v", err)
+			}
+			if metadata.Owner != contract {
+				t.Errorf("key owner: got %v, want %v", metadata.Owner, contract)
+			}
+		case REVERT:
+			if err == nil {
+				t.Errorf("key created in reverted frame still exists")
+			}
+		}
+	}
+}
+
+// Tests that keys deleted in a reverted frame remain, and keys deleted in a
+// committed transaction are removed from the key store.
+func TestSGXPrecompileDeleteRevert(t *testing.T) {
+	for _, end := range []OpCode{RETURN, REVERT} {
+		keys := newSGXTestKeyStore(t)
+		contract := common.BytesToAddress([]byte("contract"))
+		keyID, err := keys.CreateKey(contract, KeyTypeAES256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evm, _ := newSGXTestEVM(t, keys, sgxKeyDeleteAddr, keyID.Bytes(), end)
+
+		if _, _, err := evm.Call(common.Address{0x01}, contract, nil, 1_000_000, new(uint256.Int)); end == RETURN && err != nil {
+			t.Fatal(err)
+		}
+		_, err = keys.GetMetadata(keyID)
+		if end == RETURN && err == nil {
+			t.Error("deleted key still exists after commit")
+		}
+		if end == REVERT && err != nil {
+			t.Errorf("key deleted in reverted frame is gone: %v", err)
+		}
+	}
+}
+
+func TestSGXPrecompileStaticCall(t *testing.T) {
+	evm, _ := newSGXTestEVM(t, newSGXTestKeyStore(t), sgxKeyCreateAddr, nil, RETURN)
+	_, gas, err := evm.StaticCall(common.Address{0x01}, sgxKeyCreateAddr, []byte{byte(KeyTypeECDSA)}, math.MaxUint32)
+	if err == nil || gas != 0 {
+		t.Errorf("key created in static call: gas %d, err %v", gas, err)
+	}
+}
+
+// Tests that without a key store only the precompiles needing key material
+// fail.
+func TestSGXPrecompileNoKeyStore(t *testing.T) {
+	evm, _ := newSGXTestEVM(t, nil, sgxKeyCreateAddr, nil, RETURN)
+	if _, _, err := evm.Call(common.Address{0x01}, sgxKeyCreateAddr, []byte{byte(KeyTypeECDSA)}, 1_000_000, new(uint256.Int)); !errors.Is(err, ErrSGXKeyStoreUnavailable) {
+		t.Errorf("expected ErrSGXKeyStoreUnavailable, got %v", err)
+	}
+	evm.Context.SGXRandomness = common.Hash{0x01}
+	random := common.BytesToAddress([]byte{0x80, 0x05})
+	if ret, _, err := evm.Call(common.Address{0x01}, random, common.LeftPadBytes([]byte{32}, 32), 1_000_000, new(uint256.Int)); err != nil || len(ret) != 32 {
+		t.Errorf("random precompile without key store: output %x, err %v", ret, err)
+	}
+}
+
+// Tests that the key store changes of blocks stay in memory until the blocks
+// become canonical, and are reverted on disk when they are reorged out.
+func TestKeyStoreLayers(t *testing.T) {
+	var (
+		base   = newSGXTestKeyStore(t)
+		layers = newTestKeyStoreLayers(t, base, rawdb.NewMemoryDatabase())
+		owner  = common.Address{0x01}
+		parent = &types.Header{Number: big.NewInt(1)}
+		blockA = &types.Header{Number: big.NewInt(2), ParentHash: parent.Hash(), Extra: []byte("a")}
+		blockB = &types.Header{Number: big.NewInt(2), ParentHash: parent.Hash(), Extra: []byte("b")}
+	)
+	if err := layers.Commit(parent); err != nil {
+		t.Fatal(err)
+	}
+	// Speculative execution leaves the key store untouched
+	keyID, err := layers.Open(parent.Hash()).CreateKey(owner, KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.GetMetadata(keyID); err == nil {
+		t.Fatal("key of discarded execution written to disk")
+	}
+	// Block A creates a key, sibling block B does not
+	keysA := layers.Open(parent.Hash())
+	keyID, err = keysA.CreateKey(owner, KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers.Retain(blockA, keysA)
+	layers.Retain(blockB, layers.Open(parent.Hash()))
+
+	if _, err := base.GetMetadata(keyID); err == nil {
+		t.Fatal("key of retained block written to disk before commit")
+	}
+	if _, err := layers.Open(blockA.Hash()).GetMetadata(keyID); err != nil {
+		t.Fatalf("key missing on top of its block: %v", err)
+	}
+	if err := layers.Commit(blockA); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.GetMetadata(keyID); err != nil {
+		t.Fatalf("key of canonical block not written: %v", err)
+	}
+	if _, err := layers.Open(blockB.Hash()).GetMetadata(keyID); err == nil {
+		t.Fatal("key of block A visible on side chain B")
+	}
+	// Reorg to block B removes the key again
+	if err := layers.Commit(blockB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.GetMetadata(keyID); err == nil {
+		t.Fatal("key of reorged block still on disk")
+	}
+	if _, err := layers.Open(blockA.Hash()).GetMetadata(keyID); err != nil {
+		t.Fatalf("key missing on top of reorged block: %v", err)
+	}
+}
+
+// Tests that the key store rewinds with the chain after a restart, and that
+// blocks creating and deleting keys can be imported again on top of the
+// rewound key store.
+func TestKeyStoreLayersRewind(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		base    = newSGXTestKeyStore(t)
+		layers  = newTestKeyStoreLayers(t, base, db)
+		owner   = common.Address{0x01}
+		chainID = big.NewInt(1)
+		genesis = &types.Header{Number: big.NewInt(0)}
+		block1  = &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash()}
+		block2  = &types.Header{Number: big.NewInt(2), ParentHash: block1.Hash()}
+	)
+	for _, header := range []*types.Header{genesis, block1, block2} {
+		rawdb.WriteHeader(db, header)
+	}
+	// importBlocks executes block 1 creating a key and block 2 deleting it
+	importBlocks := func(layers *KeyStoreLayers) common.Hash {
+		keys := layers.Open(genesis.Hash())
+		keyID, err := keys.CreateKeyDeterministic(owner, KeyTypeECDSA, chainID, 0)
+		if err != nil {
+			t.Fatalf("failed to create key: %v", err)
+		}
+		layers.Retain(block1, keys)
+		if err := layers.Commit(block1); err != nil {
+			t.Fatal(err)
+		}
+		keys = layers.Open(block1.Hash())
+		if err := keys.DeleteKey(keyID, owner); err != nil {
+			t.Fatalf("failed to delete key: %v", err)
+		}
+		layers.Retain(block2, keys)
+		if err := layers.Commit(block2); err != nil {
+			t.Fatal(err)
+		}
+		return keyID
+	}
+	if err := layers.Commit(genesis); err != nil {
+		t.Fatal(err)
+	}
+	keyID := importBlocks(layers)
+	if _, err := base.GetMetadata(keyID); err == nil {
+		t.Fatal("deleted key still on disk")
+	}
+	// After a restart, the key store at block 1 is rebuilt from the journal
+	layers = newTestKeyStoreLayers(t, base, db)
+	if _, err := layers.Open(block1.Hash()).GetMetadata(keyID); err != nil {
+		t.Fatalf("key missing on top of block 1 after restart: %v", err)
+	}
+	if err := layers.Open(block1.Hash()).DeleteKey(keyID, owner); err != nil {
+		t.Fatalf("failed to delete key on top of block 1 after restart: %v", err)
+	}
+	// Rewinding the chain rewinds the key store
+	if err := layers.Commit(block1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.GetMetadata(keyID); err != nil {
+		t.Fatalf("key not restored on rewind to block 1: %v", err)
+	}
+	if err := layers.Commit(genesis); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.GetMetadata(keyID); err == nil {
+		t.Fatal("key still on disk after rewind to genesis")
+	}
+	// Re-importing the blocks after another restart gives the same result
+	layers = newTestKeyStoreLayers(t, base, db)
+	if id := importBlocks(layers); id != keyID {
+		t.Fatalf("re-imported key ID mismatch: got %x, want %x", id, keyID)
+	}
+	if _, err := base.GetMetadata(keyID); err == nil {
+		t.Fatal("deleted key on disk after re-import")
+	}
+}
+
+func newTestKeyStoreLayers(t *testing.T, base *EncryptedKeyStore, db ethdb.KeyValueStore) *KeyStoreLayers {
+	layers, err := NewKeyStoreLayers(base, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layers
+}
+
+// Tests that ownership transfers are undone on revert.
+func TestSGXJournalRevert(t *testing.T) {
+	var (
+		keys    = newSGXTestKeyStore(t)
+		journal = newSGXJournal(keys, nil)
+		owner   = common.Address{0x01}
+		other   = common.Address{0x02}
+	)
+	keyID, err := keys.CreateKey(owner, KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := journal.snapshot()
+	if err := journal.keyStore().TransferOwnership(keyID, other); err != nil {
+		t.Fatal(err)
+	}
+	journal.revertToSnapshot(snap)
+
+	if metadata, _ := keys.GetMetadata(keyID); metadata.Owner != owner {
+		t.Errorf("owner after revert: got %v, want %v", metadata.Owner, owner)
+	}
+}
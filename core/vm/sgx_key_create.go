@@ -19,10 +19,18 @@ package vm
 import (
 	"errors"
 	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXKeyCreate is the precompiled contract for key creation (0x8000)
-type SGXKeyCreate struct{}
+type SGXKeyCreate struct {
+	repriced bool // Gas schedule of the SGX gas fork
+	tagged    bool // Key types of the SGX key types fork
+	threshold bool // Threshold keys of the SGX threshold keys fork
+}
 
 // Name returns the name of the contract
 func (c *SGXKeyCreate) Name() string {
@@ -30,9 +38,15 @@ func (c *SGXKeyCreate) Name() string {
 }
 
 // RequiredGas calculates the required gas
-// Input format: keyType (1 byte)
+// Input format: keyType (1 byte) [+ threshold parameters + dealer signature]
 func (c *SGXKeyCreate) RequiredGas(input []byte) uint64 {
-	return 50000
+	if !c.repriced {
+		return 50000
+	}
+	if c.threshold && len(input) > 1 && KeyType(input[0]) == KeyTypeThreshold {
+		return params.SGXThresholdKeyCreateGas + uint64(input[1])*params.SGXThresholdCommitmentGas + params.EcrecoverGas
+	}
+	return params.SGXKeyCreateGas
 }
 
 // Run executes the contract (requires context)
@@ -41,28 +55,90 @@ func (c *SGXKeyCreate) Run(input []byte) ([]byte, error) {
 }
 
 // RunWithContext executes the contract with SGX context
-// Input format: keyType (1 byte)
+// Input format: keyType (1 byte), P-256 keys from the SGX key types fork on
+// Threshold keys, from the SGX threshold keys fork on: keyType (1 byte) +
+// threshold (1 byte) + commitments (33 bytes each) + dealer signature (65 bytes)
 // Output format: keyID (32 bytes)
 func (c *SGXKeyCreate) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
-	// 1. Parse input
+	// 1. Check if in read-only mode
+	if ctx.IsReadOnly {
+		return nil, errors.New("cannot create key in read-only mode")
+	}
+	
+	// 2. Parse input
 	if len(input) < 1 {
 		return nil, errors.New("invalid input: missing key type")
 	}
 	keyType := KeyType(input[0])
 	
-	// 2. Validate key type
-	if keyType != KeyTypeECDSA && keyType != KeyTypeEd25519 && keyType != KeyTypeAES256 {
+	// 3. Validate key type
+	if keyType != KeyTypeECDSA && keyType != KeyTypeEd25519 && keyType != KeyTypeAES256 && (keyType != KeyTypeThreshold || !c.threshold) && (keyType != KeyTypeP256 || !c.tagged) {
 		return nil, fmt.Errorf("unsupported key type: %d", keyType)
 	}
 	
-	// 3. Create key
-	keyID, err := ctx.KeyStore.CreateKey(ctx.Caller, keyType)
+	// 4. Create key. Threshold keys are dealt off-chain and only registered here.
+	if keyType == KeyTypeThreshold {
+		return c.registerThreshold(ctx, input[1:])
+	}
+	// Other keys are created in the key store. Within the EVM the key is
+	// derived from the network master secret and the caller's key nonce, so
+	// that every node creates the same key.
+	var (
+		keyID common.Hash
+		err   error
+	)
+	if ctx.StateDB != nil {
+		nonce := sgxKeyNonce(ctx.StateDB, ctx.Caller)
+		keyID, err = ctx.KeyStore.CreateKeyDeterministic(ctx.Caller, keyType, ctx.ChainID, nonce)
+		if err == nil {
+			setSGXKeyNonce(ctx.StateDB, ctx.Caller, nonce+1)
+		}
+	} else {
+		keyID, err = ctx.KeyStore.CreateKey(ctx.Caller, keyType)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create key: %w", err)
 	}
 	
-	// 4. Automatically grant Admin permission to the owner
-	err = ctx.PermissionManager.GrantPermission(keyID, Permission{
+	// 5. Automatically grant Admin permission to the owner
+	return c.grantOwner(ctx, keyID)
+}
+
+// registerThreshold records the parameters of a threshold key in the state,
+// the key ID is the hash of the compressed group key. The parameters must be
+// signed for the caller by the dealer key of the network, which only attested
+// enclaves dealing the key hold.
+func (c *SGXKeyCreate) registerThreshold(ctx *SGXContext, input []byte) ([]byte, error) {
+	if ctx.StateDB == nil {
+		return nil, errors.New("threshold keys require state")
+	}
+	if len(input) < crypto.SignatureLength {
+		return nil, errors.New("invalid input: missing dealer signature")
+	}
+	input, signature := input[:len(input)-crypto.SignatureLength], input[len(input)-crypto.SignatureLength:]
+	params, err := decodeThresholdParams(input)
+	if err != nil {
+		return nil, err
+	}
+	dealer, ok := ctx.KeyStore.(ThresholdDealer)
+	if !ok {
+		return nil, errors.New("key store cannot verify threshold key dealers")
+	}
+	if err := verifyThresholdDealer(dealer, ctx.ChainID, ctx.Caller, params, signature); err != nil {
+		return nil, err
+	}
+	keyID := params.KeyID()
+	if _, _, exists := thresholdKey(ctx.StateDB, keyID); exists {
+		return nil, fmt.Errorf("threshold key %s already registered", keyID.Hex())
+	}
+	registerThresholdKey(ctx.StateDB, ctx.Caller, params)
+	return c.grantOwner(ctx, keyID)
+}
+
+// grantOwner grants the Admin permission of a new key to its owner and
+// returns the key ID.
+func (c *SGXKeyCreate) grantOwner(ctx *SGXContext, keyID common.Hash) ([]byte, error) {
+	err := ctx.PermissionManager.GrantPermission(keyID, Permission{
 		Grantee:   ctx.Caller,
 		Type:      PermissionAdmin,
 		ExpiresAt: 0,
@@ -73,6 +149,5 @@ func (c *SGXKeyCreate) RunWithContext(ctx *SGXContext, input []byte) ([]byte, er
 		return nil, fmt.Errorf("failed to grant admin permission: %w", err)
 	}
 	
-	// 5. Return key ID
 	return keyID.Bytes(), nil
 }
@@ -20,10 +20,13 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXKeyDelete is the precompiled contract for deleting keys (0x8009)
-type SGXKeyDelete struct{}
+type SGXKeyDelete struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
 
 // Name returns the name of the contract
 func (c *SGXKeyDelete) Name() string {
@@ -33,6 +36,9 @@ func (c *SGXKeyDelete) Name() string {
 // RequiredGas calculates the required gas
 // Input format: keyID (32 bytes)
 func (c *SGXKeyDelete) RequiredGas(input []byte) uint64 {
+	if c.repriced {
+		return params.SGXKeyDeleteGas
+	}
 	return 5000
 }
 
@@ -45,17 +51,22 @@ func (c *SGXKeyDelete) Run(input []byte) ([]byte, error) {
 // Input format: keyID (32 bytes)
 // Output format: success (1 byte: 0x01 for success)
 func (c *SGXKeyDelete) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
-	// 1. Parse input
+	// 1. Check if in read-only mode
+	if ctx.IsReadOnly {
+		return nil, errors.New("cannot delete key in read-only mode")
+	}
+	
+	// 2. Parse input
 	if len(input) != 32 {
 		return nil, errors.New("invalid input: expected keyID (32 bytes)")
 	}
 	keyID := common.BytesToHash(input[:32])
 	
-	// 2. Delete the key (ownership check is done inside DeleteKey)
+	// 3. Delete the key (ownership check is done inside DeleteKey)
 	if err := ctx.KeyStore.DeleteKey(keyID, ctx.Caller); err != nil {
 		return nil, err
 	}
 	
-	// 3. Return success
+	// 4. Return success
 	return []byte{0x01}, nil
 }
@@ -0,0 +1,119 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Keys created by the SGX precompiles are derived inside the enclave from a
+// network-wide master secret, shared between attested nodes, and the public
+// inputs (chain ID, creator, key nonce, key type). Every node executing the
+// same transaction thus creates the same key ID and public key, while the
+// private material never leaves the enclaves.
+
+// MasterSecretLength is the length of the network master secret.
+const MasterSecretLength = 32
+
+// ErrNoMasterSecret is returned when creating a key before the network master
+// secret is available.
+var ErrNoMasterSecret = errors.New("sgx master secret unavailable")
+
+// sgxKeyNonceAddress is the account whose storage holds the key nonce of each
+// creator, the address of the key creation precompile.
+var sgxKeyNonceAddress = common.BytesToAddress([]byte{0x80, 0x00})
+
+// deriveKeySeed derives the 32 byte seed of a key from the master secret using
+// HKDF-SHA256, bound to the chain, the creator and its key nonce.
+func deriveKeySeed(masterSecret []byte, chainID *big.Int, creator common.Address, nonce uint64, keyType KeyType) ([]byte, error) {
+	if len(masterSecret) != MasterSecretLength {
+		return nil, ErrNoMasterSecret
+	}
+	if chainID == nil {
+		chainID = new(big.Int)
+	}
+	info := make([]byte, 0, 7+common.HashLength+common.AddressLength+9)
+	info = append(info, "sgx-key"...)
+	info = append(info, common.BigToHash(chainID).Bytes()...)
+	info = append(info, creator.Bytes()...)
+	info = binary.BigEndian.AppendUint64(info, nonce)
+	info = append(info, byte(keyType))
+
+	seed := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, masterSecret, nil, info), seed); err != nil {
+		return nil, fmt.Errorf("failed to derive key seed: %w", err)
+	}
+	return seed, nil
+}
+
+// keyFromSeed returns the private key and the public component of the key of
+// the given type generated from a 32 byte seed.
+func keyFromSeed(keyType KeyType, seed []byte) (interface{}, []byte, error) {
+	switch keyType {
+	case KeyTypeECDSA:
+		key, err := crypto.ToECDSA(seed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid ECDSA seed: %w", err)
+		}
+		return key, crypto.FromECDSAPub(&key.PublicKey), nil
+
+	case KeyTypeEd25519:
+		key := ed25519.NewKeyFromSeed(seed)
+		return key, []byte(key.Public().(ed25519.PublicKey)), nil
+
+	case KeyTypeP256:
+		key := p256KeyFromSeed(seed)
+		return key, p256PublicKey(&key.PublicKey), nil
+
+	case KeyTypeAES256:
+		key := common.CopyBytes(seed)
+		return key, key, nil // symmetric keys are their own public component
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported key type: %d", keyType)
+	}
+}
+
+// sgxKeyNonce returns the number of keys the creator has created.
+func sgxKeyNonce(db StateDB, creator common.Address) uint64 {
+	return db.GetState(sgxKeyNonceAddress, common.BytesToHash(creator.Bytes())).Big().Uint64()
+}
+
+// touchSGXAccount prepares a system account for storage writes. A non-zero
+// nonce keeps the account from being cleared as empty (EIP-161).
+func touchSGXAccount(db StateDB, addr common.Address) {
+	if db.GetNonce(addr) == 0 {
+		db.SetNonce(addr, 1, tracing.NonceChangeUnspecified)
+	}
+}
+
+// setSGXKeyNonce sets the number of keys the creator has created.
+func setSGXKeyNonce(db StateDB, creator common.Address, nonce uint64) {
+	touchSGXAccount(db, sgxKeyNonceAddress)
+	db.SetState(sgxKeyNonceAddress, common.BytesToHash(creator.Bytes()), common.BigToHash(new(big.Int).SetUint64(nonce)))
+}
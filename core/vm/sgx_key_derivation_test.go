@@ -0,0 +1,106 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+)
+
+// Tests that nodes sharing the master secret create the same keys when
+// executing the same calls, and that each call creates a new key.
+func TestSGXKeyCreateDeterministic(t *testing.T) {
+	var (
+		keysA = newSGXTestKeyStore(t)
+		keysB = newSGXTestKeyStore(t)
+		input = []byte{byte(KeyTypeECDSA)}
+	)
+	evmA, contract := newSGXTestEVM(t, keysA, sgxKeyCreateAddr, input, RETURN)
+	evmB, _ := newSGXTestEVM(t, keysB, sgxKeyCreateAddr, input, RETURN)
+
+	var ids []common.Hash
+	for i := 0; i < 2; i++ {
+		retA, _, err := evmA.Call(common.Address{0x01}, contract, nil, 1_000_000, new(uint256.Int))
+		if err != nil {
+			t.Fatal(err)
+		}
+		retB, _, err := evmB.Call(common.Address{0x01}, contract, nil, 1_000_000, new(uint256.Int))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(retA, retB) {
+			t.Fatalf("call %d: key IDs differ between nodes: %x != %x", i, retA, retB)
+		}
+		id := common.BytesToHash(retA)
+		pubA, _ := keysA.GetPublicKey(id)
+		pubB, _ := keysB.GetPublicKey(id)
+		if len(pubA) == 0 || !bytes.Equal(pubA, pubB) {
+			t.Fatalf("call %d: public keys differ between nodes", i)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] == ids[1] {
+		t.Error("repeated calls created the same key")
+	}
+	if nonce := sgxKeyNonce(evmA.StateDB, contract); nonce != 2 {
+		t.Errorf("key nonce: got %d, want 2", nonce)
+	}
+}
+
+// Tests that keys are bound to the master secret and the chain.
+func TestSGXKeyDerivationInputs(t *testing.T) {
+	var (
+		secret  = bytes.Repeat([]byte{0x01}, MasterSecretLength)
+		other   = bytes.Repeat([]byte{0x02}, MasterSecretLength)
+		creator = common.Address{0xaa}
+	)
+	seed, _ := deriveKeySeed(secret, common.Big1, creator, 0, KeyTypeEd25519)
+	for _, tt := range []struct {
+		name    string
+		secret  []byte
+		chainID *big.Int
+		creator common.Address
+		nonce   uint64
+		keyType KeyType
+	}{
+		{"master secret", other, common.Big1, creator, 0, KeyTypeEd25519},
+		{"chain ID", secret, common.Big2, creator, 0, KeyTypeEd25519},
+		{"creator", secret, common.Big1, common.Address{0xbb}, 0, KeyTypeEd25519},
+		{"nonce", secret, common.Big1, creator, 1, KeyTypeEd25519},
+		{"key type", secret, common.Big1, creator, 0, KeyTypeAES256},
+	} {
+		derived, err := deriveKeySeed(tt.secret, tt.chainID, tt.creator, tt.nonce, tt.keyType)
+		if err != nil || bytes.Equal(seed, derived) {
+			t.Errorf("%s does not change the key seed (err %v)", tt.name, err)
+		}
+	}
+	// Without the master secret no key can be derived
+	dir := t.TempDir()
+	keys, err := NewEncryptedKeyStore(filepath.Join(dir, "encrypted"), filepath.Join(dir, "public"), FileSealingKey{Path: filepath.Join(dir, "sealing.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.CreateKeyDeterministic(creator, KeyTypeECDSA, common.Big1, 0); !errors.Is(err, ErrNoMasterSecret) {
+		t.Errorf("expected ErrNoMasterSecret, got %v", err)
+	}
+}
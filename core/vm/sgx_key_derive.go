@@ -20,10 +20,13 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXKeyDerive is the precompiled contract for key derivation (0x8008)
-type SGXKeyDerive struct{}
+type SGXKeyDerive struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
 
 // Name returns the name of the contract
 func (c *SGXKeyDerive) Name() string {
@@ -31,9 +34,17 @@ func (c *SGXKeyDerive) Name() string {
 }
 
 // RequiredGas calculates the required gas
-// Input format: parentKeyID (32 bytes) + derivationPath (variable)
+// Input format: parentKeyID (32 bytes) + derivationPath (4 bytes per index,
+// see ParseDerivationPath)
 func (c *SGXKeyDerive) RequiredGas(input []byte) uint64 {
-	return 10000
+	if !c.repriced {
+		return 10000
+	}
+	elements := uint64(1)
+	if len(input) > 36 {
+		elements = uint64(len(input)-32) / 4
+	}
+	return params.SGXKeyDeriveGas + elements*params.SGXKeyDerivePathElementGas
 }
 
 // Run executes the contract (requires context)
@@ -42,7 +53,8 @@ func (c *SGXKeyDerive) Run(input []byte) ([]byte, error) {
 }
 
 // RunWithContext executes the contract with SGX context
-// Input format: parentKeyID (32 bytes) + derivationPath (variable)
+// Input format: parentKeyID (32 bytes) + derivationPath (4 bytes per index,
+// see ParseDerivationPath)
 // Output format: childKeyID (32 bytes)
 func (c *SGXKeyDerive) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
 	// 1. Check if in read-only mode
@@ -63,9 +75,9 @@ func (c *SGXKeyDerive) RunWithContext(ctx *SGXContext, input []byte) ([]byte, er
 		return nil, err
 	}
 	
-	// SECURITY: Only owner can derive keys
-	if metadata.Owner != ctx.Caller {
-		return nil, errors.New("permission denied: only key owner can derive child keys")
+	// SECURITY: Only the owner or a grantee with derivation permission can derive keys
+	if !authorizeKeyUse(ctx, metadata, PermissionDerive) {
+		return nil, errors.New("permission denied: caller is neither key owner nor granted derivation")
 	}
 	
 	// 4. Derive child key
@@ -18,12 +18,17 @@ package vm
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXKeyGetPublic is the precompiled contract for retrieving public keys (0x8001)
-type SGXKeyGetPublic struct{}
+type SGXKeyGetPublic struct {
+	repriced bool // Gas schedule of the SGX gas fork
+	tagged   bool // Key-type-tagged output of the SGX key types fork
+}
 
 // Name returns the name of the contract
 func (c *SGXKeyGetPublic) Name() string {
@@ -33,6 +38,9 @@ func (c *SGXKeyGetPublic) Name() string {
 // RequiredGas calculates the required gas
 // Input format: keyID (32 bytes)
 func (c *SGXKeyGetPublic) RequiredGas(input []byte) uint64 {
+	if c.repriced {
+		return params.SGXKeyGetPublicGas
+	}
 	return 3000
 }
 
@@ -42,15 +50,37 @@ func (c *SGXKeyGetPublic) Run(input []byte) ([]byte, error) {
 }
 
 // RunWithContext executes the contract with SGX context
-// Input format: keyID (32 bytes)
-// Output format: publicKey (variable length)
+// Input format: keyID (32 bytes) + optional format (1 byte: 0x00 public key,
+// 0x01 BIP32 extended public key of a secp256k1 key)
+// Output format: publicKey (variable length, 33 bytes compressed for threshold
+// keys) or extended public key (78 bytes)
+//
+// From the SGX key types fork on, format 0x02 returns the ECDH public key (the
+// X25519 public key of Ed25519 keys) and the output is prefixed with the key
+// type (1 byte), see sgx_curves.go for the encodings.
 func (c *SGXKeyGetPublic) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
+	if c.tagged {
+		return c.runTagged(ctx, input)
+	}
 	// 1. Parse input
 	if len(input) < 32 {
 		return nil, errors.New("invalid input: missing key ID")
 	}
 	keyID := common.BytesToHash(input[:32])
 	
+	// Threshold keys are registered in the state with their group key
+	if ctx.StateDB != nil {
+		if _, params, ok := thresholdKey(ctx.StateDB, keyID); ok {
+			return params.GroupKey(), nil
+		}
+	}
+	
+	// Extended public keys let contracts and wallets derive non-hardened
+	// children without the enclave
+	if len(input) > 32 && input[32] == 0x01 {
+		return ctx.KeyStore.GetExtendedPublicKey(keyID)
+	}
+	
 	// 2. Get public key (no permission check needed, public keys are public)
 	pubKey, err := ctx.KeyStore.GetPublicKey(keyID)
 	if err != nil {
@@ -60,3 +90,40 @@ func (c *SGXKeyGetPublic) RunWithContext(ctx *SGXContext, input []byte) ([]byte,
 	// 3. Return public key
 	return pubKey, nil
 }
+
+// runTagged returns the key-type-tagged public key of the SGX key types fork.
+func (c *SGXKeyGetPublic) runTagged(ctx *SGXContext, input []byte) ([]byte, error) {
+	if len(input) < 32 {
+		return nil, errors.New("invalid input: missing key ID")
+	}
+	keyID := common.BytesToHash(input[:32])
+
+	if ctx.StateDB != nil {
+		if _, params, ok := thresholdKey(ctx.StateDB, keyID); ok {
+			return append([]byte{byte(KeyTypeThreshold)}, params.GroupKey()...), nil
+		}
+	}
+	metadata, err := ctx.KeyStore.GetMetadata(keyID)
+	if err != nil {
+		return nil, err
+	}
+	var format byte
+	if len(input) > 32 {
+		format = input[32]
+	}
+	var pubKey []byte
+	switch format {
+	case 0x00:
+		pubKey, err = ctx.KeyStore.GetPublicKey(keyID)
+	case 0x01:
+		pubKey, err = ctx.KeyStore.GetExtendedPublicKey(keyID)
+	case 0x02:
+		pubKey, err = ctx.KeyStore.GetECDHPublicKey(keyID)
+	default:
+		return nil, fmt.Errorf("unsupported public key format: %d", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(metadata.KeyType)}, pubKey...), nil
+}
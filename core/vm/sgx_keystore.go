@@ -17,6 +17,8 @@
 package vm
 
 import (
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -27,6 +29,14 @@ const (
 	KeyTypeECDSA   KeyType = 0x01 // secp256k1
 	KeyTypeEd25519 KeyType = 0x02 // Ed25519
 	KeyTypeAES256  KeyType = 0x03 // AES-256
+
+	// KeyTypeThreshold is a secp256k1 Schnorr key shared among attested nodes,
+	// registered on chain and never held by a single key store
+	KeyTypeThreshold KeyType = 0x04
+
+	// KeyTypeP256 is an ECDSA key on the NIST P-256 curve (secp256r1), as used
+	// by WebAuthn authenticators and passkeys
+	KeyTypeP256 KeyType = 0x05
 )
 
 // KeyMetadata holds metadata about a cryptographic key
@@ -37,12 +47,25 @@ type KeyMetadata struct {
 	CreatedAt   uint64         // Creation timestamp
 	CreatedBy   common.Address // Creator address
 	Permissions []Permission   // Permission list
+
+	// Position in the key hierarchy of derived keys (see sgx_hd.go)
+	Depth             uint8  `json:",omitempty"` // Number of derivations from the root key
+	ParentFingerprint uint32 `json:",omitempty"` // BIP32 fingerprint of the parent public key
+	ChildNumber       uint32 `json:",omitempty"` // Index of the key below its parent
+
+	// Version of the key set from the chain state, an older version than the
+	// one anchored in the state reveals a rollback of the key store
+	Version uint64 `json:",omitempty"`
 }
 
 // KeyStore is the interface for cryptographic key storage and operations
 type KeyStore interface {
 	// CreateKey creates a new cryptographic key
 	CreateKey(owner common.Address, keyType KeyType) (common.Hash, error)
+
+	// CreateKeyDeterministic derives a new key from the network master secret,
+	// bound to the chain ID, the owner and the owner's key nonce
+	CreateKeyDeterministic(owner common.Address, keyType KeyType, chainID *big.Int, nonce uint64) (common.Hash, error)
 	
 	// GetPublicKey retrieves the public key for a given key ID
 	GetPublicKey(keyID common.Hash) ([]byte, error)
@@ -52,6 +75,10 @@ type KeyStore interface {
 	
 	// ECDH performs ECDH key exchange, optionally applies KDF, and returns a new key ID
 	ECDH(keyID common.Hash, peerPubKey []byte, kdfParams []byte) (common.Hash, error)
+
+	// GetECDHPublicKey returns the public key peers use for ECDH with the key,
+	// the X25519 public key for Ed25519 keys
+	GetECDHPublicKey(keyID common.Hash) ([]byte, error)
 	
 	// Encrypt encrypts data using the specified key
 	Encrypt(keyID common.Hash, plaintext []byte) ([]byte, error)
@@ -59,8 +86,13 @@ type KeyStore interface {
 	// Decrypt decrypts data using the specified key
 	Decrypt(keyID common.Hash, ciphertext []byte) ([]byte, error)
 	
-	// DeriveKey derives a child key from a parent key
+	// DeriveKey derives a descendant key along a derivation path (see
+	// ParseDerivationPath)
 	DeriveKey(keyID common.Hash, path []byte) (common.Hash, error)
+
+	// GetExtendedPublicKey returns the BIP32 extended public key of a
+	// secp256k1 key
+	GetExtendedPublicKey(keyID common.Hash) ([]byte, error)
 	
 	// GetMetadata retrieves key metadata
 	GetMetadata(keyID common.Hash) (*KeyMetadata, error)
@@ -17,20 +17,27 @@
 package vm
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"golang.org/x/crypto/hkdf"
 )
@@ -42,14 +49,42 @@ func zeroBytes(b []byte) {
 	}
 }
 
+// zeroPrivateKey zeros the secret material of a loaded private key
+func zeroPrivateKey(privKey interface{}) {
+	switch key := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		key.D.SetInt64(0)
+	case ed25519.PrivateKey:
+		zeroBytes(key)
+	case []byte:
+		zeroBytes(key)
+	}
+}
+
 // EncryptedKeyStore 实现 KeyStore 接口，支持加密存储
 type EncryptedKeyStore struct {
-	encryptedPath string // 加密分区路径
-	publicPath    string // 公开数据路径
+	encryptedPath string        // 加密分区路径
+	publicPath    string        // 公开数据路径
+	seal          *keyStoreSeal // 用 enclave 密封密钥加密和认证所有文件
+	files         keyFiles      // 文件读写，覆盖层将修改缓存在内存中
+
+	secret   *masterSecret      // 网络主密钥，确定性派生密钥所需，与覆盖层共享
+	sessions *thresholdSessions // 门限签名进行中的 nonce，与覆盖层共享
 }
 
-// NewEncryptedKeyStore 创建新的密钥存储
-func NewEncryptedKeyStore(encryptedPath, publicPath string) (*EncryptedKeyStore, error) {
+// masterSecret 保存网络主密钥
+type masterSecret struct {
+	lock  sync.RWMutex
+	value []byte
+}
+
+// NewEncryptedKeyStore 创建新的密钥存储，文件用 sealing 提供的密封密钥保护。
+// 未密封的旧版密钥存储在首次打开时被密封
+func NewEncryptedKeyStore(encryptedPath, publicPath string, sealing SealingKeyProvider) (*EncryptedKeyStore, error) {
+	seal, err := newKeyStoreSeal(sealing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive sealing keys: %w", err)
+	}
 	// 创建目录
 	if err := os.MkdirAll(encryptedPath, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create encrypted directory: %w", err)
@@ -58,10 +93,71 @@ func NewEncryptedKeyStore(encryptedPath, publicPath string) (*EncryptedKeyStore,
 		return nil, fmt.Errorf("failed to create public directory: %w", err)
 	}
 	
-	return &EncryptedKeyStore{
+	ks := &EncryptedKeyStore{
 		encryptedPath: encryptedPath,
 		publicPath:    publicPath,
-	}, nil
+		seal:          seal,
+		files:         diskFiles{},
+		secret:        new(masterSecret),
+		sessions:      newThresholdSessions(),
+	}
+	// 密封之前版本写入的明文文件在首次打开时迁移
+	if err := ks.migrateLegacyFiles(); err != nil {
+		return nil, fmt.Errorf("failed to migrate legacy key store: %w", err)
+	}
+	return ks, nil
+}
+
+// overlay 返回共享密封密钥和网络主密钥、通过 files 读写文件的密钥存储
+func (ks *EncryptedKeyStore) overlay(files keyFiles) *EncryptedKeyStore {
+	return &EncryptedKeyStore{
+		encryptedPath: ks.encryptedPath,
+		publicPath:    ks.publicPath,
+		seal:          ks.seal,
+		files:         files,
+		secret:        ks.secret,
+		sessions:      ks.sessions,
+	}
+}
+
+// SetMasterSecret 设置网络主密钥，之后可确定性地派生密钥
+func (ks *EncryptedKeyStore) SetMasterSecret(secret []byte) error {
+	if len(secret) != MasterSecretLength {
+		return fmt.Errorf("invalid master secret length: %d", len(secret))
+	}
+	ks.secret.lock.Lock()
+	defer ks.secret.lock.Unlock()
+
+	if ks.secret.value != nil {
+		zeroBytes(ks.secret.value)
+	}
+	ks.secret.value = common.CopyBytes(secret)
+	return nil
+}
+
+// HasMasterSecret 返回是否已设置网络主密钥
+func (ks *EncryptedKeyStore) HasMasterSecret() bool {
+	ks.secret.lock.RLock()
+	defer ks.secret.lock.RUnlock()
+
+	return ks.secret.value != nil
+}
+
+// CreateKeyDeterministic 从网络主密钥派生新密钥，所有节点对相同输入得到相同密钥
+func (ks *EncryptedKeyStore) CreateKeyDeterministic(owner common.Address, keyType KeyType, chainID *big.Int, nonce uint64) (common.Hash, error) {
+	ks.secret.lock.RLock()
+	seed, err := deriveKeySeed(ks.secret.value, chainID, owner, nonce, keyType)
+	ks.secret.lock.RUnlock()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer zeroBytes(seed)
+
+	privKey, pubKey, err := keyFromSeed(keyType, seed)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return ks.saveKey(owner, keyType, privKey, pubKey)
 }
 
 // CreateKey 创建新密钥
@@ -91,6 +187,16 @@ func (ks *EncryptedKeyStore) CreateKey(owner common.Address, keyType KeyType) (c
 		pubKey = pubKeyEd
 		keyID = crypto.Keccak256Hash(pubKey)
 		
+	case KeyTypeP256:
+		// 生成 P-256 密钥对
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("failed to generate P-256 key: %w", err)
+		}
+		privKey = privateKey
+		pubKey = p256PublicKey(&privateKey.PublicKey)
+		keyID = crypto.Keccak256Hash(pubKey)
+		
 	case KeyTypeAES256:
 		// 生成 AES-256 密钥
 		aesKey := make([]byte, 32)
@@ -111,7 +217,16 @@ func (ks *EncryptedKeyStore) CreateKey(owner common.Address, keyType KeyType) (c
 	}
 	
 	// 保存元数据到公开分区
-	metadata := &KeyMetadata{
+	if err := ks.saveMetadata(newKeyMetadata(keyID, owner, keyType)); err != nil {
+		return common.Hash{}, err
+	}
+	
+	return keyID, nil
+}
+
+// newKeyMetadata 返回新密钥的元数据
+func newKeyMetadata(keyID common.Hash, owner common.Address, keyType KeyType) *KeyMetadata {
+	return &KeyMetadata{
 		KeyID:       keyID,
 		Owner:       owner,
 		KeyType:     keyType,
@@ -119,10 +234,17 @@ func (ks *EncryptedKeyStore) CreateKey(owner common.Address, keyType KeyType) (c
 		CreatedBy:   owner,
 		Permissions: []Permission{},
 	}
-	if err := ks.saveMetadata(metadata); err != nil {
+}
+
+// saveKey 保存由公开部分标识的密钥，返回密钥 ID
+func (ks *EncryptedKeyStore) saveKey(owner common.Address, keyType KeyType, privKey interface{}, pubKey []byte) (common.Hash, error) {
+	keyID := crypto.Keccak256Hash(pubKey)
+	if err := ks.savePrivateKey(keyID, privKey); err != nil {
+		return common.Hash{}, err
+	}
+	if err := ks.saveMetadata(newKeyMetadata(keyID, owner, keyType)); err != nil {
 		return common.Hash{}, err
 	}
-	
 	return keyID, nil
 }
 
@@ -153,6 +275,13 @@ func (ks *EncryptedKeyStore) GetPublicKey(keyID common.Hash) ([]byte, error) {
 		}
 		return []byte(ed25519Key.Public().(ed25519.PublicKey)), nil
 		
+	case KeyTypeP256:
+		p256Key, ok := privKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid P-256 key")
+		}
+		return p256PublicKey(&p256Key.PublicKey), nil
+		
 	case KeyTypeAES256:
 		// 对称密钥不公开
 		return nil, errors.New("AES keys have no public component")
@@ -169,7 +298,7 @@ func (ks *EncryptedKeyStore) Sign(keyID common.Hash, hash []byte) ([]byte, error
 		return nil, err
 	}
 	
-	if metadata.KeyType != KeyTypeECDSA && metadata.KeyType != KeyTypeEd25519 {
+	if metadata.KeyType != KeyTypeECDSA && metadata.KeyType != KeyTypeEd25519 && metadata.KeyType != KeyTypeP256 {
 		return nil, errors.New("key type does not support signing")
 	}
 	
@@ -206,6 +335,14 @@ func (ks *EncryptedKeyStore) Sign(keyID common.Hash, hash []byte) ([]byte, error
 		defer zeroBytes(ed25519Key)
 		return signature, nil
 		
+	case KeyTypeP256:
+		p256Key, ok := privKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("invalid P-256 key")
+		}
+		defer p256Key.D.SetInt64(0)
+		return signP256(p256Key, hash)
+		
 	default:
 		return nil, fmt.Errorf("unsupported signing key type: %d", metadata.KeyType)
 	}
@@ -218,36 +355,23 @@ func (ks *EncryptedKeyStore) ECDH(keyID common.Hash, peerPubKey []byte, kdfParam
 		return common.Hash{}, err
 	}
 	
-	if metadata.KeyType != KeyTypeECDSA {
-		return common.Hash{}, errors.New("only ECDSA keys support ECDH")
+	if metadata.KeyType != KeyTypeECDSA && metadata.KeyType != KeyTypeEd25519 && metadata.KeyType != KeyTypeP256 {
+		return common.Hash{}, errors.New("key type does not support ECDH")
 	}
 	
 	privKey, err := ks.loadPrivateKey(keyID, metadata.KeyType)
 	if err != nil {
 		return common.Hash{}, err
 	}
+	defer zeroPrivateKey(privKey)
 	
-	ecdsaKey, ok := privKey.(*ecdsa.PrivateKey)
-	if !ok {
-		return common.Hash{}, errors.New("invalid ECDSA key")
-	}
-	
-	// Zero the private key big.Int after use
-	defer func() {
-		if ecdsaKey.D != nil {
-			ecdsaKey.D.SetInt64(0)
-		}
-	}()
-	
-	// 解析对方公钥
-	peerPublicKey, err := crypto.UnmarshalPubkey(peerPubKey)
+	// 执行 ECDH：secp256k1 和 P-256 取共享点的 X 坐标，Ed25519 密钥执行 X25519
+	shared, err := ecdhSharedSecret(privKey, peerPubKey)
 	if err != nil {
-		return common.Hash{}, fmt.Errorf("invalid peer public key: %w", err)
+		return common.Hash{}, err
 	}
-	
-	// 执行 ECDH
-	x, _ := peerPublicKey.Curve.ScalarMult(peerPublicKey.X, peerPublicKey.Y, ecdsaKey.D.Bytes())
-	sharedSecret := crypto.Keccak256(x.Bytes())
+	defer zeroBytes(shared)
+	sharedSecret := crypto.Keccak256(shared)
 	defer zeroBytes(sharedSecret)
 	
 	// Apply KDF if kdfParams provided
@@ -291,6 +415,20 @@ func (ks *EncryptedKeyStore) ECDH(keyID common.Hash, peerPubKey []byte, kdfParam
 	return newKeyID, nil
 }
 
+// GetECDHPublicKey 返回对方执行 ECDH 所用的公钥，Ed25519 密钥返回其 X25519 公钥
+func (ks *EncryptedKeyStore) GetECDHPublicKey(keyID common.Hash) ([]byte, error) {
+	metadata, err := ks.GetMetadata(keyID)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := ks.loadPrivateKey(keyID, metadata.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroPrivateKey(privKey)
+	return ecdhPublicKey(privKey)
+}
+
 // Encrypt 加密数据
 func (ks *EncryptedKeyStore) Encrypt(keyID common.Hash, plaintext []byte) ([]byte, error) {
 	metadata, err := ks.GetMetadata(keyID)
@@ -380,75 +518,113 @@ func (ks *EncryptedKeyStore) Decrypt(keyID common.Hash, ciphertext []byte) ([]by
 	return plaintext, nil
 }
 
-// DeriveKey 派生子密钥
+// DeriveKey 沿派生路径派生子孙密钥：secp256k1 按 BIP32，Ed25519 按 SLIP-10，AES 按 HKDF
 func (ks *EncryptedKeyStore) DeriveKey(keyID common.Hash, path []byte) (common.Hash, error) {
+	indices, err := ParseDerivationPath(path)
+	if err != nil {
+		return common.Hash{}, err
+	}
 	metadata, err := ks.GetMetadata(keyID)
 	if err != nil {
 		return common.Hash{}, err
 	}
-	
+	if metadata.KeyType == KeyTypeP256 {
+		return common.Hash{}, errors.New("P-256 keys do not support derivation")
+	}
+	if int(metadata.Depth)+len(indices) > 255 {
+		return common.Hash{}, fmt.Errorf("%w: depth exceeds 255", errInvalidPath)
+	}
 	privKey, err := ks.loadPrivateKey(keyID, metadata.KeyType)
 	if err != nil {
 		return common.Hash{}, err
 	}
-	
-	var derivedKey []byte
-	
-	switch metadata.KeyType {
-	case KeyTypeECDSA:
-		ecdsaKey, ok := privKey.(*ecdsa.PrivateKey)
-		if !ok {
-			return common.Hash{}, errors.New("invalid ECDSA key")
-		}
-		// 使用 HKDF 派生
-		derivedKey = crypto.Keccak256(ecdsaKey.D.Bytes(), path)
-		// Zero the big.Int after use
-		defer func() {
-			if ecdsaKey.D != nil {
-				ecdsaKey.D.SetInt64(0)
-			}
-		}()
-		
-	case KeyTypeEd25519:
-		ed25519Key, ok := privKey.(ed25519.PrivateKey)
-		if !ok {
-			return common.Hash{}, errors.New("invalid Ed25519 key")
+	chainCode, err := ks.loadChainCode(keyID, privKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// 逐级派生，记录最后一级父密钥的指纹
+	var (
+		pubKey      []byte
+		fingerprint uint32
+	)
+	for _, index := range indices {
+		switch key := privKey.(type) {
+		case *ecdsa.PrivateKey:
+			fingerprint = keyFingerprint(crypto.CompressPubkey(&key.PublicKey))
+			privKey, chainCode, err = deriveChildECDSA(key, chainCode, index)
+			key.D.SetInt64(0)
+		case ed25519.PrivateKey:
+			fingerprint = keyFingerprint(append([]byte{0x00}, key.Public().(ed25519.PublicKey)...))
+			privKey, chainCode, err = deriveChildEd25519(key, chainCode, index)
+			zeroBytes(key)
+		case []byte:
+			fingerprint = 0 // 对称密钥没有公钥指纹
+			privKey, err = deriveChildAES(key, index)
+			zeroBytes(key)
+		default:
+			return common.Hash{}, fmt.Errorf("unsupported key type: %d", metadata.KeyType)
 		}
-		derivedKey = crypto.Keccak256(ed25519Key, path)
-		defer zeroBytes(ed25519Key)
-		
-	case KeyTypeAES256:
-		aesKey, ok := privKey.([]byte)
-		if !ok {
-			return common.Hash{}, errors.New("invalid AES key")
+		if err != nil {
+			return common.Hash{}, err
 		}
-		derivedKey = crypto.Keccak256(aesKey, path)
-		defer zeroBytes(aesKey)
-		
-	default:
-		return common.Hash{}, fmt.Errorf("unsupported key type: %d", metadata.KeyType)
 	}
-	
-	defer zeroBytes(derivedKey)
-	
-	// 创建派生密钥（使用相同类型）
-	childKeyID, err := ks.CreateKey(metadata.Owner, metadata.KeyType)
-	if err != nil {
+	switch key := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		pubKey = crypto.FromECDSAPub(&key.PublicKey)
+		defer key.D.SetInt64(0)
+	case ed25519.PrivateKey:
+		pubKey = []byte(key.Public().(ed25519.PublicKey))
+		defer zeroBytes(key)
+	case []byte:
+		pubKey = key // 对称密钥，公钥即私钥
+		defer zeroBytes(key)
+	}
+
+	// 子密钥属于父密钥的所有者，子密钥 ID 由父密钥和路径唯一确定
+	childID := crypto.Keccak256Hash(pubKey)
+	if err := ks.savePrivateKey(childID, privKey); err != nil {
 		return common.Hash{}, err
 	}
-	
-	// 替换派生密钥的私钥数据
-	if err := ks.savePrivateKey(childKeyID, derivedKey); err != nil {
+	if err := ks.saveChainCode(childID, chainCode); err != nil {
 		return common.Hash{}, err
 	}
-	
-	return childKeyID, nil
+	child := newKeyMetadata(childID, metadata.Owner, metadata.KeyType)
+	child.Depth = metadata.Depth + uint8(len(indices))
+	child.ParentFingerprint = fingerprint
+	child.ChildNumber = indices[len(indices)-1]
+	if err := ks.saveMetadata(child); err != nil {
+		return common.Hash{}, err
+	}
+	return childID, nil
+}
+
+// GetExtendedPublicKey 返回 secp256k1 密钥的 BIP32 扩展公钥，可在 enclave 外派生非强化子密钥
+func (ks *EncryptedKeyStore) GetExtendedPublicKey(keyID common.Hash) ([]byte, error) {
+	metadata, err := ks.GetMetadata(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.KeyType != KeyTypeECDSA {
+		return nil, fmt.Errorf("extended public keys only exist for ECDSA keys, not type %d", metadata.KeyType)
+	}
+	privKey, err := ks.loadPrivateKey(keyID, metadata.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	key := privKey.(*ecdsa.PrivateKey)
+	defer key.D.SetInt64(0)
+
+	chainCode, err := ks.loadChainCode(keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	return serializeExtendedPublicKey(metadata.Depth, metadata.ParentFingerprint, metadata.ChildNumber, chainCode, crypto.CompressPubkey(&key.PublicKey)), nil
 }
 
 // GetMetadata 获取密钥元数据
 func (ks *EncryptedKeyStore) GetMetadata(keyID common.Hash) (*KeyMetadata, error) {
-	metaPath := filepath.Join(ks.publicPath, keyID.Hex()+".meta")
-	data, err := os.ReadFile(metaPath)
+	data, err := ks.readPublic(keyID.Hex() + ".meta")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
@@ -476,26 +652,53 @@ func (ks *EncryptedKeyStore) DeleteKey(keyID common.Hash, caller common.Address)
 	
 	// Load and zero the private key data before deleting
 	keyPath := filepath.Join(ks.encryptedPath, keyID.Hex()+".key")
-	data, err := os.ReadFile(keyPath)
+	data, err := ks.files.readFile(keyPath)
 	if err == nil {
 		// Zero the key data
 		zeroBytes(data)
 	}
 	
 	// 删除私钥
-	if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+	if err := ks.files.removeFile(keyPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete private key: %w", err)
 	}
 	
+	// 删除链码
+	chainPath := filepath.Join(ks.encryptedPath, keyID.Hex()+".chain")
+	if err := ks.files.removeFile(chainPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete chain code: %w", err)
+	}
+
 	// 删除元数据
 	metaPath := filepath.Join(ks.publicPath, keyID.Hex()+".meta")
-	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+	if err := ks.files.removeFile(metaPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
 	
 	return nil
 }
 
+// SetKeyVersion 设置密钥元数据的版本号。版本由链上状态确定，
+// 元数据版本低于状态中记录的版本说明宿主回滚了密钥目录
+func (ks *EncryptedKeyStore) SetKeyVersion(keyID common.Hash, version uint64) error {
+	metadata, err := ks.GetMetadata(keyID)
+	if err != nil {
+		return err
+	}
+	metadata.Version = version
+	return ks.saveMetadata(metadata)
+}
+
+// TransferOwnership 转移密钥所有权
+func (ks *EncryptedKeyStore) TransferOwnership(keyID common.Hash, newOwner common.Address) error {
+	metadata, err := ks.GetMetadata(keyID)
+	if err != nil {
+		return err
+	}
+	metadata.Owner = newOwner
+	return ks.saveMetadata(metadata)
+}
+
 // savePrivateKey 保存私钥到加密分区
 func (ks *EncryptedKeyStore) savePrivateKey(keyID common.Hash, privKey interface{}) error {
 	var data []byte
@@ -511,14 +714,45 @@ func (ks *EncryptedKeyStore) savePrivateKey(keyID common.Hash, privKey interface
 		return errors.New("unsupported private key type")
 	}
 	
-	keyPath := filepath.Join(ks.encryptedPath, keyID.Hex()+".key")
-	if err := os.WriteFile(keyPath, data, 0600); err != nil {
+	if err := ks.writeSealed(keyID.Hex()+".key", data); err != nil {
 		return fmt.Errorf("failed to write private key: %w", err)
 	}
 	
 	return nil
 }
 
+// saveChainCode 保存派生密钥的链码到加密分区
+func (ks *EncryptedKeyStore) saveChainCode(keyID common.Hash, chainCode []byte) error {
+	if chainCode == nil {
+		return nil // AES 密钥没有链码
+	}
+	if err := ks.writeSealed(keyID.Hex()+".chain", chainCode); err != nil {
+		return fmt.Errorf("failed to write chain code: %w", err)
+	}
+	return nil
+}
+
+// loadChainCode 加载密钥的链码，非派生密钥的链码由私钥确定
+func (ks *EncryptedKeyStore) loadChainCode(keyID common.Hash, privKey interface{}) ([]byte, error) {
+	chainCode, err := ks.readSealed(keyID.Hex() + ".chain")
+	switch {
+	case err == nil:
+		return chainCode, nil
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read chain code: %w", err)
+	}
+	switch key := privKey.(type) {
+	case *ecdsa.PrivateKey:
+		material := math.PaddedBigBytes(key.D, 32)
+		defer zeroBytes(material)
+		return defaultChainCode(material), nil
+	case ed25519.PrivateKey:
+		return defaultChainCode(key.Seed()), nil
+	default:
+		return nil, nil // AES 密钥派生不需要链码
+	}
+}
+
 // saveMetadata 保存元数据到公开分区
 func (ks *EncryptedKeyStore) saveMetadata(metadata *KeyMetadata) error {
 	data, err := json.Marshal(metadata)
@@ -526,8 +760,7 @@ func (ks *EncryptedKeyStore) saveMetadata(metadata *KeyMetadata) error {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 	
-	metaPath := filepath.Join(ks.publicPath, metadata.KeyID.Hex()+".meta")
-	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+	if err := ks.writePublic(metadata.KeyID.Hex()+".meta", data); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 	
@@ -537,8 +770,7 @@ func (ks *EncryptedKeyStore) saveMetadata(metadata *KeyMetadata) error {
 // loadPrivateKey 从加密分区加载私钥
 func (ks *EncryptedKeyStore) loadPrivateKey(keyID common.Hash, keyType KeyType) (interface{}, error) {
 	// 从文件加载
-	keyPath := filepath.Join(ks.encryptedPath, keyID.Hex()+".key")
-	data, err := os.ReadFile(keyPath)
+	data, err := ks.readSealed(keyID.Hex() + ".key")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
@@ -556,6 +788,13 @@ func (ks *EncryptedKeyStore) loadPrivateKey(keyID common.Hash, keyType KeyType)
 		}
 		privKey = key
 		
+	case KeyTypeP256:
+		key, err := p256KeyFromScalar(data)
+		if err != nil {
+			return nil, err
+		}
+		privKey = key
+		
 	case KeyTypeEd25519:
 		if len(data) != ed25519.PrivateKeySize {
 			return nil, errors.New("invalid Ed25519 key size")
@@ -580,3 +819,165 @@ func (ks *EncryptedKeyStore) loadPrivateKey(keyID common.Hash, keyType KeyType)
 	
 	return privKey, nil
 }
+
+// ImportKeyShare 验证并保存门限密钥的份额，返回门限密钥 ID。
+// 份额由发起节点经 RA-TLS 同步（见 storage.SyncManager），只保存在加密分区中
+func (ks *EncryptedKeyStore) ImportKeyShare(data []byte) (common.Hash, error) {
+	share, err := DecodeKeyShare(data)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	keyID := share.Params.KeyID()
+	if err := ks.writeSealed(keyID.Hex()+".share", data); err != nil {
+		return common.Hash{}, fmt.Errorf("failed to write key share: %w", err)
+	}
+	return keyID, nil
+}
+
+// loadKeyShare 加载门限密钥的份额，并检查其参数与链上登记的一致
+func (ks *EncryptedKeyStore) loadKeyShare(db StateDB, keyID common.Hash) (*KeyShare, error) {
+	data, err := ks.readSealed(keyID.Hex() + ".share")
+	if err != nil {
+		return nil, fmt.Errorf("key share not found: %w", err)
+	}
+	defer zeroBytes(data)
+
+	share, err := DecodeKeyShare(data)
+	if err != nil {
+		return nil, err
+	}
+	_, params, ok := thresholdKey(db, keyID)
+	if !ok {
+		return nil, fmt.Errorf("threshold key %s not registered", keyID.Hex())
+	}
+	if !bytes.Equal(params.Encode(), share.Params.Encode()) {
+		return nil, errors.New("key share does not match the registered threshold key")
+	}
+	return share, nil
+}
+
+// DecryptionShare 用本节点持有的交易密钥份额为队列中 index 处已提交的加密交易计算解密份额（带证明）。
+// 只为已提交且载荷哈希一致的交易计算，未提交的载荷（例如复制他人的临时公钥）得不到份额
+func (ks *EncryptedKeyStore) DecryptionShare(db StateDB, params *ThresholdParams, index uint64, payload []byte) ([]byte, error) {
+	committed, ok := EncryptedTxAt(db, index)
+	if !ok {
+		return nil, fmt.Errorf("encrypted transaction %d not committed", index)
+	}
+	if crypto.Keccak256Hash(payload) != committed.PayloadHash {
+		return nil, errors.New("payload does not match the committed transaction")
+	}
+	ephemeral := types.EncryptedTxEphemeralKey(payload)
+	if ephemeral == nil {
+		return nil, errors.New("invalid encrypted payload")
+	}
+	data, err := ks.readSealed(params.KeyID().Hex() + ".share")
+	if err != nil {
+		return nil, fmt.Errorf("key share not found: %w", err)
+	}
+	defer zeroBytes(data)
+
+	share, err := DecodeKeyShare(data)
+	if err != nil {
+		return nil, err
+	}
+	defer share.Value.SetInt64(0)
+	if !bytes.Equal(params.Encode(), share.Params.Encode()) {
+		return nil, errors.New("key share does not match the transaction key")
+	}
+	return share.DecryptionShare(ephemeral, rand.Reader)
+}
+
+// DealerAddress 返回链的门限密钥分发者地址，分发者私钥由网络主密钥派生，只存在于 enclave 内
+func (ks *EncryptedKeyStore) DealerAddress(chainID *big.Int) (common.Address, error) {
+	ks.secret.lock.RLock()
+	key, err := deriveDealerKey(ks.secret.value, chainID)
+	ks.secret.lock.RUnlock()
+	if err != nil {
+		return common.Address{}, err
+	}
+	defer key.D.SetInt64(0)
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// DealThresholdKey 在 enclave 内生成门限密钥并拆分为 count 个份额，任意 threshold 个可签名。
+// 返回 owner 调用 SGXKeyCreate 登记该密钥的输入（带分发者签名）和各份额（序号 1..count）。
+// 完整私钥不离开本函数，份额经 storage.SyncManager 只发给对应节点
+func (ks *EncryptedKeyStore) DealThresholdKey(chainID *big.Int, owner common.Address, threshold, count uint8) ([]byte, [][]byte, error) {
+	ks.secret.lock.RLock()
+	dealer, err := deriveDealerKey(ks.secret.value, chainID)
+	ks.secret.lock.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dealer.D.SetInt64(0)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	secret := crypto.FromECDSA(key)
+	key.D.SetInt64(0)
+	defer zeroBytes(secret)
+
+	params, shares, err := SplitThresholdKey(secret, threshold, count, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := crypto.Sign(ThresholdRegistrationHash(chainID, owner, params), dealer)
+	if err != nil {
+		return nil, nil, err
+	}
+	registration := append([]byte{byte(KeyTypeThreshold)}, params.Encode()...)
+	registration = append(registration, sig...)
+
+	encoded := make([][]byte, len(shares))
+	for i, share := range shares {
+		encoded[i] = share.Encode()
+		share.Value.SetInt64(0)
+	}
+	return registration, encoded, nil
+}
+
+// ThresholdCommitment 为本节点生成新的签名 nonce，返回其承诺 D_i ++ E_i（第一轮）。
+// 只为 db 中已由合约请求的消息签名。nonce 保存在 enclave 内，只能用于一次部分签名
+func (ks *EncryptedKeyStore) ThresholdCommitment(db StateDB, keyID common.Hash, hash []byte) ([]byte, error) {
+	if !ThresholdSignRequested(db, keyID, hash) {
+		return nil, errors.New("threshold signature not requested")
+	}
+	share, err := ks.loadKeyShare(db, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer share.Value.SetInt64(0)
+
+	nonces, err := share.Commit(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ks.sessions.add(keyID, hash, nonces)
+	return nonces.Commitment(), nil
+}
+
+// ThresholdPartialSign 返回本节点的部分签名（第二轮），commitments 为各签名者按序号升序的承诺，
+// 其中本节点的承诺须由 ThresholdCommitment 生成；对应的 nonce 使用后即删除。
+// 结果可直接附加到 SGXSign 的输入中
+func (ks *EncryptedKeyStore) ThresholdPartialSign(db StateDB, keyID common.Hash, hash []byte, signers []uint8, commitments [][]byte) ([]byte, error) {
+	if !ThresholdSignRequested(db, keyID, hash) {
+		return nil, errors.New("threshold signature not requested")
+	}
+	share, err := ks.loadKeyShare(db, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer share.Value.SetInt64(0)
+
+	position := slices.Index(signers, share.Index)
+	if position < 0 || position >= len(commitments) {
+		return nil, fmt.Errorf("key share %d not among the signers", share.Index)
+	}
+	nonces, err := ks.sessions.take(keyID, hash, commitments[position])
+	if err != nil {
+		return nil, err
+	}
+	return share.PartialSign(nonces, hash, signers, commitments)
+}
@@ -0,0 +1,552 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// keyStoreLayersDepth is the number of blocks below the canonical head
+	// whose key store changes are kept in memory, for reorgs and side chain
+	// imports.
+	keyStoreLayersDepth = 128
+
+	// keyStoreJournalDepth is the number of blocks below the canonical head
+	// whose key store changes are journaled in the database, for rewinding
+	// the key store along with the chain.
+	keyStoreJournalDepth = params.FullImmutabilityThreshold
+)
+
+// keyFiles reads and writes the files of a key store.
+type keyFiles interface {
+	readFile(path string) ([]byte, error)
+	writeFile(path string, data []byte, perm os.FileMode) error
+	removeFile(path string) error
+}
+
+// diskFiles keeps the files of a key store on disk.
+type diskFiles struct{}
+
+func (diskFiles) readFile(path string) ([]byte, error) { return os.ReadFile(path) }
+
+func (diskFiles) writeFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+func (diskFiles) removeFile(path string) error { return os.Remove(path) }
+
+// keyFile is the content of a changed key store file.
+type keyFile struct {
+	data []byte
+	perm os.FileMode
+}
+
+// fileDiff is a set of key store file changes by path, nil for removed files.
+type fileDiff map[string]*keyFile
+
+// lookup returns the content of a file in the diff and whether it is part of
+// the diff at all.
+func (diff fileDiff) lookup(path string) ([]byte, bool, error) {
+	file, ok := diff[path]
+	switch {
+	case !ok:
+		return nil, false, nil
+	case file == nil:
+		return nil, true, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	default:
+		return common.CopyBytes(file.data), true, nil
+	}
+}
+
+// overlayFiles keeps the file changes of a key store in memory, on top of the
+// key store of a block.
+type overlayFiles struct {
+	layers *KeyStoreLayers
+	parent common.Hash
+
+	lock sync.RWMutex
+	diff fileDiff
+}
+
+func (f *overlayFiles) readFile(path string) ([]byte, error) {
+	f.lock.RLock()
+	data, ok, err := f.diff.lookup(path)
+	f.lock.RUnlock()
+	if ok {
+		return data, err
+	}
+	return f.layers.readFile(f.parent, path)
+}
+
+func (f *overlayFiles) writeFile(path string, data []byte, perm os.FileMode) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.diff[path] = &keyFile{data: common.CopyBytes(data), perm: perm}
+	return nil
+}
+
+func (f *overlayFiles) removeFile(path string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.diff[path] = nil
+	return nil
+}
+
+// keyStoreLayer holds the key store changes made by the transactions of a
+// block.
+type keyStoreLayer struct {
+	hash   common.Hash
+	parent common.Hash
+	number uint64
+
+	diff fileDiff
+	undo fileDiff // Previous content of the changed files on disk, nil unless written
+}
+
+func (l *keyStoreLayer) written() bool { return l.undo != nil }
+
+// journalFile is a file of a journaled diff.
+type journalFile struct {
+	Path    string
+	Data    []byte
+	Perm    uint32
+	Removed bool
+}
+
+// keyStoreJournal is the database record of a block whose key store changes
+// are written to disk. It holds the changes, to write them again if the node
+// stopped in the middle, and the previous content of the changed files, to
+// restore them when the block is rewound. The private key files are stored
+// sealed, as on disk.
+type keyStoreJournal struct {
+	Parent common.Hash
+	Diff   []journalFile
+	Undo   []journalFile
+}
+
+// encodeDiff converts a diff to its journal encoding, ordered by path.
+func encodeDiff(diff fileDiff) []journalFile {
+	files := make([]journalFile, 0, len(diff))
+	for path, file := range diff {
+		if file == nil {
+			files = append(files, journalFile{Path: path, Removed: true})
+		} else {
+			files = append(files, journalFile{Path: path, Data: file.data, Perm: uint32(file.perm)})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// decodeDiff converts a journaled diff back.
+func decodeDiff(files []journalFile) fileDiff {
+	diff := make(fileDiff, len(files))
+	for _, file := range files {
+		if file.Removed {
+			diff[file.Path] = nil
+		} else {
+			diff[file.Path] = &keyFile{data: file.Data, perm: os.FileMode(file.Perm)}
+		}
+	}
+	return diff
+}
+
+// keyStoreJournalKey = SGXKeyJournalPrefix + num (uint64 big endian) + hash
+func keyStoreJournalKey(number uint64, hash common.Hash) []byte {
+	key := append([]byte{}, rawdb.SGXKeyJournalPrefix...)
+	key = binary.BigEndian.AppendUint64(key, number)
+	return append(key, hash.Bytes()...)
+}
+
+// KeyStoreLayers buffers the key store changes of the executed blocks in
+// memory and writes them to disk once the blocks become canonical, so that
+// speculative execution (block building, calls, tracing) and blocks of side
+// chains leave the key store untouched.
+//
+// The changes of the canonical blocks are written together with the previous
+// content of the files, which is restored when the blocks are reorged out.
+// Both are journaled in the chain database, so that the key store rewinds
+// along with the chain after a restart, a crash or SetHead, and blocks
+// re-executed on top of an older canonical block see the key store as it was
+// at that block.
+type KeyStoreLayers struct {
+	base *EncryptedKeyStore
+	db   ethdb.KeyValueStore // Chain database holding the journal of the written blocks
+
+	lock       sync.RWMutex
+	layers     map[common.Hash]*keyStoreLayer // Changes of the recent blocks by hash
+	head       common.Hash                    // Block whose changes were last written to disk
+	headNumber uint64
+}
+
+// NewKeyStoreLayers creates the block layers on top of a key store, whose
+// written blocks are journaled in db.
+func NewKeyStoreLayers(base *EncryptedKeyStore, db ethdb.KeyValueStore) (*KeyStoreLayers, error) {
+	l := &KeyStoreLayers{
+		base:   base,
+		db:     db,
+		layers: make(map[common.Hash]*keyStoreLayer),
+	}
+	blob, _ := db.Get(rawdb.SGXKeyHeadKey)
+	if len(blob) != 8+common.HashLength {
+		return l, nil
+	}
+	l.headNumber = binary.BigEndian.Uint64(blob)
+	l.head = common.BytesToHash(blob[8:])
+
+	// The node may have stopped while writing the changes of the head, write
+	// them again. Rewinding it restores the previous content either way.
+	head, err := l.writtenLayer(l.headNumber, l.head)
+	if err != nil {
+		return nil, err
+	}
+	if head != nil {
+		if err := l.apply(head.diff); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Base returns the key store on disk.
+func (l *KeyStoreLayers) Base() *EncryptedKeyStore { return l.base }
+
+// Ready returns ErrNoMasterSecret until the network master secret is loaded
+// into the key store. Blocks cannot be executed or built before, as the
+// deterministic keys derive from it.
+func (l *KeyStoreLayers) Ready() error {
+	if l != nil && !l.base.HasMasterSecret() {
+		return ErrNoMasterSecret
+	}
+	return nil
+}
+
+// Open returns the key store for executing on top of the block with the
+// given hash. Its changes are kept in memory and discarded unless the block
+// executed with it is retained.
+func (l *KeyStoreLayers) Open(block common.Hash) *EncryptedKeyStore {
+	return l.base.overlay(&overlayFiles{layers: l, parent: block, diff: make(fileDiff)})
+}
+
+// Retain records the key store changes of a block executed with a key store
+// opened on top of its parent.
+func (l *KeyStoreLayers) Retain(header *types.Header, keys KeyStore) {
+	ks, ok := keys.(*EncryptedKeyStore)
+	if !ok {
+		return
+	}
+	files, ok := ks.files.(*overlayFiles)
+	if !ok || files.layers != l || files.parent != header.ParentHash {
+		return
+	}
+	files.lock.RLock()
+	diff := maps.Clone(files.diff)
+	files.lock.RUnlock()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	hash := header.Hash()
+	if layer, _ := l.writtenLayer(header.Number.Uint64(), hash); layer != nil {
+		return // the changes of the block are on disk already
+	}
+	l.layers[hash] = &keyStoreLayer{
+		hash:   hash,
+		parent: header.ParentHash,
+		number: header.Number.Uint64(),
+		diff:   diff,
+	}
+}
+
+// Commit writes the key store changes of a new canonical head and its
+// ancestors to disk, restoring the files changed by the blocks of the old
+// canonical chain first. It also rewinds the key store to an older head.
+func (l *KeyStoreLayers) Commit(header *types.Header) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	hash, number := header.Hash(), header.Number.Uint64()
+	if hash == l.head {
+		return nil
+	}
+	// Collect the changes of the blocks not written yet
+	var (
+		pending      []*keyStoreLayer
+		anchor       = hash
+		anchorNumber = number
+	)
+	for layer := l.layers[anchor]; layer != nil && !layer.written(); layer = l.layers[anchor] {
+		pending = append(pending, layer)
+		anchor, anchorNumber = layer.parent, layer.number-1
+	}
+	// Undo the changes of the blocks written after the common ancestor
+	for l.head != anchor && l.head != (common.Hash{}) {
+		layer, err := l.writtenLayer(l.headNumber, l.head)
+		if err != nil {
+			return err
+		}
+		if layer == nil || l.headNumber <= anchorNumber {
+			log.Warn("SGX key store changes cannot be rewound", "head", l.head, "number", l.headNumber, "ancestor", anchor)
+			break
+		}
+		if err := l.revert(layer); err != nil {
+			return err
+		}
+	}
+	// Write the changes of the new canonical blocks, oldest first
+	for i := len(pending) - 1; i >= 0; i-- {
+		if err := l.commit(pending[i]); err != nil {
+			return err
+		}
+	}
+	if l.head != hash {
+		if err := l.setHead(l.db, number, hash); err != nil {
+			return err
+		}
+	}
+	// Drop the layers too old to be reorged or built upon, and the journal of
+	// the blocks too old to be rewound
+	for h, layer := range l.layers {
+		if layer.number+keyStoreLayersDepth < number {
+			delete(l.layers, h)
+		}
+	}
+	if number > keyStoreJournalDepth {
+		return l.prune(number - keyStoreJournalDepth)
+	}
+	return nil
+}
+
+// commit writes the changes of a block on top of the current head. The
+// journal is stored first, so an interrupted write is repaired on restart.
+func (l *KeyStoreLayers) commit(layer *keyStoreLayer) error {
+	undo, err := l.previous(layer.diff)
+	if err != nil {
+		return err
+	}
+	blob, err := rlp.EncodeToBytes(&keyStoreJournal{
+		Parent: layer.parent,
+		Diff:   encodeDiff(layer.diff),
+		Undo:   encodeDiff(undo),
+	})
+	if err != nil {
+		return err
+	}
+	batch := l.db.NewBatch()
+	batch.Put(keyStoreJournalKey(layer.number, layer.hash), blob)
+	if err := l.setHead(batch, layer.number, layer.hash); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	layer.undo = undo
+	l.layers[layer.hash] = layer
+	return l.apply(layer.diff)
+}
+
+// revert restores the files changed by the head block and drops its journal.
+// The block's changes stay in memory to be written again on a reorg back.
+func (l *KeyStoreLayers) revert(layer *keyStoreLayer) error {
+	if err := l.apply(layer.undo); err != nil {
+		return err
+	}
+	batch := l.db.NewBatch()
+	batch.Delete(keyStoreJournalKey(layer.number, layer.hash))
+	if err := l.setHead(batch, layer.number-1, layer.parent); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	layer.undo = nil
+	l.layers[layer.hash] = layer
+	return nil
+}
+
+// setHead records the block whose changes were last written to disk.
+func (l *KeyStoreLayers) setHead(db ethdb.KeyValueWriter, number uint64, hash common.Hash) error {
+	blob := binary.BigEndian.AppendUint64(nil, number)
+	if err := db.Put(rawdb.SGXKeyHeadKey, append(blob, hash.Bytes()...)); err != nil {
+		return err
+	}
+	l.head, l.headNumber = hash, number
+	return nil
+}
+
+// prune deletes the journal of the blocks below the given number.
+func (l *KeyStoreLayers) prune(limit uint64) error {
+	it := l.db.NewIterator(rawdb.SGXKeyJournalPrefix, nil)
+	defer it.Release()
+
+	batch := l.db.NewBatch()
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(rawdb.SGXKeyJournalPrefix)+8+common.HashLength {
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(rawdb.SGXKeyJournalPrefix):]) >= limit {
+			break
+		}
+		batch.Delete(common.CopyBytes(key))
+	}
+	return batch.Write()
+}
+
+// writtenLayer returns the block with the given number and hash if its
+// changes are written to disk, loading its journal if it is not in memory.
+func (l *KeyStoreLayers) writtenLayer(number uint64, hash common.Hash) (*keyStoreLayer, error) {
+	if layer := l.layers[hash]; layer != nil {
+		if layer.written() {
+			return layer, nil
+		}
+		return nil, nil
+	}
+	blob, _ := l.db.Get(keyStoreJournalKey(number, hash))
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	var journal keyStoreJournal
+	if err := rlp.DecodeBytes(blob, &journal); err != nil {
+		return nil, err
+	}
+	return &keyStoreLayer{
+		hash:   hash,
+		parent: journal.Parent,
+		number: number,
+		diff:   decodeDiff(journal.Diff),
+		undo:   decodeDiff(journal.Undo),
+	}, nil
+}
+
+// previous returns the diff restoring the content on disk of the files
+// changed by a diff.
+func (l *KeyStoreLayers) previous(diff fileDiff) (fileDiff, error) {
+	files := l.base.files
+	undo := make(fileDiff, len(diff))
+	for path, file := range diff {
+		prev, err := files.readFile(path)
+		switch {
+		case err == nil:
+			perm := os.FileMode(0600)
+			if file != nil {
+				perm = file.perm
+			}
+			undo[path] = &keyFile{data: prev, perm: perm}
+		case os.IsNotExist(err):
+			undo[path] = nil
+		default:
+			return nil, err
+		}
+	}
+	return undo, nil
+}
+
+// apply writes a diff to the files on disk.
+func (l *KeyStoreLayers) apply(diff fileDiff) error {
+	files := l.base.files
+	for path, file := range diff {
+		var err error
+		if file == nil {
+			err = files.removeFile(path)
+		} else {
+			err = files.writeFile(path, file.data, file.perm)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFile reads a file of the key store of the block with the given hash.
+func (l *KeyStoreLayers) readFile(block common.Hash, path string) ([]byte, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	// Look up the changes of the block and its ancestors not on disk
+	anchor := block
+	for layer := l.layers[anchor]; layer != nil && !layer.written(); layer = l.layers[anchor] {
+		if data, ok, err := layer.diff.lookup(path); ok {
+			return data, err
+		}
+		anchor = layer.parent
+	}
+	// The files changed on disk by blocks after the anchor, either later
+	// canonical blocks or ones of another branch, have their previous content
+	// in the undo of the oldest such block.
+	written, err := l.writtenSince(anchor)
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range written {
+		if data, ok, err := layer.undo.lookup(path); ok {
+			return data, err
+		}
+	}
+	return l.base.files.readFile(path)
+}
+
+// writtenSince returns the blocks whose changes were written to disk after
+// the given block, oldest first. It returns nil if the block is not an
+// ancestor of the written head.
+func (l *KeyStoreLayers) writtenSince(anchor common.Hash) ([]*keyStoreLayer, error) {
+	// Stop the walk at the height of the anchor if it is known
+	limit, known := l.blockNumber(anchor)
+	if known && limit >= l.headNumber && anchor != l.head {
+		return nil, nil
+	}
+	var written []*keyStoreLayer
+	for hash, number := l.head, l.headNumber; hash != anchor; number-- {
+		if known && number <= limit {
+			return nil, nil
+		}
+		layer, err := l.writtenLayer(number, hash)
+		if err != nil || layer == nil {
+			return nil, err
+		}
+		written = append(written, layer)
+		hash = layer.parent
+	}
+	slices.Reverse(written)
+	return written, nil
+}
+
+// blockNumber returns the number of a block known to the layers or the chain.
+func (l *KeyStoreLayers) blockNumber(hash common.Hash) (uint64, bool) {
+	if layer := l.layers[hash]; layer != nil {
+		return layer.number, true
+	}
+	return rawdb.ReadHeaderNumber(l.db, hash)
+}
@@ -0,0 +1,323 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/log"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The key store seals every file it writes under a key derived from the
+// enclave sealing key. Private key material, chain codes and key shares are
+// encrypted and authenticated with AES-256-GCM. Metadata stays readable in
+// the public directory but carries an HMAC-SHA256 tag. Both are bound to the
+// file name, so the host can neither modify a file nor swap it for the file
+// of another key. Replaying an older version of a file is detected with the
+// key versions anchored in the chain state (see sgx_journal.go).
+
+// SealingPolicy selects the enclave identity the sealing key is bound to.
+type SealingPolicy uint8
+
+const (
+	// SealToMRSigner binds the key store to the enclave signer, so that it
+	// survives enclave upgrades. This is the default.
+	SealToMRSigner SealingPolicy = iota
+	// SealToMREnclave binds the key store to the exact enclave build. Every
+	// upgrade of the binary loses the key store.
+	SealToMREnclave
+)
+
+// sealedFileVersion is the format version of sealed files.
+const sealedFileVersion = 0x01
+
+// sealedStoreMarker is the public file marking a key store as sealed. Key
+// stores without it were written before sealing and are migrated on open.
+const sealedStoreMarker = "keystore.sealed"
+
+var (
+	// ErrSealedFileInvalid is returned for key store files that do not
+	// authenticate under the sealing key.
+	ErrSealedFileInvalid = errors.New("sealed key store file invalid")
+
+	sealingKeyInfo  = []byte("sgx-keystore-seal")
+	metadataMACInfo = []byte("sgx-keystore-meta")
+)
+
+// SealingKeyProvider supplies the enclave sealing key the key store protects
+// its files with.
+type SealingKeyProvider interface {
+	SealingKey() ([]byte, error)
+}
+
+// GramineSealingKey reads the sealing key of the policy from the Gramine
+// attestation device.
+type GramineSealingKey struct {
+	Policy SealingPolicy
+}
+
+// SealingKey implements SealingKeyProvider.
+func (k GramineSealingKey) SealingKey() ([]byte, error) {
+	name := "_sgx_mrsigner"
+	if k.Policy == SealToMREnclave {
+		name = "_sgx_mrenclave"
+	}
+	key, err := os.ReadFile(filepath.Join("/dev/attestation/keys", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sealing key: %w", err)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("invalid sealing key length: %d", len(key))
+	}
+	return key, nil
+}
+
+// FileSealingKey is a fake sealing key kept in a plain file, generated on
+// first use. It offers no protection against the host and is only meant for
+// tests and development nodes running outside an enclave.
+type FileSealingKey struct {
+	Path string
+}
+
+// SealingKey implements SealingKeyProvider.
+func (k FileSealingKey) SealingKey() ([]byte, error) {
+	key, err := os.ReadFile(k.Path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid sealing key length: %d", len(key))
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read sealing key: %w", err)
+	}
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.Path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(k.Path, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write sealing key: %w", err)
+	}
+	return key, nil
+}
+
+// keyStoreSeal protects the files of the key store.
+type keyStoreSeal struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// newKeyStoreSeal derives the file encryption and MAC keys from the sealing
+// key of the provider.
+func newKeyStoreSeal(provider SealingKeyProvider) (*keyStoreSeal, error) {
+	if provider == nil {
+		return nil, errors.New("no sealing key provider")
+	}
+	sealingKey, err := provider.SealingKey()
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(sealingKey)
+
+	encKey := make([]byte, 32)
+	defer zeroBytes(encKey)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sealingKey, nil, sealingKeyInfo), encKey); err != nil {
+		return nil, err
+	}
+	macKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sealingKey, nil, metadataMACInfo), macKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keyStoreSeal{aead: aead, macKey: macKey}, nil
+}
+
+// seal encrypts the content of the named file.
+func (s *keyStoreSeal) seal(name string, data []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte{sealedFileVersion}, nonce...)
+	return s.aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+// unseal decrypts and authenticates the content of the named file.
+func (s *keyStoreSeal) unseal(name string, sealed []byte) ([]byte, error) {
+	if len(sealed) < 1+s.aead.NonceSize()+s.aead.Overhead() || sealed[0] != sealedFileVersion {
+		return nil, fmt.Errorf("%w: %s", ErrSealedFileInvalid, name)
+	}
+	nonce, ciphertext := sealed[1:1+s.aead.NonceSize()], sealed[1+s.aead.NonceSize():]
+	data, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSealedFileInvalid, name)
+	}
+	return data, nil
+}
+
+// tag returns the MAC of the named public file.
+func (s *keyStoreSeal) tag(name string, data []byte) []byte {
+	mac := hmac.New(sha256.New, s.macKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0x00})
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// authenticate prefixes the content of the named public file with its MAC.
+func (s *keyStoreSeal) authenticate(name string, data []byte) []byte {
+	return append(s.tag(name, data), data...)
+}
+
+// verify checks and strips the MAC of the named public file.
+func (s *keyStoreSeal) verify(name string, tagged []byte) ([]byte, error) {
+	if len(tagged) < sha256.Size || !hmac.Equal(tagged[:sha256.Size], s.tag(name, tagged[sha256.Size:])) {
+		return nil, fmt.Errorf("%w: %s", ErrSealedFileInvalid, name)
+	}
+	return tagged[sha256.Size:], nil
+}
+
+// writeSealed seals and writes a file of the encrypted directory.
+func (ks *EncryptedKeyStore) writeSealed(name string, data []byte) error {
+	sealed, err := ks.seal.seal(name, data)
+	if err != nil {
+		return err
+	}
+	return ks.files.writeFile(filepath.Join(ks.encryptedPath, name), sealed, 0600)
+}
+
+// readSealed reads and unseals a file of the encrypted directory.
+func (ks *EncryptedKeyStore) readSealed(name string) ([]byte, error) {
+	sealed, err := ks.files.readFile(filepath.Join(ks.encryptedPath, name))
+	if err != nil {
+		return nil, err
+	}
+	return ks.seal.unseal(name, sealed)
+}
+
+// writePublic authenticates and writes a file of the public directory.
+func (ks *EncryptedKeyStore) writePublic(name string, data []byte) error {
+	return ks.files.writeFile(filepath.Join(ks.publicPath, name), ks.seal.authenticate(name, data), 0644)
+}
+
+// readPublic reads and verifies a file of the public directory.
+func (ks *EncryptedKeyStore) readPublic(name string) ([]byte, error) {
+	tagged, err := ks.files.readFile(filepath.Join(ks.publicPath, name))
+	if err != nil {
+		return nil, err
+	}
+	return ks.seal.verify(name, tagged)
+}
+
+// legacyFile is a key store file written before sealing.
+type legacyFile struct {
+	name   string
+	data   []byte
+	public bool
+}
+
+// migrateLegacyFiles seals the files of a key store written before sealing
+// was introduced, and marks the key store as sealed. Key stores holding any
+// file sealed under this or another sealing key are left alone, so files
+// planted in the clear by the host are never sealed into them.
+func (ks *EncryptedKeyStore) migrateLegacyFiles() error {
+	if _, err := os.Stat(filepath.Join(ks.publicPath, sealedStoreMarker)); !os.IsNotExist(err) {
+		return err
+	}
+	legacy, ok, err := ks.legacyFiles()
+	if err != nil || !ok {
+		return err
+	}
+	for _, file := range legacy {
+		if file.public {
+			err = ks.writePublic(file.name, file.data)
+		} else {
+			err = ks.writeSealed(file.name, file.data)
+		}
+		zeroBytes(file.data)
+		if err != nil {
+			return fmt.Errorf("failed to seal %s: %w", file.name, err)
+		}
+	}
+	if len(legacy) > 0 {
+		log.Info("Sealed legacy SGX key store", "files", len(legacy))
+	}
+	return ks.writePublic(sealedStoreMarker, []byte{sealedFileVersion})
+}
+
+// legacyFiles returns the files of the key store if it was written before
+// sealing. Legacy key stores keep their metadata as plain JSON, and none of
+// their files authenticate under the sealing key.
+func (ks *EncryptedKeyStore) legacyFiles() (legacy []legacyFile, ok bool, err error) {
+	defer func() {
+		if !ok {
+			for _, file := range legacy {
+				zeroBytes(file.data)
+			}
+			legacy = nil
+		}
+	}()
+	for _, public := range []bool{false, true} {
+		dir := ks.encryptedPath
+		if public {
+			dir = ks.publicPath
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return legacy, false, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return legacy, false, err
+			}
+			legacy = append(legacy, legacyFile{name: entry.Name(), data: data, public: public})
+			if public {
+				if _, err := ks.seal.verify(entry.Name(), data); err == nil || !json.Valid(data) {
+					return legacy, false, nil
+				}
+			} else if _, err := ks.seal.unseal(entry.Name(), data); err == nil {
+				return legacy, false, nil
+			}
+		}
+	}
+	return legacy, true, nil
+}
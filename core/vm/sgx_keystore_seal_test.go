@@ -0,0 +1,202 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the key store files are encrypted and authenticated under the
+// sealing key.
+func TestSealedKeyStore(t *testing.T) {
+	var (
+		dir        = t.TempDir()
+		encrypted  = filepath.Join(dir, "encrypted")
+		public     = filepath.Join(dir, "public")
+		sealingKey = FileSealingKey{Path: filepath.Join(dir, "sealing.key")}
+		owner      = common.Address{0x01}
+	)
+	keys, err := NewEncryptedKeyStore(encrypted, public, sealingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := keys.CreateKey(owner, KeyTypeECDSA)
+	second, _ := keys.CreateKey(owner, KeyTypeECDSA)
+	hash := crypto.Keccak256(nil)
+
+	// The private key is not stored in the clear
+	sealed, err := os.ReadFile(filepath.Join(encrypted, first.Hex()+".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _ := keys.loadPrivateKey(first, KeyTypeECDSA)
+	if bytes.Contains(sealed, crypto.FromECDSA(priv.(*ecdsa.PrivateKey))) {
+		t.Error("private key stored unencrypted")
+	}
+	// Modified files and files swapped between keys are rejected
+	tampered := common.CopyBytes(sealed)
+	tampered[len(tampered)-1] ^= 0x01
+	os.WriteFile(filepath.Join(encrypted, first.Hex()+".key"), tampered, 0600)
+	if _, err := keys.Sign(first, hash); !errors.Is(err, ErrSealedFileInvalid) {
+		t.Errorf("modified key: expected ErrSealedFileInvalid, got %v", err)
+	}
+	other, _ := os.ReadFile(filepath.Join(encrypted, second.Hex()+".key"))
+	os.WriteFile(filepath.Join(encrypted, first.Hex()+".key"), other, 0600)
+	if _, err := keys.Sign(first, hash); !errors.Is(err, ErrSealedFileInvalid) {
+		t.Errorf("swapped key: expected ErrSealedFileInvalid, got %v", err)
+	}
+	meta, _ := os.ReadFile(filepath.Join(public, second.Hex()+".meta"))
+	os.WriteFile(filepath.Join(public, first.Hex()+".meta"), meta, 0644)
+	if _, err := keys.GetMetadata(first); !errors.Is(err, ErrSealedFileInvalid) {
+		t.Errorf("swapped metadata: expected ErrSealedFileInvalid, got %v", err)
+	}
+	// The store reopens with the same sealing key only
+	reopened, err := NewEncryptedKeyStore(encrypted, public, sealingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Sign(second, hash); err != nil {
+		t.Errorf("reopened store: %v", err)
+	}
+	foreign, err := NewEncryptedKeyStore(encrypted, public, FileSealingKey{Path: filepath.Join(dir, "other.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := foreign.Sign(second, hash); !errors.Is(err, ErrSealedFileInvalid) {
+		t.Errorf("foreign sealing key: expected ErrSealedFileInvalid, got %v", err)
+	}
+}
+
+// Tests that key stores written before sealing are sealed when first opened,
+// and that files planted in the clear later are not.
+func TestLegacyKeyStoreMigration(t *testing.T) {
+	var (
+		dir        = t.TempDir()
+		encrypted  = filepath.Join(dir, "encrypted")
+		public     = filepath.Join(dir, "public")
+		sealingKey = FileSealingKey{Path: filepath.Join(dir, "sealing.key")}
+		hash       = crypto.Keccak256(nil)
+	)
+	keys, err := NewEncryptedKeyStore(encrypted, public, sealingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID, _ := keys.CreateKey(common.Address{0x01}, KeyTypeECDSA)
+	want, err := keys.Sign(keyID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rewrite the store in the unsealed format of earlier versions
+	plain, _ := keys.readSealed(keyID.Hex() + ".key")
+	chain, _ := keys.readSealed(keyID.Hex() + ".chain")
+	meta, _ := keys.readPublic(keyID.Hex() + ".meta")
+	os.WriteFile(filepath.Join(encrypted, keyID.Hex()+".key"), plain, 0600)
+	os.WriteFile(filepath.Join(encrypted, keyID.Hex()+".chain"), chain, 0600)
+	os.WriteFile(filepath.Join(public, keyID.Hex()+".meta"), meta, 0644)
+	os.Remove(filepath.Join(public, sealedStoreMarker))
+
+	migrated, err := NewEncryptedKeyStore(encrypted, public, sealingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, err := migrated.Sign(keyID, hash); err != nil || !bytes.Equal(sig, want) {
+		t.Fatalf("migrated key: signature %x, error %v", sig, err)
+	}
+	if sealed, _ := os.ReadFile(filepath.Join(encrypted, keyID.Hex()+".key")); bytes.Contains(sealed, plain) {
+		t.Error("migrated private key stored unencrypted")
+	}
+	// Files planted in the clear after the migration are rejected
+	planted, _ := migrated.CreateKey(common.Address{0x01}, KeyTypeECDSA)
+	os.WriteFile(filepath.Join(encrypted, planted.Hex()+".key"), plain, 0600)
+	reopened, err := NewEncryptedKeyStore(encrypted, public, sealingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Sign(planted, hash); !errors.Is(err, ErrSealedFileInvalid) {
+		t.Errorf("planted key: expected ErrSealedFileInvalid, got %v", err)
+	}
+}
+
+// Tests that restoring an older copy of the key store is detected with the
+// key versions anchored in the state.
+func TestSGXKeyRollback(t *testing.T) {
+	var (
+		keys       = newSGXTestKeyStore(t)
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		journal    = newSGXJournal(keys, statedb)
+		ks         = journal.keyStore()
+		owner      = common.Address{0x01}
+		other      = common.Address{0x02}
+		hash       = crypto.Keccak256(nil)
+	)
+	keyID, err := ks.CreateKey(owner, KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.commit()
+	metaPath := filepath.Join(keys.publicPath, keyID.Hex()+".meta")
+	keyPath := filepath.Join(keys.encryptedPath, keyID.Hex()+".key")
+	backupMeta, _ := os.ReadFile(metaPath)
+	backupKey, _ := os.ReadFile(keyPath)
+
+	// A reverted transfer restores the previous version
+	snap, keySnap := statedb.Snapshot(), journal.snapshot()
+	if err := ks.TransferOwnership(keyID, other); err != nil {
+		t.Fatal(err)
+	}
+	statedb.RevertToSnapshot(snap)
+	journal.revertToSnapshot(keySnap)
+	if _, err := ks.Sign(keyID, hash); err != nil {
+		t.Fatalf("sign after reverted transfer: %v", err)
+	}
+	// Restoring the metadata from before a transfer is detected
+	if err := ks.TransferOwnership(keyID, other); err != nil {
+		t.Fatal(err)
+	}
+	journal.commit()
+	if version := anchoredKeyVersion(statedb, keyID); version != 2 {
+		t.Fatalf("anchored version: got %d, want 2", version)
+	}
+	os.WriteFile(metaPath, backupMeta, 0644)
+	if _, err := ks.GetMetadata(keyID); !errors.Is(err, ErrKeyRollback) {
+		t.Fatalf("restored metadata: expected ErrKeyRollback, got %v", err)
+	}
+	if _, err := ks.Sign(keyID, hash); !errors.Is(err, ErrKeyRollback) {
+		t.Fatalf("restored metadata: expected ErrKeyRollback, got %v", err)
+	}
+	// Restoring a deleted key is detected
+	keys.SetKeyVersion(keyID, 2)
+	if err := ks.DeleteKey(keyID, owner); err != nil {
+		t.Fatal(err)
+	}
+	journal.commit()
+	os.WriteFile(metaPath, backupMeta, 0644)
+	os.WriteFile(keyPath, backupKey, 0600)
+	if _, err := ks.Sign(keyID, hash); !errors.Is(err, ErrKeyRollback) {
+		t.Errorf("restored deleted key: expected ErrKeyRollback, got %v", err)
+	}
+}
@@ -20,10 +20,13 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
-// SGXTransferOwnership is the precompiled contract for key ownership transfer (0x8009)
-type SGXTransferOwnership struct{}
+// SGXTransferOwnership is the precompiled contract for key ownership transfer (0x800a)
+type SGXTransferOwnership struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
 
 // Name returns the name of the contract
 func (c *SGXTransferOwnership) Name() string {
@@ -33,6 +36,9 @@ func (c *SGXTransferOwnership) Name() string {
 // RequiredGas calculates the required gas
 // Input format: keyID (32 bytes) + newOwner (20 bytes)
 func (c *SGXTransferOwnership) RequiredGas(input []byte) uint64 {
+	if c.repriced {
+		return params.SGXTransferOwnershipGas
+	}
 	return 3000
 }
 
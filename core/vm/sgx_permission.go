@@ -32,11 +32,11 @@ const (
 
 // Permission defines access rights for a key
 type Permission struct {
-	Grantee   common.Address // Grantee address
-	Type      PermissionType // Permission type
-	ExpiresAt uint64         // Expiration timestamp (0 means never expires)
-	MaxUses   uint64         // Maximum usage count (0 means unlimited)
-	UsedCount uint64         // Current usage count
+	Grantee   common.Address `json:"grantee"`   // Grantee address
+	Type      PermissionType `json:"type"`      // Permission type
+	ExpiresAt uint64         `json:"expiresAt"` // Expiration timestamp (0 means never expires)
+	MaxUses   uint64         `json:"maxUses"`   // Maximum usage count (0 means unlimited)
+	UsedCount uint64         `json:"usedCount"` // Current usage count
 }
 
 // PermissionManager is the interface for managing key permissions
@@ -44,7 +44,8 @@ type PermissionManager interface {
 	// GrantPermission grants a permission to a grantee
 	GrantPermission(keyID common.Hash, permission Permission) error
 	
-	// RevokePermission revokes a permission from a grantee
+	// RevokePermission revokes permission types from a grantee, narrowing
+	// combined grants
 	RevokePermission(keyID common.Hash, grantee common.Address, permType PermissionType) error
 	
 	// CheckPermission checks if a caller has the specified permission
@@ -53,6 +54,7 @@ type PermissionManager interface {
 	// GetPermissions retrieves all permissions for a key
 	GetPermissions(keyID common.Hash) ([]Permission, error)
 	
-	// UsePermission records permission usage (increments counter)
-	UsePermission(keyID common.Hash, caller common.Address, permType PermissionType) error
+	// UsePermission records permission usage (increments the counter of the
+	// permission CheckPermission accepts at the timestamp)
+	UsePermission(keyID common.Hash, caller common.Address, permType PermissionType, timestamp uint64) error
 }
@@ -0,0 +1,104 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// authorizePermissionChange reports whether the caller may grant or revoke
+// permissions of the given type on the key: the owner may change any
+// permission, holders of an active admin permission all but admin ones.
+func authorizePermissionChange(ctx *SGXContext, keyID common.Hash, permType PermissionType) error {
+	metadata, err := keyMetadata(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	if metadata.Owner == ctx.Caller {
+		return nil
+	}
+	if permType&PermissionAdmin == 0 && ctx.PermissionManager.CheckPermission(keyID, ctx.Caller, PermissionAdmin, ctx.Timestamp) {
+		return nil
+	}
+	return errors.New("permission denied: only key owner or admin can change permissions")
+}
+
+// SGXGrantPermission is the precompiled contract for granting key permissions (0x800c)
+type SGXGrantPermission struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
+
+// Name returns the name of the contract
+func (c *SGXGrantPermission) Name() string {
+	return "SGXGrantPermission"
+}
+
+// RequiredGas calculates the required gas
+// Input format: keyID (32 bytes) + grantee (20 bytes) + permType (1 byte) +
+// expiresAt (8 bytes) + maxUses (8 bytes)
+func (c *SGXGrantPermission) RequiredGas(input []byte) uint64 {
+	if c.repriced {
+		return params.SGXGrantPermissionGas
+	}
+	return 25000
+}
+
+// Run executes the contract (requires context)
+func (c *SGXGrantPermission) Run(input []byte) ([]byte, error) {
+	return nil, errors.New("context required")
+}
+
+// RunWithContext executes the contract with SGX context
+// Input format: keyID (32 bytes) + grantee (20 bytes) + permType (1 byte) +
+// expiresAt (8 bytes, 0 for never) + maxUses (8 bytes, 0 for unlimited)
+// Output format: success (1 byte: 0x01 for success)
+func (c *SGXGrantPermission) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
+	// 1. Check if in read-only mode
+	if ctx.IsReadOnly {
+		return nil, errors.New("cannot grant permission in read-only mode")
+	}
+
+	// 2. Parse input
+	if len(input) != 69 { // 32 + 20 + 1 + 8 + 8
+		return nil, errors.New("invalid input: expected 69 bytes (keyID + grantee + permType + expiresAt + maxUses)")
+	}
+	keyID := common.BytesToHash(input[:32])
+	permission := Permission{
+		Grantee:   common.BytesToAddress(input[32:52]),
+		Type:      PermissionType(input[52]),
+		ExpiresAt: binary.BigEndian.Uint64(input[53:61]),
+		MaxUses:   binary.BigEndian.Uint64(input[61:69]),
+	}
+
+	// 3. Check that the caller may grant the permission
+	if err := authorizePermissionChange(ctx, keyID, permission.Type); err != nil {
+		return nil, err
+	}
+
+	// 4. Grant the permission, resetting its usage counter
+	if err := ctx.PermissionManager.GrantPermission(keyID, permission); err != nil {
+		return nil, fmt.Errorf("failed to grant permission: %w", err)
+	}
+
+	// 5. Return success
+	return []byte{0x01}, nil
+}
@@ -58,7 +58,8 @@ func (pm *InMemoryPermissionManager) GrantPermission(keyID common.Hash, permissi
 	return nil
 }
 
-// RevokePermission 撤销权限
+// RevokePermission 撤销权限，从被授权者包含这些类型的所有权限中移除这些类型
+// （组合授权被收窄，类型全部移除的权限被删除）
 func (pm *InMemoryPermissionManager) RevokePermission(keyID common.Hash, grantee common.Address, permType PermissionType) error {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
@@ -68,9 +69,12 @@ func (pm *InMemoryPermissionManager) RevokePermission(keyID common.Hash, grantee
 	
 	found := false
 	for _, p := range perms {
-		if p.Grantee == grantee && p.Type == permType {
+		if p.Grantee == grantee && p.Type&permType != 0 {
 			found = true
-			continue
+			p.Type &^= permType
+			if p.Type == 0 || pm.hasGrant(perms, grantee, p.Type) {
+				continue
+			}
 		}
 		newPerms = append(newPerms, p)
 	}
@@ -83,31 +87,26 @@ func (pm *InMemoryPermissionManager) RevokePermission(keyID common.Hash, grantee
 	return nil
 }
 
-// CheckPermission 检查权限
+// hasGrant 检查被授权者是否单独持有该类型的权限
+func (pm *InMemoryPermissionManager) hasGrant(perms []Permission, grantee common.Address, permType PermissionType) bool {
+	for _, p := range perms {
+		if p.Grantee == grantee && p.Type == permType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPermission 检查权限（未过期且有剩余使用次数）
 func (pm *InMemoryPermissionManager) CheckPermission(keyID common.Hash, caller common.Address, permType PermissionType, timestamp uint64) bool {
 	pm.mutex.RLock()
 	defer pm.mutex.RUnlock()
 	
 	perms := pm.permissions[keyID]
-	for _, p := range perms {
-		if p.Grantee != caller {
-			continue
+	for i := range perms {
+		if perms[i].active(caller, permType, timestamp) {
+			return true
 		}
-		if p.Type&permType == 0 {
-			continue
-		}
-		
-		// 检查过期时间
-		if p.ExpiresAt > 0 && timestamp > p.ExpiresAt {
-			continue
-		}
-		
-		// 检查使用次数
-		if p.MaxUses > 0 && p.UsedCount >= p.MaxUses {
-			continue
-		}
-		
-		return true
 	}
 	
 	return false
@@ -125,17 +124,14 @@ func (pm *InMemoryPermissionManager) GetPermissions(keyID common.Hash) ([]Permis
 	return result, nil
 }
 
-// UsePermission 使用权限（增加计数）
-func (pm *InMemoryPermissionManager) UsePermission(keyID common.Hash, caller common.Address, permType PermissionType) error {
+// UsePermission 使用权限（增加 CheckPermission 在同一时间接受的权限的计数）
+func (pm *InMemoryPermissionManager) UsePermission(keyID common.Hash, caller common.Address, permType PermissionType, timestamp uint64) error {
 	pm.mutex.Lock()
 	defer pm.mutex.Unlock()
 	
 	perms := pm.permissions[keyID]
-	for i, p := range perms {
-		if p.Grantee != caller {
-			continue
-		}
-		if p.Type&permType == 0 {
+	for i := range perms {
+		if !perms[i].active(caller, permType, timestamp) {
 			continue
 		}
 		
@@ -0,0 +1,80 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// SGXRevokePermission is the precompiled contract for revoking key permissions (0x800d)
+type SGXRevokePermission struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
+
+// Name returns the name of the contract
+func (c *SGXRevokePermission) Name() string {
+	return "SGXRevokePermission"
+}
+
+// RequiredGas calculates the required gas
+// Input format: keyID (32 bytes) + grantee (20 bytes) + permType (1 byte)
+func (c *SGXRevokePermission) RequiredGas(input []byte) uint64 {
+	if c.repriced {
+		return params.SGXRevokePermissionGas
+	}
+	return 10000
+}
+
+// Run executes the contract (requires context)
+func (c *SGXRevokePermission) Run(input []byte) ([]byte, error) {
+	return nil, errors.New("context required")
+}
+
+// RunWithContext executes the contract with SGX context
+// Input format: keyID (32 bytes) + grantee (20 bytes) + permType (1 byte)
+// Output format: success (1 byte: 0x01 for success)
+func (c *SGXRevokePermission) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
+	// 1. Check if in read-only mode
+	if ctx.IsReadOnly {
+		return nil, errors.New("cannot revoke permission in read-only mode")
+	}
+
+	// 2. Parse input
+	if len(input) != 53 { // 32 + 20 + 1
+		return nil, errors.New("invalid input: expected 53 bytes (keyID + grantee + permType)")
+	}
+	keyID := common.BytesToHash(input[:32])
+	grantee := common.BytesToAddress(input[32:52])
+	permType := PermissionType(input[52])
+
+	// 3. Check that the caller may revoke the permission
+	if err := authorizePermissionChange(ctx, keyID, permType); err != nil {
+		return nil, err
+	}
+
+	// 4. Revoke the permission
+	if err := ctx.PermissionManager.RevokePermission(keyID, grantee, permType); err != nil {
+		return nil, fmt.Errorf("failed to revoke permission: %w", err)
+	}
+
+	// 5. Return success
+	return []byte{0x01}, nil
+}
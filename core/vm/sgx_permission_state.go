@@ -0,0 +1,252 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SGXPermissionAddress is the system account whose storage holds the key
+// permissions, the address of the permission grant precompile.
+var SGXPermissionAddress = common.BytesToAddress([]byte{0x80, 0x0c})
+
+// The permissions of a key are stored as a list in the storage of
+// SGXPermissionAddress:
+//
+//	keccak256("sgx-perm-count" ++ keyID)                 number of permissions
+//	keccak256("sgx-perm-entry" ++ keyID ++ index) + 0    grantee ++ type
+//	keccak256("sgx-perm-entry" ++ keyID ++ index) + 1    expiresAt ++ maxUses ++ usedCount
+//	keccak256("sgx-perm-index" ++ keyID ++ grantee ++ type)  index + 1
+//
+// Removing a permission moves the last entry into its place. Permission types
+// are stored with the defined type bits only, so a grantee holds at most one
+// entry per combination of them, and the entries of a grantee are found
+// through the index slots without walking the key's list.
+var (
+	permCountDomain = []byte("sgx-perm-count")
+	permEntryDomain = []byte("sgx-perm-entry")
+	permIndexDomain = []byte("sgx-perm-index")
+)
+
+// permissionTypeMask holds the defined permission type bits.
+const permissionTypeMask = PermissionSign | PermissionDecrypt | PermissionDerive | PermissionAdmin
+
+// errPermissionNotFound is returned when revoking a permission not granted.
+var errPermissionNotFound = errors.New("permission not found")
+
+// StatePermissionManager is a PermissionManager keeping the permissions in
+// the state, so that they are part of consensus and reverted with the call
+// frames that changed them.
+type StatePermissionManager struct {
+	db StateDB
+}
+
+// NewStatePermissionManager returns a permission manager on the given state.
+func NewStatePermissionManager(db StateDB) *StatePermissionManager {
+	return &StatePermissionManager{db: db}
+}
+
+func permCountSlot(keyID common.Hash) common.Hash {
+	return crypto.Keccak256Hash(permCountDomain, keyID.Bytes())
+}
+
+func permEntrySlot(keyID common.Hash, index uint64) *big.Int {
+	return crypto.Keccak256Hash(permEntryDomain, keyID.Bytes(), binary.BigEndian.AppendUint64(nil, index)).Big()
+}
+
+func permIndexSlot(keyID common.Hash, grantee common.Address, permType PermissionType) common.Hash {
+	return crypto.Keccak256Hash(permIndexDomain, keyID.Bytes(), grantee.Bytes(), []byte{byte(permType)})
+}
+
+func (pm *StatePermissionManager) get(slot common.Hash) uint64 {
+	return pm.db.GetState(SGXPermissionAddress, slot).Big().Uint64()
+}
+
+func (pm *StatePermissionManager) set(slot common.Hash, value uint64) {
+	pm.db.SetState(SGXPermissionAddress, slot, common.BigToHash(new(big.Int).SetUint64(value)))
+}
+
+// readEntry reads the permission at the given index of the key's list.
+func (pm *StatePermissionManager) readEntry(keyID common.Hash, index uint64) Permission {
+	base := permEntrySlot(keyID, index)
+	head := pm.db.GetState(SGXPermissionAddress, common.BigToHash(base))
+	data := pm.db.GetState(SGXPermissionAddress, common.BigToHash(new(big.Int).Add(base, common.Big1)))
+	return Permission{
+		Grantee:   common.BytesToAddress(head[:common.AddressLength]),
+		Type:      PermissionType(head[common.AddressLength]),
+		ExpiresAt: binary.BigEndian.Uint64(data[8:16]),
+		MaxUses:   binary.BigEndian.Uint64(data[16:24]),
+		UsedCount: binary.BigEndian.Uint64(data[24:32]),
+	}
+}
+
+// writeEntry writes the permission at the given index of the key's list, an
+// empty permission clears the entry.
+func (pm *StatePermissionManager) writeEntry(keyID common.Hash, index uint64, p Permission) {
+	var head, data common.Hash
+	if p != (Permission{}) {
+		copy(head[:], p.Grantee.Bytes())
+		head[common.AddressLength] = byte(p.Type)
+		binary.BigEndian.PutUint64(data[8:16], p.ExpiresAt)
+		binary.BigEndian.PutUint64(data[16:24], p.MaxUses)
+		binary.BigEndian.PutUint64(data[24:32], p.UsedCount)
+	}
+	base := permEntrySlot(keyID, index)
+	pm.db.SetState(SGXPermissionAddress, common.BigToHash(base), head)
+	pm.db.SetState(SGXPermissionAddress, common.BigToHash(new(big.Int).Add(base, common.Big1)), data)
+}
+
+// granteeEntries returns the list indexes of the grantee's permissions that
+// include any of the given types, ascending, read from the index slots of the
+// type combinations.
+func (pm *StatePermissionManager) granteeEntries(keyID common.Hash, grantee common.Address, permType PermissionType) []uint64 {
+	var indexes []uint64
+	for t := permissionTypeMask; t != 0; t = (t - 1) & permissionTypeMask {
+		if t&permType == 0 {
+			continue
+		}
+		if index := pm.get(permIndexSlot(keyID, grantee, t)); index != 0 {
+			indexes = append(indexes, index-1)
+		}
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// GrantPermission grants a permission, replacing the one of the same grantee
+// and type if any. Type bits without a defined permission are dropped.
+func (pm *StatePermissionManager) GrantPermission(keyID common.Hash, permission Permission) error {
+	permission.Type &= permissionTypeMask
+	if permission.Grantee == (common.Address{}) || permission.Type == 0 {
+		return errors.New("invalid permission: missing grantee or type")
+	}
+	touchSGXAccount(pm.db, SGXPermissionAddress)
+	indexSlot := permIndexSlot(keyID, permission.Grantee, permission.Type)
+	if index := pm.get(indexSlot); index != 0 {
+		pm.writeEntry(keyID, index-1, permission)
+		return nil
+	}
+	count := pm.get(permCountSlot(keyID))
+	pm.writeEntry(keyID, count, permission)
+	pm.set(indexSlot, count+1)
+	pm.set(permCountSlot(keyID), count+1)
+	return nil
+}
+
+// RevokePermission revokes the given permission types from the grantee. The
+// types are removed from every permission of the grantee that includes any of
+// them, so that revoking a single type also narrows combined grants, and
+// revoking all types removes them entirely. A narrowed permission keeps its
+// expiry and usage counter, unless the grantee already holds one of the
+// remaining types alone, which is kept instead.
+func (pm *StatePermissionManager) RevokePermission(keyID common.Hash, grantee common.Address, permType PermissionType) error {
+	indexes := pm.granteeEntries(keyID, grantee, permType)
+	if len(indexes) == 0 {
+		return errPermissionNotFound
+	}
+	// Entries are edited from the back, removing one only moves entries
+	// behind those still to edit
+	for i := len(indexes); i > 0; i-- {
+		index := indexes[i-1]
+		p := pm.readEntry(keyID, index)
+		remaining := p.Type &^ permType
+		if remaining == 0 || pm.get(permIndexSlot(keyID, grantee, remaining)) != 0 {
+			pm.removeEntry(keyID, index, p)
+			continue
+		}
+		pm.set(permIndexSlot(keyID, grantee, p.Type), 0)
+		pm.set(permIndexSlot(keyID, grantee, remaining), index+1)
+		p.Type = remaining
+		pm.writeEntry(keyID, index, p)
+	}
+	return nil
+}
+
+// removeEntry removes the permission at the given index of the key's list,
+// moving the last entry into its place. Entries after the index are never
+// moved, so the list can be edited while iterating it backwards.
+func (pm *StatePermissionManager) removeEntry(keyID common.Hash, index uint64, p Permission) {
+	last := pm.get(permCountSlot(keyID)) - 1
+	if index != last {
+		moved := pm.readEntry(keyID, last)
+		pm.writeEntry(keyID, index, moved)
+		pm.set(permIndexSlot(keyID, moved.Grantee, moved.Type), index+1)
+	}
+	pm.writeEntry(keyID, last, Permission{})
+	pm.set(permIndexSlot(keyID, p.Grantee, p.Type), 0)
+	pm.set(permCountSlot(keyID), last)
+}
+
+// active reports whether the permission allows the caller to use the key for
+// permType at the given time.
+func (p *Permission) active(caller common.Address, permType PermissionType, timestamp uint64) bool {
+	if p.Grantee != caller || p.Type&permType == 0 {
+		return false
+	}
+	if p.ExpiresAt > 0 && timestamp > p.ExpiresAt {
+		return false
+	}
+	return p.MaxUses == 0 || p.UsedCount < p.MaxUses
+}
+
+// activeEntry returns the index of the first active permission of the caller
+// and type at the given time. Only the caller's entries are read, so the cost
+// does not grow with the permissions of the key.
+func (pm *StatePermissionManager) activeEntry(keyID common.Hash, caller common.Address, permType PermissionType, timestamp uint64) (uint64, Permission, bool) {
+	for _, index := range pm.granteeEntries(keyID, caller, permType) {
+		if p := pm.readEntry(keyID, index); p.active(caller, permType, timestamp) {
+			return index, p, true
+		}
+	}
+	return 0, Permission{}, false
+}
+
+// CheckPermission checks if a caller has an active permission of the type.
+func (pm *StatePermissionManager) CheckPermission(keyID common.Hash, caller common.Address, permType PermissionType, timestamp uint64) bool {
+	_, _, ok := pm.activeEntry(keyID, caller, permType, timestamp)
+	return ok
+}
+
+// GetPermissions returns all permissions of a key.
+func (pm *StatePermissionManager) GetPermissions(keyID common.Hash) ([]Permission, error) {
+	count := pm.get(permCountSlot(keyID))
+	perms := make([]Permission, 0, count)
+	for i := uint64(0); i < count; i++ {
+		perms = append(perms, pm.readEntry(keyID, i))
+	}
+	return perms, nil
+}
+
+// UsePermission increments the usage counter of the permission accepted by
+// CheckPermission at the same time, the first active one of the caller and
+// type.
+func (pm *StatePermissionManager) UsePermission(keyID common.Hash, caller common.Address, permType PermissionType, timestamp uint64) error {
+	index, p, ok := pm.activeEntry(keyID, caller, permType, timestamp)
+	if !ok {
+		return fmt.Errorf("permission not found for caller %s and type %d", caller.Hex(), permType)
+	}
+	p.UsedCount++
+	pm.writeEntry(keyID, index, p)
+	return nil
+}
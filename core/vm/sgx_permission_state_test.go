@@ -0,0 +1,257 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+var sgxGrantPermissionAddr = common.BytesToAddress([]byte{0x80, 0x0c})
+
+func TestStatePermissionManager(t *testing.T) {
+	var (
+		db         = state.NewDatabaseForTesting()
+		statedb, _ = state.New(types.EmptyRootHash, db)
+		pm         = NewStatePermissionManager(statedb)
+		keyID      = common.Hash{0x01}
+		alice      = common.Address{0xaa}
+		bob        = common.Address{0xbb}
+		carol      = common.Address{0xcc}
+	)
+	grants := []Permission{
+		{Grantee: alice, Type: PermissionSign, MaxUses: 2},
+		{Grantee: bob, Type: PermissionDecrypt, ExpiresAt: 100},
+		{Grantee: carol, Type: PermissionSign | PermissionDerive},
+	}
+	for _, p := range grants {
+		if err := pm.GrantPermission(keyID, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Permissions survive a restart from the committed state
+	root, err := statedb.Commit(0, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb, _ = state.New(root, db)
+	pm = NewStatePermissionManager(statedb)
+	if perms, _ := pm.GetPermissions(keyID); !reflect.DeepEqual(perms, grants) {
+		t.Fatalf("permissions after restart: got %v, want %v", perms, grants)
+	}
+
+	// Expiry
+	if !pm.CheckPermission(keyID, bob, PermissionDecrypt, 100) || pm.CheckPermission(keyID, bob, PermissionDecrypt, 101) {
+		t.Error("expiry not applied")
+	}
+	// Usage counters
+	for i := 0; i < 2; i++ {
+		if !pm.CheckPermission(keyID, alice, PermissionSign, 0) {
+			t.Fatalf("use %d: permission inactive", i)
+		}
+		if err := pm.UsePermission(keyID, alice, PermissionSign, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pm.CheckPermission(keyID, alice, PermissionSign, 0) || pm.UsePermission(keyID, alice, PermissionSign, 0) == nil {
+		t.Error("permission usable beyond its maximum uses")
+	}
+	// Granting again replaces the permission
+	if err := pm.GrantPermission(keyID, Permission{Grantee: alice, Type: PermissionSign, MaxUses: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if !pm.CheckPermission(keyID, alice, PermissionSign, 0) {
+		t.Error("renewed permission inactive")
+	}
+	// Revoking moves the last permission into the free place
+	if err := pm.RevokePermission(keyID, alice, PermissionSign); err != nil {
+		t.Fatal(err)
+	}
+	want := []Permission{grants[2], grants[1]}
+	if perms, _ := pm.GetPermissions(keyID); !reflect.DeepEqual(perms, want) {
+		t.Errorf("permissions after revoke: got %v, want %v", perms, want)
+	}
+	if err := pm.RevokePermission(keyID, alice, PermissionSign); !errors.Is(err, errPermissionNotFound) {
+		t.Errorf("revoking twice: expected errPermissionNotFound, got %v", err)
+	}
+	if err := pm.RevokePermission(keyID, carol, PermissionSign|PermissionDerive); err != nil {
+		t.Fatal(err)
+	}
+	if perms, _ := pm.GetPermissions(keyID); !reflect.DeepEqual(perms, []Permission{grants[1]}) {
+		t.Errorf("permissions after second revoke: got %v", perms)
+	}
+}
+
+// Tests that using a permission charges the one accepted at the block time,
+// and that revoking a type narrows combined and wildcard grants.
+func TestStatePermissionUseAndRevoke(t *testing.T) {
+	var (
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		pm         = NewStatePermissionManager(statedb)
+		keyID      = common.Hash{0x01}
+		alice      = common.Address{0xaa}
+		bob        = common.Address{0xbb}
+		all        = PermissionType(0xff)
+	)
+	grants := []Permission{
+		{Grantee: alice, Type: PermissionSign, ExpiresAt: 100, MaxUses: 5},
+		{Grantee: alice, Type: PermissionSign | PermissionDecrypt, MaxUses: 1},
+		{Grantee: bob, Type: all},
+		{Grantee: bob, Type: PermissionSign},
+	}
+	for _, p := range grants {
+		if err := pm.GrantPermission(keyID, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the defined type bits are granted
+	if err := pm.GrantPermission(keyID, Permission{Grantee: bob, Type: 0x08}); err == nil {
+		t.Error("permission without defined type granted")
+	}
+	// The expired permission is not charged
+	if !pm.CheckPermission(keyID, alice, PermissionSign, 200) {
+		t.Fatal("permission inactive")
+	}
+	if err := pm.UsePermission(keyID, alice, PermissionSign, 200); err != nil {
+		t.Fatal(err)
+	}
+	if perms, _ := pm.GetPermissions(keyID); perms[0].UsedCount != 0 || perms[1].UsedCount != 1 {
+		t.Errorf("wrong permission charged: %v", perms[:2])
+	}
+	if pm.CheckPermission(keyID, alice, PermissionSign, 200) || pm.UsePermission(keyID, alice, PermissionSign, 200) == nil {
+		t.Error("exhausted permission still usable")
+	}
+	// Revoking a single type removes the plain grant and narrows the combined
+	// one, keeping its counters
+	if err := pm.RevokePermission(keyID, alice, PermissionSign); err != nil {
+		t.Fatal(err)
+	}
+	want := []Permission{grants[3], {Grantee: alice, Type: PermissionDecrypt, MaxUses: 1, UsedCount: 1}, {Grantee: bob, Type: permissionTypeMask}}
+	if perms, _ := pm.GetPermissions(keyID); !reflect.DeepEqual(perms, want) {
+		t.Errorf("permissions after narrowing: got %v, want %v", perms, want)
+	}
+	if err := pm.RevokePermission(keyID, alice, PermissionDecrypt); err != nil {
+		t.Fatal(err)
+	}
+	// Revoking a type of the wildcard grant keeps the other types
+	if err := pm.RevokePermission(keyID, bob, PermissionDecrypt); err != nil {
+		t.Fatal(err)
+	}
+	if pm.CheckPermission(keyID, bob, PermissionDecrypt, 0) || !pm.CheckPermission(keyID, bob, PermissionDerive, 0) {
+		t.Error("wildcard grant not narrowed")
+	}
+	if err := pm.RevokePermission(keyID, bob, all); err != nil {
+		t.Fatal(err)
+	}
+	if perms, _ := pm.GetPermissions(keyID); len(perms) != 0 {
+		t.Errorf("permissions left after revoking all: %v", perms)
+	}
+	if err := pm.GrantPermission(keyID, Permission{Grantee: bob, Type: PermissionDecrypt}); err != nil {
+		t.Fatal(err)
+	}
+	if perms, _ := pm.GetPermissions(keyID); len(perms) != 1 {
+		t.Errorf("stale index after revoking all: %v", perms)
+	}
+}
+
+// Tests that contracts grant permissions on their keys through the precompile,
+// and that grants in a reverted frame are undone with the state.
+func TestSGXGrantPermission(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		grantee  = common.Address{0xaa}
+	)
+	for _, end := range []OpCode{RETURN, REVERT} {
+		keys := newSGXTestKeyStore(t)
+		keyID, err := keys.CreateKey(contract, KeyTypeECDSA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := append(keyID.Bytes(), grantee.Bytes()...)
+		input = append(input, byte(PermissionSign))
+		input = binary.BigEndian.AppendUint64(input, 0)
+		input = binary.BigEndian.AppendUint64(input, 5)
+		evm, _ := newSGXTestEVM(t, keys, sgxGrantPermissionAddr, input, end)
+
+		ret, _, err := evm.Call(common.Address{0x01}, contract, nil, 1_000_000, new(uint256.Int))
+		if end == RETURN && (err != nil || ret[0] != 0x01) {
+			t.Fatalf("grant failed: ret %x, err %v", ret, err)
+		}
+		perms, _ := NewStatePermissionManager(evm.StateDB).GetPermissions(keyID)
+		switch {
+		case end == RETURN && !reflect.DeepEqual(perms, []Permission{{Grantee: grantee, Type: PermissionSign, MaxUses: 5}}):
+			t.Errorf("granted permissions: %v", perms)
+		case end == REVERT && len(perms) != 0:
+			t.Errorf("permission granted in reverted frame remains: %v", perms)
+		}
+	}
+}
+
+func TestSGXPermissionPrecompileAuth(t *testing.T) {
+	var (
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		keys       = newSGXTestKeyStore(t)
+		owner      = common.Address{0x01}
+		admin      = common.Address{0x02}
+		other      = common.Address{0x03}
+	)
+	keyID, err := keys.CreateKey(owner, KeyTypeECDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := func(caller common.Address) *SGXContext {
+		return &SGXContext{Caller: caller, KeyStore: keys, PermissionManager: NewStatePermissionManager(statedb)}
+	}
+	grant := func(grantee common.Address, permType PermissionType) []byte {
+		return append(append(keyID.Bytes(), grantee.Bytes()...), append([]byte{byte(permType)}, make([]byte, 16)...)...)
+	}
+	revoke := func(grantee common.Address, permType PermissionType) []byte {
+		return append(append(keyID.Bytes(), grantee.Bytes()...), byte(permType))
+	}
+	if _, err := new(SGXGrantPermission).RunWithContext(ctx(other), grant(other, PermissionSign)); err == nil {
+		t.Fatal("permission granted by a stranger")
+	}
+	if _, err := new(SGXGrantPermission).RunWithContext(ctx(owner), grant(admin, PermissionAdmin)); err != nil {
+		t.Fatal(err)
+	}
+	// Admins manage all permissions but admin ones
+	if _, err := new(SGXGrantPermission).RunWithContext(ctx(admin), grant(other, PermissionSign)); err != nil {
+		t.Fatalf("admin failed to grant: %v", err)
+	}
+	if _, err := new(SGXGrantPermission).RunWithContext(ctx(admin), grant(other, PermissionAdmin)); err == nil {
+		t.Error("admin granted admin permission")
+	}
+	if _, err := new(SGXRevokePermission).RunWithContext(ctx(admin), revoke(other, PermissionSign)); err != nil {
+		t.Errorf("admin failed to revoke: %v", err)
+	}
+	if _, err := new(SGXRevokePermission).RunWithContext(ctx(admin), revoke(admin, PermissionAdmin)); err == nil {
+		t.Error("admin revoked admin permission")
+	}
+	// No changes in read-only mode
+	readOnly := ctx(owner)
+	readOnly.IsReadOnly = true
+	if _, err := new(SGXRevokePermission).RunWithContext(readOnly, revoke(admin, PermissionAdmin)); err == nil {
+		t.Error("permission revoked in read-only mode")
+	}
+}
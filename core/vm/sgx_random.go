@@ -17,60 +17,142 @@
 package vm
 
 import (
-	"crypto/rand"
 	"encoding/binary"
 	"errors"
-	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 )
 
-// SGXRandom is the precompiled contract for secure random number generation (0x8005)
-type SGXRandom struct{}
+// The SGX random precompiles expand the verifiable randomness of the block,
+// a VRF output of the producer enclave committed to the header mix digest,
+// with the transaction hash, the index of the SGX precompile call within the
+// transaction and the caller. Every node executing the block obtains the same
+// output, which nobody can predict before the block is sealed.
 
-// Name returns the name of the contract
-func (c *SGXRandom) Name() string {
-	return "SGXRandom"
+var sgxRandomDomain = []byte("sgx-random-v1")
+
+// sgxRandomLength parses and validates the requested output length.
+func sgxRandomLength(input []byte) (uint64, error) {
+	if len(input) < 32 {
+		return 0, errors.New("invalid input: missing length")
+	}
+	// Extract length (big-endian uint256)
+	length := binary.BigEndian.Uint64(input[24:32])
+
+	// Validate length (limit to max 1KB)
+	if length > 1024 {
+		return 0, errors.New("requested length too large (max 1KB)")
+	}
+	if length == 0 {
+		return 0, errors.New("requested length must be greater than 0")
+	}
+	return length, nil
 }
 
-// RequiredGas calculates the required gas
-// Input format: length (32 bytes)
-func (c *SGXRandom) RequiredGas(input []byte) uint64 {
+// sgxRandomGas calculates the gas of a random output request.
+func sgxRandomGas(input []byte, repriced bool) uint64 {
 	if len(input) < 32 {
 		return 1000
 	}
-	
 	// Parse length
 	length := binary.BigEndian.Uint64(input[24:32])
-	
+
 	// Base cost + per-byte cost
+	if repriced {
+		return params.SGXRandomGas + toWordSize(length)*params.SGXRandomWordGas
+	}
 	return 1000 + (length * 100)
 }
 
-// Run executes the contract (no context needed)
+// expandSGXRandomness derives length random bytes for the call described by
+// ctx from the block randomness.
+func expandSGXRandomness(ctx *SGXContext, length uint64) ([]byte, error) {
+	if ctx.Randomness == (common.Hash{}) {
+		return nil, errors.New("block randomness unavailable")
+	}
+	seed := crypto.Keccak256(sgxRandomDomain, ctx.Randomness.Bytes(), ctx.TxHash.Bytes(),
+		binary.BigEndian.AppendUint64(nil, ctx.CallIndex), ctx.Caller.Bytes())
+
+	output := make([]byte, 0, length+common.HashLength)
+	for i := uint64(0); uint64(len(output)) < length; i++ {
+		output = append(output, crypto.Keccak256(seed, binary.BigEndian.AppendUint64(nil, i))...)
+	}
+	return output[:length], nil
+}
+
+// SGXRandom is the precompiled contract for secure random number generation (0x8005)
+type SGXRandom struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
+
+// Name returns the name of the contract
+func (c *SGXRandom) Name() string {
+	return "SGXRandom"
+}
+
+// RequiredGas calculates the required gas
 // Input format: length (32 bytes)
-// Output format: randomBytes (variable length)
+func (c *SGXRandom) RequiredGas(input []byte) uint64 {
+	return sgxRandomGas(input, c.repriced)
+}
+
+// Run executes the contract (requires context)
 func (c *SGXRandom) Run(input []byte) ([]byte, error) {
-	// 1. Parse input
-	if len(input) < 32 {
-		return nil, errors.New("invalid input: missing length")
-	}
-	
-	// Extract length (big-endian uint256)
-	length := binary.BigEndian.Uint64(input[24:32])
-	
-	// 2. Validate length (limit to max 1KB)
-	if length > 1024 {
-		return nil, errors.New("requested length too large (max 1KB)")
+	return nil, errors.New("context required")
+}
+
+// RunWithContext executes the contract with SGX context
+// Input format: length (32 bytes)
+// Output format: randomBytes (variable length)
+func (c *SGXRandom) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
+	length, err := sgxRandomLength(input)
+	if err != nil {
+		return nil, err
 	}
-	if length == 0 {
-		return nil, errors.New("requested length must be greater than 0")
+	return expandSGXRandomness(ctx, length)
+}
+
+// SGXRandomProof is the precompiled contract for random number generation
+// with the inputs needed to verify the output off-chain (0x800b). Together
+// with the VRF proof in the block header, anyone can recompute the output.
+type SGXRandomProof struct {
+	repriced bool // Gas schedule of the SGX gas fork
+}
+
+// Name returns the name of the contract
+func (c *SGXRandomProof) Name() string {
+	return "SGXRandomProof"
+}
+
+// RequiredGas calculates the required gas
+// Input format: length (32 bytes)
+func (c *SGXRandomProof) RequiredGas(input []byte) uint64 {
+	return sgxRandomGas(input, c.repriced)
+}
+
+// Run executes the contract (requires context)
+func (c *SGXRandomProof) Run(input []byte) ([]byte, error) {
+	return nil, errors.New("context required")
+}
+
+// RunWithContext executes the contract with SGX context
+// Input format: length (32 bytes)
+// Output format: blockRandomness (32 bytes) + txHash (32 bytes) +
+// callIndex (32 bytes) + randomBytes (variable length)
+func (c *SGXRandomProof) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
+	length, err := sgxRandomLength(input)
+	if err != nil {
+		return nil, err
 	}
-	
-	// 3. Generate random bytes
-	randomBytes := make([]byte, length)
-	if _, err := io.ReadFull(rand.Reader, randomBytes); err != nil {
+	random, err := expandSGXRandomness(ctx, length)
+	if err != nil {
 		return nil, err
 	}
-	
-	// 4. Return random bytes
-	return randomBytes, nil
+	output := make([]byte, 0, 3*common.HashLength+len(random))
+	output = append(output, ctx.Randomness.Bytes()...)
+	output = append(output, ctx.TxHash.Bytes()...)
+	output = append(output, common.LeftPadBytes(binary.BigEndian.AppendUint64(nil, ctx.CallIndex), 32)...)
+	return append(output, random...), nil
 }
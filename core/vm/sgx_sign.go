@@ -20,10 +20,14 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXSign is the precompiled contract for ECDSA signing (0x8002)
-type SGXSign struct{}
+type SGXSign struct {
+	repriced bool // Gas schedule of the SGX gas fork
+	tagged   bool // Key-type-tagged output of the SGX key types fork
+}
 
 // Name returns the name of the contract
 func (c *SGXSign) Name() string {
@@ -31,9 +35,18 @@ func (c *SGXSign) Name() string {
 }
 
 // RequiredGas calculates the required gas
-// Input format: keyID (32 bytes) + hash (32 bytes)
+// Input format: keyID (32 bytes) + hash (32 bytes) [+ partial signatures]
 func (c *SGXSign) RequiredGas(input []byte) uint64 {
-	return 10000
+	// Verifying a partial signature of a threshold key costs about four
+	// point multiplications
+	partials := uint64(0)
+	if len(input) > 64 {
+		partials = uint64((len(input) - 64) / thresholdPartialLength)
+	}
+	if !c.repriced {
+		return 10000 + partials*15000
+	}
+	return params.SGXSignGas + partials*params.SGXSignPartialGas
 }
 
 // Run executes the contract (requires context)
@@ -44,6 +57,15 @@ func (c *SGXSign) Run(input []byte) ([]byte, error) {
 // RunWithContext executes the contract with SGX context
 // Input format: keyID (32 bytes) + hash (32 bytes)
 // Output format: signature (65 bytes for ECDSA, 64 bytes for Ed25519)
+//
+// Threshold keys are signed in two calls. Without partial signatures the call
+// records a signature request and returns 0x01. Once the share holders have
+// signed the request, anyone may call with their partial signatures appended
+// (index (1 byte) + D ++ E (66 bytes) + z (32 bytes) each, ascending by index) to
+// get the combined signature R (33 bytes) + z (32 bytes).
+//
+// From the SGX key types fork on, P-256 keys sign too and signatures are
+// prefixed with the key type (1 byte), see sgx_curves.go for the encodings.
 func (c *SGXSign) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error) {
 	// 1. Check if in read-only mode
 	if ctx.IsReadOnly {
@@ -58,19 +80,30 @@ func (c *SGXSign) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error)
 	hash := input[32:64]
 	
 	// 3. Get key metadata and check ownership
-	metadata, err := ctx.KeyStore.GetMetadata(keyID)
+	metadata, err := keyMetadata(ctx, keyID)
 	if err != nil {
 		return nil, err
 	}
+	if metadata.KeyType == KeyTypeThreshold && len(input) > 64 {
+		signature, err := combineThresholdSign(ctx, keyID, hash, input[64:])
+		if err != nil || !c.tagged {
+			return signature, err
+		}
+		return append([]byte{byte(KeyTypeThreshold)}, signature...), nil
+	}
 	
-	// SECURITY: Only owner can sign
-	if metadata.Owner != ctx.Caller {
-		return nil, errors.New("permission denied: only key owner can sign")
+	// SECURITY: Only the owner or a grantee with signing permission can sign
+	if !authorizeKeyUse(ctx, metadata, PermissionSign) {
+		return nil, errors.New("permission denied: caller is neither key owner nor granted signing")
 	}
 	
 	// 4. Check key type
-	if metadata.KeyType != KeyTypeECDSA && metadata.KeyType != KeyTypeEd25519 {
-		return nil, errors.New("key type must be ECDSA or Ed25519 for signing")
+	if metadata.KeyType == KeyTypeThreshold {
+		setThresholdSignRequest(ctx.StateDB, keyID, hash, true)
+		return []byte{0x01}, nil
+	}
+	if metadata.KeyType != KeyTypeECDSA && metadata.KeyType != KeyTypeEd25519 && (metadata.KeyType != KeyTypeP256 || !c.tagged) {
+		return nil, errors.New("key type must be ECDSA, Ed25519 or P-256 for signing")
 	}
 	
 	// 5. Execute signing
@@ -80,5 +113,23 @@ func (c *SGXSign) RunWithContext(ctx *SGXContext, input []byte) ([]byte, error)
 	}
 	
 	// 6. Return signature
+	if c.tagged {
+		return append([]byte{byte(metadata.KeyType)}, signature...), nil
+	}
+	return signature, nil
+}
+
+// combineThresholdSign combines the partial signatures of a requested
+// threshold signature and consumes the request.
+func combineThresholdSign(ctx *SGXContext, keyID common.Hash, hash []byte, partials []byte) ([]byte, error) {
+	if !ThresholdSignRequested(ctx.StateDB, keyID, hash) {
+		return nil, errors.New("threshold signature not requested")
+	}
+	_, params, _ := thresholdKey(ctx.StateDB, keyID)
+	signature, err := CombineThresholdSignature(params, hash, partials)
+	if err != nil {
+		return nil, err
+	}
+	setThresholdSignRequest(ctx.StateDB, keyID, hash, false)
 	return signature, nil
 }
@@ -0,0 +1,698 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Threshold keys (KeyTypeThreshold) are secp256k1 keys whose secret is split
+// among attested nodes with Shamir's scheme, none of which holds the whole
+// key. The dealing enclave publishes Feldman commitments to the polynomial,
+// the first of which is the group public key, and signs them with the dealer
+// key of the network, derived from the master secret. SGXKeyCreate registers
+// the commitments on chain only with that signature, so every registered key
+// was dealt by an attested node. Each node verifies its share against the
+// commitments.
+//
+// Signatures are Schnorr signatures produced with FROST by any threshold
+// sized set of share holders:
+//
+//	round 1: signer i publishes D_i = d_i*G and E_i = e_i*G
+//	round 2: signer i publishes z_i = d_i + e_i*ρ_i + λ_i*c*s_i
+//	ρ_i = keccak256("sgx-threshold-binding" ++ P ++ hash ++ B ++ i)
+//	R = Σ(D_i + ρ_i*E_i), c = keccak256("sgx-schnorr-v1" ++ R ++ P ++ hash), z = Σz_i
+//
+// where B is the list of all signers' commitments. The binding factors ρ_i
+// tie every signature share to the full commitment list, and the nonces d_i,
+// e_i are random and erased after their first use, so a share is never used
+// with the same nonces for two different challenges.
+//
+// Contracts request a signature through SGXSign, the share holders sign
+// requested messages only, and anyone submits the partial signatures to
+// SGXSign, which verifies and combines them deterministically.
+
+// ThresholdSignatureLength is the length of a threshold signature, R (33
+// bytes, compressed) followed by z (32 bytes).
+const ThresholdSignatureLength = 33 + 32
+
+// ThresholdCommitmentLength is the length of the nonce commitment of a signer,
+// D_i followed by E_i (33 bytes each, compressed).
+const ThresholdCommitmentLength = 33 + 33
+
+// thresholdPartialLength is the length of an encoded partial signature:
+// signer index (1 byte), D_i ++ E_i (66 bytes) and z_i (32 bytes).
+const thresholdPartialLength = 1 + ThresholdCommitmentLength + 32
+
+// maxPendingNonces is the number of signing sessions a key store keeps nonces
+// for. Older sessions are dropped and have to start over.
+const maxPendingNonces = 1024
+
+var (
+	thresholdKeyDomain     = []byte("sgx-threshold-key")
+	thresholdRequestDomain = []byte("sgx-threshold-request")
+	thresholdNonceDomain   = []byte("sgx-threshold-nonce")
+	thresholdBindingDomain = []byte("sgx-threshold-binding")
+	thresholdDealerDomain  = []byte("sgx-threshold-dealer")
+	schnorrDomain          = []byte("sgx-schnorr-v1")
+)
+
+var (
+	errInvalidThresholdParams = errors.New("invalid threshold key parameters")
+	errInvalidKeyShare        = errors.New("invalid key share")
+	errInvalidSignerSet       = errors.New("invalid signer set")
+	errInvalidPartial         = errors.New("invalid partial signature")
+	errUnknownNonces          = errors.New("unknown or used signing nonces")
+	errInvalidDealer          = errors.New("threshold key not dealt by an attested node")
+)
+
+// ThresholdDealer is implemented by key stores holding the dealer key of the
+// network, which authenticates the registration of threshold keys.
+type ThresholdDealer interface {
+	// DealerAddress returns the address of the dealer key of the chain.
+	DealerAddress(chainID *big.Int) (common.Address, error)
+}
+
+// deriveDealerKey derives the dealer key of the chain from the master secret.
+func deriveDealerKey(masterSecret []byte, chainID *big.Int) (*ecdsa.PrivateKey, error) {
+	return deriveNetworkKey(masterSecret, chainID, "sgx-threshold-dealer")
+}
+
+// deriveNetworkKey derives a secp256k1 key of the chain, shared by all attested
+// nodes, from the master secret using HKDF-SHA256.
+func deriveNetworkKey(masterSecret []byte, chainID *big.Int, label string) (*ecdsa.PrivateKey, error) {
+	if len(masterSecret) != MasterSecretLength {
+		return nil, ErrNoMasterSecret
+	}
+	if chainID == nil {
+		chainID = new(big.Int)
+	}
+	info := append([]byte(label), common.BigToHash(chainID).Bytes()...)
+
+	seed := make([]byte, 32)
+	defer zeroBytes(seed)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, masterSecret, nil, info), seed); err != nil {
+		return nil, fmt.Errorf("failed to derive %s: %w", label, err)
+	}
+	return crypto.ToECDSA(seed)
+}
+
+// ThresholdRegistrationHash returns the hash the dealer signs to authorize the
+// registration of a threshold key by owner.
+func ThresholdRegistrationHash(chainID *big.Int, owner common.Address, params *ThresholdParams) []byte {
+	if chainID == nil {
+		chainID = new(big.Int)
+	}
+	return crypto.Keccak256(thresholdDealerDomain, common.BigToHash(chainID).Bytes(), owner.Bytes(), params.Encode())
+}
+
+// verifyThresholdDealer checks that the registration of a threshold key by
+// owner is signed by the dealer key of the chain.
+func verifyThresholdDealer(dealer ThresholdDealer, chainID *big.Int, owner common.Address, params *ThresholdParams, signature []byte) error {
+	want, err := dealer.DealerAddress(chainID)
+	if err != nil {
+		return err
+	}
+	pub, err := crypto.SigToPub(ThresholdRegistrationHash(chainID, owner, params), signature)
+	if err != nil || crypto.PubkeyToAddress(*pub) != want {
+		return errInvalidDealer
+	}
+	return nil
+}
+
+// sgxSignAddress is the account whose storage holds the threshold signature
+// requests, the address of the signing precompile.
+var sgxSignAddress = common.BytesToAddress([]byte{0x80, 0x02})
+
+// ThresholdParams are the public parameters of a threshold key.
+type ThresholdParams struct {
+	Threshold   uint8    // Number of shares needed to sign
+	Commitments [][]byte // Compressed commitments to the polynomial coefficients
+}
+
+// GroupKey returns the compressed group public key.
+func (p *ThresholdParams) GroupKey() []byte {
+	return p.Commitments[0]
+}
+
+// KeyID returns the ID of the threshold key.
+func (p *ThresholdParams) KeyID() common.Hash {
+	return crypto.Keccak256Hash(p.GroupKey())
+}
+
+// validate checks that the parameters are well-formed.
+func (p *ThresholdParams) validate() error {
+	if p.Threshold == 0 || len(p.Commitments) != int(p.Threshold) {
+		return fmt.Errorf("%w: threshold %d with %d commitments", errInvalidThresholdParams, p.Threshold, len(p.Commitments))
+	}
+	for _, c := range p.Commitments {
+		if len(c) != 33 {
+			return fmt.Errorf("%w: commitment length %d", errInvalidThresholdParams, len(c))
+		}
+		if _, err := crypto.DecompressPubkey(c); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidThresholdParams, err)
+		}
+	}
+	return nil
+}
+
+// Encode returns threshold (1 byte) followed by the commitments.
+func (p *ThresholdParams) Encode() []byte {
+	data := []byte{p.Threshold}
+	for _, c := range p.Commitments {
+		data = append(data, c...)
+	}
+	return data
+}
+
+// decodeThresholdParams parses and validates encoded threshold parameters.
+func decodeThresholdParams(data []byte) (*ThresholdParams, error) {
+	if len(data) < 1 || len(data) != 1+33*int(data[0]) {
+		return nil, fmt.Errorf("%w: length %d", errInvalidThresholdParams, len(data))
+	}
+	p := &ThresholdParams{Threshold: data[0]}
+	for i := 0; i < int(p.Threshold); i++ {
+		p.Commitments = append(p.Commitments, common.CopyBytes(data[1+33*i:34+33*i]))
+	}
+	return p, p.validate()
+}
+
+// publicShare returns the public key of the share with the given index.
+func (p *ThresholdParams) publicShare(index uint8) (*big.Int, *big.Int) {
+	var (
+		curve = crypto.S256()
+		x, y  *big.Int
+		power = big.NewInt(1)
+		i     = big.NewInt(int64(index))
+	)
+	for _, c := range p.Commitments {
+		point, _ := crypto.DecompressPubkey(c)
+		px, py := curve.ScalarMult(point.X, point.Y, math.PaddedBigBytes(power, 32))
+		if x == nil {
+			x, y = px, py
+		} else {
+			x, y = curve.Add(x, y, px, py)
+		}
+		power.Mul(power, i)
+		power.Mod(power, curve.Params().N)
+	}
+	return x, y
+}
+
+// KeyShare is one node's share of a threshold key.
+type KeyShare struct {
+	Index  uint8    // Share index, the polynomial is evaluated at Index
+	Value  *big.Int // Secret share
+	Params ThresholdParams
+}
+
+// Encode serializes the share: index (1 byte), value (32 bytes) and the
+// threshold parameters.
+func (s *KeyShare) Encode() []byte {
+	data := append([]byte{s.Index}, math.PaddedBigBytes(s.Value, 32)...)
+	return append(data, s.Params.Encode()...)
+}
+
+// DecodeKeyShare parses a share and verifies it against its commitments.
+func DecodeKeyShare(data []byte) (*KeyShare, error) {
+	if len(data) < 34 {
+		return nil, fmt.Errorf("%w: length %d", errInvalidKeyShare, len(data))
+	}
+	params, err := decodeThresholdParams(data[33:])
+	if err != nil {
+		return nil, err
+	}
+	share := &KeyShare{Index: data[0], Value: new(big.Int).SetBytes(data[1:33]), Params: *params}
+	return share, share.verify()
+}
+
+// verify checks the share against the commitments of its parameters.
+func (s *KeyShare) verify() error {
+	curve := crypto.S256()
+	if s.Index == 0 || s.Value.Sign() == 0 || s.Value.Cmp(curve.Params().N) >= 0 {
+		return errInvalidKeyShare
+	}
+	x, y := curve.ScalarBaseMult(math.PaddedBigBytes(s.Value, 32))
+	px, py := s.Params.publicShare(s.Index)
+	if x.Cmp(px) != 0 || y.Cmp(py) != 0 {
+		return fmt.Errorf("%w: share %d does not match the commitments", errInvalidKeyShare, s.Index)
+	}
+	return nil
+}
+
+// SplitThresholdKey splits a secret into shares with indices 1..shares, any
+// threshold of which can sign.
+func SplitThresholdKey(secret []byte, threshold, shares uint8, rand io.Reader) (*ThresholdParams, []*KeyShare, error) {
+	n := crypto.S256().Params().N
+	if threshold == 0 || threshold > shares {
+		return nil, nil, fmt.Errorf("%w: %d of %d", errInvalidThresholdParams, threshold, shares)
+	}
+	key, err := crypto.ToECDSA(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	coefficients := []*big.Int{key.D}
+	for len(coefficients) < int(threshold) {
+		c, err := ecdsa.GenerateKey(crypto.S256(), rand)
+		if err != nil {
+			return nil, nil, err
+		}
+		coefficients = append(coefficients, c.D)
+	}
+	params := &ThresholdParams{Threshold: threshold}
+	for _, c := range coefficients {
+		x, y := crypto.S256().ScalarBaseMult(math.PaddedBigBytes(c, 32))
+		params.Commitments = append(params.Commitments, compressPoint(x, y))
+	}
+	result := make([]*KeyShare, 0, shares)
+	for i := 1; i <= int(shares); i++ {
+		// Horner evaluation of the polynomial at i
+		value := new(big.Int)
+		for j := len(coefficients) - 1; j >= 0; j-- {
+			value.Mul(value, big.NewInt(int64(i)))
+			value.Add(value, coefficients[j])
+			value.Mod(value, n)
+		}
+		result = append(result, &KeyShare{Index: uint8(i), Value: value, Params: *params})
+	}
+	return params, result, nil
+}
+
+func compressPoint(x, y *big.Int) []byte {
+	return crypto.CompressPubkey(&ecdsa.PublicKey{Curve: crypto.S256(), X: x, Y: y})
+}
+
+// checkSignerSet checks that the signers are strictly ascending and at least
+// threshold many.
+func checkSignerSet(signers []uint8, threshold uint8) error {
+	if len(signers) < int(threshold) {
+		return fmt.Errorf("%w: %d signers, threshold %d", errInvalidSignerSet, len(signers), threshold)
+	}
+	for i, index := range signers {
+		if index == 0 || (i > 0 && index <= signers[i-1]) {
+			return fmt.Errorf("%w: signers must be ascending non-zero indices", errInvalidSignerSet)
+		}
+	}
+	return nil
+}
+
+// lagrangeCoefficient returns the coefficient of signer i at zero.
+func lagrangeCoefficient(i uint8, signers []uint8) *big.Int {
+	var (
+		n   = crypto.S256().Params().N
+		num = big.NewInt(1)
+		den = big.NewInt(1)
+	)
+	for _, j := range signers {
+		if j == i {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(j)))
+		num.Mod(num, n)
+		den.Mul(den, new(big.Int).Sub(big.NewInt(int64(j)), big.NewInt(int64(i))))
+		den.Mod(den, n)
+	}
+	return num.Mul(num, den.ModInverse(den, n)).Mod(num, n)
+}
+
+// schnorrChallenge computes the challenge of a Schnorr signature.
+func schnorrChallenge(r []byte, groupKey []byte, hash []byte) *big.Int {
+	c := new(big.Int).SetBytes(crypto.Keccak256(schnorrDomain, r, groupKey, hash))
+	return c.Mod(c, crypto.S256().Params().N)
+}
+
+// SigningNonces are the secret nonces of a share for one signing session.
+type SigningNonces struct {
+	hiding, binding *big.Int
+	commitment      []byte // D_i ++ E_i
+}
+
+// Commitment returns the public commitment to the nonces.
+func (n *SigningNonces) Commitment() []byte { return n.commitment }
+
+// erase clears the nonces after their use.
+func (n *SigningNonces) erase() {
+	n.hiding.SetInt64(0)
+	n.binding.SetInt64(0)
+	n.hiding, n.binding = nil, nil
+}
+
+// nonce generates a signing nonce from fresh randomness, hedged with the share
+// against a weak random source.
+func (s *KeyShare) nonce(rand io.Reader) (*big.Int, error) {
+	random := make([]byte, 32)
+	if _, err := io.ReadFull(rand, random); err != nil {
+		return nil, err
+	}
+	secret := math.PaddedBigBytes(s.Value, 32)
+	defer clear(secret)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(thresholdNonceDomain)
+	mac.Write(random)
+	r := new(big.Int).SetBytes(mac.Sum(nil))
+	if r.Mod(r, crypto.S256().Params().N).Sign() == 0 {
+		return nil, errors.New("zero nonce")
+	}
+	return r, nil
+}
+
+// Commit generates the nonces of the share for a new signing session and
+// returns them with their commitment D_i ++ E_i (round 1). The nonces can be
+// used for a single partial signature.
+func (s *KeyShare) Commit(rand io.Reader) (*SigningNonces, error) {
+	hiding, err := s.nonce(rand)
+	if err != nil {
+		return nil, err
+	}
+	binding, err := s.nonce(rand)
+	if err != nil {
+		return nil, err
+	}
+	curve := crypto.S256()
+	dx, dy := curve.ScalarBaseMult(math.PaddedBigBytes(hiding, 32))
+	ex, ey := curve.ScalarBaseMult(math.PaddedBigBytes(binding, 32))
+	return &SigningNonces{
+		hiding:     hiding,
+		binding:    binding,
+		commitment: append(compressPoint(dx, dy), compressPoint(ex, ey)...),
+	}, nil
+}
+
+// encodeCommitments returns the commitment list B: index (1 byte) followed by
+// D_i ++ E_i for every signer, in ascending signer order.
+func encodeCommitments(signers []uint8, commitments [][]byte) []byte {
+	list := make([]byte, 0, len(signers)*(1+ThresholdCommitmentLength))
+	for i, index := range signers {
+		list = append(list, index)
+		list = append(list, commitments[i]...)
+	}
+	return list
+}
+
+// bindingFactor returns the binding factor ρ_i of a signer.
+func bindingFactor(groupKey []byte, hash []byte, list []byte, index uint8) *big.Int {
+	rho := new(big.Int).SetBytes(crypto.Keccak256(thresholdBindingDomain, groupKey, hash, list, []byte{index}))
+	return rho.Mod(rho, crypto.S256().Params().N)
+}
+
+// groupCommitment returns the commitments R_i = D_i + ρ_i*E_i of the signers
+// and the group commitment R = ΣR_i, compressed.
+func groupCommitment(groupKey []byte, hash []byte, signers []uint8, commitments [][]byte) ([][2]*big.Int, []byte, error) {
+	var (
+		curve  = crypto.S256()
+		list   = encodeCommitments(signers, commitments)
+		shares = make([][2]*big.Int, len(signers))
+		x, y   *big.Int
+	)
+	for i, index := range signers {
+		if len(commitments[i]) != ThresholdCommitmentLength {
+			return nil, nil, fmt.Errorf("%w: commitment of signer %d", errInvalidPartial, index)
+		}
+		d, err := crypto.DecompressPubkey(commitments[i][:33])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errInvalidPartial, err)
+		}
+		e, err := crypto.DecompressPubkey(commitments[i][33:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errInvalidPartial, err)
+		}
+		rho := bindingFactor(groupKey, hash, list, index)
+		bx, by := curve.ScalarMult(e.X, e.Y, math.PaddedBigBytes(rho, 32))
+		rx, ry := curve.Add(d.X, d.Y, bx, by)
+		shares[i] = [2]*big.Int{rx, ry}
+		if x == nil {
+			x, y = rx, ry
+		} else {
+			x, y = curve.Add(x, y, rx, ry)
+		}
+	}
+	if x == nil || (x.Sign() == 0 && y.Sign() == 0) {
+		return nil, nil, errInvalidPartial
+	}
+	return shares, compressPoint(x, y), nil
+}
+
+// PartialSign returns the encoded partial signature of the share (round 2),
+// given the commitments of all signers in ascending signer order. The nonces
+// must be the ones committed to for the share and are erased, so that they
+// are never used for another challenge.
+func (s *KeyShare) PartialSign(nonces *SigningNonces, hash []byte, signers []uint8, commitments [][]byte) ([]byte, error) {
+	if nonces == nil || nonces.hiding == nil {
+		return nil, errUnknownNonces
+	}
+	if err := checkSignerSet(signers, s.Params.Threshold); err != nil {
+		return nil, err
+	}
+	if len(commitments) != len(signers) {
+		return nil, fmt.Errorf("%w: %d commitments for %d signers", errInvalidSignerSet, len(commitments), len(signers))
+	}
+	position := slices.Index(signers, s.Index)
+	if position < 0 {
+		return nil, fmt.Errorf("%w: share %d not a signer", errInvalidSignerSet, s.Index)
+	}
+	if !bytes.Equal(commitments[position], nonces.commitment) {
+		return nil, fmt.Errorf("%w: commitment of share %d differs", errInvalidPartial, s.Index)
+	}
+	groupKey := s.Params.GroupKey()
+	_, r, err := groupCommitment(groupKey, hash, signers, commitments)
+	if err != nil {
+		return nil, err
+	}
+	defer nonces.erase()
+
+	n := crypto.S256().Params().N
+	c := schnorrChallenge(r, groupKey, hash)
+	z := c.Mul(c, lagrangeCoefficient(s.Index, signers))
+	z.Mul(z, s.Value)
+	z.Add(z, nonces.hiding)
+	rho := bindingFactor(groupKey, hash, encodeCommitments(signers, commitments), s.Index)
+	z.Add(z, rho.Mul(rho, nonces.binding))
+	z.Mod(z, n)
+
+	partial := append([]byte{s.Index}, nonces.commitment...)
+	return append(partial, math.PaddedBigBytes(z, 32)...), nil
+}
+
+// CombineThresholdSignature verifies the encoded partial signatures, ordered
+// by ascending signer index, and combines them into a Schnorr signature of
+// the group key. The commitments of the partial signatures form the list the
+// signers were bound to. The result only depends on the inputs.
+func CombineThresholdSignature(params *ThresholdParams, hash []byte, partials []byte) ([]byte, error) {
+	if len(partials) == 0 || len(partials)%thresholdPartialLength != 0 {
+		return nil, fmt.Errorf("%w: length %d", errInvalidPartial, len(partials))
+	}
+	var (
+		count       = len(partials) / thresholdPartialLength
+		signers     = make([]uint8, count)
+		commitments = make([][]byte, count)
+		curve       = crypto.S256()
+		n           = curve.Params().N
+	)
+	for i := 0; i < count; i++ {
+		p := partials[i*thresholdPartialLength:]
+		signers[i], commitments[i] = p[0], p[1:1+ThresholdCommitmentLength]
+	}
+	if err := checkSignerSet(signers, params.Threshold); err != nil {
+		return nil, err
+	}
+	shares, r, err := groupCommitment(params.GroupKey(), hash, signers, commitments)
+	if err != nil {
+		return nil, err
+	}
+	c := schnorrChallenge(r, params.GroupKey(), hash)
+	z := new(big.Int)
+	for i, index := range signers {
+		zi := new(big.Int).SetBytes(partials[(i+1)*thresholdPartialLength-32 : (i+1)*thresholdPartialLength])
+		if zi.Cmp(n) >= 0 {
+			return nil, fmt.Errorf("%w: signer %d", errInvalidPartial, index)
+		}
+		// z_i*G == R_i + λ_i*c*Y_i
+		weight := new(big.Int).Mul(c, lagrangeCoefficient(index, signers))
+		weight.Mod(weight, n)
+		yx, yy := params.publicShare(index)
+		wx, wy := curve.ScalarMult(yx, yy, math.PaddedBigBytes(weight, 32))
+		ex, ey := curve.Add(shares[i][0], shares[i][1], wx, wy)
+		zx, zy := curve.ScalarBaseMult(math.PaddedBigBytes(zi, 32))
+		if zx.Cmp(ex) != 0 || zy.Cmp(ey) != 0 {
+			return nil, fmt.Errorf("%w: signer %d", errInvalidPartial, index)
+		}
+		z.Add(z, zi)
+	}
+	z.Mod(z, n)
+	return append(r, math.PaddedBigBytes(z, 32)...), nil
+}
+
+// thresholdSessions keeps the nonces of the pending signing sessions of a key
+// store, until they are used for a partial signature.
+type thresholdSessions struct {
+	lock   sync.Mutex
+	nonces map[string]*SigningNonces
+}
+
+func newThresholdSessions() *thresholdSessions {
+	return &thresholdSessions{nonces: make(map[string]*SigningNonces)}
+}
+
+func thresholdSessionKey(keyID common.Hash, hash []byte, commitment []byte) string {
+	return string(keyID.Bytes()) + string(hash) + string(commitment)
+}
+
+// add keeps the nonces of a new session, dropping an arbitrary older one if
+// too many sessions are pending.
+func (s *thresholdSessions) add(keyID common.Hash, hash []byte, nonces *SigningNonces) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.nonces) >= maxPendingNonces {
+		for key, old := range s.nonces {
+			old.erase()
+			delete(s.nonces, key)
+			break
+		}
+	}
+	s.nonces[thresholdSessionKey(keyID, hash, nonces.commitment)] = nonces
+}
+
+// take removes and returns the nonces committed to for a message.
+func (s *thresholdSessions) take(keyID common.Hash, hash []byte, commitment []byte) (*SigningNonces, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := thresholdSessionKey(keyID, hash, commitment)
+	nonces, ok := s.nonces[key]
+	if !ok {
+		return nil, errUnknownNonces
+	}
+	delete(s.nonces, key)
+	return nonces, nil
+}
+
+// VerifyThresholdSignature verifies a Schnorr signature of a compressed group
+// public key.
+func VerifyThresholdSignature(groupKey []byte, hash []byte, signature []byte) bool {
+	if len(signature) != ThresholdSignatureLength {
+		return false
+	}
+	pub, err := crypto.DecompressPubkey(groupKey)
+	if err != nil {
+		return false
+	}
+	r, err := crypto.DecompressPubkey(signature[:33])
+	if err != nil {
+		return false
+	}
+	curve := crypto.S256()
+	z := new(big.Int).SetBytes(signature[33:])
+	if z.Cmp(curve.Params().N) >= 0 {
+		return false
+	}
+	// z*G == R + c*P
+	c := schnorrChallenge(signature[:33], groupKey, hash)
+	cx, cy := curve.ScalarMult(pub.X, pub.Y, math.PaddedBigBytes(c, 32))
+	ex, ey := curve.Add(r.X, r.Y, cx, cy)
+	zx, zy := curve.ScalarBaseMult(math.PaddedBigBytes(z, 32))
+	return zx.Cmp(ex) == 0 && zy.Cmp(ey) == 0
+}
+
+// thresholdKeySlot returns the first storage slot of a registered threshold
+// key in the key nonce account: owner ++ threshold, followed by two slots per
+// commitment.
+func thresholdKeySlot(keyID common.Hash) *big.Int {
+	return crypto.Keccak256Hash(thresholdKeyDomain, keyID.Bytes()).Big()
+}
+
+func slotAt(base *big.Int, offset int) common.Hash {
+	return common.BigToHash(new(big.Int).Add(base, big.NewInt(int64(offset))))
+}
+
+// registerThresholdKey records the owner and parameters of a threshold key.
+func registerThresholdKey(db StateDB, owner common.Address, params *ThresholdParams) {
+	touchSGXAccount(db, sgxKeyNonceAddress)
+
+	base := thresholdKeySlot(params.KeyID())
+	var head common.Hash
+	copy(head[:], owner.Bytes())
+	head[common.AddressLength] = params.Threshold
+	db.SetState(sgxKeyNonceAddress, slotAt(base, 0), head)
+	for i, c := range params.Commitments {
+		db.SetState(sgxKeyNonceAddress, slotAt(base, 1+2*i), common.BytesToHash(c[:32]))
+		db.SetState(sgxKeyNonceAddress, slotAt(base, 2+2*i), common.BytesToHash(c[32:]))
+	}
+}
+
+// thresholdKey returns the owner and parameters of a registered threshold key.
+func thresholdKey(db StateDB, keyID common.Hash) (common.Address, *ThresholdParams, bool) {
+	base := thresholdKeySlot(keyID)
+	head := db.GetState(sgxKeyNonceAddress, slotAt(base, 0))
+	if head == (common.Hash{}) {
+		return common.Address{}, nil, false
+	}
+	params := &ThresholdParams{Threshold: head[common.AddressLength]}
+	for i := 0; i < int(params.Threshold); i++ {
+		hi := db.GetState(sgxKeyNonceAddress, slotAt(base, 1+2*i))
+		lo := db.GetState(sgxKeyNonceAddress, slotAt(base, 2+2*i))
+		params.Commitments = append(params.Commitments, append(hi.Bytes(), lo[31]))
+	}
+	return common.BytesToAddress(head[:common.AddressLength]), params, true
+}
+
+// thresholdRequestSlot returns the storage slot recording a signature request.
+func thresholdRequestSlot(keyID common.Hash, hash []byte) common.Hash {
+	return crypto.Keccak256Hash(thresholdRequestDomain, keyID.Bytes(), hash)
+}
+
+// ThresholdSignRequested reports whether a contract requested a signature of
+// hash with the threshold key in the given state.
+func ThresholdSignRequested(db StateDB, keyID common.Hash, hash []byte) bool {
+	return db.GetState(sgxSignAddress, thresholdRequestSlot(keyID, hash)) != (common.Hash{})
+}
+
+// setThresholdSignRequest records or clears a signature request.
+func setThresholdSignRequest(db StateDB, keyID common.Hash, hash []byte, requested bool) {
+	var value common.Hash
+	if requested {
+		touchSGXAccount(db, sgxSignAddress)
+		value[31] = 0x01
+	}
+	db.SetState(sgxSignAddress, thresholdRequestSlot(keyID, hash), value)
+}
+
+// keyMetadata returns the metadata of a key, registered threshold keys are
+// looked up in the state and all others in the key store.
+func keyMetadata(ctx *SGXContext, keyID common.Hash) (*KeyMetadata, error) {
+	if ctx.StateDB != nil {
+		if owner, _, ok := thresholdKey(ctx.StateDB, keyID); ok {
+			return &KeyMetadata{KeyID: keyID, Owner: owner, KeyType: KeyTypeThreshold, CreatedBy: owner}, nil
+		}
+	}
+	return ctx.KeyStore.GetMetadata(keyID)
+}
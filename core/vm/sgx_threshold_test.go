@@ -0,0 +1,261 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// thresholdTestSign runs both signing rounds with the given shares.
+func thresholdTestSign(t *testing.T, shares []*KeyShare, hash []byte) []byte {
+	t.Helper()
+
+	var (
+		signers     []uint8
+		nonces      []*SigningNonces
+		commitments [][]byte
+	)
+	for _, s := range shares {
+		n, err := s.Commit(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s.Index)
+		nonces = append(nonces, n)
+		commitments = append(commitments, n.Commitment())
+	}
+	var partials []byte
+	for i, s := range shares {
+		partial, err := s.PartialSign(nonces[i], hash, signers, commitments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, partial...)
+	}
+	return partials
+}
+
+func TestThresholdSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	params, shares, err := SplitThresholdKey(crypto.FromECDSA(key), 2, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(params.GroupKey(), crypto.CompressPubkey(&key.PublicKey)) {
+		t.Fatal("group key differs from the split key")
+	}
+	for _, s := range shares {
+		decoded, err := DecodeKeyShare(s.Encode())
+		if err != nil || decoded.Value.Cmp(s.Value) != 0 {
+			t.Fatalf("share %d does not roundtrip: %v", s.Index, err)
+		}
+	}
+	hash := crypto.Keccak256([]byte("message"))
+
+	// Every pair of shares signs, every pair yields a valid signature
+	var signatures [][]byte
+	for _, pair := range [][]*KeyShare{{shares[0], shares[1]}, {shares[0], shares[2]}, {shares[1], shares[2]}, shares} {
+		signature, err := CombineThresholdSignature(params, hash, thresholdTestSign(t, pair, hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyThresholdSignature(params.GroupKey(), hash, signature) {
+			t.Fatalf("signature of %d shares rejected", len(pair))
+		}
+		signatures = append(signatures, signature)
+	}
+	// Aggregation is deterministic
+	partials := thresholdTestSign(t, shares[:2], hash)
+	first, _ := CombineThresholdSignature(params, hash, partials)
+	again, _ := CombineThresholdSignature(params, hash, partials)
+	if !bytes.Equal(again, first) {
+		t.Error("combining the same partial signatures twice differs")
+	}
+	if VerifyThresholdSignature(params.GroupKey(), crypto.Keccak256([]byte("other")), signatures[0]) {
+		t.Error("signature accepted for another message")
+	}
+	// A single share is below the threshold
+	nonces, _ := shares[0].Commit(rand.Reader)
+	if _, err := shares[0].PartialSign(nonces, hash, []uint8{1}, [][]byte{nonces.Commitment()}); !errors.Is(err, errInvalidSignerSet) {
+		t.Errorf("expected errInvalidSignerSet, got %v", err)
+	}
+	// Modified partial signatures are rejected
+	partials[thresholdPartialLength-1] ^= 0x01
+	if _, err := CombineThresholdSignature(params, hash, partials); !errors.Is(err, errInvalidPartial) {
+		t.Errorf("expected errInvalidPartial, got %v", err)
+	}
+	// Shares not matching the commitments are rejected
+	forged := *shares[0]
+	forged.Value = shares[1].Value
+	if _, err := DecodeKeyShare(forged.Encode()); !errors.Is(err, errInvalidKeyShare) {
+		t.Errorf("expected errInvalidKeyShare, got %v", err)
+	}
+}
+
+// Tests that signature shares are bound to the full commitment list and that
+// nonces are used once: a share signed for one list does not combine with the
+// commitments of another, and used nonces sign nothing.
+func TestThresholdNonceBinding(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	params, shares, err := SplitThresholdKey(crypto.FromECDSA(key), 2, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.Keccak256([]byte("message"))
+	n1, _ := shares[0].Commit(rand.Reader)
+	n2, _ := shares[1].Commit(rand.Reader)
+	n2b, _ := shares[1].Commit(rand.Reader)
+
+	signers := []uint8{1, 2}
+	p1, err := shares[0].PartialSign(n1, hash, signers, [][]byte{n1.Commitment(), n2.Commitment()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The nonces are erased after their use
+	if _, err := shares[0].PartialSign(n1, hash, signers, [][]byte{n1.Commitment(), n2b.Commitment()}); !errors.Is(err, errUnknownNonces) {
+		t.Errorf("expected errUnknownNonces, got %v", err)
+	}
+	// A share bound to another commitment list does not combine
+	p2, err := shares[1].PartialSign(n2b, hash, signers, [][]byte{n1.Commitment(), n2b.Commitment()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CombineThresholdSignature(params, hash, append(common.CopyBytes(p1), p2...)); !errors.Is(err, errInvalidPartial) {
+		t.Errorf("expected errInvalidPartial for a share bound to another list, got %v", err)
+	}
+	// A commitment not matching the nonces is refused
+	n3, _ := shares[2].Commit(rand.Reader)
+	if _, err := shares[2].PartialSign(n3, hash, []uint8{1, 3}, [][]byte{n1.Commitment(), n2.Commitment()}); !errors.Is(err, errInvalidPartial) {
+		t.Errorf("expected errInvalidPartial, got %v", err)
+	}
+}
+
+// Tests signing with a threshold key through the precompiles: a node deals the
+// key, the contract registers it and requests a signature, the share holders
+// sign requested messages only, and the combined signature verifies.
+func TestSGXThresholdSign(t *testing.T) {
+	var (
+		statedb, _ = state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+		owner      = common.Address{0x01}
+		other      = common.Address{0x02}
+		chainID    = big.NewInt(1)
+		hash       = crypto.Keccak256([]byte("message"))
+		nodes      = []*EncryptedKeyStore{newSGXTestKeyStore(t), newSGXTestKeyStore(t), newSGXTestKeyStore(t)}
+		create     = &SGXKeyCreate{repriced: true, tagged: true, threshold: true}
+	)
+	ctx := func(caller common.Address) *SGXContext {
+		return &SGXContext{Caller: caller, ChainID: chainID, KeyStore: nodes[0], PermissionManager: NewStatePermissionManager(statedb), StateDB: statedb}
+	}
+	registration, shares, err := nodes[1].DealThresholdKey(chainID, owner, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range shares {
+		if _, err := nodes[i].ImportKeyShare(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	params, err := decodeThresholdParams(registration[1 : len(registration)-crypto.SignatureLength])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the caller the dealer signed for registers the key, and only from
+	// the threshold keys fork on
+	if _, err := create.RunWithContext(ctx(other), registration); !errors.Is(err, errInvalidDealer) {
+		t.Fatalf("expected errInvalidDealer, got %v", err)
+	}
+	if _, err := new(SGXKeyCreate).RunWithContext(ctx(owner), registration); err == nil {
+		t.Fatal("threshold key registered before the fork")
+	}
+	unsigned := append([]byte{byte(KeyTypeThreshold)}, params.Encode()...)
+	if _, err := create.RunWithContext(ctx(owner), append(unsigned, make([]byte, crypto.SignatureLength)...)); err == nil {
+		t.Fatal("threshold key registered without the dealer signature")
+	}
+	ret, err := create.RunWithContext(ctx(owner), registration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := common.BytesToHash(ret)
+	if keyID != params.KeyID() {
+		t.Fatalf("key ID: got %x, want %x", keyID, params.KeyID())
+	}
+	if pub, err := new(SGXKeyGetPublic).RunWithContext(ctx(other), keyID.Bytes()); err != nil || !bytes.Equal(pub, params.GroupKey()) {
+		t.Fatalf("group key: got %x (err %v)", pub, err)
+	}
+	signers := []uint8{1, 3}
+	request := append(keyID.Bytes(), hash...)
+
+	// Nodes do not sign messages that were not requested
+	if _, err := nodes[0].ThresholdCommitment(statedb, keyID, hash); err == nil {
+		t.Fatal("node signed an unrequested message")
+	}
+	if _, err := new(SGXSign).RunWithContext(ctx(other), request); err == nil {
+		t.Fatal("stranger requested a signature")
+	}
+	if ret, err := new(SGXSign).RunWithContext(ctx(owner), request); err != nil || ret[0] != 0x01 {
+		t.Fatalf("signature request failed: ret %x, err %v", ret, err)
+	}
+	var commitments [][]byte
+	for _, node := range []*EncryptedKeyStore{nodes[0], nodes[2]} {
+		r, err := node.ThresholdCommitment(statedb, keyID, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitments = append(commitments, r)
+	}
+	var partials []byte
+	for _, node := range []*EncryptedKeyStore{nodes[0], nodes[2]} {
+		partial, err := node.ThresholdPartialSign(statedb, keyID, hash, signers, commitments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partials = append(partials, partial...)
+	}
+	// The nonces of a commitment sign once
+	if _, err := nodes[0].ThresholdPartialSign(statedb, keyID, hash, signers, commitments); !errors.Is(err, errUnknownNonces) {
+		t.Errorf("expected errUnknownNonces, got %v", err)
+	}
+	// Anyone submits the partial signatures
+	signature, err := new(SGXSign).RunWithContext(ctx(other), append(request, partials...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := append(append([]byte{byte(KeyTypeThreshold)}, params.GroupKey()...), signature...)
+	verify = append(verify, hash...)
+	if ret, err := (&SGXVerify{repriced: true, tagged: true, threshold: true}).Run(verify); err != nil || ret[0] != 0x01 {
+		t.Errorf("threshold signature rejected: ret %x, err %v", ret, err)
+	}
+	if _, err := (&SGXVerify{repriced: true, tagged: true}).Run(verify); err == nil {
+		t.Error("threshold signature verified before the fork")
+	}
+	// The request is consumed
+	if ThresholdSignRequested(statedb, keyID, hash) {
+		t.Error("signature request remains after combining")
+	}
+	if _, err := new(SGXSign).RunWithContext(ctx(other), append(request, partials...)); err == nil {
+		t.Error("partial signatures combined without a request")
+	}
+}
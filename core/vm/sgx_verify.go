@@ -19,12 +19,18 @@ package vm
 import (
 	"crypto/ed25519"
 	"errors"
+	"fmt"
 
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // SGXVerify is the precompiled contract for signature verification (0x8003)
-type SGXVerify struct{}
+type SGXVerify struct {
+	repriced bool // Gas schedule of the SGX gas fork
+	tagged    bool // Key-type-tagged input of the SGX key types fork
+	threshold bool // Threshold signatures of the SGX threshold keys fork
+}
 
 // Name returns the name of the contract
 func (c *SGXVerify) Name() string {
@@ -34,13 +40,22 @@ func (c *SGXVerify) Name() string {
 // RequiredGas calculates the required gas
 // Input format: hash (32 bytes) + signature (65 bytes) + publicKey (64 bytes)
 func (c *SGXVerify) RequiredGas(input []byte) uint64 {
-	return 5000
+	if c.tagged {
+		return c.taggedGas(input)
+	}
+	if !c.repriced {
+		return 5000
+	}
+	return params.SGXVerifyGas
 }
 
 // Run executes the contract (no context needed, pure computation)
 // Input format: hash (32 bytes) + signature (variable) + publicKey (variable)
 // Output format: result (1 byte: 0x01 for valid, 0x00 for invalid)
 func (c *SGXVerify) Run(input []byte) ([]byte, error) {
+	if c.tagged {
+		return c.runTagged(input)
+	}
 	// ECDSA verification: hash (32) + sig (65) + pubkey (64 or 65) = 161 or 162 bytes
 	// Ed25519 verification: hash (32) + sig (64) + pubkey (32) = 128 bytes
 	
@@ -101,3 +116,58 @@ func (c *SGXVerify) Run(input []byte) ([]byte, error) {
 		return nil, errors.New("invalid input length: expected 161 bytes (hash+sig+64-byte-pubkey) or 162 bytes (hash+sig+65-byte-pubkey with 0x04 prefix) for ECDSA, or 128 bytes (hash+sig+pubkey) for Ed25519")
 	}
 }
+
+// taggedGas returns the gas of a key-type-tagged verification, Ed25519
+// messages are charged per word.
+// Input format: keyType (1 byte) + publicKey + signature + message
+func (c *SGXVerify) taggedGas(input []byte) uint64 {
+	if len(input) == 0 {
+		return params.SGXVerifyGas
+	}
+	switch keyType := KeyType(input[0]); keyType {
+	case KeyTypeThreshold:
+		if !c.threshold {
+			return params.SGXVerifyGas
+		}
+		return params.SGXVerifyThresholdGas
+	case KeyTypeP256:
+		return params.P256VerifyGas
+	case KeyTypeEd25519:
+		msgLen := len(input) - 1 - publicKeyLength(keyType) - signatureLength(keyType)
+		if msgLen < 0 {
+			msgLen = 0
+		}
+		return params.SGXVerifyGas + toWordSize(uint64(msgLen))*params.SGXVerifyWordGas
+	default:
+		return params.SGXVerifyGas
+	}
+}
+
+// runTagged verifies a key-type-tagged signature of the SGX key types fork.
+// Input format: keyType (1 byte) + publicKey + signature + message, with the
+// public key and signature encoded as in sgx_curves.go. Ed25519 signs messages
+// of any length, the other key types sign 32 byte hashes.
+// Output format: result (1 byte: 0x01 for valid, 0x00 for invalid)
+func (c *SGXVerify) runTagged(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return nil, errors.New("invalid input: missing key type")
+	}
+	keyType := KeyType(input[0])
+	pubLen, sigLen := publicKeyLength(keyType), signatureLength(keyType)
+	if sigLen == 0 || (keyType == KeyTypeThreshold && !c.threshold) {
+		return nil, fmt.Errorf("key type %d does not support signatures", keyType)
+	}
+	input = input[1:]
+	if len(input) < pubLen+sigLen || (keyType != KeyTypeEd25519 && len(input) != pubLen+sigLen+32) {
+		return nil, fmt.Errorf("invalid input length for key type %d", keyType)
+	}
+	var (
+		pubKey    = input[:pubLen]
+		signature = input[pubLen : pubLen+sigLen]
+		message   = input[pubLen+sigLen:]
+	)
+	if verifySignature(keyType, pubKey, message, signature) {
+		return []byte{0x01}, nil
+	}
+	return []byte{0x00}, nil
+}
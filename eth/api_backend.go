@@ -294,13 +294,23 @@ func (b *EthAPIBackend) GetEVM(ctx context.Context, state *state.StateDB, header
 	if vmConfig == nil {
 		vmConfig = b.eth.blockchain.GetVMConfig()
 	}
+	config := *vmConfig
+	if config.SGXKeyStore == nil {
+		config.SGXKeyStore = b.SGXKeyStore(header.Hash())
+	}
 	var context vm.BlockContext
 	if blockCtx != nil {
 		context = *blockCtx
 	} else {
 		context = core.NewEVMBlockContext(header, b.eth.BlockChain(), nil)
 	}
-	return vm.NewEVM(context, state, b.ChainConfig(), *vmConfig)
+	return vm.NewEVM(context, state, b.ChainConfig(), config)
+}
+
+// SGXKeyStore returns the SGX key store of the chain at the given block for
+// the EVMs of calls and tracing. Their key changes stay in memory.
+func (b *EthAPIBackend) SGXKeyStore(block common.Hash) vm.KeyStore {
+	return b.eth.sgxKeyStore(block)
 }
 
 func (b *EthAPIBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
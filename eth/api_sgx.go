@@ -0,0 +1,160 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/storage"
+)
+
+var errNoSGXKeyStore = errors.New("SGX key store unavailable")
+
+// sgxKeys returns the SGX key store on disk.
+func (s *Ethereum) sgxKeys() (*vm.EncryptedKeyStore, error) {
+	layers := s.blockchain.GetVMConfig().SGXKeyLayers
+	if layers == nil {
+		return nil, errNoSGXKeyStore
+	}
+	return layers.Base(), nil
+}
+
+// ThresholdKeyDeal is the result of dealing a threshold key.
+type ThresholdKeyDeal struct {
+	KeyID        common.Hash   `json:"keyID"`
+	Registration hexutil.Bytes `json:"registration"` // SGXKeyCreate input the owner registers the key with
+	Params       hexutil.Bytes `json:"params"`       // Threshold parameters, the transactionKey of the chain config for a transaction key
+}
+
+// DealThresholdKey generates a threshold key in the enclave for the given
+// owner, any threshold of the local node and the given peers can sign with.
+// The local node keeps the first share, the peers' shares are served to them
+// over the `sgx` protocol once they connect or request them. The owner
+// registers the key by calling SGXKeyCreate with the returned input. A key
+// dealt as the transaction key of encrypted transactions is configured with
+// the returned parameters instead.
+func (api *AdminAPI) DealThresholdKey(owner common.Address, threshold uint8, peers []enode.ID) (*ThresholdKeyDeal, error) {
+	keys, err := api.eth.sgxKeys()
+	if err != nil {
+		return nil, err
+	}
+	secrets := api.eth.sgxSecrets
+	if secrets == nil {
+		return nil, errNoSGXSecrets
+	}
+	if len(peers) == 0 || len(peers) >= math.MaxUint8 {
+		return nil, fmt.Errorf("invalid number of peers: %d", len(peers))
+	}
+	seen := make(map[enode.ID]bool, len(peers))
+	for _, peer := range peers {
+		if seen[peer] || peer == api.eth.p2pServer.Self().ID() {
+			return nil, fmt.Errorf("invalid peer %s", peer)
+		}
+		seen[peer] = true
+	}
+	registration, shares, err := keys.DealThresholdKey(api.eth.blockchain.Config().ChainID, owner, threshold, uint8(len(peers)+1))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, share := range shares {
+			clear(share)
+		}
+	}()
+	keyID, err := keys.ImportKeyShare(shares[0])
+	if err != nil {
+		return nil, err
+	}
+	dealt := make(map[common.Hash][]byte, len(peers))
+	for i, peer := range peers {
+		dealt[common.Hash(peer)] = shares[i+1]
+	}
+	if err := secrets.StoreKeyShares(keyID, dealt); err != nil {
+		return nil, err
+	}
+	local, err := vm.DecodeKeyShare(shares[0])
+	if err != nil {
+		return nil, err
+	}
+	return &ThresholdKeyDeal{KeyID: keyID, Registration: registration, Params: local.Params.Encode()}, nil
+}
+
+// RequestSGXSecrets requests the threshold key shares dealt to the local node
+// from an attested peer, and the master secret if the local node lacks it.
+func (api *AdminAPI) RequestSGXSecrets(peer enode.ID) error {
+	h := api.eth.sgxHandler
+	if h == nil {
+		return errNoSGXSecrets
+	}
+	types := []storage.SecretDataType{storage.SecretTypeKeyShare}
+	if keys, err := api.eth.sgxKeys(); err == nil && !keys.HasMasterSecret() {
+		types = append(types, storage.SecretTypeSharedSecret)
+	}
+	return h.requestSecrets(peer, types...)
+}
+
+// SGXAPI runs the signing rounds of the threshold keys whose shares the local
+// node holds.
+type SGXAPI struct {
+	eth *Ethereum
+}
+
+// NewSGXAPI creates a new SGXAPI instance.
+func NewSGXAPI(eth *Ethereum) *SGXAPI {
+	return &SGXAPI{eth: eth}
+}
+
+// ThresholdCommitment returns the nonce commitment of the local share for a
+// signature of hash with a threshold key, which must have been requested
+// through SGXSign in the head state. The nonces are kept in the enclave for a
+// single partial signature.
+func (api *SGXAPI) ThresholdCommitment(keyID common.Hash, hash hexutil.Bytes) (hexutil.Bytes, error) {
+	keys, err := api.eth.sgxKeys()
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := api.eth.blockchain.State()
+	if err != nil {
+		return nil, err
+	}
+	return keys.ThresholdCommitment(statedb, keyID, hash)
+}
+
+// ThresholdPartialSign returns the partial signature of the local share, given
+// the signer indices and their commitments in ascending order. The result is
+// appended to the SGXSign input combining the signature.
+func (api *SGXAPI) ThresholdPartialSign(keyID common.Hash, hash hexutil.Bytes, signers hexutil.Bytes, commitments []hexutil.Bytes) (hexutil.Bytes, error) {
+	keys, err := api.eth.sgxKeys()
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := api.eth.blockchain.State()
+	if err != nil {
+		return nil, err
+	}
+	list := make([][]byte, len(commitments))
+	for i, c := range commitments {
+		list[i] = c
+	}
+	return keys.ThresholdPartialSign(statedb, keyID, hash, signers, list)
+}
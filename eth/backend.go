@@ -20,9 +20,11 @@ package eth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"os"
 	"runtime"
 	"sync"
 	"time"
@@ -51,6 +53,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	internalsgx "github.com/ethereum/go-ethereum/internal/sgx"
 	"github.com/ethereum/go-ethereum/internal/shutdowncheck"
 	"github.com/ethereum/go-ethereum/internal/version"
 	"github.com/ethereum/go-ethereum/log"
@@ -62,6 +65,7 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/storage"
 	gethversion "github.com/ethereum/go-ethereum/version"
 )
 
@@ -98,9 +102,11 @@ type Ethereum struct {
 	localTxTracker *locals.TxTracker
 	blockchain     *core.BlockChain
 
-	handler *handler
-	discmix *enode.FairMix
-	dropper *dropper
+	handler    *handler
+	sgxHandler *sgxHandler // SGX heartbeat and block propagation, nil unless running the SGX engine
+	sgxSecrets *storage.SyncManagerImpl // Sync of the SGX master secret and key shares with attested peers, nil without SGX
+	discmix    *enode.FairMix
+	dropper    *dropper
 
 	// DB interfaces
 	chainDb ethdb.Database // Block chain database
@@ -184,6 +190,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if err != nil {
 		return nil, err
 	}
+	// On a fresh database the genesis spec is not stored yet, so hand the
+	// SGX engine its whitelist straight from the configured genesis.
+	if sgxEngine, ok := engine.(*sgx.SGXEngine); ok && config.Genesis != nil {
+		if err := sgxEngine.LoadGenesisWhitelist(config.Genesis.Alloc); err != nil {
+			return nil, err
+		}
+	}
 	// Set networkID to chainID by default.
 	networkID := config.NetworkId
 	if networkID == 0 {
@@ -261,6 +274,21 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		}
 		options.VmConfig.Tracer = t
 	}
+	// The SGX precompiles keep their keys in the data directory. The changes
+	// of each block are buffered until the block becomes canonical, and
+	// journaled in the chain database to rewind them with the chain.
+	if _, ok := engine.(*sgx.SGXEngine); ok {
+		keys, secrets, err := openSGXKeyStore(stack, config.SGXBootstrap, config.SGXSealing, chainConfig.SGX.MasterSecretHash)
+		if err != nil {
+			return nil, err
+		}
+		layers, err := vm.NewKeyStoreLayers(keys, chainDb)
+		if err != nil {
+			return nil, err
+		}
+		options.VmConfig.SGXKeyLayers = layers
+		eth.sgxSecrets = secrets
+	}
 	// Override the chain config with provided settings.
 	var overrides core.ChainOverrides
 	if config.OverrideOsaka != nil {
@@ -356,6 +384,15 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 	eth.APIBackend.gpo = gasprice.NewOracle(eth.APIBackend, config.GPO, config.Miner.GasPrice)
 
+	// Set up the SGX heartbeat and block propagation for nodes sealing with SGX
+	if sgxEngine, ok := engine.(*sgx.SGXEngine); ok {
+		keys := eth.blockchain.GetVMConfig().SGXKeyLayers.Base()
+		self := func() enode.ID { return eth.p2pServer.Self().ID() }
+		eth.sgxHandler = newSGXHandler(sgxEngine, eth.blockchain, eth.sgxSecrets, keys, self)
+		eth.miner.SetDecryptionShares(eth.sgxHandler)
+		sgxEngine.SetDecryptionShares(eth.sgxHandler)
+	}
+
 	// Start the RPC service
 	eth.netRPCService = ethapi.NewNetAPI(eth.p2pServer, networkID)
 
@@ -387,10 +424,142 @@ func makeExtraData(extra []byte) []byte {
 	return extra
 }
 
+// sgxSealingKey returns the provider of the sealing key the SGX key store is
+// protected with.
+func sgxSealingKey(stack *node.Node, policy string) (vm.SealingKeyProvider, error) {
+	switch policy {
+	case "", "mrsigner":
+		return vm.GramineSealingKey{Policy: vm.SealToMRSigner}, nil
+	case "mrenclave":
+		return vm.GramineSealingKey{Policy: vm.SealToMREnclave}, nil
+	case "file":
+		log.Warn("SGX key store sealed with an insecure file-based key")
+		return vm.FileSealingKey{Path: stack.ResolvePath("sgxkeys/sealing.key")}, nil
+	default:
+		return nil, fmt.Errorf("unknown SGX sealing policy %q", policy)
+	}
+}
+
+// openSGXKeyStore opens the key store of the SGX precompiles and loads the
+// network master secret sealed in the encrypted partition, generating it when
+// bootstrapping a new network. Without the master secret the node executes no
+// blocks until it has been synced from an attested peer through the returned
+// sync manager, which also distributes threshold key shares.
+func openSGXKeyStore(stack *node.Node, bootstrap bool, sealing string, commitment common.Hash) (*vm.EncryptedKeyStore, *storage.SyncManagerImpl, error) {
+	sealingKey, err := sgxSealingKey(stack, sealing)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := vm.NewEncryptedKeyStore(stack.ResolvePath("sgxkeys/encrypted"), stack.ResolvePath("sgxkeys/public"), sealingKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open SGX key store: %v", err)
+	}
+	path := stack.ResolvePath("sgxkeys/secrets")
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create SGX secrets directory: %v", err)
+	}
+	partition, err := storage.NewEncryptedPartition(path)
+	if err != nil {
+		log.Warn("SGX master secret unavailable, block processing disabled", "err", err)
+		return keys, nil, nil
+	}
+	importSGXKeyShares(keys, partition)
+
+	secrets, err := newSGXSecretSync(partition, keys, commitment)
+	if err != nil {
+		log.Warn("SGX secret sync unavailable", "err", err)
+	}
+	var secret []byte
+	if bootstrap {
+		secret, err = storage.BootstrapMasterSecret(partition)
+	} else {
+		secret, err = storage.LoadMasterSecret(partition)
+	}
+	if err != nil {
+		log.Warn("SGX master secret unavailable, block processing disabled until synced", "err", err)
+		return keys, secrets, nil
+	}
+	defer clear(secret)
+
+	if commitment != (common.Hash{}) && storage.MasterSecretCommitment(secret) != commitment {
+		return nil, nil, errors.New("SGX master secret does not match the chain configuration")
+	}
+	if err := keys.SetMasterSecret(secret); err != nil {
+		return nil, nil, err
+	}
+	log.Info("Loaded SGX master secret", "commitment", storage.MasterSecretCommitment(secret))
+	return keys, secrets, nil
+}
+
+// newSGXSecretSync creates the sync manager exchanging the network master
+// secret and threshold key shares with peers running the same enclave. A
+// synced secret matching the commitment of the chain configuration is loaded
+// into the key store right away, resuming block processing, and received key
+// shares are imported into the key store.
+func newSGXSecretSync(partition storage.EncryptedPartition, keys *vm.EncryptedKeyStore, commitment common.Hash) (*storage.SyncManagerImpl, error) {
+	attestor, err := internalsgx.NewGramineAttestor()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := internalsgx.NewDCAPVerifierFromEnvironment(false)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := storage.NewSyncManager(partition, attestor, verifier)
+	if err != nil {
+		return nil, err
+	}
+	secrets.UpdateAllowedEnclaves([][32]byte{[32]byte(attestor.GetMREnclave())})
+	secrets.SetMasterSecretCommitment(commitment)
+	secrets.SetMasterSecretHandler(func(secret []byte) error {
+		if keys.HasMasterSecret() {
+			return nil
+		}
+		if err := keys.SetMasterSecret(secret); err != nil {
+			return err
+		}
+		log.Info("Loaded synced SGX master secret", "commitment", storage.MasterSecretCommitment(secret))
+		return nil
+	})
+	secrets.SetKeyShareHandler(func(keyID common.Hash, share []byte) error {
+		imported, err := keys.ImportKeyShare(share)
+		if err != nil {
+			return err
+		}
+		if imported != keyID {
+			return fmt.Errorf("key share of %s received as %s", imported.Hex(), keyID.Hex())
+		}
+		log.Info("Imported synced SGX key share", "key", keyID)
+		return nil
+	})
+	return secrets, nil
+}
+
+// importSGXKeyShares loads the threshold key shares synced from the dealing
+// nodes into the key store.
+func importSGXKeyShares(keys *vm.EncryptedKeyStore, partition storage.EncryptedPartition) {
+	shares, err := storage.LoadKeyShares(partition)
+	if err != nil {
+		log.Warn("Failed to load SGX key shares", "err", err)
+		return
+	}
+	for id, share := range shares {
+		if keyID, err := keys.ImportKeyShare(share); err != nil || keyID != id {
+			log.Warn("Invalid SGX key share", "key", id, "err", err)
+		}
+	}
+	if len(shares) > 0 {
+		log.Info("Loaded SGX key shares", "count", len(shares))
+	}
+}
+
 // APIs return the collection of RPC services the ethereum package offers.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *Ethereum) APIs() []rpc.API {
 	apis := ethapi.GetAPIs(s.APIBackend)
+	if s.sgxHandler != nil {
+		apis = append(apis, rpc.API{Namespace: "sgx", Service: NewSGXAPI(s)})
+	}
 
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
@@ -413,6 +582,16 @@ func (s *Ethereum) APIs() []rpc.API {
 	}...)
 }
 
+// sgxKeyStore returns the SGX key store of the chain at the given block for
+// re-executing blocks, calls and tracing. Their key changes stay in memory.
+func (s *Ethereum) sgxKeyStore(block common.Hash) vm.KeyStore {
+	return s.blockchain.GetVMConfig().WithSGXKeys(block).SGXKeyStore
+}
+
+// SGXSecretSync returns the sync manager exchanging the SGX master secret and
+// threshold key shares with attested peers, nil without SGX.
+func (s *Ethereum) SGXSecretSync() *storage.SyncManagerImpl { return s.sgxSecrets }
+
 func (s *Ethereum) ResetWithGenesisBlock(gb *types.Block) {
 	s.blockchain.ResetWithGenesisBlock(gb)
 }
@@ -438,6 +617,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 	if s.config.SnapshotCache > 0 {
 		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler))...)
 	}
+	if s.sgxHandler != nil {
+		protos = append(protos, s.sgxHandler.protocol.Protocols()...)
+	}
 	return protos
 }
 
@@ -470,6 +652,10 @@ func (s *Ethereum) Start() error {
 		} else {
 			log.Info("SGX block producer started successfully")
 		}
+		sgxEngine.StartWhitelistSync(s.blockchain)
+	}
+	if s.sgxHandler != nil {
+		s.sgxHandler.start()
 	}
 	
 	return nil
@@ -589,6 +775,9 @@ func (s *Ethereum) Stop() error {
 	s.discmix.Close()
 	s.dropper.Stop()
 	s.handler.Stop()
+	if s.sgxHandler != nil {
+		s.sgxHandler.stop()
+	}
 
 	// Then stop everything else.
 	ch := make(chan struct{})
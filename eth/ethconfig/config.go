@@ -178,6 +178,15 @@ type Config struct {
 	// Enables tracking of state size
 	EnableStateSizeTracking bool
 
+	// Generate the SGX network master secret if none is sealed. Only the first
+	// node of a new network bootstraps, all others sync the secret from peers.
+	SGXBootstrap bool
+
+	// Enclave identity the SGX key store is sealed to: "mrsigner" (default) to
+	// survive enclave upgrades, "mrenclave" to lose it on every upgrade, or
+	// "file" for an insecure fake sealing key when running outside an enclave.
+	SGXSealing string
+
 	// Enables VM tracing
 	VMTrace           string
 	VMTraceJsonConfig string
@@ -229,7 +238,7 @@ func CreateConsensusEngine(config *params.ChainConfig, db ethdb.Database) (conse
 		log.Info("Loading Module 01: SGX Attestation")
 		log.Info("Loading Module 02: SGX Consensus Engine")
 		log.Info("Loading Module 03: Incentive Mechanism")
-		log.Info("Loading Module 04: Precompiled Contracts (0x8000-0x8009)")
+		log.Info("Loading Module 04: Precompiled Contracts (0x8000-0x800d)")
 		log.Info("Loading Module 05: Governance System")
 		log.Info("Loading Module 06: Encrypted Storage")
 		log.Info("Loading Module 07: Gramine Integration")
@@ -56,6 +56,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		EnableWitnessStats      bool
 		StatelessSelfValidation bool
 		EnableStateSizeTracking bool
+		SGXBootstrap            bool
+		SGXSealing              string
 		VMTrace                 string
 		VMTraceJsonConfig       string
 		RPCGasCap               uint64
@@ -109,6 +111,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.EnableWitnessStats = c.EnableWitnessStats
 	enc.StatelessSelfValidation = c.StatelessSelfValidation
 	enc.EnableStateSizeTracking = c.EnableStateSizeTracking
+	enc.SGXBootstrap = c.SGXBootstrap
+	enc.SGXSealing = c.SGXSealing
 	enc.VMTrace = c.VMTrace
 	enc.VMTraceJsonConfig = c.VMTraceJsonConfig
 	enc.RPCGasCap = c.RPCGasCap
@@ -166,6 +170,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		EnableWitnessStats      *bool
 		StatelessSelfValidation *bool
 		EnableStateSizeTracking *bool
+		SGXBootstrap            *bool
+		SGXSealing              *string
 		VMTrace                 *string
 		VMTraceJsonConfig       *string
 		RPCGasCap               *uint64
@@ -300,6 +306,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.EnableStateSizeTracking != nil {
 		c.EnableStateSizeTracking = *dec.EnableStateSizeTracking
 	}
+	if dec.SGXBootstrap != nil {
+		c.SGXBootstrap = *dec.SGXBootstrap
+	}
+	if dec.SGXSealing != nil {
+		c.SGXSealing = *dec.SGXSealing
+	}
 	if dec.VMTrace != nil {
 		c.VMTrace = *dec.VMTrace
 	}
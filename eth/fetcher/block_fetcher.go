@@ -0,0 +1,281 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/prque"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	maxUncleDist = 7  // Maximum allowed backward distance from the chain head
+	maxQueueDist = 32 // Maximum allowed distance from the chain head to queue
+	blockLimit   = 64 // Maximum number of unique blocks a peer may have delivered
+)
+
+// blockRetrievalFn is a callback type for retrieving a block from the local chain.
+type blockRetrievalFn func(common.Hash) *types.Block
+
+// headerVerifierFn is a callback type to verify a block's header for fast propagation.
+type headerVerifierFn func(header *types.Header) error
+
+// blockBroadcasterFn is a callback type for broadcasting a block to connected peers.
+type blockBroadcasterFn func(block *types.Block)
+
+// chainHeightFn is a callback type to retrieve the current chain height.
+type chainHeightFn func() uint64
+
+// chainInsertFn is a callback type to insert a batch of blocks into the local chain.
+type chainInsertFn func(types.Blocks) (int, error)
+
+// candidateFn is a callback type to record a verified block as a candidate
+// of its height, together with the time it was received.
+type candidateFn func(block *types.Block, receivedAt time.Time)
+
+// peerDropFn is a callback type for dropping a peer detected as malicious.
+type peerDropFn func(id string)
+
+// blockInject represents a scheduled import operation.
+type blockInject struct {
+	origin string
+	block  *types.Block
+	time   time.Time // Timestamp when the block was received
+}
+
+// BlockFetcher is responsible for accumulating block propagations from various
+// peers and scheduling them for import. Every block passing header
+// verification is recorded as a candidate of its height before the chain
+// decides between competing siblings, so that all producers racing for a
+// height can be ranked.
+type BlockFetcher struct {
+	// Various event channels
+	inject chan *blockInject
+	done   chan common.Hash
+	quit   chan struct{}
+
+	// Block cache
+	queue  *prque.Prque[int64, *blockInject] // Queue containing the import operations (block number sorted)
+	queues map[string]int                    // Per peer block counts to prevent memory exhaustion
+	queued map[common.Hash]*blockInject      // Set of already queued blocks (to dedup imports)
+
+	// Callbacks
+	getBlock       blockRetrievalFn   // Retrieves a block from the local chain
+	verifyHeader   headerVerifierFn   // Checks if a block's header carries a valid attestation
+	broadcastBlock blockBroadcasterFn // Broadcasts a block to connected peers
+	chainHeight    chainHeightFn      // Retrieves the current chain's height
+	insertChain    chainInsertFn      // Injects a batch of blocks into the chain
+	addCandidate   candidateFn        // Records a block as a candidate of its height
+	dropPeer       peerDropFn         // Drops a peer for misbehaving
+
+	// Testing hooks
+	queueChangeHook func(common.Hash, bool) // Method to call upon adding or deleting a block from the import queue
+	importedHook    func(*types.Block)      // Method to call upon successful block import
+}
+
+// NewBlockFetcher creates a block fetcher to import and propagate blocks
+// broadcast by other producers.
+func NewBlockFetcher(getBlock blockRetrievalFn, verifyHeader headerVerifierFn, broadcastBlock blockBroadcasterFn, chainHeight chainHeightFn, insertChain chainInsertFn, addCandidate candidateFn, dropPeer peerDropFn) *BlockFetcher {
+	return &BlockFetcher{
+		inject:         make(chan *blockInject),
+		done:           make(chan common.Hash),
+		quit:           make(chan struct{}),
+		queue:          prque.New[int64, *blockInject](nil),
+		queues:         make(map[string]int),
+		queued:         make(map[common.Hash]*blockInject),
+		getBlock:       getBlock,
+		verifyHeader:   verifyHeader,
+		broadcastBlock: broadcastBlock,
+		chainHeight:    chainHeight,
+		insertChain:    insertChain,
+		addCandidate:   addCandidate,
+		dropPeer:       dropPeer,
+	}
+}
+
+// Start boots up the block fetcher, accepting and processing block
+// propagations until termination is requested.
+func (f *BlockFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the block fetcher, canceling all pending operations.
+func (f *BlockFetcher) Stop() {
+	close(f.quit)
+}
+
+// Enqueue tries to fill gaps in the fetcher's future import queue.
+func (f *BlockFetcher) Enqueue(peer string, block *types.Block) error {
+	op := &blockInject{
+		origin: peer,
+		block:  block,
+		time:   time.Now(),
+	}
+	select {
+	case f.inject <- op:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// loop is the main fetcher loop, checking and processing various notification
+// events.
+func (f *BlockFetcher) loop() {
+	for {
+		// Import any queued blocks that could potentially fit
+		height := f.chainHeight()
+		for !f.queue.Empty() {
+			op := f.queue.PopItem()
+			hash := op.block.Hash()
+			if f.queueChangeHook != nil {
+				f.queueChangeHook(hash, false)
+			}
+			// If too high up the chain, continue later
+			number := op.block.NumberU64()
+			if number > height+1 {
+				f.queue.Push(op, -int64(number))
+				if f.queueChangeHook != nil {
+					f.queueChangeHook(hash, true)
+				}
+				break
+			}
+			// Otherwise if fresh and still unknown, try and import
+			if number+maxUncleDist < height || f.getBlock(hash) != nil {
+				f.forgetBlock(hash)
+				continue
+			}
+			f.importBlock(op)
+		}
+		// Wait for an outside event to occur
+		select {
+		case <-f.quit:
+			// BlockFetcher terminating, abort all operations
+			return
+
+		case op := <-f.inject:
+			// A direct block insertion was requested, try and fill any pending gaps
+			blockBroadcastInMeter.Mark(1)
+			f.enqueue(op)
+
+		case hash := <-f.done:
+			// A pending import finished, remove all traces of the notification
+			f.forgetBlock(hash)
+		}
+	}
+}
+
+// enqueue schedules a new block import operation, if the component to be
+// imported has not yet been seen.
+func (f *BlockFetcher) enqueue(op *blockInject) {
+	hash := op.block.Hash()
+
+	// Ensure the peer isn't DOSing us
+	count := f.queues[op.origin] + 1
+	if count > blockLimit {
+		log.Debug("Discarded delivered block, exceeded allowance", "peer", op.origin, "number", op.block.Number(), "hash", hash, "limit", blockLimit)
+		blockBroadcastDOSMeter.Mark(1)
+		return
+	}
+	// Discard any past or too distant blocks
+	if dist := int64(op.block.NumberU64()) - int64(f.chainHeight()); dist < -maxUncleDist || dist > maxQueueDist {
+		log.Debug("Discarded delivered block, too far away", "peer", op.origin, "number", op.block.Number(), "hash", hash, "distance", dist)
+		blockBroadcastDropMeter.Mark(1)
+		return
+	}
+	// Schedule the block for future importing
+	if _, ok := f.queued[hash]; !ok {
+		f.queues[op.origin] = count
+		f.queued[hash] = op
+		f.queue.Push(op, -int64(op.block.NumberU64()))
+		if f.queueChangeHook != nil {
+			f.queueChangeHook(hash, true)
+		}
+		log.Debug("Queued delivered block", "peer", op.origin, "number", op.block.Number(), "hash", hash, "queued", f.queue.Size())
+	}
+}
+
+// importBlock spawns a new goroutine to run a block insertion into the chain.
+// If the block's number is at the same height as the current import phase, it
+// updates the phase states accordingly.
+func (f *BlockFetcher) importBlock(op *blockInject) {
+	var (
+		peer  = op.origin
+		block = op.block
+		hash  = block.Hash()
+	)
+	// Run the import on a new thread
+	log.Debug("Importing propagated block", "peer", peer, "number", block.Number(), "hash", hash)
+	go func() {
+		defer func() {
+			select {
+			case f.done <- hash:
+			case <-f.quit:
+			}
+		}()
+		// If the parent's unknown, abort insertion
+		if f.getBlock(block.ParentHash()) == nil {
+			log.Debug("Unknown parent of propagated block", "peer", peer, "number", block.Number(), "hash", hash, "parent", block.ParentHash())
+			return
+		}
+		// Quickly validate the header and propagate the block if it passes
+		switch err := f.verifyHeader(block.Header()); err {
+		case nil:
+			// All ok, quickly propagate to our peers
+			blockBroadcastOutTimer.UpdateSince(op.time)
+			go f.broadcastBlock(block)
+
+		case consensus.ErrFutureBlock:
+			// Weird future block, don't fail, but neither propagate
+
+		default:
+			// Something went very wrong, drop the peer
+			log.Debug("Propagated block verification failed", "peer", peer, "number", block.Number(), "hash", hash, "err", err)
+			f.dropPeer(peer)
+			return
+		}
+		// The block competes for its height regardless of which sibling the
+		// chain ends up keeping
+		f.addCandidate(block, op.time)
+
+		// Run the actual import and log any issues
+		if _, err := f.insertChain(types.Blocks{block}); err != nil {
+			log.Debug("Propagated block import failed", "peer", peer, "number", block.Number(), "hash", hash, "err", err)
+			return
+		}
+		// Invoke the testing hook if needed
+		if f.importedHook != nil {
+			f.importedHook(block)
+		}
+	}()
+}
+
+// forgetBlock removes all traces of a queued block from the fetcher's internal
+// state.
+func (f *BlockFetcher) forgetBlock(hash common.Hash) {
+	if insert := f.queued[hash]; insert != nil {
+		f.queues[insert.origin]--
+		if f.queues[insert.origin] == 0 {
+			delete(f.queues, insert.origin)
+		}
+		delete(f.queued, hash)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var errBadHeader = errors.New("bad header")
+
+// fetcherTester is a test simulator for mocking out the local chain.
+type fetcherTester struct {
+	fetcher *BlockFetcher
+
+	lock       sync.RWMutex
+	blocks     map[common.Hash]*types.Block // Blocks belonging to the tester
+	height     uint64                       // Height of the highest imported block
+	candidates chan *types.Block            // Blocks recorded as candidates
+	drops      chan string                  // Peers dropped by the fetcher
+}
+
+// newTester creates a new fetcher test mocker with a genesis block.
+func newTester() *fetcherTester {
+	genesis := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0)})
+	tester := &fetcherTester{
+		blocks:     map[common.Hash]*types.Block{genesis.Hash(): genesis},
+		candidates: make(chan *types.Block, 16),
+		drops:      make(chan string, 16),
+	}
+	tester.fetcher = NewBlockFetcher(tester.getBlock, tester.verifyHeader, tester.broadcastBlock, tester.chainHeight, tester.insertChain, tester.addCandidate, tester.dropPeer)
+	tester.fetcher.Start()
+	return tester
+}
+
+func (f *fetcherTester) getBlock(hash common.Hash) *types.Block {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.blocks[hash]
+}
+
+func (f *fetcherTester) verifyHeader(header *types.Header) error {
+	if string(header.Extra) == "bad" {
+		return errBadHeader
+	}
+	return nil
+}
+
+func (f *fetcherTester) broadcastBlock(block *types.Block) {}
+
+func (f *fetcherTester) chainHeight() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.height
+}
+
+func (f *fetcherTester) insertChain(blocks types.Blocks) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i, block := range blocks {
+		if _, ok := f.blocks[block.ParentHash()]; !ok {
+			return i, errors.New("unknown parent")
+		}
+		f.blocks[block.Hash()] = block
+		if block.NumberU64() > f.height {
+			f.height = block.NumberU64()
+		}
+	}
+	return 0, nil
+}
+
+func (f *fetcherTester) addCandidate(block *types.Block, receivedAt time.Time) {
+	f.candidates <- block
+}
+
+func (f *fetcherTester) dropPeer(peer string) {
+	f.drops <- peer
+}
+
+// makeBlock creates a block on top of parent, distinguished by extra.
+func makeBlock(parent *types.Block, extra string) *types.Block {
+	return types.NewBlockWithHeader(&types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		Extra:      []byte(extra),
+	})
+}
+
+// genesis returns the single block the tester was created with.
+func (f *fetcherTester) genesis() *types.Block {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, block := range f.blocks {
+		return block
+	}
+	return nil
+}
+
+func waitCandidates(t *testing.T, tester *fetcherTester, n int) map[common.Hash]bool {
+	t.Helper()
+	seen := make(map[common.Hash]bool)
+	for len(seen) < n {
+		select {
+		case block := <-tester.candidates:
+			seen[block.Hash()] = true
+		case <-time.After(time.Second):
+			t.Fatalf("recorded %d candidates, want %d", len(seen), n)
+		}
+	}
+	return seen
+}
+
+// Tests that all siblings competing for a height are recorded as candidates,
+// not only the one the chain ends up keeping.
+func TestSiblingCandidates(t *testing.T) {
+	tester := newTester()
+	defer tester.fetcher.Stop()
+
+	genesis := tester.genesis()
+	siblings := []*types.Block{makeBlock(genesis, "a"), makeBlock(genesis, "b"), makeBlock(genesis, "c")}
+	for i, block := range siblings {
+		if err := tester.fetcher.Enqueue(string(rune('a'+i)), block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := waitCandidates(t, tester, len(siblings))
+	for _, block := range siblings {
+		if !seen[block.Hash()] {
+			t.Errorf("sibling %x not recorded", block.Hash())
+		}
+	}
+}
+
+// Tests that blocks delivered before their parent are held back until the
+// parent is imported.
+func TestOutOfOrderImport(t *testing.T) {
+	tester := newTester()
+	defer tester.fetcher.Stop()
+
+	parent := makeBlock(tester.genesis(), "p")
+	child := makeBlock(parent, "c")
+	if err := tester.fetcher.Enqueue("peer", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := tester.fetcher.Enqueue("peer", parent); err != nil {
+		t.Fatal(err)
+	}
+	waitCandidates(t, tester, 2)
+
+	// The candidate is recorded right before insertion, give it a moment
+	for i := 0; tester.getBlock(child.Hash()) == nil; i++ {
+		if i == 100 {
+			t.Fatal("child not imported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Tests that peers delivering blocks failing header verification are dropped
+// and their blocks never become candidates.
+func TestInvalidBlockDropsPeer(t *testing.T) {
+	tester := newTester()
+	defer tester.fetcher.Stop()
+
+	if err := tester.fetcher.Enqueue("bad", makeBlock(tester.genesis(), "bad")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case peer := <-tester.drops:
+		if peer != "bad" {
+			t.Fatalf("dropped %q, want %q", peer, "bad")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer not dropped")
+	}
+	select {
+	case block := <-tester.candidates:
+		t.Fatalf("invalid block %x recorded as candidate", block.Hash())
+	default:
+	}
+}
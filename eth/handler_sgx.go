@@ -0,0 +1,475 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/consensus/sgx"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/ethereum/go-ethereum/eth/fetcher"
+	sgxproto "github.com/ethereum/go-ethereum/eth/protocols/sgx"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/storage"
+)
+
+// maxSGXSessionPeers is the number of peers whose attested session keys are
+// remembered.
+const maxSGXSessionPeers = 1024
+
+// maxDecryptionSharePayloads is the number of encrypted payloads whose
+// decryption shares are kept for revealing them.
+const maxDecryptionSharePayloads = 4096
+
+// sgxSessionDomain separates the report data of secret sync sessions.
+var sgxSessionDomain = []byte("sgx-secret-session")
+
+var errNoSGXSecrets = errors.New("SGX secret sync unavailable")
+
+// sgxHandler implements the sgxproto.Backend interface on top of the SGX
+// consensus engine, which attests, verifies and accounts heartbeats. Blocks
+// propagated by other producers are scheduled through a block fetcher that
+// records every verified sibling as a candidate of its height, while blocks
+// sealed locally are broadcast to the network.
+//
+// The handler also syncs the master secret and threshold key shares between
+// attested enclaves. Every node attests a session key bound to its node ID,
+// and secrets are encrypted to the session key of the requesting peer, so
+// that only its enclave can read them.
+//
+// Once a block committing encrypted transactions becomes canonical, the
+// handler releases the decryption shares of the local key share for them and
+// gossips them, collecting the shares of the other holders for the producers
+// revealing the transactions.
+type sgxHandler struct {
+	engine   *sgx.SGXEngine
+	protocol *sgxproto.Handler
+	fetcher  *fetcher.BlockFetcher
+
+	secrets    *storage.SyncManagerImpl // Secret sync with attested peers, nil without SGX
+	keys       *vm.EncryptedKeyStore    // Key store the synced secrets are loaded into
+	self       func() enode.ID          // ID of the local node
+	sessionKey *ecdsa.PrivateKey        // Key the secrets for this node are encrypted to
+
+	attestLock  sync.Mutex
+	attestation *sgxproto.AttestationPacket            // Cached attestation of the session key
+	peerKeys    *lru.Cache[enode.ID, *ecies.PublicKey] // Attested session keys of the peers
+
+	chain    *core.BlockChain
+	shares   *lru.Cache[string, map[uint8][]byte] // Decryption shares by ephemeral key and share index
+	released *lru.Cache[string, struct{}]         // Ephemeral keys the local share was released for
+	sharesMu sync.Mutex                           // Serialises the updates of the decryption shares
+
+	sealedSub event.Subscription
+	headSub   event.Subscription
+	importSub event.Subscription
+	wg        sync.WaitGroup
+}
+
+// newSGXHandler creates the `sgx` protocol handler and the block fetcher
+// feeding candidate blocks into the engine. Secrets are synced with the sync
+// manager, if any.
+func newSGXHandler(engine *sgx.SGXEngine, chain *core.BlockChain, secrets *storage.SyncManagerImpl, keys *vm.EncryptedKeyStore, self func() enode.ID) *sgxHandler {
+	h := &sgxHandler{
+		engine:   engine,
+		secrets:  secrets,
+		keys:     keys,
+		self:     self,
+		peerKeys: lru.NewCache[enode.ID, *ecies.PublicKey](maxSGXSessionPeers),
+		chain:    chain,
+		shares:   lru.NewCache[string, map[uint8][]byte](maxDecryptionSharePayloads),
+		released: lru.NewCache[string, struct{}](maxDecryptionSharePayloads),
+	}
+	h.protocol = sgxproto.NewHandler(h, engine.HeartbeatInterval())
+	if secrets != nil {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			log.Warn("Failed to create SGX session key, secret sync disabled", "err", err)
+			h.secrets = nil
+		}
+		h.sessionKey = key
+	}
+
+	getBlock := func(hash common.Hash) *types.Block {
+		return chain.GetBlockByHash(hash)
+	}
+	verifyHeader := func(header *types.Header) error {
+		return engine.VerifyHeader(chain, header)
+	}
+	chainHeight := func() uint64 {
+		return chain.CurrentBlock().Number.Uint64()
+	}
+	addCandidate := func(block *types.Block, receivedAt time.Time) {
+		if err := engine.AddCandidate(block, receivedAt); err != nil {
+			log.Debug("Failed to record candidate block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+	}
+	h.fetcher = fetcher.NewBlockFetcher(getBlock, verifyHeader, h.protocol.BroadcastBlock, chainHeight, chain.InsertChain, addCandidate, h.protocol.DropPeer)
+	return h
+}
+
+// start launches the heartbeat broadcast, the block fetcher, the propagation
+// of locally sealed blocks, the double-sign detection of imported blocks and
+// the release of decryption shares.
+func (h *sgxHandler) start() {
+	h.protocol.Start()
+	h.fetcher.Start()
+
+	h.wg.Add(3)
+	sealedCh := make(chan sgx.SealedBlockEvent, 16)
+	h.sealedSub = h.engine.SubscribeSealedBlocks(sealedCh)
+	go h.sealedBroadcastLoop(sealedCh)
+
+	headCh := make(chan core.ChainHeadEvent, 16)
+	h.headSub = h.chain.SubscribeChainHeadEvent(headCh)
+	go h.decryptionShareLoop(headCh)
+
+	importCh := make(chan core.ChainEvent, 16)
+	h.importSub = h.chain.SubscribeChainEvent(importCh)
+	go h.importLoop(importCh)
+}
+
+// stop terminates all goroutines started by start.
+func (h *sgxHandler) stop() {
+	h.sealedSub.Unsubscribe()
+	h.headSub.Unsubscribe()
+	h.importSub.Unsubscribe()
+	h.wg.Wait()
+	h.fetcher.Stop()
+	h.protocol.Stop()
+}
+
+// sealedBroadcastLoop propagates blocks sealed by the local producer.
+func (h *sgxHandler) sealedBroadcastLoop(sealedCh <-chan sgx.SealedBlockEvent) {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case ev := <-sealedCh:
+			h.protocol.BroadcastBlock(ev.Block)
+		case <-h.sealedSub.Err():
+			return
+		}
+	}
+}
+
+// importLoop feeds the blocks imported into the chain, also those synced
+// without being announced, into the double-sign detector of the engine.
+func (h *sgxHandler) importLoop(importCh <-chan core.ChainEvent) {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case ev := <-importCh:
+			h.engine.ObserveSealed(ev.Header)
+		case <-h.importSub.Err():
+			return
+		}
+	}
+}
+
+// decryptionShareLoop releases the decryption shares of the encrypted
+// transactions committed by every new canonical head.
+func (h *sgxHandler) decryptionShareLoop(headCh <-chan core.ChainHeadEvent) {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case ev := <-headCh:
+			h.releaseDecryptionShares(ev.Header)
+		case <-h.headSub.Err():
+			return
+		}
+	}
+}
+
+// releaseDecryptionShares computes the decryption shares of the local key
+// share for the encrypted transactions committed up to head and not revealed
+// yet, and gossips them.
+func (h *sgxHandler) releaseDecryptionShares(head *types.Header) {
+	config := h.chain.Config()
+	if h.keys == nil || !config.IsSGXEncryptedTx(head.Number) {
+		return
+	}
+	params, err := vm.TransactionKeyParams(config)
+	if err != nil {
+		return
+	}
+	statedb, err := h.chain.StateAt(head.Root)
+	if err != nil {
+		log.Debug("Failed to open state for decryption shares", "number", head.Number, "err", err)
+		return
+	}
+	var fresh []sgxproto.DecryptionShare
+	for _, committed := range vm.PendingEncryptedTxs(statedb) {
+		payload, err := core.EncryptedTxPayload(h.chain, head, committed)
+		if err != nil {
+			log.Debug("Failed to find encrypted transaction", "index", committed.Index, "err", err)
+			continue
+		}
+		ephemeral := types.EncryptedTxEphemeralKey(payload)
+		if h.released.Contains(string(ephemeral)) {
+			continue
+		}
+		share, err := h.keys.DecryptionShare(statedb, params, committed.Index, payload)
+		if err != nil {
+			log.Debug("Failed to compute decryption share", "index", committed.Index, "err", err)
+			continue
+		}
+		h.released.Add(string(ephemeral), struct{}{})
+		if h.addDecryptionShare(ephemeral, share) {
+			fresh = append(fresh, sgxproto.DecryptionShare{Ephemeral: ephemeral, Share: share})
+		}
+	}
+	h.protocol.BroadcastDecryptionShares(fresh)
+}
+
+// addDecryptionShare records a verified decryption share and reports whether
+// it is new.
+func (h *sgxHandler) addDecryptionShare(ephemeral []byte, share []byte) bool {
+	h.sharesMu.Lock()
+	defer h.sharesMu.Unlock()
+
+	byIndex, _ := h.shares.Get(string(ephemeral))
+	if _, ok := byIndex[share[0]]; ok {
+		return false
+	}
+	if byIndex == nil {
+		byIndex = make(map[uint8][]byte)
+		h.shares.Add(string(ephemeral), byIndex)
+	}
+	byIndex[share[0]] = common.CopyBytes(share)
+	return true
+}
+
+// DecryptionShares returns threshold many decryption shares of an ephemeral
+// key, ascending by share index, or nil if not enough are known yet.
+func (h *sgxHandler) DecryptionShares(ephemeral []byte) [][]byte {
+	params, err := vm.TransactionKeyParams(h.chain.Config())
+	if err != nil {
+		return nil
+	}
+	h.sharesMu.Lock()
+	defer h.sharesMu.Unlock()
+
+	byIndex, _ := h.shares.Get(string(ephemeral))
+	if len(byIndex) < int(params.Threshold) {
+		return nil
+	}
+	indices := slices.Sorted(maps.Keys(byIndex))
+	shares := make([][]byte, params.Threshold)
+	for i := range shares {
+		shares[i] = common.CopyBytes(byIndex[indices[i]])
+	}
+	return shares
+}
+
+// DeliverDecryptionShares verifies the decryption shares gossiped by a peer
+// and returns the new ones.
+func (h *sgxHandler) DeliverDecryptionShares(shares []sgxproto.DecryptionShare) ([]sgxproto.DecryptionShare, error) {
+	params, err := vm.TransactionKeyParams(h.chain.Config())
+	if err != nil {
+		return nil, nil
+	}
+	var fresh []sgxproto.DecryptionShare
+	for _, share := range shares {
+		if err := vm.VerifyDecryptionShare(params, share.Ephemeral, share.Share); err != nil {
+			return nil, err
+		}
+		if h.addDecryptionShare(share.Ephemeral, share.Share) {
+			fresh = append(fresh, share)
+		}
+	}
+	return fresh, nil
+}
+
+// MakeHeartbeat creates an attested heartbeat of the local node.
+func (h *sgxHandler) MakeHeartbeat(observed []common.Address) (*sgxproto.HeartbeatPacket, error) {
+	msg, err := h.engine.NewHeartbeat(observed)
+	if err != nil {
+		return nil, err
+	}
+	return &sgxproto.HeartbeatPacket{
+		NodeID:     msg.NodeID,
+		Timestamp:  msg.Timestamp,
+		Observed:   msg.Observed,
+		Quote:      msg.SGXQuote,
+		Signature:  msg.Signature,
+		ProducerID: msg.ProducerID,
+	}, nil
+}
+
+// VerifyHeartbeat checks the attestation of a remote heartbeat.
+func (h *sgxHandler) VerifyHeartbeat(packet *sgxproto.HeartbeatPacket) error {
+	return h.engine.VerifyHeartbeat(heartbeatMessage(packet))
+}
+
+// DeliverHeartbeat feeds a verified heartbeat into the uptime accounting.
+func (h *sgxHandler) DeliverHeartbeat(packet *sgxproto.HeartbeatPacket) error {
+	return h.engine.RecordHeartbeat(heartbeatMessage(packet))
+}
+
+// DeliverBlock schedules a propagated block for verification and import.
+func (h *sgxHandler) DeliverBlock(peer string, block *types.Block) error {
+	return h.fetcher.Enqueue(peer, block)
+}
+
+// sgxSessionReportData returns the report data attesting the session key of a
+// node.
+func sgxSessionReportData(node enode.ID, sessionKey []byte) []byte {
+	return crypto.Keccak256(sgxSessionDomain, node.Bytes(), sessionKey)
+}
+
+// MakeAttestation attests the session key of the local node.
+func (h *sgxHandler) MakeAttestation() (*sgxproto.AttestationPacket, error) {
+	if h.secrets == nil {
+		return nil, errNoSGXSecrets
+	}
+	h.attestLock.Lock()
+	defer h.attestLock.Unlock()
+
+	if h.attestation == nil {
+		key := crypto.FromECDSAPub(&h.sessionKey.PublicKey)
+		quote, err := h.secrets.Attest(sgxSessionReportData(h.self(), key))
+		if err != nil {
+			return nil, err
+		}
+		h.attestation = &sgxproto.AttestationPacket{Quote: quote, SessionKey: key}
+	}
+	return h.attestation, nil
+}
+
+// VerifyAttestation registers an attested peer for secret syncs and requests
+// the secrets the local node lacks from it.
+func (h *sgxHandler) VerifyAttestation(peer enode.ID, packet *sgxproto.AttestationPacket) error {
+	if h.secrets == nil {
+		return nil
+	}
+	key, err := crypto.UnmarshalPubkey(packet.SessionKey)
+	if err != nil {
+		return fmt.Errorf("invalid session key: %v", err)
+	}
+	if err := h.secrets.AddAttestedPeer(common.Hash(peer), packet.Quote, sgxSessionReportData(peer, packet.SessionKey)); err != nil {
+		return err
+	}
+	h.peerKeys.Add(peer, ecies.ImportECDSAPublic(key))
+
+	// Shares are only served to the peer they were dealt to, ask every peer
+	types := []storage.SecretDataType{storage.SecretTypeKeyShare}
+	if h.keys != nil && !h.keys.HasMasterSecret() {
+		types = append(types, storage.SecretTypeSharedSecret)
+	}
+	if err := h.requestSecrets(peer, types...); err != nil {
+		log.Debug("Failed to request SGX secrets", "peer", peer, "err", err)
+	}
+	return nil
+}
+
+// requestSecrets requests the secrets of the given types from an attested
+// peer.
+func (h *sgxHandler) requestSecrets(peer enode.ID, types ...storage.SecretDataType) error {
+	if h.secrets == nil {
+		return errNoSGXSecrets
+	}
+	requestID, err := h.secrets.RequestSync(common.Hash(peer), types)
+	if err != nil {
+		return err
+	}
+	packet := &sgxproto.SecretRequestPacket{RequestID: requestID}
+	for _, t := range types {
+		packet.Types = append(packet.Types, uint8(t))
+	}
+	return h.protocol.RequestSecrets(peer.String(), packet)
+}
+
+// HandleSecretRequest returns the requested secrets, encrypted to the session
+// key of the attested peer.
+func (h *sgxHandler) HandleSecretRequest(peer enode.ID, packet *sgxproto.SecretRequestPacket) (*sgxproto.SecretsPacket, error) {
+	if h.secrets == nil {
+		return nil, errNoSGXSecrets
+	}
+	key, ok := h.peerKeys.Get(peer)
+	if !ok {
+		return nil, errors.New("peer not attested")
+	}
+	request := &storage.SyncRequest{RequestID: packet.RequestID, PeerID: common.Hash(peer), Timestamp: uint64(time.Now().Unix())}
+	for _, t := range packet.Types {
+		request.SecretTypes = append(request.SecretTypes, storage.SecretDataType(t))
+	}
+	response, err := h.secrets.HandleSyncRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	result := &sgxproto.SecretsPacket{RequestID: packet.RequestID}
+	for _, secret := range response.Secrets {
+		data, err := ecies.Encrypt(rand.Reader, key, secret.Data, nil, nil)
+		clear(secret.Data)
+		if err != nil {
+			return nil, err
+		}
+		result.Secrets = append(result.Secrets, sgxproto.Secret{ID: string(secret.ID), Type: uint8(secret.Type), Data: data})
+	}
+	return result, nil
+}
+
+// DeliverSecrets decrypts and applies the secrets sent by a peer.
+func (h *sgxHandler) DeliverSecrets(peer enode.ID, packet *sgxproto.SecretsPacket) error {
+	if h.secrets == nil {
+		return errNoSGXSecrets
+	}
+	response := &storage.SyncResponse{RequestID: packet.RequestID, PeerID: common.Hash(peer), Timestamp: uint64(time.Now().Unix())}
+	defer func() {
+		for _, secret := range response.Secrets {
+			clear(secret.Data)
+		}
+	}()
+	key := ecies.ImportECDSA(h.sessionKey)
+	for _, secret := range packet.Secrets {
+		data, err := key.Decrypt(secret.Data, nil, nil)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt secret %s: %v", secret.ID, err)
+		}
+		response.Secrets = append(response.Secrets, storage.SecretData{Type: storage.SecretDataType(secret.Type), ID: []byte(secret.ID), Data: data})
+	}
+	return h.secrets.VerifyAndApplySync(response)
+}
+
+func heartbeatMessage(packet *sgxproto.HeartbeatPacket) *sgx.HeartbeatMessage {
+	return &sgx.HeartbeatMessage{
+		NodeID:     packet.NodeID,
+		Timestamp:  packet.Timestamp,
+		Observed:   packet.Observed,
+		SGXQuote:   packet.Quote,
+		Signature:  packet.Signature,
+		ProducerID: packet.ProducerID,
+	}
+}
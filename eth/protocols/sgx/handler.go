@@ -0,0 +1,438 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	// maxSeenHeartbeats is the number of heartbeat IDs remembered to drop
+	// duplicates arriving from different peers.
+	maxSeenHeartbeats = 16384
+
+	// maxTrackedNodes is the number of origin nodes whose latest heartbeat
+	// timestamp is remembered.
+	maxTrackedNodes = 4096
+
+	// maxClockSkew is how far in the future a heartbeat timestamp may be.
+	maxClockSkew = 15 * time.Second
+
+	// maxObserved is the maximum number of observed nodes in a heartbeat.
+	maxObserved = 256
+)
+
+// Backend creates, verifies and consumes heartbeats on behalf of the protocol.
+type Backend interface {
+	// MakeHeartbeat creates an attested heartbeat of the local node, listing
+	// the nodes it has observed online.
+	MakeHeartbeat(observed []common.Address) (*HeartbeatPacket, error)
+
+	// VerifyHeartbeat checks the attestation of a remote heartbeat.
+	VerifyHeartbeat(packet *HeartbeatPacket) error
+
+	// DeliverHeartbeat is invoked for every new, verified heartbeat.
+	DeliverHeartbeat(packet *HeartbeatPacket) error
+
+	// DeliverBlock is invoked for every block propagated by a peer. The block
+	// is not verified yet, the backend is responsible for scheduling it.
+	DeliverBlock(peer string, block *types.Block) error
+
+	// MakeAttestation creates the attestation of the local session key sent
+	// to every peer on connect.
+	MakeAttestation() (*AttestationPacket, error)
+
+	// VerifyAttestation checks the attestation of a peer and registers it for
+	// secret syncs.
+	VerifyAttestation(peer enode.ID, packet *AttestationPacket) error
+
+	// HandleSecretRequest returns the requested secrets for an attested peer.
+	HandleSecretRequest(peer enode.ID, packet *SecretRequestPacket) (*SecretsPacket, error)
+
+	// DeliverSecrets is invoked for the secrets sent by a peer in response to
+	// a request.
+	DeliverSecrets(peer enode.ID, packet *SecretsPacket) error
+
+	// DeliverDecryptionShares verifies the decryption shares gossiped by a
+	// peer and returns the ones not known before, to be relayed.
+	DeliverDecryptionShares(shares []DecryptionShare) ([]DecryptionShare, error)
+}
+
+// Handler runs the `sgx` protocol: it periodically broadcasts the local
+// heartbeat and verifies, accounts and gossips the heartbeats of other nodes.
+// It also carries the candidate blocks of all producers.
+type Handler struct {
+	backend  Backend
+	interval time.Duration
+
+	peers map[string]*Peer
+	lock  sync.RWMutex
+
+	seen   *lru.Cache[common.Hash, struct{}]  // Heartbeats already processed
+	latest *lru.Cache[common.Address, uint64] // Newest accepted timestamp per node
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewHandler creates a protocol handler broadcasting a heartbeat every interval.
+func NewHandler(backend Backend, interval time.Duration) *Handler {
+	return &Handler{
+		backend:  backend,
+		interval: interval,
+		peers:    make(map[string]*Peer),
+		seen:     lru.NewCache[common.Hash, struct{}](maxSeenHeartbeats),
+		latest:   lru.NewCache[common.Address, uint64](maxTrackedNodes),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Protocols constructs the P2P protocol definitions for `sgx`.
+func (h *Handler) Protocols() []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  protocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return h.runPeer(NewPeer(version, p, rw))
+			},
+			NodeInfo: func() interface{} {
+				return &NodeInfo{Interval: uint64(h.interval / time.Second)}
+			},
+			PeerInfo: func(id enode.ID) interface{} {
+				return nil
+			},
+		}
+	}
+	return protocols
+}
+
+// NodeInfo represents a short summary of the `sgx` protocol metadata known
+// about the host peer.
+type NodeInfo struct {
+	Interval uint64 `json:"interval"` // Heartbeat interval in seconds
+}
+
+// Start launches the local heartbeat broadcast loop.
+func (h *Handler) Start() {
+	h.wg.Add(1)
+	go h.loop()
+}
+
+// Stop terminates the broadcast loop.
+func (h *Handler) Stop() {
+	close(h.quit)
+	h.wg.Wait()
+}
+
+// loop broadcasts a heartbeat of the local node every interval.
+func (h *Handler) loop() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			packet, err := h.backend.MakeHeartbeat(h.observed(time.Now()))
+			if err != nil {
+				log.Debug("Failed to create heartbeat", "err", err)
+				continue
+			}
+			id := packet.ID()
+			h.seen.Add(id, struct{}{})
+			h.broadcast(packet, id)
+
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// observed returns the nodes whose latest heartbeat is at most two intervals
+// old, in ascending order.
+func (h *Handler) observed(now time.Time) []common.Address {
+	cutoff := now.Add(-2 * h.interval).Unix()
+
+	var nodes []common.Address
+	for _, node := range h.latest.Keys() {
+		if ts, ok := h.latest.Peek(node); ok && int64(ts) >= cutoff {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Cmp(nodes[j]) < 0 })
+	if len(nodes) > maxObserved {
+		nodes = nodes[:maxObserved]
+	}
+	return nodes
+}
+
+// runPeer registers the peer for broadcasts and processes its messages until
+// the connection is torn down.
+func (h *Handler) runPeer(peer *Peer) error {
+	h.lock.Lock()
+	h.peers[peer.ID()] = peer
+	h.lock.Unlock()
+
+	defer func() {
+		h.lock.Lock()
+		delete(h.peers, peer.ID())
+		h.lock.Unlock()
+		peer.close()
+	}()
+	go peer.broadcast()
+
+	if packet, err := h.backend.MakeAttestation(); err != nil {
+		peer.Log().Debug("Failed to create attestation", "err", err)
+	} else if err := p2p.Send(peer.rw, AttestationMsg, packet); err != nil {
+		return err
+	}
+	for {
+		if err := h.handleMessage(peer); err != nil {
+			peer.Log().Debug("Message handling failed in `sgx`", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage is invoked whenever an inbound message is received from a
+// remote peer. The remote connection is torn down upon returning any error.
+func (h *Handler) handleMessage(peer *Peer) error {
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case HeartbeatMsg:
+		packet := new(HeartbeatPacket)
+		if err := msg.Decode(packet); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		return h.handleHeartbeat(peer, packet, time.Now())
+
+	case NewBlockMsg:
+		packet := new(NewBlockPacket)
+		if err := msg.Decode(packet); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		if err := packet.sanityCheck(); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidBlock, err)
+		}
+		return h.handleNewBlock(peer, packet.Block)
+
+	case AttestationMsg:
+		packet := new(AttestationPacket)
+		if err := msg.Decode(packet); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		return h.backend.VerifyAttestation(peer.Peer.ID(), packet)
+
+	case SecretRequestMsg:
+		packet := new(SecretRequestPacket)
+		if err := msg.Decode(packet); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		response, err := h.backend.HandleSecretRequest(peer.Peer.ID(), packet)
+		if err != nil {
+			peer.Log().Debug("Refused secret request", "err", err)
+			return nil
+		}
+		return p2p.Send(peer.rw, SecretsMsg, response)
+
+	case SecretsMsg:
+		packet := new(SecretsPacket)
+		if err := msg.Decode(packet); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		if len(packet.Secrets) > maxSecrets {
+			return fmt.Errorf("%w: %d secrets", errInvalidSecrets, len(packet.Secrets))
+		}
+		if err := h.backend.DeliverSecrets(peer.Peer.ID(), packet); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidSecrets, err)
+		}
+		return nil
+
+	case DecryptionSharesMsg:
+		packet := new(DecryptionSharesPacket)
+		if err := msg.Decode(packet); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		if len(packet.Shares) > maxDecryptionShares {
+			return fmt.Errorf("%w: %d shares", errInvalidShares, len(packet.Shares))
+		}
+		return h.handleDecryptionShares(peer, packet.Shares)
+
+	default:
+		return fmt.Errorf("%w: %v", errInvalidMsgCode, msg.Code)
+	}
+}
+
+// handleDecryptionShares verifies the decryption shares relayed by a peer and
+// relays the new ones. Peers relaying invalid shares are disconnected.
+func (h *Handler) handleDecryptionShares(peer *Peer, shares []DecryptionShare) error {
+	for i := range shares {
+		peer.markDecryptionShare(shares[i].ID())
+	}
+	fresh, err := h.backend.DeliverDecryptionShares(shares)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidShares, err)
+	}
+	h.BroadcastDecryptionShares(fresh)
+	return nil
+}
+
+// handleHeartbeat processes a heartbeat relayed by a peer. Duplicates, stale
+// and too frequent heartbeats are dropped before the costly quote check, and
+// peers relaying heartbeats that fail verification are disconnected.
+func (h *Handler) handleHeartbeat(peer *Peer, packet *HeartbeatPacket, now time.Time) error {
+	id := packet.ID()
+	peer.markHeartbeat(id)
+
+	if !peer.limiter.Allow() {
+		peer.Log().Trace("Dropping rate limited heartbeat", "node", packet.NodeID)
+		return nil
+	}
+	if h.seen.Contains(id) {
+		return nil
+	}
+	if len(packet.Observed) > maxObserved {
+		return fmt.Errorf("%w: %d observed nodes", errInvalidHeartbeat, len(packet.Observed))
+	}
+	ts := int64(packet.Timestamp)
+	if ts > now.Add(maxClockSkew).Unix() || ts < now.Add(-2*h.interval).Unix() {
+		peer.Log().Trace("Dropping stale heartbeat", "node", packet.NodeID, "timestamp", packet.Timestamp)
+		return nil
+	}
+	// Accept at most one heartbeat per node every half interval
+	if last, ok := h.latest.Peek(packet.NodeID); ok && packet.Timestamp < last+h.minGap() {
+		return nil
+	}
+	if err := h.backend.VerifyHeartbeat(packet); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidHeartbeat, err)
+	}
+	h.seen.Add(id, struct{}{})
+	h.latest.Add(packet.NodeID, packet.Timestamp)
+
+	if err := h.backend.DeliverHeartbeat(packet); err != nil {
+		log.Debug("Failed to record heartbeat", "node", packet.NodeID, "err", err)
+	}
+	h.broadcast(packet, id)
+	return nil
+}
+
+// handleNewBlock hands a propagated block to the backend for scheduling.
+func (h *Handler) handleNewBlock(peer *Peer, block *types.Block) error {
+	peer.markBlock(block.Hash())
+	return h.backend.DeliverBlock(peer.ID(), block)
+}
+
+// minGap returns the minimum number of seconds between two accepted
+// heartbeats of the same node.
+func (h *Handler) minGap() uint64 {
+	if gap := uint64(h.interval / time.Second / 2); gap > 0 {
+		return gap
+	}
+	return 1
+}
+
+// broadcast queues the heartbeat for all peers not known to have it.
+func (h *Handler) broadcast(packet *HeartbeatPacket, id common.Hash) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for _, peer := range h.peers {
+		if !peer.KnownHeartbeat(id) {
+			peer.AsyncSendHeartbeat(packet, id)
+		}
+	}
+}
+
+// BroadcastBlock propagates a block to all peers not known to have it.
+func (h *Handler) BroadcastBlock(block *types.Block) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	hash := block.Hash()
+	for _, peer := range h.peers {
+		if !peer.KnownBlock(hash) {
+			peer.AsyncSendNewBlock(block)
+		}
+	}
+}
+
+// BroadcastDecryptionShares propagates decryption shares to all peers not
+// known to have them.
+func (h *Handler) BroadcastDecryptionShares(shares []DecryptionShare) {
+	if len(shares) == 0 {
+		return
+	}
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for _, peer := range h.peers {
+		var unknown []DecryptionShare
+		for i := range shares {
+			if !peer.KnownDecryptionShare(shares[i].ID()) {
+				unknown = append(unknown, shares[i])
+			}
+		}
+		if len(unknown) > 0 {
+			peer.AsyncSendDecryptionShares(unknown)
+		}
+	}
+}
+
+// RequestSecrets sends a secret request to a peer.
+func (h *Handler) RequestSecrets(id string, packet *SecretRequestPacket) error {
+	h.lock.RLock()
+	peer := h.peers[id]
+	h.lock.RUnlock()
+
+	if peer == nil {
+		return fmt.Errorf("peer %s not connected", id)
+	}
+	return p2p.Send(peer.rw, SecretRequestMsg, packet)
+}
+
+// DropPeer disconnects a peer that sent invalid data.
+func (h *Handler) DropPeer(id string) {
+	h.lock.RLock()
+	peer := h.peers[id]
+	h.lock.RUnlock()
+
+	if peer != nil {
+		peer.Disconnect(p2p.DiscUselessPeer)
+	}
+}
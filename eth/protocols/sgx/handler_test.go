@@ -0,0 +1,403 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"golang.org/x/time/rate"
+)
+
+var errBadQuote = errors.New("bad quote")
+
+// testBackend accepts every heartbeat and attestation whose quote is not
+// "bad", and serves a single secret to attested peers.
+type testBackend struct {
+	lock      sync.Mutex
+	delivered []*HeartbeatPacket
+	blocks    []*types.Block
+	attested  map[enode.ID]bool
+	secrets   []*SecretsPacket
+	shares    map[common.Hash]bool
+}
+
+func (b *testBackend) MakeHeartbeat(observed []common.Address) (*HeartbeatPacket, error) {
+	return &HeartbeatPacket{NodeID: common.Address{0xff}, Timestamp: uint64(time.Now().Unix()), Observed: observed}, nil
+}
+
+func (b *testBackend) VerifyHeartbeat(packet *HeartbeatPacket) error {
+	if string(packet.Quote) == "bad" {
+		return errBadQuote
+	}
+	return nil
+}
+
+func (b *testBackend) DeliverHeartbeat(packet *HeartbeatPacket) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.delivered = append(b.delivered, packet)
+	return nil
+}
+
+func (b *testBackend) DeliverBlock(peer string, block *types.Block) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.blocks = append(b.blocks, block)
+	return nil
+}
+
+func (b *testBackend) MakeAttestation() (*AttestationPacket, error) {
+	return &AttestationPacket{Quote: []byte("ok"), SessionKey: []byte{0x04}}, nil
+}
+
+func (b *testBackend) VerifyAttestation(peer enode.ID, packet *AttestationPacket) error {
+	if string(packet.Quote) == "bad" {
+		return errBadQuote
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.attested == nil {
+		b.attested = make(map[enode.ID]bool)
+	}
+	b.attested[peer] = true
+	return nil
+}
+
+func (b *testBackend) HandleSecretRequest(peer enode.ID, packet *SecretRequestPacket) (*SecretsPacket, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.attested[peer] {
+		return nil, errors.New("peer not attested")
+	}
+	return &SecretsPacket{RequestID: packet.RequestID, Secrets: []Secret{{ID: "secret", Type: packet.Types[0], Data: []byte("data")}}}, nil
+}
+
+func (b *testBackend) DeliverSecrets(peer enode.ID, packet *SecretsPacket) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.secrets = append(b.secrets, packet)
+	return nil
+}
+
+func (b *testBackend) DeliverDecryptionShares(shares []DecryptionShare) ([]DecryptionShare, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.shares == nil {
+		b.shares = make(map[common.Hash]bool)
+	}
+	var fresh []DecryptionShare
+	for _, share := range shares {
+		if string(share.Share) == "bad" {
+			return nil, errors.New("invalid share")
+		}
+		if !b.shares[share.ID()] {
+			b.shares[share.ID()] = true
+			fresh = append(fresh, share)
+		}
+	}
+	return fresh, nil
+}
+
+func (b *testBackend) count() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.delivered)
+}
+
+// newTestPeer registers a peer with the handler without starting its
+// broadcast loop, so queued heartbeats can be inspected directly.
+func newTestPeer(h *Handler, id byte) (*Peer, *p2p.MsgPipeRW) {
+	app, net := p2p.MsgPipe()
+	peer := NewPeer(SGX1, p2p.NewPeer(enode.ID{id}, "test", nil), net)
+	h.peers[peer.ID()] = peer
+	return peer, app
+}
+
+func TestHandleHeartbeat(t *testing.T) {
+	var (
+		backend = new(testBackend)
+		h       = NewHandler(backend, 10*time.Second)
+		now     = time.Unix(1_000_000, 0)
+		a, _    = newTestPeer(h, 1)
+		b, _    = newTestPeer(h, 2)
+	)
+	hb := &HeartbeatPacket{NodeID: common.Address{1}, Timestamp: uint64(now.Unix()), Quote: []byte("ok")}
+
+	// A new heartbeat is delivered and relayed to peers that don't know it.
+	if err := h.handleHeartbeat(a, hb, now); err != nil {
+		t.Fatalf("heartbeat rejected: %v", err)
+	}
+	if backend.count() != 1 {
+		t.Fatalf("delivered %d heartbeats, want 1", backend.count())
+	}
+	if len(a.queue) != 0 || len(b.queue) != 1 {
+		t.Fatalf("relay queues: a=%d b=%d, want 0 and 1", len(a.queue), len(b.queue))
+	}
+
+	// Duplicates from another peer are dropped, also when the fields not
+	// bound by the quote were changed.
+	if err := h.handleHeartbeat(b, hb, now); err != nil {
+		t.Fatalf("duplicate rejected: %v", err)
+	}
+	resigned := *hb
+	resigned.Signature, resigned.ProducerID = []byte{0x01}, []byte{0x02}
+	if resigned.ID() != hb.ID() {
+		t.Fatalf("unbound fields change the heartbeat ID")
+	}
+	if err := h.handleHeartbeat(b, &resigned, now); err != nil {
+		t.Fatalf("re-signed duplicate rejected: %v", err)
+	}
+	if backend.count() != 1 {
+		t.Fatalf("duplicate delivered")
+	}
+
+	// A second heartbeat of the same node within half an interval is dropped,
+	// a later one accepted.
+	early := &HeartbeatPacket{NodeID: hb.NodeID, Timestamp: hb.Timestamp + 2, Quote: []byte("ok")}
+	if err := h.handleHeartbeat(a, early, now.Add(2*time.Second)); err != nil || backend.count() != 1 {
+		t.Fatalf("early heartbeat: err=%v delivered=%d", err, backend.count())
+	}
+	next := &HeartbeatPacket{NodeID: hb.NodeID, Timestamp: hb.Timestamp + 10, Quote: []byte("ok")}
+	if err := h.handleHeartbeat(a, next, now.Add(10*time.Second)); err != nil || backend.count() != 2 {
+		t.Fatalf("next heartbeat: err=%v delivered=%d", err, backend.count())
+	}
+
+	// Stale and future heartbeats are dropped without penalising the peer.
+	stale := &HeartbeatPacket{NodeID: common.Address{2}, Timestamp: uint64(now.Add(-time.Minute).Unix()), Quote: []byte("ok")}
+	future := &HeartbeatPacket{NodeID: common.Address{3}, Timestamp: uint64(now.Add(time.Minute).Unix()), Quote: []byte("ok")}
+	for _, packet := range []*HeartbeatPacket{stale, future} {
+		if err := h.handleHeartbeat(a, packet, now); err != nil {
+			t.Fatalf("out of window heartbeat rejected: %v", err)
+		}
+	}
+	if backend.count() != 2 {
+		t.Fatalf("out of window heartbeat delivered")
+	}
+
+	// Heartbeats failing verification are an error.
+	bad := &HeartbeatPacket{NodeID: common.Address{4}, Timestamp: uint64(now.Unix()), Quote: []byte("bad")}
+	if err := h.handleHeartbeat(a, bad, now); !errors.Is(err, errInvalidHeartbeat) {
+		t.Fatalf("expected errInvalidHeartbeat, got %v", err)
+	}
+
+	// Observed nodes are reported once their heartbeat was accepted.
+	if observed := h.observed(now); len(observed) != 1 || observed[0] != hb.NodeID {
+		t.Fatalf("unexpected observed nodes: %v", observed)
+	}
+}
+
+func TestHandleHeartbeatRateLimit(t *testing.T) {
+	var (
+		backend = new(testBackend)
+		h       = NewHandler(backend, 10*time.Second)
+		now     = time.Unix(1_000_000, 0)
+		peer, _ = newTestPeer(h, 1)
+	)
+	peer.limiter = rate.NewLimiter(0, 2)
+	for i := byte(0); i < 5; i++ {
+		hb := &HeartbeatPacket{NodeID: common.Address{i}, Timestamp: uint64(now.Unix()), Quote: []byte("ok")}
+		if err := h.handleHeartbeat(peer, hb, now); err != nil {
+			t.Fatalf("heartbeat %d rejected: %v", i, err)
+		}
+	}
+	if backend.count() != 2 {
+		t.Fatalf("delivered %d heartbeats, want 2", backend.count())
+	}
+}
+
+func TestInvalidHeartbeatDisconnects(t *testing.T) {
+	var (
+		backend = new(testBackend)
+		h       = NewHandler(backend, 10*time.Second)
+	)
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.runPeer(NewPeer(SGX1, p2p.NewPeer(enode.ID{1}, "test", nil), net))
+	}()
+	if err := p2p.ExpectMsg(app, AttestationMsg, nil); err != nil {
+		t.Fatal(err)
+	}
+	good := &HeartbeatPacket{NodeID: common.Address{1}, Timestamp: uint64(time.Now().Unix()), Quote: []byte("ok")}
+	if err := p2p.Send(app, HeartbeatMsg, good); err != nil {
+		t.Fatal(err)
+	}
+	bad := &HeartbeatPacket{NodeID: common.Address{2}, Timestamp: uint64(time.Now().Unix()), Quote: []byte("bad")}
+	if err := p2p.Send(app, HeartbeatMsg, bad); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, errInvalidHeartbeat) {
+			t.Fatalf("expected errInvalidHeartbeat, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer not disconnected")
+	}
+	if backend.count() != 1 {
+		t.Fatalf("delivered %d heartbeats, want 1", backend.count())
+	}
+}
+
+func TestNewBlockPropagation(t *testing.T) {
+	var (
+		backend = new(testBackend)
+		h       = NewHandler(backend, 10*time.Second)
+	)
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	peer := NewPeer(SGX1, p2p.NewPeer(enode.ID{1}, "test", nil), net)
+	other, _ := newTestPeer(h, 2)
+	go h.runPeer(peer)
+	if err := p2p.ExpectMsg(app, AttestationMsg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	block := types.NewBlockWithHeader(&types.Header{Number: common.Big1, Difficulty: common.Big1})
+	if err := p2p.Send(app, NewBlockMsg, &NewBlockPacket{Block: block}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		backend.lock.Lock()
+		n := len(backend.blocks)
+		backend.lock.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("block not delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Broadcasting skips the peer the block came from.
+	h.BroadcastBlock(block)
+	if len(other.queuedBlocks) != 1 {
+		t.Fatalf("block not queued for other peer")
+	}
+	if !peer.KnownBlock(block.Hash()) {
+		t.Fatalf("block not marked known for sender")
+	}
+	if len(peer.queuedBlocks) != 0 {
+		t.Fatalf("block echoed back to sender")
+	}
+}
+
+// Tests that peers exchange attestations on connect and that secrets are
+// only served to attested peers.
+func TestSecretSync(t *testing.T) {
+	var (
+		backend = new(testBackend)
+		h       = NewHandler(backend, 10*time.Second)
+	)
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	go h.runPeer(NewPeer(SGX1, p2p.NewPeer(enode.ID{1}, "test", nil), net))
+
+	// The local attestation is sent on connect
+	msg, err := app.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Code != AttestationMsg {
+		t.Fatalf("first message %d, want attestation", msg.Code)
+	}
+	msg.Discard()
+
+	// Secret requests of unattested peers are ignored
+	request := &SecretRequestPacket{RequestID: common.Hash{0x01}, Types: []uint8{5}}
+	if err := p2p.Send(app, SecretRequestMsg, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.Send(app, AttestationMsg, &AttestationPacket{Quote: []byte("ok")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.Send(app, SecretRequestMsg, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2p.ExpectMsg(app, SecretsMsg, &SecretsPacket{RequestID: request.RequestID, Secrets: []Secret{{ID: "secret", Type: 5, Data: []byte("data")}}}); err != nil {
+		t.Fatal(err)
+	}
+	// Responses are delivered to the backend
+	if err := p2p.Send(app, SecretsMsg, &SecretsPacket{RequestID: common.Hash{0x02}}); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- h.RequestSecrets(enode.ID{1}.String(), request) }()
+	if err := p2p.ExpectMsg(app, SecretRequestMsg, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		backend.lock.Lock()
+		n := len(backend.secrets)
+		backend.lock.Unlock()
+		if n == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("secrets not delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if backend.secrets[0].RequestID != (common.Hash{0x02}) {
+		t.Fatalf("delivered secrets %v", backend.secrets[0])
+	}
+}
+
+// Tests that new decryption shares are relayed to the peers not knowing
+// them, and that peers relaying invalid shares are an error.
+func TestDecryptionShareRelay(t *testing.T) {
+	var (
+		backend = new(testBackend)
+		h       = NewHandler(backend, 10*time.Second)
+		a, _    = newTestPeer(h, 1)
+		b, _    = newTestPeer(h, 2)
+		c, _    = newTestPeer(h, 3)
+	)
+
+	shares := []DecryptionShare{{Ephemeral: []byte{0x02}, Share: []byte{0x01}}}
+	if err := h.handleDecryptionShares(a, shares); err != nil {
+		t.Fatalf("shares rejected: %v", err)
+	}
+	if len(a.queuedShares) != 0 || len(b.queuedShares) != 1 || len(c.queuedShares) != 1 {
+		t.Fatalf("relay queues: a=%d b=%d c=%d, want 0, 1 and 1", len(a.queuedShares), len(b.queuedShares), len(c.queuedShares))
+	}
+	// Known shares are not relayed again
+	if err := h.handleDecryptionShares(b, shares); err != nil {
+		t.Fatalf("duplicate rejected: %v", err)
+	}
+	if len(a.queuedShares) != 0 || len(b.queuedShares) != 1 || len(c.queuedShares) != 1 {
+		t.Fatalf("duplicate relayed")
+	}
+	bad := []DecryptionShare{{Ephemeral: []byte{0x02}, Share: []byte("bad")}}
+	if err := h.handleDecryptionShares(a, bad); !errors.Is(err, errInvalidShares) {
+		t.Fatalf("expected errInvalidShares, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxKnownHeartbeats is the maximum heartbeat IDs to keep in the known list
+	// per peer, to prevent sending them back or announcing them twice.
+	maxKnownHeartbeats = 4096
+
+	// maxQueuedHeartbeats is the maximum number of heartbeats to queue up before
+	// dropping broadcasts to a slow peer.
+	maxQueuedHeartbeats = 128
+
+	// maxKnownBlocks is the maximum block hashes to keep in the known list
+	// per peer, to prevent sending them back or announcing them twice.
+	maxKnownBlocks = 1024
+
+	// maxQueuedBlocks is the maximum number of block propagations to queue up
+	// before dropping broadcasts. There's not much point in queueing stale
+	// blocks, so a few that might cover uncles should be enough.
+	maxQueuedBlocks = 4
+
+	// maxKnownShares is the maximum decryption share IDs to keep in the known
+	// list per peer, to prevent sending them back or announcing them twice.
+	maxKnownShares = 16384
+
+	// maxQueuedShares is the maximum number of decryption share batches to
+	// queue up before dropping broadcasts to a slow peer.
+	maxQueuedShares = 16
+
+	// peerHeartbeatRate and peerHeartbeatBurst limit how many heartbeats a
+	// single peer may relay to us, across all origins.
+	peerHeartbeatRate  = 20
+	peerHeartbeatBurst = 200
+)
+
+// Peer is a collection of relevant information we have about a `sgx` peer.
+type Peer struct {
+	id string // Unique ID for the peer, cached
+
+	*p2p.Peer                   // The embedded P2P package peer
+	rw        p2p.MsgReadWriter // Input/output streams for sgx
+	version   uint              // Protocol version negotiated
+
+	known   *lru.Cache[common.Hash, struct{}] // Heartbeats known to the peer
+	queue   chan *HeartbeatPacket             // Queue of heartbeats to broadcast
+	limiter *rate.Limiter                     // Inbound heartbeat rate limit
+
+	knownBlocks  *lru.Cache[common.Hash, struct{}] // Blocks known to the peer
+	queuedBlocks chan *types.Block                 // Queue of blocks to broadcast
+
+	knownShares  *lru.Cache[common.Hash, struct{}] // Decryption shares known to the peer
+	queuedShares chan []DecryptionShare            // Queue of decryption shares to broadcast
+
+	logger log.Logger // Contextual logger with the peer id injected
+	term   chan struct{}
+}
+
+// NewPeer creates a wrapper for a network connection and negotiated protocol
+// version.
+func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+	id := p.ID().String()
+	return &Peer{
+		id:      id,
+		Peer:    p,
+		rw:      rw,
+		version: version,
+		known:   lru.NewCache[common.Hash, struct{}](maxKnownHeartbeats),
+		queue:   make(chan *HeartbeatPacket, maxQueuedHeartbeats),
+		limiter: rate.NewLimiter(peerHeartbeatRate, peerHeartbeatBurst),
+
+		knownBlocks:  lru.NewCache[common.Hash, struct{}](maxKnownBlocks),
+		queuedBlocks: make(chan *types.Block, maxQueuedBlocks),
+		knownShares:  lru.NewCache[common.Hash, struct{}](maxKnownShares),
+		queuedShares: make(chan []DecryptionShare, maxQueuedShares),
+		logger:       log.New("peer", id[:8]),
+		term:         make(chan struct{}),
+	}
+}
+
+// ID retrieves the peer's unique identifier.
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// Version retrieves the peer's negotiated `sgx` protocol version.
+func (p *Peer) Version() uint {
+	return p.version
+}
+
+// Log overrides the P2P logger with the higher level one containing only the id.
+func (p *Peer) Log() log.Logger {
+	return p.logger
+}
+
+// close signals the broadcast goroutine to terminate.
+func (p *Peer) close() {
+	close(p.term)
+}
+
+// KnownHeartbeat returns whether the peer is known to have the heartbeat.
+func (p *Peer) KnownHeartbeat(id common.Hash) bool {
+	return p.known.Contains(id)
+}
+
+// markHeartbeat marks a heartbeat as known for the peer.
+func (p *Peer) markHeartbeat(id common.Hash) {
+	p.known.Add(id, struct{}{})
+}
+
+// AsyncSendHeartbeat queues a heartbeat for propagation to the peer. If the
+// peer's broadcast queue is full, the heartbeat is silently dropped.
+func (p *Peer) AsyncSendHeartbeat(packet *HeartbeatPacket, id common.Hash) {
+	select {
+	case p.queue <- packet:
+		p.markHeartbeat(id)
+	default:
+		p.Log().Debug("Dropping heartbeat propagation", "node", packet.NodeID)
+	}
+}
+
+// KnownBlock returns whether the peer is known to already have a block.
+func (p *Peer) KnownBlock(hash common.Hash) bool {
+	return p.knownBlocks.Contains(hash)
+}
+
+// markBlock marks a block as known for the peer.
+func (p *Peer) markBlock(hash common.Hash) {
+	p.knownBlocks.Add(hash, struct{}{})
+}
+
+// AsyncSendNewBlock queues an entire block for propagation to the peer. If
+// the peer's broadcast queue is full, the block is silently dropped.
+func (p *Peer) AsyncSendNewBlock(block *types.Block) {
+	select {
+	case p.queuedBlocks <- block:
+		p.markBlock(block.Hash())
+	default:
+		p.Log().Debug("Dropping block propagation", "number", block.NumberU64(), "hash", block.Hash())
+	}
+}
+
+// KnownDecryptionShare returns whether the peer is known to have a decryption
+// share.
+func (p *Peer) KnownDecryptionShare(id common.Hash) bool {
+	return p.knownShares.Contains(id)
+}
+
+// markDecryptionShare marks a decryption share as known for the peer.
+func (p *Peer) markDecryptionShare(id common.Hash) {
+	p.knownShares.Add(id, struct{}{})
+}
+
+// AsyncSendDecryptionShares queues decryption shares for propagation to the
+// peer. If the peer's broadcast queue is full, the shares are silently
+// dropped.
+func (p *Peer) AsyncSendDecryptionShares(shares []DecryptionShare) {
+	select {
+	case p.queuedShares <- shares:
+		for i := range shares {
+			p.markDecryptionShare(shares[i].ID())
+		}
+	default:
+		p.Log().Debug("Dropping decryption share propagation", "count", len(shares))
+	}
+}
+
+// broadcast is a write loop that sends queued heartbeats, blocks and shares to the
+// remote peer. The goal is to have an async writer that does not lock up the
+// node internals.
+func (p *Peer) broadcast() {
+	for {
+		select {
+		case packet := <-p.queue:
+			if err := p2p.Send(p.rw, HeartbeatMsg, packet); err != nil {
+				return
+			}
+		case block := <-p.queuedBlocks:
+			if err := p2p.Send(p.rw, NewBlockMsg, &NewBlockPacket{Block: block}); err != nil {
+				return
+			}
+		case shares := <-p.queuedShares:
+			if err := p2p.Send(p.rw, DecryptionSharesMsg, &DecryptionSharesPacket{Shares: shares}); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
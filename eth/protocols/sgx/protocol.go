@@ -0,0 +1,179 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	SGX1 = 1
+)
+
+// ProtocolName is the official short name of the `sgx` protocol used during
+// devp2p capability negotiation.
+const ProtocolName = "sgx"
+
+// ProtocolVersions are the supported versions of the `sgx` protocol (first
+// is primary).
+var ProtocolVersions = []uint{SGX1}
+
+// protocolLengths are the number of implemented message corresponding to
+// different protocol versions.
+var protocolLengths = map[uint]uint64{SGX1: 6}
+
+// maxMessageSize is the maximum cap on the size of a protocol message. It
+// has to fit a full candidate block.
+const maxMessageSize = 10 * 1024 * 1024
+
+const (
+	HeartbeatMsg        = 0x00
+	NewBlockMsg         = 0x01
+	AttestationMsg      = 0x02
+	SecretRequestMsg    = 0x03
+	SecretsMsg          = 0x04
+	DecryptionSharesMsg = 0x05
+)
+
+// maxSecrets is the maximum number of secrets in a SecretsMsg.
+const maxSecrets = 1024
+
+// maxDecryptionShares is the maximum number of shares in a DecryptionSharesMsg.
+const maxDecryptionShares = 1024
+
+var (
+	errMsgTooLarge      = errors.New("message too long")
+	errDecode           = errors.New("invalid message")
+	errInvalidMsgCode   = errors.New("invalid message code")
+	errInvalidHeartbeat = errors.New("invalid heartbeat")
+	errInvalidBlock     = errors.New("invalid block")
+	errInvalidSecrets   = errors.New("invalid secrets")
+	errInvalidShares    = errors.New("invalid decryption shares")
+)
+
+// Packet represents a p2p message in the `sgx` protocol.
+type Packet interface {
+	Name() string // Name returns a string corresponding to the message type.
+	Kind() byte   // Kind returns the message type.
+}
+
+// HeartbeatPacket is the liveness announcement of a node, attested by an SGX
+// quote whose user data commits to the other fields. Besides proving that the
+// sender is online, it lists the nodes the sender has recently heard from.
+type HeartbeatPacket struct {
+	NodeID    common.Address   // Address derived from the sender's platform instance ID
+	Timestamp uint64           // Unix time at which the heartbeat was created
+	Observed  []common.Address // Nodes recently seen online by the sender
+	Quote     []byte           // SGX quote binding the fields above
+	Signature []byte           // Optional signature, unused by the protocol
+
+	ProducerID []byte `rlp:"optional"` // Platform instance ID of the sender, checked against the quote
+}
+
+func (*HeartbeatPacket) Name() string { return "Heartbeat" }
+func (*HeartbeatPacket) Kind() byte   { return HeartbeatMsg }
+
+// ID returns the hash identifying the heartbeat for de-duplication. It only
+// covers the quote and the fields bound by it, so copies with a stripped or
+// replaced signature or producer ID are still recognised as duplicates.
+func (p *HeartbeatPacket) ID() common.Hash {
+	enc, _ := rlp.EncodeToBytes([]interface{}{p.NodeID, p.Timestamp, p.Observed, p.Quote})
+	return crypto.Keccak256Hash(enc)
+}
+
+// NewBlockPacket is the propagation of a freshly sealed block. Unlike the
+// merged eth protocol, every producer broadcasts its block so that nodes can
+// collect all competing candidates of a height.
+type NewBlockPacket struct {
+	Block *types.Block
+}
+
+func (*NewBlockPacket) Name() string { return "NewBlock" }
+func (*NewBlockPacket) Kind() byte   { return NewBlockMsg }
+
+// sanityCheck verifies that the values are reasonable, as a DoS protection.
+func (p *NewBlockPacket) sanityCheck() error {
+	if p.Block == nil {
+		return errors.New("missing block")
+	}
+	return p.Block.SanityCheck()
+}
+
+// AttestationPacket announces the session key secrets are encrypted to for
+// the sender, with a quote of the sender's enclave binding the key to the
+// sender's node ID.
+type AttestationPacket struct {
+	Quote      []byte // SGX quote over the session report data
+	SessionKey []byte // Uncompressed secp256k1 session public key
+}
+
+func (*AttestationPacket) Name() string { return "Attestation" }
+func (*AttestationPacket) Kind() byte   { return AttestationMsg }
+
+// SecretRequestPacket requests the secrets of the given types from an
+// attested peer.
+type SecretRequestPacket struct {
+	RequestID common.Hash
+	Types     []uint8 // storage.SecretDataType values
+}
+
+func (*SecretRequestPacket) Name() string { return "SecretRequest" }
+func (*SecretRequestPacket) Kind() byte   { return SecretRequestMsg }
+
+// SecretsPacket is the response to a SecretRequestPacket. The data of every
+// secret is encrypted to the session key of the requester.
+type SecretsPacket struct {
+	RequestID common.Hash
+	Secrets   []Secret
+}
+
+// Secret is an encrypted secret in a SecretsPacket.
+type Secret struct {
+	ID   string
+	Type uint8
+	Data []byte
+}
+
+func (*SecretsPacket) Name() string { return "Secrets" }
+func (*SecretsPacket) Kind() byte   { return SecretsMsg }
+
+// DecryptionSharesPacket gossips the decryption shares the holders of the
+// transaction key release for committed encrypted transactions.
+type DecryptionSharesPacket struct {
+	Shares []DecryptionShare
+}
+
+// DecryptionShare is a decryption share of the ephemeral key of a committed
+// encrypted payload.
+type DecryptionShare struct {
+	Ephemeral []byte // Compressed ephemeral key of the payload
+	Share     []byte // Share index, decryption share and its proof
+}
+
+// ID returns the hash identifying the share for de-duplication.
+func (s *DecryptionShare) ID() common.Hash {
+	return crypto.Keccak256Hash(s.Ephemeral, s.Share)
+}
+
+func (*DecryptionSharesPacket) Name() string { return "DecryptionShares" }
+func (*DecryptionSharesPacket) Kind() byte   { return DecryptionSharesMsg }
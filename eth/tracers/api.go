@@ -111,6 +111,16 @@ func (api *API) chainContext(ctx context.Context) core.ChainContext {
 
 // blockByNumber is the wrapper of the chain access function offered by the backend.
 // It will return an error if the block is not found.
+// sgxKeyStore returns the SGX key store of the chain at the given block for
+// the traced EVMs, nil if the backend has none. The key changes of the traced
+// transactions stay in memory.
+func (api *API) sgxKeyStore(block common.Hash) vm.KeyStore {
+	if b, ok := api.backend.(interface{ SGXKeyStore(common.Hash) vm.KeyStore }); ok {
+		return b.SGXKeyStore(block)
+	}
+	return nil
+}
+
 func (api *API) blockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
 	block, err := api.backend.BlockByNumber(ctx, number)
 	if err != nil {
@@ -271,6 +281,7 @@ func (api *API) traceChain(start, end *types.Block, config *TraceConfig, closed
 				var (
 					signer   = types.MakeSigner(api.backend.ChainConfig(), task.block.Number(), task.block.Time())
 					blockCtx = core.NewEVMBlockContext(task.block.Header(), api.chainContext(ctx), nil)
+					keys     = api.sgxKeyStore(task.block.ParentHash())
 				)
 				// Trace all the transactions contained within
 				for i, tx := range task.block.Transactions() {
@@ -281,7 +292,7 @@ func (api *API) traceChain(start, end *types.Block, config *TraceConfig, closed
 						TxIndex:     i,
 						TxHash:      tx.Hash(),
 					}
-					res, err := api.traceTx(ctx, tx, msg, txctx, blockCtx, task.statedb, config, nil)
+					res, err := api.traceTx(ctx, tx, msg, txctx, blockCtx, task.statedb, keys, config, nil)
 					if err != nil {
 						task.results[i] = &txTraceResult{TxHash: tx.Hash(), Error: err.Error()}
 						log.Warn("Tracing failed", "hash", tx.Hash(), "block", task.block.NumberU64(), "err", err)
@@ -538,7 +549,7 @@ func (api *API) IntermediateRoots(ctx context.Context, hash common.Hash, config
 		vmctx              = core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
 		deleteEmptyObjects = chainConfig.IsEIP158(block.Number())
 	)
-	evm := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{})
+	evm := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{SGXKeyStore: api.sgxKeyStore(block.ParentHash())})
 	if beaconRoot := block.BeaconRoot(); beaconRoot != nil {
 		core.ProcessBeaconBlockRoot(*beaconRoot, evm)
 	}
@@ -602,7 +613,8 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 	defer release()
 
 	blockCtx := core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
-	evm := vm.NewEVM(blockCtx, statedb, api.backend.ChainConfig(), vm.Config{})
+	keys := api.sgxKeyStore(block.ParentHash())
+	evm := vm.NewEVM(blockCtx, statedb, api.backend.ChainConfig(), vm.Config{SGXKeyStore: keys})
 	if beaconRoot := block.BeaconRoot(); beaconRoot != nil {
 		core.ProcessBeaconBlockRoot(*beaconRoot, evm)
 	}
@@ -634,7 +646,7 @@ func (api *API) traceBlock(ctx context.Context, block *types.Block, config *Trac
 			TxIndex:     i,
 			TxHash:      tx.Hash(),
 		}
-		res, err := api.traceTx(ctx, tx, msg, txctx, blockCtx, statedb, config, nil)
+		res, err := api.traceTx(ctx, tx, msg, txctx, blockCtx, statedb, keys, config, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -664,6 +676,9 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, stat
 		pend.Add(1)
 		go func() {
 			defer pend.Done()
+			// The key store is not safe for concurrent use either
+			keys := api.sgxKeyStore(block.ParentHash())
+
 			// Fetch and execute the next transaction trace tasks
 			for task := range jobs {
 				msg, _ := core.TransactionToMessage(txs[task.index], signer, block.BaseFee())
@@ -678,7 +693,7 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, stat
 				// concurrent use.
 				// See: https://github.com/ethereum/go-ethereum/issues/29114
 				blockCtx := core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
-				res, err := api.traceTx(ctx, txs[task.index], msg, txctx, blockCtx, task.statedb, config, nil)
+				res, err := api.traceTx(ctx, txs[task.index], msg, txctx, blockCtx, task.statedb, keys, config, nil)
 				if err != nil {
 					results[task.index] = &txTraceResult{TxHash: txs[task.index].Hash(), Error: err.Error()}
 					continue
@@ -691,7 +706,7 @@ func (api *API) traceBlockParallel(ctx context.Context, block *types.Block, stat
 	// Feed the transactions into the tracers and return
 	var failed error
 	blockCtx := core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
-	evm := vm.NewEVM(blockCtx, statedb, api.backend.ChainConfig(), vm.Config{})
+	evm := vm.NewEVM(blockCtx, statedb, api.backend.ChainConfig(), vm.Config{SGXKeyStore: api.sgxKeyStore(block.ParentHash())})
 
 txloop:
 	for i, tx := range txs {
@@ -780,7 +795,8 @@ func (api *API) standardTraceBlockToFile(ctx context.Context, block *types.Block
 		chainConfig, canon = overrideConfig(chainConfig, config.Overrides)
 	}
 
-	evm := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{})
+	keys := api.sgxKeyStore(block.ParentHash())
+	evm := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{SGXKeyStore: keys})
 	if beaconRoot := block.BeaconRoot(); beaconRoot != nil {
 		core.ProcessBeaconBlockRoot(*beaconRoot, evm)
 	}
@@ -818,8 +834,9 @@ func (api *API) standardTraceBlockToFile(ctx context.Context, block *types.Block
 			writer = bufio.NewWriter(dump)
 			tracer = logger.NewJSONLogger(&logConfig, writer)
 			evm    = vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{
-				Tracer:    tracer,
-				NoBaseFee: true,
+				Tracer:      tracer,
+				NoBaseFee:   true,
+				SGXKeyStore: keys,
 			})
 		)
 		// Execute the transaction and flush any traces to disk
@@ -901,7 +918,7 @@ func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *
 		TxIndex:     int(index),
 		TxHash:      hash,
 	}
-	return api.traceTx(ctx, tx, msg, txctx, vmctx, statedb, config, nil)
+	return api.traceTx(ctx, tx, msg, txctx, vmctx, statedb, api.sgxKeyStore(block.ParentHash()), config, nil)
 }
 
 // TraceCall lets you trace a given eth_call. It collects the structured logs
@@ -944,8 +961,10 @@ func (api *API) TraceCall(ctx context.Context, args ethapi.TransactionArgs, bloc
 		reexec = *config.Reexec
 	}
 
+	keys := api.sgxKeyStore(block.Hash())
 	if config != nil && config.TxIndex != nil {
 		_, _, statedb, release, err = api.backend.StateAtTransaction(ctx, block, int(*config.TxIndex), reexec)
+		keys = api.sgxKeyStore(block.ParentHash())
 	} else {
 		statedb, release, err = api.backend.StateAtBlock(ctx, block, reexec, nil, true, false)
 	}
@@ -1000,13 +1019,13 @@ func (api *API) TraceCall(ctx context.Context, args ethapi.TransactionArgs, bloc
 	if config != nil {
 		traceConfig = &config.TraceConfig
 	}
-	return api.traceTx(ctx, tx, msg, new(Context), blockContext, statedb, traceConfig, precompiles)
+	return api.traceTx(ctx, tx, msg, new(Context), blockContext, statedb, keys, traceConfig, precompiles)
 }
 
 // traceTx configures a new tracer according to the provided configuration, and
 // executes the given message in the provided environment. The return value will
 // be tracer dependent.
-func (api *API) traceTx(ctx context.Context, tx *types.Transaction, message *core.Message, txctx *Context, vmctx vm.BlockContext, statedb *state.StateDB, config *TraceConfig, precompiles vm.PrecompiledContracts) (interface{}, error) {
+func (api *API) traceTx(ctx context.Context, tx *types.Transaction, message *core.Message, txctx *Context, vmctx vm.BlockContext, statedb *state.StateDB, keys vm.KeyStore, config *TraceConfig, precompiles vm.PrecompiledContracts) (interface{}, error) {
 	var (
 		tracer  *Tracer
 		err     error
@@ -1031,7 +1050,7 @@ func (api *API) traceTx(ctx context.Context, tx *types.Transaction, message *cor
 		}
 	}
 	tracingStateDB := state.NewHookedState(statedb, tracer.Hooks)
-	evm := vm.NewEVM(vmctx, tracingStateDB, api.backend.ChainConfig(), vm.Config{Tracer: tracer.Hooks, NoBaseFee: true})
+	evm := vm.NewEVM(vmctx, tracingStateDB, api.backend.ChainConfig(), vm.Config{Tracer: tracer.Hooks, NoBaseFee: true, SGXKeyStore: keys})
 	if precompiles != nil {
 		evm.SetPrecompiles(precompiles)
 	}
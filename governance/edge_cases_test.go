@@ -256,12 +256,12 @@ t.Errorf("expected error %v, got %v", ErrValidatorNotFound, err)
 func TestVote_ProposalNotFound(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 proposalID := common.HexToHash("nonexistent")
-voter := common.HexToAddress("0x1")
+voter := testAccount(0x1)
 
-err := vm.Vote(proposalID, voter, true, nil)
+err := vm.Vote(proposalID, voter, true, signTestVote(testDomain, vm, proposalID, voter, true))
 if err != ErrProposalNotFound {
 t.Errorf("expected error %v, got %v", ErrProposalNotFound, err)
 }
@@ -270,9 +270,9 @@ t.Errorf("expected error %v, got %v", ErrProposalNotFound, err)
 func TestVote_AlreadyVoted(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
-proposer := common.HexToAddress("0x1")
+proposer := testAccount(0x1)
 validators.AddMockValidator(proposer, VoterTypeCore, 1)
 
 proposal := &Proposal{
@@ -284,10 +284,10 @@ CreatedAt: 100,
 proposalID, _ := vm.CreateProposal(proposal)
 
 // Vote once
-vm.Vote(proposalID, proposer, true, nil)
+vm.Vote(proposalID, proposer, true, signTestVote(testDomain, vm, proposalID, proposer, true))
 
 // Vote again
-err := vm.Vote(proposalID, proposer, false, nil)
+err := vm.Vote(proposalID, proposer, false, signTestVote(testDomain, vm, proposalID, proposer, false))
 if err != ErrAlreadyVoted {
 t.Errorf("expected error %v, got %v", ErrAlreadyVoted, err)
 }
@@ -296,9 +296,9 @@ t.Errorf("expected error %v, got %v", ErrAlreadyVoted, err)
 func TestCheckProposalStatus_NotPending(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
-proposer := common.HexToAddress("0x1")
+proposer := testAccount(0x1)
 proposal := &Proposal{
 Type:      ProposalAddMREnclave,
 Proposer:  proposer,
@@ -326,9 +326,9 @@ t.Error("status should remain passed")
 func TestCheckProposalStatus_StillVoting(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
-proposer := common.HexToAddress("0x1")
+proposer := testAccount(0x1)
 proposal := &Proposal{
 Type:      ProposalAddMREnclave,
 Proposer:  proposer,
@@ -354,7 +354,7 @@ t.Error("status should remain pending during voting period")
 func TestExecuteProposal_NotFound(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 proposalID := common.HexToHash("nonexistent")
 err := vm.ExecuteProposal(proposalID)
@@ -366,7 +366,7 @@ t.Errorf("expected error %v, got %v", ErrProposalNotFound, err)
 func TestGetProposal_NotFound(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 proposalID := common.HexToHash("nonexistent")
 _, err := vm.GetProposal(proposalID)
@@ -378,7 +378,7 @@ t.Errorf("expected error %v, got %v", ErrProposalNotFound, err)
 func TestGetProposalVotes_NotFound(t *testing.T) {
 config := DefaultWhitelistConfig()
 validators := NewMockValidatorManager()
-vm := NewInMemoryVotingManager(config, validators)
+vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 proposalID := common.HexToHash("nonexistent")
 _, err := vm.GetProposalVotes(proposalID)
@@ -393,7 +393,7 @@ voting := NewMockVotingManager()
 voting.shouldFailCreate = true
 wm := NewInMemoryWhitelistManager(config, voting)
 
-proposer := common.HexToAddress("0x1")
+proposer := testAccount(0x1)
 mrenclave := [32]byte{9, 9, 9}
 
 _, err := wm.ProposeAdd(proposer, mrenclave, "v1.0.0")
@@ -416,7 +416,7 @@ Status:    StatusActive,
 })
 
 voting.shouldFailCreate = true
-proposer := common.HexToAddress("0x1")
+proposer := testAccount(0x1)
 
 _, err := wm.ProposeRemove(proposer, mrenclave, "test reason")
 if err == nil {
@@ -439,7 +439,7 @@ PermissionLevel: PermissionBasic,
 })
 
 voting.shouldFailCreate = true
-proposer := common.HexToAddress("0x1")
+proposer := testAccount(0x1)
 
 _, err := wm.ProposeUpgrade(proposer, mrenclave, PermissionStandard)
 if err == nil {
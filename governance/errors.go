@@ -32,6 +32,7 @@ var (
 	ErrMREnclaveNotFound     = errors.New("MRENCLAVE not found")
 	ErrMREnclaveNotAllowed   = errors.New("MRENCLAVE not allowed")
 	ErrInvalidPermissionLevel = errors.New("invalid permission level")
+	ErrMREnclaveExists       = errors.New("MRENCLAVE already allowed")
 )
 
 // Voting errors
@@ -41,10 +42,18 @@ var (
 	ErrAlreadyVoted          = errors.New("voter has already voted on this proposal")
 	ErrInvalidVoter          = errors.New("voter is not authorized")
 	ErrInvalidSignature      = errors.New("invalid signature")
+	ErrMissingSignature      = errors.New("missing vote signature")
+	ErrNoVotingPower         = errors.New("no voting power at proposal creation")
 	ErrVotingPeriodEnded     = errors.New("voting period has ended")
 	ErrProposalNotPassed     = errors.New("proposal has not passed")
 	ErrExecutionDelayNotMet  = errors.New("execution delay not met")
 	ErrProposalAlreadyExecuted = errors.New("proposal already executed")
+	ErrProposalExists        = errors.New("proposal already exists")
+	ErrInvalidProposal       = errors.New("invalid proposal")
+	ErrInvalidProposer       = errors.New("proposer is not a validator")
+	ErrUnknownParameter      = errors.New("unknown parameter")
+	ErrInvalidParameter      = errors.New("invalid parameter value")
+	ErrUnsupportedProposal   = errors.New("proposal type not supported by executor")
 )
 
 // Validator errors
@@ -52,7 +61,11 @@ var (
 	ErrValidatorNotFound       = errors.New("validator not found")
 	ErrInsufficientStake       = errors.New("insufficient stake amount")
 	ErrValidatorNotActive      = errors.New("validator is not active")
+	ErrInvalidDelegation       = errors.New("invalid voting power delegation")
 	ErrInsufficientBalance     = errors.New("insufficient balance")
+	ErrValidatorSetFull        = errors.New("validator set is full")
+	ErrUnbondingQueueFull      = errors.New("unbonding queue is full")
+	ErrProducerBound           = errors.New("producer bound to another validator")
 )
 
 // Admission errors
@@ -62,6 +75,15 @@ var (
 	ErrNodeNotFound            = errors.New("node not found")
 )
 
+// Native contract errors
+var (
+	ErrUnknownMethod  = errors.New("unknown method")
+	ErrNotPayable     = errors.New("method is not payable")
+	ErrWriteProtected = errors.New("write in a static call")
+	ErrOutOfGas       = errors.New("out of gas")
+	ErrListTooLong    = errors.New("list exceeds the maximum length")
+)
+
 // Upgrade errors
 var (
 	ErrUpgradeReadOnlyMode = errors.New("node is in upgrade read-only mode, write operations are rejected")
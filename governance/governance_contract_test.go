@@ -28,7 +28,7 @@ whitelistCfg := DefaultWhitelistConfig()
 voting := NewMockVotingManager()
 whitelist := NewInMemoryWhitelistManager(whitelistCfg, voting)
 validators := NewMockValidatorManager()
-votingMgr := NewInMemoryVotingManager(whitelistCfg, validators)
+votingMgr := NewInMemoryVotingManager(whitelistCfg, testDomain, validators)
 validatorMgr := NewInMemoryValidatorManager(DefaultStakingConfig())
 
 gc := NewGovernanceContract(whitelist, votingMgr, validatorMgr)
@@ -53,7 +53,7 @@ whitelistCfg := DefaultWhitelistConfig()
 voting := NewMockVotingManager()
 whitelist := NewInMemoryWhitelistManager(whitelistCfg, voting)
 validators := NewMockValidatorManager()
-votingMgr := NewInMemoryVotingManager(whitelistCfg, validators)
+votingMgr := NewInMemoryVotingManager(whitelistCfg, testDomain, validators)
 validatorMgr := NewInMemoryValidatorManager(DefaultStakingConfig())
 
 gc := NewGovernanceContract(whitelist, votingMgr, validatorMgr)
@@ -75,7 +75,7 @@ whitelistCfg := DefaultWhitelistConfig()
 voting := NewMockVotingManager()
 whitelist := NewInMemoryWhitelistManager(whitelistCfg, voting)
 validators := NewMockValidatorManager()
-votingMgr := NewInMemoryVotingManager(whitelistCfg, validators)
+votingMgr := NewInMemoryVotingManager(whitelistCfg, testDomain, validators)
 validatorMgr := NewInMemoryValidatorManager(DefaultStakingConfig())
 
 gc := NewGovernanceContract(whitelist, votingMgr, validatorMgr)
@@ -101,13 +101,13 @@ whitelistCfg := DefaultWhitelistConfig()
 voting := NewMockVotingManager()
 whitelist := NewInMemoryWhitelistManager(whitelistCfg, voting)
 validators := NewMockValidatorManager()
-votingMgr := NewInMemoryVotingManager(whitelistCfg, validators)
+votingMgr := NewInMemoryVotingManager(whitelistCfg, testDomain, validators)
 validatorMgr := NewInMemoryValidatorManager(DefaultStakingConfig())
 
 gc := NewGovernanceContract(whitelist, votingMgr, validatorMgr)
 
 // Add validator
-voter := common.HexToAddress("0x1")
+voter := testAccount(0x1)
 validators.AddMockValidator(voter, VoterTypeCore, 1)
 
 // Create proposal
@@ -120,7 +120,7 @@ CreatedAt: 100,
 proposalID, _ := gc.CreateProposal(proposal)
 
 // Vote
-err := gc.Vote(proposalID, voter, true, nil)
+err := gc.Vote(proposalID, voter, true, signTestVote(testDomain, votingMgr, proposalID, voter, true))
 if err != nil {
 t.Fatalf("failed to vote: %v", err)
 }
@@ -131,7 +131,7 @@ whitelistCfg := DefaultWhitelistConfig()
 voting := NewMockVotingManager()
 whitelist := NewInMemoryWhitelistManager(whitelistCfg, voting)
 validators := NewMockValidatorManager()
-votingMgr := NewInMemoryVotingManager(whitelistCfg, validators)
+votingMgr := NewInMemoryVotingManager(whitelistCfg, testDomain, validators)
 validatorMgr := NewInMemoryValidatorManager(DefaultStakingConfig())
 
 gc := NewGovernanceContract(whitelist, votingMgr, validatorMgr)
@@ -155,7 +155,7 @@ whitelistCfg := DefaultWhitelistConfig()
 voting := NewMockVotingManager()
 whitelist := NewInMemoryWhitelistManager(whitelistCfg, voting)
 validators := NewMockValidatorManager()
-votingMgr := NewInMemoryVotingManager(whitelistCfg, validators)
+votingMgr := NewInMemoryVotingManager(whitelistCfg, testDomain, validators)
 validatorMgr := NewInMemoryValidatorManager(DefaultStakingConfig())
 
 gc := NewGovernanceContract(whitelist, votingMgr, validatorMgr)
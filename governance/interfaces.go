@@ -74,6 +74,10 @@ type VotingManager interface {
 
 	// CheckProposalStatus checks and updates proposal status based on current block
 	CheckProposalStatus(proposalID common.Hash, currentBlock uint64) error
+
+	// GetVotingPower returns the voting power of a voter on a proposal, as
+	// snapshotted when the proposal was created
+	GetVotingPower(proposalID common.Hash, voter common.Address) (uint64, error)
 }
 
 // ValidatorManager manages validators and their staking
@@ -110,6 +114,11 @@ type ValidatorManager interface {
 
 	// UpdateMREnclave updates the MRENCLAVE for a validator
 	UpdateMREnclave(addr common.Address, newMREnclave [32]byte) error
+
+	// Delegate delegates the voting power of a community validator to another
+	// community validator. Delegating to the validator itself or to the zero
+	// address removes the delegation.
+	Delegate(delegator, delegatee common.Address) error
 }
 
 // AdmissionController manages node admission based on SGX attestation
@@ -0,0 +1,596 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// GovernanceABI is the ABI of the native governance contract.
+const GovernanceABI = `[
+	{"name": "propose", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "proposalType", "type": "uint8"}, {"name": "target", "type": "bytes"}, {"name": "description", "type": "string"}],
+	 "outputs": [{"name": "proposalId", "type": "bytes32"}]},
+	{"name": "proposeAddMREnclave", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "mrenclave", "type": "bytes32"}, {"name": "version", "type": "string"}],
+	 "outputs": [{"name": "proposalId", "type": "bytes32"}]},
+	{"name": "proposeRemoveMREnclave", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "mrenclave", "type": "bytes32"}, {"name": "reason", "type": "string"}],
+	 "outputs": [{"name": "proposalId", "type": "bytes32"}]},
+	{"name": "proposeUpgradePermission", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "mrenclave", "type": "bytes32"}, {"name": "level", "type": "uint8"}],
+	 "outputs": [{"name": "proposalId", "type": "bytes32"}]},
+	{"name": "vote", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "proposalId", "type": "bytes32"}, {"name": "support", "type": "bool"}, {"name": "signature", "type": "bytes"}],
+	 "outputs": []},
+	{"name": "checkProposal", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "proposalId", "type": "bytes32"}],
+	 "outputs": [{"name": "status", "type": "uint8"}]},
+	{"name": "executeProposal", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "proposalId", "type": "bytes32"}],
+	 "outputs": []},
+	{"name": "stake", "type": "function", "stateMutability": "payable",
+	 "inputs": [{"name": "producerId", "type": "bytes32"}],
+	 "outputs": []},
+	{"name": "unstake", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "amount", "type": "uint256"}],
+	 "outputs": []},
+	{"name": "claimRewards", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [],
+	 "outputs": [{"name": "rewards", "type": "uint256"}]},
+	{"name": "pendingRewards", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "validator", "type": "address"}],
+	 "outputs": [{"name": "rewards", "type": "uint256"}]},
+	{"name": "unbonding", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "validator", "type": "address"}],
+	 "outputs": [{"name": "amount", "type": "uint256"}]},
+	{"name": "delegate", "type": "function", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "delegatee", "type": "address"}],
+	 "outputs": []},
+	{"name": "getProposal", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "proposalId", "type": "bytes32"}],
+	 "outputs": [
+		{"name": "proposalType", "type": "uint8"}, {"name": "proposer", "type": "address"},
+		{"name": "target", "type": "bytes"}, {"name": "description", "type": "string"},
+		{"name": "createdAt", "type": "uint64"}, {"name": "votingEndsAt", "type": "uint64"},
+		{"name": "executeAfter", "type": "uint64"}, {"name": "status", "type": "uint8"},
+		{"name": "coreYesVotes", "type": "uint64"}, {"name": "coreNoVotes", "type": "uint64"},
+		{"name": "communityYesVotes", "type": "uint64"}, {"name": "communityNoVotes", "type": "uint64"}]},
+	{"name": "getVotingPower", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "proposalId", "type": "bytes32"}, {"name": "voter", "type": "address"}],
+	 "outputs": [{"name": "power", "type": "uint64"}]},
+	{"name": "getActiveProposals", "type": "function", "stateMutability": "view",
+	 "inputs": [],
+	 "outputs": [{"name": "proposalIds", "type": "bytes32[]"}]},
+	{"name": "getValidator", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "validator", "type": "address"}],
+	 "outputs": [
+		{"name": "validatorType", "type": "uint8"}, {"name": "mrenclave", "type": "bytes32"},
+		{"name": "stake", "type": "uint256"}, {"name": "joinedAt", "type": "uint64"},
+		{"name": "lastActiveAt", "type": "uint64"}, {"name": "votingPower", "type": "uint64"},
+		{"name": "status", "type": "uint8"}, {"name": "delegate", "type": "address"}]},
+	{"name": "getValidators", "type": "function", "stateMutability": "view",
+	 "inputs": [],
+	 "outputs": [{"name": "validators", "type": "address[]"}]},
+	{"name": "isValidator", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "validator", "type": "address"}],
+	 "outputs": [{"name": "", "type": "bool"}]},
+	{"name": "getParameter", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "name", "type": "string"}],
+	 "outputs": [{"name": "value", "type": "uint64"}, {"name": "set", "type": "bool"}]}
+]`
+
+// SecurityConfigABI is the ABI of the native security config contract.
+const SecurityConfigABI = `[
+	{"name": "getAllowedMREnclaves", "type": "function", "stateMutability": "view",
+	 "inputs": [],
+	 "outputs": [{"name": "", "type": "bytes32[]"}]},
+	{"name": "getAllowedMRSigners", "type": "function", "stateMutability": "view",
+	 "inputs": [],
+	 "outputs": [{"name": "", "type": "bytes32[]"}]},
+	{"name": "isAllowed", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "mrenclave", "type": "bytes32"}],
+	 "outputs": [{"name": "", "type": "bool"}]},
+	{"name": "getEntry", "type": "function", "stateMutability": "view",
+	 "inputs": [{"name": "mrenclave", "type": "bytes32"}],
+	 "outputs": [
+		{"name": "version", "type": "string"}, {"name": "addedAt", "type": "uint64"},
+		{"name": "addBy", "type": "address"}, {"name": "permissionLevel", "type": "uint8"},
+		{"name": "status", "type": "uint8"}]},
+	{"name": "getUpgradeConfig", "type": "function", "stateMutability": "view",
+	 "inputs": [],
+	 "outputs": [
+		{"name": "newMREnclave", "type": "bytes32"}, {"name": "upgradeCompleteBlock", "type": "uint64"},
+		{"name": "upgradeStartBlock", "type": "uint64"}]}
+]`
+
+var (
+	governanceABI     = mustParseABI(GovernanceABI)
+	securityConfigABI = mustParseABI(SecurityConfigABI)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// CallContext is the context of a call to the native contract.
+type CallContext struct {
+	DB          StateDB
+	Caller      common.Address
+	Value       *uint256.Int // Value transferred to the contract by the call
+	ChainID     *big.Int     // Chain ID of the EIP-712 domain of votes
+	BlockNumber uint64
+	ReadOnly    bool   // Set within a static call frame
+	Gas         uint64 // Gas left for reading list entries, reduced by the call
+}
+
+// useGas charges the gas of reading entries list entries, failing with
+// ErrOutOfGas before they are read if the call cannot pay for them.
+func (ctx *CallContext) useGas(entries uint64) error {
+	if entries > ctx.Gas/params.GovernanceListEntryGas {
+		ctx.Gas = 0
+		return ErrOutOfGas
+	}
+	ctx.Gas -= entries * params.GovernanceListEntryGas
+	return nil
+}
+
+// methodHandler executes a method of the native contract on the decoded
+// arguments and returns the values of its outputs.
+type methodHandler func(c *NativeContract, ctx *CallContext, args []interface{}) ([]interface{}, error)
+
+// nativeMethod is a method of the native contract.
+type nativeMethod struct {
+	gas     uint64
+	perWord bool // charge GovernanceWordGas per word of the arguments
+	handler methodHandler
+}
+
+// NativeContract implements the governance contract and the security config
+// contract natively on their state, at the addresses configured in the SGX
+// chain config. Both contracts are served by the same instance, selected by
+// its address.
+type NativeContract struct {
+	address        common.Address
+	governance     common.Address
+	securityConfig common.Address
+
+	abi     abi.ABI
+	methods map[string]nativeMethod
+}
+
+// NewGovernanceNativeContract creates the native governance contract.
+func NewGovernanceNativeContract(governance, securityConfig common.Address) *NativeContract {
+	return &NativeContract{
+		address:        governance,
+		governance:     governance,
+		securityConfig: securityConfig,
+		abi:            governanceABI,
+		methods:        governanceMethods,
+	}
+}
+
+// NewSecurityConfigNativeContract creates the native security config contract.
+func NewSecurityConfigNativeContract(governance, securityConfig common.Address) *NativeContract {
+	return &NativeContract{
+		address:        securityConfig,
+		governance:     governance,
+		securityConfig: securityConfig,
+		abi:            securityConfigABI,
+		methods:        securityConfigMethods,
+	}
+}
+
+var governanceMethods = map[string]nativeMethod{
+	"propose":                  {params.GovernanceProposeGas, true, (*NativeContract).propose},
+	"proposeAddMREnclave":      {params.GovernanceProposeGas, true, (*NativeContract).proposeAddMREnclave},
+	"proposeRemoveMREnclave":   {params.GovernanceProposeGas, true, (*NativeContract).proposeRemoveMREnclave},
+	"proposeUpgradePermission": {params.GovernanceProposeGas, true, (*NativeContract).proposeUpgradePermission},
+	"vote":                     {params.GovernanceVoteGas, false, (*NativeContract).vote},
+	"checkProposal":            {params.GovernanceListGas, false, (*NativeContract).checkProposal},
+	"executeProposal":          {params.GovernanceExecuteGas, false, (*NativeContract).executeProposal},
+	"stake":                    {params.GovernanceStakeGas, false, (*NativeContract).stake},
+	"unstake":                  {params.GovernanceStakeGas, false, (*NativeContract).unstake},
+	"claimRewards":             {params.GovernanceStakeGas, false, (*NativeContract).claimRewards},
+	"pendingRewards":           {params.GovernanceReadGas, false, (*NativeContract).pendingRewards},
+	"unbonding":                {params.GovernanceListGas, false, (*NativeContract).unbonding},
+	"delegate":                 {params.GovernanceStakeGas, false, (*NativeContract).delegate},
+	"getProposal":              {params.GovernanceReadGas, false, (*NativeContract).getProposal},
+	"getVotingPower":           {params.GovernanceReadGas, false, (*NativeContract).getVotingPower},
+	"getActiveProposals":       {params.GovernanceListGas, false, (*NativeContract).getActiveProposals},
+	"getValidator":             {params.GovernanceReadGas, false, (*NativeContract).getValidator},
+	"getValidators":            {params.GovernanceListGas, false, (*NativeContract).getValidators},
+	"isValidator":              {params.GovernanceReadGas, false, (*NativeContract).isValidator},
+	"getParameter":             {params.GovernanceReadGas, false, (*NativeContract).getParameter},
+}
+
+var securityConfigMethods = map[string]nativeMethod{
+	"getAllowedMREnclaves": {params.GovernanceListGas, false, (*NativeContract).getAllowedMREnclaves},
+	"getAllowedMRSigners":  {params.GovernanceListGas, false, (*NativeContract).getAllowedMRSigners},
+	"isAllowed":            {params.GovernanceReadGas, false, (*NativeContract).isAllowed},
+	"getEntry":             {params.GovernanceReadGas, false, (*NativeContract).getEntry},
+	"getUpgradeConfig":     {params.GovernanceReadGas, false, (*NativeContract).getUpgradeConfig},
+}
+
+// Address returns the address the contract is served at.
+func (c *NativeContract) Address() common.Address {
+	return c.address
+}
+
+// RequiredGas returns the gas of a call. Methods creating proposals are also
+// charged for storing their arguments, and methods listing entries are charged
+// for reading them from the call context as they run.
+func (c *NativeContract) RequiredGas(input []byte) uint64 {
+	if len(input) < 4 {
+		return params.GovernanceReadGas
+	}
+	method, err := c.abi.MethodById(input[:4])
+	if err != nil {
+		return params.GovernanceReadGas
+	}
+	m, ok := c.methods[method.Name]
+	if !ok {
+		return params.GovernanceReadGas
+	}
+	if m.perWord {
+		return m.gas + uint64(len(input)-4+31)/32*params.GovernanceWordGas
+	}
+	return m.gas
+}
+
+// Run executes an ABI encoded call and returns the ABI encoded outputs.
+// Calls changing the state fail with ErrWriteProtected in a static call.
+func (c *NativeContract) Run(ctx *CallContext, input []byte) ([]byte, error) {
+	if len(input) < 4 {
+		return nil, ErrUnknownMethod
+	}
+	method, err := c.abi.MethodById(input[:4])
+	if err != nil {
+		return nil, ErrUnknownMethod
+	}
+	m, ok := c.methods[method.Name]
+	if !ok {
+		return nil, ErrUnknownMethod
+	}
+	if !method.IsPayable() && ctx.Value != nil && !ctx.Value.IsZero() {
+		return nil, ErrNotPayable
+	}
+	if !method.IsConstant() {
+		if ctx.ReadOnly {
+			return nil, ErrWriteProtected
+		}
+		touchContract(ctx.DB, c.governance)
+		touchContract(ctx.DB, c.securityConfig)
+	}
+	args, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := m.handler(c, ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return method.Outputs.Pack(outputs...)
+}
+
+// touchContract keeps a contract without code from being deleted as an empty
+// account when its storage changes.
+func touchContract(db StateDB, addr common.Address) {
+	if db.GetNonce(addr) == 0 {
+		db.SetNonce(addr, 1, tracing.NonceChangeUnspecified)
+	}
+}
+
+// managers returns the state-backed managers of the contracts at the block of
+// the call.
+func (c *NativeContract) managers(ctx *CallContext) (*StateWhitelistManager, *StateVotingManager, *StateValidatorManager) {
+	validators := NewStateValidatorManager(ctx.DB, c.governance, ctx.BlockNumber, NewStateParameters(ctx.DB, c.governance).StakingConfig())
+	voting := NewStateVotingManager(ctx.DB, c.governance, ctx.ChainID, ctx.BlockNumber, DefaultWhitelistConfig(), validators)
+	whitelist := NewStateWhitelistManager(ctx.DB, c.securityConfig, ctx.BlockNumber, DefaultWhitelistConfig(), voting)
+	return whitelist, voting, validators
+}
+
+// executor returns the executor applying the proposals of the governance
+// contract to the state.
+func (c *NativeContract) executor(ctx *CallContext) *ProposalExecutor {
+	whitelist, voting, validators := c.managers(ctx)
+	return NewProposalExecutor(voting, whitelist, validators,
+		NewStateParameters(ctx.DB, c.governance), NewStateSecurityConfig(ctx.DB, c.securityConfig))
+}
+
+// NewStateGovernanceContract creates the governance facade on the state of
+// the governance and security config contracts at the given block of the
+// chain chainID.
+func NewStateGovernanceContract(db StateDB, governance, securityConfig common.Address, chainID *big.Int, number uint64) *GovernanceContract {
+	c := NewGovernanceNativeContract(governance, securityConfig)
+	return NewGovernanceContract(c.managers(&CallContext{DB: db, ChainID: chainID, BlockNumber: number}))
+}
+
+// proposer checks that the caller may create proposals.
+func (c *NativeContract) proposer(ctx *CallContext) error {
+	_, _, validators := c.managers(ctx)
+	if !validators.IsValidator(ctx.Caller) {
+		return ErrInvalidProposer
+	}
+	return nil
+}
+
+func (c *NativeContract) propose(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	if err := c.proposer(ctx); err != nil {
+		return nil, err
+	}
+	ptype := ProposalType(args[0].(uint8))
+	if _, err := DecodeProposalPayload(ptype, args[1].([]byte)); err != nil {
+		return nil, err
+	}
+	_, voting, _ := c.managers(ctx)
+	id, err := voting.CreateProposal(&Proposal{
+		Type:        ptype,
+		Proposer:    ctx.Caller,
+		Target:      args[1].([]byte),
+		Description: args[2].(string),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{id}, nil
+}
+
+func (c *NativeContract) proposeAddMREnclave(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	if err := c.proposer(ctx); err != nil {
+		return nil, err
+	}
+	whitelist, _, _ := c.managers(ctx)
+	id, err := whitelist.ProposeAdd(ctx.Caller, args[0].([32]byte), args[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{id}, nil
+}
+
+func (c *NativeContract) proposeRemoveMREnclave(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	if err := c.proposer(ctx); err != nil {
+		return nil, err
+	}
+	whitelist, _, _ := c.managers(ctx)
+	id, err := whitelist.ProposeRemove(ctx.Caller, args[0].([32]byte), args[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{id}, nil
+}
+
+func (c *NativeContract) proposeUpgradePermission(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	if err := c.proposer(ctx); err != nil {
+		return nil, err
+	}
+	whitelist, _, _ := c.managers(ctx)
+	id, err := whitelist.ProposeUpgrade(ctx.Caller, args[0].([32]byte), PermissionLevel(args[1].(uint8)))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{id}, nil
+}
+
+func (c *NativeContract) vote(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, voting, _ := c.managers(ctx)
+	return nil, voting.Vote(args[0].([32]byte), ctx.Caller, args[1].(bool), args[2].([]byte))
+}
+
+func (c *NativeContract) checkProposal(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, voting, _ := c.managers(ctx)
+	id := common.Hash(args[0].([32]byte))
+	if err := voting.CheckProposalStatus(id, ctx.BlockNumber); err != nil {
+		return nil, err
+	}
+	proposal, err := voting.GetProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{uint8(proposal.Status)}, nil
+}
+
+func (c *NativeContract) executeProposal(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	return nil, c.executor(ctx).Execute(args[0].([32]byte), ctx.BlockNumber)
+}
+
+func (c *NativeContract) stake(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	amount := new(big.Int)
+	if ctx.Value != nil {
+		amount = ctx.Value.ToBig()
+	}
+	return nil, validators.bondProducer(ctx.Caller, args[0].([32]byte), amount)
+}
+
+func (c *NativeContract) unstake(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	return nil, validators.Unstake(ctx.Caller, args[0].(*big.Int))
+}
+
+func (c *NativeContract) claimRewards(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	rewards, err := validators.ClaimRewards(ctx.Caller)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{rewards}, nil
+}
+
+func (c *NativeContract) pendingRewards(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	return []interface{}{validators.PendingRewards(args[0].(common.Address))}, nil
+}
+
+func (c *NativeContract) unbonding(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	if err := ctx.useGas(validators.unbondingCount()); err != nil {
+		return nil, err
+	}
+	return []interface{}{validators.Unbonding(args[0].(common.Address))}, nil
+}
+
+func (c *NativeContract) delegate(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	return nil, validators.Delegate(ctx.Caller, args[0].(common.Address))
+}
+
+func (c *NativeContract) getProposal(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, voting, _ := c.managers(ctx)
+	p, err := voting.GetProposal(args[0].([32]byte))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		uint8(p.Type), p.Proposer, p.Target, p.Description,
+		p.CreatedAt, p.VotingEndsAt, p.ExecuteAfter, uint8(p.Status),
+		p.CoreYesVotes, p.CoreNoVotes, p.CommunityYesVotes, p.CommunityNoVotes,
+	}, nil
+}
+
+func (c *NativeContract) getVotingPower(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, voting, _ := c.managers(ctx)
+	power, err := voting.GetVotingPower(args[0].([32]byte), args[1].(common.Address))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{power}, nil
+}
+
+func (c *NativeContract) getActiveProposals(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, voting, _ := c.managers(ctx)
+	if err := ctx.useGas(min(voting.storage.getUint(slotHash(proposalListSlot)), maxListEntries)); err != nil {
+		return nil, err
+	}
+	ids := make([][32]byte, 0)
+	for _, p := range voting.GetActiveProposals() {
+		ids = append(ids, p.ID)
+	}
+	return []interface{}{ids}, nil
+}
+
+func (c *NativeContract) getValidator(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	v, err := validators.GetValidator(args[0].(common.Address))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		uint8(v.Type), v.MRENCLAVE, v.StakeAmount, v.JoinedAt,
+		v.LastActiveAt, v.VotingPower, uint8(v.Status), v.Delegate,
+	}, nil
+}
+
+func (c *NativeContract) getValidators(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	if err := ctx.useGas(validators.validatorCount()); err != nil {
+		return nil, err
+	}
+	all, err := validators.Validators()
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]common.Address, 0)
+	for _, v := range all {
+		addrs = append(addrs, v.Address)
+	}
+	return []interface{}{addrs}, nil
+}
+
+func (c *NativeContract) isValidator(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	_, _, validators := c.managers(ctx)
+	return []interface{}{validators.IsValidator(args[0].(common.Address))}, nil
+}
+
+func (c *NativeContract) getParameter(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	value, set := NewStateParameters(ctx.DB, c.governance).GetParameter(args[0].(string))
+	return []interface{}{value, set}, nil
+}
+
+// allowedList returns the allowed values of a whitelist list, like the
+// consensus engine reads them.
+func (c *NativeContract) allowedList(ctx *CallContext, mapSlot, listSlot uint64) ([][32]byte, error) {
+	s := contractStorage{db: ctx.DB, addr: c.securityConfig}
+	if err := ctx.useGas(s.getUint(slotHash(listSlot))); err != nil {
+		return nil, err
+	}
+	values, err := s.list(slotHash(listSlot))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		allowed = make([][32]byte, 0)
+		seen    = make(map[common.Hash]bool)
+	)
+	for _, value := range values {
+		if seen[value] || s.get(mappingSlot(value, slotHash(mapSlot))) == (common.Hash{}) {
+			continue
+		}
+		seen[value] = true
+		allowed = append(allowed, value)
+	}
+	return allowed, nil
+}
+
+func (c *NativeContract) getAllowedMREnclaves(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	allowed, err := c.allowedList(ctx, allowedMREnclavesSlot, mrEnclaveListSlot)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{allowed}, nil
+}
+
+func (c *NativeContract) getAllowedMRSigners(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	allowed, err := c.allowedList(ctx, allowedMRSignersSlot, mrSignerListSlot)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{allowed}, nil
+}
+
+func (c *NativeContract) isAllowed(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	whitelist, _, _ := c.managers(ctx)
+	return []interface{}{whitelist.IsAllowed(args[0].([32]byte))}, nil
+}
+
+func (c *NativeContract) getEntry(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	whitelist, _, _ := c.managers(ctx)
+	e, err := whitelist.GetEntry(args[0].([32]byte))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{e.Version, e.AddedAt, e.AddBy, uint8(e.PermissionLevel), uint8(e.Status)}, nil
+}
+
+func (c *NativeContract) getUpgradeConfig(ctx *CallContext, args []interface{}) ([]interface{}, error) {
+	config := NewStateSecurityConfig(ctx.DB, c.securityConfig).GetUpgradeConfig()
+	if config == nil {
+		return []interface{}{[32]byte{}, uint64(0), uint64(0)}, nil
+	}
+	return []interface{}{config.NewMREnclave, config.UpgradeCompleteBlock, config.UpgradeStartBlock}, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+func TestNativeContract(t *testing.T) {
+	statedb := newTestState(t)
+	gov := NewGovernanceNativeContract(testGovernance, testSecurityConfig)
+	sec := NewSecurityConfigNativeContract(testGovernance, testSecurityConfig)
+	staker := testAccount(1)
+	minStake := uint256.MustFromBig(DefaultStakingConfig().MinStakeAmount)
+	number := uint64(10)
+	gas := 16 * params.GovernanceListEntryGas
+
+	call := func(c *NativeContract, caller common.Address, value *uint256.Int, method string, args ...interface{}) ([]interface{}, error) {
+		t.Helper()
+		input, err := c.abi.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The EVM transfers the value before running the contract.
+		if value != nil {
+			statedb.SubBalance(caller, value, tracing.BalanceChangeTransfer)
+			statedb.AddBalance(c.Address(), value, tracing.BalanceChangeTransfer)
+		}
+		ret, err := c.Run(&CallContext{DB: statedb, Caller: caller, Value: value, ChainID: testDomain.ChainID, BlockNumber: number, Gas: gas}, input)
+		if err != nil {
+			return nil, err
+		}
+		out, err := c.abi.Unpack(method, ret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out, nil
+	}
+	statedb.AddBalance(staker, new(uint256.Int).Mul(minStake, uint256.NewInt(2)), tracing.BalanceChangeUnspecified)
+
+	if _, err := call(gov, staker, nil, "proposeAddMREnclave", [32]byte{1}, "v1"); !errors.Is(err, ErrInvalidProposer) {
+		t.Fatalf("proposal by non-validator: have %v, want %v", err, ErrInvalidProposer)
+	}
+	if _, err := call(gov, staker, minStake, "stake", [32]byte{}); err != nil {
+		t.Fatal(err)
+	}
+	input, _ := gov.abi.Pack("vote", [32]byte{}, true, []byte{})
+	if _, err := gov.Run(&CallContext{DB: statedb, Caller: staker, Value: minStake, BlockNumber: number}, input); !errors.Is(err, ErrNotPayable) {
+		t.Fatalf("value to non-payable method: have %v, want %v", err, ErrNotPayable)
+	}
+
+	// Voting power is snapshotted at the block before the proposal.
+	number = 11
+	out, err := call(gov, staker, nil, "proposeAddMREnclave", [32]byte{1}, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := out[0].([32]byte)
+	power := stakeVotingPower(minStake.ToBig())
+	if out, err = call(gov, staker, nil, "getVotingPower", id, staker); err != nil {
+		t.Fatal(err)
+	}
+	if have := out[0].(uint64); have != power {
+		t.Fatalf("have voting power %d, want %d", have, power)
+	}
+	validators := NewStateValidatorManager(statedb, testGovernance, number, DefaultStakingConfig())
+	voting := NewStateVotingManager(statedb, testGovernance, testDomain.ChainID, number, DefaultWhitelistConfig(), validators)
+	if _, err := call(gov, staker, nil, "vote", id, false, signTestVote(testDomain, voting, id, staker, false)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := call(gov, staker, nil, "delegate", testAccount(2)); !errors.Is(err, ErrInvalidDelegation) {
+		t.Fatalf("delegation to non-validator: have %v, want %v", err, ErrInvalidDelegation)
+	}
+
+	out, err = call(gov, staker, nil, "getProposal", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].(uint8) != uint8(ProposalAddMREnclave) || out[1].(common.Address) != staker ||
+		out[3].(string) != "Add MRENCLAVE version v1" || out[11].(uint64) != power {
+		t.Fatalf("unexpected proposal %v", out)
+	}
+	out, err = call(gov, staker, nil, "getActiveProposals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := out[0].([][32]byte); len(ids) != 1 || ids[0] != id {
+		t.Fatalf("unexpected active proposals %x", ids)
+	}
+	out, err = call(gov, staker, nil, "getValidator", staker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[2].(*big.Int).Cmp(minStake.ToBig()) != 0 || out[6].(uint8) != uint8(ValidatorStatusActive) {
+		t.Fatalf("unexpected validator %v", out)
+	}
+
+	// State changes are rejected in static calls.
+	input, _ = gov.abi.Pack("unstake", minStake.ToBig())
+	if _, err := gov.Run(&CallContext{DB: statedb, Caller: staker, BlockNumber: number, ReadOnly: true}, input); !errors.Is(err, ErrWriteProtected) {
+		t.Fatalf("static unstake: have %v, want %v", err, ErrWriteProtected)
+	}
+	if _, err := call(gov, staker, nil, "unstake", minStake.ToBig()); err != nil {
+		t.Fatal(err)
+	}
+	if balance := statedb.GetBalance(staker); !balance.Eq(minStake) {
+		t.Fatalf("have balance %v after unstaking", balance)
+	}
+	if out, err = call(gov, staker, nil, "unbonding", staker); err != nil {
+		t.Fatal(err)
+	}
+	if unbonding := out[0].(*big.Int); unbonding.Cmp(minStake.ToBig()) != 0 {
+		t.Fatalf("have %v unbonding, want %v", unbonding, minStake)
+	}
+
+	// The unbonded stake is released after the lock period.
+	NewStateValidatorManager(statedb, testGovernance, number+DefaultStakingConfig().UnstakeLockPeriod, DefaultStakingConfig()).FinalizeBlock()
+	if balance := statedb.GetBalance(staker); balance.Cmp(new(uint256.Int).Mul(minStake, uint256.NewInt(2))) != 0 {
+		t.Fatalf("have balance %v after release", balance)
+	}
+	if !statedb.GetBalance(testGovernance).IsZero() {
+		t.Fatalf("have contract balance %v after release", statedb.GetBalance(testGovernance))
+	}
+
+	// The whitelist views of the security config contract.
+	whitelist := NewStateWhitelistManager(statedb, testSecurityConfig, 10, DefaultWhitelistConfig(), nil)
+	whitelist.AddEntry(&MREnclaveEntry{MRENCLAVE: [32]byte{2}, Version: "v2", Status: StatusActive})
+	whitelist.AddEntry(&MREnclaveEntry{MRENCLAVE: [32]byte{3}, Version: "v3", Status: StatusPending})
+	out, err = call(sec, staker, nil, "getAllowedMREnclaves")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed := out[0].([][32]byte); len(allowed) != 1 || allowed[0] != [32]byte{2} {
+		t.Fatalf("unexpected whitelist %x", allowed)
+	}
+	out, err = call(sec, staker, nil, "getEntry", [32]byte{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].(string) != "v3" || out[4].(uint8) != uint8(StatusPending) {
+		t.Fatalf("unexpected entry %v", out)
+	}
+	if _, err := sec.Run(&CallContext{DB: statedb}, []byte{1, 2, 3, 4}); !errors.Is(err, ErrUnknownMethod) {
+		t.Fatalf("unknown method: have %v, want %v", err, ErrUnknownMethod)
+	}
+
+	// Listing is charged per entry, and lists are bounded instead of truncated.
+	gas = params.GovernanceListEntryGas
+	if _, err := call(sec, staker, nil, "getAllowedMREnclaves"); !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("listing without gas: have %v, want %v", err, ErrOutOfGas)
+	}
+	gas = (maxListEntries + 1) * params.GovernanceListEntryGas
+	storage := contractStorage{db: statedb, addr: testSecurityConfig}
+	storage.setUint(slotHash(mrEnclaveListSlot), maxListEntries+1)
+	if _, err := call(sec, staker, nil, "getAllowedMREnclaves"); !errors.Is(err, ErrListTooLong) {
+		t.Fatalf("listing a corrupt list: have %v, want %v", err, ErrListTooLong)
+	}
+	storage = contractStorage{db: statedb, addr: testGovernance}
+	storage.setUint(slotHash(validatorListSlot), maxValidators)
+	statedb.AddBalance(testAccount(3), minStake, tracing.BalanceChangeUnspecified)
+	if _, err := call(gov, testAccount(3), minStake, "stake", [32]byte{}); !errors.Is(err, ErrValidatorSetFull) {
+		t.Fatalf("staking into a full validator set: have %v, want %v", err, ErrValidatorSetFull)
+	}
+}
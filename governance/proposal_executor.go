@@ -0,0 +1,181 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/security"
+)
+
+// ParameterSetter applies parameter change proposals. It is implemented by
+// the SGX consensus Config and by StateParameters.
+type ParameterSetter interface {
+	// SetParameter sets one of the Param* parameters
+	SetParameter(name string, value uint64) error
+}
+
+// ValidatorRegistry is a ValidatorManager that can also add and remove
+// validators, as needed to execute validator proposals.
+type ValidatorRegistry interface {
+	ValidatorManager
+
+	// AddValidator adds or replaces a validator
+	AddValidator(validator *ValidatorInfo) error
+
+	// RemoveValidator marks a validator as exiting
+	RemoveValidator(addr common.Address)
+}
+
+// ProposalExecutor applies passed proposals to the managers they target.
+type ProposalExecutor struct {
+	voting     VotingManager
+	whitelist  WhitelistManager
+	validators ValidatorRegistry
+	parameters ParameterSetter                 // nil rejects parameter changes
+	security   security.SecurityConfigContract // nil rejects upgrades
+}
+
+// NewProposalExecutor creates an executor for the proposals of voting.
+func NewProposalExecutor(voting VotingManager, whitelist WhitelistManager, validators ValidatorRegistry, parameters ParameterSetter, security security.SecurityConfigContract) *ProposalExecutor {
+	return &ProposalExecutor{
+		voting:     voting,
+		whitelist:  whitelist,
+		validators: validators,
+		parameters: parameters,
+		security:   security,
+	}
+}
+
+// Execute applies a passed proposal and marks it executed. Proposals whose
+// voting period has ended are tallied first. The proposal must have passed
+// its execution delay. A proposal is applied at most once; executing it again
+// fails with ErrProposalAlreadyExecuted.
+func (e *ProposalExecutor) Execute(proposalID common.Hash, currentBlock uint64) error {
+	proposal, err := e.voting.GetProposal(proposalID)
+	if err != nil {
+		return err
+	}
+	if proposal.Status == ProposalStatusExecuted {
+		return ErrProposalAlreadyExecuted
+	}
+	if err := e.voting.CheckProposalStatus(proposalID, currentBlock); err != nil {
+		return err
+	}
+	if proposal, err = e.voting.GetProposal(proposalID); err != nil {
+		return err
+	}
+	if proposal.Status != ProposalStatusPassed {
+		return ErrProposalNotPassed
+	}
+	if currentBlock < proposal.ExecuteAfter {
+		return ErrExecutionDelayNotMet
+	}
+	payload, err := DecodeProposalPayload(proposal.Type, proposal.Target)
+	if err != nil {
+		return err
+	}
+	if err := e.apply(proposal, payload, currentBlock); err != nil {
+		return err
+	}
+	return e.voting.ExecuteProposal(proposalID)
+}
+
+// apply dispatches a proposal payload to the manager it targets.
+func (e *ProposalExecutor) apply(proposal *Proposal, payload ProposalPayload, currentBlock uint64) error {
+	switch p := payload.(type) {
+	case *AddMREnclavePayload:
+		e.whitelist.AddEntry(&MREnclaveEntry{
+			MRENCLAVE:       p.MRENCLAVE,
+			Version:         p.Version,
+			AddedAt:         currentBlock,
+			AddBy:           proposal.Proposer,
+			PermissionLevel: p.PermissionLevel,
+			Status:          StatusActive,
+		})
+
+	case *RemoveMREnclavePayload:
+		e.whitelist.RemoveEntry(p.MRENCLAVE)
+
+	case *UpgradePermissionPayload:
+		entry, err := e.whitelist.GetEntry(p.MRENCLAVE)
+		if err != nil {
+			return err
+		}
+		if entry.PermissionLevel >= p.PermissionLevel {
+			return ErrInvalidPermissionLevel
+		}
+		entry.PermissionLevel = p.PermissionLevel
+		e.whitelist.AddEntry(entry)
+
+	case *AddValidatorPayload:
+		validator := &ValidatorInfo{
+			Address:      p.Address,
+			Type:         p.Type,
+			MRENCLAVE:    p.MRENCLAVE,
+			StakeAmount:  new(big.Int),
+			JoinedAt:     currentBlock,
+			LastActiveAt: currentBlock,
+			VotingPower:  p.VotingPower,
+			Status:       ValidatorStatusActive,
+		}
+		if existing, err := e.validators.GetValidator(p.Address); err == nil {
+			validator.StakeAmount = existing.StakeAmount
+			validator.JoinedAt = existing.JoinedAt
+			if existing.StakeAmount.Sign() > 0 {
+				validator.VotingPower = stakeVotingPower(existing.StakeAmount)
+			}
+		}
+		return e.validators.AddValidator(validator)
+
+	case *RemoveValidatorPayload:
+		if _, err := e.validators.GetValidator(p.Address); err != nil {
+			return err
+		}
+		e.validators.RemoveValidator(p.Address)
+
+	case *ParameterChangePayload:
+		if e.parameters == nil {
+			return ErrUnsupportedProposal
+		}
+		return e.parameters.SetParameter(p.Name, p.Value)
+
+	case *UpgradePayload:
+		if e.security == nil {
+			return ErrUnsupportedProposal
+		}
+		// Old and new enclaves run side by side until the upgrade completes.
+		e.whitelist.AddEntry(&MREnclaveEntry{
+			MRENCLAVE:       p.NewMREnclave,
+			Version:         p.Version,
+			AddedAt:         currentBlock,
+			AddBy:           proposal.Proposer,
+			PermissionLevel: PermissionBasic,
+			Status:          StatusActive,
+		})
+		return e.security.SetUpgradeConfig(&security.UpgradeConfig{
+			NewMREnclave:         p.NewMREnclave,
+			UpgradeCompleteBlock: p.UpgradeCompleteBlock,
+			UpgradeStartBlock:    currentBlock,
+		})
+
+	default:
+		return ErrUnsupportedProposal
+	}
+	return nil
+}
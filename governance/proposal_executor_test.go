@@ -0,0 +1,275 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+)
+
+var (
+	testCore      = []common.Address{testAccount(0xc1), testAccount(0xc2), testAccount(0xc3)}
+	testCommunity = []common.Address{testAccount(0xd1), testAccount(0xd2), testAccount(0xd3)}
+)
+
+// testExecution holds the state-backed managers of one block.
+type testExecution struct {
+	voting     *StateVotingManager
+	validators *StateValidatorManager
+	whitelist  *StateWhitelistManager
+	parameters *StateParameters
+	security   *StateSecurityConfig
+	executor   *ProposalExecutor
+}
+
+func newTestExecution(statedb *state.StateDB, number uint64) *testExecution {
+	config := DefaultWhitelistConfig()
+	e := &testExecution{
+		validators: NewStateValidatorManager(statedb, testGovernance, number, DefaultStakingConfig()),
+		parameters: NewStateParameters(statedb, testGovernance),
+		security:   NewStateSecurityConfig(statedb, testSecurityConfig),
+	}
+	e.voting = NewStateVotingManager(statedb, testGovernance, testDomain.ChainID, number, config, e.validators)
+	e.whitelist = NewStateWhitelistManager(statedb, testSecurityConfig, number, config, e.voting)
+	e.executor = NewProposalExecutor(e.voting, e.whitelist, e.validators, e.parameters, e.security)
+	return e
+}
+
+// newExecutorState returns a state with the test core validators and the
+// given community validators.
+func newExecutorState(t *testing.T, community ...common.Address) *state.StateDB {
+	statedb := newTestState(t)
+	setupCoreValidators(statedb, testCore...)
+	for _, addr := range community {
+		newTestExecution(statedb, 0).validators.AddValidator(&ValidatorInfo{
+			Address:     addr,
+			Type:        VoterTypeCommunity,
+			VotingPower: 1,
+			Status:      ValidatorStatusActive,
+		})
+	}
+	return statedb
+}
+
+// proposeAndPass creates a proposal at block 1 which all core validators
+// and the given community validators vote on at block 2. It returns the
+// proposal and the managers of its first executable block.
+func proposeAndPass(t *testing.T, statedb *state.StateDB, payload ProposalPayload, communityNo ...common.Address) (*Proposal, *testExecution) {
+	t.Helper()
+	id, err := newTestExecution(statedb, 1).voting.CreateProposal(&Proposal{
+		Type:     payload.ProposalType(),
+		Proposer: testCore[0],
+		Target:   payload.Encode(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newTestExecution(statedb, 2)
+	for _, addr := range testCore {
+		if err := e.voting.Vote(id, addr, true, signTestVote(testDomain, e.voting, id, addr, true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, addr := range communityNo {
+		if err := e.voting.Vote(id, addr, false, signTestVote(testDomain, e.voting, id, addr, false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proposal, _ := e.voting.GetProposal(id)
+	return proposal, newTestExecution(statedb, proposal.ExecuteAfter)
+}
+
+// execute passes and executes a proposal, failing the test on any error.
+func execute(t *testing.T, statedb *state.StateDB, payload ProposalPayload) *testExecution {
+	t.Helper()
+	proposal, e := proposeAndPass(t, statedb, payload)
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); err != nil {
+		t.Fatalf("executing %T: %v", payload, err)
+	}
+	return e
+}
+
+func TestExecuteAddRemoveMREnclave(t *testing.T) {
+	statedb := newExecutorState(t)
+	mr := [32]byte{0x01}
+
+	e := execute(t, statedb, &AddMREnclavePayload{MRENCLAVE: mr, PermissionLevel: PermissionStandard, Version: "v1.0.0"})
+	entry, err := e.whitelist.GetEntry(mr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.whitelist.IsAllowed(mr) || entry.PermissionLevel != PermissionStandard || entry.Version != "v1.0.0" || entry.AddBy != testCore[0] {
+		t.Fatalf("unexpected entry after add: %+v", entry)
+	}
+
+	e = execute(t, statedb, &RemoveMREnclavePayload{MRENCLAVE: mr})
+	if e.whitelist.IsAllowed(mr) {
+		t.Fatal("MRENCLAVE still allowed after removal")
+	}
+}
+
+func TestExecuteUpgradePermission(t *testing.T) {
+	statedb := newExecutorState(t)
+	mr := [32]byte{0x01}
+	newTestExecution(statedb, 0).whitelist.AddEntry(&MREnclaveEntry{MRENCLAVE: mr, PermissionLevel: PermissionBasic, Status: StatusActive})
+
+	e := execute(t, statedb, &UpgradePermissionPayload{MRENCLAVE: mr, PermissionLevel: PermissionFull})
+	if level := e.whitelist.GetPermissionLevel(mr); level != PermissionFull {
+		t.Fatalf("permission level = %v, want %v", level, PermissionFull)
+	}
+
+	// Permissions are never lowered by a proposal.
+	proposal, e := proposeAndPass(t, statedb, &UpgradePermissionPayload{MRENCLAVE: mr, PermissionLevel: PermissionStandard})
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); !errors.Is(err, ErrInvalidPermissionLevel) {
+		t.Fatalf("lowering permission: have %v, want %v", err, ErrInvalidPermissionLevel)
+	}
+}
+
+func TestExecuteAddRemoveValidator(t *testing.T) {
+	statedb := newExecutorState(t)
+	addr := common.HexToAddress("0xd1")
+
+	e := execute(t, statedb, &AddValidatorPayload{Address: addr, Type: VoterTypeCommunity, MRENCLAVE: [32]byte{0x01}, VotingPower: 3})
+	v, err := e.validators.GetValidator(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Type != VoterTypeCommunity || v.VotingPower != 3 || v.Status != ValidatorStatusActive {
+		t.Fatalf("unexpected validator after add: %+v", v)
+	}
+
+	e = execute(t, statedb, &RemoveValidatorPayload{Address: addr})
+	if e.validators.IsValidator(addr) {
+		t.Fatal("validator still active after removal")
+	}
+
+	// Removing an unknown validator fails.
+	proposal, e := proposeAndPass(t, statedb, &RemoveValidatorPayload{Address: common.HexToAddress("0xee")})
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); !errors.Is(err, ErrValidatorNotFound) {
+		t.Fatalf("removing unknown validator: have %v, want %v", err, ErrValidatorNotFound)
+	}
+}
+
+func TestExecuteParameterChange(t *testing.T) {
+	statedb := newExecutorState(t)
+
+	e := execute(t, statedb, &ParameterChangePayload{Name: ParamMaxTxPerBlock, Value: 500})
+	if value, ok := e.parameters.GetParameter(ParamMaxTxPerBlock); !ok || value != 500 {
+		t.Fatalf("parameter = %d (set %v), want 500", value, ok)
+	}
+
+	// Staking parameters change the staking configuration.
+	e = execute(t, statedb, &ParameterChangePayload{Name: ParamMinStakeAmount, Value: 5})
+	if stake := e.parameters.StakingConfig().MinStakeAmount; stake.Cmp(new(big.Int).Mul(big.NewInt(5), big.NewInt(1e18))) != 0 {
+		t.Fatalf("minimum stake = %v, want 5 tokens", stake)
+	}
+
+	// Invalid values are rejected and leave the parameter unchanged.
+	execute(t, statedb, &ParameterChangePayload{Name: ParamMaxBlockInterval, Value: 5000})
+	for _, payload := range []*ParameterChangePayload{
+		{Name: ParamMaxTxPerBlock, Value: 0},
+		{Name: ParamMaxCandidates, Value: 1 << 40},
+		{Name: ParamMinBlockInterval, Value: 6000},
+		{Name: ParamSlashingRate, Value: 101},
+	} {
+		proposal, e := proposeAndPass(t, statedb, payload)
+		if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); !errors.Is(err, ErrInvalidParameter) {
+			t.Fatalf("%s=%d: have %v, want %v", payload.Name, payload.Value, err, ErrInvalidParameter)
+		}
+	}
+	if value, _ := e.parameters.GetParameter(ParamMaxTxPerBlock); value != 500 {
+		t.Fatalf("parameter = %d after invalid change, want 500", value)
+	}
+
+	// Without a parameter setter parameter changes are not supported.
+	proposal, e := proposeAndPass(t, statedb, &ParameterChangePayload{Name: ParamMaxTxPerBlock, Value: 600})
+	e.executor.parameters = nil
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); !errors.Is(err, ErrUnsupportedProposal) {
+		t.Fatalf("no parameter setter: have %v, want %v", err, ErrUnsupportedProposal)
+	}
+}
+
+func TestExecuteUpgrade(t *testing.T) {
+	for _, emergency := range []bool{false, true} {
+		statedb := newExecutorState(t)
+		mr := [32]byte{0x02}
+
+		proposal, e := proposeAndPass(t, statedb, &UpgradePayload{Emergency: emergency, NewMREnclave: mr, UpgradeCompleteBlock: 100000, Version: "v2.0.0"})
+		if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); err != nil {
+			t.Fatalf("emergency %v: %v", emergency, err)
+		}
+		if !e.whitelist.IsAllowed(mr) {
+			t.Fatalf("emergency %v: new MRENCLAVE not allowed", emergency)
+		}
+		config := e.security.GetUpgradeConfig()
+		if config == nil || config.NewMREnclave != mr || config.UpgradeCompleteBlock != 100000 || config.UpgradeStartBlock != proposal.ExecuteAfter {
+			t.Fatalf("emergency %v: unexpected upgrade config %+v", emergency, config)
+		}
+	}
+}
+
+func TestExecuteDelayAndIdempotency(t *testing.T) {
+	statedb := newExecutorState(t)
+	mr := [32]byte{0x01}
+	proposal, _ := proposeAndPass(t, statedb, &AddMREnclavePayload{MRENCLAVE: mr, PermissionLevel: PermissionBasic})
+
+	// Still voting.
+	e := newTestExecution(statedb, 3)
+	if err := e.executor.Execute(proposal.ID, 3); !errors.Is(err, ErrProposalNotPassed) {
+		t.Fatalf("during voting: have %v, want %v", err, ErrProposalNotPassed)
+	}
+	// Tallied, but the execution delay has not passed.
+	e = newTestExecution(statedb, proposal.VotingEndsAt)
+	if err := e.executor.Execute(proposal.ID, proposal.VotingEndsAt); !errors.Is(err, ErrExecutionDelayNotMet) {
+		t.Fatalf("before delay: have %v, want %v", err, ErrExecutionDelayNotMet)
+	}
+	if e.whitelist.IsAllowed(mr) {
+		t.Fatal("proposal applied before its execution delay")
+	}
+	e = newTestExecution(statedb, proposal.ExecuteAfter)
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter+1); !errors.Is(err, ErrProposalAlreadyExecuted) {
+		t.Fatalf("second execution: have %v, want %v", err, ErrProposalAlreadyExecuted)
+	}
+}
+
+func TestExecuteCommunityVeto(t *testing.T) {
+	// Half of the community vetoes, the proposal is rejected at the tally.
+	statedb := newExecutorState(t, testCommunity[:2]...)
+	proposal, e := proposeAndPass(t, statedb, &RemoveMREnclavePayload{MRENCLAVE: [32]byte{0x01}}, testCommunity[0])
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); !errors.Is(err, ErrProposalNotPassed) {
+		t.Fatalf("vetoed proposal: have %v, want %v", err, ErrProposalNotPassed)
+	}
+
+	// A third of the community is just short of the veto threshold. The
+	// tally uses the power snapshotted at creation, so a community validator
+	// leaving before the tally does not turn it into a veto.
+	statedb = newExecutorState(t, testCommunity...)
+	proposal, _ = proposeAndPass(t, statedb, &RemoveMREnclavePayload{MRENCLAVE: [32]byte{0x01}}, testCommunity[0])
+	newTestExecution(statedb, 3).validators.RemoveValidator(testCommunity[2])
+
+	e = newTestExecution(statedb, proposal.ExecuteAfter)
+	if err := e.executor.Execute(proposal.ID, proposal.ExecuteAfter); err != nil {
+		t.Fatalf("executing after a validator left: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Parameters of the SGX consensus configuration that can be changed by
+// ProposalParameterChange. Durations are in milliseconds.
+const (
+	ParamMinBlockInterval  = "minBlockInterval"
+	ParamMaxBlockInterval  = "maxBlockInterval"
+	ParamMaxTxPerBlock     = "maxTxPerBlock"
+	ParamMaxGasPerBlock    = "maxGasPerBlock"
+	ParamMinTxCount        = "minTxCount"
+	ParamMinGasTotal       = "minGasTotal"
+	ParamCandidateWindowMs = "candidateWindowMs"
+	ParamMaxCandidates     = "maxCandidates"
+)
+
+// Parameters of the validator staking configuration that can be changed by
+// ProposalParameterChange. The minimum stake is in whole tokens of 1e18 wei,
+// the lock period in blocks and the rates in percent.
+const (
+	ParamMinStakeAmount    = "minStakeAmount"
+	ParamUnstakeLockPeriod = "unstakeLockPeriod"
+	ParamAnnualRewardRate  = "annualRewardRate"
+	ParamSlashingRate      = "slashingRate"
+	ParamBlocksPerYear     = "blocksPerYear"
+)
+
+// parameterNames contains the parameters that can be changed.
+var parameterNames = map[string]bool{
+	ParamMinStakeAmount:    true,
+	ParamUnstakeLockPeriod: true,
+	ParamAnnualRewardRate:  true,
+	ParamSlashingRate:      true,
+	ParamBlocksPerYear:     true,
+	ParamMinBlockInterval:  true,
+	ParamMaxBlockInterval:  true,
+	ParamMaxTxPerBlock:     true,
+	ParamMaxGasPerBlock:    true,
+	ParamMinTxCount:        true,
+	ParamMinGasTotal:       true,
+	ParamCandidateWindowMs: true,
+	ParamMaxCandidates:     true,
+}
+
+// ProposalPayload is the typed content of a proposal, stored encoded in its
+// Target. The encodings are:
+//
+//	ProposalAddMREnclave       mrenclave (32) ++ permission level (1) ++ version
+//	ProposalRemoveMREnclave    mrenclave (32)
+//	ProposalUpgradePermission  mrenclave (32) ++ permission level (1)
+//	ProposalAddValidator       address (20) ++ voter type (1) ++ mrenclave (32) ++ voting power (8)
+//	ProposalRemoveValidator    address (20)
+//	ProposalParameterChange    value (8) ++ parameter name
+//	ProposalNormalUpgrade      new mrenclave (32) ++ upgrade complete block (8) ++ version
+//	ProposalEmergencyUpgrade   same as ProposalNormalUpgrade
+//
+// Integers are big endian.
+type ProposalPayload interface {
+	// ProposalType returns the type of proposal carrying the payload
+	ProposalType() ProposalType
+
+	// Encode returns the payload as proposal target
+	Encode() []byte
+}
+
+// AddMREnclavePayload adds an MRENCLAVE to the whitelist.
+type AddMREnclavePayload struct {
+	MRENCLAVE       [32]byte
+	PermissionLevel PermissionLevel
+	Version         string
+}
+
+func (p *AddMREnclavePayload) ProposalType() ProposalType { return ProposalAddMREnclave }
+
+func (p *AddMREnclavePayload) Encode() []byte {
+	out := append(common.CopyBytes(p.MRENCLAVE[:]), byte(p.PermissionLevel))
+	return append(out, p.Version...)
+}
+
+// RemoveMREnclavePayload removes an MRENCLAVE from the whitelist.
+type RemoveMREnclavePayload struct {
+	MRENCLAVE [32]byte
+}
+
+func (p *RemoveMREnclavePayload) ProposalType() ProposalType { return ProposalRemoveMREnclave }
+
+func (p *RemoveMREnclavePayload) Encode() []byte {
+	return common.CopyBytes(p.MRENCLAVE[:])
+}
+
+// UpgradePermissionPayload raises the permission level of an MRENCLAVE.
+type UpgradePermissionPayload struct {
+	MRENCLAVE       [32]byte
+	PermissionLevel PermissionLevel
+}
+
+func (p *UpgradePermissionPayload) ProposalType() ProposalType { return ProposalUpgradePermission }
+
+func (p *UpgradePermissionPayload) Encode() []byte {
+	return append(common.CopyBytes(p.MRENCLAVE[:]), byte(p.PermissionLevel))
+}
+
+// AddValidatorPayload adds a validator, or changes the type and voting power
+// of an existing one.
+type AddValidatorPayload struct {
+	Address     common.Address
+	Type        VoterType
+	MRENCLAVE   [32]byte
+	VotingPower uint64
+}
+
+func (p *AddValidatorPayload) ProposalType() ProposalType { return ProposalAddValidator }
+
+func (p *AddValidatorPayload) Encode() []byte {
+	out := append(common.CopyBytes(p.Address[:]), byte(p.Type))
+	out = append(out, p.MRENCLAVE[:]...)
+	return binary.BigEndian.AppendUint64(out, p.VotingPower)
+}
+
+// RemoveValidatorPayload removes a validator.
+type RemoveValidatorPayload struct {
+	Address common.Address
+}
+
+func (p *RemoveValidatorPayload) ProposalType() ProposalType { return ProposalRemoveValidator }
+
+func (p *RemoveValidatorPayload) Encode() []byte {
+	return common.CopyBytes(p.Address[:])
+}
+
+// ParameterChangePayload changes a parameter of the SGX consensus
+// configuration.
+type ParameterChangePayload struct {
+	Name  string
+	Value uint64
+}
+
+func (p *ParameterChangePayload) ProposalType() ProposalType { return ProposalParameterChange }
+
+func (p *ParameterChangePayload) Encode() []byte {
+	return append(binary.BigEndian.AppendUint64(nil, p.Value), p.Name...)
+}
+
+// UpgradePayload starts an upgrade to a new MRENCLAVE, which is added to the
+// whitelist next to the current ones until the upgrade completes.
+type UpgradePayload struct {
+	Emergency            bool // Carried by ProposalEmergencyUpgrade
+	NewMREnclave         [32]byte
+	UpgradeCompleteBlock uint64
+	Version              string
+}
+
+func (p *UpgradePayload) ProposalType() ProposalType {
+	if p.Emergency {
+		return ProposalEmergencyUpgrade
+	}
+	return ProposalNormalUpgrade
+}
+
+func (p *UpgradePayload) Encode() []byte {
+	out := binary.BigEndian.AppendUint64(common.CopyBytes(p.NewMREnclave[:]), p.UpgradeCompleteBlock)
+	return append(out, p.Version...)
+}
+
+// DecodeProposalPayload decodes the target of a proposal of the given type.
+func DecodeProposalPayload(ptype ProposalType, target []byte) (ProposalPayload, error) {
+	invalid := func() (ProposalPayload, error) {
+		return nil, fmt.Errorf("%w: malformed target of type %d proposal", ErrInvalidProposal, ptype)
+	}
+	switch ptype {
+	case ProposalAddMREnclave:
+		if len(target) < 33 || !validPermissionLevel(PermissionLevel(target[32])) {
+			return invalid()
+		}
+		return &AddMREnclavePayload{MRENCLAVE: [32]byte(target[:32]), PermissionLevel: PermissionLevel(target[32]), Version: string(target[33:])}, nil
+	case ProposalRemoveMREnclave:
+		if len(target) != 32 {
+			return invalid()
+		}
+		return &RemoveMREnclavePayload{MRENCLAVE: [32]byte(target)}, nil
+	case ProposalUpgradePermission:
+		if len(target) != 33 || !validPermissionLevel(PermissionLevel(target[32])) {
+			return invalid()
+		}
+		return &UpgradePermissionPayload{MRENCLAVE: [32]byte(target[:32]), PermissionLevel: PermissionLevel(target[32])}, nil
+	case ProposalAddValidator:
+		if len(target) != 61 || (VoterType(target[20]) != VoterTypeCore && VoterType(target[20]) != VoterTypeCommunity) {
+			return invalid()
+		}
+		return &AddValidatorPayload{
+			Address:     common.BytesToAddress(target[:20]),
+			Type:        VoterType(target[20]),
+			MRENCLAVE:   [32]byte(target[21:53]),
+			VotingPower: binary.BigEndian.Uint64(target[53:]),
+		}, nil
+	case ProposalRemoveValidator:
+		if len(target) != 20 {
+			return invalid()
+		}
+		return &RemoveValidatorPayload{Address: common.BytesToAddress(target)}, nil
+	case ProposalParameterChange:
+		if len(target) < 8 || !parameterNames[string(target[8:])] {
+			return invalid()
+		}
+		return &ParameterChangePayload{Name: string(target[8:]), Value: binary.BigEndian.Uint64(target[:8])}, nil
+	case ProposalNormalUpgrade, ProposalEmergencyUpgrade:
+		if len(target) < 40 {
+			return invalid()
+		}
+		return &UpgradePayload{
+			Emergency:            ptype == ProposalEmergencyUpgrade,
+			NewMREnclave:         [32]byte(target[:32]),
+			UpgradeCompleteBlock: binary.BigEndian.Uint64(target[32:40]),
+			Version:              string(target[40:]),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %d", ErrInvalidProposal, ptype)
+	}
+}
+
+// validPermissionLevel reports whether level is a known permission level.
+func validPermissionLevel(level PermissionLevel) bool {
+	return level >= PermissionBasic && level <= PermissionFull
+}
@@ -0,0 +1,334 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+var (
+	testGovernance     = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testSecurityConfig = common.HexToAddress("0x1000000000000000000000000000000000000002")
+)
+
+func newTestState(t *testing.T) *state.StateDB {
+	t.Helper()
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabaseForTesting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return statedb
+}
+
+// setupCoreValidators stores active core validators like a genesis allocation.
+func setupCoreValidators(db StateDB, addrs ...common.Address) {
+	var validators []*ValidatorInfo
+	for _, addr := range addrs {
+		validators = append(validators, &ValidatorInfo{
+			Address:     addr,
+			Type:        VoterTypeCore,
+			StakeAmount: new(big.Int),
+			VotingPower: 1,
+			Status:      ValidatorStatusActive,
+		})
+	}
+	for slot, value := range ValidatorStorage(validators) {
+		db.SetState(testGovernance, slot, value)
+	}
+}
+
+func TestStateValidatorManager(t *testing.T) {
+	statedb := newTestState(t)
+	config := DefaultStakingConfig()
+	addr := common.HexToAddress("0x01")
+
+	vm := NewStateValidatorManager(statedb, testGovernance, 10, config)
+	if err := vm.Stake(addr, big.NewInt(1)); !errors.Is(err, ErrInsufficientStake) {
+		t.Fatalf("stake below minimum: have %v, want %v", err, ErrInsufficientStake)
+	}
+	stake := new(big.Int).Mul(config.MinStakeAmount, big.NewInt(2))
+	if err := vm.Stake(addr, stake); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("stake without funds: have %v, want %v", err, ErrInsufficientBalance)
+	}
+	statedb.AddBalance(addr, uint256.MustFromBig(stake), tracing.BalanceChangeUnspecified)
+	if err := vm.Stake(addr, stake); err != nil {
+		t.Fatal(err)
+	}
+	if !statedb.GetBalance(addr).IsZero() || statedb.GetBalance(testGovernance).ToBig().Cmp(stake) != 0 {
+		t.Fatalf("stake not locked in the governance contract")
+	}
+
+	// A manager at a later block reads the same validator from the state.
+	vm = NewStateValidatorManager(statedb, testGovernance, 20, config)
+	v, err := vm.GetValidator(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.StakeAmount.Cmp(stake) != 0 || v.JoinedAt != 10 || v.Type != VoterTypeCommunity || v.Status != ValidatorStatusActive {
+		t.Fatalf("unexpected validator %+v", v)
+	}
+	if !vm.IsValidator(addr) || len(vm.GetCommunityValidators()) != 1 || len(vm.GetCoreValidators()) != 0 {
+		t.Fatal("staked validator not active")
+	}
+
+	// Slashing burns the slashed stake from the contract balance.
+	if err := vm.Slash(addr, "test"); err != nil {
+		t.Fatal(err)
+	}
+	v, _ = vm.GetValidator(addr)
+	want := new(big.Int).Div(new(big.Int).Mul(stake, big.NewInt(90)), big.NewInt(100))
+	if v.StakeAmount.Cmp(want) != 0 || statedb.GetBalance(testGovernance).ToBig().Cmp(want) != 0 {
+		t.Fatalf("slashed stake %v, balance %v, want %v", v.StakeAmount, statedb.GetBalance(testGovernance), want)
+	}
+
+	// Unstaking below the minimum deactivates the validator.
+	if err := vm.Unstake(addr, want); err != nil {
+		t.Fatal(err)
+	}
+	if vm.IsValidator(addr) {
+		t.Fatal("validator still active without stake")
+	}
+	if unbonding := vm.Unbonding(addr); unbonding.Cmp(want) != 0 {
+		t.Fatalf("have %v unbonding, want %v", unbonding, want)
+	}
+	if err := vm.Unstake(addr, big.NewInt(1)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("unstake without stake: have %v, want %v", err, ErrInsufficientBalance)
+	}
+	// Without stake the validator leaves the list but keeps its record.
+	if all := vm.GetAllValidators(); len(all) != 0 {
+		t.Fatalf("have %d validators, want 0", len(all))
+	}
+	if _, err := vm.GetValidator(addr); err != nil {
+		t.Fatalf("validator record removed: %v", err)
+	}
+}
+
+// Tests that validators leave the validator list when they exit or run out of
+// stake, and that only the live validators count against maxValidators.
+func TestStateValidatorList(t *testing.T) {
+	statedb := newTestState(t)
+	config := DefaultStakingConfig()
+	vm := NewStateValidatorManager(statedb, testGovernance, 1, config)
+	a, b, c := testCommunity[0], testCommunity[1], testCommunity[2]
+	fundStakers(statedb, new(big.Int).Mul(config.MinStakeAmount, big.NewInt(3)), a, b, c)
+
+	listed := func(want ...common.Address) {
+		t.Helper()
+		all := vm.GetAllValidators()
+		if len(all) != len(want) || vm.validatorCount() != uint64(len(want)) {
+			t.Fatalf("have %d validators, want %d", len(all), len(want))
+		}
+		for i, v := range all {
+			if v.Address != want[i] {
+				t.Fatalf("validator %d: have %v, want %v", i, v.Address, want[i])
+			}
+		}
+	}
+	for _, addr := range []common.Address{a, b, c} {
+		if err := vm.Stake(addr, config.MinStakeAmount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed(a, b, c)
+
+	// Unstaking everything moves the last validator into the free position.
+	if err := vm.Unstake(a, config.MinStakeAmount); err != nil {
+		t.Fatal(err)
+	}
+	listed(c, b)
+
+	// Exiting validators leave the list, staking again rejoins it.
+	vm.RemoveValidator(b)
+	listed(c)
+	if err := vm.Stake(a, config.MinStakeAmount); err != nil {
+		t.Fatal(err)
+	}
+	listed(c, a)
+	if err := vm.Unstake(c, config.MinStakeAmount); err != nil {
+		t.Fatal(err)
+	}
+	listed(a)
+
+	// A full list only rejects validators that are not in it.
+	list := contractStorage{db: statedb, addr: testGovernance}
+	list.setUint(slotHash(validatorListSlot), maxValidators)
+	if err := vm.Stake(c, config.MinStakeAmount); !errors.Is(err, ErrValidatorSetFull) {
+		t.Fatalf("stake into full set: have %v, want %v", err, ErrValidatorSetFull)
+	}
+	if err := vm.Stake(a, config.MinStakeAmount); err != nil {
+		t.Fatalf("stake of listed validator into full set: %v", err)
+	}
+}
+
+func TestStateVotingManager(t *testing.T) {
+	statedb := newTestState(t)
+	config := DefaultWhitelistConfig()
+	core := []common.Address{testAccount(1), testAccount(2), testAccount(3)}
+	setupCoreValidators(statedb, core...)
+
+	managers := func(number uint64) *StateVotingManager {
+		validators := NewStateValidatorManager(statedb, testGovernance, number, DefaultStakingConfig())
+		return NewStateVotingManager(statedb, testGovernance, testDomain.ChainID, number, config, validators)
+	}
+	voting := managers(100)
+	id, err := voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: core[0], Target: []byte{1, 2, 3}, Description: "add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: core[0], Target: []byte{1, 2, 3}}); !errors.Is(err, ErrProposalExists) {
+		t.Fatalf("duplicate proposal: have %v, want %v", err, ErrProposalExists)
+	}
+
+	voting = managers(101)
+	sign := func(voter common.Address, support bool) []byte {
+		return signTestVote(testDomain, voting, id, voter, support)
+	}
+	if err := voting.Vote(id, core[0], true, nil); !errors.Is(err, ErrMissingSignature) {
+		t.Fatalf("unsigned vote: have %v, want %v", err, ErrMissingSignature)
+	}
+	if err := voting.Vote(id, core[0], true, sign(core[0], true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := voting.Vote(id, core[0], false, sign(core[0], false)); !errors.Is(err, ErrAlreadyVoted) {
+		t.Fatalf("second vote: have %v, want %v", err, ErrAlreadyVoted)
+	}
+	if err := voting.Vote(id, common.HexToAddress("0x04"), true, nil); !errors.Is(err, ErrNoVotingPower) {
+		t.Fatalf("vote by non-validator: have %v, want %v", err, ErrNoVotingPower)
+	}
+	// The snapshot decides who votes: validators joining later do not, and
+	// validators exiting later still do.
+	validators := NewStateValidatorManager(statedb, testGovernance, 101, DefaultStakingConfig())
+	late := testAccount(5)
+	if err := validators.AddValidator(&ValidatorInfo{Address: late, Type: VoterTypeCore, StakeAmount: new(big.Int), VotingPower: 1, Status: ValidatorStatusActive}); err != nil {
+		t.Fatal(err)
+	}
+	if err := voting.Vote(id, late, true, sign(late, true)); !errors.Is(err, ErrNoVotingPower) {
+		t.Fatalf("vote by later validator: have %v, want %v", err, ErrNoVotingPower)
+	}
+	validators.RemoveValidator(core[2])
+	for _, voter := range core[1:] {
+		if err := voting.Vote(id, voter, true, sign(voter, true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proposal, err := managers(102).GetProposal(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposal.CreatedAt != 100 || proposal.VotingEndsAt != 100+config.VotingPeriod ||
+		string(proposal.Target) != "\x01\x02\x03" || proposal.Description != "add" || proposal.CoreYesVotes != 3 {
+		t.Fatalf("unexpected proposal %+v", proposal)
+	}
+	votes, err := managers(102).GetProposalVotes(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(votes) != 3 || votes[0].Voter != core[0] || !votes[0].Support || votes[0].Timestamp != 101 {
+		t.Fatalf("unexpected votes %+v", votes)
+	}
+
+	// Votes are closed and the proposal tallied after the voting period.
+	end := proposal.VotingEndsAt
+	if err := managers(end).Vote(id, core[2], false, sign(core[2], false)); !errors.Is(err, ErrVotingPeriodEnded) {
+		t.Fatalf("late vote: have %v, want %v", err, ErrVotingPeriodEnded)
+	}
+	if err := managers(end).CheckProposalStatus(id, end); err != nil {
+		t.Fatal(err)
+	}
+	if err := managers(end).ExecuteProposal(id); !errors.Is(err, ErrExecutionDelayNotMet) {
+		t.Fatalf("early execution: have %v, want %v", err, ErrExecutionDelayNotMet)
+	}
+	if err := managers(proposal.ExecuteAfter).ExecuteProposal(id); err != nil {
+		t.Fatal(err)
+	}
+	if proposal, _ = managers(end).GetProposal(id); proposal.Status != ProposalStatusExecuted {
+		t.Fatalf("have status %d, want executed", proposal.Status)
+	}
+	if active := managers(end).GetActiveProposals(); len(active) != 0 {
+		t.Fatalf("have %d active proposals, want 0", len(active))
+	}
+}
+
+func TestStateWhitelistManager(t *testing.T) {
+	statedb := newTestState(t)
+	genesis := common.HexToHash("0xaa")
+	added := common.HexToHash("0xbb")
+
+	// Whitelist allocated in genesis, in the layout read by the consensus engine.
+	one := common.BigToHash(common.Big1)
+	statedb.SetState(testSecurityConfig, mappingSlot(genesis, slotHash(allowedMREnclavesSlot)), one)
+	statedb.SetState(testSecurityConfig, listSlot(slotHash(mrEnclaveListSlot), 0), genesis)
+	statedb.SetState(testSecurityConfig, slotHash(mrEnclaveListSlot), one)
+
+	wm := NewStateWhitelistManager(statedb, testSecurityConfig, 1, DefaultWhitelistConfig(), nil)
+	entry, err := wm.GetEntry(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Status != StatusActive || entry.PermissionLevel != PermissionBasic || !wm.IsAllowed(genesis) {
+		t.Fatalf("unexpected genesis entry %+v", entry)
+	}
+
+	wm.AddEntry(&MREnclaveEntry{MRENCLAVE: added, Version: "v2", AddedAt: 5, PermissionLevel: PermissionStandard, Status: StatusActive})
+	wm.RemoveEntry(genesis)
+	wm.RemoveEntry(added)
+	wm.AddEntry(&MREnclaveEntry{MRENCLAVE: added, Version: "v2.1", AddedAt: 6, PermissionLevel: PermissionStandard, Status: StatusActive})
+
+	if wm.IsAllowed(genesis) || !wm.IsAllowed(added) {
+		t.Fatal("whitelist flags not updated")
+	}
+	if length := statedb.GetState(testSecurityConfig, slotHash(mrEnclaveListSlot)).Big().Uint64(); length != 2 {
+		t.Fatalf("have %d listed MRENCLAVEs, want 2", length)
+	}
+	entries := wm.GetAllEntries()
+	if len(entries) != 2 || entries[0].Status != StatusDeprecated || entries[1].Version != "v2.1" || entries[1].AddedAt != 6 {
+		t.Fatalf("unexpected entries %+v %+v", entries[0], entries[1])
+	}
+	if level := wm.GetPermissionLevel(added); level != PermissionStandard {
+		t.Fatalf("have permission level %d, want %d", level, PermissionStandard)
+	}
+}
+
+func TestContractStorageBytes(t *testing.T) {
+	s := contractStorage{db: make(GenesisStorage)}
+	slot := slotHash(7)
+	long := make([]byte, 70)
+	for i := range long {
+		long[i] = byte(i + 1)
+	}
+	s.setBytes(slot, long)
+	if have := s.getBytes(slot); string(have) != string(long) {
+		t.Fatalf("have %x, want %x", have, long)
+	}
+	s.setBytes(slot, []byte("short"))
+	if have := s.getBytes(slot); string(have) != "short" {
+		t.Fatalf("have %q, want %q", have, "short")
+	}
+	// Only the length slot and one data word remain.
+	if n := len(s.db.(GenesisStorage)); n != 2 {
+		t.Fatalf("have %d slots, want 2", n)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/security"
+)
+
+// StateParameters stores the SGX consensus parameters changed by governance
+// in the storage of the governance contract.
+type StateParameters struct {
+	storage contractStorage
+}
+
+// NewStateParameters creates the parameter store of the governance contract.
+func NewStateParameters(db StorageDB, contract common.Address) *StateParameters {
+	return &StateParameters{storage: contractStorage{db: db, addr: contract}}
+}
+
+// parameterSlot returns the first slot of the parameter name, following the
+// Solidity layout of string keys, i.e. keccak256(name ++ slot).
+func parameterSlot(name string) common.Hash {
+	return crypto.Keccak256Hash([]byte(name), slotHash(parametersSlot).Bytes())
+}
+
+// SetParameter stores the value of a parameter
+func (p *StateParameters) SetParameter(name string, value uint64) error {
+	if !parameterNames[name] {
+		return fmt.Errorf("%w: %q", ErrUnknownParameter, name)
+	}
+	if err := p.validateParameter(name, value); err != nil {
+		return fmt.Errorf("parameter %s=%d: %w", name, value, err)
+	}
+	base := parameterSlot(name)
+	p.storage.setUint(offsetSlot(base, parameterFieldValue), value)
+	p.storage.setUint(offsetSlot(base, parameterFieldSet), 1)
+	return nil
+}
+
+// validateParameter checks a value against the bounds of the SGX consensus
+// config: block intervals are milliseconds of a time.Duration, counts are
+// ints, and block intervals and block limits must be positive. The minimum
+// block interval cannot exceed the maximum one set by governance. The minimum
+// stake and the blocks per year must be positive, and the slashing rate is at
+// most 100 percent.
+func (p *StateParameters) validateParameter(name string, value uint64) error {
+	switch name {
+	case ParamMinBlockInterval, ParamMaxBlockInterval:
+		if value == 0 || value > math.MaxInt64/uint64(time.Millisecond) {
+			return ErrInvalidParameter
+		}
+		minInterval, minSet := p.GetParameter(ParamMinBlockInterval)
+		maxInterval, maxSet := p.GetParameter(ParamMaxBlockInterval)
+		if name == ParamMinBlockInterval && maxSet && value > maxInterval {
+			return ErrInvalidParameter
+		}
+		if name == ParamMaxBlockInterval && minSet && value < minInterval {
+			return ErrInvalidParameter
+		}
+	case ParamMaxGasPerBlock:
+		if value == 0 {
+			return ErrInvalidParameter
+		}
+	case ParamMaxTxPerBlock:
+		if value == 0 || value > math.MaxInt32 {
+			return ErrInvalidParameter
+		}
+	case ParamMinTxCount, ParamCandidateWindowMs, ParamMaxCandidates:
+		if value > math.MaxInt32 {
+			return ErrInvalidParameter
+		}
+	case ParamMinStakeAmount, ParamBlocksPerYear:
+		if value == 0 {
+			return ErrInvalidParameter
+		}
+	case ParamSlashingRate:
+		if value > 100 {
+			return ErrInvalidParameter
+		}
+	}
+	return nil
+}
+
+// GetParameter returns the value of a parameter and whether governance has
+// set it
+func (p *StateParameters) GetParameter(name string) (uint64, bool) {
+	base := parameterSlot(name)
+	if p.storage.getUint(offsetSlot(base, parameterFieldSet)) == 0 {
+		return 0, false
+	}
+	return p.storage.getUint(offsetSlot(base, parameterFieldValue)), true
+}
+
+// Parameters returns all parameters set by governance.
+func (p *StateParameters) Parameters() map[string]uint64 {
+	params := make(map[string]uint64)
+	for name := range parameterNames {
+		if value, ok := p.GetParameter(name); ok {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+// StakingConfig returns the default staking configuration with the staking
+// parameters set by governance.
+func (p *StateParameters) StakingConfig() *StakingConfig {
+	config := DefaultStakingConfig()
+	if value, ok := p.GetParameter(ParamMinStakeAmount); ok {
+		config.MinStakeAmount = new(big.Int).Mul(new(big.Int).SetUint64(value), big.NewInt(1e18))
+	}
+	if value, ok := p.GetParameter(ParamUnstakeLockPeriod); ok {
+		config.UnstakeLockPeriod = value
+	}
+	if value, ok := p.GetParameter(ParamAnnualRewardRate); ok {
+		config.AnnualRewardRate = value
+	}
+	if value, ok := p.GetParameter(ParamSlashingRate); ok {
+		config.SlashingRate = value
+	}
+	if value, ok := p.GetParameter(ParamBlocksPerYear); ok {
+		config.BlocksPerYear = value
+	}
+	return config
+}
+
+// StateSecurityConfig implements security.SecurityConfigContract on the
+// storage of the security config contract.
+type StateSecurityConfig struct {
+	storage contractStorage
+}
+
+// NewStateSecurityConfig creates the upgrade configuration store of the
+// security config contract.
+func NewStateSecurityConfig(db StorageDB, contract common.Address) *StateSecurityConfig {
+	return &StateSecurityConfig{storage: contractStorage{db: db, addr: contract}}
+}
+
+// GetUpgradeConfig returns the current upgrade configuration, nil if no
+// upgrade has been started
+func (c *StateSecurityConfig) GetUpgradeConfig() *security.UpgradeConfig {
+	base := slotHash(upgradeConfigSlot)
+	config := &security.UpgradeConfig{
+		NewMREnclave:         c.storage.get(offsetSlot(base, upgradeFieldNewMREnclave)),
+		UpgradeCompleteBlock: c.storage.getUint(offsetSlot(base, upgradeFieldCompleteBlock)),
+		UpgradeStartBlock:    c.storage.getUint(offsetSlot(base, upgradeFieldStartBlock)),
+	}
+	if config.NewMREnclave == ([32]byte{}) {
+		return nil
+	}
+	return config
+}
+
+// SetUpgradeConfig sets the upgrade configuration
+func (c *StateSecurityConfig) SetUpgradeConfig(config *security.UpgradeConfig) error {
+	base := slotHash(upgradeConfigSlot)
+	c.storage.set(offsetSlot(base, upgradeFieldNewMREnclave), config.NewMREnclave)
+	c.storage.setUint(offsetSlot(base, upgradeFieldCompleteBlock), config.UpgradeCompleteBlock)
+	c.storage.setUint(offsetSlot(base, upgradeFieldStartBlock), config.UpgradeStartBlock)
+	return nil
+}
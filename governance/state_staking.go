@@ -0,0 +1,231 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/holiman/uint256"
+)
+
+// The governance contract is the locked account of the staked funds. Its
+// balance backs the bonded stake, the stake waiting in the unbonding queue
+// and the unclaimed staking rewards.
+//
+// Rewards accrue per block on the bonded stake, the stake of active
+// validators. Each block mints AnnualRewardRate percent of the total bonded
+// stake divided by BlocksPerYear to the governance contract and raises the
+// reward index, the reward per unit of bonded stake, accordingly. The rewards
+// of a validator are settled against the index whenever its record changes,
+// so that the settled rewards never exceed the minted ones.
+
+// rewardIndexUnit is the fixed-point unit of the reward index.
+var rewardIndexUnit = big.NewInt(1e18)
+
+// maxUnbondingReleases bounds how many unbonding entries are released per
+// block. Entries left over are released in the following blocks.
+const maxUnbondingReleases = 256
+
+// bondedStake returns the stake of a validator that accrues rewards, which is
+// zero unless it is active.
+func bondedStake(v *ValidatorInfo) *big.Int {
+	if v == nil || v.Status != ValidatorStatusActive || v.StakeAmount == nil {
+		return new(big.Int)
+	}
+	return v.StakeAmount
+}
+
+// rewardSlot returns the first slot of the rewards of addr.
+func rewardSlot(addr common.Address) common.Hash {
+	return mappingSlot(addressKey(addr), slotHash(rewardsSlot))
+}
+
+// accruedRewards returns the rewards of addr not yet settled, accrued on
+// bonded since its last settlement.
+func accruedRewards(s contractStorage, addr common.Address, bonded *big.Int) (accrued, index *big.Int) {
+	index = s.getBig(slotHash(rewardIndexSlot))
+	last := s.getBig(offsetSlot(rewardSlot(addr), rewardFieldIndex))
+	accrued = new(big.Int).Sub(index, last)
+	accrued.Mul(accrued, bonded)
+	return accrued.Div(accrued, rewardIndexUnit), index
+}
+
+// settleRewards adds the rewards of addr accrued on bonded since its last
+// settlement to its unclaimed rewards.
+func settleRewards(s contractStorage, addr common.Address, bonded *big.Int) {
+	accrued, index := accruedRewards(s, addr, bonded)
+	base := rewardSlot(addr)
+	if s.getBig(offsetSlot(base, rewardFieldIndex)).Cmp(index) == 0 {
+		return
+	}
+	if accrued.Sign() > 0 {
+		amount := s.getBig(offsetSlot(base, rewardFieldAmount))
+		s.setBig(offsetSlot(base, rewardFieldAmount), amount.Add(amount, accrued))
+	}
+	s.setBig(offsetSlot(base, rewardFieldIndex), index)
+}
+
+// updateBonded moves the bonded stake of a validator whose record changes
+// from old to new in the total bonded stake. Old is nil for new validators.
+func updateBonded(s contractStorage, old, new *ValidatorInfo) {
+	sub, add := bondedStake(old), bondedStake(new)
+	if sub.Cmp(add) == 0 {
+		return
+	}
+	total := s.getBig(slotHash(totalBondedSlot))
+	total.Sub(total, sub).Add(total, add)
+	if total.Sign() < 0 {
+		total.SetUint64(0)
+	}
+	s.setBig(slotHash(totalBondedSlot), total)
+}
+
+// unbondingSlot returns the first slot of the entry index of the unbonding
+// queue.
+func unbondingSlot(index uint64) common.Hash {
+	return listSlot(slotHash(unbondingQueueSlot), index*unbondingFields)
+}
+
+// transfer moves amount from the governance contract to addr.
+func (vm *StateValidatorManager) transfer(addr common.Address, amount *big.Int) {
+	if amount.Sign() <= 0 {
+		return
+	}
+	value := uint256.MustFromBig(amount)
+	vm.db.SubBalance(vm.contract, value, tracing.BalanceChangeTransfer)
+	vm.db.AddBalance(addr, value, tracing.BalanceChangeTransfer)
+}
+
+// unbond queues amount of stake of addr for release after the unstake lock
+// period.
+func (vm *StateValidatorManager) unbond(addr common.Address, amount *big.Int) {
+	if amount.Sign() <= 0 {
+		return
+	}
+	slot := slotHash(unbondingQueueSlot)
+	index := vm.storage.getUint(slot)
+	base := unbondingSlot(index)
+	vm.storage.set(offsetSlot(base, unbondingFieldOwner), addressKey(addr))
+	vm.storage.setBig(offsetSlot(base, unbondingFieldAmount), amount)
+	vm.storage.setUint(offsetSlot(base, unbondingFieldReleaseAt), vm.number+vm.config.UnstakeLockPeriod)
+	vm.storage.setUint(slot, index+1)
+}
+
+// unbondingCount returns the number of entries waiting in the unbonding
+// queue. Unstaking fails while maxListEntries of them are waiting.
+func (vm *StateValidatorManager) unbondingCount() uint64 {
+	head, length := vm.storage.getUint(slotHash(unbondingHeadSlot)), vm.storage.getUint(slotHash(unbondingQueueSlot))
+	return length - min(head, length)
+}
+
+// Unbonding returns the stake of addr waiting in the unbonding queue.
+func (vm *StateValidatorManager) Unbonding(addr common.Address) *big.Int {
+	s, total := vm.storage, new(big.Int)
+	head, length := s.getUint(slotHash(unbondingHeadSlot)), s.getUint(slotHash(unbondingQueueSlot))
+	for i := head; i < length; i++ {
+		base := unbondingSlot(i)
+		if s.get(offsetSlot(base, unbondingFieldOwner)) == addressKey(addr) {
+			total.Add(total, s.getBig(offsetSlot(base, unbondingFieldAmount)))
+		}
+	}
+	return total
+}
+
+// slashAmount returns the part of amount slashed for misbehavior.
+func (vm *StateValidatorManager) slashAmount(amount *big.Int) *big.Int {
+	slashed := new(big.Int).Mul(amount, new(big.Int).SetUint64(vm.config.SlashingRate))
+	return slashed.Div(slashed, big.NewInt(100))
+}
+
+// slashUnbonding slashes the entries of addr waiting in the unbonding queue
+// and returns the total slashed amount.
+func (vm *StateValidatorManager) slashUnbonding(addr common.Address) *big.Int {
+	s, total := vm.storage, new(big.Int)
+	head, length := s.getUint(slotHash(unbondingHeadSlot)), s.getUint(slotHash(unbondingQueueSlot))
+	for i := head; i < length; i++ {
+		base := unbondingSlot(i)
+		if s.get(offsetSlot(base, unbondingFieldOwner)) != addressKey(addr) {
+			continue
+		}
+		amount := s.getBig(offsetSlot(base, unbondingFieldAmount))
+		slashed := vm.slashAmount(amount)
+		s.setBig(offsetSlot(base, unbondingFieldAmount), amount.Sub(amount, slashed))
+		total.Add(total, slashed)
+	}
+	return total
+}
+
+// PendingRewards returns the unclaimed staking rewards of addr.
+func (vm *StateValidatorManager) PendingRewards(addr common.Address) *big.Int {
+	accrued, _ := accruedRewards(vm.storage, addr, bondedStake(readValidator(vm.storage, addr)))
+	return accrued.Add(accrued, vm.storage.getBig(offsetSlot(rewardSlot(addr), rewardFieldAmount)))
+}
+
+// FinalizeBlock releases the unbonded stake due at the current block and
+// accrues the staking rewards of the block. The consensus engine calls it
+// once per block.
+func (vm *StateValidatorManager) FinalizeBlock() {
+	vm.releaseUnbonded()
+	vm.accrueRewards()
+}
+
+// releaseUnbonded pays out the entries of the unbonding queue whose lock
+// period has passed. Entries are queued in release order.
+func (vm *StateValidatorManager) releaseUnbonded() {
+	s := vm.storage
+	head, length := s.getUint(slotHash(unbondingHeadSlot)), s.getUint(slotHash(unbondingQueueSlot))
+	next := head
+	for ; next < length && next-head < maxUnbondingReleases; next++ {
+		base := unbondingSlot(next)
+		if s.getUint(offsetSlot(base, unbondingFieldReleaseAt)) > vm.number {
+			break
+		}
+		owner := common.BytesToAddress(s.get(offsetSlot(base, unbondingFieldOwner)).Bytes())
+		vm.transfer(owner, s.getBig(offsetSlot(base, unbondingFieldAmount)))
+		for field := uint64(0); field < unbondingFields; field++ {
+			s.set(offsetSlot(base, field), common.Hash{})
+		}
+	}
+	if next != head {
+		s.setUint(slotHash(unbondingHeadSlot), next)
+	}
+}
+
+// accrueRewards mints the staking rewards of the block to the governance
+// contract and raises the reward index.
+func (vm *StateValidatorManager) accrueRewards() {
+	if vm.config.AnnualRewardRate == 0 || vm.config.BlocksPerYear == 0 {
+		return
+	}
+	s := vm.storage
+	total := s.getBig(slotHash(totalBondedSlot))
+	if total.Sign() == 0 {
+		return
+	}
+	reward := new(big.Int).Mul(total, new(big.Int).SetUint64(vm.config.AnnualRewardRate))
+	reward.Div(reward, new(big.Int).Mul(big.NewInt(100), new(big.Int).SetUint64(vm.config.BlocksPerYear)))
+	delta := new(big.Int).Mul(reward, rewardIndexUnit)
+	delta.Div(delta, total)
+	if delta.Sign() == 0 {
+		return
+	}
+	index := s.getBig(slotHash(rewardIndexSlot))
+	s.setBig(slotHash(rewardIndexSlot), index.Add(index, delta))
+	vm.db.AddBalance(vm.contract, uint256.MustFromBig(reward), tracing.BalanceIncreaseRewardMineBlock)
+}
@@ -0,0 +1,258 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/holiman/uint256"
+)
+
+// fundStakers credits amount to the balance of each staker.
+func fundStakers(statedb StateDB, amount *big.Int, stakers ...common.Address) {
+	for _, addr := range stakers {
+		statedb.AddBalance(addr, uint256.MustFromBig(amount), tracing.BalanceChangeUnspecified)
+	}
+}
+
+func TestStakingLifecycle(t *testing.T) {
+	statedb := newTestState(t)
+	config := DefaultStakingConfig()
+	config.UnstakeLockPeriod = 10
+	config.BlocksPerYear = 100
+	config.SlashRecipient = common.HexToAddress("0xfee")
+	manager := func(number uint64) *StateValidatorManager {
+		return NewStateValidatorManager(statedb, testGovernance, number, config)
+	}
+	balance := func(addr common.Address) *big.Int {
+		return statedb.GetBalance(addr).ToBig()
+	}
+	minStake := config.MinStakeAmount
+	a, b := testCommunity[0], testCommunity[1]
+	fundStakers(statedb, new(big.Int).Mul(minStake, big.NewInt(2)), a, b)
+
+	if err := manager(1).Stake(a, new(big.Int).Mul(minStake, big.NewInt(2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager(1).Stake(a, minStake); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("stake without funds: have %v, want %v", err, ErrInsufficientBalance)
+	}
+
+	// Each block accrues AnnualRewardRate/BlocksPerYear of the bonded stake.
+	for number := uint64(1); number <= 4; number++ {
+		manager(number).FinalizeBlock()
+	}
+	perBlock := new(big.Int).Div(minStake, big.NewInt(1000))
+	want := new(big.Int).Mul(perBlock, big.NewInt(4))
+	if rewards := manager(5).PendingRewards(a); rewards.Cmp(want) != 0 {
+		t.Fatalf("have rewards %v, want %v", rewards, want)
+	}
+
+	// A later staker does not share earlier rewards.
+	if err := manager(5).Stake(b, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if rewards := manager(5).PendingRewards(b); rewards.Sign() != 0 {
+		t.Fatalf("have rewards %v for new staker", rewards)
+	}
+	rewards, err := manager(5).ClaimRewards(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewards.Cmp(want) != 0 || balance(a).Cmp(want) != 0 {
+		t.Fatalf("claimed %v, balance %v, want %v", rewards, balance(a), want)
+	}
+	if rewards := manager(5).PendingRewards(a); rewards.Sign() != 0 {
+		t.Fatalf("have rewards %v after claiming", rewards)
+	}
+
+	// Slashing moves SlashingRate percent of the stake to the slash recipient
+	// and a jailed validator stops accruing rewards.
+	if err := manager(5).Slash(b, "test"); err != nil {
+		t.Fatal(err)
+	}
+	slashed := new(big.Int).Div(new(big.Int).Mul(minStake, big.NewInt(int64(config.SlashingRate))), big.NewInt(100))
+	if balance(config.SlashRecipient).Cmp(slashed) != 0 {
+		t.Fatalf("slash recipient has %v, want %v", balance(config.SlashRecipient), slashed)
+	}
+	manager(5).FinalizeBlock()
+	if rewards := manager(6).PendingRewards(b); rewards.Sign() != 0 {
+		t.Fatalf("jailed validator accrued %v", rewards)
+	}
+	if rewards := manager(6).PendingRewards(a); rewards.Cmp(perBlock) != 0 {
+		t.Fatalf("have rewards %v, want %v", rewards, perBlock)
+	}
+
+	// Unstaked funds are released after the lock period.
+	if err := manager(6).Unstake(a, minStake); err != nil {
+		t.Fatal(err)
+	}
+	before := balance(a)
+	manager(15).FinalizeBlock()
+	if balance(a).Cmp(before) != 0 {
+		t.Fatal("unbonded stake released before the lock period")
+	}
+	manager(16).FinalizeBlock()
+	if have := new(big.Int).Sub(balance(a), before); have.Cmp(minStake) != 0 {
+		t.Fatalf("released %v, want %v", have, minStake)
+	}
+	if unbonding := manager(16).Unbonding(a); unbonding.Sign() != 0 {
+		t.Fatalf("have %v unbonding after release", unbonding)
+	}
+	checkStakingSolvency(t, statedb, manager(16), a, b)
+}
+
+// Tests that inactive validators claim their rewards and reactivate when
+// bonding back to the minimum stake, and that slashing reaches the stake the
+// offender is unbonding.
+func TestStakingStatusChanges(t *testing.T) {
+	statedb := newTestState(t)
+	config := DefaultStakingConfig()
+	config.UnstakeLockPeriod = 10
+	config.BlocksPerYear = 100
+	config.SlashRecipient = common.HexToAddress("0xfee")
+	manager := func(number uint64) *StateValidatorManager {
+		return NewStateValidatorManager(statedb, testGovernance, number, config)
+	}
+	status := func(addr common.Address) ValidatorStatus {
+		v, err := manager(0).GetValidator(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.Status
+	}
+	minStake := config.MinStakeAmount
+	a, b := testCommunity[0], testCommunity[1]
+	fundStakers(statedb, new(big.Int).Mul(minStake, big.NewInt(3)), a, b)
+
+	if err := manager(1).Stake(a, new(big.Int).Mul(minStake, big.NewInt(2))); err != nil {
+		t.Fatal(err)
+	}
+	manager(1).FinalizeBlock()
+
+	// An inactive validator still claims the rewards it earned.
+	unstaked := new(big.Int).Add(minStake, common.Big1)
+	if err := manager(2).Unstake(a, unstaked); err != nil {
+		t.Fatal(err)
+	}
+	if status(a) != ValidatorStatusInactive {
+		t.Fatalf("have status %d, want inactive", status(a))
+	}
+	rewards, err := manager(2).ClaimRewards(a)
+	if err != nil {
+		t.Fatalf("claim of inactive validator: %v", err)
+	}
+	if rewards.Sign() == 0 {
+		t.Fatal("inactive validator claimed no rewards")
+	}
+	// Bonding back to the minimum stake reactivates it.
+	if err := manager(3).Stake(a, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if status(a) != ValidatorStatusActive {
+		t.Fatalf("have status %d, want active", status(a))
+	}
+	// Slashing also takes SlashingRate percent of the unbonding stake.
+	stake := new(big.Int).Sub(new(big.Int).Mul(minStake, big.NewInt(3)), unstaked)
+	if err := manager(4).Slash(a, "test"); err != nil {
+		t.Fatal(err)
+	}
+	slash := func(amount *big.Int) *big.Int {
+		return new(big.Int).Div(new(big.Int).Mul(amount, big.NewInt(int64(config.SlashingRate))), big.NewInt(100))
+	}
+	if unbonding, want := manager(4).Unbonding(a), new(big.Int).Sub(unstaked, slash(unstaked)); unbonding.Cmp(want) != 0 {
+		t.Fatalf("have %v unbonding after slash, want %v", unbonding, want)
+	}
+	want := new(big.Int).Add(slash(stake), slash(unstaked))
+	if have := statedb.GetBalance(config.SlashRecipient).ToBig(); have.Cmp(want) != 0 {
+		t.Fatalf("slash recipient has %v, want %v", have, want)
+	}
+	// Jailed validators stay jailed when bonding.
+	if err := manager(4).Stake(b, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager(4).Slash(b, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager(5).Stake(b, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if status(b) != ValidatorStatusJailed {
+		t.Fatalf("have status %d, want jailed", status(b))
+	}
+	checkStakingSolvency(t, statedb, manager(5), a, b)
+}
+
+// checkStakingSolvency checks that the governance contract holds the bonded
+// and unbonding stake and the pending rewards of the stakers.
+func checkStakingSolvency(t *testing.T, statedb *state.StateDB, vm *StateValidatorManager, stakers ...common.Address) {
+	t.Helper()
+	owed := new(big.Int)
+	for _, addr := range stakers {
+		if v, err := vm.GetValidator(addr); err == nil {
+			owed.Add(owed, v.StakeAmount)
+		}
+		owed.Add(owed, vm.Unbonding(addr))
+		owed.Add(owed, vm.PendingRewards(addr))
+	}
+	if have := statedb.GetBalance(testGovernance).ToBig(); have.Cmp(owed) < 0 {
+		t.Fatalf("governance contract holds %v, owes %v", have, owed)
+	}
+}
+
+// Tests that staking binds a validator to an SGX producer ID once, and that
+// neither side can be rebound to another.
+func TestStakeProducer(t *testing.T) {
+	statedb := newTestState(t)
+	config := DefaultStakingConfig()
+	manager := NewStateValidatorManager(statedb, testGovernance, 1, config)
+	minStake := config.MinStakeAmount
+	a, b := testCommunity[0], testCommunity[1]
+	fundStakers(statedb, new(big.Int).Mul(minStake, big.NewInt(3)), a, b)
+
+	producer, other := common.Hash{0x01}, common.Hash{0x02}
+	if _, ok := manager.ProducerStaker(producer); ok {
+		t.Fatal("unbound producer resolved")
+	}
+	if err := manager.StakeProducer(a, producer, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if staker, ok := manager.ProducerStaker(producer); !ok || staker != a {
+		t.Fatalf("producer resolved to %v, %v", staker, ok)
+	}
+	// Staking more without a producer ID keeps the binding.
+	if err := manager.Stake(a, minStake); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := manager.GetValidator(a); v.ProducerID != producer {
+		t.Fatalf("binding lost: %x", v.ProducerID)
+	}
+	if err := manager.StakeProducer(a, other, minStake); !errors.Is(err, ErrProducerBound) {
+		t.Fatalf("rebinding validator: have %v, want %v", err, ErrProducerBound)
+	}
+	if err := manager.StakeProducer(b, producer, minStake); !errors.Is(err, ErrProducerBound) {
+		t.Fatalf("binding bound producer: have %v, want %v", err, ErrProducerBound)
+	}
+	if statedb.GetBalance(b).ToBig().Cmp(new(big.Int).Mul(minStake, big.NewInt(3))) != 0 {
+		t.Fatal("failed stake moved funds")
+	}
+}
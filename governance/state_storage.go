@@ -0,0 +1,325 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
+)
+
+// StorageDB is the storage of the system contracts.
+type StorageDB interface {
+	GetState(addr common.Address, slot common.Hash) common.Hash
+	SetState(addr common.Address, slot common.Hash, value common.Hash) common.Hash
+}
+
+// StateDB is the part of the EVM state used by the state-backed managers and
+// the native governance contract.
+type StateDB interface {
+	StorageDB
+	GetBalance(addr common.Address) *uint256.Int
+	AddBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) uint256.Int
+	SubBalance(addr common.Address, amount *uint256.Int, reason tracing.BalanceChangeReason) uint256.Int
+	GetNonce(addr common.Address) uint64
+	SetNonce(addr common.Address, nonce uint64, reason tracing.NonceChangeReason)
+}
+
+// Storage layout of the governance contract, following the Solidity layout
+// rules:
+//
+//	slot 0: bytes32[] proposalList
+//	slot 1: mapping(bytes32 => Proposal) proposals
+//	slot 2: mapping(bytes32 => address[]) proposalVoters
+//	slot 3: mapping(bytes32 => mapping(address => Vote)) votes
+//	slot 4: address[] validatorList
+//	slot 5: mapping(address => Validator) validators
+//	slot 6: mapping(string => Parameter) parameters
+//	slot 7: mapping(bytes32 => uint256[]) powerCheckpoints
+//	slot 8: uint256 totalBonded
+//	slot 9: uint256 rewardIndex
+//	slot 10: mapping(address => Rewards) rewards
+//	slot 11: Unbonding[] unbondingQueue
+//	slot 12: uint256 unbondingHead
+//	slot 13: mapping(address => uint256) validatorIndex
+//	slot 14: mapping(bytes32 => address) producerStakers
+//
+// The security config contract keeps the whitelist layout read by the
+// consensus engine in slots 0 to 3 and adds the entry details:
+//
+//	slot 4: mapping(bytes32 => Entry) mrEnclaveEntries
+//	slot 5: UpgradeConfig upgradeConfig
+//
+// Struct fields take one slot each, in the order of the *Field constants, and
+// array elements of struct type take as many consecutive slots as fields.
+// Unlike Solidity, byte strings are never packed: their slot holds the length
+// and the data follows in words at keccak256(slot).
+const (
+	proposalListSlot   = 0
+	proposalsSlot      = 1
+	proposalVotersSlot = 2
+	votesSlot          = 3
+	validatorListSlot  = 4
+	validatorsSlot     = 5
+	parametersSlot     = 6
+	checkpointsSlot    = 7
+	totalBondedSlot    = 8
+	rewardIndexSlot    = 9
+	rewardsSlot        = 10
+	unbondingQueueSlot = 11
+	unbondingHeadSlot  = 12
+	validatorIndexSlot = 13
+	producerStakerSlot = 14
+
+	allowedMREnclavesSlot = 0
+	allowedMRSignersSlot  = 1
+	mrEnclaveListSlot     = 2
+	mrSignerListSlot      = 3
+	mrEnclaveEntriesSlot  = 4
+	upgradeConfigSlot     = 5
+)
+
+// Fields of a Proposal.
+const (
+	proposalFieldType = iota
+	proposalFieldProposer
+	proposalFieldTarget
+	proposalFieldDescription
+	proposalFieldCreatedAt
+	proposalFieldVotingEndsAt
+	proposalFieldExecuteAfter
+	proposalFieldStatus
+	proposalFieldCoreYes
+	proposalFieldCoreNo
+	proposalFieldCommunityYes
+	proposalFieldCommunityNo
+)
+
+// Fields of a Vote.
+const (
+	voteFieldSupport = iota // 1 = 赞成, 2 = 反对, 0 = 未投票
+	voteFieldWeight
+	voteFieldTimestamp
+	voteFieldSignature
+)
+
+// Fields of a Validator.
+const (
+	validatorFieldType = iota
+	validatorFieldMREnclave
+	validatorFieldStake
+	validatorFieldJoinedAt
+	validatorFieldLastActiveAt
+	validatorFieldVotingPower
+	validatorFieldStatus
+	validatorFieldDelegate
+	validatorFieldProducer
+)
+
+// Fields of the Rewards of a validator.
+const (
+	rewardFieldIndex  = iota // 上次结算时的 rewardIndex
+	rewardFieldAmount        // 待领取奖励
+)
+
+// Fields of an Unbonding.
+const (
+	unbondingFieldOwner = iota
+	unbondingFieldAmount
+	unbondingFieldReleaseAt
+	unbondingFields // Unbonding 占用的槽数
+)
+
+// Fields of an Entry.
+const (
+	entryFieldListed = iota // 已加入 mrEnclaveList
+	entryFieldVersion
+	entryFieldAddedAt
+	entryFieldAddBy
+	entryFieldPermissionLevel
+	entryFieldStatus
+)
+
+// Fields of a Parameter.
+const (
+	parameterFieldValue = iota
+	parameterFieldSet   // 已设置
+)
+
+// Fields of the UpgradeConfig.
+const (
+	upgradeFieldNewMREnclave = iota
+	upgradeFieldCompleteBlock
+	upgradeFieldStartBlock
+)
+
+const (
+	// maxListEntries bounds how many list entries are read per list, so that
+	// a corrupted length cannot make reads unbounded.
+	maxListEntries = 4096
+
+	// maxValidators bounds the live validators in the validator list, and
+	// with it the votes of a proposal.
+	maxValidators = 1024
+
+	// maxBytesLength bounds the length of stored byte strings.
+	maxBytesLength = 4096
+)
+
+// slotHash returns a slot number as a storage key.
+func slotHash(slot uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(slot))
+}
+
+// mappingSlot returns the storage slot of key in the mapping at slot, i.e.
+// keccak256(abi.encode(key, slot)).
+func mappingSlot(key common.Hash, slot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), slot.Bytes())
+}
+
+// addressKey returns an address as a mapping key.
+func addressKey(addr common.Address) common.Hash {
+	return common.BytesToHash(addr.Bytes())
+}
+
+// offsetSlot returns the storage slot offset words after base.
+func offsetSlot(base common.Hash, offset uint64) common.Hash {
+	n := base.Big()
+	return common.BigToHash(n.Add(n, new(big.Int).SetUint64(offset)))
+}
+
+// listSlot returns the storage slot of element index of the dynamic array at
+// slot, i.e. keccak256(abi.encode(slot)) + index.
+func listSlot(slot common.Hash, index uint64) common.Hash {
+	return offsetSlot(crypto.Keccak256Hash(slot.Bytes()), index)
+}
+
+// contractStorage reads and writes the storage of a system contract.
+type contractStorage struct {
+	db   StorageDB
+	addr common.Address
+}
+
+func (s contractStorage) get(slot common.Hash) common.Hash {
+	return s.db.GetState(s.addr, slot)
+}
+
+func (s contractStorage) set(slot common.Hash, value common.Hash) {
+	s.db.SetState(s.addr, slot, value)
+}
+
+func (s contractStorage) getUint(slot common.Hash) uint64 {
+	n := s.get(slot).Big()
+	if !n.IsUint64() {
+		return 0
+	}
+	return n.Uint64()
+}
+
+func (s contractStorage) setUint(slot common.Hash, value uint64) {
+	s.set(slot, slotHash(value))
+}
+
+func (s contractStorage) getBig(slot common.Hash) *big.Int {
+	return s.get(slot).Big()
+}
+
+func (s contractStorage) setBig(slot common.Hash, value *big.Int) {
+	s.set(slot, common.BigToHash(value))
+}
+
+// getBytes returns the byte string stored at slot.
+func (s contractStorage) getBytes(slot common.Hash) []byte {
+	length := s.getUint(slot)
+	if length > maxBytesLength {
+		length = maxBytesLength
+	}
+	data := make([]byte, 0, length+31)
+	for i := uint64(0); uint64(len(data)) < length; i++ {
+		word := s.get(listSlot(slot, i))
+		data = append(data, word[:]...)
+	}
+	return data[:length]
+}
+
+// setBytes stores a byte string at slot, clearing the words of a longer
+// previous value.
+func (s contractStorage) setBytes(slot common.Hash, data []byte) {
+	words := (uint64(len(data)) + 31) / 32
+	oldWords := (min(s.getUint(slot), maxBytesLength) + 31) / 32
+	for i := uint64(0); i < words; i++ {
+		var word common.Hash
+		copy(word[:], data[i*32:])
+		s.set(listSlot(slot, i), word)
+	}
+	for i := words; i < oldWords; i++ {
+		s.set(listSlot(slot, i), common.Hash{})
+	}
+	s.setUint(slot, uint64(len(data)))
+}
+
+// list returns the elements of the dynamic array at slot, failing with
+// ErrListTooLong for arrays longer than maxListEntries.
+func (s contractStorage) list(slot common.Hash) ([]common.Hash, error) {
+	length := s.getUint(slot)
+	if length > maxListEntries {
+		return nil, ErrListTooLong
+	}
+	elems := make([]common.Hash, 0, length)
+	for i := uint64(0); i < length; i++ {
+		elems = append(elems, s.get(listSlot(slot, i)))
+	}
+	return elems, nil
+}
+
+// tail returns the last maxListEntries elements of the dynamic array at slot.
+func (s contractStorage) tail(slot common.Hash) []common.Hash {
+	length := s.getUint(slot)
+	start := length - min(length, maxListEntries)
+	elems := make([]common.Hash, 0, length-start)
+	for i := start; i < length; i++ {
+		elems = append(elems, s.get(listSlot(slot, i)))
+	}
+	return elems
+}
+
+// appendList appends an element to the dynamic array at slot.
+func (s contractStorage) appendList(slot common.Hash, elem common.Hash) {
+	length := s.getUint(slot)
+	s.set(listSlot(slot, length), elem)
+	s.setUint(slot, length+1)
+}
+
+// GenesisStorage is the storage of a system contract in a genesis allocation.
+type GenesisStorage map[common.Hash]common.Hash
+
+func (g GenesisStorage) GetState(addr common.Address, slot common.Hash) common.Hash {
+	return g[slot]
+}
+
+func (g GenesisStorage) SetState(addr common.Address, slot common.Hash, value common.Hash) common.Hash {
+	prev := g[slot]
+	if value == (common.Hash{}) {
+		delete(g, slot)
+	} else {
+		g[slot] = value
+	}
+	return prev
+}
@@ -0,0 +1,449 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/tracing"
+	"github.com/holiman/uint256"
+)
+
+// StateValidatorManager implements ValidatorManager on the storage of the
+// governance contract. The governance contract holds the staked funds, see
+// state_staking.go for the staking lifecycle.
+type StateValidatorManager struct {
+	config   *StakingConfig
+	storage  contractStorage
+	db       StateDB
+	contract common.Address
+	number   uint64
+}
+
+// NewStateValidatorManager creates a validator manager on the state of the
+// governance contract at the given block.
+func NewStateValidatorManager(db StateDB, contract common.Address, number uint64, config *StakingConfig) *StateValidatorManager {
+	return &StateValidatorManager{
+		config:   config,
+		storage:  contractStorage{db: db, addr: contract},
+		db:       db,
+		contract: contract,
+		number:   number,
+	}
+}
+
+// validatorSlot returns the first slot of the validator record of addr.
+func validatorSlot(addr common.Address) common.Hash {
+	return mappingSlot(addressKey(addr), slotHash(validatorsSlot))
+}
+
+// readValidator reads the validator record of addr, nil if there is none.
+func readValidator(s contractStorage, addr common.Address) *ValidatorInfo {
+	base := validatorSlot(addr)
+	status := s.getUint(offsetSlot(base, validatorFieldStatus))
+	if status == 0 {
+		return nil
+	}
+	return &ValidatorInfo{
+		Address:      addr,
+		Type:         VoterType(s.getUint(offsetSlot(base, validatorFieldType))),
+		MRENCLAVE:    s.get(offsetSlot(base, validatorFieldMREnclave)),
+		StakeAmount:  s.getBig(offsetSlot(base, validatorFieldStake)),
+		JoinedAt:     s.getUint(offsetSlot(base, validatorFieldJoinedAt)),
+		LastActiveAt: s.getUint(offsetSlot(base, validatorFieldLastActiveAt)),
+		VotingPower:  s.getUint(offsetSlot(base, validatorFieldVotingPower)),
+		Status:       ValidatorStatus(status),
+		Delegate:     common.BytesToAddress(s.get(offsetSlot(base, validatorFieldDelegate)).Bytes()),
+		ProducerID:   s.get(offsetSlot(base, validatorFieldProducer)),
+	}
+}
+
+// validatorIndexKey returns the slot of the position of addr in the
+// validator list, plus one, or zero if addr is not listed.
+func validatorIndexKey(addr common.Address) common.Hash {
+	return mappingSlot(addressKey(addr), slotHash(validatorIndexSlot))
+}
+
+// validatorListed reports whether addr is in the validator list.
+func validatorListed(s contractStorage, addr common.Address) bool {
+	return s.getUint(validatorIndexKey(addr)) != 0
+}
+
+// validatorLive reports whether a validator belongs in the validator list,
+// i.e. it is not exiting and has stake or voting power.
+func validatorLive(v *ValidatorInfo) bool {
+	if v.Status == ValidatorStatusExiting {
+		return false
+	}
+	return v.VotingPower > 0 || (v.StakeAmount != nil && v.StakeAmount.Sign() > 0)
+}
+
+// updateValidatorList adds a validator to the validator list when it becomes
+// live and removes it when it exits or runs out of stake, moving the last
+// validator of the list to its position. The records of removed validators
+// are kept for their rewards and unbonding stake.
+func updateValidatorList(s contractStorage, v *ValidatorInfo) {
+	var (
+		list     = slotHash(validatorListSlot)
+		index    = validatorIndexKey(v.Address)
+		position = s.getUint(index)
+	)
+	switch live := validatorLive(v); {
+	case live && position == 0:
+		s.appendList(list, addressKey(v.Address))
+		s.setUint(index, s.getUint(list))
+
+	case !live && position != 0:
+		length := s.getUint(list)
+		if position != length {
+			last := s.get(listSlot(list, length-1))
+			s.set(listSlot(list, position-1), last)
+			s.setUint(mappingSlot(last, slotHash(validatorIndexSlot)), position)
+		}
+		s.set(listSlot(list, length-1), common.Hash{})
+		s.setUint(list, length-1)
+		s.setUint(index, 0)
+	}
+}
+
+// writeValidator stores a validator record at block number, keeping the
+// validator list to the live validators, settling the rewards accrued on the
+// old record and checkpointing changes of voting power.
+func writeValidator(s contractStorage, number uint64, v *ValidatorInfo) {
+	base := validatorSlot(v.Address)
+	old := readValidator(s, v.Address)
+	settleRewards(s, v.Address, bondedStake(old))
+	stake := v.StakeAmount
+	if stake == nil {
+		stake = new(big.Int)
+	}
+	s.setUint(offsetSlot(base, validatorFieldType), uint64(v.Type))
+	s.set(offsetSlot(base, validatorFieldMREnclave), v.MRENCLAVE)
+	s.setBig(offsetSlot(base, validatorFieldStake), stake)
+	s.setUint(offsetSlot(base, validatorFieldJoinedAt), v.JoinedAt)
+	s.setUint(offsetSlot(base, validatorFieldLastActiveAt), v.LastActiveAt)
+	s.setUint(offsetSlot(base, validatorFieldVotingPower), v.VotingPower)
+	s.setUint(offsetSlot(base, validatorFieldStatus), uint64(v.Status))
+	s.set(offsetSlot(base, validatorFieldDelegate), addressKey(v.Delegate))
+	s.set(offsetSlot(base, validatorFieldProducer), v.ProducerID)
+	if v.ProducerID != (common.Hash{}) {
+		s.set(producerStakerKey(v.ProducerID), addressKey(v.Address))
+	}
+	updateValidatorList(s, v)
+	updatePower(s, number, old, v)
+	updateBonded(s, old, v)
+}
+
+// GetValidator returns information about a validator
+func (vm *StateValidatorManager) GetValidator(addr common.Address) (*ValidatorInfo, error) {
+	validator := readValidator(vm.storage, addr)
+	if validator == nil {
+		return nil, ErrValidatorNotFound
+	}
+	return validator, nil
+}
+
+// GetAllValidators returns the live validators, in list order. The
+// validator list is bounded by maxValidators when written, only a corrupt
+// list longer than maxListEntries yields no validators.
+func (vm *StateValidatorManager) GetAllValidators() []*ValidatorInfo {
+	validators, _ := vm.Validators()
+	return validators
+}
+
+// Validators returns the live validators, in list order, failing with
+// ErrListTooLong for a corrupt validator list.
+func (vm *StateValidatorManager) Validators() ([]*ValidatorInfo, error) {
+	keys, err := vm.storage.list(slotHash(validatorListSlot))
+	if err != nil {
+		return nil, err
+	}
+	var validators []*ValidatorInfo
+	for _, key := range keys {
+		if validator := readValidator(vm.storage, common.BytesToAddress(key.Bytes())); validator != nil {
+			validators = append(validators, validator)
+		}
+	}
+	return validators, nil
+}
+
+// validatorCount returns the number of live validators.
+func (vm *StateValidatorManager) validatorCount() uint64 {
+	return vm.storage.getUint(slotHash(validatorListSlot))
+}
+
+// activeValidators returns the active validators of the given type.
+func (vm *StateValidatorManager) activeValidators(vtype VoterType) []*ValidatorInfo {
+	validators := make([]*ValidatorInfo, 0)
+	for _, v := range vm.GetAllValidators() {
+		if v.Type == vtype && v.Status == ValidatorStatusActive {
+			validators = append(validators, v)
+		}
+	}
+	return validators
+}
+
+// GetCoreValidators returns all core validators
+func (vm *StateValidatorManager) GetCoreValidators() []*ValidatorInfo {
+	return vm.activeValidators(VoterTypeCore)
+}
+
+// GetCommunityValidators returns all community validators
+func (vm *StateValidatorManager) GetCommunityValidators() []*ValidatorInfo {
+	return vm.activeValidators(VoterTypeCommunity)
+}
+
+// IsValidator checks if an address is an active validator
+func (vm *StateValidatorManager) IsValidator(addr common.Address) bool {
+	validator := readValidator(vm.storage, addr)
+	return validator != nil && validator.Status == ValidatorStatusActive
+}
+
+// GetVoterType returns the voter type for an address
+func (vm *StateValidatorManager) GetVoterType(addr common.Address) VoterType {
+	validator := readValidator(vm.storage, addr)
+	if validator == nil {
+		return VoterTypeCommunity // Default to community
+	}
+	return validator.Type
+}
+
+// producerStakerKey returns the slot of the validator bound to an SGX
+// producer ID.
+func producerStakerKey(producerID common.Hash) common.Hash {
+	return mappingSlot(producerID, slotHash(producerStakerSlot))
+}
+
+// ProducerStaker returns the validator that bound the SGX producer ID when
+// staking, through which double-sign evidence of the producer slashes stake.
+func (vm *StateValidatorManager) ProducerStaker(producerID common.Hash) (common.Address, bool) {
+	if producerID == (common.Hash{}) {
+		return common.Address{}, false
+	}
+	staker := vm.storage.get(producerStakerKey(producerID))
+	return common.BytesToAddress(staker.Bytes()), staker != (common.Hash{})
+}
+
+// Stake adds stake for a validator, moving the staked funds from its balance
+// to the governance contract.
+func (vm *StateValidatorManager) Stake(addr common.Address, amount *big.Int) error {
+	return vm.StakeProducer(addr, common.Hash{}, amount)
+}
+
+// StakeProducer adds stake for a validator like Stake and binds it to the
+// SGX producer ID unless the ID is zero. A producer is bound to at most one
+// validator and a validator to at most one producer, for good: binding only
+// puts the stake of the validator at risk for the producer's double signs.
+func (vm *StateValidatorManager) StakeProducer(addr common.Address, producerID common.Hash, amount *big.Int) error {
+	if amount.Cmp(vm.config.MinStakeAmount) < 0 {
+		return ErrInsufficientStake
+	}
+	if vm.db.GetBalance(addr).CmpBig(amount) < 0 {
+		return ErrInsufficientBalance
+	}
+	if err := vm.bondProducer(addr, producerID, amount); err != nil {
+		return err
+	}
+	value := uint256.MustFromBig(amount)
+	vm.db.SubBalance(addr, value, tracing.BalanceChangeTransfer)
+	vm.db.AddBalance(vm.contract, value, tracing.BalanceChangeTransfer)
+	return nil
+}
+
+// bondProducer adds stake for a validator whose funds have already been
+// transferred to the governance contract, binding it to the SGX producer ID
+// unless the ID is zero. Validators not in the validator list join it while
+// it has room for them, and inactive validators back at the minimum stake
+// become active again. Jailed and exiting validators keep their status.
+func (vm *StateValidatorManager) bondProducer(addr common.Address, producerID common.Hash, amount *big.Int) error {
+	if amount.Cmp(vm.config.MinStakeAmount) < 0 {
+		return ErrInsufficientStake
+	}
+	if !validatorListed(vm.storage, addr) && vm.validatorCount() >= maxValidators {
+		return ErrValidatorSetFull
+	}
+	validator := readValidator(vm.storage, addr)
+	if producerID != (common.Hash{}) {
+		if staker, ok := vm.ProducerStaker(producerID); ok && staker != addr {
+			return ErrProducerBound
+		}
+		if validator != nil && validator.ProducerID != (common.Hash{}) && validator.ProducerID != producerID {
+			return ErrProducerBound
+		}
+	}
+	if validator == nil {
+		validator = &ValidatorInfo{
+			Address:     addr,
+			Type:        VoterTypeCommunity,
+			StakeAmount: new(big.Int),
+			JoinedAt:    vm.number,
+			Status:      ValidatorStatusActive,
+		}
+	}
+	if producerID != (common.Hash{}) {
+		validator.ProducerID = producerID
+	}
+	validator.StakeAmount.Add(validator.StakeAmount, amount)
+	validator.VotingPower = stakeVotingPower(validator.StakeAmount)
+	validator.LastActiveAt = vm.number
+	if validator.Status == ValidatorStatusInactive && validator.StakeAmount.Cmp(vm.config.MinStakeAmount) >= 0 {
+		validator.Status = ValidatorStatusActive
+	}
+	writeValidator(vm.storage, vm.number, validator)
+	return nil
+}
+
+// Unstake removes stake for a validator. The funds stay locked in the
+// unbonding queue and are paid out by FinalizeBlock after the unstake lock
+// period.
+func (vm *StateValidatorManager) Unstake(addr common.Address, amount *big.Int) error {
+	validator := readValidator(vm.storage, addr)
+	if validator == nil {
+		return ErrValidatorNotFound
+	}
+	if validator.StakeAmount.Cmp(amount) < 0 {
+		return ErrInsufficientBalance
+	}
+	if amount.Sign() > 0 && vm.unbondingCount() >= maxListEntries {
+		return ErrUnbondingQueueFull
+	}
+	validator.StakeAmount.Sub(validator.StakeAmount, amount)
+	validator.VotingPower = stakeVotingPower(validator.StakeAmount)
+
+	// If stake falls below minimum, mark as inactive
+	if validator.StakeAmount.Cmp(vm.config.MinStakeAmount) < 0 && validator.Status == ValidatorStatusActive {
+		validator.Status = ValidatorStatusInactive
+	}
+	writeValidator(vm.storage, vm.number, validator)
+	vm.unbond(addr, amount)
+	return nil
+}
+
+// ClaimRewards claims the staking rewards of a validator. Inactive, jailed
+// and exiting validators claim the rewards settled before they stopped
+// earning as well.
+func (vm *StateValidatorManager) ClaimRewards(addr common.Address) (*big.Int, error) {
+	validator := readValidator(vm.storage, addr)
+	if validator == nil {
+		return nil, ErrValidatorNotFound
+	}
+	settleRewards(vm.storage, addr, bondedStake(validator))
+	slot := offsetSlot(rewardSlot(addr), rewardFieldAmount)
+	rewards := vm.storage.getBig(slot)
+	vm.storage.setBig(slot, new(big.Int))
+	vm.transfer(addr, rewards)
+	return rewards, nil
+}
+
+// Slash slashes SlashingRate percent of the stake of a validator for
+// misbehavior, including the stake it is unbonding, since evidence is only
+// processed after the misbehavior. The slashed funds are moved from the
+// governance contract to the SlashRecipient, or burnt if there is none.
+func (vm *StateValidatorManager) Slash(addr common.Address, reason string) error {
+	validator := readValidator(vm.storage, addr)
+	if validator == nil {
+		return ErrValidatorNotFound
+	}
+	slashAmount := vm.slashAmount(validator.StakeAmount)
+	validator.StakeAmount.Sub(validator.StakeAmount, slashAmount)
+	slashAmount.Add(slashAmount, vm.slashUnbonding(addr))
+	validator.VotingPower = stakeVotingPower(validator.StakeAmount)
+
+	// If stake falls below minimum, jail the validator
+	if validator.StakeAmount.Cmp(vm.config.MinStakeAmount) < 0 {
+		validator.Status = ValidatorStatusJailed
+	}
+	writeValidator(vm.storage, vm.number, validator)
+
+	switch {
+	case slashAmount.Sign() == 0:
+	case vm.config.SlashRecipient != (common.Address{}):
+		vm.transfer(vm.config.SlashRecipient, slashAmount)
+	default:
+		vm.db.SubBalance(vm.contract, uint256.MustFromBig(slashAmount), tracing.BalanceChangeUnspecified)
+	}
+	return nil
+}
+
+// UpdateMREnclave updates the MRENCLAVE for a validator
+func (vm *StateValidatorManager) UpdateMREnclave(addr common.Address, newMREnclave [32]byte) error {
+	validator := readValidator(vm.storage, addr)
+	if validator == nil {
+		return ErrValidatorNotFound
+	}
+	validator.MRENCLAVE = newMREnclave
+	writeValidator(vm.storage, vm.number, validator)
+	return nil
+}
+
+// Delegate delegates the voting power of a community validator to another
+// community validator. Proposals created after the delegation count the
+// delegated power for the delegate.
+func (vm *StateValidatorManager) Delegate(delegator, delegatee common.Address) error {
+	validator := readValidator(vm.storage, delegator)
+	if validator == nil {
+		return ErrValidatorNotFound
+	}
+	if delegatee == delegator {
+		delegatee = common.Address{}
+	}
+	if delegatee != (common.Address{}) {
+		if err := checkDelegation(validator, readValidator(vm.storage, delegatee)); err != nil {
+			return err
+		}
+	}
+	validator.Delegate = delegatee
+	writeValidator(vm.storage, vm.number, validator)
+	return nil
+}
+
+// VotingPowerAt returns the voting power of a validator, including the power
+// delegated to it, at the end of block number.
+func (vm *StateValidatorManager) VotingPowerAt(addr common.Address, number uint64) uint64 {
+	return vm.storage.powerAt(addressKey(addr), number)
+}
+
+// AddValidator adds a new validator (internal use)
+func (vm *StateValidatorManager) AddValidator(validator *ValidatorInfo) error {
+	if validatorLive(validator) && !validatorListed(vm.storage, validator.Address) && vm.validatorCount() >= maxValidators {
+		return ErrValidatorSetFull
+	}
+	writeValidator(vm.storage, vm.number, validator)
+	return nil
+}
+
+// RemoveValidator removes a validator (internal use)
+func (vm *StateValidatorManager) RemoveValidator(addr common.Address) {
+	if validator := readValidator(vm.storage, addr); validator != nil {
+		validator.Status = ValidatorStatusExiting
+		writeValidator(vm.storage, vm.number, validator)
+	}
+}
+
+// ValidatorStorage returns the storage of a governance contract with the
+// given validators, for use in a genesis allocation. The stakes of the
+// validators must be matched by the balance of the contract, and there may be
+// at most maxValidators live ones.
+func ValidatorStorage(validators []*ValidatorInfo) GenesisStorage {
+	storage := make(GenesisStorage)
+	s := contractStorage{db: storage}
+	for _, v := range validators {
+		writeValidator(s, 0, v)
+	}
+	return storage
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// StateVotingManager implements VotingManager on the storage of the
+// governance contract. Voting power is read from the checkpoints kept by the
+// StateValidatorManager of the same contract.
+type StateVotingManager struct {
+	config     *WhitelistConfig
+	storage    contractStorage
+	domain     VoteDomain
+	number     uint64
+	validators ValidatorManager
+}
+
+// NewStateVotingManager creates a voting manager on the state of the
+// governance contract at the given block of the chain chainID.
+func NewStateVotingManager(db StorageDB, contract common.Address, chainID *big.Int, number uint64, config *WhitelistConfig, validators ValidatorManager) *StateVotingManager {
+	return &StateVotingManager{
+		config:     config,
+		storage:    contractStorage{db: db, addr: contract},
+		domain:     VoteDomain{ChainID: chainID, Governance: contract},
+		number:     number,
+		validators: validators,
+	}
+}
+
+// proposalSlot returns the first slot of the proposal record of id.
+func proposalSlot(id common.Hash) common.Hash {
+	return mappingSlot(id, slotHash(proposalsSlot))
+}
+
+// voteSlot returns the first slot of the vote of voter on proposal id.
+func voteSlot(id common.Hash, voter common.Address) common.Hash {
+	return mappingSlot(addressKey(voter), mappingSlot(id, slotHash(votesSlot)))
+}
+
+// readProposal reads the proposal record of id, nil if there is none.
+func (vm *StateVotingManager) readProposal(id common.Hash) *Proposal {
+	s, base := vm.storage, proposalSlot(id)
+	ptype := s.getUint(offsetSlot(base, proposalFieldType))
+	if ptype == 0 {
+		return nil
+	}
+	return &Proposal{
+		ID:                id,
+		Type:              ProposalType(ptype),
+		Proposer:          common.BytesToAddress(s.get(offsetSlot(base, proposalFieldProposer)).Bytes()),
+		Target:            s.getBytes(offsetSlot(base, proposalFieldTarget)),
+		Description:       string(s.getBytes(offsetSlot(base, proposalFieldDescription))),
+		CreatedAt:         s.getUint(offsetSlot(base, proposalFieldCreatedAt)),
+		VotingEndsAt:      s.getUint(offsetSlot(base, proposalFieldVotingEndsAt)),
+		ExecuteAfter:      s.getUint(offsetSlot(base, proposalFieldExecuteAfter)),
+		Status:            ProposalStatus(s.getUint(offsetSlot(base, proposalFieldStatus))),
+		CoreYesVotes:      s.getUint(offsetSlot(base, proposalFieldCoreYes)),
+		CoreNoVotes:       s.getUint(offsetSlot(base, proposalFieldCoreNo)),
+		CommunityYesVotes: s.getUint(offsetSlot(base, proposalFieldCommunityYes)),
+		CommunityNoVotes:  s.getUint(offsetSlot(base, proposalFieldCommunityNo)),
+	}
+}
+
+// setStatus updates the status of a proposal.
+func (vm *StateVotingManager) setStatus(id common.Hash, status ProposalStatus) {
+	vm.storage.setUint(offsetSlot(proposalSlot(id), proposalFieldStatus), uint64(status))
+}
+
+// CreateProposal creates a new proposal, opening its voting period at the
+// current block. Proposals are identified like in the in-memory manager.
+func (vm *StateVotingManager) CreateProposal(proposal *Proposal) (common.Hash, error) {
+	if proposal.Type == 0 || len(proposal.Target) > maxBytesLength || len(proposal.Description) > maxBytesLength {
+		return common.Hash{}, ErrInvalidProposal
+	}
+	proposal.CreatedAt = vm.number
+
+	idData := make([]byte, 1+20+len(proposal.Target)+8)
+	idData[0] = byte(proposal.Type)
+	copy(idData[1:21], proposal.Proposer[:])
+	copy(idData[21:21+len(proposal.Target)], proposal.Target)
+	binary.BigEndian.PutUint64(idData[21+len(proposal.Target):], proposal.CreatedAt)
+	proposal.ID = crypto.Keccak256Hash(idData)
+
+	if vm.readProposal(proposal.ID) != nil {
+		return common.Hash{}, ErrProposalExists
+	}
+	proposal.VotingEndsAt = proposal.CreatedAt + vm.config.VotingPeriod
+	proposal.ExecuteAfter = proposal.VotingEndsAt + vm.config.ExecutionDelay
+	proposal.Status = ProposalStatusPending
+	proposal.CoreYesVotes, proposal.CoreNoVotes = 0, 0
+	proposal.CommunityYesVotes, proposal.CommunityNoVotes = 0, 0
+
+	s, base := vm.storage, proposalSlot(proposal.ID)
+	s.appendList(slotHash(proposalListSlot), proposal.ID)
+	s.setUint(offsetSlot(base, proposalFieldType), uint64(proposal.Type))
+	s.set(offsetSlot(base, proposalFieldProposer), addressKey(proposal.Proposer))
+	s.setBytes(offsetSlot(base, proposalFieldTarget), proposal.Target)
+	s.setBytes(offsetSlot(base, proposalFieldDescription), []byte(proposal.Description))
+	s.setUint(offsetSlot(base, proposalFieldCreatedAt), proposal.CreatedAt)
+	s.setUint(offsetSlot(base, proposalFieldVotingEndsAt), proposal.VotingEndsAt)
+	s.setUint(offsetSlot(base, proposalFieldExecuteAfter), proposal.ExecuteAfter)
+	s.setUint(offsetSlot(base, proposalFieldStatus), uint64(proposal.Status))
+	return proposal.ID, nil
+}
+
+// Vote votes on a proposal. The vote must carry the voter's EIP-712
+// signature of its VoteMessage, which binds it to the chain, the governance
+// contract and the voting power of the voter.
+func (vm *StateVotingManager) Vote(proposalID common.Hash, voter common.Address, support bool, signature []byte) error {
+	proposal := vm.readProposal(proposalID)
+	if proposal == nil {
+		return ErrProposalNotFound
+	}
+	if proposal.Status != ProposalStatusPending {
+		return ErrProposalNotPending
+	}
+	if vm.number >= proposal.VotingEndsAt {
+		return ErrVotingPeriodEnded
+	}
+	s, vbase := vm.storage, voteSlot(proposalID, voter)
+	if s.getUint(offsetSlot(vbase, voteFieldSupport)) != 0 {
+		return ErrAlreadyVoted
+	}
+	// Voters are the validators with power at the snapshot, whatever their
+	// current status, matching the totals the proposal is tallied against
+	weight := s.powerAt(addressKey(voter), snapshotBlock(proposal.CreatedAt))
+	if weight == 0 {
+		return ErrNoVotingPower
+	}
+	message := &VoteMessage{Domain: vm.domain, ProposalID: proposalID, Support: support, Weight: weight}
+	if err := message.Verify(voter, signature); err != nil {
+		return err
+	}
+
+	// Record vote
+	choice := uint64(2)
+	if support {
+		choice = 1
+	}
+	s.appendList(mappingSlot(proposalID, slotHash(proposalVotersSlot)), addressKey(voter))
+	s.setUint(offsetSlot(vbase, voteFieldSupport), choice)
+	s.setUint(offsetSlot(vbase, voteFieldWeight), weight)
+	s.setUint(offsetSlot(vbase, voteFieldTimestamp), vm.number)
+	s.setBytes(offsetSlot(vbase, voteFieldSignature), signature)
+
+	// Update vote counts
+	field := uint64(proposalFieldCommunityNo)
+	switch {
+	case vm.validators.GetVoterType(voter) == VoterTypeCore && support:
+		field = proposalFieldCoreYes
+	case vm.validators.GetVoterType(voter) == VoterTypeCore:
+		field = proposalFieldCoreNo
+	case support:
+		field = proposalFieldCommunityYes
+	}
+	slot := offsetSlot(proposalSlot(proposalID), field)
+	s.setUint(slot, s.getUint(slot)+weight)
+	return nil
+}
+
+// CheckProposalStatus tallies a pending proposal once its voting period has
+// ended.
+func (vm *StateVotingManager) CheckProposalStatus(proposalID common.Hash, currentBlock uint64) error {
+	proposal := vm.readProposal(proposalID)
+	if proposal == nil {
+		return ErrProposalNotFound
+	}
+	if proposal.Status != ProposalStatusPending || currentBlock < proposal.VotingEndsAt {
+		return nil
+	}
+	if proposalPassed(proposal, vm.totalsAt(snapshotBlock(proposal.CreatedAt)), vm.config) {
+		vm.setStatus(proposalID, ProposalStatusPassed)
+	} else {
+		vm.setStatus(proposalID, ProposalStatusRejected)
+	}
+	return nil
+}
+
+// totalsAt returns the total voting power of core and community validators at
+// the end of block number.
+func (vm *StateVotingManager) totalsAt(number uint64) votingTotals {
+	return votingTotals{
+		core:      vm.storage.powerAt(totalPowerKey(VoterTypeCore), number),
+		community: vm.storage.powerAt(totalPowerKey(VoterTypeCommunity), number),
+	}
+}
+
+// GetVotingPower returns the voting power of a voter on a proposal, as
+// checkpointed at the block before the proposal was created.
+func (vm *StateVotingManager) GetVotingPower(proposalID common.Hash, voter common.Address) (uint64, error) {
+	proposal := vm.readProposal(proposalID)
+	if proposal == nil {
+		return 0, ErrProposalNotFound
+	}
+	return vm.storage.powerAt(addressKey(voter), snapshotBlock(proposal.CreatedAt)), nil
+}
+
+// ExecuteProposal marks a passed proposal as executed once its execution
+// delay has passed.
+func (vm *StateVotingManager) ExecuteProposal(proposalID common.Hash) error {
+	proposal := vm.readProposal(proposalID)
+	if proposal == nil {
+		return ErrProposalNotFound
+	}
+	if proposal.Status == ProposalStatusExecuted {
+		return ErrProposalAlreadyExecuted
+	}
+	if proposal.Status != ProposalStatusPassed {
+		return ErrProposalNotPassed
+	}
+	if vm.number < proposal.ExecuteAfter {
+		return ErrExecutionDelayNotMet
+	}
+	vm.setStatus(proposalID, ProposalStatusExecuted)
+	return nil
+}
+
+// GetProposal returns a proposal
+func (vm *StateVotingManager) GetProposal(proposalID common.Hash) (*Proposal, error) {
+	proposal := vm.readProposal(proposalID)
+	if proposal == nil {
+		return nil, ErrProposalNotFound
+	}
+	return proposal, nil
+}
+
+// GetProposalVotes returns all votes for a proposal, in the order they were
+// cast
+func (vm *StateVotingManager) GetProposalVotes(proposalID common.Hash) ([]*Vote, error) {
+	if vm.readProposal(proposalID) == nil {
+		return nil, ErrProposalNotFound
+	}
+	s := vm.storage
+	voters, err := s.list(mappingSlot(proposalID, slotHash(proposalVotersSlot)))
+	if err != nil {
+		return nil, err
+	}
+	votes := make([]*Vote, 0)
+	for _, key := range voters {
+		voter := common.BytesToAddress(key.Bytes())
+		base := voteSlot(proposalID, voter)
+		votes = append(votes, &Vote{
+			ProposalID: proposalID,
+			Voter:      voter,
+			Support:    s.getUint(offsetSlot(base, voteFieldSupport)) == 1,
+			Weight:     s.getUint(offsetSlot(base, voteFieldWeight)),
+			Timestamp:  s.getUint(offsetSlot(base, voteFieldTimestamp)),
+			Signature:  s.getBytes(offsetSlot(base, voteFieldSignature)),
+		})
+	}
+	return votes, nil
+}
+
+// GetActiveProposals returns the pending and passed proposals among the most
+// recent ones, in the order they were created
+func (vm *StateVotingManager) GetActiveProposals() []*Proposal {
+	active := make([]*Proposal, 0)
+	for _, id := range vm.storage.tail(slotHash(proposalListSlot)) {
+		proposal := vm.readProposal(id)
+		if proposal != nil && (proposal.Status == ProposalStatusPending || proposal.Status == ProposalStatusPassed) {
+			active = append(active, proposal)
+		}
+	}
+	return active
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The governance contract records the voting power of every validator, with
+// the power delegated to it, and the total voting power of core and community
+// validators as checkpoints. A checkpoint is a word holding the block number
+// in bytes 16 to 24 and the voting power from that block on in bytes 24 to
+// 32. The checkpoints of a key are an array in powerCheckpoints, ordered by
+// block number.
+
+// totalPowerKey returns the checkpoint key of the total voting power of the
+// validators of a type.
+func totalPowerKey(vtype VoterType) common.Hash {
+	return crypto.Keccak256Hash([]byte("totalVotingPower"), []byte{byte(vtype)})
+}
+
+// powerCheckpoints returns the slot of the checkpoint array of key.
+func powerCheckpoints(key common.Hash) common.Hash {
+	return mappingSlot(key, slotHash(checkpointsSlot))
+}
+
+// decodeCheckpoint splits a checkpoint word into block number and power.
+func decodeCheckpoint(word common.Hash) (number uint64, power uint64) {
+	return binary.BigEndian.Uint64(word[16:24]), binary.BigEndian.Uint64(word[24:])
+}
+
+// powerAt returns the voting power of key at the end of block number.
+func (s contractStorage) powerAt(key common.Hash, number uint64) uint64 {
+	slot := powerCheckpoints(key)
+
+	// Find the last checkpoint at or before number
+	lo, hi := uint64(0), s.getUint(slot)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if at, _ := decodeCheckpoint(s.get(listSlot(slot, mid))); at > number {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	if lo == 0 {
+		return 0
+	}
+	_, power := decodeCheckpoint(s.get(listSlot(slot, lo-1)))
+	return power
+}
+
+// movePower subtracts sub from and adds add to the voting power of key from
+// block number on.
+func (s contractStorage) movePower(key common.Hash, number uint64, sub, add uint64) {
+	if sub == add {
+		return
+	}
+	slot := powerCheckpoints(key)
+	length := s.getUint(slot)
+
+	var last common.Hash
+	if length > 0 {
+		last = s.get(listSlot(slot, length-1))
+	}
+	at, power := decodeCheckpoint(last)
+	power = power - min(power, sub) + add
+
+	var word common.Hash
+	binary.BigEndian.PutUint64(word[16:24], number)
+	binary.BigEndian.PutUint64(word[24:], power)
+	if length > 0 && at == number {
+		s.set(listSlot(slot, length-1), word)
+	} else {
+		s.appendList(slot, word)
+	}
+}
+
+// updatePower moves the voting power of a validator whose record changes
+// from old to new at block number. Old is nil for new validators.
+func updatePower(s contractStorage, number uint64, old, new *ValidatorInfo) {
+	if old != nil {
+		if power := ownVotingPower(old); power > 0 {
+			s.movePower(addressKey(delegateOf(old)), number, power, 0)
+			s.movePower(totalPowerKey(old.Type), number, power, 0)
+		}
+	}
+	if power := ownVotingPower(new); power > 0 {
+		s.movePower(addressKey(delegateOf(new)), number, 0, power)
+		s.movePower(totalPowerKey(new.Type), number, 0, power)
+	}
+}
+
+// snapshotBlock returns the block whose voting power is used for a proposal
+// created at the given block. It is the block before the proposal was
+// created: voting power in the creation block may still change after votes
+// have been cast in it.
+func snapshotBlock(createdAt uint64) uint64 {
+	if createdAt == 0 {
+		return 0
+	}
+	return createdAt - 1
+}
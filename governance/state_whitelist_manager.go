@@ -0,0 +1,211 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StateWhitelistManager implements WhitelistManager on the storage of the
+// security config contract. Allowed MRENCLAVEs are kept in the layout read by
+// the consensus engine, so whitelist changes take effect on all nodes.
+type StateWhitelistManager struct {
+	config  *WhitelistConfig
+	storage contractStorage
+	number  uint64
+	voting  VotingManager
+}
+
+// NewStateWhitelistManager creates a whitelist manager on the state of the
+// security config contract at the given block.
+func NewStateWhitelistManager(db StorageDB, contract common.Address, number uint64, config *WhitelistConfig, voting VotingManager) *StateWhitelistManager {
+	return &StateWhitelistManager{
+		config:  config,
+		storage: contractStorage{db: db, addr: contract},
+		number:  number,
+		voting:  voting,
+	}
+}
+
+// allowedSlot returns the slot of the allowed flag of mrenclave.
+func allowedSlot(mrenclave [32]byte) common.Hash {
+	return mappingSlot(mrenclave, slotHash(allowedMREnclavesSlot))
+}
+
+// entrySlot returns the first slot of the entry details of mrenclave.
+func entrySlot(mrenclave [32]byte) common.Hash {
+	return mappingSlot(mrenclave, slotHash(mrEnclaveEntriesSlot))
+}
+
+// readEntry reads the entry of mrenclave, nil if there is none. Entries
+// allowed in the genesis allocation have no details and read as active.
+func (wm *StateWhitelistManager) readEntry(mrenclave [32]byte) *MREnclaveEntry {
+	s, base := wm.storage, entrySlot(mrenclave)
+	allowed := s.get(allowedSlot(mrenclave)) != (common.Hash{})
+	if !allowed && s.getUint(offsetSlot(base, entryFieldListed)) == 0 {
+		return nil
+	}
+	entry := &MREnclaveEntry{
+		MRENCLAVE:       mrenclave,
+		Version:         string(s.getBytes(offsetSlot(base, entryFieldVersion))),
+		AddedAt:         s.getUint(offsetSlot(base, entryFieldAddedAt)),
+		AddBy:           common.BytesToAddress(s.get(offsetSlot(base, entryFieldAddBy)).Bytes()),
+		PermissionLevel: PermissionLevel(s.getUint(offsetSlot(base, entryFieldPermissionLevel))),
+		Status:          EntryStatus(s.getUint(offsetSlot(base, entryFieldStatus))),
+	}
+	if s.getUint(offsetSlot(base, entryFieldListed)) == 0 {
+		entry.Status = StatusActive
+	}
+	if entry.PermissionLevel == 0 {
+		entry.PermissionLevel = PermissionBasic
+	}
+	return entry
+}
+
+// IsAllowed checks if an MRENCLAVE is allowed
+func (wm *StateWhitelistManager) IsAllowed(mrenclave [32]byte) bool {
+	return wm.storage.get(allowedSlot(mrenclave)) != (common.Hash{})
+}
+
+// GetPermissionLevel returns the permission level of an MRENCLAVE
+func (wm *StateWhitelistManager) GetPermissionLevel(mrenclave [32]byte) PermissionLevel {
+	entry := wm.readEntry(mrenclave)
+	if entry == nil {
+		return PermissionBasic
+	}
+	return entry.PermissionLevel
+}
+
+// GetEntry returns the entry for an MRENCLAVE
+func (wm *StateWhitelistManager) GetEntry(mrenclave [32]byte) (*MREnclaveEntry, error) {
+	entry := wm.readEntry(mrenclave)
+	if entry == nil {
+		return nil, ErrMREnclaveNotFound
+	}
+	return entry, nil
+}
+
+// GetAllEntries returns all entries, in the order they were added. A corrupt
+// list longer than maxListEntries yields no entries.
+func (wm *StateWhitelistManager) GetAllEntries() []*MREnclaveEntry {
+	entries, _ := wm.Entries()
+	return entries
+}
+
+// Entries returns all entries, in the order they were added, failing with
+// ErrListTooLong for a corrupt list.
+func (wm *StateWhitelistManager) Entries() ([]*MREnclaveEntry, error) {
+	list, err := wm.storage.list(slotHash(mrEnclaveListSlot))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		entries []*MREnclaveEntry
+		seen    = make(map[common.Hash]bool)
+	)
+	for _, mrenclave := range list {
+		if seen[mrenclave] {
+			continue
+		}
+		seen[mrenclave] = true
+		if entry := wm.readEntry(mrenclave); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// ProposeAdd proposes adding a new MRENCLAVE
+func (wm *StateWhitelistManager) ProposeAdd(proposer common.Address, mrenclave [32]byte, version string) (common.Hash, error) {
+	if wm.IsAllowed(mrenclave) {
+		return common.Hash{}, ErrMREnclaveExists
+	}
+	return wm.voting.CreateProposal(&Proposal{
+		Type:        ProposalAddMREnclave,
+		Proposer:    proposer,
+		Target:      (&AddMREnclavePayload{MRENCLAVE: mrenclave, PermissionLevel: PermissionBasic, Version: version}).Encode(),
+		Description: "Add MRENCLAVE version " + version,
+	})
+}
+
+// ProposeRemove proposes removing an MRENCLAVE
+func (wm *StateWhitelistManager) ProposeRemove(proposer common.Address, mrenclave [32]byte, reason string) (common.Hash, error) {
+	if !wm.IsAllowed(mrenclave) {
+		return common.Hash{}, ErrMREnclaveNotFound
+	}
+	return wm.voting.CreateProposal(&Proposal{
+		Type:        ProposalRemoveMREnclave,
+		Proposer:    proposer,
+		Target:      (&RemoveMREnclavePayload{MRENCLAVE: mrenclave}).Encode(),
+		Description: "Remove MRENCLAVE: " + reason,
+	})
+}
+
+// ProposeUpgrade proposes upgrading the permission level of an MRENCLAVE
+func (wm *StateWhitelistManager) ProposeUpgrade(proposer common.Address, mrenclave [32]byte, newLevel PermissionLevel) (common.Hash, error) {
+	entry := wm.readEntry(mrenclave)
+	if entry == nil {
+		return common.Hash{}, ErrMREnclaveNotFound
+	}
+	if newLevel > PermissionFull || entry.PermissionLevel >= newLevel {
+		return common.Hash{}, ErrInvalidPermissionLevel
+	}
+	return wm.voting.CreateProposal(&Proposal{
+		Type:        ProposalUpgradePermission,
+		Proposer:    proposer,
+		Target:      (&UpgradePermissionPayload{MRENCLAVE: mrenclave, PermissionLevel: newLevel}).Encode(),
+		Description: "Upgrade permission level",
+	})
+}
+
+// writeEntry stores the details of an entry, listing new MRENCLAVEs.
+func (wm *StateWhitelistManager) writeEntry(entry *MREnclaveEntry) {
+	s, base := wm.storage, entrySlot(entry.MRENCLAVE)
+	if s.getUint(offsetSlot(base, entryFieldListed)) == 0 {
+		if s.get(allowedSlot(entry.MRENCLAVE)) == (common.Hash{}) {
+			s.appendList(slotHash(mrEnclaveListSlot), entry.MRENCLAVE)
+		}
+		s.setUint(offsetSlot(base, entryFieldListed), 1)
+	}
+	s.setBytes(offsetSlot(base, entryFieldVersion), []byte(entry.Version))
+	s.setUint(offsetSlot(base, entryFieldAddedAt), entry.AddedAt)
+	s.set(offsetSlot(base, entryFieldAddBy), addressKey(entry.AddBy))
+	s.setUint(offsetSlot(base, entryFieldPermissionLevel), uint64(entry.PermissionLevel))
+	s.setUint(offsetSlot(base, entryFieldStatus), uint64(entry.Status))
+}
+
+// AddEntry adds a new entry to the whitelist (internal use only). Active and
+// approved entries are allowed.
+func (wm *StateWhitelistManager) AddEntry(entry *MREnclaveEntry) {
+	wm.writeEntry(entry)
+	if entry.Status == StatusActive || entry.Status == StatusApproved {
+		wm.storage.set(allowedSlot(entry.MRENCLAVE), common.BigToHash(common.Big1))
+	} else {
+		wm.storage.set(allowedSlot(entry.MRENCLAVE), common.Hash{})
+	}
+}
+
+// RemoveEntry removes an entry from the whitelist (internal use only)
+func (wm *StateWhitelistManager) RemoveEntry(mrenclave [32]byte) {
+	entry := wm.readEntry(mrenclave)
+	if entry == nil {
+		return
+	}
+	entry.Status = StatusDeprecated
+	wm.writeEntry(entry)
+	wm.storage.set(allowedSlot(mrenclave), common.Hash{})
+}
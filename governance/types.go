@@ -140,8 +140,10 @@ type ValidatorInfo struct {
 	StakeAmount  *big.Int        // 质押金额 (StakedAmount in architecture doc)
 	JoinedAt     uint64          // 加入区块 (block number, not time.Time for consistency)
 	LastActiveAt uint64          // 最后活跃区块
-	VotingPower  uint64          // 投票权重
+	VotingPower  uint64          // 投票权重（质押验证者按质押计算）
 	Status       ValidatorStatus // 状态
+	Delegate     common.Address  // 投票权委托对象（零地址表示未委托）
+	ProducerID   common.Hash     // 质押时绑定的 SGX 生产者 ID（零表示未绑定），双签证据据此罚没质押
 	
 	// Optional fields for architecture document compatibility
 	// These are derived/computed fields and not stored directly
@@ -225,19 +227,22 @@ func DefaultCommunityValidatorConfig() *CommunityValidatorConfig {
 
 // StakingConfig holds the configuration for validator staking
 type StakingConfig struct {
-	MinStakeAmount    *big.Int // 最小质押金额
-	UnstakeLockPeriod uint64   // 解除质押锁定期（区块数）
-	AnnualRewardRate  uint64   // 质押奖励率（年化百分比）
-	SlashingRate      uint64   // 惩罚率（百分比）
+	MinStakeAmount    *big.Int       // 最小质押金额
+	UnstakeLockPeriod uint64         // 解除质押锁定期（区块数）
+	AnnualRewardRate  uint64         // 质押奖励率（年化百分比）
+	SlashingRate      uint64         // 惩罚率（百分比）
+	BlocksPerYear     uint64         // 每年区块数（按区块累计奖励）
+	SlashRecipient    common.Address // 罚没资金接收地址（零地址表示销毁）
 }
 
 // DefaultStakingConfig returns the default staking configuration
 func DefaultStakingConfig() *StakingConfig {
 	return &StakingConfig{
 		MinStakeAmount:    new(big.Int).Mul(big.NewInt(10000), big.NewInt(1e18)), // 10000 X
-		UnstakeLockPeriod: 172800, // 约 30 天（15s/块）
-		AnnualRewardRate:  5,      // 5%
-		SlashingRate:      10,     // 10%
+		UnstakeLockPeriod: 172800,  // 约 30 天（15s/块）
+		AnnualRewardRate:  5,       // 5%
+		SlashingRate:      10,      // 10%
+		BlocksPerYear:     2102400, // 约 1 年（15s/块）
 	}
 }
 
@@ -145,7 +145,6 @@ func (vm *InMemoryValidatorManager) Stake(addr common.Address, amount *big.Int)
 			Address:      addr,
 			Type:         VoterTypeCommunity,
 			StakeAmount:  new(big.Int),
-			VotingPower:  1,
 			Status:       ValidatorStatusActive,
 		}
 		vm.validators[addr] = validator
@@ -153,6 +152,7 @@ func (vm *InMemoryValidatorManager) Stake(addr common.Address, amount *big.Int)
 
 	// Add stake
 	validator.StakeAmount = new(big.Int).Add(validator.StakeAmount, amount)
+	validator.VotingPower = stakeVotingPower(validator.StakeAmount)
 
 	return nil
 }
@@ -174,6 +174,7 @@ func (vm *InMemoryValidatorManager) Unstake(addr common.Address, amount *big.Int
 
 	// Remove stake
 	validator.StakeAmount = new(big.Int).Sub(validator.StakeAmount, amount)
+	validator.VotingPower = stakeVotingPower(validator.StakeAmount)
 
 	// If stake falls below minimum, mark as inactive
 	if validator.StakeAmount.Cmp(vm.config.MinStakeAmount) < 0 {
@@ -220,6 +221,7 @@ func (vm *InMemoryValidatorManager) Slash(addr common.Address, reason string) er
 
 	// Apply slashing
 	validator.StakeAmount = new(big.Int).Sub(validator.StakeAmount, slashAmount)
+	validator.VotingPower = stakeVotingPower(validator.StakeAmount)
 
 	// If stake falls below minimum, jail the validator
 	if validator.StakeAmount.Cmp(vm.config.MinStakeAmount) < 0 {
@@ -244,14 +246,39 @@ func (vm *InMemoryValidatorManager) UpdateMREnclave(addr common.Address, newMREn
 	return nil
 }
 
+// Delegate delegates the voting power of a community validator to another
+// community validator
+func (vm *InMemoryValidatorManager) Delegate(delegator, delegatee common.Address) error {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	validator, exists := vm.validators[delegator]
+	if !exists {
+		return ErrValidatorNotFound
+	}
+
+	// Delegating to oneself removes the delegation
+	if delegatee == delegator || delegatee == (common.Address{}) {
+		validator.Delegate = common.Address{}
+		return nil
+	}
+	if err := checkDelegation(validator, vm.validators[delegatee]); err != nil {
+		return err
+	}
+	validator.Delegate = delegatee
+
+	return nil
+}
+
 // AddValidator adds a new validator (internal use)
-func (vm *InMemoryValidatorManager) AddValidator(validator *ValidatorInfo) {
+func (vm *InMemoryValidatorManager) AddValidator(validator *ValidatorInfo) error {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
 
 	validatorCopy := *validator
 	validatorCopy.StakeAmount = new(big.Int).Set(validator.StakeAmount)
 	vm.validators[validator.Address] = &validatorCopy
+	return nil
 }
 
 // RemoveValidator removes a validator (internal use)
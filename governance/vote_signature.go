@@ -0,0 +1,202 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// EIP-712 domain and type of governance votes.
+const (
+	VoteDomainName    = "SGX Governance"
+	VoteDomainVersion = "1"
+	VotePrimaryType   = "GovernanceVote"
+)
+
+// VoteDomain is the EIP-712 domain of governance votes. It binds a vote to
+// one chain and one governance contract, so that it cannot be replayed on
+// another network or deployment.
+type VoteDomain struct {
+	ChainID    *big.Int
+	Governance common.Address
+}
+
+// VoteMessage is the EIP-712 message signed by a validator to vote on a
+// proposal. Weight is the voting power of the validator when voting; a vote
+// signed for a different weight is rejected.
+type VoteMessage struct {
+	Domain     VoteDomain
+	ProposalID common.Hash
+	Support    bool
+	Weight     uint64
+}
+
+// voteTypes returns the EIP-712 types of a vote.
+func voteTypes() apitypes.Types {
+	return apitypes.Types{
+		"EIP712Domain": {
+			{Name: "name", Type: "string"},
+			{Name: "version", Type: "string"},
+			{Name: "chainId", Type: "uint256"},
+			{Name: "verifyingContract", Type: "address"},
+		},
+		VotePrimaryType: {
+			{Name: "proposalId", Type: "bytes32"},
+			{Name: "support", Type: "bool"},
+			{Name: "weight", Type: "uint64"},
+		},
+	}
+}
+
+// TypedData returns the vote as EIP-712 typed data, as signed by clef's
+// account_signTypedData.
+func (m *VoteMessage) TypedData() apitypes.TypedData {
+	return apitypes.TypedData{
+		Types:       voteTypes(),
+		PrimaryType: VotePrimaryType,
+		Domain: apitypes.TypedDataDomain{
+			Name:              VoteDomainName,
+			Version:           VoteDomainVersion,
+			ChainId:           (*math.HexOrDecimal256)(m.Domain.ChainID),
+			VerifyingContract: m.Domain.Governance.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"proposalId": m.ProposalID.Hex(),
+			"support":    m.Support,
+			"weight":     strconv.FormatUint(m.Weight, 10),
+		},
+	}
+}
+
+// Hash returns the EIP-712 signing hash of the vote.
+func (m *VoteMessage) Hash() (common.Hash, error) {
+	if m.Domain.ChainID == nil {
+		return common.Hash{}, errors.New("vote domain without chain ID")
+	}
+	hash, _, err := apitypes.TypedDataAndHash(m.TypedData())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(hash), nil
+}
+
+// Sign signs the vote with key. The signature is in the [R || S || V]
+// format with V being 27 or 28, like the signatures made by clef.
+func (m *VoteMessage) Sign(key *ecdsa.PrivateKey) ([]byte, error) {
+	hash, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+// Verify checks that signature is a signature of the vote made by voter.
+// Both 0/1 and 27/28 recovery IDs are accepted.
+func (m *VoteMessage) Verify(voter common.Address, signature []byte) error {
+	if len(signature) == 0 {
+		return ErrMissingSignature
+	}
+	if len(signature) != crypto.SignatureLength {
+		return ErrInvalidSignature
+	}
+	hash, err := m.Hash()
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sig := common.CopyBytes(signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pubkey, err := crypto.SigToPub(hash[:], sig)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != voter {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParseVoteTypedData decodes EIP-712 typed data that is exactly a governance
+// vote, as returned by VoteMessage.TypedData.
+func ParseVoteTypedData(typedData apitypes.TypedData) (*VoteMessage, error) {
+	domain := typedData.Domain
+	if typedData.PrimaryType != VotePrimaryType || domain.Name != VoteDomainName || domain.Version != VoteDomainVersion {
+		return nil, errors.New("not a governance vote")
+	}
+	if domain.ChainId == nil || !common.IsHexAddress(domain.VerifyingContract) {
+		return nil, errors.New("governance vote without chain ID or governance contract")
+	}
+	m := &VoteMessage{
+		Domain: VoteDomain{
+			ChainID:    (*big.Int)(domain.ChainId),
+			Governance: common.HexToAddress(domain.VerifyingContract),
+		},
+	}
+	id, ok := typedData.Message["proposalId"].(string)
+	if !ok {
+		return nil, errors.New("governance vote without proposal ID")
+	}
+	idBytes, err := hexutil.Decode(id)
+	if err != nil || len(idBytes) != common.HashLength {
+		return nil, fmt.Errorf("invalid proposal ID %q", id)
+	}
+	m.ProposalID = common.BytesToHash(idBytes)
+	if m.Support, ok = typedData.Message["support"].(bool); !ok {
+		return nil, errors.New("governance vote without support")
+	}
+	// JSON numbers are decoded as float64, other integers as strings.
+	switch weight := typedData.Message["weight"].(type) {
+	case string:
+		if m.Weight, ok = math.ParseUint64(weight); !ok {
+			return nil, fmt.Errorf("invalid vote weight %q", weight)
+		}
+	case float64:
+		if weight < 0 || weight > 1<<53 || weight != float64(uint64(weight)) {
+			return nil, fmt.Errorf("invalid vote weight %v", weight)
+		}
+		m.Weight = uint64(weight)
+	default:
+		return nil, errors.New("governance vote without weight")
+	}
+
+	// Reject extra types or fields which would be signed but not shown.
+	have, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, err
+	}
+	want, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if common.BytesToHash(have) != want || len(typedData.Types) != len(voteTypes()) || len(typedData.Message) != 3 {
+		return nil, errors.New("governance vote with unexpected fields")
+	}
+	return m, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+func TestVoteTypedData(t *testing.T) {
+	voter := testAccount(1)
+	message := &VoteMessage{Domain: testDomain, ProposalID: common.HexToHash("0xabcd"), Support: true, Weight: 3}
+	sig, err := message.Sign(testKeys[voter])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The typed data survives the JSON round trip to clef.
+	blob, err := json.Marshal(message.TypedData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var typedData apitypes.TypedData
+	if err := json.Unmarshal(blob, &typedData); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseVoteTypedData(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Domain.ChainID.Cmp(testDomain.ChainID) != 0 || parsed.Domain.Governance != testDomain.Governance ||
+		parsed.ProposalID != message.ProposalID || !parsed.Support || parsed.Weight != 3 {
+		t.Fatalf("unexpected vote %+v", parsed)
+	}
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := message.Hash(); common.BytesToHash(hash) != want {
+		t.Fatalf("typed data hash %x, want %x", hash, want)
+	}
+	if err := parsed.Verify(voter, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	// Numeric weights, as sent by most clients, are accepted.
+	typedData.Message["weight"] = float64(3)
+	if _, err := ParseVoteTypedData(typedData); err != nil {
+		t.Fatalf("numeric weight: %v", err)
+	}
+
+	// Data signed along with the vote must be part of the vote.
+	typedData.Message["note"] = "hidden"
+	if _, err := ParseVoteTypedData(typedData); err == nil {
+		t.Fatal("accepted vote with extra message field")
+	}
+	delete(typedData.Message, "note")
+	typedData.Types[VotePrimaryType] = append(typedData.Types[VotePrimaryType], apitypes.Type{Name: "extra", Type: "uint256"})
+	typedData.Message["extra"] = "1"
+	if _, err := ParseVoteTypedData(typedData); err == nil {
+		t.Fatal("accepted vote with extra type field")
+	}
+	typedData = message.TypedData()
+	typedData.Domain.ChainId = nil
+	if _, err := ParseVoteTypedData(typedData); err == nil {
+		t.Fatal("accepted vote without chain ID")
+	}
+}
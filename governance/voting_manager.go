@@ -30,15 +30,20 @@ type InMemoryVotingManager struct {
 	mu         sync.RWMutex
 	proposals  map[common.Hash]*Proposal
 	votes      map[common.Hash][]*Vote
+	snapshots  map[common.Hash]*powerSnapshot
+	domain     VoteDomain
 	validators ValidatorManager
 }
 
-// NewInMemoryVotingManager creates a new in-memory voting manager
-func NewInMemoryVotingManager(config *WhitelistConfig, validators ValidatorManager) *InMemoryVotingManager {
+// NewInMemoryVotingManager creates a new in-memory voting manager whose votes
+// are signed for the given EIP-712 domain
+func NewInMemoryVotingManager(config *WhitelistConfig, domain VoteDomain, validators ValidatorManager) *InMemoryVotingManager {
 	return &InMemoryVotingManager{
 		config:     config,
+		domain:     domain,
 		proposals:  make(map[common.Hash]*Proposal),
 		votes:      make(map[common.Hash][]*Vote),
+		snapshots:  make(map[common.Hash]*powerSnapshot),
 		validators: validators,
 	}
 }
@@ -67,10 +72,15 @@ func (vm *InMemoryVotingManager) CreateProposal(proposal *Proposal) (common.Hash
 	vm.proposals[proposal.ID] = &proposalCopy
 	vm.votes[proposal.ID] = make([]*Vote, 0)
 
+	// Snapshot voting power, so that stake moved during the vote is not
+	// counted twice
+	vm.snapshots[proposal.ID] = newPowerSnapshot(vm.validators.GetAllValidators())
+
 	return proposal.ID, nil
 }
 
-// Vote votes on a proposal
+// Vote votes on a proposal. The vote must carry the voter's EIP-712
+// signature of its VoteMessage.
 func (vm *InMemoryVotingManager) Vote(proposalID common.Hash, voter common.Address, support bool, signature []byte) error {
 	vm.mu.Lock()
 	defer vm.mu.Unlock()
@@ -86,11 +96,6 @@ func (vm *InMemoryVotingManager) Vote(proposalID common.Hash, voter common.Addre
 		return ErrProposalNotPending
 	}
 
-	// Check if voter is a validator
-	if !vm.validators.IsValidator(voter) {
-		return ErrInvalidVoter
-	}
-
 	// Check if voter has already voted
 	existingVotes := vm.votes[proposalID]
 	for _, v := range existingVotes {
@@ -99,24 +104,18 @@ func (vm *InMemoryVotingManager) Vote(proposalID common.Hash, voter common.Addre
 		}
 	}
 
-	// Verify signature
-	if len(signature) > 0 {
-		voteData := boolToBytes(support)
-		voteData = append(proposalID[:], voteData...)
-		hash := crypto.Keccak256Hash(voteData)
-		
-		pubkey, err := crypto.SigToPub(hash.Bytes(), signature)
-		if err != nil || crypto.PubkeyToAddress(*pubkey) != voter {
-			return ErrInvalidSignature
-		}
+	// Get voter type and snapshotted weight, only validators with power at
+	// the snapshot vote
+	voterType := vm.validators.GetVoterType(voter)
+	weight := vm.snapshots[proposalID].weights[voter]
+	if weight == 0 {
+		return ErrNoVotingPower
 	}
 
-	// Get voter type and weight
-	voterType := vm.validators.GetVoterType(voter)
-	validatorInfo, _ := vm.validators.GetValidator(voter)
-	weight := uint64(1)
-	if validatorInfo != nil {
-		weight = validatorInfo.VotingPower
+	// Verify the EIP-712 signature over the vote and its weight
+	message := &VoteMessage{Domain: vm.domain, ProposalID: proposalID, Support: support, Weight: weight}
+	if err := message.Verify(voter, signature); err != nil {
+		return err
 	}
 
 	// Record vote
@@ -168,52 +167,7 @@ func (vm *InMemoryVotingManager) CheckProposalStatus(proposalID common.Hash, cur
 		return nil // Still voting
 	}
 
-	// Count validators
-	coreValidators := vm.validators.GetCoreValidators()
-	communityValidators := vm.validators.GetCommunityValidators()
-
-	var totalCoreVotingPower, totalCommunityVotingPower uint64
-	for _, v := range coreValidators {
-		totalCoreVotingPower += v.VotingPower
-	}
-	for _, v := range communityValidators {
-		totalCommunityVotingPower += v.VotingPower
-	}
-
-	// Check if proposal passed
-	passed := false
-
-	// Emergency upgrade requires 100% core validator approval
-	if proposal.Type == ProposalEmergencyUpgrade {
-		// Must have 100% of core validators vote yes
-		if totalCoreVotingPower > 0 && proposal.CoreYesVotes == totalCoreVotingPower {
-			passed = true
-		}
-
-		// Community veto threshold is 1/2 for emergency upgrades (stricter)
-		if passed && totalCommunityVotingPower > 0 {
-			communityRejectionRate := (proposal.CommunityNoVotes * 100) / totalCommunityVotingPower
-			if communityRejectionRate >= 50 { // 1/2 veto threshold
-				passed = false
-			}
-		}
-	} else {
-		// Normal upgrade: Core validator threshold check (2/3 majority)
-		if totalCoreVotingPower > 0 {
-			coreApprovalRate := (proposal.CoreYesVotes * 100) / totalCoreVotingPower
-			if coreApprovalRate >= vm.config.CoreValidatorThreshold {
-				passed = true
-			}
-		}
-
-		// Community validator veto check (1/3 can veto for normal upgrades)
-		if passed && totalCommunityVotingPower > 0 {
-			communityRejectionRate := (proposal.CommunityNoVotes * 100) / totalCommunityVotingPower
-			if communityRejectionRate >= vm.config.CommunityVetoThreshold {
-				passed = false
-			}
-		}
-	}
+	passed := proposalPassed(proposal, vm.snapshots[proposalID].totals, vm.config)
 
 	// Update status
 	if passed {
@@ -284,6 +238,19 @@ func (vm *InMemoryVotingManager) GetProposalVotes(proposalID common.Hash) ([]*Vo
 	return votesCopy, nil
 }
 
+// GetVotingPower returns the voting power of a voter on a proposal, as
+// snapshotted when the proposal was created.
+func (vm *InMemoryVotingManager) GetVotingPower(proposalID common.Hash, voter common.Address) (uint64, error) {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+
+	snapshot, exists := vm.snapshots[proposalID]
+	if !exists {
+		return 0, ErrProposalNotFound
+	}
+	return snapshot.weights[voter], nil
+}
+
 // GetActiveProposals returns all active proposals
 func (vm *InMemoryVotingManager) GetActiveProposals() []*Proposal {
 	vm.mu.RLock()
@@ -300,6 +267,52 @@ func (vm *InMemoryVotingManager) GetActiveProposals() []*Proposal {
 	return active
 }
 
+// proposalPassed tallies the votes of a proposal whose voting period ended
+// against the voting power snapshotted when it was created.
+func proposalPassed(proposal *Proposal, totals votingTotals, config *WhitelistConfig) bool {
+	return quorumReached(proposal, totals, config) && coreApproved(proposal, totals, config) && !communityVetoed(proposal, totals, config)
+}
+
+// quorumReached reports whether enough of the total voting power voted on a
+// proposal.
+func quorumReached(proposal *Proposal, totals votingTotals, config *WhitelistConfig) bool {
+	total := totals.core + totals.community
+	if total == 0 {
+		return false
+	}
+	cast := proposal.CoreYesVotes + proposal.CoreNoVotes + proposal.CommunityYesVotes + proposal.CommunityNoVotes
+	return cast*100/total >= config.MinParticipation
+}
+
+// coreApproved reports whether the core validators approved a proposal.
+func coreApproved(proposal *Proposal, totals votingTotals, config *WhitelistConfig) bool {
+	if totals.core == 0 {
+		return false
+	}
+	// Emergency upgrade requires 100% core validator approval
+	if proposal.Type == ProposalEmergencyUpgrade {
+		return proposal.CoreYesVotes == totals.core
+	}
+	// Core validator threshold check (2/3 majority)
+	coreApprovalRate := (proposal.CoreYesVotes * 100) / totals.core
+	return coreApprovalRate >= config.CoreValidatorThreshold
+}
+
+// communityVetoed reports whether the community validators vetoed a proposal.
+func communityVetoed(proposal *Proposal, totals votingTotals, config *WhitelistConfig) bool {
+	if totals.community == 0 {
+		return false
+	}
+	// Community veto threshold is 1/2 for emergency upgrades (stricter),
+	// 1/3 for all other proposals
+	threshold := config.CommunityVetoThreshold
+	if proposal.Type == ProposalEmergencyUpgrade {
+		threshold = 50
+	}
+	communityRejectionRate := (proposal.CommunityNoVotes * 100) / totals.community
+	return communityRejectionRate >= threshold
+}
+
 // boolToBytes converts a boolean to a byte slice
 func boolToBytes(b bool) []byte {
 	if b {
@@ -17,6 +17,8 @@
 package governance
 
 import (
+	"crypto/ecdsa"
+	"errors"
 	"math/big"
 	"testing"
 
@@ -114,12 +116,47 @@ func (m *MockValidatorManager) UpdateMREnclave(addr common.Address, newMREnclave
 	return nil
 }
 
+func (m *MockValidatorManager) Delegate(delegator, delegatee common.Address) error {
+	v, exists := m.validators[delegator]
+	if !exists {
+		return ErrValidatorNotFound
+	}
+	v.Delegate = delegatee
+	return nil
+}
+
+// testDomain is the EIP-712 domain of the votes in the tests.
+var testDomain = VoteDomain{ChainID: big.NewInt(1337), Governance: testGovernance}
+
+// testKeys holds the keys of the accounts created by testAccount.
+var testKeys = make(map[common.Address]*ecdsa.PrivateKey)
+
+// testAccount returns the address of the test account with private key n.
+func testAccount(n uint64) common.Address {
+	key, _ := crypto.ToECDSA(common.BigToHash(new(big.Int).SetUint64(n)).Bytes())
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	testKeys[addr] = key
+	return addr
+}
+
+// signTestVote signs the vote of a test account with its voting power on the
+// proposal in domain.
+func signTestVote(domain VoteDomain, voting VotingManager, proposalID common.Hash, voter common.Address, support bool) []byte {
+	weight, _ := voting.GetVotingPower(proposalID, voter)
+	key, ok := testKeys[voter]
+	if !ok {
+		return nil
+	}
+	sig, _ := (&VoteMessage{Domain: domain, ProposalID: proposalID, Support: support, Weight: weight}).Sign(key)
+	return sig
+}
+
 func TestVotingManager_CreateProposal(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
-	proposer := common.HexToAddress("0x1")
+	proposer := testAccount(0x1)
 	proposal := &Proposal{
 		Type:        ProposalAddMREnclave,
 		Proposer:    proposer,
@@ -155,11 +192,11 @@ func TestVotingManager_CreateProposal(t *testing.T) {
 func TestVotingManager_Vote(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add core validators
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 
@@ -173,7 +210,7 @@ func TestVotingManager_Vote(t *testing.T) {
 	proposalID, _ := vm.CreateProposal(proposal)
 
 	// Vote
-	err := vm.Vote(proposalID, core1, true, nil)
+	err := vm.Vote(proposalID, core1, true, signTestVote(testDomain, vm, proposalID, core1, true))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -185,23 +222,23 @@ func TestVotingManager_Vote(t *testing.T) {
 	}
 
 	// Try to vote again (should fail)
-	err = vm.Vote(proposalID, core1, false, nil)
+	err = vm.Vote(proposalID, core1, false, signTestVote(testDomain, vm, proposalID, core1, false))
 	if err != ErrAlreadyVoted {
 		t.Errorf("expected error %v, got %v", ErrAlreadyVoted, err)
 	}
 
 	// Vote from non-validator (should fail)
-	nonValidator := common.HexToAddress("0x999")
-	err = vm.Vote(proposalID, nonValidator, true, nil)
-	if err != ErrInvalidVoter {
-		t.Errorf("expected error %v, got %v", ErrInvalidVoter, err)
+	nonValidator := testAccount(0x999)
+	err = vm.Vote(proposalID, nonValidator, true, signTestVote(testDomain, vm, proposalID, nonValidator, true))
+	if err != ErrNoVotingPower {
+		t.Errorf("expected error %v, got %v", ErrNoVotingPower, err)
 	}
 }
 
 func TestVotingManager_VoteWithSignature(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Generate key for validator
 	key, _ := crypto.GenerateKey()
@@ -217,14 +254,30 @@ func TestVotingManager_VoteWithSignature(t *testing.T) {
 	}
 	proposalID, _ := vm.CreateProposal(proposal)
 
-	// Create signature
 	support := true
-	voteData := boolToBytes(support)
-	voteData = append(proposalID[:], voteData...)
-	hash := crypto.Keccak256Hash(voteData)
-	signature, _ := crypto.Sign(hash.Bytes(), key)
+	message := &VoteMessage{Domain: testDomain, ProposalID: proposalID, Support: support, Weight: 1}
+
+	// Unsigned votes and votes signed for another chain, another governance
+	// contract or another weight are rejected
+	otherChain := VoteDomain{ChainID: big.NewInt(1), Governance: testDomain.Governance}
+	otherContract := VoteDomain{ChainID: testDomain.ChainID, Governance: common.HexToAddress("0x1234")}
+	for _, m := range []*VoteMessage{
+		{Domain: otherChain, ProposalID: proposalID, Support: support, Weight: 1},
+		{Domain: otherContract, ProposalID: proposalID, Support: support, Weight: 1},
+		{Domain: testDomain, ProposalID: proposalID, Support: support, Weight: 2},
+		{Domain: testDomain, ProposalID: proposalID, Support: !support, Weight: 1},
+	} {
+		sig, _ := m.Sign(key)
+		if err := vm.Vote(proposalID, addr, support, sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("vote signed for %+v: expected error %v, got %v", m, ErrInvalidSignature, err)
+		}
+	}
+	if err := vm.Vote(proposalID, addr, support, nil); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("unsigned vote: expected error %v, got %v", ErrMissingSignature, err)
+	}
 
 	// Vote with signature
+	signature, _ := message.Sign(key)
 	err := vm.Vote(proposalID, addr, support, signature)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -243,15 +296,15 @@ func TestVotingManager_VoteWithSignature(t *testing.T) {
 func TestVotingManager_CheckProposalStatus(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add 6 core validators (need 2/3 = 67%, so 4 yes votes needed)
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
-	core3 := common.HexToAddress("0x3")
-	core4 := common.HexToAddress("0x4")
-	core5 := common.HexToAddress("0x5")
-	core6 := common.HexToAddress("0x6")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
+	core3 := testAccount(0x3)
+	core4 := testAccount(0x4)
+	core5 := testAccount(0x5)
+	core6 := testAccount(0x6)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 	validators.AddMockValidator(core3, VoterTypeCore, 1)
@@ -270,11 +323,11 @@ func TestVotingManager_CheckProposalStatus(t *testing.T) {
 
 	// Vote yes from 4 validators (4/6 = 66.67%, rounds to 66% in integer division, need to vote 5 for 83%)
 	// Actually, 4*100/6 = 400/6 = 66, which is < 67, so need 5 votes
-	vm.Vote(proposalID, core1, true, nil)
-	vm.Vote(proposalID, core2, true, nil)
-	vm.Vote(proposalID, core3, true, nil)
-	vm.Vote(proposalID, core4, true, nil)
-	vm.Vote(proposalID, core5, true, nil) // 5 votes = 83%
+	vm.Vote(proposalID, core1, true, signTestVote(testDomain, vm, proposalID, core1, true))
+	vm.Vote(proposalID, core2, true, signTestVote(testDomain, vm, proposalID, core2, true))
+	vm.Vote(proposalID, core3, true, signTestVote(testDomain, vm, proposalID, core3, true))
+	vm.Vote(proposalID, core4, true, signTestVote(testDomain, vm, proposalID, core4, true))
+	vm.Vote(proposalID, core5, true, signTestVote(testDomain, vm, proposalID, core5, true)) // 5 votes = 83%
 
 	// Check status after voting period ends
 	currentBlock := 100 + config.VotingPeriod + 1
@@ -293,12 +346,12 @@ func TestVotingManager_CheckProposalStatus(t *testing.T) {
 func TestVotingManager_CheckProposalStatus_Rejected(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add 3 core validators
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
-	core3 := common.HexToAddress("0x3")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
+	core3 := testAccount(0x3)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 	validators.AddMockValidator(core3, VoterTypeCore, 1)
@@ -313,8 +366,8 @@ func TestVotingManager_CheckProposalStatus_Rejected(t *testing.T) {
 	proposalID, _ := vm.CreateProposal(proposal)
 
 	// Vote no from 2 validators
-	vm.Vote(proposalID, core1, false, nil)
-	vm.Vote(proposalID, core2, false, nil)
+	vm.Vote(proposalID, core1, false, signTestVote(testDomain, vm, proposalID, core1, false))
+	vm.Vote(proposalID, core2, false, signTestVote(testDomain, vm, proposalID, core2, false))
 
 	// Check status after voting period ends
 	currentBlock := 100 + config.VotingPeriod + 1
@@ -330,20 +383,20 @@ func TestVotingManager_CheckProposalStatus_Rejected(t *testing.T) {
 func TestVotingManager_CommunityVeto(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add 3 core validators (all vote yes)
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
-	core3 := common.HexToAddress("0x3")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
+	core3 := testAccount(0x3)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 	validators.AddMockValidator(core3, VoterTypeCore, 1)
 
 	// Add 3 community validators (all vote no - 100% rejection)
-	comm1 := common.HexToAddress("0x11")
-	comm2 := common.HexToAddress("0x12")
-	comm3 := common.HexToAddress("0x13")
+	comm1 := testAccount(0x11)
+	comm2 := testAccount(0x12)
+	comm3 := testAccount(0x13)
 	validators.AddMockValidator(comm1, VoterTypeCommunity, 1)
 	validators.AddMockValidator(comm2, VoterTypeCommunity, 1)
 	validators.AddMockValidator(comm3, VoterTypeCommunity, 1)
@@ -358,14 +411,14 @@ func TestVotingManager_CommunityVeto(t *testing.T) {
 	proposalID, _ := vm.CreateProposal(proposal)
 
 	// Core validators vote yes (100%)
-	vm.Vote(proposalID, core1, true, nil)
-	vm.Vote(proposalID, core2, true, nil)
-	vm.Vote(proposalID, core3, true, nil)
+	vm.Vote(proposalID, core1, true, signTestVote(testDomain, vm, proposalID, core1, true))
+	vm.Vote(proposalID, core2, true, signTestVote(testDomain, vm, proposalID, core2, true))
+	vm.Vote(proposalID, core3, true, signTestVote(testDomain, vm, proposalID, core3, true))
 
 	// Community validators vote no (100% veto)
-	vm.Vote(proposalID, comm1, false, nil)
-	vm.Vote(proposalID, comm2, false, nil)
-	vm.Vote(proposalID, comm3, false, nil)
+	vm.Vote(proposalID, comm1, false, signTestVote(testDomain, vm, proposalID, comm1, false))
+	vm.Vote(proposalID, comm2, false, signTestVote(testDomain, vm, proposalID, comm2, false))
+	vm.Vote(proposalID, comm3, false, signTestVote(testDomain, vm, proposalID, comm3, false))
 
 	// Check status after voting period ends
 	currentBlock := 100 + config.VotingPeriod + 1
@@ -381,9 +434,9 @@ func TestVotingManager_CommunityVeto(t *testing.T) {
 func TestVotingManager_ExecuteProposal(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
-	proposer := common.HexToAddress("0x1")
+	proposer := testAccount(0x1)
 	proposal := &Proposal{
 		Type:      ProposalAddMREnclave,
 		Proposer:  proposer,
@@ -419,9 +472,9 @@ func TestVotingManager_ExecuteProposal(t *testing.T) {
 func TestVotingManager_GetActiveProposals(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
-	proposer := common.HexToAddress("0x1")
+	proposer := testAccount(0x1)
 
 	// Create 3 proposals with different statuses
 	p1 := &Proposal{Type: ProposalAddMREnclave, Proposer: proposer, Target: []byte{1}, CreatedAt: 100}
@@ -449,12 +502,12 @@ func TestVotingManager_GetActiveProposals(t *testing.T) {
 func TestVotingManager_EmergencyUpgrade_RequiresUnanimous(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add 3 core validators
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
-	core3 := common.HexToAddress("0x3")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
+	core3 := testAccount(0x3)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 	validators.AddMockValidator(core3, VoterTypeCore, 1)
@@ -469,8 +522,8 @@ func TestVotingManager_EmergencyUpgrade_RequiresUnanimous(t *testing.T) {
 	proposalID, _ := vm.CreateProposal(proposal)
 
 	// Only 2 out of 3 vote yes (not unanimous)
-	vm.Vote(proposalID, core1, true, nil)
-	vm.Vote(proposalID, core2, true, nil)
+	vm.Vote(proposalID, core1, true, signTestVote(testDomain, vm, proposalID, core1, true))
+	vm.Vote(proposalID, core2, true, signTestVote(testDomain, vm, proposalID, core2, true))
 
 	// Check status after voting period ends
 	currentBlock := 100 + config.VotingPeriod + 1
@@ -486,12 +539,12 @@ func TestVotingManager_EmergencyUpgrade_RequiresUnanimous(t *testing.T) {
 func TestVotingManager_EmergencyUpgrade_Unanimous(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add 3 core validators
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
-	core3 := common.HexToAddress("0x3")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
+	core3 := testAccount(0x3)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 	validators.AddMockValidator(core3, VoterTypeCore, 1)
@@ -506,9 +559,9 @@ func TestVotingManager_EmergencyUpgrade_Unanimous(t *testing.T) {
 	proposalID, _ := vm.CreateProposal(proposal)
 
 	// All 3 vote yes (unanimous)
-	vm.Vote(proposalID, core1, true, nil)
-	vm.Vote(proposalID, core2, true, nil)
-	vm.Vote(proposalID, core3, true, nil)
+	vm.Vote(proposalID, core1, true, signTestVote(testDomain, vm, proposalID, core1, true))
+	vm.Vote(proposalID, core2, true, signTestVote(testDomain, vm, proposalID, core2, true))
+	vm.Vote(proposalID, core3, true, signTestVote(testDomain, vm, proposalID, core3, true))
 
 	// Check status after voting period ends
 	currentBlock := 100 + config.VotingPeriod + 1
@@ -524,21 +577,21 @@ func TestVotingManager_EmergencyUpgrade_Unanimous(t *testing.T) {
 func TestVotingManager_EmergencyUpgrade_StricterVeto(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	validators := NewMockValidatorManager()
-	vm := NewInMemoryVotingManager(config, validators)
+	vm := NewInMemoryVotingManager(config, testDomain, validators)
 
 	// Add 3 core validators (all vote yes)
-	core1 := common.HexToAddress("0x1")
-	core2 := common.HexToAddress("0x2")
-	core3 := common.HexToAddress("0x3")
+	core1 := testAccount(0x1)
+	core2 := testAccount(0x2)
+	core3 := testAccount(0x3)
 	validators.AddMockValidator(core1, VoterTypeCore, 1)
 	validators.AddMockValidator(core2, VoterTypeCore, 1)
 	validators.AddMockValidator(core3, VoterTypeCore, 1)
 
 	// Add 4 community validators
-	comm1 := common.HexToAddress("0x11")
-	comm2 := common.HexToAddress("0x12")
-	comm3 := common.HexToAddress("0x13")
-	comm4 := common.HexToAddress("0x14")
+	comm1 := testAccount(0x11)
+	comm2 := testAccount(0x12)
+	comm3 := testAccount(0x13)
+	comm4 := testAccount(0x14)
 	validators.AddMockValidator(comm1, VoterTypeCommunity, 1)
 	validators.AddMockValidator(comm2, VoterTypeCommunity, 1)
 	validators.AddMockValidator(comm3, VoterTypeCommunity, 1)
@@ -554,13 +607,13 @@ func TestVotingManager_EmergencyUpgrade_StricterVeto(t *testing.T) {
 	proposalID, _ := vm.CreateProposal(proposal)
 
 	// All core validators vote yes
-	vm.Vote(proposalID, core1, true, nil)
-	vm.Vote(proposalID, core2, true, nil)
-	vm.Vote(proposalID, core3, true, nil)
+	vm.Vote(proposalID, core1, true, signTestVote(testDomain, vm, proposalID, core1, true))
+	vm.Vote(proposalID, core2, true, signTestVote(testDomain, vm, proposalID, core2, true))
+	vm.Vote(proposalID, core3, true, signTestVote(testDomain, vm, proposalID, core3, true))
 
 	// 2 out of 4 community validators vote no (50% - should veto)
-	vm.Vote(proposalID, comm1, false, nil)
-	vm.Vote(proposalID, comm2, false, nil)
+	vm.Vote(proposalID, comm1, false, signTestVote(testDomain, vm, proposalID, comm1, false))
+	vm.Vote(proposalID, comm2, false, signTestVote(testDomain, vm, proposalID, comm2, false))
 
 	// Check status after voting period ends
 	currentBlock := 100 + config.VotingPeriod + 1
@@ -0,0 +1,101 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// VotingPowerUnit is the stake worth one vote.
+var VotingPowerUnit = big.NewInt(params.Ether)
+
+// stakeVotingPower returns the voting power of a stake, one vote per whole
+// staked token.
+func stakeVotingPower(stake *big.Int) uint64 {
+	power := new(big.Int).Div(stake, VotingPowerUnit)
+	if !power.IsUint64() {
+		return math.MaxUint64
+	}
+	return power.Uint64()
+}
+
+// ownVotingPower returns the voting power a validator contributes, which is
+// zero unless it is active.
+func ownVotingPower(v *ValidatorInfo) uint64 {
+	if v.Status != ValidatorStatusActive {
+		return 0
+	}
+	return v.VotingPower
+}
+
+// delegateOf returns the validator voting with the power of v.
+func delegateOf(v *ValidatorInfo) common.Address {
+	if v.Delegate != (common.Address{}) {
+		return v.Delegate
+	}
+	return v.Address
+}
+
+// checkDelegation checks that delegator may delegate its voting power to
+// delegatee. Only community validators delegate, to other active community
+// validators, so delegation never moves power between the two tallies.
+func checkDelegation(delegator, delegatee *ValidatorInfo) error {
+	if delegator.Type != VoterTypeCommunity || delegator.Status != ValidatorStatusActive {
+		return ErrInvalidDelegation
+	}
+	if delegatee == nil || delegatee.Type != VoterTypeCommunity || delegatee.Status != ValidatorStatusActive {
+		return ErrInvalidDelegation
+	}
+	return nil
+}
+
+// votingTotals is the total voting power of the core and community validators
+// when a proposal was created.
+type votingTotals struct {
+	core      uint64
+	community uint64
+}
+
+// powerSnapshot is the voting power of all validators when a proposal was
+// created. Delegated power is counted for the delegate, whether or not the
+// delegate is still active.
+type powerSnapshot struct {
+	weights map[common.Address]uint64
+	totals  votingTotals
+}
+
+// newPowerSnapshot takes a snapshot of the voting power of validators.
+func newPowerSnapshot(validators []*ValidatorInfo) *powerSnapshot {
+	snapshot := &powerSnapshot{weights: make(map[common.Address]uint64)}
+	for _, v := range validators {
+		power := ownVotingPower(v)
+		if power == 0 {
+			continue
+		}
+		snapshot.weights[delegateOf(v)] += power
+		if v.Type == VoterTypeCore {
+			snapshot.totals.core += power
+		} else {
+			snapshot.totals.community += power
+		}
+	}
+	return snapshot
+}
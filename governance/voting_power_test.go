@@ -0,0 +1,212 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package governance
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestStateVotingPowerSnapshot(t *testing.T) {
+	statedb := newTestState(t)
+	setupCoreValidators(statedb, testCore...)
+	staking := DefaultStakingConfig()
+	managers := func(number uint64) (*StateValidatorManager, *StateVotingManager) {
+		validators := NewStateValidatorManager(statedb, testGovernance, number, staking)
+		return validators, NewStateVotingManager(statedb, testGovernance, testDomain.ChainID, number, DefaultWhitelistConfig(), validators)
+	}
+	a, b, c := testCommunity[0], testCommunity[1], testCommunity[2]
+	minPower := stakeVotingPower(staking.MinStakeAmount)
+	fundStakers(statedb, new(big.Int).Mul(staking.MinStakeAmount, big.NewInt(2)), a, b, c)
+
+	validators, _ := managers(1)
+	if err := validators.Stake(a, new(big.Int).Mul(staking.MinStakeAmount, big.NewInt(2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := validators.Stake(b, staking.MinStakeAmount); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stake moved in the creation block does not count for the proposal.
+	validators, voting := managers(2)
+	if err := validators.Stake(c, staking.MinStakeAmount); err != nil {
+		t.Fatal(err)
+	}
+	id, err := voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: testCore[0], Target: []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validators.Unstake(a, staking.MinStakeAmount); err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[common.Address]uint64{a: 2 * minPower, b: minPower, c: 0, testCore[0]: 1} {
+		if have, _ := voting.GetVotingPower(id, addr); have != want {
+			t.Errorf("voting power of %x: have %d, want %d", addr, have, want)
+		}
+	}
+	if v, _ := validators.GetValidator(a); v.VotingPower != minPower {
+		t.Errorf("current voting power: have %d, want %d", v.VotingPower, minPower)
+	}
+
+	_, voting = managers(3)
+	if err := voting.Vote(id, c, true, signTestVote(testDomain, voting, id, c, true)); !errors.Is(err, ErrNoVotingPower) {
+		t.Fatalf("vote without snapshotted power: have %v, want %v", err, ErrNoVotingPower)
+	}
+	for _, addr := range append([]common.Address{a}, testCore...) {
+		if err := voting.Vote(id, addr, true, signTestVote(testDomain, voting, id, addr, true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proposal, _ := voting.GetProposal(id)
+	if proposal.CommunityYesVotes != 2*minPower {
+		t.Fatalf("community yes votes: have %d, want %d", proposal.CommunityYesVotes, 2*minPower)
+	}
+	if err := voting.CheckProposalStatus(id, proposal.VotingEndsAt); err != nil {
+		t.Fatal(err)
+	}
+	if proposal, _ = voting.GetProposal(id); proposal.Status != ProposalStatusPassed {
+		t.Fatalf("proposal status = %v, want passed", proposal.Status)
+	}
+
+	// The core validators alone do not reach the participation quorum.
+	_, voting = managers(4)
+	id, err = voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: testCore[0], Target: []byte{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range testCore {
+		if err := voting.Vote(id, addr, true, signTestVote(testDomain, voting, id, addr, true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proposal, _ = voting.GetProposal(id)
+	if err := voting.CheckProposalStatus(id, proposal.VotingEndsAt); err != nil {
+		t.Fatal(err)
+	}
+	if proposal, _ = voting.GetProposal(id); proposal.Status != ProposalStatusRejected {
+		t.Fatalf("proposal status = %v, want rejected", proposal.Status)
+	}
+}
+
+func TestStateDelegation(t *testing.T) {
+	statedb := newTestState(t)
+	setupCoreValidators(statedb, testCore...)
+	staking := DefaultStakingConfig()
+	managers := func(number uint64) (*StateValidatorManager, *StateVotingManager) {
+		validators := NewStateValidatorManager(statedb, testGovernance, number, staking)
+		return validators, NewStateVotingManager(statedb, testGovernance, testDomain.ChainID, number, DefaultWhitelistConfig(), validators)
+	}
+	a, b := testCommunity[0], testCommunity[1]
+	minPower := stakeVotingPower(staking.MinStakeAmount)
+	fundStakers(statedb, staking.MinStakeAmount, a, b)
+
+	validators, _ := managers(1)
+	for _, addr := range []common.Address{a, b} {
+		if err := validators.Stake(addr, staking.MinStakeAmount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := validators.Delegate(a, testCore[0]); !errors.Is(err, ErrInvalidDelegation) {
+		t.Fatalf("delegation to core validator: have %v, want %v", err, ErrInvalidDelegation)
+	}
+	if err := validators.Delegate(testCore[0], a); !errors.Is(err, ErrInvalidDelegation) {
+		t.Fatalf("delegation by core validator: have %v, want %v", err, ErrInvalidDelegation)
+	}
+	if err := validators.Delegate(testCommunity[2], a); !errors.Is(err, ErrValidatorNotFound) {
+		t.Fatalf("delegation by non-validator: have %v, want %v", err, ErrValidatorNotFound)
+	}
+	if err := validators.Delegate(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := validators.GetValidator(a); v.Delegate != b {
+		t.Fatalf("delegate: have %x, want %x", v.Delegate, b)
+	}
+
+	_, voting := managers(2)
+	id, err := voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: testCore[0], Target: []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, voting = managers(3)
+	if err := voting.Vote(id, a, false, signTestVote(testDomain, voting, id, a, false)); !errors.Is(err, ErrNoVotingPower) {
+		t.Fatalf("vote of delegator: have %v, want %v", err, ErrNoVotingPower)
+	}
+	if err := voting.Vote(id, b, false, signTestVote(testDomain, voting, id, b, false)); err != nil {
+		t.Fatal(err)
+	}
+	if proposal, _ := voting.GetProposal(id); proposal.CommunityNoVotes != 2*minPower {
+		t.Fatalf("community no votes: have %d, want %d", proposal.CommunityNoVotes, 2*minPower)
+	}
+
+	// Delegating to oneself removes the delegation for later proposals.
+	validators, _ = managers(3)
+	if err := validators.Delegate(a, a); err != nil {
+		t.Fatal(err)
+	}
+	_, voting = managers(4)
+	next, err := voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: testCore[0], Target: []byte{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[common.Address]uint64{a: minPower, b: minPower} {
+		if have, _ := voting.GetVotingPower(next, addr); have != want {
+			t.Errorf("voting power of %x: have %d, want %d", addr, have, want)
+		}
+	}
+	if have, _ := voting.GetVotingPower(id, b); have != 2*minPower {
+		t.Errorf("snapshotted voting power: have %d, want %d", have, 2*minPower)
+	}
+}
+
+func TestInMemoryDelegation(t *testing.T) {
+	staking := DefaultStakingConfig()
+	validators := NewInMemoryValidatorManager(staking)
+	voting := NewInMemoryVotingManager(DefaultWhitelistConfig(), testDomain, validators)
+	a, b := testCommunity[0], testCommunity[1]
+	minPower := stakeVotingPower(staking.MinStakeAmount)
+
+	for _, addr := range []common.Address{a, b} {
+		if err := validators.Stake(addr, staking.MinStakeAmount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := validators.Delegate(a, b); err != nil {
+		t.Fatal(err)
+	}
+	id, err := voting.CreateProposal(&Proposal{Type: ProposalAddMREnclave, Proposer: a, Target: []byte{1}, CreatedAt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes after the proposal was created do not affect its snapshot.
+	if err := validators.Delegate(a, common.Address{}); err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[common.Address]uint64{a: 0, b: 2 * minPower} {
+		if have, _ := voting.GetVotingPower(id, addr); have != want {
+			t.Errorf("voting power of %x: have %d, want %d", addr, have, want)
+		}
+	}
+	if err := voting.Vote(id, b, true, signTestVote(testDomain, voting, id, b, true)); err != nil {
+		t.Fatal(err)
+	}
+	if proposal, _ := voting.GetProposal(id); proposal.CommunityYesVotes != 2*minPower {
+		t.Fatalf("community yes votes: have %d, want %d", proposal.CommunityYesVotes, 2*minPower)
+	}
+}
@@ -109,7 +109,7 @@ func (wm *InMemoryWhitelistManager) ProposeAdd(proposer common.Address, mrenclav
 	proposal := &Proposal{
 		Type:        ProposalAddMREnclave,
 		Proposer:    proposer,
-		Target:      mrenclave[:],
+		Target:      (&AddMREnclavePayload{MRENCLAVE: mrenclave, PermissionLevel: PermissionBasic, Version: version}).Encode(),
 		Description: "Add MRENCLAVE version " + version,
 	}
 
@@ -130,7 +130,7 @@ func (wm *InMemoryWhitelistManager) ProposeRemove(proposer common.Address, mrenc
 	proposal := &Proposal{
 		Type:        ProposalRemoveMREnclave,
 		Proposer:    proposer,
-		Target:      mrenclave[:],
+		Target:      (&RemoveMREnclavePayload{MRENCLAVE: mrenclave}).Encode(),
 		Description: "Remove MRENCLAVE: " + reason,
 	}
 
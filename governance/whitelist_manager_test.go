@@ -79,6 +79,10 @@ func (m *MockVotingManager) CheckProposalStatus(proposalID common.Hash, currentB
 	return nil
 }
 
+func (m *MockVotingManager) GetVotingPower(proposalID common.Hash, voter common.Address) (uint64, error) {
+	return 0, nil
+}
+
 func TestWhitelistManager_IsAllowed(t *testing.T) {
 	config := DefaultWhitelistConfig()
 	voting := NewMockVotingManager()
@@ -160,6 +160,17 @@ type simulator struct {
 	traceTransfers bool
 	validate       bool
 	fullTx         bool
+	keys           vm.KeyStore // SGX key store shared by the simulated blocks
+}
+
+// sgxKeyStore returns the SGX key store of the chain at the given block for
+// simulated calls, nil if the backend has none. The key changes of the calls
+// stay in memory.
+func sgxKeyStore(b Backend, block common.Hash) vm.KeyStore {
+	if b, ok := b.(interface{ SGXKeyStore(common.Hash) vm.KeyStore }); ok {
+		return b.SGXKeyStore(block)
+	}
+	return nil
 }
 
 // execute runs the simulation of a series of blocks.
@@ -246,8 +257,9 @@ func (sim *simulator) processBlock(ctx context.Context, block *simBlock, header,
 		// Block hash will be repaired after execution.
 		tracer   = newTracer(sim.traceTransfers, blockContext.BlockNumber.Uint64(), blockContext.Time, common.Hash{}, common.Hash{}, 0)
 		vmConfig = &vm.Config{
-			NoBaseFee: !sim.validate,
-			Tracer:    tracer.Hooks(),
+			NoBaseFee:   !sim.validate,
+			Tracer:      tracer.Hooks(),
+			SGXKeyStore: sim.keys,
 		}
 		// senders is a map of transaction hashes to their senders.
 		// Transaction objects contain only the signature, and we lose track
@@ -11,6 +11,17 @@ type AppConfig struct {
 	GovernanceContract     string
 	SecurityConfigContract string
 	NodeType               string
+	CollateralDir          string // optional DCAP collateral directory, see LoadCollateral
+}
+
+// collateralDirEnv names the environment variable holding the DCAP collateral
+// directory.
+const collateralDirEnv = "SGX_COLLATERAL_DIR"
+
+// TestMode reports whether the node runs in test mode outside an enclave, as
+// set by SGX_TEST_MODE=true or GRAMINE_VERSION=test.
+func TestMode() bool {
+	return os.Getenv("SGX_TEST_MODE") == "true" || os.Getenv("GRAMINE_VERSION") == "test"
 }
 
 // GetAppConfigFromEnvironment reads application configuration from environment variables.
@@ -21,11 +32,8 @@ func GetAppConfigFromEnvironment() (*AppConfig, error) {
 	mrenclave := os.Getenv("RA_TLS_MRENCLAVE")
 	isGramineEnv := mrenclave != ""
 	
-	// Check for test mode
-	isTestMode := os.Getenv("SGX_TEST_MODE") == "true" || os.Getenv("GRAMINE_VERSION") == "test"
-	
 	// In production, MUST be in Gramine environment
-	if !isGramineEnv && !isTestMode {
+	if !isGramineEnv && !TestMode() {
 		return nil, fmt.Errorf("not in SGX environment - RA_TLS_MRENCLAVE not set. For testing: export SGX_TEST_MODE=true")
 	}
 
@@ -34,6 +42,7 @@ func GetAppConfigFromEnvironment() (*AppConfig, error) {
 		GovernanceContract:     os.Getenv("GOVERNANCE_CONTRACT"),
 		SecurityConfigContract: os.Getenv("SECURITY_CONFIG_CONTRACT"),
 		NodeType:               os.Getenv("NODE_TYPE"),
+		CollateralDir:          os.Getenv(collateralDirEnv),
 	}
 
 	// Validate required config
@@ -0,0 +1,332 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File names looked up inside a collateral directory. All files are optional;
+// a check is only enforced when its collateral is present.
+const (
+	CollateralRootCAFile          = "root_ca.pem"           // overrides the pinned Intel SGX Root CA
+	CollateralRootCACRLFile       = "root_ca_crl.der"       // CRL issued by the root CA (DER or PEM)
+	CollateralPCKCRLPattern       = "pck_crl*"              // CRLs issued by the PCK platform/processor CAs
+	CollateralTCBSigningChainFile = "tcb_signing_chain.pem" // signer of TCB Info and QE Identity
+	CollateralTCBInfoPattern      = "tcb_info*.json"        // one TCB Info per FMSPC
+	CollateralQEIdentityFile      = "qe_identity.json"
+)
+
+// TCB status values as named by Intel in TCB Info and QE Identity collateral.
+var tcbStatusNames = map[string]uint8{
+	"UpToDate":                          TCBUpToDate,
+	"SWHardeningNeeded":                 TCBSWHardeningNeeded,
+	"ConfigurationNeeded":               TCBConfigurationNeeded,
+	"ConfigurationAndSWHardeningNeeded": TCBConfigurationAndSWHardeningNeeded,
+	"OutOfDate":                         TCBOutOfDate,
+	"OutOfDateConfigurationNeeded":      TCBOutOfDateConfigurationNeeded,
+	"Revoked":                           TCBRevoked,
+}
+
+// tcbUnknownName is the name of TCBUnknown, which Intel collateral never
+// lists.
+const tcbUnknownName = "Unknown"
+
+// TCBStatusString returns Intel's name for a TCB status value.
+func TCBStatusString(status uint8) string {
+	if status == TCBUnknown {
+		return tcbUnknownName
+	}
+	for name, s := range tcbStatusNames {
+		if s == status {
+			return name
+		}
+	}
+	return fmt.Sprintf("Unknown(%d)", status)
+}
+
+func parseTCBStatus(name string) (uint8, error) {
+	status, ok := tcbStatusNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown TCB status %q", name)
+	}
+	return status, nil
+}
+
+// Collateral is the verification material needed to evaluate a DCAP quote
+// offline. It mirrors what the Intel PCS serves: CRLs for the PCK hierarchy,
+// TCB Info per platform FMSPC and the QE Identity, together with the chain of
+// the TCB signing certificate that signs the latter two.
+type Collateral struct {
+	RootCA          *x509.Certificate      // trust anchor, nil to use the pinned Intel SGX Root CA
+	RootCACRL       *x509.RevocationList   // revocations issued by the root CA
+	PCKCRLs         []*x509.RevocationList // revocations issued by the PCK intermediate CAs
+	TCBSigningChain []*x509.Certificate    // TCB signing certificate first, followed by its issuers
+	TCBInfos        map[string]*TCBInfo    // keyed by lower case hex FMSPC
+	QEIdentity      *QEIdentity
+}
+
+// LoadCollateral reads collateral from a local directory, see the Collateral*
+// file name constants for the expected layout. Signatures are not checked
+// here, they are verified against the trust anchor on every quote verification.
+func LoadCollateral(dir string) (*Collateral, error) {
+	c := &Collateral{TCBInfos: make(map[string]*TCBInfo)}
+
+	if data, err := readOptional(filepath.Join(dir, CollateralRootCAFile)); err != nil {
+		return nil, err
+	} else if data != nil {
+		certs, err := parseCertificates(data)
+		if err != nil || len(certs) != 1 {
+			return nil, fmt.Errorf("invalid root CA in %s: %v", CollateralRootCAFile, err)
+		}
+		c.RootCA = certs[0]
+	}
+	if data, err := readOptional(filepath.Join(dir, CollateralRootCACRLFile)); err != nil {
+		return nil, err
+	} else if data != nil {
+		if c.RootCACRL, err = parseCRL(data); err != nil {
+			return nil, fmt.Errorf("invalid root CA CRL: %w", err)
+		}
+	}
+	crlFiles, _ := filepath.Glob(filepath.Join(dir, CollateralPCKCRLPattern))
+	for _, file := range crlFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		crl, err := parseCRL(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PCK CRL %s: %w", filepath.Base(file), err)
+		}
+		c.PCKCRLs = append(c.PCKCRLs, crl)
+	}
+	if data, err := readOptional(filepath.Join(dir, CollateralTCBSigningChainFile)); err != nil {
+		return nil, err
+	} else if data != nil {
+		if c.TCBSigningChain, err = parseCertificates(data); err != nil {
+			return nil, fmt.Errorf("invalid TCB signing chain: %w", err)
+		}
+	}
+	infoFiles, _ := filepath.Glob(filepath.Join(dir, CollateralTCBInfoPattern))
+	for _, file := range infoFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := ParseTCBInfo(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TCB info %s: %w", filepath.Base(file), err)
+		}
+		c.TCBInfos[strings.ToLower(info.body.FMSPC)] = info
+	}
+	if data, err := readOptional(filepath.Join(dir, CollateralQEIdentityFile)); err != nil {
+		return nil, err
+	} else if data != nil {
+		if c.QEIdentity, err = ParseQEIdentity(data); err != nil {
+			return nil, fmt.Errorf("invalid QE identity: %w", err)
+		}
+	}
+	if (len(c.TCBInfos) > 0 || c.QEIdentity != nil) && len(c.TCBSigningChain) == 0 {
+		return nil, errors.New("TCB info or QE identity present without TCB signing chain")
+	}
+	return c, nil
+}
+
+// TCBInfo is a signed Intel TCB Info document for one platform FMSPC.
+type TCBInfo struct {
+	body      tcbInfoBody
+	raw       []byte // exact signed bytes of the "tcbInfo" object
+	signature []byte
+}
+
+type tcbInfoBody struct {
+	ID         string     `json:"id"`
+	Version    int        `json:"version"`
+	IssueDate  time.Time  `json:"issueDate"`
+	NextUpdate time.Time  `json:"nextUpdate"`
+	FMSPC      string     `json:"fmspc"`
+	PCEID      string     `json:"pceId"`
+	TCBLevels  []tcbLevel `json:"tcbLevels"`
+}
+
+type tcbLevel struct {
+	TCB       tcbComponents `json:"tcb"`
+	TCBStatus string        `json:"tcbStatus"`
+}
+
+// tcbComponents holds the sixteen SGX TCB component SVNs and the PCE SVN.
+// Version 2 TCB Info lists them as flat sgxtcbcompNNsvn fields, version 3 as
+// an sgxtcbcomponents array; both are accepted.
+type tcbComponents struct {
+	SVNs   [16]uint8
+	PCESVN uint16
+}
+
+func (c *tcbComponents) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields["pcesvn"], &c.PCESVN); err != nil {
+		return fmt.Errorf("invalid pcesvn: %w", err)
+	}
+	if list, ok := fields["sgxtcbcomponents"]; ok {
+		var comps []struct {
+			SVN uint8 `json:"svn"`
+		}
+		if err := json.Unmarshal(list, &comps); err != nil {
+			return err
+		}
+		if len(comps) != len(c.SVNs) {
+			return fmt.Errorf("expected %d sgxtcbcomponents, got %d", len(c.SVNs), len(comps))
+		}
+		for i, comp := range comps {
+			c.SVNs[i] = comp.SVN
+		}
+		return nil
+	}
+	for i := range c.SVNs {
+		name := fmt.Sprintf("sgxtcbcomp%02dsvn", i+1)
+		if err := json.Unmarshal(fields[name], &c.SVNs[i]); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ParseTCBInfo decodes a TCB Info document as served by the Intel PCS.
+func ParseTCBInfo(data []byte) (*TCBInfo, error) {
+	var doc struct {
+		TCBInfo   json.RawMessage `json:"tcbInfo"`
+		Signature string          `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	info := &TCBInfo{raw: doc.TCBInfo}
+	if err := json.Unmarshal(doc.TCBInfo, &info.body); err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(doc.Signature)
+	if err != nil || len(sig) != quoteECDSASigSize {
+		return nil, errors.New("invalid TCB info signature encoding")
+	}
+	info.signature = sig
+	return info, nil
+}
+
+// QEIdentity is a signed Intel QE Identity document.
+type QEIdentity struct {
+	body      qeIdentityBody
+	raw       []byte // exact signed bytes of the "enclaveIdentity" object
+	signature []byte
+}
+
+type qeIdentityBody struct {
+	ID             string    `json:"id"`
+	Version        int       `json:"version"`
+	IssueDate      time.Time `json:"issueDate"`
+	NextUpdate     time.Time `json:"nextUpdate"`
+	MiscSelect     string    `json:"miscselect"`
+	MiscSelectMask string    `json:"miscselectMask"`
+	Attributes     string    `json:"attributes"`
+	AttributesMask string    `json:"attributesMask"`
+	MRSigner       string    `json:"mrsigner"`
+	ISVProdID      uint16    `json:"isvprodid"`
+	TCBLevels      []struct {
+		TCB struct {
+			ISVSVN uint16 `json:"isvsvn"`
+		} `json:"tcb"`
+		TCBStatus string `json:"tcbStatus"`
+	} `json:"tcbLevels"`
+}
+
+// ParseQEIdentity decodes a QE Identity document as served by the Intel PCS.
+func ParseQEIdentity(data []byte) (*QEIdentity, error) {
+	var doc struct {
+		EnclaveIdentity json.RawMessage `json:"enclaveIdentity"`
+		Signature       string          `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	id := &QEIdentity{raw: doc.EnclaveIdentity}
+	if err := json.Unmarshal(doc.EnclaveIdentity, &id.body); err != nil {
+		return nil, err
+	}
+	sig, err := hex.DecodeString(doc.Signature)
+	if err != nil || len(sig) != quoteECDSASigSize {
+		return nil, errors.New("invalid QE identity signature encoding")
+	}
+	id.signature = sig
+	return id, nil
+}
+
+// readOptional returns the file content, or nil if the file does not exist.
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// parseCertificates decodes one or more PEM encoded certificates.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// parseCRL decodes a DER or PEM encoded certificate revocation list.
+func parseCRL(data []byte) (*x509.RevocationList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("invalid PEM CRL")
+		}
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
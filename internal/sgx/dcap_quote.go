@@ -0,0 +1,139 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Layout of an Intel SGX ECDSA quote (version 3), as produced by the DCAP
+// quoting enclave:
+//
+//	header        48 bytes
+//	report body  384 bytes (the ISV enclave report)
+//	sig data len   4 bytes
+//	sig data:
+//	  ISV report signature  64 bytes (r||s, signed by the attestation key)
+//	  attestation key       64 bytes (raw P-256 X||Y)
+//	  QE report            384 bytes
+//	  QE report signature   64 bytes (r||s, signed by the PCK key)
+//	  QE auth data size      2 bytes, followed by QE auth data
+//	  cert data type         2 bytes
+//	  cert data size         4 bytes, followed by cert data
+const (
+	quoteHeaderSize     = 48
+	quoteReportBodySize = 384
+	quoteSignedSize     = quoteHeaderSize + quoteReportBodySize
+	quoteECDSASigSize   = 64
+	quoteAttestKeySize  = 64
+
+	// quoteAttestKeyTypeECDSAP256 is the attestation key type of ECDSA-256
+	// with P-256, the only type produced by the DCAP quoting enclave.
+	quoteAttestKeyTypeECDSAP256 = 2
+
+	// certDataTypePCKChain is the certification data type carrying the
+	// concatenated PEM PCK leaf, intermediate CA and root CA certificates.
+	certDataTypePCKChain = 5
+)
+
+// Offsets of fields inside a 384 byte SGX report body.
+const (
+	reportMiscSelectOffset = 16
+	reportAttributesOffset = 48
+	reportMRSignerOffset   = 128
+	reportISVProdIDOffset  = 256
+	reportISVSVNOffset     = 258
+	reportDataOffset       = 320
+)
+
+// ecdsaQuote is an SGX ECDSA quote split into its signed and signature parts.
+type ecdsaQuote struct {
+	version       uint16
+	attestKeyType uint16
+	signed        []byte // header || ISV report body, covered by isvSignature
+	reportBody    []byte
+	isvSignature  []byte
+	attestKey     []byte
+	qeReport      []byte
+	qeReportSig   []byte
+	qeAuthData    []byte
+	certDataType  uint16
+	certData      []byte
+}
+
+// parseECDSAQuote splits a raw version 3 ECDSA quote into its components. It
+// only checks the structure; no cryptographic verification is performed.
+func parseECDSAQuote(raw []byte) (*ecdsaQuote, error) {
+	if len(raw) < quoteSignedSize+4 {
+		return nil, fmt.Errorf("quote too short: %d bytes", len(raw))
+	}
+	q := &ecdsaQuote{
+		version:       binary.LittleEndian.Uint16(raw[0:2]),
+		attestKeyType: binary.LittleEndian.Uint16(raw[2:4]),
+		signed:        raw[:quoteSignedSize],
+		reportBody:    raw[quoteHeaderSize:quoteSignedSize],
+	}
+	if q.version != 3 {
+		return nil, fmt.Errorf("unsupported quote version: %d", q.version)
+	}
+	if q.attestKeyType != quoteAttestKeyTypeECDSAP256 {
+		return nil, fmt.Errorf("unsupported attestation key type: %d", q.attestKeyType)
+	}
+	sigLen := int(binary.LittleEndian.Uint32(raw[quoteSignedSize : quoteSignedSize+4]))
+	sig := raw[quoteSignedSize+4:]
+	if len(sig) < sigLen {
+		return nil, fmt.Errorf("quote signature data truncated: have %d, want %d", len(sig), sigLen)
+	}
+	sig = sig[:sigLen]
+
+	fixed := quoteECDSASigSize + quoteAttestKeySize + quoteReportBodySize + quoteECDSASigSize + 2
+	if len(sig) < fixed {
+		return nil, errors.New("quote signature data too short")
+	}
+	q.isvSignature, sig = sig[:quoteECDSASigSize], sig[quoteECDSASigSize:]
+	q.attestKey, sig = sig[:quoteAttestKeySize], sig[quoteAttestKeySize:]
+	q.qeReport, sig = sig[:quoteReportBodySize], sig[quoteReportBodySize:]
+	q.qeReportSig, sig = sig[:quoteECDSASigSize], sig[quoteECDSASigSize:]
+
+	authLen := int(binary.LittleEndian.Uint16(sig[0:2]))
+	sig = sig[2:]
+	if len(sig) < authLen+6 {
+		return nil, errors.New("quote QE auth data truncated")
+	}
+	q.qeAuthData, sig = sig[:authLen], sig[authLen:]
+
+	q.certDataType = binary.LittleEndian.Uint16(sig[0:2])
+	certLen := int(binary.LittleEndian.Uint32(sig[2:6]))
+	sig = sig[6:]
+	if len(sig) < certLen {
+		return nil, errors.New("quote certification data truncated")
+	}
+	q.certData = sig[:certLen]
+	return q, nil
+}
+
+// qeISVSVN returns the ISV security version of the quoting enclave.
+func (q *ecdsaQuote) qeISVSVN() uint16 {
+	return binary.LittleEndian.Uint16(q.qeReport[reportISVSVNOffset : reportISVSVNOffset+2])
+}
+
+// qeISVProdID returns the product ID of the quoting enclave.
+func (q *ecdsaQuote) qeISVProdID() uint16 {
+	return binary.LittleEndian.Uint16(q.qeReport[reportISVProdIDOffset : reportISVProdIDOffset+2])
+}
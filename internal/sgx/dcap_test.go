@@ -0,0 +1,596 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTime is inside the validity window of the recorded PCK certificates.
+var testTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func loadRecordedQuote(t *testing.T) []byte {
+	quote, err := os.ReadFile(filepath.Join("testdata", "gramine_ratls_quote.bin"))
+	if err != nil {
+		t.Fatalf("failed to read recorded quote: %v", err)
+	}
+	return quote
+}
+
+func TestVerifyRecordedQuote(t *testing.T) {
+	quote := loadRecordedQuote(t)
+
+	status, err := verifyECDSAQuote(quote, intelSGXRootCA, nil, testTime)
+	if err != nil {
+		t.Fatalf("recorded quote rejected: %v", err)
+	}
+	// Without collateral the TCB level is unknown
+	if status != TCBUnknown {
+		t.Errorf("status mismatch: have %s, want Unknown", TCBStatusString(status))
+	}
+	// Report data, QE report and chain tampering must all be detected.
+	for name, offset := range map[string]int{
+		"report data": quoteHeaderSize + reportDataOffset,
+		"mrenclave":   112,
+		"qe report":   quoteSignedSize + 4 + 64 + 64 + 10,
+	} {
+		forged := append([]byte{}, quote...)
+		forged[offset] ^= 0xff
+		if _, err := verifyECDSAQuote(forged, intelSGXRootCA, nil, testTime); err == nil {
+			t.Errorf("forged %s accepted", name)
+		}
+	}
+	// A chain not rooted in the trust anchor must be rejected.
+	other := newTestPKI(t)
+	if _, err := verifyECDSAQuote(quote, other.root, nil, testTime); err == nil {
+		t.Error("quote accepted under foreign root CA")
+	}
+}
+
+func TestVerifyRecordedQuotePCKExtensions(t *testing.T) {
+	q, err := parseECDSAQuote(loadRecordedQuote(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := parseCertificates(q.certData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := parsePCKExtensions(chain[0])
+	if err != nil {
+		t.Fatalf("failed to parse PCK extensions: %v", err)
+	}
+	if len(ext.fmspc) != 6 || len(ext.pceID) != 2 {
+		t.Errorf("unexpected FMSPC %x / PCE-ID %x", ext.fmspc, ext.pceID)
+	}
+}
+
+func TestDCAPVerifierRejectsForgedQuote(t *testing.T) {
+	v := NewDCAPVerifier(false)
+	v.now = func() time.Time { return testTime }
+
+	// Quotes of unknown TCB level need collateral or an explicit opt-in.
+	if err := v.VerifyQuote(loadRecordedQuote(t)); err == nil {
+		t.Fatal("quote of unknown TCB level accepted without collateral")
+	}
+	v.SetAllowUnknownTCB(true)
+	if err := v.VerifyQuote(loadRecordedQuote(t)); err != nil {
+		t.Fatalf("recorded quote rejected: %v", err)
+	}
+	forged := make([]byte, 500)
+	binary.LittleEndian.PutUint16(forged[0:2], 3)
+	binary.LittleEndian.PutUint16(forged[2:4], 2)
+	if err := v.VerifyQuote(forged); err == nil {
+		t.Error("well-formed but unsigned quote accepted")
+	}
+}
+
+// Tests that quotes verify against the time they were used at, so that
+// historical quotes stay valid after their certificates expire.
+func TestDCAPVerifyTime(t *testing.T) {
+	v := NewDCAPVerifier(false)
+	v.SetAllowUnknownTCB(true)
+	v.now = func() time.Time { return testTime.AddDate(100, 0, 0) }
+	quote := loadRecordedQuote(t)
+
+	if err := v.VerifyQuote(quote); err == nil {
+		t.Fatal("quote with expired certificates accepted")
+	}
+	result, err := v.VerifyQuoteComplete(quote, map[string]interface{}{"skipWhitelist": true, "verifyTime": testTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Verified {
+		t.Fatalf("quote rejected at its verification time: %v", result.Error)
+	}
+}
+
+// Tests that nodes require collateral outside test mode.
+func TestDCAPVerifierFromEnvironment(t *testing.T) {
+	t.Setenv("SGX_COLLATERAL_DIR", "")
+	t.Setenv("SGX_TEST_MODE", "")
+	t.Setenv("GRAMINE_VERSION", "")
+	if _, err := NewDCAPVerifierFromEnvironment(false); err == nil {
+		t.Fatal("verifier created without collateral outside test mode")
+	}
+	t.Setenv("SGX_TEST_MODE", "true")
+	v, err := NewDCAPVerifierFromEnvironment(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testTime }
+	if err := v.VerifyQuote(loadRecordedQuote(t)); err != nil {
+		t.Fatalf("test mode verifier rejected quote of unknown TCB level: %v", err)
+	}
+}
+
+func TestDCAPCollateral(t *testing.T) {
+	pki := newTestPKI(t)
+	fmspc := []byte{0x00, 0x90, 0x6e, 0xd5, 0x00, 0x00}
+	platformSVN := uint8(5)
+
+	tests := []struct {
+		name      string
+		levels    []testTCBLevel
+		qeLevels  []testTCBLevel
+		revokePCK bool
+		tamper    func(dir string)
+		strict    string // expected failure with allowOutdatedTCB=false
+		lenient   string // expected failure with allowOutdatedTCB=true
+	}{
+		{
+			name:     "up to date",
+			levels:   []testTCBLevel{{5, "UpToDate"}, {1, "OutOfDate"}},
+			qeLevels: []testTCBLevel{{8, "UpToDate"}},
+		},
+		{
+			name:     "out of date platform",
+			levels:   []testTCBLevel{{6, "UpToDate"}, {1, "OutOfDate"}},
+			qeLevels: []testTCBLevel{{8, "UpToDate"}},
+			strict:   "TCB status not up to date: OutOfDate",
+		},
+		{
+			name:     "out of date quoting enclave",
+			levels:   []testTCBLevel{{5, "ConfigurationNeeded"}},
+			qeLevels: []testTCBLevel{{9, "UpToDate"}, {1, "OutOfDate"}},
+			strict:   "TCB status not up to date: OutOfDateConfigurationNeeded",
+		},
+		{
+			name:     "revoked TCB",
+			levels:   []testTCBLevel{{6, "UpToDate"}, {1, "Revoked"}},
+			qeLevels: []testTCBLevel{{8, "UpToDate"}},
+			strict:   "TCB status revoked",
+			lenient:  "TCB status revoked",
+		},
+		{
+			name:     "unknown platform TCB",
+			levels:   []testTCBLevel{{6, "UpToDate"}},
+			qeLevels: []testTCBLevel{{8, "UpToDate"}},
+			strict:   "platform TCB below all TCB levels",
+			lenient:  "platform TCB below all TCB levels",
+		},
+		{
+			name:      "revoked PCK",
+			levels:    []testTCBLevel{{5, "UpToDate"}},
+			qeLevels:  []testTCBLevel{{8, "UpToDate"}},
+			revokePCK: true,
+			strict:    "PCK certificate revoked",
+			lenient:   "PCK certificate revoked",
+		},
+		{
+			name:     "tampered TCB info",
+			levels:   []testTCBLevel{{6, "UpToDate"}, {1, "OutOfDate"}},
+			qeLevels: []testTCBLevel{{8, "UpToDate"}},
+			tamper: func(dir string) {
+				path := filepath.Join(dir, "tcb_info_00906ed50000.json")
+				data, _ := os.ReadFile(path)
+				os.WriteFile(path, []byte(strings.Replace(string(data), "OutOfDate", "UpToDate", 1)), 0644)
+			},
+			strict:  "invalid TCB info signature",
+			lenient: "invalid TCB info signature",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, pck := pki.issueQuote(t, fmspc, platformSVN, 8)
+			dir := t.TempDir()
+			pki.writeCollateral(t, dir, fmspc, tt.levels, tt.qeLevels, tt.revokePCK, pck)
+			if tt.tamper != nil {
+				tt.tamper(dir)
+			}
+			for _, allowOutdated := range []bool{false, true} {
+				v, err := NewDCAPVerifierWithCollateral(allowOutdated, dir)
+				if err != nil {
+					t.Fatalf("failed to load collateral: %v", err)
+				}
+				v.now = func() time.Time { return testTime }
+				want := tt.strict
+				if allowOutdated {
+					want = tt.lenient
+				}
+				err = v.VerifyQuote(quote)
+				switch {
+				case want == "" && err != nil:
+					t.Errorf("allowOutdated=%v: unexpected error: %v", allowOutdated, err)
+				case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+					t.Errorf("allowOutdated=%v: error mismatch: have %v, want %v", allowOutdated, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDCAPCollateralMissingFMSPC(t *testing.T) {
+	pki := newTestPKI(t)
+	quote, pck := pki.issueQuote(t, []byte{1, 2, 3, 4, 5, 6}, 5, 8)
+	dir := t.TempDir()
+	pki.writeCollateral(t, dir, []byte{6, 5, 4, 3, 2, 1}, []testTCBLevel{{1, "UpToDate"}}, []testTCBLevel{{1, "UpToDate"}}, false, pck)
+
+	v, err := NewDCAPVerifierWithCollateral(true, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testTime }
+	if err := v.VerifyQuote(quote); err == nil || !strings.Contains(err.Error(), "no TCB info for FMSPC") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDCAPCollateralIncomplete(t *testing.T) {
+	pki := newTestPKI(t)
+	fmspc := []byte{0x00, 0x90, 0x6e, 0xd5, 0x00, 0x00}
+	quote, pck := pki.issueQuote(t, fmspc, 5, 8)
+
+	// Without either half of the TCB collateral the status is unknown, not
+	// up to date.
+	for _, missing := range []string{CollateralQEIdentityFile, CollateralTCBInfoPattern} {
+		dir := t.TempDir()
+		pki.writeCollateral(t, dir, fmspc, []testTCBLevel{{5, "UpToDate"}}, []testTCBLevel{{8, "UpToDate"}}, false, pck)
+		files, _ := filepath.Glob(filepath.Join(dir, missing))
+		for _, file := range files {
+			os.Remove(file)
+		}
+		v, err := NewDCAPVerifierWithCollateral(true, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.now = func() time.Time { return testTime }
+		if err := v.VerifyQuote(quote); err == nil || !strings.Contains(err.Error(), "TCB status unknown") {
+			t.Errorf("without %s: unexpected error: %v", missing, err)
+		}
+	}
+}
+
+func TestDCAPCollateralPCKSigner(t *testing.T) {
+	pki := newTestPKI(t)
+	fmspc := []byte{0x00, 0x90, 0x6e, 0xd5, 0x00, 0x00}
+	quote, pck := pki.issueQuote(t, fmspc, 5, 8)
+
+	// Sign the collateral with a PCK-like leaf that chains to the root.
+	pki.signerKey = newP256Key(t)
+	pki.signer = pki.issue(t, "Test SGX PCK Certificate", &pki.signerKey.PublicKey, pki.root, pki.rootKey, false,
+		[]pkix.Extension{{Id: oidSGXExtensions, Value: sgxExtension(t, fmspc, 5)}})
+	dir := t.TempDir()
+	pki.writeCollateral(t, dir, fmspc, []testTCBLevel{{5, "UpToDate"}}, []testTCBLevel{{8, "UpToDate"}}, false, pck)
+
+	v, err := NewDCAPVerifierWithCollateral(true, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testTime }
+	if err := v.VerifyQuote(quote); err == nil || !strings.Contains(err.Error(), "is not the TCB signing certificate") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParsePCKExtensionsZeroArc(t *testing.T) {
+	pki := newTestPKI(t)
+	comp, err := asn1.Marshal(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcb, err := asn1.Marshal([]sgxExtensionEntry{
+		{ID: append(append(asn1.ObjectIdentifier{}, oidSGXTCB...), 0), Value: asn1.RawValue{FullBytes: comp}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmspc, _ := asn1.Marshal([]byte{1, 2, 3, 4, 5, 6})
+	pceID, _ := asn1.Marshal([]byte{0, 0})
+	ext, err := asn1.Marshal([]sgxExtensionEntry{
+		{ID: oidSGXTCB, Value: asn1.RawValue{FullBytes: tcb}},
+		{ID: oidSGXPCEID, Value: asn1.RawValue{FullBytes: pceID}},
+		{ID: oidSGXFMSPC, Value: asn1.RawValue{FullBytes: fmspc}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newP256Key(t)
+	cert := pki.issue(t, "Test SGX PCK Certificate", &key.PublicKey, pki.ca, pki.caKey, false,
+		[]pkix.Extension{{Id: oidSGXExtensions, Value: ext}})
+	parsed, err := parsePCKExtensions(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.tcb != (tcbComponents{}) {
+		t.Errorf("component with arc 0 was applied: %+v", parsed.tcb)
+	}
+}
+
+// testTCBLevel is a TCB level where all platform components (or the QE ISVSVN)
+// share a single SVN value.
+type testTCBLevel struct {
+	svn    uint8
+	status string
+}
+
+// testPKI is a throwaway Intel-like PKI: root CA, PCK platform CA and TCB
+// signing certificate.
+type testPKI struct {
+	root      *x509.Certificate
+	rootKey   *ecdsa.PrivateKey
+	ca        *x509.Certificate
+	caKey     *ecdsa.PrivateKey
+	signer    *x509.Certificate
+	signerKey *ecdsa.PrivateKey
+	serial    int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	p := new(testPKI)
+	p.rootKey = newP256Key(t)
+	p.root = p.issue(t, "Test SGX Root CA", &p.rootKey.PublicKey, nil, p.rootKey, true, nil)
+	p.caKey = newP256Key(t)
+	p.ca = p.issue(t, "Test SGX PCK Platform CA", &p.caKey.PublicKey, p.root, p.rootKey, true, nil)
+	p.signerKey = newP256Key(t)
+	p.signer = p.issue(t, tcbSigningCommonName, &p.signerKey.PublicKey, p.root, p.rootKey, false, nil)
+	return p
+}
+
+func newP256Key(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (p *testPKI) issue(t *testing.T, cn string, pub *ecdsa.PublicKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool, exts []pkix.Extension) *x509.Certificate {
+	p.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(p.serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             testTime.Add(-24 * time.Hour),
+		NotAfter:              testTime.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		ExtraExtensions:       exts,
+	}
+	if isCA {
+		tmpl.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// issueQuote creates a PCK certificate for the given platform and a quote
+// signed through it.
+func (p *testPKI) issueQuote(t *testing.T, fmspc []byte, platformSVN uint8, qeSVN uint16) ([]byte, *x509.Certificate) {
+	pckKey := newP256Key(t)
+	pck := p.issue(t, "Test SGX PCK Certificate", &pckKey.PublicKey, p.ca, p.caKey, false,
+		[]pkix.Extension{{Id: oidSGXExtensions, Value: sgxExtension(t, fmspc, platformSVN)}})
+
+	attestKey := newP256Key(t)
+	attestPub := make([]byte, 64)
+	attestKey.X.FillBytes(attestPub[:32])
+	attestKey.Y.FillBytes(attestPub[32:])
+	authData := make([]byte, 32)
+
+	header := make([]byte, quoteHeaderSize)
+	binary.LittleEndian.PutUint16(header[0:2], 3)
+	binary.LittleEndian.PutUint16(header[2:4], quoteAttestKeyTypeECDSAP256)
+	body := make([]byte, quoteReportBodySize)
+	copy(body[64:96], []byte("test mrenclave"))
+
+	qeReport := make([]byte, quoteReportBodySize)
+	binary.LittleEndian.PutUint16(qeReport[reportISVSVNOffset:], qeSVN)
+	qeReport[reportAttributesOffset] = 0x11
+	copy(qeReport[reportMRSignerOffset:], testQEMRSigner)
+	binding := sha256.Sum256(append(append([]byte{}, attestPub...), authData...))
+	copy(qeReport[reportDataOffset:], binding[:])
+
+	var certData []byte
+	for _, cert := range []*x509.Certificate{pck, p.ca, p.root} {
+		certData = append(certData, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	var sig []byte
+	sig = append(sig, signRaw(t, attestKey, append(append([]byte{}, header...), body...))...)
+	sig = append(sig, attestPub...)
+	sig = append(sig, qeReport...)
+	sig = append(sig, signRaw(t, pckKey, qeReport)...)
+	sig = binary.LittleEndian.AppendUint16(sig, uint16(len(authData)))
+	sig = append(sig, authData...)
+	sig = binary.LittleEndian.AppendUint16(sig, certDataTypePCKChain)
+	sig = binary.LittleEndian.AppendUint32(sig, uint32(len(certData)))
+	sig = append(sig, certData...)
+
+	quote := append(append([]byte{}, header...), body...)
+	quote = binary.LittleEndian.AppendUint32(quote, uint32(len(sig)))
+	return append(quote, sig...), pck
+}
+
+var testQEMRSigner = func() []byte { h := sha256.Sum256([]byte("test quoting enclave")); return h[:] }()
+
+func sgxExtension(t *testing.T, fmspc []byte, svn uint8) []byte {
+	entry := func(oid asn1.ObjectIdentifier, value interface{}) sgxExtensionEntry {
+		der, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sgxExtensionEntry{ID: oid, Value: asn1.RawValue{FullBytes: der}}
+	}
+	var tcb []sgxExtensionEntry
+	for i := 1; i <= 17; i++ {
+		oid := append(append(asn1.ObjectIdentifier{}, oidSGXTCB...), i)
+		tcb = append(tcb, entry(oid, int(svn)))
+	}
+	tcb = append(tcb, entry(append(append(asn1.ObjectIdentifier{}, oidSGXTCB...), 18), make([]byte, 16)))
+	tcbDER, err := asn1.Marshal(tcb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal([]sgxExtensionEntry{
+		entry(append(append(asn1.ObjectIdentifier{}, oidSGXExtensions...), 1), make([]byte, 16)),
+		{ID: oidSGXTCB, Value: asn1.RawValue{FullBytes: tcbDER}},
+		entry(oidSGXPCEID, []byte{0, 0}),
+		entry(oidSGXFMSPC, fmspc),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func signRaw(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig
+}
+
+// writeCollateral writes a complete collateral directory for the test PKI.
+func (p *testPKI) writeCollateral(t *testing.T, dir string, fmspc []byte, levels, qeLevels []testTCBLevel, revokePCK bool, pck *x509.Certificate) {
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(CollateralRootCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.root.Raw}))
+	write(CollateralTCBSigningChainFile, append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.signer.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.root.Raw})...))
+
+	crl := func(issuer *x509.Certificate, key *ecdsa.PrivateKey, revoked []*x509.Certificate) []byte {
+		tmpl := &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: testTime.Add(-time.Hour),
+			NextUpdate: testTime.Add(30 * 24 * time.Hour),
+		}
+		for _, cert := range revoked {
+			tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries,
+				x509.RevocationListEntry{SerialNumber: cert.SerialNumber, RevocationTime: testTime.Add(-time.Hour)})
+		}
+		der, err := x509.CreateRevocationList(rand.Reader, tmpl, issuer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	write(CollateralRootCACRLFile, crl(p.root, p.rootKey, nil))
+	var revoked []*x509.Certificate
+	if revokePCK {
+		revoked = append(revoked, pck)
+	}
+	write("pck_crl_platform.der", crl(p.ca, p.caKey, revoked))
+
+	var tcbLevels []map[string]interface{}
+	for _, level := range levels {
+		comps := make([]map[string]interface{}, 16)
+		for i := range comps {
+			comps[i] = map[string]interface{}{"svn": level.svn}
+		}
+		tcbLevels = append(tcbLevels, map[string]interface{}{
+			"tcb":       map[string]interface{}{"sgxtcbcomponents": comps, "pcesvn": level.svn},
+			"tcbDate":   "2025-01-01T00:00:00Z",
+			"tcbStatus": level.status,
+		})
+	}
+	write("tcb_info_"+hex.EncodeToString(fmspc)+".json", p.signDocument(t, "tcbInfo", map[string]interface{}{
+		"id":         "SGX",
+		"version":    3,
+		"issueDate":  testTime.Add(-time.Hour),
+		"nextUpdate": testTime.Add(30 * 24 * time.Hour),
+		"fmspc":      strings.ToUpper(hex.EncodeToString(fmspc)),
+		"pceId":      "0000",
+		"tcbLevels":  tcbLevels,
+	}))
+
+	var qeTCBLevels []map[string]interface{}
+	for _, level := range qeLevels {
+		qeTCBLevels = append(qeTCBLevels, map[string]interface{}{
+			"tcb":       map[string]interface{}{"isvsvn": level.svn},
+			"tcbStatus": level.status,
+		})
+	}
+	write(CollateralQEIdentityFile, p.signDocument(t, "enclaveIdentity", map[string]interface{}{
+		"id":             "QE",
+		"version":        2,
+		"issueDate":      testTime.Add(-time.Hour),
+		"nextUpdate":     testTime.Add(30 * 24 * time.Hour),
+		"miscselect":     "00000000",
+		"miscselectMask": "FFFFFFFF",
+		"attributes":     "11000000000000000000000000000000",
+		"attributesMask": "FBFFFFFFFFFFFFFF0000000000000000",
+		"mrsigner":       hex.EncodeToString(testQEMRSigner),
+		"isvprodid":      0,
+		"tcbLevels":      qeTCBLevels,
+	}))
+}
+
+// signDocument wraps body the way the Intel PCS does, signing the exact
+// serialized bytes of the body object.
+func (p *testPKI) signDocument(t *testing.T, field string, body interface{}) []byte {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := signRaw(t, p.signerKey, raw)
+	return []byte(fmt.Sprintf(`{"%s":%s,"signature":"%x"}`, field, raw, sig))
+}
@@ -0,0 +1,459 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package sgx
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// IntelSGXRootCAPEM is the Intel SGX Root CA certificate, the trust anchor of
+// every PCK certificate chain. SHA-256 fingerprint:
+// 44a0196b2b99f889b8e149e95b807a350e7424964399e885a7cbb8ccfab674d3.
+const IntelSGXRootCAPEM = `-----BEGIN CERTIFICATE-----
+MIICjzCCAjSgAwIBAgIUImUM1lqdNInzg7SVUr9QGzknBqwwCgYIKoZIzj0EAwIw
+aDEaMBgGA1UEAwwRSW50ZWwgU0dYIFJvb3QgQ0ExGjAYBgNVBAoMEUludGVsIENv
+cnBvcmF0aW9uMRQwEgYDVQQHDAtTYW50YSBDbGFyYTELMAkGA1UECAwCQ0ExCzAJ
+BgNVBAYTAlVTMB4XDTE4MDUyMTEwNDUxMFoXDTQ5MTIzMTIzNTk1OVowaDEaMBgG
+A1UEAwwRSW50ZWwgU0dYIFJvb3QgQ0ExGjAYBgNVBAoMEUludGVsIENvcnBvcmF0
+aW9uMRQwEgYDVQQHDAtTYW50YSBDbGFyYTELMAkGA1UECAwCQ0ExCzAJBgNVBAYT
+AlVTMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEC6nEwMDIYZOj/iPWsCzaEKi7
+1OiOSLRFhWGjbnBVJfVnkY4u3IjkDYYL0MxO4mqsyYjlBalTVYxFP2sJBK5zlKOB
+uzCBuDAfBgNVHSMEGDAWgBQiZQzWWp00ifODtJVSv1AbOScGrDBSBgNVHR8ESzBJ
+MEegRaBDhkFodHRwczovL2NlcnRpZmljYXRlcy50cnVzdGVkc2VydmljZXMuaW50
+ZWwuY29tL0ludGVsU0dYUm9vdENBLmRlcjAdBgNVHQ4EFgQUImUM1lqdNInzg7SV
+Ur9QGzknBqwwDgYDVR0PAQH/BAQDAgEGMBIGA1UdEwEB/wQIMAYBAf8CAQEwCgYI
+KoZIzj0EAwIDSQAwRgIhAOW/5QkR+S9CiSDcNoowLuPRLsWGf/Yi7GSX94BgwTwg
+AiEA4J0lrHoMs+Xo5o/sX6O9QWxHRAvZUGOdRQ7cvqRXaqI=
+-----END CERTIFICATE-----
+`
+
+// intelSGXRootCA is the parsed form of IntelSGXRootCAPEM.
+var intelSGXRootCA = func() *x509.Certificate {
+	certs, err := parseCertificates([]byte(IntelSGXRootCAPEM))
+	if err != nil {
+		panic(fmt.Sprintf("invalid Intel SGX root CA: %v", err))
+	}
+	return certs[0]
+}()
+
+// tcbSigningCommonName is the subject common name of the Intel SGX TCB
+// Signing certificate, the only certificate allowed to sign TCB Info and QE
+// Identity collateral.
+const tcbSigningCommonName = "Intel SGX TCB Signing"
+
+// OIDs of the Intel SGX extension carried by PCK certificates.
+var (
+	oidSGXExtensions = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1}
+	oidSGXTCB        = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 2}
+	oidSGXPCEID      = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 3}
+	oidSGXFMSPC      = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 13, 1, 4}
+)
+
+// pckExtensions holds the platform identity and TCB read from a PCK certificate.
+type pckExtensions struct {
+	fmspc []byte
+	pceID []byte
+	tcb   tcbComponents
+}
+
+type sgxExtensionEntry struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// parsePCKExtensions extracts FMSPC, PCE-ID and the TCB SVNs from the SGX
+// extension of a PCK certificate.
+func parsePCKExtensions(cert *x509.Certificate) (*pckExtensions, error) {
+	var raw []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSGXExtensions) {
+			raw = ext.Value
+			break
+		}
+	}
+	if raw == nil {
+		return nil, errors.New("PCK certificate has no SGX extension")
+	}
+	var entries []sgxExtensionEntry
+	if _, err := asn1.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("invalid SGX extension: %w", err)
+	}
+	ext := new(pckExtensions)
+	for _, entry := range entries {
+		switch {
+		case entry.ID.Equal(oidSGXFMSPC):
+			ext.fmspc = entry.Value.Bytes
+		case entry.ID.Equal(oidSGXPCEID):
+			ext.pceID = entry.Value.Bytes
+		case entry.ID.Equal(oidSGXTCB):
+			var comps []sgxExtensionEntry
+			if _, err := asn1.Unmarshal(entry.Value.FullBytes, &comps); err != nil {
+				return nil, fmt.Errorf("invalid SGX TCB extension: %w", err)
+			}
+			for _, comp := range comps {
+				if len(comp.ID) != len(oidSGXTCB)+1 {
+					continue
+				}
+				arc := comp.ID[len(comp.ID)-1]
+				if arc < 1 || arc > 17 {
+					continue // CPUSVN as a whole is not needed for TCB evaluation
+				}
+				var svn int
+				if _, err := asn1.Unmarshal(comp.Value.FullBytes, &svn); err != nil {
+					return nil, fmt.Errorf("invalid SGX TCB component %d: %w", arc, err)
+				}
+				if arc == 17 {
+					ext.tcb.PCESVN = uint16(svn)
+				} else {
+					ext.tcb.SVNs[arc-1] = uint8(svn)
+				}
+			}
+		}
+	}
+	if len(ext.fmspc) != 6 || len(ext.pceID) != 2 {
+		return nil, errors.New("PCK certificate SGX extension misses FMSPC or PCE-ID")
+	}
+	return ext, nil
+}
+
+// verifyECDSAQuote performs full DCAP verification of a version 3 ECDSA quote:
+//
+//  1. the PCK certificate chain up to the trusted root, including CRLs,
+//  2. the QE report signature by the PCK key,
+//  3. the binding of the attestation key into the QE report data,
+//  4. the ISV enclave report signature by the attestation key,
+//  5. the QE identity and the platform TCB level against the collateral.
+//
+// Without TCB info or without the QE identity the quote is still authenticated
+// up to the root CA, but no TCB level is evaluated and TCBUnknown is returned.
+func verifyECDSAQuote(raw []byte, root *x509.Certificate, col *Collateral, now time.Time) (uint8, error) {
+	q, err := parseECDSAQuote(raw)
+	if err != nil {
+		return 0, err
+	}
+	if q.certDataType != certDataTypePCKChain {
+		return 0, fmt.Errorf("unsupported certification data type: %d", q.certDataType)
+	}
+	if col != nil && col.RootCA != nil {
+		root = col.RootCA
+	}
+	chain, err := parseCertificates(q.certData)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PCK certificate chain: %w", err)
+	}
+	pck, err := verifyCertChain(chain, root, now)
+	if err != nil {
+		return 0, fmt.Errorf("PCK certificate chain: %w", err)
+	}
+	if col != nil {
+		if err := checkRevocation(col, pck, now); err != nil {
+			return 0, err
+		}
+	}
+
+	// The QE report is signed by the PCK key.
+	pckKey, ok := pck[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || pckKey.Curve != elliptic.P256() {
+		return 0, errors.New("PCK certificate key is not ECDSA P-256")
+	}
+	if !verifyRawECDSA(pckKey, q.qeReport, q.qeReportSig) {
+		return 0, errors.New("invalid QE report signature")
+	}
+	// The QE report data commits to the attestation key and QE auth data.
+	binding := sha256.Sum256(append(append([]byte{}, q.attestKey...), q.qeAuthData...))
+	qeReportData := q.qeReport[reportDataOffset : reportDataOffset+64]
+	if !bytes.Equal(qeReportData[:32], binding[:]) || !bytes.Equal(qeReportData[32:], make([]byte, 32)) {
+		return 0, errors.New("attestation key is not bound to the QE report")
+	}
+	// The enclave report is signed by the attestation key.
+	attestKey, err := rawP256PublicKey(q.attestKey)
+	if err != nil {
+		return 0, fmt.Errorf("invalid attestation key: %w", err)
+	}
+	if !verifyRawECDSA(attestKey, q.signed, q.isvSignature) {
+		return 0, errors.New("invalid enclave report signature")
+	}
+
+	// Both halves of the TCB evaluation are needed, one alone is not up to date.
+	if col == nil || len(col.TCBInfos) == 0 || col.QEIdentity == nil {
+		return TCBUnknown, nil
+	}
+	signer, err := verifyCertChain(col.TCBSigningChain, root, now)
+	if err != nil {
+		return 0, fmt.Errorf("TCB signing chain: %w", err)
+	}
+	if col.RootCACRL != nil && len(signer) > 0 && isRevoked(col.RootCACRL, signer[0]) {
+		return 0, errors.New("TCB signing certificate revoked")
+	}
+	if err := checkTCBSigner(signer[0]); err != nil {
+		return 0, err
+	}
+	signerKey, ok := signer[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return 0, errors.New("TCB signing key is not ECDSA")
+	}
+	qeStatus, err := evaluateQEIdentity(col.QEIdentity, signerKey, q, now)
+	if err != nil {
+		return 0, err
+	}
+	ext, err := parsePCKExtensions(pck[0])
+	if err != nil {
+		return 0, err
+	}
+	info := col.TCBInfos[hex.EncodeToString(ext.fmspc)]
+	if info == nil {
+		return 0, fmt.Errorf("no TCB info for FMSPC %x", ext.fmspc)
+	}
+	platformStatus, err := evaluateTCBInfo(info, signerKey, ext, now)
+	if err != nil {
+		return 0, err
+	}
+	return convergeTCBStatus(platformStatus, qeStatus), nil
+}
+
+// checkTCBSigner ensures that TCB Info and QE Identity are signed by the
+// dedicated TCB signing certificate, not by any other certificate chaining to
+// the root such as a PCK certificate.
+func checkTCBSigner(cert *x509.Certificate) error {
+	if cert.Subject.CommonName != tcbSigningCommonName {
+		return fmt.Errorf("TCB signer %q is not the TCB signing certificate", cert.Subject.CommonName)
+	}
+	if cert.IsCA {
+		return errors.New("TCB signing certificate is a CA")
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSGXExtensions) {
+			return errors.New("TCB signing certificate carries PCK extensions")
+		}
+	}
+	return nil
+}
+
+// verifyCertChain verifies a leaf-first certificate chain against the trust
+// anchor and returns the verified chain, leaf first and root last.
+func verifyCertChain(chain []*x509.Certificate, root *x509.Certificate, now time.Time) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	verified, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return verified[0], nil
+}
+
+// checkRevocation checks a verified PCK chain (leaf, intermediate, root)
+// against the CRLs in the collateral.
+func checkRevocation(col *Collateral, chain []*x509.Certificate, now time.Time) error {
+	if len(chain) < 2 {
+		return errors.New("PCK chain has no issuing CA")
+	}
+	pck, ca, root := chain[0], chain[1], chain[len(chain)-1]
+	if col.RootCACRL != nil {
+		if err := checkCRL(col.RootCACRL, root, now); err != nil {
+			return fmt.Errorf("root CA CRL: %w", err)
+		}
+		if isRevoked(col.RootCACRL, ca) {
+			return errors.New("PCK issuing CA certificate revoked")
+		}
+	}
+	if len(col.PCKCRLs) == 0 {
+		return nil
+	}
+	for _, crl := range col.PCKCRLs {
+		if !bytes.Equal(crl.RawIssuer, pck.RawIssuer) {
+			continue
+		}
+		if err := checkCRL(crl, ca, now); err != nil {
+			return fmt.Errorf("PCK CRL: %w", err)
+		}
+		if isRevoked(crl, pck) {
+			return errors.New("PCK certificate revoked")
+		}
+		return nil
+	}
+	return fmt.Errorf("no PCK CRL for issuer %q", ca.Subject.CommonName)
+}
+
+// checkCRL verifies the CRL signature and its validity window.
+func checkCRL(crl *x509.RevocationList, issuer *x509.Certificate, now time.Time) error {
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return err
+	}
+	if now.Before(crl.ThisUpdate) || (!crl.NextUpdate.IsZero() && now.After(crl.NextUpdate)) {
+		return errors.New("CRL expired or not yet valid")
+	}
+	return nil
+}
+
+func isRevoked(crl *x509.RevocationList, cert *x509.Certificate) bool {
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateQEIdentity checks the quoting enclave against the QE Identity and
+// returns the TCB status matching its ISV SVN.
+func evaluateQEIdentity(id *QEIdentity, signer *ecdsa.PublicKey, q *ecdsaQuote, now time.Time) (uint8, error) {
+	if !verifyRawECDSA(signer, id.raw, id.signature) {
+		return 0, errors.New("invalid QE identity signature")
+	}
+	body := &id.body
+	if now.Before(body.IssueDate) || now.After(body.NextUpdate) {
+		return 0, errors.New("QE identity expired or not yet valid")
+	}
+	mrsigner, err := hex.DecodeString(body.MRSigner)
+	if err != nil || !bytes.Equal(mrsigner, q.qeReport[reportMRSignerOffset:reportMRSignerOffset+32]) {
+		return 0, errors.New("quoting enclave MRSIGNER mismatch")
+	}
+	if q.qeISVProdID() != body.ISVProdID {
+		return 0, errors.New("quoting enclave ISVPRODID mismatch")
+	}
+	misc, err1 := hex.DecodeString(body.MiscSelect)
+	miscMask, err2 := hex.DecodeString(body.MiscSelectMask)
+	if err1 != nil || err2 != nil || len(misc) != 4 || len(miscMask) != 4 {
+		return 0, errors.New("invalid QE identity MISCSELECT")
+	}
+	reportMisc := binary.LittleEndian.Uint32(q.qeReport[reportMiscSelectOffset : reportMiscSelectOffset+4])
+	mask := binary.BigEndian.Uint32(miscMask)
+	if reportMisc&mask != binary.BigEndian.Uint32(misc)&mask {
+		return 0, errors.New("quoting enclave MISCSELECT mismatch")
+	}
+	attrs, err1 := hex.DecodeString(body.Attributes)
+	attrsMask, err2 := hex.DecodeString(body.AttributesMask)
+	if err1 != nil || err2 != nil || len(attrs) != 16 || len(attrsMask) != 16 {
+		return 0, errors.New("invalid QE identity ATTRIBUTES")
+	}
+	reportAttrs := q.qeReport[reportAttributesOffset : reportAttributesOffset+16]
+	for i := range attrs {
+		if reportAttrs[i]&attrsMask[i] != attrs[i]&attrsMask[i] {
+			return 0, errors.New("quoting enclave ATTRIBUTES mismatch")
+		}
+	}
+	isvsvn := q.qeISVSVN()
+	for _, level := range body.TCBLevels {
+		if isvsvn >= level.TCB.ISVSVN {
+			return parseTCBStatus(level.TCBStatus)
+		}
+	}
+	return 0, fmt.Errorf("quoting enclave ISVSVN %d below all TCB levels", isvsvn)
+}
+
+// evaluateTCBInfo returns the status of the first TCB level, in the order
+// listed by Intel, that the platform TCB from the PCK certificate meets.
+func evaluateTCBInfo(info *TCBInfo, signer *ecdsa.PublicKey, ext *pckExtensions, now time.Time) (uint8, error) {
+	if !verifyRawECDSA(signer, info.raw, info.signature) {
+		return 0, errors.New("invalid TCB info signature")
+	}
+	body := &info.body
+	if body.ID != "" && body.ID != "SGX" {
+		return 0, fmt.Errorf("unexpected TCB info id %q", body.ID)
+	}
+	if now.Before(body.IssueDate) || now.After(body.NextUpdate) {
+		return 0, errors.New("TCB info expired or not yet valid")
+	}
+	if !strings.EqualFold(body.PCEID, hex.EncodeToString(ext.pceID)) {
+		return 0, errors.New("TCB info PCE-ID mismatch")
+	}
+	for _, level := range body.TCBLevels {
+		if ext.tcb.meets(&level.TCB) {
+			return parseTCBStatus(level.TCBStatus)
+		}
+	}
+	return 0, errors.New("platform TCB below all TCB levels")
+}
+
+// meets reports whether every SVN of c is at least the one of the level.
+func (c *tcbComponents) meets(level *tcbComponents) bool {
+	for i := range c.SVNs {
+		if c.SVNs[i] < level.SVNs[i] {
+			return false
+		}
+	}
+	return c.PCESVN >= level.PCESVN
+}
+
+// convergeTCBStatus combines the platform and quoting enclave TCB statuses
+// the same way the Intel quote verification library does.
+func convergeTCBStatus(platform, qe uint8) uint8 {
+	switch qe {
+	case TCBRevoked:
+		return TCBRevoked
+	case TCBOutOfDate:
+		switch platform {
+		case TCBUpToDate, TCBSWHardeningNeeded:
+			return TCBOutOfDate
+		case TCBConfigurationNeeded, TCBConfigurationAndSWHardeningNeeded:
+			return TCBOutOfDateConfigurationNeeded
+		}
+	}
+	return platform
+}
+
+// verifyRawECDSA verifies a 64 byte r||s ECDSA signature over SHA-256(data).
+func verifyRawECDSA(pub *ecdsa.PublicKey, data, sig []byte) bool {
+	if len(sig) != quoteECDSASigSize {
+		return false
+	}
+	digest := sha256.Sum256(data)
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(pub, digest[:], r, s)
+}
+
+// rawP256PublicKey decodes a 64 byte X||Y P-256 public key.
+func rawP256PublicKey(raw []byte) (*ecdsa.PublicKey, error) {
+	if len(raw) != 64 {
+		return nil, fmt.Errorf("invalid length %d", len(raw))
+	}
+	// crypto/ecdh rejects points that are not on the curve.
+	if _, err := ecdh.P256().NewPublicKey(append([]byte{0x04}, raw...)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(raw[:32]),
+		Y:     new(big.Int).SetBytes(raw[32:]),
+	}, nil
+}
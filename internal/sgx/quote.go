@@ -41,6 +41,14 @@ const (
 	TCBOutOfDate           uint8 = 0x01
 	TCBRevoked             uint8 = 0x02
 	TCBConfigurationNeeded uint8 = 0x03
+
+	TCBSWHardeningNeeded                 uint8 = 0x04
+	TCBConfigurationAndSWHardeningNeeded uint8 = 0x05
+	TCBOutOfDateConfigurationNeeded      uint8 = 0x06
+
+	// TCBUnknown is the status of quotes verified without TCB collateral,
+	// whose platform TCB level could not be evaluated
+	TCBUnknown uint8 = 0x07
 )
 
 // SGXQuoteOID is the OID for SGX Quote in X.509 certificates.
@@ -48,6 +48,10 @@ type Verifier interface {
 func NewGramineVerifier() (Verifier, error) {
 	// For now, use DCAPVerifier as the default implementation
 	// In production with RA-TLS CGO support, this would return GramineRATLSVerifier
-	return NewDCAPVerifier(1==1), nil
+	verifier, err := NewDCAPVerifierFromEnvironment(true)
+	if err != nil {
+		return nil, err
+	}
+	return verifier, nil
 }
 
@@ -15,6 +15,7 @@ func TestVerifyQuoteComplete(t *testing.T) {
 	defer os.Unsetenv("XCHAIN_SGX_MODE")
 
 verifier := NewDCAPVerifier(true) // mockMode=true
+verifier.SetAllowUnknownTCB(true)
 
 // Generate a mock quote
 attestor, err := NewGramineAttestor()
@@ -162,6 +163,7 @@ func TestVerifyQuoteCompleteInputFormats(t *testing.T) {
 	defer os.Unsetenv("XCHAIN_SGX_MODE")
 
 verifier := NewDCAPVerifier(true)
+verifier.SetAllowUnknownTCB(true)
 attestor, err := NewGramineAttestor()
 if err != nil {
 t.Fatalf("Failed to create attestor: %v", err)
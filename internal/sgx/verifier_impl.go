@@ -23,58 +23,145 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/binary"
-	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // DCAPVerifier implements the Verifier interface using Intel DCAP.
+// Quotes are verified in pure Go against a pinned root CA and, optionally,
+// collateral loaded from a local directory, so verification runs offline.
 type DCAPVerifier struct {
 	mu               sync.RWMutex
 	allowedMREnclave map[string]bool
 	allowedMRSigner  map[string]bool
 	allowOutdatedTCB bool
+	allowUnknownTCB  bool // accept quotes verified without TCB collateral
+
+	rootCA     *x509.Certificate // trust anchor of the PCK certificate chain
+	collateral *Collateral       // CRLs, TCB info and QE identity, may be nil
+	now        func() time.Time  // clock for certificate and collateral validity
 }
 
-// NewDCAPVerifier creates a new DCAP-based verifier.
+// NewDCAPVerifier creates a new DCAP-based verifier trusting the Intel SGX
+// Root CA, without any collateral.
 func NewDCAPVerifier(allowOutdatedTCB bool) *DCAPVerifier {
 	return &DCAPVerifier{
 		allowedMREnclave: make(map[string]bool),
 		allowedMRSigner:  make(map[string]bool),
 		allowOutdatedTCB: allowOutdatedTCB,
+		rootCA:           intelSGXRootCA,
+		now:              time.Now,
 	}
 }
 
+// NewDCAPVerifierWithCollateral creates a DCAP verifier that additionally
+// checks CRLs and evaluates TCB levels using the collateral in dir.
+func NewDCAPVerifierWithCollateral(allowOutdatedTCB bool, dir string) (*DCAPVerifier, error) {
+	collateral, err := LoadCollateral(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load collateral: %w", err)
+	}
+	v := NewDCAPVerifier(allowOutdatedTCB)
+	v.SetCollateral(collateral)
+	return v, nil
+}
+
+// NewDCAPVerifierFromEnvironment creates the DCAP verifier of a node with the
+// collateral in the SGX_COLLATERAL_DIR directory. Collateral is required
+// outside test mode (see TestMode); in test mode a verifier without
+// collateral accepts quotes of unknown TCB level.
+func NewDCAPVerifierFromEnvironment(allowOutdatedTCB bool) (*DCAPVerifier, error) {
+	if dir := os.Getenv(collateralDirEnv); dir != "" {
+		return NewDCAPVerifierWithCollateral(allowOutdatedTCB, dir)
+	}
+	if !TestMode() {
+		return nil, fmt.Errorf("%s not set: DCAP collateral is required to evaluate TCB levels", collateralDirEnv)
+	}
+	v := NewDCAPVerifier(allowOutdatedTCB)
+	v.SetAllowUnknownTCB(true)
+	return v, nil
+}
+
+// SetRootCA replaces the trust anchor of the PCK certificate chain.
+func (v *DCAPVerifier) SetRootCA(root *x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rootCA = root
+}
+
+// SetAllowUnknownTCB sets whether quotes are accepted whose TCB level cannot
+// be evaluated for lack of collateral. Outdated TCB levels are not accepted
+// by this, only unknown ones; it is meant for test and development setups.
+func (v *DCAPVerifier) SetAllowUnknownTCB(allow bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.allowUnknownTCB = allow
+}
+
+// SetCollateral replaces the collateral used for CRL and TCB checks.
+func (v *DCAPVerifier) SetCollateral(collateral *Collateral) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.collateral = collateral
+}
+
 // VerifyQuote verifies the validity of an SGX Quote.
 // This method only verifies the Quote's cryptographic signature and TCB status.
 // It does NOT check MRENCLAVE/MRSIGNER against whitelist - that's only for RA-TLS certificate verification.
 func (v *DCAPVerifier) VerifyQuote(quote []byte) error {
+	v.mu.RLock()
+	now := v.now
+	v.mu.RUnlock()
+
+	_, err := v.verifyQuote(quote, now())
+	return err
+}
+
+// verifyQuote verifies the quote with certificate and collateral validity
+// evaluated at the given time, and returns its TCB status.
+func (v *DCAPVerifier) verifyQuote(quote []byte, at time.Time) (uint8, error) {
 	// Parse the quote
 	parsedQuote, err := ParseQuote(quote)
 	if err != nil {
-		return fmt.Errorf("failed to parse quote: %w", err)
+		return 0, fmt.Errorf("failed to parse quote: %w", err)
 	}
 
-	// Verify quote signature (in a real implementation, this would call DCAP libraries)
-	if err := v.verifyQuoteSignature(quote); err != nil {
-		return fmt.Errorf("quote signature verification failed: %w", err)
+	// Verify quote signature, certificate chain and TCB level
+	status, err := v.verifyQuoteSignature(quote, at)
+	if err != nil {
+		return 0, fmt.Errorf("quote signature verification failed: %w", err)
 	}
+	parsedQuote.TCBStatus = status
 
 	// Check TCB status
+	if parsedQuote.TCBStatus == TCBRevoked {
+		return 0, errors.New("TCB status revoked")
+	}
+	v.mu.RLock()
+	allowUnknown := v.allowUnknownTCB
+	v.mu.RUnlock()
+	if parsedQuote.TCBStatus == TCBUnknown {
+		if !allowUnknown {
+			return 0, errors.New("TCB status unknown: TCB info or QE identity not configured")
+		}
+		return parsedQuote.TCBStatus, nil
+	}
 	if !v.allowOutdatedTCB && parsedQuote.TCBStatus != TCBUpToDate {
-		return fmt.Errorf("TCB status not up to date: %d", parsedQuote.TCBStatus)
+		return 0, fmt.Errorf("TCB status not up to date: %s", TCBStatusString(parsedQuote.TCBStatus))
 	}
 
 	// NO MRENCLAVE/MRSIGNER whitelist check here!
 	// Whitelist is only checked during RA-TLS certificate verification (VerifyCertificate method)
 
-	return nil
+	return parsedQuote.TCBStatus, nil
 }
 
 // VerifyCertificate verifies an RA-TLS certificate.
@@ -161,6 +248,34 @@ func (v *DCAPVerifier) IsAllowedMRSigner(mrsigner []byte) bool {
 	return v.allowedMRSigner[string(mrsigner)]
 }
 
+// AllowedMREnclaves returns the whitelisted MRENCLAVE values in sorted order.
+func (v *DCAPVerifier) AllowedMREnclaves() [][]byte {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return sortedKeys(v.allowedMREnclave)
+}
+
+// AllowedMRSigners returns the whitelisted MRSIGNER values in sorted order.
+func (v *DCAPVerifier) AllowedMRSigners() [][]byte {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return sortedKeys(v.allowedMRSigner)
+}
+
+func sortedKeys(set map[string]bool) [][]byte {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = []byte(key)
+	}
+	return values
+}
+
 // AddAllowedMREnclave adds an MRENCLAVE to the whitelist.
 func (v *DCAPVerifier) AddAllowedMREnclave(mrenclave []byte) {
 	v.mu.Lock()
@@ -189,23 +304,21 @@ func (v *DCAPVerifier) RemoveAllowedMRSigner(mrsigner []byte) {
 	delete(v.allowedMRSigner, string(mrsigner))
 }
 
-// verifyQuoteSignature verifies the quote signature.
-// In a real implementation, this would call Intel DCAP libraries via CGO.
-// For now, we provide a mock implementation for testing.
-func (v *DCAPVerifier) verifyQuoteSignature(quote []byte) error {
-	// Mock implementation: just check minimum length
+// verifyQuoteSignature verifies the quote signature chain: the enclave report
+// signature, the attestation key binding, the QE report signature and the PCK
+// certificate chain up to the root CA. It returns the TCB status evaluated
+// against the collateral, or TCBUnknown unless both TCB info and QE identity
+// are configured.
+// Certificates and collateral must be valid at the given time.
+func (v *DCAPVerifier) verifyQuoteSignature(quote []byte, at time.Time) (uint8, error) {
 	if len(quote) < 432 {
-		return errors.New("quote too short for signature verification")
+		return 0, errors.New("quote too short for signature verification")
 	}
+	v.mu.RLock()
+	root, collateral := v.rootCA, v.collateral
+	v.mu.RUnlock()
 
-	// In a real implementation, this would:
-	// 1. Call libsgx_dcap_ql to verify the quote signature
-	// 2. Check the quote against Intel's attestation service
-	// 3. Verify the certificate chain
-
-	// For testing purposes, we accept any quote that can be parsed
-	_, err := ParseQuote(quote)
-	return err
+	return verifyECDSAQuote(quote, root, collateral, at)
 }
 
 // ExtractMREnclave is a utility function to extract MRENCLAVE from a quote.
@@ -373,6 +486,11 @@ type QuoteMeasurements struct {
 // Options can include:
 // - apiKey: Intel SGX API key (if not set, read from INTEL_SGX_API_KEY env var)
 // - cacheDir: Directory for caching certificates (default: /tmp/sgx-cert-cache)
+// - skipWhitelist: if true, measurements are not checked against the verifier's
+//   whitelist, for callers that check them against their own
+// - verifyTime: time.Time at which certificates and collateral must be valid
+//   (default: now), so that historical quotes verify against the time they
+//   were used at rather than the wall clock
 func (v *DCAPVerifier) VerifyQuoteComplete(input []byte, options map[string]interface{}) (*QuoteVerificationResult, error) {
 	result := &QuoteVerificationResult{
 		Verified: false,
@@ -448,18 +566,25 @@ func (v *DCAPVerifier) VerifyQuoteComplete(input []byte, options map[string]inte
 		result.Measurements.PlatformInstanceIDSource = "error: " + err.Error()
 	}
 
-	// Perform basic validation
-	err = v.VerifyQuote(quote)
+	// Perform full DCAP validation
+	v.mu.RLock()
+	at := v.now()
+	v.mu.RUnlock()
+	if t, ok := options["verifyTime"].(time.Time); ok {
+		at = t
+	}
+	status, err := v.verifyQuote(quote, at)
 	if err == nil {
 		result.Verified = true
-		result.TCBStatus = "OK"
+		result.TCBStatus = TCBStatusString(status)
 	} else {
 		result.Error = err
 		result.TCBStatus = "INVALID"
 	}
 
 	// Verify against whitelist if configured
-	if result.Verified {
+	skipWhitelist, _ := options["skipWhitelist"].(bool)
+	if result.Verified && !skipWhitelist {
 		if err := v.verifyMeasurementsWhitelist(result.Measurements); err != nil {
 			result.Verified = false
 			result.Error = err
@@ -901,17 +1026,15 @@ func (v *DCAPVerifier) verifyMeasurementsWhitelist(measurements QuoteMeasurement
 
 	// Check MRENCLAVE whitelist
 	if len(v.allowedMREnclave) > 0 {
-		mrEnclaveHex := hex.EncodeToString(measurements.MrEnclave)
-		if !v.allowedMREnclave[mrEnclaveHex] {
-			return fmt.Errorf("MRENCLAVE %s not in whitelist", mrEnclaveHex)
+		if !v.allowedMREnclave[string(measurements.MrEnclave)] {
+			return fmt.Errorf("MRENCLAVE %x not in whitelist", measurements.MrEnclave)
 		}
 	}
 
 	// Check MRSIGNER whitelist
 	if len(v.allowedMRSigner) > 0 {
-		mrSignerHex := hex.EncodeToString(measurements.MrSigner)
-		if !v.allowedMRSigner[mrSignerHex] {
-			return fmt.Errorf("MRSIGNER %s not in whitelist", mrSignerHex)
+		if !v.allowedMRSigner[string(measurements.MrSigner)] {
+			return fmt.Errorf("MRSIGNER %x not in whitelist", measurements.MrSigner)
 		}
 	}
 
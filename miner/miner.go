@@ -71,7 +71,8 @@ type Miner struct {
 	chainConfig *params.ChainConfig
 	engine      consensus.Engine
 	txpool      *txpool.TxPool
-	prio        []common.Address // A list of senders to prioritize
+	prio        []common.Address           // A list of senders to prioritize
+	shares      core.DecryptionShareSource // Decryption shares revealing the committed encrypted transactions
 	chain       *core.BlockChain
 	pending     *pending
 	pendingMu   sync.Mutex // Lock protects the pending block
@@ -111,6 +112,14 @@ func (miner *Miner) SetExtra(extra []byte) error {
 	return nil
 }
 
+// SetDecryptionShares sets the source of the decryption shares for revealing
+// the committed encrypted transactions of SGX networks.
+func (miner *Miner) SetDecryptionShares(source core.DecryptionShareSource) {
+	miner.confMu.Lock()
+	miner.shares = source
+	miner.confMu.Unlock()
+}
+
 // SetPrioAddresses sets a list of addresses to prioritize for transaction inclusion.
 func (miner *Miner) SetPrioAddresses(prio []common.Address) {
 	miner.confMu.Lock()
@@ -132,6 +132,8 @@ func (miner *Miner) generateWork(genParam *generateParams, witness bool) *newPay
 	work.size += uint64(genParam.withdrawals.Size())
 
 	if !genParam.noTxs {
+		miner.commitReveals(work)
+
 		interrupt := new(atomic.Int32)
 		timer := time.AfterFunc(miner.config.Recommit, func() {
 			interrupt.Store(commitInterruptTimeout)
@@ -194,6 +196,9 @@ func (miner *Miner) prepareWork(genParams *generateParams, witness bool) (*envir
 	miner.confMu.RLock()
 	defer miner.confMu.RUnlock()
 
+	if err := miner.chain.GetVMConfig().SGXKeyLayers.Ready(); err != nil {
+		return nil, err
+	}
 	// Find the parent block for sealing task
 	parent := miner.chain.CurrentBlock()
 	if genParams.parentHash != (common.Hash{}) {
@@ -255,7 +260,12 @@ func (miner *Miner) prepareWork(genParams *generateParams, witness bool) (*envir
 	// Could potentially happen if starting to mine in an odd state.
 	// Note genParams.coinbase can be different with header.Coinbase
 	// since clique algorithm can modify the coinbase field in header.
-	env, err := miner.makeEnv(parent, header, genParams.coinbase, witness)
+	// SGX chains collect the fees in the coinbase set by the engine.
+	coinbase := genParams.coinbase
+	if miner.chainConfig.SGX != nil {
+		coinbase = header.Coinbase
+	}
+	env, err := miner.makeEnv(parent, header, coinbase, witness)
 	if err != nil {
 		log.Error("Failed to create sealing context", "err", err)
 		return nil, err
@@ -291,10 +301,22 @@ func (miner *Miner) makeEnv(parent *types.Header, header *types.Header, coinbase
 		coinbase: coinbase,
 		header:   header,
 		witness:  state.Witness(),
-		evm:      vm.NewEVM(core.NewEVMBlockContext(header, miner.chain, &coinbase), state, miner.chainConfig, vm.Config{}),
+		evm:      vm.NewEVM(core.NewEVMBlockContext(header, miner.chain, &coinbase), state, miner.chainConfig, miner.vmConfig(header.ParentHash)),
 	}, nil
 }
 
+// vmConfig returns the EVM configuration for building on top of the parent
+// block. The SGX precompiles see the key store of the chain at the parent, so
+// sealed blocks execute as they do on import, but their changes stay in
+// memory and are dropped with the built block.
+func (miner *Miner) vmConfig(parent common.Hash) vm.Config {
+	config := miner.chain.GetVMConfig()
+	return vm.Config{
+		SGXKeyStore:  config.SGXKeyStore,
+		SGXKeyLayers: config.SGXKeyLayers,
+	}.WithSGXKeys(parent)
+}
+
 func (miner *Miner) commitTransaction(env *environment, tx *types.Transaction) error {
 	if tx.Type() == types.BlobTxType {
 		return miner.commitBlobTransaction(env, tx)
@@ -310,6 +332,33 @@ func (miner *Miner) commitTransaction(env *environment, tx *types.Transaction) e
 	return nil
 }
 
+// commitReveals includes the reveals of the encrypted transactions committed
+// in earlier blocks, ahead of all other transactions.
+func (miner *Miner) commitReveals(env *environment) {
+	if !miner.chainConfig.IsSGXEncryptedTx(env.header.Number) {
+		return
+	}
+	miner.confMu.RLock()
+	source := miner.shares
+	miner.confMu.RUnlock()
+
+	parent := miner.chain.GetHeader(env.header.ParentHash, env.header.Number.Uint64()-1)
+	if parent == nil {
+		return
+	}
+	reveals := core.EncryptedTxReveals(miner.chainConfig, miner.chain, parent, env.state, source)
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	for _, tx := range reveals {
+		env.state.SetTxContext(tx.Hash(), env.tcount)
+		if err := miner.commitTransaction(env, tx); err != nil {
+			log.Warn("Failed to reveal encrypted transaction", "hash", tx.Hash(), "err", err)
+			return
+		}
+	}
+}
+
 func (miner *Miner) commitBlobTransaction(env *environment, tx *types.Transaction) error {
 	sc := tx.BlobTxSidecar()
 	if sc == nil {
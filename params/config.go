@@ -23,6 +23,7 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/params/forks"
 )
 
@@ -453,6 +454,12 @@ type ChainConfig struct {
 	ArrowGlacierBlock   *big.Int `json:"arrowGlacierBlock,omitempty"`   // Eip-4345 (bomb delay) switch block (nil = no fork, 0 = already activated)
 	GrayGlacierBlock    *big.Int `json:"grayGlacierBlock,omitempty"`    // Eip-5133 (bomb delay) switch block (nil = no fork, 0 = already activated)
 	MergeNetsplitBlock  *big.Int `json:"mergeNetsplitBlock,omitempty"`  // Virtual fork after The Merge to use as a network splitter
+	SGXGasBlock         *big.Int `json:"sgxGasBlock,omitempty"`         // SGX precompile gas schedule switch block (nil = no fork, 0 = already activated)
+	SGXEncryptedTxBlock *big.Int `json:"sgxEncryptedTxBlock,omitempty"` // SGX encrypted transactions switch block (nil = no fork, 0 = already activated)
+	SGXKeyVersionBlock  *big.Int `json:"sgxKeyVersionBlock,omitempty"`  // SGX key versions anchored in state switch block (nil = no fork, 0 = already activated)
+	SGXKeyTypesBlock    *big.Int `json:"sgxKeyTypesBlock,omitempty"`    // SGX key-type-tagged precompiles switch block, implies the SGX gas schedule (nil = no fork, 0 = already activated)
+	SGXGovernanceBlock  *big.Int `json:"sgxGovernanceBlock,omitempty"`  // Native governance and security config contracts switch block (nil = no fork, 0 = already activated)
+	SGXThresholdBlock   *big.Int `json:"sgxThresholdBlock,omitempty"`   // SGX threshold keys switch block, implies the SGX key types fork (nil = no fork, 0 = already activated)
 
 	// Fork scheduling was switched from blocks to timestamps here
 
@@ -515,11 +522,16 @@ func (c CliqueConfig) String() string {
 
 // SGXConfig is the consensus engine configs for SGX-based PoA sealing.
 type SGXConfig struct {
-	Period             uint64         `json:"period"`             // Number of seconds between blocks to enforce
-	Epoch              uint64         `json:"epoch"`              // Epoch length to reset votes and checkpoint
-	GovernanceContract common.Address `json:"governanceContract"` // Address of the governance contract
-	SecurityConfig     common.Address `json:"securityConfig"`     // Address of the security config contract
-	IncentiveContract  common.Address `json:"incentiveContract"`  // Address of the incentive contract
+	Period             uint64         `json:"period"`                      // Number of seconds between blocks to enforce
+	Epoch              uint64         `json:"epoch"`                       // Epoch length to reset votes and checkpoint
+	GovernanceContract common.Address `json:"governanceContract"`          // Address of the governance contract
+	SecurityConfig     common.Address `json:"securityConfig"`              // Address of the security config contract
+	IncentiveContract  common.Address `json:"incentiveContract"`           // Address of the incentive contract
+	HeartbeatInterval  uint64         `json:"heartbeatInterval,omitempty"` // Seconds between node heartbeats (0 = default)
+	MasterSecretHash   common.Hash    `json:"masterSecretHash,omitempty"`  // Commitment to the network master secret of the SGX key store
+	TransactionKey     hexutil.Bytes  `json:"transactionKey,omitempty"`    // Threshold parameters of the key encrypted transactions are encrypted to
+	AllowAnyMREnclave  bool           `json:"allowAnyMREnclave,omitempty"` // Accept any MRENCLAVE while the whitelist lists none, instead of none
+	AllowAnyMRSigner   bool           `json:"allowAnyMRSigner,omitempty"`  // Accept any MRSIGNER while the whitelist lists none, instead of none
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -578,6 +590,24 @@ func (c *ChainConfig) String() string {
 	if c.MergeNetsplitBlock != nil {
 		result += fmt.Sprintf(", MergeNetsplitBlock: %v", c.MergeNetsplitBlock)
 	}
+	if c.SGXGasBlock != nil {
+		result += fmt.Sprintf(", SGXGasBlock: %v", c.SGXGasBlock)
+	}
+	if c.SGXEncryptedTxBlock != nil {
+		result += fmt.Sprintf(", SGXEncryptedTxBlock: %v", c.SGXEncryptedTxBlock)
+	}
+	if c.SGXKeyVersionBlock != nil {
+		result += fmt.Sprintf(", SGXKeyVersionBlock: %v", c.SGXKeyVersionBlock)
+	}
+	if c.SGXKeyTypesBlock != nil {
+		result += fmt.Sprintf(", SGXKeyTypesBlock: %v", c.SGXKeyTypesBlock)
+	}
+	if c.SGXGovernanceBlock != nil {
+		result += fmt.Sprintf(", SGXGovernanceBlock: %v", c.SGXGovernanceBlock)
+	}
+	if c.SGXThresholdBlock != nil {
+		result += fmt.Sprintf(", SGXThresholdBlock: %v", c.SGXThresholdBlock)
+	}
 
 	// Add timestamp-based forks
 	if c.ShanghaiTime != nil {
@@ -663,6 +693,24 @@ func (c *ChainConfig) Description() string {
 	if c.GrayGlacierBlock != nil {
 		banner += fmt.Sprintf(" - Gray Glacier:                #%-8v\n", c.GrayGlacierBlock)
 	}
+	if c.SGXGasBlock != nil {
+		banner += fmt.Sprintf(" - SGX gas schedule:            #%-8v\n", c.SGXGasBlock)
+	}
+	if c.SGXEncryptedTxBlock != nil {
+		banner += fmt.Sprintf(" - SGX encrypted transactions:  #%-8v\n", c.SGXEncryptedTxBlock)
+	}
+	if c.SGXKeyVersionBlock != nil {
+		banner += fmt.Sprintf(" - SGX key versions:            #%-8v\n", c.SGXKeyVersionBlock)
+	}
+	if c.SGXKeyTypesBlock != nil {
+		banner += fmt.Sprintf(" - SGX Ed25519 and P-256 keys:  #%-8v\n", c.SGXKeyTypesBlock)
+	}
+	if c.SGXGovernanceBlock != nil {
+		banner += fmt.Sprintf(" - SGX native governance:       #%-8v\n", c.SGXGovernanceBlock)
+	}
+	if c.SGXThresholdBlock != nil {
+		banner += fmt.Sprintf(" - SGX threshold keys:          #%-8v\n", c.SGXThresholdBlock)
+	}
 	banner += "\n"
 
 	// Add a special section for the merge as it's non-obvious
@@ -808,6 +856,42 @@ func (c *ChainConfig) IsArrowGlacier(num *big.Int) bool {
 	return isBlockForked(c.ArrowGlacierBlock, num)
 }
 
+// IsSGXGas returns whether num is either equal to the SGX precompile gas
+// schedule fork block or greater.
+func (c *ChainConfig) IsSGXGas(num *big.Int) bool {
+	return c.SGX != nil && isBlockForked(c.SGXGasBlock, num)
+}
+
+// IsSGXEncryptedTx returns whether num is either equal to the SGX encrypted
+// transactions fork block or greater.
+func (c *ChainConfig) IsSGXEncryptedTx(num *big.Int) bool {
+	return c.SGX != nil && isBlockForked(c.SGXEncryptedTxBlock, num)
+}
+
+// IsSGXKeyVersion returns whether num is either equal to the fork block
+// anchoring SGX key versions in the state or greater.
+func (c *ChainConfig) IsSGXKeyVersion(num *big.Int) bool {
+	return c.SGX != nil && isBlockForked(c.SGXKeyVersionBlock, num)
+}
+
+// IsSGXKeyTypes returns whether num is either equal to the fork block of the
+// key-type-tagged SGX precompiles, adding Ed25519 and P-256 support, or greater.
+func (c *ChainConfig) IsSGXKeyTypes(num *big.Int) bool {
+	return c.SGX != nil && isBlockForked(c.SGXKeyTypesBlock, num)
+}
+
+// IsSGXGovernance returns whether num is either equal to the fork block of
+// the native governance and security config contracts or greater.
+func (c *ChainConfig) IsSGXGovernance(num *big.Int) bool {
+	return c.SGX != nil && isBlockForked(c.SGXGovernanceBlock, num)
+}
+
+// IsSGXThreshold returns whether num is either equal to the fork block of the
+// SGX threshold keys or greater.
+func (c *ChainConfig) IsSGXThreshold(num *big.Int) bool {
+	return c.SGX != nil && isBlockForked(c.SGXThresholdBlock, num)
+}
+
 // IsGrayGlacier returns whether num is either equal to the Gray Glacier (EIP-5133) fork block or greater.
 func (c *ChainConfig) IsGrayGlacier(num *big.Int) bool {
 	return isBlockForked(c.GrayGlacierBlock, num)
@@ -1107,6 +1191,24 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, headNumber *big.Int,
 	if isForkBlockIncompatible(c.MergeNetsplitBlock, newcfg.MergeNetsplitBlock, headNumber) {
 		return newBlockCompatError("Merge netsplit fork block", c.MergeNetsplitBlock, newcfg.MergeNetsplitBlock)
 	}
+	if isForkBlockIncompatible(c.SGXGasBlock, newcfg.SGXGasBlock, headNumber) {
+		return newBlockCompatError("SGX gas schedule fork block", c.SGXGasBlock, newcfg.SGXGasBlock)
+	}
+	if isForkBlockIncompatible(c.SGXEncryptedTxBlock, newcfg.SGXEncryptedTxBlock, headNumber) {
+		return newBlockCompatError("SGX encrypted transactions fork block", c.SGXEncryptedTxBlock, newcfg.SGXEncryptedTxBlock)
+	}
+	if isForkBlockIncompatible(c.SGXKeyVersionBlock, newcfg.SGXKeyVersionBlock, headNumber) {
+		return newBlockCompatError("SGX key versions fork block", c.SGXKeyVersionBlock, newcfg.SGXKeyVersionBlock)
+	}
+	if isForkBlockIncompatible(c.SGXKeyTypesBlock, newcfg.SGXKeyTypesBlock, headNumber) {
+		return newBlockCompatError("SGX key types fork block", c.SGXKeyTypesBlock, newcfg.SGXKeyTypesBlock)
+	}
+	if isForkBlockIncompatible(c.SGXGovernanceBlock, newcfg.SGXGovernanceBlock, headNumber) {
+		return newBlockCompatError("SGX governance fork block", c.SGXGovernanceBlock, newcfg.SGXGovernanceBlock)
+	}
+	if isForkBlockIncompatible(c.SGXThresholdBlock, newcfg.SGXThresholdBlock, headNumber) {
+		return newBlockCompatError("SGX threshold keys fork block", c.SGXThresholdBlock, newcfg.SGXThresholdBlock)
+	}
 	if isForkTimestampIncompatible(c.ShanghaiTime, newcfg.ShanghaiTime, headTimestamp) {
 		return newTimestampCompatError("Shanghai fork timestamp", c.ShanghaiTime, newcfg.ShanghaiTime)
 	}
@@ -1398,6 +1500,12 @@ type Rules struct {
 	IsMerge, IsShanghai, IsCancun, IsPrague, IsOsaka        bool
 	IsAmsterdam, IsVerkle                                   bool
 	IsSGX                                                   bool // SGX consensus enabled
+	IsSGXGas                                                bool // SGX precompile gas schedule active
+	IsSGXEncryptedTx                                        bool // SGX encrypted transactions accepted
+	IsSGXKeyVersion                                         bool // SGX key versions anchored in state
+	IsSGXKeyTypes                                           bool // SGX key-type-tagged precompiles active
+	IsSGXGovernance                                         bool // Native governance contracts active
+	IsSGXThreshold                                          bool // SGX threshold keys active
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -1431,5 +1539,11 @@ func (c *ChainConfig) Rules(num *big.Int, isMerge bool, timestamp uint64) Rules
 		IsVerkle:         isVerkle,
 		IsEIP4762:        isVerkle,
 		IsSGX:            c.SGX != nil, // SGX consensus is enabled if config exists
+		IsSGXGas:         c.IsSGXGas(num),
+		IsSGXEncryptedTx: c.IsSGXEncryptedTx(num),
+		IsSGXKeyVersion:  c.IsSGXKeyVersion(num),
+		IsSGXKeyTypes:    c.IsSGXKeyTypes(num),
+		IsSGXGovernance:  c.IsSGXGovernance(num),
+		IsSGXThreshold:   c.IsSGXThreshold(num),
 	}
 }
@@ -167,6 +167,43 @@ const (
 
 	P256VerifyGas uint64 = 6900 // secp256r1 elliptic curve signature verifier gas price
 
+	// Gas schedule of the SGX precompiles from the SGX gas fork block on, derived
+	// from BenchmarkPrecompiledSGX in core/vm at about the throughput of
+	// ecrecover. Operations on stored keys include reading and decrypting the key
+	// from the encrypted partition, precompiles writing state include the new
+	// storage slots.
+	SGXKeyCreateGas            uint64 = 100000 // Price for creating and storing a key and granting its owner
+	SGXThresholdKeyCreateGas   uint64 = 60000  // Base price for registering a threshold key
+	SGXThresholdCommitmentGas  uint64 = 40000  // Per-commitment price for registering a threshold key
+	SGXKeyGetPublicGas         uint64 = 10000  // Price for loading a public key
+	SGXSignGas                 uint64 = 25000  // Price for signing with a stored key or requesting a threshold signature
+	SGXSignPartialGas          uint64 = 30000  // Per-partial-signature price for combining a threshold signature
+	SGXVerifyGas               uint64 = 4000   // Price for verifying an ECDSA or Ed25519 signature
+	SGXVerifyThresholdGas      uint64 = 13000  // Price for verifying a threshold signature
+	SGXVerifyWordGas           uint64 = 3      // Per-word price for hashing an Ed25519 message when verifying
+	SGXECDHGas                 uint64 = 100000 // Price for ECDH with a stored key, storing the shared key
+	SGXRandomGas               uint64 = 1000   // Base price for generating randomness
+	SGXRandomWordGas           uint64 = 60     // Per-word price for generating randomness
+	SGXCipherGas               uint64 = 3000   // Base price for encrypting or decrypting with a stored key
+	SGXCipherWordGas           uint64 = 6      // Per-word price for encrypting or decrypting
+	SGXKeyDeriveGas            uint64 = 50000  // Base price for deriving and storing a child key
+	SGXKeyDerivePathElementGas uint64 = 8000   // Per-path-element price for deriving a child key
+	SGXKeyDeleteGas            uint64 = 60000  // Price for deleting a stored key
+	SGXTransferOwnershipGas    uint64 = 10000  // Price for transferring the ownership of a stored key
+	SGXGrantPermissionGas      uint64 = 50000  // Price for granting a key permission
+	SGXRevokePermissionGas     uint64 = 10000  // Price for revoking a key permission
+
+	// Gas schedule of the native governance contract. Calls iterating over the
+	// validators, proposals or the whitelist are charged per entry they read.
+	GovernanceReadGas      uint64 = 20000  // Price for reading a proposal, validator or whitelist entry
+	GovernanceListGas      uint64 = 200000 // Base price for listing validators, proposals or the whitelist, or tallying a proposal
+	GovernanceListEntryGas uint64 = 10000  // Per-entry price for reading a listed validator, proposal or whitelist entry
+	GovernanceProposeGas   uint64 = 300000 // Price for creating a proposal
+	GovernanceWordGas      uint64 = 20000  // Per-word price for storing the arguments of a proposal
+	GovernanceVoteGas      uint64 = 100000 // Price for casting a vote
+	GovernanceExecuteGas   uint64 = 100000 // Price for executing a passed proposal
+	GovernanceStakeGas     uint64 = 200000 // Price for staking, unstaking or claiming rewards
+
 	// The Refund Quotient is the cap on how much of the used gas can be refunded. Before EIP-3529,
 	// up to half the consumed gas could be refunded. Redefined as 1/5th in EIP-3529
 	RefundQuotient        uint64 = 2
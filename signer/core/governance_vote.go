@@ -0,0 +1,47 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/governance"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// validateGovernanceVote checks that typed data claiming to be an SGX
+// governance vote is exactly such a vote for the chain the signer is
+// configured for, and describes the vote to the UI and the rules. Votes for
+// other chains are refused outright.
+func validateGovernanceVote(typedData apitypes.TypedData, chainID *big.Int) (*apitypes.ValidationMessages, error) {
+	vote, err := governance.ParseVoteTypedData(typedData)
+	if err != nil {
+		return nil, err
+	}
+	if vote.Domain.ChainID.Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("governance vote for chain %v, signer is configured for chain %v", vote.Domain.ChainID, chainID)
+	}
+	choice := "against"
+	if vote.Support {
+		choice = "for"
+	}
+	msgs := new(apitypes.ValidationMessages)
+	msgs.Info(fmt.Sprintf("Governance vote %s proposal %v with weight %d on governance contract %v",
+		choice, vote.ProposalID.Hex(), vote.Weight, vote.Domain.Governance.Hex()))
+	return msgs, nil
+}
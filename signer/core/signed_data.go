@@ -29,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/governance"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/signer/core/apitypes"
 )
@@ -167,7 +168,7 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 	case apitypes.DataTyped.Mime:
 		// EIP-712 conformant typed data
 		var err error
-		req, err = typedDataRequest(data)
+		req, err = api.typedDataRequest(data)
 		if err != nil {
 			return nil, useEthereumV, err
 		}
@@ -233,14 +234,14 @@ func (api *SignerAPI) SignTypedData(ctx context.Context, addr common.MixedcaseAd
 // - the signature preimage (hash)
 func (api *SignerAPI) signTypedData(ctx context.Context, addr common.MixedcaseAddress,
 	typedData apitypes.TypedData, validationMessages *apitypes.ValidationMessages) (hexutil.Bytes, hexutil.Bytes, error) {
-	req, err := typedDataRequest(typedData)
+	req, err := api.typedDataRequest(typedData)
 	if err != nil {
 		return nil, nil, err
 	}
 	req.Address = addr
 	req.Meta = MetadataFromContext(ctx)
 	if validationMessages != nil {
-		req.Callinfo = validationMessages.Messages
+		req.Callinfo = append(req.Callinfo, validationMessages.Messages...)
 	}
 	signature, err := api.sign(req, true)
 	if err != nil {
@@ -261,7 +262,8 @@ func fromHex(data any) ([]byte, error) {
 }
 
 // typedDataRequest tries to convert the data into a SignDataRequest.
-func typedDataRequest(data any) (*SignDataRequest, error) {
+// Governance votes are validated and described in the call info.
+func (api *SignerAPI) typedDataRequest(data any) (*SignDataRequest, error) {
 	var typedData apitypes.TypedData
 	if td, ok := data.(apitypes.TypedData); ok {
 		typedData = td
@@ -282,11 +284,19 @@ func typedDataRequest(data any) (*SignDataRequest, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &SignDataRequest{
+	req := &SignDataRequest{
 		ContentType: apitypes.DataTyped.Mime,
 		Rawdata:     []byte(rawData),
 		Messages:    messages,
-		Hash:        sighash}, nil
+		Hash:        sighash}
+	if typedData.PrimaryType == governance.VotePrimaryType {
+		msgs, err := validateGovernanceVote(typedData, api.chainID)
+		if err != nil {
+			return nil, err
+		}
+		req.Callinfo = msgs.Messages
+	}
+	return req, nil
 }
 
 // EcRecover recovers the address associated with the given sig.
@@ -624,3 +624,56 @@ function ApproveSignData(r){
 		t.Fatalf("Expected approved")
 	}
 }
+
+func TestGovernanceVote(t *testing.T) {
+	t.Parallel()
+	js := `function ApproveSignData(r) {
+	if (r.content_type != "data/typed" || r.address.toLowerCase() != "0x694267f14675d7e1b9494fd8d72fefe1755710fa") {
+		return
+	}
+	var info = r.call_info || []
+	for (var i = 0; i < info.length; i++) {
+		var msg = info[i].message
+		if (info[i].type == "Info" && msg.indexOf("Governance vote ") == 0 &&
+			msg.slice(-42).toLowerCase() == "0x0000000000000000000000000000000000001001") {
+			return "Approve"
+		}
+	}
+}`
+	r, err := initRuleEngine(js)
+	if err != nil {
+		t.Fatalf("Couldn't create evaluator %v", err)
+	}
+	addr, _ := mixAddr("0x694267f14675d7e1b9494fd8d72fefe1755710fa")
+	vote := func(contract string) *core.SignDataRequest {
+		var info []apitypes.ValidationInfo
+		if contract != "" {
+			info = append(info, apitypes.ValidationInfo{
+				Typ:     apitypes.INFO,
+				Message: "Governance vote for proposal 0x" + strings.Repeat("01", 32) + " with weight 1 on governance contract " + contract,
+			})
+		}
+		return &core.SignDataRequest{
+			ContentType: apitypes.DataTyped.Mime,
+			Address:     *addr,
+			Callinfo:    info,
+			Meta:        core.Metadata{Remote: "remoteip", Local: "localip", Scheme: "inproc"},
+		}
+	}
+	for _, tt := range []struct {
+		req  *core.SignDataRequest
+		want bool
+	}{
+		{vote("0x0000000000000000000000000000000000001001"), true},
+		{vote("0x0000000000000000000000000000000000001002"), false},
+		{vote(""), false}, // Other typed data
+	} {
+		resp, err := r.ApproveSignData(tt.req)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if resp.Approved != tt.want {
+			t.Errorf("request %v: approved %v, want %v", tt.req.Callinfo, resp.Approved, tt.want)
+		}
+	}
+}
@@ -34,6 +34,10 @@ func (m *MockSyncManager) RequestSync(peerID common.Hash, secretTypes []SecretDa
 	return common.BytesToHash([]byte("request-id")), nil
 }
 
+func (m *MockSyncManager) RequestMasterSecret(peerID common.Hash) (common.Hash, error) {
+	return m.RequestSync(peerID, []SecretDataType{SecretTypeSharedSecret})
+}
+
 func (m *MockSyncManager) HandleSyncRequest(request *SyncRequest) (*SyncResponse, error) {
 	return &SyncResponse{}, nil
 }
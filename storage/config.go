@@ -33,6 +33,7 @@ const (
 	SecretTypeSealingKey   SecretDataType = 0x02
 	SecretTypeNodeIdentity SecretDataType = 0x03
 	SecretTypeSharedSecret SecretDataType = 0x04
+	SecretTypeKeyShare     SecretDataType = 0x05 // Share of a threshold key
 )
 
 // SecretData represents a secret data entry
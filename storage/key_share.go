@@ -0,0 +1,95 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Threshold keys of the SGX precompiles are split among attested nodes. The
+// dealer stores each node's share in its encrypted partition under an ID
+// naming the key and the receiving peer, and the SyncManager serves it to that
+// peer only, over the same attested channel as the master secret. Received
+// shares are stored under an ID naming only the key and are never served
+// again. Shares are opaque here; the key store verifies them on import.
+
+// keyShareSecretPrefix prefixes the IDs of key shares in the encrypted partition
+const keyShareSecretPrefix = "sgx-key-share-"
+
+// KeyShareSecretID returns the ID of a key share held for the given peer.
+// Shares held by the node itself use the zero peer ID.
+func KeyShareSecretID(keyID common.Hash, peerID common.Hash) string {
+	if peerID == (common.Hash{}) {
+		return keyShareSecretPrefix + keyID.Hex()
+	}
+	return keyShareSecretPrefix + keyID.Hex() + "-" + peerID.Hex()
+}
+
+// parseKeyShareSecretID returns the key and peer of a key share ID.
+func parseKeyShareSecretID(id string) (keyID common.Hash, peerID common.Hash, ok bool) {
+	rest, found := strings.CutPrefix(id, keyShareSecretPrefix)
+	if !found {
+		return common.Hash{}, common.Hash{}, false
+	}
+	key, peer, hasPeer := strings.Cut(rest, "-")
+	if len(key) != 66 || (hasPeer && len(peer) != 66) {
+		return common.Hash{}, common.Hash{}, false
+	}
+	keyID = common.HexToHash(key)
+	if hasPeer {
+		peerID = common.HexToHash(peer)
+	}
+	return keyID, peerID, true
+}
+
+// StoreKeyShares stores the shares of a threshold key for distribution, keyed
+// by the ID of the receiving peer.
+func StoreKeyShares(partition EncryptedPartition, keyID common.Hash, shares map[common.Hash][]byte) error {
+	for peerID, share := range shares {
+		if peerID == (common.Hash{}) {
+			return fmt.Errorf("invalid peer ID for key share of %s", keyID.Hex())
+		}
+		if err := partition.WriteSecret(KeyShareSecretID(keyID, peerID), share); err != nil {
+			return fmt.Errorf("failed to store key share: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadKeyShares returns the key shares received by this node by key ID.
+func LoadKeyShares(partition EncryptedPartition) (map[common.Hash][]byte, error) {
+	ids, err := partition.ListSecrets()
+	if err != nil {
+		return nil, err
+	}
+	shares := make(map[common.Hash][]byte)
+	for _, id := range ids {
+		keyID, peerID, ok := parseKeyShareSecretID(id)
+		if !ok || peerID != (common.Hash{}) {
+			continue
+		}
+		data, err := partition.ReadSecret(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key share: %w", err)
+		}
+		shares[keyID] = data
+	}
+	return shares, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestSyncKeyShares(t *testing.T) {
+	var (
+		dealer = newMasterSecretTestPartition(t)
+		target = newMasterSecretTestPartition(t)
+		peer1  = common.BytesToHash([]byte("peer1"))
+		peer2  = common.BytesToHash([]byte("peer2"))
+		keyID  = common.Hash{0x01}
+	)
+	shares := map[common.Hash][]byte{peer1: []byte("share1"), peer2: []byte("share2")}
+	if err := StoreKeyShares(dealer, keyID, shares); err != nil {
+		t.Fatalf("Failed to store key shares: %v", err)
+	}
+	// Shares dealt to others are not the dealer's own
+	if own, err := LoadKeyShares(dealer); err != nil || len(own) != 0 {
+		t.Fatalf("Dealer holds shares %v (err %v)", own, err)
+	}
+	dealerManager := newMasterSecretTestSyncManager(t, dealer, peer1)
+	targetManager := newMasterSecretTestSyncManager(t, target, peer1)
+
+	// Shares are not part of other syncs
+	response, err := dealerManager.HandleSyncRequest(&SyncRequest{PeerID: peer1, SecretTypes: []SecretDataType{SecretTypePrivateKey}})
+	if err != nil {
+		t.Fatalf("Failed to handle sync request: %v", err)
+	}
+	if len(response.Secrets) != 0 {
+		t.Fatalf("Key shares shared without request")
+	}
+	requestID, err := targetManager.RequestSync(peer1, []SecretDataType{SecretTypeKeyShare})
+	if err != nil {
+		t.Fatalf("Failed to request key shares: %v", err)
+	}
+	response, err = dealerManager.HandleSyncRequest(&SyncRequest{RequestID: requestID, PeerID: peer1, SecretTypes: []SecretDataType{SecretTypeKeyShare}})
+	if err != nil {
+		t.Fatalf("Failed to handle sync request: %v", err)
+	}
+	// Only the share dealt to the requesting peer is sent
+	if len(response.Secrets) != 1 || response.Secrets[0].Type != SecretTypeKeyShare || !bytes.Equal(response.Secrets[0].Data, shares[peer1]) {
+		t.Fatalf("Unexpected secrets in response: %v", response.Secrets)
+	}
+	var imported []byte
+	targetManager.SetKeyShareHandler(func(id common.Hash, share []byte) error {
+		if id == keyID {
+			imported = share
+		}
+		return nil
+	})
+	response.PeerID = peer1
+	if err := targetManager.VerifyAndApplySync(response); err != nil {
+		t.Fatalf("Failed to apply key shares: %v", err)
+	}
+	if !bytes.Equal(imported, shares[peer1]) {
+		t.Fatalf("Key share handler got %q, want %q", imported, shares[peer1])
+	}
+	received, err := LoadKeyShares(target)
+	if err != nil || len(received) != 1 || !bytes.Equal(received[keyID], shares[peer1]) {
+		t.Fatalf("Received shares %v (err %v)", received, err)
+	}
+	// Received shares are not served to other peers
+	targetManager.peers[peer2] = &PeerInfo{PeerID: peer2, MREnclave: [32]byte{1}}
+	response, err = targetManager.HandleSyncRequest(&SyncRequest{PeerID: peer2, SecretTypes: []SecretDataType{SecretTypeKeyShare}})
+	if err != nil {
+		t.Fatalf("Failed to handle sync request: %v", err)
+	}
+	if len(response.Secrets) != 0 {
+		t.Errorf("Received key share served again: %v", response.Secrets)
+	}
+}
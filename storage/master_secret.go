@@ -0,0 +1,106 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The network master secret is the root of the keys created by the SGX
+// precompiles. The first node of a network generates it (bootstrap), every
+// other node obtains it from an attested peer through the SyncManager. It is
+// only ever stored in the encrypted partition; the chain configuration may
+// publish a commitment to it, against which synced secrets are checked.
+
+// MasterSecretID is the ID of the network master secret in the encrypted partition
+const MasterSecretID = "network-master-secret"
+
+// MasterSecretLength is the length of the network master secret
+const MasterSecretLength = 32
+
+var (
+	ErrMasterSecretNotFound = errors.New("master secret not found")
+	ErrMasterSecretInvalid  = errors.New("invalid master secret")
+	ErrMasterSecretMismatch = errors.New("master secret does not match")
+)
+
+// MasterSecretCommitment returns the public commitment to a master secret
+func MasterSecretCommitment(secret []byte) common.Hash {
+	return crypto.Keccak256Hash([]byte("sgx-master-secret"), secret)
+}
+
+// LoadMasterSecret reads the master secret from the encrypted partition
+func LoadMasterSecret(partition EncryptedPartition) ([]byte, error) {
+	secret, err := partition.ReadSecret(MasterSecretID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrMasterSecretNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != MasterSecretLength {
+		return nil, fmt.Errorf("%w: length %d", ErrMasterSecretInvalid, len(secret))
+	}
+	return secret, nil
+}
+
+// BootstrapMasterSecret returns the master secret in the encrypted partition,
+// generating a new one if none exists. Only the first node of a network may
+// bootstrap, all others must sync the secret.
+func BootstrapMasterSecret(partition EncryptedPartition) ([]byte, error) {
+	secret, err := LoadMasterSecret(partition)
+	if !errors.Is(err, ErrMasterSecretNotFound) {
+		return secret, err
+	}
+	secret = make([]byte, MasterSecretLength)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, fmt.Errorf("failed to generate master secret: %w", err)
+	}
+	if err := partition.WriteSecret(MasterSecretID, secret); err != nil {
+		return nil, fmt.Errorf("failed to store master secret: %w", err)
+	}
+	return secret, nil
+}
+
+// verifyMasterSecret checks a master secret received from a peer against the
+// commitment, if any, and the master secret already stored.
+func verifyMasterSecret(partition EncryptedPartition, secret []byte, commitment common.Hash) error {
+	if len(secret) != MasterSecretLength {
+		return fmt.Errorf("%w: length %d", ErrMasterSecretInvalid, len(secret))
+	}
+	if commitment != (common.Hash{}) && MasterSecretCommitment(secret) != commitment {
+		return fmt.Errorf("%w: commitment", ErrMasterSecretMismatch)
+	}
+	existing, err := LoadMasterSecret(partition)
+	switch {
+	case errors.Is(err, ErrMasterSecretNotFound):
+		return nil
+	case err != nil:
+		return err
+	case subtle.ConstantTimeCompare(existing, secret) != 1:
+		return fmt.Errorf("%w: stored secret", ErrMasterSecretMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/internal/sgx"
+)
+
+// masterSecretTestAttestor reports a fixed MRENCLAVE.
+type masterSecretTestAttestor struct {
+	sgx.Attestor
+}
+
+func (masterSecretTestAttestor) GetMREnclave() []byte { return make([]byte, 32) }
+
+func newMasterSecretTestPartition(t *testing.T) EncryptedPartition {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("GRAMINE_ENCRYPTED_PATHS", dir)
+	partition, err := NewEncryptedPartition(dir)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	return partition
+}
+
+// newMasterSecretTestSyncManager returns a sync manager with one whitelisted peer.
+func newMasterSecretTestSyncManager(t *testing.T, partition EncryptedPartition, peerID common.Hash) *SyncManagerImpl {
+	t.Helper()
+
+	sm, err := NewSyncManager(partition, masterSecretTestAttestor{}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create sync manager: %v", err)
+	}
+	mrenclave := [32]byte{1}
+	sm.peers[peerID] = &PeerInfo{PeerID: peerID, MREnclave: mrenclave, SyncStatus: SyncStatusPending}
+	sm.UpdateAllowedEnclaves([][32]byte{mrenclave})
+	return sm
+}
+
+func TestBootstrapMasterSecret(t *testing.T) {
+	partition := newMasterSecretTestPartition(t)
+
+	if _, err := LoadMasterSecret(partition); !errors.Is(err, ErrMasterSecretNotFound) {
+		t.Fatalf("Expected ErrMasterSecretNotFound, got %v", err)
+	}
+	secret, err := BootstrapMasterSecret(partition)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap master secret: %v", err)
+	}
+	if len(secret) != MasterSecretLength {
+		t.Fatalf("Master secret length %d, want %d", len(secret), MasterSecretLength)
+	}
+	// Bootstrapping again keeps the existing secret
+	again, err := BootstrapMasterSecret(partition)
+	if err != nil || !bytes.Equal(secret, again) {
+		t.Errorf("Bootstrap replaced the master secret (err %v)", err)
+	}
+	loaded, err := LoadMasterSecret(partition)
+	if err != nil || !bytes.Equal(secret, loaded) {
+		t.Errorf("Loaded master secret differs (err %v)", err)
+	}
+}
+
+func TestSyncMasterSecret(t *testing.T) {
+	var (
+		source = newMasterSecretTestPartition(t)
+		target = newMasterSecretTestPartition(t)
+		peerID = common.BytesToHash([]byte("peer1"))
+	)
+	secret, err := BootstrapMasterSecret(source)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap master secret: %v", err)
+	}
+	sourceManager := newMasterSecretTestSyncManager(t, source, peerID)
+	targetManager := newMasterSecretTestSyncManager(t, target, peerID)
+	targetManager.SetMasterSecretCommitment(MasterSecretCommitment(secret))
+
+	var loaded []byte
+	targetManager.SetMasterSecretHandler(func(secret []byte) error {
+		loaded = bytes.Clone(secret)
+		return nil
+	})
+
+	// The master secret is not part of other syncs
+	response, err := sourceManager.HandleSyncRequest(&SyncRequest{PeerID: peerID, SecretTypes: []SecretDataType{SecretTypePrivateKey}})
+	if err != nil {
+		t.Fatalf("Failed to handle sync request: %v", err)
+	}
+	if len(response.Secrets) != 0 {
+		t.Fatalf("Master secret shared without request")
+	}
+	requestID, err := targetManager.RequestMasterSecret(peerID)
+	if err != nil {
+		t.Fatalf("Failed to request master secret: %v", err)
+	}
+	response, err = sourceManager.HandleSyncRequest(&SyncRequest{RequestID: requestID, PeerID: peerID, SecretTypes: []SecretDataType{SecretTypeSharedSecret}})
+	if err != nil {
+		t.Fatalf("Failed to handle sync request: %v", err)
+	}
+	response.PeerID = peerID
+
+	// A secret not matching the commitment is rejected
+	forged := *response
+	forged.Secrets = []SecretData{{Type: SecretTypeSharedSecret, ID: []byte(MasterSecretID), Data: make([]byte, MasterSecretLength)}}
+	if err := targetManager.VerifyAndApplySync(&forged); !errors.Is(err, ErrMasterSecretMismatch) {
+		t.Fatalf("Expected ErrMasterSecretMismatch, got %v", err)
+	}
+	if loaded != nil {
+		t.Fatal("Forged master secret loaded")
+	}
+	if err := targetManager.VerifyAndApplySync(response); err != nil {
+		t.Fatalf("Failed to apply master secret: %v", err)
+	}
+	synced, err := LoadMasterSecret(target)
+	if err != nil || !bytes.Equal(secret, synced) {
+		t.Errorf("Synced master secret differs (err %v)", err)
+	}
+	if !bytes.Equal(secret, loaded) {
+		t.Errorf("Synced master secret not loaded")
+	}
+}
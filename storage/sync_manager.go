@@ -44,6 +44,9 @@ type SyncManager interface {
 	// RequestSync initiates a sync request to a peer
 	RequestSync(peerID common.Hash, secretTypes []SecretDataType) (common.Hash, error)
 
+	// RequestMasterSecret initiates a request for the network master secret
+	RequestMasterSecret(peerID common.Hash) (common.Hash, error)
+
 	// HandleSyncRequest processes an incoming sync request
 	HandleSyncRequest(request *SyncRequest) (*SyncResponse, error)
 
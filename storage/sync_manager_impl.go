@@ -46,6 +46,11 @@ type SyncManagerImpl struct {
 	syncRequests     map[common.Hash]*SyncRequest
 	allowedEnclaves  map[[32]byte]bool
 	heartbeatRunning bool
+
+	masterSecretCommitment common.Hash               // expected master secret commitment, zero if unknown
+	masterSecretHandler    func(secret []byte) error // loads a synced master secret, nil if unset
+
+	keyShareHandler func(keyID common.Hash, share []byte) error // imports a received key share, nil if unset
 }
 
 // NewSyncManager creates a new sync manager
@@ -71,6 +76,74 @@ func (sm *SyncManagerImpl) UpdateAllowedEnclaves(enclaves [][32]byte) {
 	}
 }
 
+// SetMasterSecretCommitment sets the commitment synced master secrets must match
+func (sm *SyncManagerImpl) SetMasterSecretCommitment(commitment common.Hash) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.masterSecretCommitment = commitment
+}
+
+// SetMasterSecretHandler sets the function loading a synced master secret into
+// the key store. It is called once the secret is stored in the partition.
+func (sm *SyncManagerImpl) SetMasterSecretHandler(handler func(secret []byte) error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.masterSecretHandler = handler
+}
+
+// SetKeyShareHandler sets the function importing a received threshold key
+// share into the key store. It is called once the share is stored in the
+// partition.
+func (sm *SyncManagerImpl) SetKeyShareHandler(handler func(keyID common.Hash, share []byte) error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.keyShareHandler = handler
+}
+
+// Attest returns a quote of the local enclave over the given report data,
+// which binds the channel the secrets are sent over.
+func (sm *SyncManagerImpl) Attest(reportData []byte) ([]byte, error) {
+	return sm.attestor.GenerateQuote(reportData)
+}
+
+// AddAttestedPeer verifies the quote of a peer, its MRENCLAVE against the
+// whitelist and that its report data starts with the expected data, then
+// adds the peer.
+func (sm *SyncManagerImpl) AddAttestedPeer(peerID common.Hash, quote []byte, reportData []byte) error {
+	mrenclave, err := sgx.ExtractMREnclave(quote)
+	if err != nil {
+		return fmt.Errorf("invalid quote: %w", err)
+	}
+	data, err := sgx.ExtractReportData(quote)
+	if err != nil {
+		return fmt.Errorf("invalid quote: %w", err)
+	}
+	if len(reportData) > len(data) || subtle.ConstantTimeCompare(data[:len(reportData)], reportData) != 1 {
+		return fmt.Errorf("quote report data mismatch")
+	}
+	sm.mu.RLock()
+	allowed := sm.verifyMREnclaveConstantTime([32]byte(mrenclave))
+	sm.mu.RUnlock()
+	if !allowed {
+		return fmt.Errorf("peer MRENCLAVE not in whitelist")
+	}
+	return sm.AddPeer(peerID, [32]byte(mrenclave), quote)
+}
+
+// StoreKeyShares stores the shares of a threshold key dealt by this node for
+// distribution to the peers they are keyed by.
+func (sm *SyncManagerImpl) StoreKeyShares(keyID common.Hash, shares map[common.Hash][]byte) error {
+	return StoreKeyShares(sm.partition, keyID, shares)
+}
+
+// RequestMasterSecret initiates a request for the network master secret
+func (sm *SyncManagerImpl) RequestMasterSecret(peerID common.Hash) (common.Hash, error) {
+	return sm.RequestSync(peerID, []SecretDataType{SecretTypeSharedSecret})
+}
+
 // RequestSync initiates a sync request to a peer
 func (sm *SyncManagerImpl) RequestSync(peerID common.Hash, secretTypes []SecretDataType) (common.Hash, error) {
 	sm.mu.Lock()
@@ -131,6 +204,15 @@ func (sm *SyncManagerImpl) HandleSyncRequest(request *SyncRequest) (*SyncRespons
 	}
 
 	for _, id := range secretIDs {
+		// The master secret is only shared on explicit request
+		if id == MasterSecretID && !requestedTypes[SecretTypeSharedSecret] {
+			continue
+		}
+		// Key shares are only sent to the peer they were dealt to, on request
+		_, sharePeer, isShare := parseKeyShareSecretID(id)
+		if isShare && (sharePeer != request.PeerID || !requestedTypes[SecretTypeKeyShare]) {
+			continue
+		}
 		data, err := sm.partition.ReadSecret(id)
 		if err != nil {
 			continue
@@ -145,6 +227,12 @@ func (sm *SyncManagerImpl) HandleSyncRequest(request *SyncRequest) (*SyncRespons
 			Data:      data,
 			CreatedAt: uint64(time.Now().Unix()),
 		}
+		if id == MasterSecretID {
+			secret.Type = SecretTypeSharedSecret
+		}
+		if isShare {
+			secret.Type = SecretTypeKeyShare
+		}
 
 		// If no specific types requested, include all secrets
 		// If types requested, include all (client-side filtering)
@@ -184,11 +272,38 @@ func (sm *SyncManagerImpl) VerifyAndApplySync(response *SyncResponse) error {
 		return fmt.Errorf("peer MRENCLAVE verification failed")
 	}
 
+	// Never replace the master secret with a different one
+	var masterSecret []byte
+	for _, secret := range response.Secrets {
+		if string(secret.ID) == MasterSecretID {
+			if err := verifyMasterSecret(sm.partition, secret.Data, sm.masterSecretCommitment); err != nil {
+				return err
+			}
+			masterSecret = secret.Data
+		}
+	}
+
 	// Apply secrets to encrypted partition
 	for _, secret := range response.Secrets {
-		if err := sm.partition.WriteSecret(string(secret.ID), secret.Data); err != nil {
+		id := string(secret.ID)
+		// Received key shares are held by this node and never served again
+		keyID, _, isShare := parseKeyShareSecretID(id)
+		if isShare {
+			id = KeyShareSecretID(keyID, common.Hash{})
+		}
+		if err := sm.partition.WriteSecret(id, secret.Data); err != nil {
 			return fmt.Errorf("failed to write secret: %w", err)
 		}
+		if isShare && sm.keyShareHandler != nil {
+			if err := sm.keyShareHandler(keyID, secret.Data); err != nil {
+				return fmt.Errorf("failed to import key share: %w", err)
+			}
+		}
+	}
+	if masterSecret != nil && sm.masterSecretHandler != nil {
+		if err := sm.masterSecretHandler(masterSecret); err != nil {
+			return fmt.Errorf("failed to load master secret: %w", err)
+		}
 	}
 
 	// Update peer status